@@ -31,3 +31,18 @@ func AdminGetInviteCodes(ctx context.Context, c *xrpc.Client, cursor string, lim
 
 	return &out, nil
 }
+
+// AdminGetInviteCodesAll calls AdminGetInviteCodes for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "codes", paced according to rate limits; see xrpc.Paginate.
+func AdminGetInviteCodesAll(ctx context.Context, c *xrpc.Client, limit int64, sort string) func(yield func(*ServerDefs_InviteCode, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*ServerDefs_InviteCode, string, error) {
+		out, err := AdminGetInviteCodes(ctx, c, cursor, limit, sort)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Codes, next, nil
+	})
+}
@@ -39,3 +39,18 @@ func AdminQueryModerationEvents(ctx context.Context, c *xrpc.Client, createdBy s
 
 	return &out, nil
 }
+
+// AdminQueryModerationEventsAll calls AdminQueryModerationEvents for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "events", paced according to rate limits; see xrpc.Paginate.
+func AdminQueryModerationEventsAll(ctx context.Context, c *xrpc.Client, createdBy string, includeAllUserRecords bool, limit int64, sortDirection string, subject string, types []string) func(yield func(*AdminDefs_ModEventView, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*AdminDefs_ModEventView, string, error) {
+		out, err := AdminQueryModerationEvents(ctx, c, createdBy, cursor, includeAllUserRecords, limit, sortDirection, subject, types)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Events, next, nil
+	})
+}
@@ -53,3 +53,18 @@ func AdminQueryModerationStatuses(ctx context.Context, c *xrpc.Client, comment s
 
 	return &out, nil
 }
+
+// AdminQueryModerationStatusesAll calls AdminQueryModerationStatuses for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "subjectStatuses", paced according to rate limits; see xrpc.Paginate.
+func AdminQueryModerationStatusesAll(ctx context.Context, c *xrpc.Client, comment string, ignoreSubjects []string, includeMuted bool, lastReviewedBy string, limit int64, reportedAfter string, reportedBefore string, reviewState string, reviewedAfter string, reviewedBefore string, sortDirection string, sortField string, subject string, takendown bool) func(yield func(*AdminDefs_SubjectStatusView, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*AdminDefs_SubjectStatusView, string, error) {
+		out, err := AdminQueryModerationStatuses(ctx, c, comment, cursor, ignoreSubjects, includeMuted, lastReviewedBy, limit, reportedAfter, reportedBefore, reviewState, reviewedAfter, reviewedBefore, sortDirection, sortField, subject, takendown)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.SubjectStatuses, next, nil
+	})
+}
@@ -34,3 +34,18 @@ func AdminSearchRepos(ctx context.Context, c *xrpc.Client, cursor string, limit
 
 	return &out, nil
 }
+
+// AdminSearchReposAll calls AdminSearchRepos for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "repos", paced according to rate limits; see xrpc.Paginate.
+func AdminSearchReposAll(ctx context.Context, c *xrpc.Client, limit int64, q string, term string) func(yield func(*AdminDefs_RepoView, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*AdminDefs_RepoView, string, error) {
+		out, err := AdminSearchRepos(ctx, c, cursor, limit, q, term)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Repos, next, nil
+	})
+}
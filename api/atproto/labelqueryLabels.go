@@ -35,3 +35,18 @@ func LabelQueryLabels(ctx context.Context, c *xrpc.Client, cursor string, limit
 
 	return &out, nil
 }
+
+// LabelQueryLabelsAll calls LabelQueryLabels for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "labels", paced according to rate limits; see xrpc.Paginate.
+func LabelQueryLabelsAll(ctx context.Context, c *xrpc.Client, limit int64, sources []string, uriPatterns []string) func(yield func(*LabelDefs_Label, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*LabelDefs_Label, string, error) {
+		out, err := LabelQueryLabels(ctx, c, cursor, limit, sources, uriPatterns)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Labels, next, nil
+	})
+}
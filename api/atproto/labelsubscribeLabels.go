@@ -4,6 +4,14 @@ package atproto
 
 // schema: com.atproto.label.subscribeLabels
 
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
 // LabelSubscribeLabels_Info is a "info" in the com.atproto.label.subscribeLabels schema.
 type LabelSubscribeLabels_Info struct {
 	Message *string `json:"message,omitempty" cborgen:"message,omitempty"`
@@ -15,3 +23,47 @@ type LabelSubscribeLabels_Labels struct {
 	Labels []*LabelDefs_Label `json:"labels" cborgen:"labels"`
 	Seq    int64              `json:"seq" cborgen:"seq"`
 }
+
+// LabelSubscribeLabels_Params are the query parameters of a com.atproto.label.subscribeLabels call.
+type LabelSubscribeLabels_Params struct {
+	// The last known event seq number to backfill from.
+	Cursor *int64
+}
+
+// LabelSubscribeLabels_Callbacks are called by LabelSubscribeLabels for the messages of the "com.atproto.label.subscribeLabels" event stream; messages without a callback are skipped.
+type LabelSubscribeLabels_Callbacks struct {
+	Labels func(evt *LabelSubscribeLabels_Labels) error
+	Info   func(evt *LabelSubscribeLabels_Info) error
+}
+
+// LabelSubscribeLabels subscribes to the event stream of "com.atproto.label.subscribeLabels", calling the callbacks for each message until the context is done, the stream ends, or a callback returns an error. Unset optional parameters are omitted.
+func LabelSubscribeLabels(ctx context.Context, c *xrpc.Client, p *LabelSubscribeLabels_Params, cb *LabelSubscribeLabels_Callbacks) error {
+	params := map[string]interface{}{}
+	if p.Cursor != nil {
+		params["cursor"] = *p.Cursor
+	}
+	return c.Subscribe(ctx, "com.atproto.label.subscribeLabels", params, func(msgType string, r io.Reader) error {
+		switch msgType {
+		case "#labels":
+			if cb.Labels == nil {
+				return nil
+			}
+			var evt LabelSubscribeLabels_Labels
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return fmt.Errorf("decoding %q message: %w", msgType, err)
+			}
+			return cb.Labels(&evt)
+		case "#info":
+			if cb.Info == nil {
+				return nil
+			}
+			var evt LabelSubscribeLabels_Info
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return fmt.Errorf("decoding %q message: %w", msgType, err)
+			}
+			return cb.Info(&evt)
+		default:
+			return nil
+		}
+	})
+}
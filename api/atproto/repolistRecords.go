@@ -50,3 +50,18 @@ func RepoListRecords(ctx context.Context, c *xrpc.Client, collection string, cur
 
 	return &out, nil
 }
+
+// RepoListRecordsAll calls RepoListRecords for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "records", paced according to rate limits; see xrpc.Paginate.
+func RepoListRecordsAll(ctx context.Context, c *xrpc.Client, collection string, limit int64, repo string, reverse bool, rkeyEnd string, rkeyStart string) func(yield func(*RepoListRecords_Record, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*RepoListRecords_Record, string, error) {
+		out, err := RepoListRecords(ctx, c, collection, cursor, limit, repo, reverse, rkeyEnd, rkeyStart)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Records, next, nil
+	})
+}
@@ -7,6 +7,7 @@ package atproto
 import (
 	"bytes"
 	"context"
+	"io"
 
 	"github.com/bluesky-social/indigo/xrpc"
 )
@@ -28,3 +29,12 @@ func SyncGetBlob(ctx context.Context, c *xrpc.Client, cid string, did string) ([
 
 	return buf.Bytes(), nil
 }
+
+// SyncGetBlobStream calls the XRPC method "com.atproto.sync.getBlob", returning the response body (which the caller must close) without buffering it in memory.
+func SyncGetBlobStream(ctx context.Context, c *xrpc.Client, cid string, did string) (io.ReadCloser, error) {
+	params := map[string]interface{}{
+		"cid": cid,
+		"did": did,
+	}
+	return c.DoStream(ctx, xrpc.Query, "", "com.atproto.sync.getBlob", params, nil)
+}
@@ -7,6 +7,7 @@ package atproto
 import (
 	"bytes"
 	"context"
+	"io"
 
 	"github.com/bluesky-social/indigo/xrpc"
 )
@@ -27,3 +28,12 @@ func SyncGetBlocks(ctx context.Context, c *xrpc.Client, cids []string, did strin
 
 	return buf.Bytes(), nil
 }
+
+// SyncGetBlocksStream calls the XRPC method "com.atproto.sync.getBlocks", returning the response body (which the caller must close) without buffering it in memory.
+func SyncGetBlocksStream(ctx context.Context, c *xrpc.Client, cids []string, did string) (io.ReadCloser, error) {
+	params := map[string]interface{}{
+		"cids": cids,
+		"did":  did,
+	}
+	return c.DoStream(ctx, xrpc.Query, "", "com.atproto.sync.getBlocks", params, nil)
+}
@@ -7,6 +7,7 @@ package atproto
 import (
 	"bytes"
 	"context"
+	"io"
 
 	"github.com/bluesky-social/indigo/xrpc"
 )
@@ -26,3 +27,11 @@ func SyncGetCheckout(ctx context.Context, c *xrpc.Client, did string) ([]byte, e
 
 	return buf.Bytes(), nil
 }
+
+// SyncGetCheckoutStream calls the XRPC method "com.atproto.sync.getCheckout", returning the response body (which the caller must close) without buffering it in memory.
+func SyncGetCheckoutStream(ctx context.Context, c *xrpc.Client, did string) (io.ReadCloser, error) {
+	params := map[string]interface{}{
+		"did": did,
+	}
+	return c.DoStream(ctx, xrpc.Query, "", "com.atproto.sync.getCheckout", params, nil)
+}
@@ -7,6 +7,7 @@ package atproto
 import (
 	"bytes"
 	"context"
+	"io"
 
 	"github.com/bluesky-social/indigo/xrpc"
 )
@@ -30,3 +31,14 @@ func SyncGetRecord(ctx context.Context, c *xrpc.Client, collection string, commi
 
 	return buf.Bytes(), nil
 }
+
+// SyncGetRecordStream calls the XRPC method "com.atproto.sync.getRecord", returning the response body (which the caller must close) without buffering it in memory.
+func SyncGetRecordStream(ctx context.Context, c *xrpc.Client, collection string, commit string, did string, rkey string) (io.ReadCloser, error) {
+	params := map[string]interface{}{
+		"collection": collection,
+		"commit":     commit,
+		"did":        did,
+		"rkey":       rkey,
+	}
+	return c.DoStream(ctx, xrpc.Query, "", "com.atproto.sync.getRecord", params, nil)
+}
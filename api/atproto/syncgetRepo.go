@@ -7,6 +7,7 @@ package atproto
 import (
 	"bytes"
 	"context"
+	"io"
 
 	"github.com/bluesky-social/indigo/xrpc"
 )
@@ -28,3 +29,12 @@ func SyncGetRepo(ctx context.Context, c *xrpc.Client, did string, since string)
 
 	return buf.Bytes(), nil
 }
+
+// SyncGetRepoStream calls the XRPC method "com.atproto.sync.getRepo", returning the response body (which the caller must close) without buffering it in memory.
+func SyncGetRepoStream(ctx context.Context, c *xrpc.Client, did string, since string) (io.ReadCloser, error) {
+	params := map[string]interface{}{
+		"did":   did,
+		"since": since,
+	}
+	return c.DoStream(ctx, xrpc.Query, "", "com.atproto.sync.getRepo", params, nil)
+}
@@ -35,3 +35,18 @@ func SyncListBlobs(ctx context.Context, c *xrpc.Client, cursor string, did strin
 
 	return &out, nil
 }
+
+// SyncListBlobsAll calls SyncListBlobs for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "cids", paced according to rate limits; see xrpc.Paginate.
+func SyncListBlobsAll(ctx context.Context, c *xrpc.Client, did string, limit int64, since string) func(yield func(string, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]string, string, error) {
+		out, err := SyncListBlobs(ctx, c, cursor, did, limit, since)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Cids, next, nil
+	})
+}
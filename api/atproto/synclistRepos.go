@@ -37,3 +37,18 @@ func SyncListRepos(ctx context.Context, c *xrpc.Client, cursor string, limit int
 
 	return &out, nil
 }
+
+// SyncListReposAll calls SyncListRepos for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "repos", paced according to rate limits; see xrpc.Paginate.
+func SyncListReposAll(ctx context.Context, c *xrpc.Client, limit int64) func(yield func(*SyncListRepos_Repo, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*SyncListRepos_Repo, string, error) {
+		out, err := SyncListRepos(ctx, c, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Repos, next, nil
+	})
+}
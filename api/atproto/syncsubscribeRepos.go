@@ -5,9 +5,27 @@ package atproto
 // schema: com.atproto.sync.subscribeRepos
 
 import (
+	"context"
+	"fmt"
+	"io"
+
 	"github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/xrpc"
 )
 
+// SyncSubscribeRepos_Account is a "account" in the com.atproto.sync.subscribeRepos schema.
+//
+// Represents a change to an account's status on a host (eg, PDS or Relay). The semantics of this event are that the status is at the host which emitted the event, not necessarily that at the currently active PDS. Eg, a Relay takedown would emit a takedown with active=false, even if the PDS is still active.
+type SyncSubscribeRepos_Account struct {
+	// active: Indicates that the account has a repository which can be fetched from the host that emitted this event.
+	Active bool   `json:"active" cborgen:"active"`
+	Did    string `json:"did" cborgen:"did"`
+	Seq    int64  `json:"seq" cborgen:"seq"`
+	// status: If active=false, this optional field indicates a reason for why the account is not active.
+	Status *string `json:"status,omitempty" cborgen:"status,omitempty"`
+	Time   string  `json:"time" cborgen:"time"`
+}
+
 // SyncSubscribeRepos_Commit is a "commit" in the com.atproto.sync.subscribeRepos schema.
 type SyncSubscribeRepos_Commit struct {
 	Blobs []util.LexLink `json:"blobs" cborgen:"blobs"`
@@ -35,6 +53,17 @@ type SyncSubscribeRepos_Handle struct {
 	Time   string `json:"time" cborgen:"time"`
 }
 
+// SyncSubscribeRepos_Identity is a "identity" in the com.atproto.sync.subscribeRepos schema.
+//
+// Represents a change to an account's identity. Could be an updated handle, signing key, or pds hosting endpoint. Serves as a prod to all downstream services to refresh their identity cache.
+type SyncSubscribeRepos_Identity struct {
+	Did string `json:"did" cborgen:"did"`
+	// handle: The current handle for the account, or 'handle.invalid' if validation fails. This field is optional, might have been validated or passed-through from an upstream source. Semantics and behaviors for PDS vs Relay may evolve in the future; see atproto specs for more details.
+	Handle *string `json:"handle,omitempty" cborgen:"handle,omitempty"`
+	Seq    int64   `json:"seq" cborgen:"seq"`
+	Time   string  `json:"time" cborgen:"time"`
+}
+
 // SyncSubscribeRepos_Info is a "info" in the com.atproto.sync.subscribeRepos schema.
 type SyncSubscribeRepos_Info struct {
 	Message *string `json:"message,omitempty" cborgen:"message,omitempty"`
@@ -64,3 +93,97 @@ type SyncSubscribeRepos_Tombstone struct {
 	Seq  int64  `json:"seq" cborgen:"seq"`
 	Time string `json:"time" cborgen:"time"`
 }
+
+// SyncSubscribeRepos_Params are the query parameters of a com.atproto.sync.subscribeRepos call.
+type SyncSubscribeRepos_Params struct {
+	// The last known event seq number to backfill from.
+	Cursor *int64
+}
+
+// SyncSubscribeRepos_Callbacks are called by SyncSubscribeRepos for the messages of the "com.atproto.sync.subscribeRepos" event stream; messages without a callback are skipped.
+type SyncSubscribeRepos_Callbacks struct {
+	Commit    func(evt *SyncSubscribeRepos_Commit) error
+	Identity  func(evt *SyncSubscribeRepos_Identity) error
+	Account   func(evt *SyncSubscribeRepos_Account) error
+	Handle    func(evt *SyncSubscribeRepos_Handle) error
+	Migrate   func(evt *SyncSubscribeRepos_Migrate) error
+	Tombstone func(evt *SyncSubscribeRepos_Tombstone) error
+	Info      func(evt *SyncSubscribeRepos_Info) error
+}
+
+// SyncSubscribeRepos subscribes to the event stream of "com.atproto.sync.subscribeRepos", calling the callbacks for each message until the context is done, the stream ends, or a callback returns an error. Unset optional parameters are omitted.
+func SyncSubscribeRepos(ctx context.Context, c *xrpc.Client, p *SyncSubscribeRepos_Params, cb *SyncSubscribeRepos_Callbacks) error {
+	params := map[string]interface{}{}
+	if p.Cursor != nil {
+		params["cursor"] = *p.Cursor
+	}
+	return c.Subscribe(ctx, "com.atproto.sync.subscribeRepos", params, func(msgType string, r io.Reader) error {
+		switch msgType {
+		case "#commit":
+			if cb.Commit == nil {
+				return nil
+			}
+			var evt SyncSubscribeRepos_Commit
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return fmt.Errorf("decoding %q message: %w", msgType, err)
+			}
+			return cb.Commit(&evt)
+		case "#identity":
+			if cb.Identity == nil {
+				return nil
+			}
+			var evt SyncSubscribeRepos_Identity
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return fmt.Errorf("decoding %q message: %w", msgType, err)
+			}
+			return cb.Identity(&evt)
+		case "#account":
+			if cb.Account == nil {
+				return nil
+			}
+			var evt SyncSubscribeRepos_Account
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return fmt.Errorf("decoding %q message: %w", msgType, err)
+			}
+			return cb.Account(&evt)
+		case "#handle":
+			if cb.Handle == nil {
+				return nil
+			}
+			var evt SyncSubscribeRepos_Handle
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return fmt.Errorf("decoding %q message: %w", msgType, err)
+			}
+			return cb.Handle(&evt)
+		case "#migrate":
+			if cb.Migrate == nil {
+				return nil
+			}
+			var evt SyncSubscribeRepos_Migrate
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return fmt.Errorf("decoding %q message: %w", msgType, err)
+			}
+			return cb.Migrate(&evt)
+		case "#tombstone":
+			if cb.Tombstone == nil {
+				return nil
+			}
+			var evt SyncSubscribeRepos_Tombstone
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return fmt.Errorf("decoding %q message: %w", msgType, err)
+			}
+			return cb.Tombstone(&evt)
+		case "#info":
+			if cb.Info == nil {
+				return nil
+			}
+			var evt SyncSubscribeRepos_Info
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return fmt.Errorf("decoding %q message: %w", msgType, err)
+			}
+			return cb.Info(&evt)
+		default:
+			return nil
+		}
+	})
+}
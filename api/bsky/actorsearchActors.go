@@ -35,3 +35,18 @@ func ActorSearchActors(ctx context.Context, c *xrpc.Client, cursor string, limit
 
 	return &out, nil
 }
+
+// ActorSearchActorsAll calls ActorSearchActors for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "actors", paced according to rate limits; see xrpc.Paginate.
+func ActorSearchActorsAll(ctx context.Context, c *xrpc.Client, limit int64, q string, term string) func(yield func(*ActorDefs_ProfileView, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*ActorDefs_ProfileView, string, error) {
+		out, err := ActorSearchActors(ctx, c, cursor, limit, q, term)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Actors, next, nil
+	})
+}
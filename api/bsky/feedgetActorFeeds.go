@@ -31,3 +31,18 @@ func FeedGetActorFeeds(ctx context.Context, c *xrpc.Client, actor string, cursor
 
 	return &out, nil
 }
+
+// FeedGetActorFeedsAll calls FeedGetActorFeeds for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "feeds", paced according to rate limits; see xrpc.Paginate.
+func FeedGetActorFeedsAll(ctx context.Context, c *xrpc.Client, actor string, limit int64) func(yield func(*FeedDefs_GeneratorView, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*FeedDefs_GeneratorView, string, error) {
+		out, err := FeedGetActorFeeds(ctx, c, actor, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Feeds, next, nil
+	})
+}
@@ -32,3 +32,18 @@ func FeedGetAuthorFeed(ctx context.Context, c *xrpc.Client, actor string, cursor
 
 	return &out, nil
 }
+
+// FeedGetAuthorFeedAll calls FeedGetAuthorFeed for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "feed", paced according to rate limits; see xrpc.Paginate.
+func FeedGetAuthorFeedAll(ctx context.Context, c *xrpc.Client, actor string, filter string, limit int64) func(yield func(*FeedDefs_FeedViewPost, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*FeedDefs_FeedViewPost, string, error) {
+		out, err := FeedGetAuthorFeed(ctx, c, actor, cursor, filter, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Feed, next, nil
+	})
+}
@@ -31,3 +31,18 @@ func FeedGetFeed(ctx context.Context, c *xrpc.Client, cursor string, feed string
 
 	return &out, nil
 }
+
+// FeedGetFeedAll calls FeedGetFeed for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "feed", paced according to rate limits; see xrpc.Paginate.
+func FeedGetFeedAll(ctx context.Context, c *xrpc.Client, feed string, limit int64) func(yield func(*FeedDefs_FeedViewPost, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*FeedDefs_FeedViewPost, string, error) {
+		out, err := FeedGetFeed(ctx, c, cursor, feed, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Feed, next, nil
+	})
+}
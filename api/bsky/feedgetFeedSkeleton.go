@@ -31,3 +31,18 @@ func FeedGetFeedSkeleton(ctx context.Context, c *xrpc.Client, cursor string, fee
 
 	return &out, nil
 }
+
+// FeedGetFeedSkeletonAll calls FeedGetFeedSkeleton for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "feed", paced according to rate limits; see xrpc.Paginate.
+func FeedGetFeedSkeletonAll(ctx context.Context, c *xrpc.Client, feed string, limit int64) func(yield func(*FeedDefs_SkeletonFeedPost, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*FeedDefs_SkeletonFeedPost, string, error) {
+		out, err := FeedGetFeedSkeleton(ctx, c, cursor, feed, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Feed, next, nil
+	})
+}
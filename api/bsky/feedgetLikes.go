@@ -41,3 +41,18 @@ func FeedGetLikes(ctx context.Context, c *xrpc.Client, cid string, cursor string
 
 	return &out, nil
 }
+
+// FeedGetLikesAll calls FeedGetLikes for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "likes", paced according to rate limits; see xrpc.Paginate.
+func FeedGetLikesAll(ctx context.Context, c *xrpc.Client, cid string, limit int64, uri string) func(yield func(*FeedGetLikes_Like, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*FeedGetLikes_Like, string, error) {
+		out, err := FeedGetLikes(ctx, c, cid, cursor, limit, uri)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Likes, next, nil
+	})
+}
@@ -31,3 +31,18 @@ func FeedGetListFeed(ctx context.Context, c *xrpc.Client, cursor string, limit i
 
 	return &out, nil
 }
+
+// FeedGetListFeedAll calls FeedGetListFeed for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "feed", paced according to rate limits; see xrpc.Paginate.
+func FeedGetListFeedAll(ctx context.Context, c *xrpc.Client, limit int64, list string) func(yield func(*FeedDefs_FeedViewPost, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*FeedDefs_FeedViewPost, string, error) {
+		out, err := FeedGetListFeed(ctx, c, cursor, limit, list)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Feed, next, nil
+	})
+}
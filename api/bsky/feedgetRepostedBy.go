@@ -34,3 +34,18 @@ func FeedGetRepostedBy(ctx context.Context, c *xrpc.Client, cid string, cursor s
 
 	return &out, nil
 }
+
+// FeedGetRepostedByAll calls FeedGetRepostedBy for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "repostedBy", paced according to rate limits; see xrpc.Paginate.
+func FeedGetRepostedByAll(ctx context.Context, c *xrpc.Client, cid string, limit int64, uri string) func(yield func(*ActorDefs_ProfileView, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*ActorDefs_ProfileView, string, error) {
+		out, err := FeedGetRepostedBy(ctx, c, cid, cursor, limit, uri)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.RepostedBy, next, nil
+	})
+}
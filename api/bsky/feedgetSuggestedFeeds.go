@@ -30,3 +30,18 @@ func FeedGetSuggestedFeeds(ctx context.Context, c *xrpc.Client, cursor string, l
 
 	return &out, nil
 }
+
+// FeedGetSuggestedFeedsAll calls FeedGetSuggestedFeeds for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "feeds", paced according to rate limits; see xrpc.Paginate.
+func FeedGetSuggestedFeedsAll(ctx context.Context, c *xrpc.Client, limit int64) func(yield func(*FeedDefs_GeneratorView, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*FeedDefs_GeneratorView, string, error) {
+		out, err := FeedGetSuggestedFeeds(ctx, c, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Feeds, next, nil
+	})
+}
@@ -36,3 +36,18 @@ func FeedSearchPosts(ctx context.Context, c *xrpc.Client, cursor string, limit i
 
 	return &out, nil
 }
+
+// FeedSearchPostsAll calls FeedSearchPosts for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "posts", paced according to rate limits; see xrpc.Paginate.
+func FeedSearchPostsAll(ctx context.Context, c *xrpc.Client, limit int64, q string) func(yield func(*FeedDefs_PostView, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*FeedDefs_PostView, string, error) {
+		out, err := FeedSearchPosts(ctx, c, cursor, limit, q)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Posts, next, nil
+	})
+}
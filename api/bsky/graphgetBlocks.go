@@ -30,3 +30,18 @@ func GraphGetBlocks(ctx context.Context, c *xrpc.Client, cursor string, limit in
 
 	return &out, nil
 }
+
+// GraphGetBlocksAll calls GraphGetBlocks for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "blocks", paced according to rate limits; see xrpc.Paginate.
+func GraphGetBlocksAll(ctx context.Context, c *xrpc.Client, limit int64) func(yield func(*ActorDefs_ProfileView, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*ActorDefs_ProfileView, string, error) {
+		out, err := GraphGetBlocks(ctx, c, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Blocks, next, nil
+	})
+}
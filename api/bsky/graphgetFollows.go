@@ -32,3 +32,18 @@ func GraphGetFollows(ctx context.Context, c *xrpc.Client, actor string, cursor s
 
 	return &out, nil
 }
+
+// GraphGetFollowsAll calls GraphGetFollows for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "follows", paced according to rate limits; see xrpc.Paginate.
+func GraphGetFollowsAll(ctx context.Context, c *xrpc.Client, actor string, limit int64) func(yield func(*ActorDefs_ProfileView, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*ActorDefs_ProfileView, string, error) {
+		out, err := GraphGetFollows(ctx, c, actor, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Follows, next, nil
+	})
+}
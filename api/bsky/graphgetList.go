@@ -32,3 +32,18 @@ func GraphGetList(ctx context.Context, c *xrpc.Client, cursor string, limit int6
 
 	return &out, nil
 }
+
+// GraphGetListAll calls GraphGetList for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "items", paced according to rate limits; see xrpc.Paginate.
+func GraphGetListAll(ctx context.Context, c *xrpc.Client, limit int64, list string) func(yield func(*GraphDefs_ListItemView, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*GraphDefs_ListItemView, string, error) {
+		out, err := GraphGetList(ctx, c, cursor, limit, list)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Items, next, nil
+	})
+}
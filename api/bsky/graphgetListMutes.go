@@ -30,3 +30,18 @@ func GraphGetListMutes(ctx context.Context, c *xrpc.Client, cursor string, limit
 
 	return &out, nil
 }
+
+// GraphGetListMutesAll calls GraphGetListMutes for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "lists", paced according to rate limits; see xrpc.Paginate.
+func GraphGetListMutesAll(ctx context.Context, c *xrpc.Client, limit int64) func(yield func(*GraphDefs_ListView, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*GraphDefs_ListView, string, error) {
+		out, err := GraphGetListMutes(ctx, c, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Lists, next, nil
+	})
+}
@@ -31,3 +31,18 @@ func GraphGetLists(ctx context.Context, c *xrpc.Client, actor string, cursor str
 
 	return &out, nil
 }
+
+// GraphGetListsAll calls GraphGetLists for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "lists", paced according to rate limits; see xrpc.Paginate.
+func GraphGetListsAll(ctx context.Context, c *xrpc.Client, actor string, limit int64) func(yield func(*GraphDefs_ListView, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*GraphDefs_ListView, string, error) {
+		out, err := GraphGetLists(ctx, c, actor, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Lists, next, nil
+	})
+}
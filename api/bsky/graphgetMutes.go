@@ -30,3 +30,18 @@ func GraphGetMutes(ctx context.Context, c *xrpc.Client, cursor string, limit int
 
 	return &out, nil
 }
+
+// GraphGetMutesAll calls GraphGetMutes for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "mutes", paced according to rate limits; see xrpc.Paginate.
+func GraphGetMutesAll(ctx context.Context, c *xrpc.Client, limit int64) func(yield func(*ActorDefs_ProfileView, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*ActorDefs_ProfileView, string, error) {
+		out, err := GraphGetMutes(ctx, c, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Mutes, next, nil
+	})
+}
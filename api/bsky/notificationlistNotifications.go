@@ -47,3 +47,18 @@ func NotificationListNotifications(ctx context.Context, c *xrpc.Client, cursor s
 
 	return &out, nil
 }
+
+// NotificationListNotificationsAll calls NotificationListNotifications for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "notifications", paced according to rate limits; see xrpc.Paginate.
+func NotificationListNotificationsAll(ctx context.Context, c *xrpc.Client, limit int64, seenAt string) func(yield func(*NotificationListNotifications_Notification, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*NotificationListNotifications_Notification, string, error) {
+		out, err := NotificationListNotifications(ctx, c, cursor, limit, seenAt)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Notifications, next, nil
+	})
+}
@@ -31,3 +31,18 @@ func UnspeccedGetPopular(ctx context.Context, c *xrpc.Client, cursor string, inc
 
 	return &out, nil
 }
+
+// UnspeccedGetPopularAll calls UnspeccedGetPopular for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "feed", paced according to rate limits; see xrpc.Paginate.
+func UnspeccedGetPopularAll(ctx context.Context, c *xrpc.Client, includeNsfw bool, limit int64) func(yield func(*FeedDefs_FeedViewPost, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*FeedDefs_FeedViewPost, string, error) {
+		out, err := UnspeccedGetPopular(ctx, c, cursor, includeNsfw, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Feed, next, nil
+	})
+}
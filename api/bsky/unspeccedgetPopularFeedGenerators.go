@@ -31,3 +31,18 @@ func UnspeccedGetPopularFeedGenerators(ctx context.Context, c *xrpc.Client, curs
 
 	return &out, nil
 }
+
+// UnspeccedGetPopularFeedGeneratorsAll calls UnspeccedGetPopularFeedGenerators for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "feeds", paced according to rate limits; see xrpc.Paginate.
+func UnspeccedGetPopularFeedGeneratorsAll(ctx context.Context, c *xrpc.Client, limit int64, query string) func(yield func(*FeedDefs_GeneratorView, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*FeedDefs_GeneratorView, string, error) {
+		out, err := UnspeccedGetPopularFeedGenerators(ctx, c, cursor, limit, query)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Feeds, next, nil
+	})
+}
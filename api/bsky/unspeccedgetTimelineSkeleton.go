@@ -30,3 +30,18 @@ func UnspeccedGetTimelineSkeleton(ctx context.Context, c *xrpc.Client, cursor st
 
 	return &out, nil
 }
+
+// UnspeccedGetTimelineSkeletonAll calls UnspeccedGetTimelineSkeleton for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "feed", paced according to rate limits; see xrpc.Paginate.
+func UnspeccedGetTimelineSkeletonAll(ctx context.Context, c *xrpc.Client, limit int64) func(yield func(*FeedDefs_SkeletonFeedPost, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*FeedDefs_SkeletonFeedPost, string, error) {
+		out, err := UnspeccedGetTimelineSkeleton(ctx, c, cursor, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Feed, next, nil
+	})
+}
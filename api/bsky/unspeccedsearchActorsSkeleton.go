@@ -38,3 +38,18 @@ func UnspeccedSearchActorsSkeleton(ctx context.Context, c *xrpc.Client, cursor s
 
 	return &out, nil
 }
+
+// UnspeccedSearchActorsSkeletonAll calls UnspeccedSearchActorsSkeleton for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "actors", paced according to rate limits; see xrpc.Paginate.
+func UnspeccedSearchActorsSkeletonAll(ctx context.Context, c *xrpc.Client, limit int64, q string, typeahead bool) func(yield func(*UnspeccedDefs_SkeletonSearchActor, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*UnspeccedDefs_SkeletonSearchActor, string, error) {
+		out, err := UnspeccedSearchActorsSkeleton(ctx, c, cursor, limit, q, typeahead)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Actors, next, nil
+	})
+}
@@ -36,3 +36,18 @@ func UnspeccedSearchPostsSkeleton(ctx context.Context, c *xrpc.Client, cursor st
 
 	return &out, nil
 }
+
+// UnspeccedSearchPostsSkeletonAll calls UnspeccedSearchPostsSkeleton for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their "posts", paced according to rate limits; see xrpc.Paginate.
+func UnspeccedSearchPostsSkeletonAll(ctx context.Context, c *xrpc.Client, limit int64, q string) func(yield func(*UnspeccedDefs_SkeletonSearchPost, error) bool) {
+	return xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]*UnspeccedDefs_SkeletonSearchPost, string, error) {
+		out, err := UnspeccedSearchPostsSkeleton(ctx, c, cursor, limit, q)
+		if err != nil {
+			return nil, "", err
+		}
+		var next string
+		if out.Cursor != nil {
+			next = *out.Cursor
+		}
+		return out.Posts, next, nil
+	})
+}
@@ -0,0 +1,129 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	otel "go.opentelemetry.io/otel"
+)
+
+// RelayHost is a PDS host known to a relay, with the state of its subscription, as listed by the relay's admin API.
+type RelayHost struct {
+	ID         uint   `json:"ID"`
+	Host       string `json:"Host"`
+	Registered bool   `json:"Registered"`
+	Blocked    bool   `json:"Blocked"`
+	Paused     bool   `json:"Paused"`
+	// Maximum number of repos accepted from the host; zero for no limit
+	RepoLimit int64 `json:"RepoLimit"`
+	RepoCount int64 `json:"RepoCount"`
+	// The sequence number of the last event consumed from the host
+	Cursor    int64 `json:"Cursor"`
+	Connected bool  `json:"Connected"`
+	// Only set while connected
+	ConnectedAt *time.Time `json:"ConnectedAt,omitempty"`
+	LastEventAt *time.Time `json:"LastEventAt,omitempty"`
+	// Seconds since the last event from the host (or since the connection, if there was none), while connected
+	Lag                float64 `json:"Lag"`
+	EventsSinceConnect uint64  `json:"EventsSinceConnect"`
+	EventsSinceStartup uint64  `json:"EventsSinceStartup"`
+	IngestRateLimit    float64 `json:"IngestRateLimit"`
+	CrawlRateLimit     float64 `json:"CrawlRateLimit"`
+}
+
+// RelayPurgeResult is the outcome of purging a host from a relay.
+type RelayPurgeResult struct {
+	Host         string `json:"Host"`
+	ReposDeleted int64  `json:"ReposDeleted"`
+}
+
+// RelayAdminClient calls the host management endpoints of the admin API of a relay (like bigsky).
+type RelayAdminClient struct {
+	// Base URL of the relay, like "https://bsky.network"
+	Host     string
+	AdminKey string
+	C        *http.Client
+}
+
+// relayAdminError is the body of error responses of the admin API.
+type relayAdminError struct {
+	Message string `json:"message"`
+}
+
+func (c *RelayAdminClient) do(ctx context.Context, method, path string, params url.Values, out any) error {
+	ctx, span := otel.Tracer("relayadmin").Start(ctx, "relayAdmin")
+	defer span.End()
+
+	if c.C == nil {
+		c.C = http.DefaultClient
+	}
+
+	u := c.Host + "/admin" + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AdminKey)
+
+	resp, err := c.C.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		var e relayAdminError
+		if json.Unmarshal(body, &e) == nil && e.Message != "" {
+			return fmt.Errorf("relay admin request %s failed (code %d): %s", path, resp.StatusCode, e.Message)
+		}
+		return fmt.Errorf("relay admin request %s failed (code %d): %s", path, resp.StatusCode, resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// ListHosts returns all the hosts known to the relay.
+func (c *RelayAdminClient) ListHosts(ctx context.Context) ([]RelayHost, error) {
+	var out []RelayHost
+	if err := c.do(ctx, "GET", "/pds/hosts", nil, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PauseHost disconnects the relay from a host, and stops it from subscribing to it until it's resumed.
+func (c *RelayAdminClient) PauseHost(ctx context.Context, host string) error {
+	return c.do(ctx, "POST", "/pds/pause", url.Values{"host": {host}}, nil)
+}
+
+// ResumeHost lets the relay subscribe to a paused host again, resuming from its cursor.
+func (c *RelayAdminClient) ResumeHost(ctx context.Context, host string) error {
+	return c.do(ctx, "POST", "/pds/resume", url.Values{"host": {host}}, nil)
+}
+
+// SetHostRepoLimit sets the maximum number of repos the relay accepts from a host; zero removes the limit.
+func (c *RelayAdminClient) SetHostRepoLimit(ctx context.Context, host string, limit int64) error {
+	return c.do(ctx, "POST", "/pds/changeRepoLimit", url.Values{"host": {host}, "limit": {strconv.FormatInt(limit, 10)}}, nil)
+}
+
+// PurgeHost disconnects the relay from a host, and deletes the host and all of its repos and events from the relay.
+func (c *RelayAdminClient) PurgeHost(ctx context.Context, host string) (*RelayPurgeResult, error) {
+	var out RelayPurgeResult
+	if err := c.do(ctx, "POST", "/pds/purge", url.Values{"host": {host}}, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
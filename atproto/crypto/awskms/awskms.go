@@ -0,0 +1,158 @@
+// Package awskms implements an atproto [crypto.Signer] with a key held in AWS KMS.
+package awskms
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// Loads AWS credentials from the standard environment variables (AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and optionally AWS_SESSION_TOKEN).
+func CredentialsFromEnv() (aws.Credentials, error) {
+	creds := aws.Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, fmt.Errorf("awskms: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	return creds, nil
+}
+
+type Config struct {
+	// ID, ARN, or alias ("alias/...") of an asymmetric KMS key, of key spec ECC_NIST_P256 or ECC_SECG_P256K1, with key usage SIGN_VERIFY
+	KeyID string
+	// AWS region of the key, eg "us-east-1"
+	Region string
+	// KMS API endpoint; "https://kms.<region>.amazonaws.com" if empty
+	Endpoint string
+	// from the environment (see CredentialsFromEnv) if empty
+	Credentials aws.Credentials
+	// http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// Implements [crypto.Signer] with a key held in AWS KMS, which never leaves it. Requests are made directly to the KMS JSON API, signed with AWS Signature Version 4.
+type Signer struct {
+	cfg    Config
+	pub    crypto.PublicKey
+	signer *v4.Signer
+}
+
+var _ crypto.Signer = (*Signer)(nil)
+
+// Creates a signer for a KMS key, fetching its public key up front.
+func NewSigner(ctx context.Context, cfg Config) (*Signer, error) {
+	if cfg.KeyID == "" || cfg.Region == "" {
+		return nil, fmt.Errorf("awskms: key ID and region are required")
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://kms." + cfg.Region + ".amazonaws.com"
+	}
+	if cfg.Credentials.AccessKeyID == "" {
+		creds, err := CredentialsFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		cfg.Credentials = creds
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	s := &Signer{cfg: cfg, signer: v4.NewSigner()}
+
+	var out struct {
+		PublicKey []byte
+		KeySpec   string
+		KeyUsage  string
+	}
+	if err := s.call(ctx, "GetPublicKey", map[string]any{"KeyId": cfg.KeyID}, &out); err != nil {
+		return nil, err
+	}
+	if out.KeyUsage != "SIGN_VERIFY" {
+		return nil, fmt.Errorf("awskms: key %s is not a signing key (usage %s)", cfg.KeyID, out.KeyUsage)
+	}
+	if out.KeySpec != "ECC_NIST_P256" && out.KeySpec != "ECC_SECG_P256K1" {
+		return nil, fmt.Errorf("awskms: unsupported key spec: %s", out.KeySpec)
+	}
+	pub, err := crypto.ParsePublicPKIX(out.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("awskms: public key: %w", err)
+	}
+	s.pub = pub
+	return s, nil
+}
+
+func (s *Signer) PublicKey() (crypto.PublicKey, error) {
+	return s.pub, nil
+}
+
+func (s *Signer) HashAndSign(ctx context.Context, content []byte) ([]byte, error) {
+	hash := sha256.Sum256(content)
+	var out struct {
+		Signature []byte
+	}
+	err := s.call(ctx, "Sign", map[string]any{
+		"KeyId":            s.cfg.KeyID,
+		"Message":          hash[:],
+		"MessageType":      "DIGEST",
+		"SigningAlgorithm": "ECDSA_SHA_256",
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.CompactSignatureASN1(s.pub, out.Signature)
+}
+
+// Calls an action of the KMS JSON API.
+func (s *Signer) call(ctx context.Context, action string, in, out any) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", s.cfg.Endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	bodyHash := sha256.Sum256(body)
+	if err := s.signer.SignHTTP(ctx, s.cfg.Credentials, req, hex.EncodeToString(bodyHash[:]), "kms", s.cfg.Region, time.Now()); err != nil {
+		return fmt.Errorf("awskms: signing %s request: %w", action, err)
+	}
+
+	resp, err := s.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("awskms: %s: %w", action, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("awskms: %s: %w", action, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var kmsErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(respBody, &kmsErr)
+		return fmt.Errorf("awskms: %s: HTTP %d: %s %s", action, resp.StatusCode, kmsErr.Type, kmsErr.Message)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("awskms: %s: invalid response: %w", action, err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package awskms
+
+import (
+	"context"
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	secp256k1secec "gitlab.com/yawning/secp256k1-voi/secec"
+)
+
+// Fake KMS API holding a single key, signing with sign.
+func fakeKMS(t *testing.T, keySpec string, pub crypto.PublicKey, sign func(digest []byte) ([]byte, error)) *httptest.Server {
+	pubDER, err := crypto.PublicKeyPKIX(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var in struct {
+			KeyId   string
+			Message []byte
+		}
+		if err := json.NewDecoder(r.Body).Decode(&in); err != nil || in.KeyId != "alias/test" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"__type": "NotFoundException", "message": "no such key"})
+			return
+		}
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.GetPublicKey":
+			json.NewEncoder(w).Encode(map[string]any{"KeyId": in.KeyId, "PublicKey": pubDER, "KeySpec": keySpec, "KeyUsage": "SIGN_VERIFY"})
+		case "TrentService.Sign":
+			sig, err := sign(in.Message)
+			if err != nil {
+				t.Fatal(err)
+			}
+			json.NewEncoder(w).Encode(map[string]any{"KeyId": in.KeyId, "Signature": sig, "SigningAlgorithm": "ECDSA_SHA_256"})
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+}
+
+func TestSigner(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	creds := aws.Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	msg := []byte("test-message")
+
+	skP256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+	stdP256, err := crypto.NewStdSigner(skP256)
+	assert.NoError(err)
+	pubP256, err := stdP256.PublicKey()
+	assert.NoError(err)
+
+	skK256, err := secp256k1secec.GenerateKey()
+	assert.NoError(err)
+	pubK256, err := crypto.ParsePublicBytesK256(skK256.PublicKey().CompressedBytes())
+	assert.NoError(err)
+
+	cases := []struct {
+		keySpec string
+		pub     crypto.PublicKey
+		sign    func([]byte) ([]byte, error)
+	}{
+		{"ECC_NIST_P256", pubP256, func(digest []byte) ([]byte, error) {
+			return ecdsa.SignASN1(rand.Reader, skP256, digest)
+		}},
+		{"ECC_SECG_P256K1", pubK256, func(digest []byte) ([]byte, error) {
+			return skK256.Sign(rand.Reader, digest, &secp256k1secec.ECDSAOptions{Hash: stdcrypto.SHA256, Encoding: secp256k1secec.EncodingASN1})
+		}},
+	}
+	for _, c := range cases {
+		srv := fakeKMS(t, c.keySpec, c.pub, c.sign)
+		defer srv.Close()
+
+		signer, err := NewSigner(ctx, Config{KeyID: "alias/test", Region: "us-east-1", Endpoint: srv.URL, Credentials: creds})
+		assert.NoError(err)
+		pub, err := signer.PublicKey()
+		assert.NoError(err)
+		assert.True(c.pub.Equal(pub))
+		for i := 0; i < 10; i++ {
+			sig, err := signer.HashAndSign(ctx, msg)
+			assert.NoError(err)
+			assert.NoError(pub.HashAndVerify(msg, sig), c.keySpec)
+		}
+
+		_, err = NewSigner(ctx, Config{KeyID: "alias/missing", Region: "us-east-1", Endpoint: srv.URL, Credentials: creds})
+		assert.ErrorContains(err, "NotFoundException")
+	}
+}
@@ -0,0 +1,71 @@
+package crypto
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+// Properties of a supported curve, for encodings which name it explicitly (JWK, PKCS#8, PKIX), and for signatures made outside of this package.
+type curveInfo struct {
+	// "crv" in JWK (RFC 7518, RFC 8812)
+	jwkName string
+	// named curve in ASN.1 (RFC 5480, SEC 2)
+	oid asn1.ObjectIdentifier
+	// order of the curve, for "low-S" normalization of signatures
+	n *big.Int
+
+	parsePrivate      func([]byte) (PrivateKeyExportable, error)
+	parseUncompressed func([]byte) (PublicKey, error)
+}
+
+// order of the K-256/secp256k1 curve (SEC 2)
+var curveN_K256, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFEBAAEDCE6AF48A03BBFD25E8CD0364141", 16)
+
+var (
+	curveP256 = &curveInfo{
+		jwkName: "P-256",
+		oid:     asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7},
+		n:       curveN_P256,
+		parsePrivate: func(b []byte) (PrivateKeyExportable, error) {
+			return ParsePrivateBytesP256(b)
+		},
+		parseUncompressed: func(b []byte) (PublicKey, error) {
+			return ParsePublicUncompressedBytesP256(b)
+		},
+	}
+	curveK256 = &curveInfo{
+		jwkName: "secp256k1",
+		oid:     asn1.ObjectIdentifier{1, 3, 132, 0, 10},
+		n:       curveN_K256,
+		parsePrivate: func(b []byte) (PrivateKeyExportable, error) {
+			return ParsePrivateBytesK256(b)
+		},
+		parseUncompressed: func(b []byte) (PublicKey, error) {
+			return ParsePublicUncompressedBytesK256(b)
+		},
+	}
+)
+
+// Size in bytes of coordinates and secret scalars, for both supported curves.
+const curveByteSize = 32
+
+func publicCurve(pub PublicKey) (*curveInfo, error) {
+	switch pub.(type) {
+	case *PublicKeyP256:
+		return curveP256, nil
+	case *PublicKeyK256:
+		return curveK256, nil
+	}
+	return nil, fmt.Errorf("crypto: unsupported public key type: %T", pub)
+}
+
+func privateCurve(priv PrivateKeyExportable) (*curveInfo, error) {
+	switch priv.(type) {
+	case *PrivateKeyP256:
+		return curveP256, nil
+	case *PrivateKeyK256:
+		return curveK256, nil
+	}
+	return nil, fmt.Errorf("crypto: unsupported private key type: %T", priv)
+}
@@ -7,5 +7,9 @@
 //   - P-256/secp256r1, internally implemented using golang's stdlib cryptographic library
 //   - K-256/secp256r1, internally implemented using https://gitlab.com/yawning/secp256k1-voi
 //
+// Besides the multibase and did:key encodings used in atproto, keys of both types can be imported and exported as JWK (JSON Web Key), PKCS#8 or PKIX DER, and PEM, for interoperability with standard tooling and key management systems.
+//
+// Keys which can't be loaded in to memory, such as those held in a hardware security module (HSM) or a cloud key management service (KMS), are supported through the [Signer] interface, with an implementation for stdlib crypto.Signer keys, as exposed by most PKCS#11 libraries ([StdSigner]). Keys held in AWS KMS are supported by the awskms subpackage.
+//
 // "Low-S" signatures are enforced for both key types, both when creating signatures and during verification, as required by the atproto specification.
 package crypto
@@ -0,0 +1,150 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// JSON Web Key (RFC 7517) representation of an elliptic curve key ("kty" of "EC"), with "crv" of "P-256" or "secp256k1". The private scalar ("d") is only set for private keys.
+type JWK struct {
+	KeyType string `json:"kty"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+	D       string `json:"d,omitempty"`
+	KeyID   string `json:"kid,omitempty"`
+	Use     string `json:"use,omitempty"`
+	Alg     string `json:"alg,omitempty"`
+}
+
+// Returns the JWK representation of a public key.
+func PublicJWK(pub PublicKey) (*JWK, error) {
+	curve, err := publicCurve(pub)
+	if err != nil {
+		return nil, err
+	}
+	// uncompressed point: 0x04 | X | Y
+	raw := pub.UncompressedBytes()
+	if len(raw) != 1+2*curveByteSize {
+		return nil, fmt.Errorf("crypto: unexpected uncompressed public key length: %d", len(raw))
+	}
+	return &JWK{
+		KeyType: "EC",
+		Curve:   curve.jwkName,
+		X:       base64.RawURLEncoding.EncodeToString(raw[1 : 1+curveByteSize]),
+		Y:       base64.RawURLEncoding.EncodeToString(raw[1+curveByteSize:]),
+	}, nil
+}
+
+// Returns the JWK representation of a private key, which includes its public key.
+func PrivateJWK(priv PrivateKeyExportable) (*JWK, error) {
+	if _, err := privateCurve(priv); err != nil {
+		return nil, err
+	}
+	pub, err := priv.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	jwk, err := PublicJWK(pub)
+	if err != nil {
+		return nil, err
+	}
+	jwk.D = base64.RawURLEncoding.EncodeToString(priv.Bytes())
+	return jwk, nil
+}
+
+func (j *JWK) curve() (*curveInfo, error) {
+	if j.KeyType != "EC" {
+		return nil, fmt.Errorf("crypto: unsupported JWK key type: %q", j.KeyType)
+	}
+	switch j.Curve {
+	case curveP256.jwkName:
+		return curveP256, nil
+	case curveK256.jwkName:
+		return curveK256, nil
+	}
+	return nil, fmt.Errorf("crypto: unsupported JWK curve: %q", j.Curve)
+}
+
+func decodeJWKField(name, val string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(val)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: invalid JWK %q: %w", name, err)
+	}
+	if len(b) != curveByteSize {
+		return nil, fmt.Errorf("crypto: invalid JWK %q length: %d", name, len(b))
+	}
+	return b, nil
+}
+
+// Loads the public key of a JWK, ignoring any private key material.
+func (j *JWK) PublicKey() (PublicKey, error) {
+	curve, err := j.curve()
+	if err != nil {
+		return nil, err
+	}
+	x, err := decodeJWKField("x", j.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeJWKField("y", j.Y)
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, 0, 1+2*curveByteSize)
+	raw = append(raw, 0x04)
+	raw = append(raw, x...)
+	raw = append(raw, y...)
+	return curve.parseUncompressed(raw)
+}
+
+// Loads the private key of a JWK, checking that it matches the public key of the JWK.
+func (j *JWK) PrivateKey() (PrivateKeyExportable, error) {
+	curve, err := j.curve()
+	if err != nil {
+		return nil, err
+	}
+	if j.D == "" {
+		return nil, fmt.Errorf("crypto: JWK has no private key material")
+	}
+	d, err := decodeJWKField("d", j.D)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := curve.parsePrivate(d)
+	if err != nil {
+		return nil, err
+	}
+
+	declared, err := j.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	pub, err := priv.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	if !pub.Equal(declared) {
+		return nil, fmt.Errorf("crypto: JWK public key doesn't match its private key")
+	}
+	return priv, nil
+}
+
+// Loads a [PublicKey] from JWK JSON. Private JWKs are accepted, and only their public key is used.
+func ParsePublicJWK(data []byte) (PublicKey, error) {
+	var jwk JWK
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, fmt.Errorf("crypto: invalid JWK: %w", err)
+	}
+	return jwk.PublicKey()
+}
+
+// Loads a private key from JWK JSON.
+func ParsePrivateJWK(data []byte) (PrivateKeyExportable, error) {
+	var jwk JWK
+	if err := json.Unmarshal(data, &jwk); err != nil {
+		return nil, fmt.Errorf("crypto: invalid JWK: %w", err)
+	}
+	return jwk.PrivateKey()
+}
@@ -0,0 +1,251 @@
+package crypto
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+)
+
+// id-ecPublicKey (RFC 5480), the algorithm of elliptic curve keys in PKCS#8 and PKIX, with the curve as parameter.
+var oidPublicKeyEC = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+
+// PKCS#8 PrivateKeyInfo (RFC 5208), with the optional fields of OneAsymmetricKey (RFC 5958).
+type pkcs8PrivateKey struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+	Attributes asn1.RawValue  `asn1:"optional,tag:0"`
+	PublicKey  asn1.BitString `asn1:"optional,tag:1"`
+}
+
+// SEC 1 ECPrivateKey (RFC 5915).
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// PKIX SubjectPublicKeyInfo (RFC 5280).
+type pkixPublicKey struct {
+	Algo      pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+func curveAlgorithm(curve *curveInfo) (pkix.AlgorithmIdentifier, error) {
+	params, err := asn1.Marshal(curve.oid)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	return pkix.AlgorithmIdentifier{
+		Algorithm:  oidPublicKeyEC,
+		Parameters: asn1.RawValue{FullBytes: params},
+	}, nil
+}
+
+func curveForOID(oid asn1.ObjectIdentifier) (*curveInfo, error) {
+	switch {
+	case oid.Equal(curveP256.oid):
+		return curveP256, nil
+	case oid.Equal(curveK256.oid):
+		return curveK256, nil
+	}
+	return nil, fmt.Errorf("crypto: unsupported elliptic curve: %s", oid)
+}
+
+func algorithmCurve(algo pkix.AlgorithmIdentifier) (*curveInfo, error) {
+	if !algo.Algorithm.Equal(oidPublicKeyEC) {
+		return nil, fmt.Errorf("crypto: unsupported key algorithm: %s", algo.Algorithm)
+	}
+	var oid asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(algo.Parameters.FullBytes, &oid); err != nil {
+		return nil, fmt.Errorf("crypto: invalid elliptic curve parameters: %w", err)
+	}
+	return curveForOID(oid)
+}
+
+// Serializes a private key as PKCS#8 DER bytes, as used by most standard tooling and KMS key import. Unlike the stdlib x509 package, this supports K-256 keys.
+func PrivateKeyPKCS8(priv PrivateKeyExportable) ([]byte, error) {
+	curve, err := privateCurve(priv)
+	if err != nil {
+		return nil, err
+	}
+	algo, err := curveAlgorithm(curve)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := priv.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	pubBytes := pub.UncompressedBytes()
+	// the curve is already in the algorithm identifier, so not repeated here (as by the stdlib)
+	inner, err := asn1.Marshal(ecPrivateKey{
+		Version:    1,
+		PrivateKey: priv.Bytes(),
+		PublicKey:  asn1.BitString{Bytes: pubBytes, BitLength: 8 * len(pubBytes)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("crypto: marshaling EC private key: %w", err)
+	}
+	return asn1.Marshal(pkcs8PrivateKey{
+		Version:    0,
+		Algo:       algo,
+		PrivateKey: inner,
+	})
+}
+
+// Loads a private key from PKCS#8 DER bytes.
+func ParsePrivatePKCS8(der []byte) (PrivateKeyExportable, error) {
+	var p pkcs8PrivateKey
+	rest, err := asn1.Unmarshal(der, &p)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: invalid PKCS#8 private key: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("crypto: trailing data after PKCS#8 private key")
+	}
+	curve, err := algorithmCurve(p.Algo)
+	if err != nil {
+		return nil, err
+	}
+	return parseECPrivateKey(p.PrivateKey, curve)
+}
+
+// Loads a private key from SEC 1 ("EC PRIVATE KEY") DER bytes, as output by 'openssl ecparam -genkey'.
+func ParsePrivateSEC1(der []byte) (PrivateKeyExportable, error) {
+	return parseECPrivateKey(der, nil)
+}
+
+// Parses a SEC 1 private key, with its curve either named in the structure or from the enclosing PKCS#8 structure.
+func parseECPrivateKey(der []byte, curve *curveInfo) (PrivateKeyExportable, error) {
+	var k ecPrivateKey
+	rest, err := asn1.Unmarshal(der, &k)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: invalid EC private key: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("crypto: trailing data after EC private key")
+	}
+	if k.Version != 1 {
+		return nil, fmt.Errorf("crypto: unsupported EC private key version: %d", k.Version)
+	}
+	if len(k.NamedCurveOID) > 0 {
+		named, err := curveForOID(k.NamedCurveOID)
+		if err != nil {
+			return nil, err
+		}
+		if curve != nil && curve != named {
+			return nil, fmt.Errorf("crypto: EC private key curve doesn't match its algorithm")
+		}
+		curve = named
+	}
+	if curve == nil {
+		return nil, fmt.Errorf("crypto: EC private key has no curve")
+	}
+	if len(k.PrivateKey) > curveByteSize {
+		return nil, fmt.Errorf("crypto: invalid EC private key length: %d", len(k.PrivateKey))
+	}
+	// some encoders drop leading zeros of the scalar
+	d := make([]byte, curveByteSize)
+	copy(d[curveByteSize-len(k.PrivateKey):], k.PrivateKey)
+	priv, err := curve.parsePrivate(d)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(k.PublicKey.Bytes) > 0 {
+		declared, err := curve.parseUncompressed(k.PublicKey.RightAlign())
+		if err != nil {
+			return nil, fmt.Errorf("crypto: invalid public key in EC private key: %w", err)
+		}
+		pub, err := priv.PublicKey()
+		if err != nil {
+			return nil, err
+		}
+		if !pub.Equal(declared) {
+			return nil, fmt.Errorf("crypto: EC private key doesn't match its public key")
+		}
+	}
+	return priv, nil
+}
+
+// Serializes a public key as PKIX (SubjectPublicKeyInfo) DER bytes, with an uncompressed point. Unlike the stdlib x509 package, this supports K-256 keys.
+func PublicKeyPKIX(pub PublicKey) ([]byte, error) {
+	curve, err := publicCurve(pub)
+	if err != nil {
+		return nil, err
+	}
+	algo, err := curveAlgorithm(curve)
+	if err != nil {
+		return nil, err
+	}
+	raw := pub.UncompressedBytes()
+	return asn1.Marshal(pkixPublicKey{
+		Algo:      algo,
+		PublicKey: asn1.BitString{Bytes: raw, BitLength: 8 * len(raw)},
+	})
+}
+
+// Loads a [PublicKey] from PKIX (SubjectPublicKeyInfo) DER bytes. Only uncompressed points are supported.
+func ParsePublicPKIX(der []byte) (PublicKey, error) {
+	var p pkixPublicKey
+	rest, err := asn1.Unmarshal(der, &p)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: invalid PKIX public key: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("crypto: trailing data after PKIX public key")
+	}
+	curve, err := algorithmCurve(p.Algo)
+	if err != nil {
+		return nil, err
+	}
+	return curve.parseUncompressed(p.PublicKey.RightAlign())
+}
+
+// Serializes a private key as a PKCS#8 "PRIVATE KEY" PEM block.
+func PrivateKeyPEM(priv PrivateKeyExportable) ([]byte, error) {
+	der, err := PrivateKeyPKCS8(priv)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// Loads a private key from the first PEM block of data, either PKCS#8 ("PRIVATE KEY") or SEC 1 ("EC PRIVATE KEY"). Encrypted PEM blocks are not supported.
+func ParsePrivatePEM(data []byte) (PrivateKeyExportable, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("crypto: no PEM block found")
+	}
+	switch block.Type {
+	case "PRIVATE KEY":
+		return ParsePrivatePKCS8(block.Bytes)
+	case "EC PRIVATE KEY":
+		return ParsePrivateSEC1(block.Bytes)
+	}
+	return nil, fmt.Errorf("crypto: unsupported PEM block type: %q", block.Type)
+}
+
+// Serializes a public key as a PKIX "PUBLIC KEY" PEM block.
+func PublicKeyPEM(pub PublicKey) ([]byte, error) {
+	der, err := PublicKeyPKIX(pub)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// Loads a [PublicKey] from the first PEM block of data, which must be a PKIX "PUBLIC KEY".
+func ParsePublicPEM(data []byte) (PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("crypto: no PEM block found")
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("crypto: unsupported PEM block type: %q", block.Type)
+	}
+	return ParsePublicPKIX(block.Bytes)
+}
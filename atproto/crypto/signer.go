@@ -0,0 +1,123 @@
+package crypto
+
+import (
+	"context"
+	stdcrypto "crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+// Common interface for signing keys which may be held outside of the process, such as in a hardware security module (HSM) or a cloud key management service (KMS), where secret key material can't be exported.
+//
+// Signing takes a context, as it may involve network requests. Signatures are the same as those of [PrivateKey]: "low-S", in the compact encoding of the curve.
+type Signer interface {
+	PublicKey() (PublicKey, error)
+
+	// Hashes the raw bytes using SHA-256, then signs the digest bytes.
+	HashAndSign(ctx context.Context, content []byte) ([]byte, error)
+}
+
+type privateKeySigner struct {
+	priv PrivateKey
+}
+
+// Returns a [Signer] for a private key held in memory.
+func PrivateKeySigner(priv PrivateKey) Signer {
+	return &privateKeySigner{priv: priv}
+}
+
+func (s *privateKeySigner) PublicKey() (PublicKey, error) {
+	return s.priv.PublicKey()
+}
+
+func (s *privateKeySigner) HashAndSign(_ context.Context, content []byte) ([]byte, error) {
+	return s.priv.HashAndSign(content)
+}
+
+// Implements [Signer] on top of a stdlib crypto.Signer with an ECDSA key (P-256 or K-256). Most PKCS#11 libraries for Go (eg, github.com/ThalesIgnite/crypto11) expose keys held in an HSM as a crypto.Signer, and can be used through this.
+type StdSigner struct {
+	signer stdcrypto.Signer
+	pub    PublicKey
+	curve  *curveInfo
+}
+
+var _ Signer = (*StdSigner)(nil)
+
+// Wraps a stdlib crypto.Signer, checking that its public key is of a supported type.
+func NewStdSigner(signer stdcrypto.Signer) (*StdSigner, error) {
+	ecPub, ok := signer.Public().(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("crypto: unsupported signer public key type: %T", signer.Public())
+	}
+	params := ecPub.Curve.Params()
+	var curve *curveInfo
+	switch {
+	case params.N.Cmp(curveP256.n) == 0:
+		curve = curveP256
+	case params.N.Cmp(curveK256.n) == 0:
+		curve = curveK256
+	default:
+		return nil, fmt.Errorf("crypto: unsupported signer curve: %s", params.Name)
+	}
+
+	raw := make([]byte, 1+2*curveByteSize)
+	raw[0] = 0x04
+	ecPub.X.FillBytes(raw[1 : 1+curveByteSize])
+	ecPub.Y.FillBytes(raw[1+curveByteSize:])
+	pub, err := curve.parseUncompressed(raw)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: invalid signer public key: %w", err)
+	}
+	return &StdSigner{signer: signer, pub: pub, curve: curve}, nil
+}
+
+func (s *StdSigner) PublicKey() (PublicKey, error) {
+	return s.pub, nil
+}
+
+// Signs the SHA-256 digest of content. The stdlib interface doesn't take a context, so ctx is ignored.
+func (s *StdSigner) HashAndSign(_ context.Context, content []byte) ([]byte, error) {
+	hash := sha256.Sum256(content)
+	der, err := s.signer.Sign(rand.Reader, hash[:], stdcrypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: signing failed: %w", err)
+	}
+	return compactSignature(s.curve, der)
+}
+
+// Converts an ASN.1 DER ECDSA signature made with the private key of pub, as returned by most external signers (eg, a KMS API), to the compact "low-S" encoding used in atproto.
+func CompactSignatureASN1(pub PublicKey, der []byte) ([]byte, error) {
+	curve, err := publicCurve(pub)
+	if err != nil {
+		return nil, err
+	}
+	return compactSignature(curve, der)
+}
+
+func compactSignature(curve *curveInfo, der []byte) ([]byte, error) {
+	var sig struct {
+		R, S *big.Int
+	}
+	rest, err := asn1.Unmarshal(der, &sig)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: invalid ASN.1 signature: %w", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("crypto: trailing data after ASN.1 signature")
+	}
+	if sig.R.Sign() <= 0 || sig.S.Sign() <= 0 || sig.R.Cmp(curve.n) >= 0 || sig.S.Cmp(curve.n) >= 0 {
+		return nil, fmt.Errorf("crypto: signature scalars out of range")
+	}
+	// both (r, s) and (r, n-s) are valid; atproto requires the lower one
+	if sig.S.Cmp(new(big.Int).Rsh(curve.n, 1)) > 0 {
+		sig.S = new(big.Int).Sub(curve.n, sig.S)
+	}
+	out := make([]byte, 2*curveByteSize)
+	sig.R.FillBytes(out[:curveByteSize])
+	sig.S.FillBytes(out[curveByteSize:])
+	return out, nil
+}
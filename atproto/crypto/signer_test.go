@@ -0,0 +1,51 @@
+package crypto
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStdSigner(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(err)
+	signer, err := NewStdSigner(sk)
+	assert.NoError(err)
+	pub, err := signer.PublicKey()
+	assert.NoError(err)
+	_, ok := pub.(*PublicKeyP256)
+	assert.True(ok)
+
+	// the stdlib doesn't make "low-S" signatures, so half of these would fail verification without normalization
+	msg := []byte("test-message")
+	for i := 0; i < 20; i++ {
+		sig, err := signer.HashAndSign(ctx, msg)
+		assert.NoError(err)
+		assert.NoError(pub.HashAndVerify(msg, sig))
+	}
+
+	other, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(err)
+	_, err = NewStdSigner(other)
+	assert.Error(err)
+}
+
+func TestPrivateKeySigner(t *testing.T) {
+	assert := assert.New(t)
+
+	priv, err := GeneratePrivateKeyK256()
+	assert.NoError(err)
+	signer := PrivateKeySigner(priv)
+	pub, err := signer.PublicKey()
+	assert.NoError(err)
+	sig, err := signer.HashAndSign(context.Background(), []byte("test-message"))
+	assert.NoError(err)
+	assert.NoError(pub.HashAndVerify([]byte("test-message"), sig))
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 
 	"github.com/bluesky-social/indigo/atproto/syntax"
+	"golang.org/x/sync/singleflight"
 	"golang.org/x/time/rate"
 )
 
@@ -19,16 +20,29 @@ type BaseDirectory struct {
 	PLCLimiter *rate.Limiter
 	// If not nil, this function will be called inline with DID Web lookups, and can be used to limit the number of requests to a given hostname
 	DIDWebLimitFunc func(ctx context.Context, hostname string) error
+	// Max size of a did:web DID document; DefaultDIDWebMaxDocSize if zero
+	DIDWebMaxDocSize int64
+	// Allows did:web for localhost, with an optional port (eg, 'did:web:localhost%3A2582'), resolved over plain HTTP. Only meant for development and tests
+	DIDWebAllowInsecureLocalhost bool
 	// HTTP client used for did:web, did:plc, and HTTP (well-known) handle resolution
 	HTTPClient http.Client
 	// DNS resolver used for DNS handle resolution. Calling code can use a custom Dialer to query against a specific DNS server, or re-implement the interface for even more control over the resolution process
 	Resolver net.Resolver
+	// If not empty, resolvers used for DNS handle resolution instead of Resolver, eg DNS-over-HTTPS endpoints (see ParseDNSResolver). They are tried in order, each with its own timeout, until one answers
+	DNSResolvers []DNSResolver
+	// Run DNS and HTTP well-known handle resolution concurrently, using whichever succeeds first, instead of only falling back to HTTP when DNS fails
+	ParallelHandleResolution bool
 	// when doing DNS handle resolution, should this resolver attempt re-try against an authoritative nameserver if the first TXT lookup fails?
 	TryAuthoritativeDNS bool
 	// set of handle domain suffixes for for which DNS handle resolution will be skipped
 	SkipDNSDomainSuffixes []string
 	// set of fallback DNS servers (eg, domain registrars) to try as a fallback. each entry should be "ip:port", eg "8.8.8.8:53"
 	FallbackDNSServers []string
+	// max number of concurrent lookups in LookupDIDs and LookupHandles; DefaultBatchConcurrency if zero
+	BatchConcurrency int
+
+	// coalesces the lookups of concurrent batches
+	flights singleflight.Group
 }
 
 var _ Directory = (*BaseDirectory)(nil)
@@ -111,3 +125,11 @@ func (d *BaseDirectory) Lookup(ctx context.Context, a syntax.AtIdentifier) (*Ide
 func (d *BaseDirectory) Purge(ctx context.Context, a syntax.AtIdentifier) error {
 	return nil
 }
+
+func (d *BaseDirectory) LookupDIDs(ctx context.Context, dids []syntax.DID) []LookupResult {
+	return lookupBatch(ctx, dids, d.BatchConcurrency, &d.flights, "did:", didString, d.LookupDID)
+}
+
+func (d *BaseDirectory) LookupHandles(ctx context.Context, handles []syntax.Handle) []LookupResult {
+	return lookupBatch(ctx, normalizeHandles(handles), d.BatchConcurrency, &d.flights, "handle:", handleString, d.LookupHandle)
+}
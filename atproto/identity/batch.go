@@ -0,0 +1,102 @@
+package identity
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// Default number of lookups of a batch (LookupDIDs or LookupHandles) which are run concurrently
+var DefaultBatchConcurrency = 20
+
+// Outcome of a single lookup of a batch.
+type LookupResult struct {
+	Identity *Identity
+	Err      error
+}
+
+// Runs lookup for each key, with at most concurrency lookups at a time, and returns the results in the same order as keys. Repeated keys are only looked up once. If flights is not nil, lookups of the same key from concurrent batches are coalesced through it, with the key's string form prefixed by kind.
+func lookupBatch[K comparable](ctx context.Context, keys []K, concurrency int, flights *singleflight.Group, kind string, key func(K) string, lookup func(context.Context, K) (*Identity, error)) []LookupResult {
+	if concurrency <= 0 {
+		concurrency = DefaultBatchConcurrency
+	}
+
+	// index of the first occurrence of each key, which the others copy
+	first := make(map[K]int, len(keys))
+	var uniq []int
+	for i, k := range keys {
+		if _, ok := first[k]; !ok {
+			first[k] = i
+			uniq = append(uniq, i)
+		}
+	}
+
+	out := make([]LookupResult, len(keys))
+	todo := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(concurrency, len(uniq)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range todo {
+				k := keys[i]
+				if err := ctx.Err(); err != nil {
+					out[i] = LookupResult{Err: err}
+					continue
+				}
+				if flights == nil {
+					ident, err := lookup(ctx, k)
+					out[i] = LookupResult{Identity: ident, Err: err}
+					continue
+				}
+				v, err, _ := flights.Do(kind+key(k), func() (any, error) {
+					return lookup(ctx, k)
+				})
+				ident, _ := v.(*Identity)
+				out[i] = LookupResult{Identity: ident, Err: err}
+			}
+		}()
+	}
+	for _, i := range uniq {
+		todo <- i
+	}
+	close(todo)
+	wg.Wait()
+
+	for i, k := range keys {
+		if j := first[k]; j != i {
+			out[i] = out[j]
+		}
+	}
+	return out
+}
+
+func didString(d syntax.DID) string {
+	return d.String()
+}
+
+func handleString(h syntax.Handle) string {
+	return h.String()
+}
+
+// Normalizes handles up front, so that different spellings of a handle in a batch are only looked up once.
+func normalizeHandles(handles []syntax.Handle) []syntax.Handle {
+	out := make([]syntax.Handle, len(handles))
+	for i, h := range handles {
+		out[i] = h.Normalize()
+	}
+	return out
+}
+
+// LookupDIDsWith runs lookup for each of dids, with at most concurrency lookups at a time (or DefaultBatchConcurrency if zero), each distinct DID only once. Results are in the same order as dids. It is meant for implementations of Directory.LookupDIDs, with their own LookupDID.
+func LookupDIDsWith(ctx context.Context, dids []syntax.DID, concurrency int, lookup func(context.Context, syntax.DID) (*Identity, error)) []LookupResult {
+	return lookupBatch(ctx, dids, concurrency, nil, "did:", didString, lookup)
+}
+
+// LookupHandlesWith is like LookupDIDsWith, for handles, which are normalized first.
+func LookupHandlesWith(ctx context.Context, handles []syntax.Handle, concurrency int, lookup func(context.Context, syntax.Handle) (*Identity, error)) []LookupResult {
+	return lookupBatch(ctx, normalizeHandles(handles), concurrency, nil, "handle:", handleString, lookup)
+}
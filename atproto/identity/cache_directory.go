@@ -3,7 +3,9 @@ package identity
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/bluesky-social/indigo/atproto/syntax"
@@ -14,12 +16,33 @@ import (
 )
 
 type CacheDirectory struct {
-	Inner             Directory
-	ErrTTL            time.Duration
+	Inner  Directory
+	ErrTTL time.Duration
+	HitTTL time.Duration
+	// max number of concurrent lookups in LookupDIDs and LookupHandles; DefaultBatchConcurrency if zero
+	BatchConcurrency  int
 	handleCache       *expirable.LRU[syntax.Handle, HandleEntry]
 	identityCache     *expirable.LRU[syntax.DID, IdentityEntry]
 	didLookupChans    sync.Map
 	handleLookupChans sync.Map
+	prefetch          *prefetchState
+}
+
+// Request counts used to pick identities for prefetching. Held by pointer so that copies of a CacheDirectory share it.
+type prefetchState struct {
+	enabled atomic.Bool
+	// map of syntax.DID to *atomic.Int64
+	counts sync.Map
+}
+
+// Configuration for CacheDirectory.RunPrefetch
+type PrefetchConfig struct {
+	// How often to look for identities to refresh
+	Interval time.Duration
+	// Max number of identities to refresh per interval. The most frequently requested identities are refreshed first.
+	MaxPerInterval int
+	// Identities are refreshed when their cache entry would expire within this window
+	Window time.Duration
 }
 
 type HandleEntry struct {
@@ -54,6 +77,11 @@ var identityCacheMisses = promauto.NewCounter(prometheus.CounterOpts{
 	Help: "Number of cache misses for ATProto identity lookups",
 })
 
+var identityPrefetches = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "atproto_directory_identity_prefetches",
+	Help: "Number of identities proactively refreshed before cache expiry",
+})
+
 var identityRequestsCoalesced = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "atproto_directory_identity_requests_coalesced",
 	Help: "Number of identity requests coalesced",
@@ -70,9 +98,11 @@ var _ Directory = (*CacheDirectory)(nil)
 func NewCacheDirectory(inner Directory, capacity int, hitTTL, errTTL time.Duration) CacheDirectory {
 	return CacheDirectory{
 		ErrTTL:        errTTL,
+		HitTTL:        hitTTL,
 		Inner:         inner,
 		handleCache:   expirable.NewLRU[syntax.Handle, HandleEntry](capacity, nil, hitTTL),
 		identityCache: expirable.NewLRU[syntax.DID, IdentityEntry](capacity, nil, hitTTL),
+		prefetch:      &prefetchState{},
 	}
 }
 
@@ -188,6 +218,7 @@ func (d *CacheDirectory) updateDID(ctx context.Context, did syntax.DID) Identity
 }
 
 func (d *CacheDirectory) LookupDID(ctx context.Context, did syntax.DID) (*Identity, error) {
+	d.countRequest(did)
 	entry, ok := d.identityCache.Get(did)
 	if ok && !d.IsIdentityStale(&entry) {
 		identityCacheHits.Inc()
@@ -278,3 +309,109 @@ func (d *CacheDirectory) Purge(ctx context.Context, a syntax.AtIdentifier) error
 	}
 	return fmt.Errorf("at-identifier neither a Handle nor a DID")
 }
+
+// Lookups of identities which aren't cached are coalesced with those of concurrent requests, as with LookupDID.
+func (d *CacheDirectory) LookupDIDs(ctx context.Context, dids []syntax.DID) []LookupResult {
+	return LookupDIDsWith(ctx, dids, d.BatchConcurrency, d.LookupDID)
+}
+
+func (d *CacheDirectory) LookupHandles(ctx context.Context, handles []syntax.Handle) []LookupResult {
+	return LookupHandlesWith(ctx, handles, d.BatchConcurrency, d.LookupHandle)
+}
+
+func (d *CacheDirectory) countRequest(did syntax.DID) {
+	if d.prefetch == nil || !d.prefetch.enabled.Load() {
+		return
+	}
+	v, ok := d.prefetch.counts.Load(did)
+	if !ok {
+		v, _ = d.prefetch.counts.LoadOrStore(did, &atomic.Int64{})
+	}
+	v.(*atomic.Int64).Add(1)
+}
+
+// Runs a loop which proactively re-resolves the most frequently requested identities shortly before their cache entries expire. This smooths out latency spikes caused by many popular entries expiring at the same time.
+//
+// Blocks until the context is cancelled. Zero-value config fields are replaced with defaults.
+func (d *CacheDirectory) RunPrefetch(ctx context.Context, config PrefetchConfig) error {
+	if d.HitTTL <= 0 || d.prefetch == nil {
+		return fmt.Errorf("identity prefetch requires a cache hit TTL")
+	}
+	if config.Interval <= 0 {
+		config.Interval = time.Minute
+	}
+	if config.MaxPerInterval <= 0 {
+		config.MaxPerInterval = 1000
+	}
+	if config.Window <= 0 {
+		config.Window = d.HitTTL / 10
+	}
+
+	d.prefetch.enabled.Store(true)
+	defer d.prefetch.enabled.Store(false)
+
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			d.prefetchOnce(ctx, config)
+		}
+	}
+}
+
+// Refreshes the most frequently requested identities (since the previous call) which are about to expire. Returns the number of identities refreshed.
+func (d *CacheDirectory) prefetchOnce(ctx context.Context, config PrefetchConfig) int {
+	type candidate struct {
+		did   syntax.DID
+		count int64
+	}
+	var candidates []candidate
+	d.prefetch.counts.Range(func(k, _ any) bool {
+		// the counter is read after it is removed from the map, so hits recorded until then are counted here, and later ones go to a new counter for the next call
+		if v, ok := d.prefetch.counts.LoadAndDelete(k); ok {
+			candidates = append(candidates, candidate{did: k.(syntax.DID), count: v.(*atomic.Int64).Load()})
+		}
+		return true
+	})
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].count > candidates[j].count
+	})
+
+	refreshed := 0
+	for _, c := range candidates {
+		if refreshed >= config.MaxPerInterval || ctx.Err() != nil {
+			break
+		}
+		entry, ok := d.identityCache.Peek(c.did)
+		// entries which aren't cached will be resolved on demand, and errors are re-tried on their own TTL
+		if !ok || entry.Err != nil {
+			continue
+		}
+		if time.Since(entry.Updated) < d.HitTTL-config.Window {
+			continue
+		}
+		// unlike updateDID, a failed lookup does not replace the existing (still valid) entry
+		ident, err := d.Inner.LookupDID(ctx, c.did)
+		if err != nil {
+			continue
+		}
+		d.identityCache.Add(c.did, IdentityEntry{
+			Updated:  time.Now(),
+			Identity: ident,
+			Err:      nil,
+		})
+		if !ident.Handle.IsInvalidHandle() {
+			d.handleCache.Add(ident.Handle, HandleEntry{
+				Updated: time.Now(),
+				DID:     c.did,
+				Err:     nil,
+			})
+		}
+		identityPrefetches.Inc()
+		refreshed++
+	}
+	return refreshed
+}
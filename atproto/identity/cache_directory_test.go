@@ -0,0 +1,153 @@
+package identity
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sync/singleflight"
+)
+
+func TestCacheDirectoryPrefetch(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	inner := NewMockDirectory()
+	id1 := Identity{
+		DID:    syntax.DID("did:plc:abc111"),
+		Handle: syntax.Handle("handle1.example.com"),
+	}
+	id2 := Identity{
+		DID:    syntax.DID("did:plc:abc222"),
+		Handle: syntax.Handle("handle2.example.com"),
+	}
+	inner.Insert(id1)
+	inner.Insert(id2)
+
+	dir := NewCacheDirectory(&inner, 100, time.Hour, time.Minute)
+	dir.prefetch.enabled.Store(true)
+	config := PrefetchConfig{MaxPerInterval: 1, Window: 10 * time.Minute}
+
+	for i := 0; i < 3; i++ {
+		_, err := dir.LookupDID(ctx, id1.DID)
+		assert.NoError(err)
+	}
+	_, err := dir.LookupDID(ctx, id2.DID)
+	assert.NoError(err)
+
+	// fresh entries aren't refreshed
+	assert.Equal(0, dir.prefetchOnce(ctx, config))
+
+	// age both entries so they are about to expire
+	for _, did := range []syntax.DID{id1.DID, id2.DID} {
+		entry, ok := dir.identityCache.Peek(did)
+		assert.True(ok)
+		entry.Updated = time.Now().Add(-55 * time.Minute)
+		dir.identityCache.Add(did, entry)
+	}
+	for i := 0; i < 3; i++ {
+		_, err := dir.LookupDID(ctx, id1.DID)
+		assert.NoError(err)
+	}
+	_, err = dir.LookupDID(ctx, id2.DID)
+	assert.NoError(err)
+
+	// only the most requested identity is refreshed, because of MaxPerInterval
+	assert.Equal(1, dir.prefetchOnce(ctx, config))
+	entry, _ := dir.identityCache.Peek(id1.DID)
+	assert.True(time.Since(entry.Updated) < time.Minute)
+	entry, _ = dir.identityCache.Peek(id2.DID)
+	assert.True(time.Since(entry.Updated) > 50*time.Minute)
+
+	// counts were reset
+	assert.Equal(0, dir.prefetchOnce(ctx, config))
+}
+
+// Counts the lookups which reach the inner directory, and how many run at the same time.
+type countingDirectory struct {
+	MockDirectory
+	lookups    atomic.Int64
+	running    atomic.Int64
+	maxRunning atomic.Int64
+}
+
+func (d *countingDirectory) LookupDID(ctx context.Context, did syntax.DID) (*Identity, error) {
+	d.lookups.Add(1)
+	n := d.running.Add(1)
+	defer d.running.Add(-1)
+	for {
+		m := d.maxRunning.Load()
+		if n <= m || d.maxRunning.CompareAndSwap(m, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return d.MockDirectory.LookupDID(ctx, did)
+}
+
+func TestCacheDirectoryLookupDIDs(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	inner := &countingDirectory{MockDirectory: NewMockDirectory()}
+	var dids []syntax.DID
+	for i := 0; i < 50; i++ {
+		did := syntax.DID(fmt.Sprintf("did:plc:batch%03d", i))
+		inner.Insert(Identity{DID: did, Handle: syntax.HandleInvalid})
+		dids = append(dids, did)
+	}
+	missing := syntax.DID("did:plc:missing")
+
+	dir := NewCacheDirectory(inner, 100, time.Hour, time.Minute)
+	dir.BatchConcurrency = 4
+
+	// every DID twice, and one which doesn't exist
+	batch := append(append(slices.Clone(dids), dids...), missing)
+	res := dir.LookupDIDs(ctx, batch)
+	assert.Len(res, len(batch))
+	for i, did := range batch[:len(batch)-1] {
+		assert.NoError(res[i].Err)
+		assert.Equal(did, res[i].Identity.DID)
+	}
+	assert.ErrorIs(res[len(batch)-1].Err, ErrDIDNotFound)
+	assert.Equal(int64(51), inner.lookups.Load())
+	assert.LessOrEqual(inner.maxRunning.Load(), int64(4))
+	assert.Greater(inner.maxRunning.Load(), int64(1))
+
+	// now all cached
+	res = dir.LookupDIDs(ctx, dids)
+	for i, did := range dids {
+		assert.Equal(did, res[i].Identity.DID)
+	}
+	assert.Equal(int64(51), inner.lookups.Load())
+}
+
+func TestLookupBatchCoalescing(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	inner := &countingDirectory{MockDirectory: NewMockDirectory()}
+	did := syntax.DID("did:plc:coalesce")
+	inner.Insert(Identity{DID: did, Handle: syntax.HandleInvalid})
+
+	var flights singleflight.Group
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := lookupBatch(ctx, []syntax.DID{did}, 0, &flights, "did:", didString, inner.LookupDID)
+			assert.NoError(res[0].Err)
+		}()
+	}
+	wg.Wait()
+	// concurrent batches share in-flight lookups, though not all of them need have overlapped
+	assert.Less(inner.lookups.Load(), int64(10))
+}
@@ -5,9 +5,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bluesky-social/indigo/atproto/syntax"
@@ -52,29 +56,78 @@ func (d *BaseDirectory) ResolveDID(ctx context.Context, did syntax.DID) (*DIDDoc
 	}
 }
 
-func (d *BaseDirectory) ResolveDIDWeb(ctx context.Context, did syntax.DID) (*DIDDocument, error) {
+// Default max size of a did:web DID document, when BaseDirectory.DIDWebMaxDocSize is zero
+var DefaultDIDWebMaxDocSize int64 = 64 * 1024
+
+// Returns the URL of the DID document of a did:web. Only hostname-level DIDs are supported, as in atproto, not those with a path. A port is only allowed for localhost, and then plain HTTP is used, if allowInsecureLocalhost; all other DIDs are resolved over HTTPS, on the default port.
+func didWebURL(did syntax.DID, allowInsecureLocalhost bool) (string, error) {
 	if did.Method() != "web" {
-		return nil, fmt.Errorf("expected a did:web, got: %s", did)
+		return "", fmt.Errorf("expected a did:web, got: %s", did)
+	}
+	ident := did.Identifier()
+	if strings.Contains(ident, ":") {
+		return "", fmt.Errorf("did:web with a path is not supported: %s", did)
+	}
+	hostport, err := url.PathUnescape(ident)
+	if err != nil {
+		return "", fmt.Errorf("did:web identifier not a valid hostname: %s", ident)
 	}
-	hostname := did.Identifier()
+
+	hostname, port, hasPort := strings.Cut(hostport, ":")
+	if hostname == "localhost" {
+		if !allowInsecureLocalhost {
+			return "", fmt.Errorf("did:web for localhost is not allowed: %s", did)
+		}
+		if hasPort {
+			if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+				return "", fmt.Errorf("did:web has an invalid port: %s", did)
+			}
+		}
+		return "http://" + hostport + "/.well-known/did.json", nil
+	}
+	if hasPort {
+		return "", fmt.Errorf("did:web with a port is only allowed for localhost: %s", did)
+	}
+
 	handle, err := syntax.ParseHandle(hostname)
 	if err != nil {
-		return nil, fmt.Errorf("did:web identifier not a simple hostname: %s", hostname)
+		return "", fmt.Errorf("did:web identifier not a simple hostname: %s", hostname)
 	}
 	if !handle.AllowedTLD() {
-		return nil, fmt.Errorf("did:web hostname has disallowed TLD: %s", hostname)
+		return "", fmt.Errorf("did:web hostname has disallowed TLD: %s", hostname)
 	}
+	return "https://" + handle.Normalize().String() + "/.well-known/did.json", nil
+}
 
-	// TODO: use a more robust client
-	// TODO: allow ctx to specify unsafe http:// resolution, for testing?
+// Fetches the DID document of a did:web from its well-known URL. Redirects are not followed, as the document must be served by the host named in the DID, and documents larger than DIDWebMaxDocSize, or with another DID than the one requested, are rejected.
+func (d *BaseDirectory) ResolveDIDWeb(ctx context.Context, did syntax.DID) (*DIDDocument, error) {
+	docURL, err := didWebURL(did, d.DIDWebAllowInsecureLocalhost)
+	if err != nil {
+		return nil, err
+	}
 
 	if d.DIDWebLimitFunc != nil {
+		u, err := url.Parse(docURL)
+		if err != nil {
+			return nil, err
+		}
+		hostname := u.Hostname()
 		if err := d.DIDWebLimitFunc(ctx, hostname); err != nil {
 			return nil, fmt.Errorf("did:web limit func returned an error for (%s): %w", hostname, err)
 		}
 	}
 
-	resp, err := http.Get("https://" + hostname + "/.well-known/did.json")
+	req, err := http.NewRequestWithContext(ctx, "GET", docURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("constructing HTTP request for did:web resolution: %w", err)
+	}
+	req.Header.Set("Accept", "application/did+json, application/json")
+
+	client := d.HTTPClient
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	resp, err := client.Do(req)
 	// look for NXDOMAIN
 	var dnsErr *net.DNSError
 	if errors.As(err, &dnsErr) {
@@ -85,17 +138,40 @@ func (d *BaseDirectory) ResolveDIDWeb(ctx context.Context, did syntax.DID) (*DID
 	if err != nil {
 		return nil, fmt.Errorf("%w: did:web HTTP well-known fetch: %w", ErrDIDResolutionFailed, err)
 	}
+	defer resp.Body.Close()
+
 	if resp.StatusCode == http.StatusNotFound {
 		return nil, fmt.Errorf("%w: did:web HTTP status 404", ErrDIDNotFound)
 	}
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		return nil, fmt.Errorf("%w: did:web HTTP redirect (status %d) not followed", ErrDIDResolutionFailed, resp.StatusCode)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("%w: did:web HTTP status %d", ErrDIDResolutionFailed, resp.StatusCode)
 	}
 
+	maxSize := d.DIDWebMaxDocSize
+	if maxSize <= 0 {
+		maxSize = DefaultDIDWebMaxDocSize
+	}
+	if resp.ContentLength > maxSize {
+		return nil, fmt.Errorf("%w: did:web document too large (%d bytes)", ErrDIDResolutionFailed, resp.ContentLength)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: did:web document read: %w", ErrDIDResolutionFailed, err)
+	}
+	if int64(len(b)) > maxSize {
+		return nil, fmt.Errorf("%w: did:web document larger than %d bytes", ErrDIDResolutionFailed, maxSize)
+	}
+
 	var doc DIDDocument
-	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+	if err := json.Unmarshal(b, &doc); err != nil {
 		return nil, fmt.Errorf("%w: JSON DID document parse: %w", ErrDIDResolutionFailed, err)
 	}
+	if doc.DID != did {
+		return nil, fmt.Errorf("%w: did:web document is for another DID: %s", ErrDIDResolutionFailed, doc.DID)
+	}
 	return &doc, nil
 }
 
@@ -1,11 +1,18 @@
 package identity
 
 import (
+	"context"
 	"encoding/json"
 	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -78,3 +85,101 @@ func TestDIDDocFeedGenParse(t *testing.T) {
 	assert.True(ok)
 	assert.Equal("https://discover.bsky.social", svc.URL)
 }
+
+func TestDIDWebURL(t *testing.T) {
+	assert := assert.New(t)
+
+	testCases := []struct {
+		did      string
+		insecure bool
+		url      string
+	}{
+		{did: "did:web:example.com", url: "https://example.com/.well-known/did.json"},
+		{did: "did:web:Example.COM", url: "https://example.com/.well-known/did.json"},
+		{did: "did:web:localhost%3A2582", insecure: true, url: "http://localhost:2582/.well-known/did.json"},
+		{did: "did:web:localhost", insecure: true, url: "http://localhost/.well-known/did.json"},
+		// paths aren't supported
+		{did: "did:web:example.com:user:alice"},
+		// ports only for localhost
+		{did: "did:web:example.com%3A8443"},
+		{did: "did:web:example.com%3A8443", insecure: true},
+		{did: "did:web:localhost%3A2582"},
+		{did: "did:web:localhost%3A99999", insecure: true},
+		{did: "did:web:127.0.0.1"},
+		{did: "did:web:example.arpa"},
+		{did: "did:plc:ewvi7nxzyoun6zhxrhs64oiz"},
+	}
+	for _, tc := range testCases {
+		u, err := didWebURL(syntax.DID(tc.did), tc.insecure)
+		if tc.url == "" {
+			assert.Error(err, tc.did)
+			continue
+		}
+		assert.NoError(err, tc.did)
+		assert.Equal(tc.url, u, tc.did)
+	}
+}
+
+func TestResolveDIDWeb(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	did := syntax.DID("did:web:localhost%3A" + port)
+
+	var body []byte
+	mux.HandleFunc("/.well-known/did.json", func(w http.ResponseWriter, r *http.Request) {
+		if body == nil {
+			http.Redirect(w, r, "https://example.com/.well-known/did.json", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/did+json")
+		w.Write(body)
+	})
+
+	dir := BaseDirectory{DIDWebAllowInsecureLocalhost: true, DIDWebMaxDocSize: 1024}
+
+	body, err = json.Marshal(DIDDocument{
+		DID:         did,
+		AlsoKnownAs: []string{"at://alice.example.com"},
+		Service: []DocService{{
+			ID:              "#atproto_pds",
+			Type:            "AtprotoPersonalDataServer",
+			ServiceEndpoint: "https://pds.example.com",
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := dir.ResolveDIDWeb(ctx, did)
+	assert.NoError(err)
+	if doc != nil {
+		ident := ParseIdentity(doc)
+		assert.Equal("https://pds.example.com", ident.PDSEndpoint())
+	}
+
+	// a document for another DID
+	body, _ = json.Marshal(DIDDocument{DID: "did:web:example.com"})
+	_, err = dir.ResolveDIDWeb(ctx, did)
+	assert.ErrorIs(err, ErrDIDResolutionFailed)
+
+	// too large
+	body, _ = json.Marshal(DIDDocument{DID: did, AlsoKnownAs: []string{strings.Repeat("a", 2000)}})
+	_, err = dir.ResolveDIDWeb(ctx, did)
+	assert.ErrorIs(err, ErrDIDResolutionFailed)
+
+	// redirects aren't followed
+	body = nil
+	_, err = dir.ResolveDIDWeb(ctx, did)
+	assert.ErrorIs(err, ErrDIDResolutionFailed)
+
+	// plain HTTP to localhost isn't allowed by default
+	_, err = (&BaseDirectory{}).ResolveDIDWeb(ctx, did)
+	assert.Error(err)
+}
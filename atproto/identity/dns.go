@@ -0,0 +1,211 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// TXTResolver looks up DNS TXT records. *net.Resolver implements it, as does DoHResolver. A name which doesn't exist should be a *net.DNSError with IsNotFound set.
+type TXTResolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DNSResolver is one of the resolvers used by BaseDirectory for handle DNS lookups.
+type DNSResolver struct {
+	// Name for logs and errors, eg the address of the server
+	Name     string
+	Resolver TXTResolver
+	// Timeout of each lookup, if not zero
+	Timeout time.Duration
+}
+
+// ParseDNSResolver returns a resolver from its configuration string: "system" for the system resolver, an "https://" URL for a DNS-over-HTTPS endpoint (RFC 8484), or else the "host:port" of a DNS server (port 53 if missing).
+func ParseDNSResolver(spec string, timeout time.Duration) (DNSResolver, error) {
+	r := DNSResolver{
+		Name:    spec,
+		Timeout: timeout,
+	}
+	switch {
+	case spec == "system":
+		r.Resolver = net.DefaultResolver
+	case strings.HasPrefix(spec, "https://"):
+		r.Resolver = &DoHResolver{URL: spec}
+	case spec == "" || strings.Contains(spec, "/"):
+		return r, fmt.Errorf("invalid DNS resolver: %q", spec)
+	default:
+		addr := spec
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "53")
+		}
+		r.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				rd := net.Dialer{
+					Timeout: time.Second * 5,
+				}
+				return rd.DialContext(ctx, network, addr)
+			},
+		}
+	}
+	return r, nil
+}
+
+// Max size of a DNS-over-HTTPS response
+const maxDoHResponseSize = 64 * 1024
+
+// DoHResolver looks up TXT records with DNS-over-HTTPS (RFC 8484), as supported by most public resolvers (eg, 'https://cloudflare-dns.com/dns-query' or 'https://dns.google/dns-query').
+type DoHResolver struct {
+	URL string
+	// HTTP client used for queries; http.DefaultClient if nil
+	Client *http.Client
+}
+
+func (r *DoHResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	fqdn := name
+	if !strings.HasSuffix(fqdn, ".") {
+		fqdn += "."
+	}
+	qname, err := dnsmessage.NewName(fqdn)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name}
+	}
+
+	// ID zero, as recommended for caching by the RFC
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{RecursionDesired: true})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: qname, Type: dnsmessage.TypeTXT, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	query, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	sep := "?"
+	if strings.Contains(r.URL, "?") {
+		sep = "&"
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", r.URL+sep+"dns="+base64.RawURLEncoding.EncodeToString(query), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/dns-message")
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name, Server: r.URL, IsTemporary: true}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &net.DNSError{Err: fmt.Sprintf("DoH HTTP status %d", resp.StatusCode), Name: name, Server: r.URL, IsTemporary: true}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDoHResponseSize))
+	if err != nil {
+		return nil, &net.DNSError{Err: err.Error(), Name: name, Server: r.URL, IsTemporary: true}
+	}
+
+	return parseTXTMessage(body, name, r.URL)
+}
+
+func parseTXTMessage(msg []byte, name, server string) ([]string, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(msg)
+	if err != nil {
+		return nil, &net.DNSError{Err: "invalid DNS response: " + err.Error(), Name: name, Server: server}
+	}
+	switch h.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, &net.DNSError{Err: "no such host", Name: name, Server: server, IsNotFound: true}
+	default:
+		return nil, &net.DNSError{Err: "DNS response code " + h.RCode.String(), Name: name, Server: server, IsTemporary: h.RCode == dnsmessage.RCodeServerFailure}
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, &net.DNSError{Err: "invalid DNS response: " + err.Error(), Name: name, Server: server}
+	}
+
+	var txts []string
+	for {
+		ah, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return nil, &net.DNSError{Err: "invalid DNS response: " + err.Error(), Name: name, Server: server}
+		}
+		if ah.Type != dnsmessage.TypeTXT {
+			if err := p.SkipAnswer(); err != nil {
+				return nil, &net.DNSError{Err: "invalid DNS response: " + err.Error(), Name: name, Server: server}
+			}
+			continue
+		}
+		rr, err := p.TXTResource()
+		if err != nil {
+			return nil, &net.DNSError{Err: "invalid DNS response: " + err.Error(), Name: name, Server: server}
+		}
+		// the strings of a record are concatenated, as by net.Resolver
+		var buf bytes.Buffer
+		for _, s := range rr.TXT {
+			buf.WriteString(s)
+		}
+		txts = append(txts, buf.String())
+	}
+	if len(txts) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: name, Server: server, IsNotFound: true}
+	}
+	return txts, nil
+}
+
+// Looks up TXT records with the configured DNSResolvers, in order, until one answers, or with Resolver if there are none. A name which doesn't exist for one resolver is still looked up with the next ones, in case it has a stale or partial view.
+func (d *BaseDirectory) lookupTXT(ctx context.Context, name string) ([]string, error) {
+	if len(d.DNSResolvers) == 0 {
+		return d.Resolver.LookupTXT(ctx, name)
+	}
+
+	var notFound, lastErr error
+	for _, r := range d.DNSResolvers {
+		res, err := lookupTXTWith(ctx, r, name)
+		if err == nil {
+			return res, nil
+		}
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			notFound = err
+		} else {
+			lastErr = fmt.Errorf("resolver %s: %w", r.Name, err)
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if notFound != nil {
+		return nil, notFound
+	}
+	return nil, lastErr
+}
+
+func lookupTXTWith(ctx context.Context, r DNSResolver, name string) ([]string, error) {
+	if r.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Timeout)
+		defer cancel()
+	}
+	return r.Resolver.LookupTXT(ctx, name)
+}
@@ -0,0 +1,221 @@
+package identity
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Minimal DNS-over-HTTPS server answering TXT queries from records.
+func dohServer(t *testing.T, records map[string][]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		var p dnsmessage.Parser
+		h, err := p.Start(query)
+		if err != nil {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+		q, err := p.Question()
+		if err != nil {
+			http.Error(w, "bad query", http.StatusBadRequest)
+			return
+		}
+
+		name := strings.TrimSuffix(q.Name.String(), ".")
+		txts, ok := records[name]
+		rh := dnsmessage.Header{ID: h.ID, Response: true, RecursionDesired: true, RecursionAvailable: true}
+		if !ok {
+			rh.RCode = dnsmessage.RCodeNameError
+		}
+		b := dnsmessage.NewBuilder(nil, rh)
+		if err := b.StartQuestions(); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Question(q); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.StartAnswers(); err != nil {
+			t.Fatal(err)
+		}
+		for _, txt := range txts {
+			err := b.TXTResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.TXTResource{TXT: []string{txt}})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		msg, err := b.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(msg)
+	}))
+}
+
+func TestDoHResolver(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	srv := dohServer(t, map[string][]string{
+		"_atproto.handle.example.com": {"did=did:plc:ewvi7nxzyoun6zhxrhs64oiz"},
+	})
+	defer srv.Close()
+
+	r := &DoHResolver{URL: srv.URL + "/dns-query"}
+	res, err := r.LookupTXT(ctx, "_atproto.handle.example.com")
+	assert.NoError(err)
+	assert.Equal([]string{"did=did:plc:ewvi7nxzyoun6zhxrhs64oiz"}, res)
+
+	_, err = r.LookupTXT(ctx, "_atproto.missing.example.com")
+	var dnsErr *net.DNSError
+	assert.True(errors.As(err, &dnsErr))
+	assert.True(dnsErr.IsNotFound)
+
+	dir := BaseDirectory{
+		DNSResolvers: []DNSResolver{{Name: "doh", Resolver: r, Timeout: time.Second}},
+	}
+	did, err := dir.ResolveHandleDNS(ctx, syntax.Handle("handle.example.com"))
+	assert.NoError(err)
+	assert.Equal(syntax.DID("did:plc:ewvi7nxzyoun6zhxrhs64oiz"), did)
+
+	_, err = dir.ResolveHandleDNS(ctx, syntax.Handle("missing.example.com"))
+	assert.ErrorIs(err, ErrHandleNotFound)
+}
+
+type funcResolver func(ctx context.Context, name string) ([]string, error)
+
+func (f funcResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	return f(ctx, name)
+}
+
+func TestDNSResolversOrder(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	hanging := funcResolver(func(ctx context.Context, name string) ([]string, error) {
+		<-ctx.Done()
+		return nil, &net.DNSError{Err: ctx.Err().Error(), Name: name, IsTimeout: true}
+	})
+	notFound := funcResolver(func(ctx context.Context, name string) ([]string, error) {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	})
+	found := funcResolver(func(ctx context.Context, name string) ([]string, error) {
+		return []string{"did=did:plc:ewvi7nxzyoun6zhxrhs64oiz"}, nil
+	})
+	handle := syntax.Handle("handle.example.com")
+
+	// a timeout or a missing name moves on to the next resolver
+	dir := BaseDirectory{
+		DNSResolvers: []DNSResolver{
+			{Name: "hanging", Resolver: hanging, Timeout: 10 * time.Millisecond},
+			{Name: "stale", Resolver: notFound},
+			{Name: "good", Resolver: found},
+		},
+	}
+	did, err := dir.ResolveHandleDNS(ctx, handle)
+	assert.NoError(err)
+	assert.Equal(syntax.DID("did:plc:ewvi7nxzyoun6zhxrhs64oiz"), did)
+
+	// not found anywhere takes precedence over failures of other resolvers
+	dir.DNSResolvers = []DNSResolver{
+		{Name: "hanging", Resolver: hanging, Timeout: 10 * time.Millisecond},
+		{Name: "stale", Resolver: notFound},
+	}
+	_, err = dir.ResolveHandleDNS(ctx, handle)
+	assert.ErrorIs(err, ErrHandleNotFound)
+
+	dir.DNSResolvers = []DNSResolver{
+		{Name: "hanging", Resolver: hanging, Timeout: 10 * time.Millisecond},
+	}
+	_, err = dir.ResolveHandleDNS(ctx, handle)
+	assert.ErrorIs(err, ErrHandleResolutionFailed)
+	assert.ErrorContains(err, "resolver hanging")
+}
+
+func TestParseDNSResolver(t *testing.T) {
+	assert := assert.New(t)
+
+	r, err := ParseDNSResolver("https://dns.google/dns-query", time.Second)
+	assert.NoError(err)
+	assert.Equal(&DoHResolver{URL: "https://dns.google/dns-query"}, r.Resolver)
+	assert.Equal(time.Second, r.Timeout)
+
+	r, err = ParseDNSResolver("system", 0)
+	assert.NoError(err)
+	assert.Equal(net.DefaultResolver, r.Resolver)
+
+	r, err = ParseDNSResolver("8.8.8.8", 0)
+	assert.NoError(err)
+	assert.IsType(&net.Resolver{}, r.Resolver)
+
+	for _, bad := range []string{"", "http://dns.google/dns-query", "8.8.8.8/24"} {
+		_, err = ParseDNSResolver(bad, 0)
+		assert.Error(err, bad)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestResolveHandleParallel(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// DNS only answers once cancelled, so success must come from HTTP well-known
+	dnsCancelled := make(chan struct{})
+	slowDNS := funcResolver(func(ctx context.Context, name string) ([]string, error) {
+		<-ctx.Done()
+		close(dnsCancelled)
+		return nil, &net.DNSError{Err: ctx.Err().Error(), Name: name, IsTimeout: true}
+	})
+	wellKnown := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/.well-known/atproto-did" {
+			return &http.Response{StatusCode: http.StatusNotFound, Body: io.NopCloser(strings.NewReader(""))}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("did:plc:ewvi7nxzyoun6zhxrhs64oiz\n"))}, nil
+	})
+
+	dir := BaseDirectory{
+		HTTPClient:               http.Client{Transport: wellKnown},
+		DNSResolvers:             []DNSResolver{{Name: "slow", Resolver: slowDNS}},
+		ParallelHandleResolution: true,
+	}
+	did, err := dir.ResolveHandle(ctx, syntax.Handle("handle.example.com"))
+	assert.NoError(err)
+	assert.Equal(syntax.DID("did:plc:ewvi7nxzyoun6zhxrhs64oiz"), did)
+	select {
+	case <-dnsCancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("DNS lookup was not cancelled")
+	}
+
+	// with both failing, the most specific error is returned
+	dir.DNSResolvers = []DNSResolver{{Name: "missing", Resolver: funcResolver(func(ctx context.Context, name string) ([]string, error) {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	})}}
+	dir.HTTPClient.Transport = roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusInternalServerError, Body: io.NopCloser(strings.NewReader(""))}, nil
+	})
+	_, err = dir.ResolveHandle(ctx, syntax.Handle("handle.example.com"))
+	assert.ErrorIs(err, ErrHandleResolutionFailed)
+}
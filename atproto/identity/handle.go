@@ -30,7 +30,7 @@ func parseTXTResp(res []string) (syntax.DID, error) {
 
 // Does not cross-verify, only does the handle resolution step.
 func (d *BaseDirectory) ResolveHandleDNS(ctx context.Context, handle syntax.Handle) (syntax.DID, error) {
-	res, err := d.Resolver.LookupTXT(ctx, "_atproto."+handle.String())
+	res, err := d.lookupTXT(ctx, "_atproto."+handle.String())
 	// check for NXDOMAIN
 	var dnsErr *net.DNSError
 	if errors.As(err, &dnsErr) {
@@ -163,60 +163,104 @@ func (d *BaseDirectory) ResolveHandleWellKnown(ctx context.Context, handle synta
 }
 
 func (d *BaseDirectory) ResolveHandle(ctx context.Context, handle syntax.Handle) (syntax.DID, error) {
-	// TODO: *could* do resolution in parallel, but expecting that sequential is sufficient to start
-	var dnsErr error
-	var did syntax.DID
-
 	if !handle.AllowedTLD() {
 		return "", ErrHandleReservedTLD
 	}
 
-	tryDNS := true
-	for _, suffix := range d.SkipDNSDomainSuffixes {
-		if strings.HasSuffix(handle.String(), suffix) {
-			tryDNS = false
-			break
-		}
+	if d.ParallelHandleResolution {
+		return d.resolveHandleParallel(ctx, handle)
+	}
+
+	did, dnsErr := d.resolveHandleDNSWithFallbacks(ctx, handle)
+	if nil == dnsErr { // if *not* an error
+		return did, nil
+	}
+	did, httpErr := d.resolveHandleWellKnownLogged(ctx, handle)
+	if nil == httpErr { // if *not* an error
+		return did, nil
+	}
+	return "", mostSpecificHandleErr(dnsErr, httpErr)
+}
+
+// Runs DNS and HTTP well-known resolution concurrently, and returns the first success, cancelling the other.
+func (d *BaseDirectory) resolveHandleParallel(ctx context.Context, handle syntax.Handle) (syntax.DID, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		did  syntax.DID
+		err  error
+		http bool
 	}
+	results := make(chan result, 2)
+	go func() {
+		did, err := d.resolveHandleDNSWithFallbacks(ctx, handle)
+		results <- result{did: did, err: err}
+	}()
+	go func() {
+		did, err := d.resolveHandleWellKnownLogged(ctx, handle)
+		results <- result{did: did, err: err, http: true}
+	}()
 
-	if tryDNS {
-		start := time.Now()
-		triedAuthoritative := false
-		triedFallback := false
-		did, dnsErr = d.ResolveHandleDNS(ctx, handle)
-		if errors.Is(dnsErr, ErrHandleNotFound) && d.TryAuthoritativeDNS {
-			slog.Info("attempting authoritative handle DNS resolution", "handle", handle)
-			triedAuthoritative = true
-			// try harder with authoritative lookup
-			did, dnsErr = d.ResolveHandleDNSAuthoritative(ctx, handle)
+	var dnsErr, httpErr error
+	for i := 0; i < 2; i++ {
+		res := <-results
+		if res.err == nil {
+			return res.did, nil
 		}
-		if errors.Is(dnsErr, ErrHandleNotFound) && len(d.FallbackDNSServers) > 0 {
-			slog.Info("attempting fallback DNS resolution", "handle", handle)
-			triedFallback = true
-			// try harder with fallback lookup
-			did, dnsErr = d.ResolveHandleDNSFallback(ctx, handle)
+		if res.http {
+			httpErr = res.err
+		} else {
+			dnsErr = res.err
 		}
-		elapsed := time.Since(start)
-		slog.Debug("resolve handle DNS", "handle", handle, "err", dnsErr, "did", did, "authoritative", triedAuthoritative, "fallback", triedFallback, "duration_ms", elapsed.Milliseconds())
-		if nil == dnsErr { // if *not* an error
-			return did, nil
+	}
+	return "", mostSpecificHandleErr(dnsErr, httpErr)
+}
+
+// DNS resolution of a handle, trying harder with the authoritative nameserver and fallback servers if configured. Returns ErrHandleNotFound if DNS resolution is skipped for the handle.
+func (d *BaseDirectory) resolveHandleDNSWithFallbacks(ctx context.Context, handle syntax.Handle) (syntax.DID, error) {
+	for _, suffix := range d.SkipDNSDomainSuffixes {
+		if strings.HasSuffix(handle.String(), suffix) {
+			return "", ErrHandleNotFound
 		}
 	}
 
+	start := time.Now()
+	triedAuthoritative := false
+	triedFallback := false
+	did, dnsErr := d.ResolveHandleDNS(ctx, handle)
+	if errors.Is(dnsErr, ErrHandleNotFound) && d.TryAuthoritativeDNS {
+		slog.Info("attempting authoritative handle DNS resolution", "handle", handle)
+		triedAuthoritative = true
+		// try harder with authoritative lookup
+		did, dnsErr = d.ResolveHandleDNSAuthoritative(ctx, handle)
+	}
+	if errors.Is(dnsErr, ErrHandleNotFound) && len(d.FallbackDNSServers) > 0 {
+		slog.Info("attempting fallback DNS resolution", "handle", handle)
+		triedFallback = true
+		// try harder with fallback lookup
+		did, dnsErr = d.ResolveHandleDNSFallback(ctx, handle)
+	}
+	elapsed := time.Since(start)
+	slog.Debug("resolve handle DNS", "handle", handle, "err", dnsErr, "did", did, "authoritative", triedAuthoritative, "fallback", triedFallback, "duration_ms", elapsed.Milliseconds())
+	return did, dnsErr
+}
+
+func (d *BaseDirectory) resolveHandleWellKnownLogged(ctx context.Context, handle syntax.Handle) (syntax.DID, error) {
 	start := time.Now()
 	did, httpErr := d.ResolveHandleWellKnown(ctx, handle)
 	elapsed := time.Since(start)
 	slog.Debug("resolve handle HTTP well-known", "handle", handle, "err", httpErr, "did", did, "duration_ms", elapsed.Milliseconds())
-	if nil == httpErr { // if *not* an error
-		return did, nil
-	}
+	return did, httpErr
+}
 
-	// return the most specific/helpful error
+// Returns the most specific/helpful of the errors of DNS and HTTP handle resolution.
+func mostSpecificHandleErr(dnsErr, httpErr error) error {
 	if !errors.Is(dnsErr, ErrHandleNotFound) {
-		return "", dnsErr
+		return dnsErr
 	}
 	if !errors.Is(httpErr, ErrHandleNotFound) {
-		return "", httpErr
+		return httpErr
 	}
-	return "", dnsErr
+	return dnsErr
 }
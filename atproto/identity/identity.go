@@ -30,6 +30,10 @@ type Directory interface {
 	LookupDID(ctx context.Context, d syntax.DID) (*Identity, error)
 	Lookup(ctx context.Context, i syntax.AtIdentifier) (*Identity, error)
 
+	// Batch versions of LookupDID and LookupHandle, which resolve many identifiers concurrently, and each distinct identifier only once. Results are in the same order as the input, with a per-identifier error.
+	LookupDIDs(ctx context.Context, dids []syntax.DID) []LookupResult
+	LookupHandles(ctx context.Context, handles []syntax.Handle) []LookupResult
+
 	// Flushes any cache of the indicated identifier. If directory is not using caching, can ignore this.
 	Purge(ctx context.Context, i syntax.AtIdentifier) error
 }
@@ -65,3 +65,11 @@ func (d *MockDirectory) Lookup(ctx context.Context, a syntax.AtIdentifier) (*Ide
 func (d *MockDirectory) Purge(ctx context.Context, a syntax.AtIdentifier) error {
 	return nil
 }
+
+func (d *MockDirectory) LookupDIDs(ctx context.Context, dids []syntax.DID) []LookupResult {
+	return LookupDIDsWith(ctx, dids, 1, d.LookupDID)
+}
+
+func (d *MockDirectory) LookupHandles(ctx context.Context, handles []syntax.Handle) []LookupResult {
+	return LookupHandlesWith(ctx, handles, 1, d.LookupHandle)
+}
@@ -3,6 +3,7 @@ package syntax
 import (
 	"fmt"
 	"regexp"
+	"strings"
 )
 
 var recordKeyRegex = regexp.MustCompile(`^[a-zA-Z0-9_~.-]{1,512}$`)
@@ -43,3 +44,52 @@ func (r *RecordKey) UnmarshalText(text []byte) error {
 	*r = rkey
 	return nil
 }
+
+// Record key for singleton records which use the "literal:self" key type, like 'app.bsky.actor.profile'
+const RecordKeySelf = RecordKey("self")
+
+// Generates a new record key using the "tid" scheme, from the provided clock (which ensures monotonically increasing keys).
+func NewRecordKeyTID(clock *TIDClock) RecordKey {
+	return RecordKey(clock.Next().String())
+}
+
+// Creates a record key for the "nsid" scheme (eg, for records which are scoped to a specific Lexicon).
+func NewRecordKeyNSID(nsid NSID) (RecordKey, error) {
+	if _, err := ParseNSID(nsid.String()); err != nil {
+		return "", fmt.Errorf("invalid NSID for recordkey: %w", err)
+	}
+	return ParseRecordKey(nsid.String())
+}
+
+// Creates a record key for a "literal:<value>" scheme, verifying that the value is a valid record key.
+func NewRecordKeyLiteral(val string) (RecordKey, error) {
+	return ParseRecordKey(val)
+}
+
+// Checks that the record key is valid for the given Lexicon record key type: "tid", "nsid", "any", or "literal:<value>".
+func (r RecordKey) ValidateType(keyType string) error {
+	if _, err := ParseRecordKey(r.String()); err != nil {
+		return err
+	}
+	switch {
+	case keyType == "any":
+		return nil
+	case keyType == "tid":
+		if _, err := ParseTID(r.String()); err != nil {
+			return fmt.Errorf("recordkey is not a valid TID: %w", err)
+		}
+		return nil
+	case keyType == "nsid":
+		if _, err := ParseNSID(r.String()); err != nil {
+			return fmt.Errorf("recordkey is not a valid NSID: %w", err)
+		}
+		return nil
+	case strings.HasPrefix(keyType, "literal:"):
+		if r.String() != keyType[len("literal:"):] {
+			return fmt.Errorf("recordkey does not match literal: %s", keyType)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown recordkey type: %s", keyType)
+	}
+}
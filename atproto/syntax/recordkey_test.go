@@ -55,3 +55,39 @@ func TestRecordKeyNoPanic(t *testing.T) {
 		_ = bad.String()
 	}
 }
+
+func TestRecordKeyGeneration(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := NewTIDClock(0)
+	k1 := NewRecordKeyTID(clock)
+	k2 := NewRecordKeyTID(clock)
+	assert.True(k1 < k2)
+	assert.NoError(k1.ValidateType("tid"))
+	assert.NoError(k1.ValidateType("any"))
+	assert.Error(k1.ValidateType("nsid"))
+	assert.Error(k1.ValidateType("literal:self"))
+
+	assert.NoError(RecordKeySelf.ValidateType("literal:self"))
+	assert.NoError(RecordKeySelf.ValidateType("any"))
+	assert.Error(RecordKeySelf.ValidateType("tid"))
+	assert.Error(RecordKeySelf.ValidateType("literal:other"))
+
+	k3, err := NewRecordKeyNSID(NSID("com.example.record"))
+	assert.NoError(err)
+	assert.Equal(RecordKey("com.example.record"), k3)
+	assert.NoError(k3.ValidateType("nsid"))
+	_, err = NewRecordKeyNSID(NSID("not an nsid"))
+	assert.Error(err)
+
+	k4, err := NewRecordKeyLiteral("self")
+	assert.NoError(err)
+	assert.Equal(RecordKeySelf, k4)
+	_, err = NewRecordKeyLiteral("..")
+	assert.Error(err)
+	_, err = NewRecordKeyLiteral("has space")
+	assert.Error(err)
+
+	assert.Error(RecordKey("..").ValidateType("any"))
+	assert.Error(RecordKeySelf.ValidateType("dunno"))
+}
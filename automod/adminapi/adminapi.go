@@ -0,0 +1,235 @@
+// Small authenticated HTTP API for runtime introspection and control of an automod engine: which rules are configured, per-rule statistics, recent rule triggers, and endpoints to toggle rules and adjust thresholds without a restart.
+package adminapi
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bluesky-social/indigo/automod"
+)
+
+// Access to the numeric rule thresholds, which are owned by the rules package (see rules.Thresholds and rules.SetThreshold).
+type ThresholdStore interface {
+	Thresholds() map[string]int
+	SetThreshold(name string, val int) error
+}
+
+type Server struct {
+	Engine *automod.Engine
+	// bearer token required on every request. Must be non-empty.
+	Token string
+	// if nil, threshold endpoints return an error (optional)
+	Thresholds ThresholdStore
+	Logger     *slog.Logger
+}
+
+type RulesResponse struct {
+	// rule names by type (eg, "post"), for each rule set. The primary rules have an empty name.
+	RuleSets map[string]map[string][]string `json:"ruleSets"`
+	Disabled []string                       `json:"disabled"`
+}
+
+type ToggleRequest struct {
+	Rule string `json:"rule"`
+}
+
+type ThresholdRequest struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
+
+type errorBody struct {
+	Error   string `json:"error"`
+	Message string `json:"message"`
+}
+
+// Returns an HTTP handler for the API, with all endpoints under "/admin/".
+//
+// The engine should have a RuleMonitor (for the metrics and triggers endpoints) and RuleToggles (for the enable and disable endpoints); endpoints which need them return an error otherwise.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/rules", s.handleRules)
+	mux.HandleFunc("/admin/rules/disable", s.handleToggle(false))
+	mux.HandleFunc("/admin/rules/enable", s.handleToggle(true))
+	mux.HandleFunc("/admin/thresholds", s.handleThresholds)
+	mux.HandleFunc("/admin/metrics", s.handleMetrics)
+	mux.HandleFunc("/admin/triggers", s.handleTriggers)
+	return s.checkAuth(mux)
+}
+
+func (s *Server) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
+
+func (s *Server) checkAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.Token == "" || !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "Unauthorized", "missing or invalid admin token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	resp := RulesResponse{
+		RuleSets: map[string]map[string][]string{
+			"": s.Engine.Rules.RuleNames(),
+		},
+		Disabled: []string{},
+	}
+	for _, nrs := range s.Engine.RuleSets {
+		resp.RuleSets[nrs.Name] = nrs.Rules.RuleNames()
+	}
+	if s.Engine.RuleToggles != nil {
+		resp.Disabled = s.Engine.RuleToggles.Disabled()
+	}
+	writeJSON(w, resp)
+}
+
+func (s *Server) handleToggle(enable bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodPost) {
+			return
+		}
+		if s.Engine.RuleToggles == nil {
+			writeError(w, http.StatusNotImplemented, "NotConfigured", "engine does not support toggling rules")
+			return
+		}
+		var req ToggleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidRequest", fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		if !s.knownRule(req.Rule) {
+			writeError(w, http.StatusBadRequest, "UnknownRule", fmt.Sprintf("no such rule: %q", req.Rule))
+			return
+		}
+		if enable {
+			s.Engine.RuleToggles.Enable(req.Rule)
+		} else {
+			s.Engine.RuleToggles.Disable(req.Rule)
+		}
+		s.logger().Warn("rule toggled via admin API", "rule", req.Rule, "enabled", enable)
+		writeJSON(w, map[string]any{"disabled": s.Engine.RuleToggles.Disabled()})
+	}
+}
+
+// Checks if the rule name is in any of the engine's rule sets.
+func (s *Server) knownRule(name string) bool {
+	sets := []automod.RuleSet{s.Engine.Rules}
+	for _, nrs := range s.Engine.RuleSets {
+		sets = append(sets, nrs.Rules)
+	}
+	for _, rs := range sets {
+		for _, names := range rs.RuleNames() {
+			for _, n := range names {
+				if n == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (s *Server) handleThresholds(w http.ResponseWriter, r *http.Request) {
+	if s.Thresholds == nil {
+		writeError(w, http.StatusNotImplemented, "NotConfigured", "thresholds are not configurable")
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, s.Thresholds.Thresholds())
+	case http.MethodPost:
+		var req ThresholdRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidRequest", fmt.Sprintf("invalid request body: %v", err))
+			return
+		}
+		if err := s.Thresholds.SetThreshold(req.Name, req.Value); err != nil {
+			writeError(w, http.StatusBadRequest, "InvalidThreshold", err.Error())
+			return
+		}
+		s.logger().Warn("rule threshold updated via admin API", "name", req.Name, "value", req.Value)
+		writeJSON(w, s.Thresholds.Thresholds())
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "expected GET or POST")
+	}
+}
+
+type ruleStatsEntry struct {
+	Rule string `json:"rule"`
+	automod.RuleStats
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	if s.Engine.RuleMonitor == nil {
+		writeError(w, http.StatusNotImplemented, "NotConfigured", "engine does not have a rule monitor")
+		return
+	}
+	stats := s.Engine.RuleMonitor.Stats()
+	out := make([]ruleStatsEntry, 0, len(stats))
+	for name, st := range stats {
+		out = append(out, ruleStatsEntry{Rule: name, RuleStats: st})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Rule < out[j].Rule })
+	writeJSON(w, map[string]any{"rules": out})
+}
+
+func (s *Server) handleTriggers(w http.ResponseWriter, r *http.Request) {
+	if !requireMethod(w, r, http.MethodGet) {
+		return
+	}
+	if s.Engine.RuleMonitor == nil {
+		writeError(w, http.StatusNotImplemented, "NotConfigured", "engine does not have a rule monitor")
+		return
+	}
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "InvalidRequest", "limit must be a positive integer")
+			return
+		}
+		limit = n
+	}
+	writeJSON(w, map[string]any{"triggers": s.Engine.RuleMonitor.Recent(limit)})
+}
+
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "expected "+method)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("failed to write admin API response", "err", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, name, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(errorBody{Error: name, Message: msg})
+}
@@ -0,0 +1,89 @@
+package adminapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/engine"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type memThresholds map[string]int
+
+func (m memThresholds) Thresholds() map[string]int {
+	return m
+}
+
+func (m memThresholds) SetThreshold(name string, val int) error {
+	if _, ok := m[name]; !ok {
+		return fmt.Errorf("unknown rule threshold: %s", name)
+	}
+	m[name] = val
+	return nil
+}
+
+func TestAdminAPI(t *testing.T) {
+	assert := assert.New(t)
+
+	eng := engine.EngineTestFixture()
+	eng.RuleMonitor = automod.NewRuleMonitor(10)
+	eng.RuleToggles = automod.NewRuleToggles()
+	s := Server{
+		Engine:     &eng,
+		Token:      "secret",
+		Thresholds: memThresholds{"some-limit": 5},
+	}
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	call := func(method, path, token, body string) (int, map[string]any) {
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		assert.NoError(err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(err)
+		defer resp.Body.Close()
+		var out map[string]any
+		assert.NoError(json.NewDecoder(resp.Body).Decode(&out))
+		return resp.StatusCode, out
+	}
+
+	status, _ := call("GET", "/admin/rules", "", "")
+	assert.Equal(http.StatusUnauthorized, status)
+	status, _ = call("GET", "/admin/rules", "wrong", "")
+	assert.Equal(http.StatusUnauthorized, status)
+
+	status, out := call("GET", "/admin/rules", "secret", "")
+	assert.Equal(http.StatusOK, status)
+	assert.Contains(fmt.Sprint(out["ruleSets"]), "simpleRule")
+
+	status, _ = call("POST", "/admin/rules/disable", "secret", `{"rule": "rules.NoSuchRule"}`)
+	assert.Equal(http.StatusBadRequest, status)
+	status, out = call("POST", "/admin/rules/disable", "secret", `{"rule": "simpleRule"}`)
+	assert.Equal(http.StatusOK, status)
+	assert.Equal([]any{"simpleRule"}, out["disabled"])
+	assert.True(eng.RuleToggles.IsDisabled("simpleRule"))
+	status, _ = call("POST", "/admin/rules/enable", "secret", `{"rule": "simpleRule"}`)
+	assert.Equal(http.StatusOK, status)
+	assert.False(eng.RuleToggles.IsDisabled("simpleRule"))
+
+	status, out = call("POST", "/admin/thresholds", "secret", `{"name": "some-limit", "value": 8}`)
+	assert.Equal(http.StatusOK, status)
+	assert.Equal(float64(8), out["some-limit"])
+	status, _ = call("POST", "/admin/thresholds", "secret", `{"name": "other-limit", "value": 8}`)
+	assert.Equal(http.StatusBadRequest, status)
+
+	status, out = call("GET", "/admin/triggers?limit=5", "secret", "")
+	assert.Equal(http.StatusOK, status)
+	assert.Empty(out["triggers"])
+	status, _ = call("GET", "/admin/metrics", "secret", "")
+	assert.Equal(http.StatusOK, status)
+}
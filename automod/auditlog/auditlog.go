@@ -0,0 +1,33 @@
+package auditlog
+
+import (
+	"context"
+	"time"
+)
+
+// Record of a single moderation action emitted by automod, with enough context to trace the decision back to the rules (and counter values) which caused it.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// Type of action, like "account-label", "record-flag", "account-report", or "record-takedown"
+	Action string `json:"action"`
+	// Label or flag value, or report reason type (empty for takedowns)
+	Value string `json:"value,omitempty"`
+	// Report comment, if any
+	Comment string `json:"comment,omitempty"`
+	DID     string `json:"did"`
+	// AT-URI of the record, for record-level actions
+	URI string `json:"uri,omitempty"`
+	CID string `json:"cid,omitempty"`
+	// Names of the rules which queued this action (see engine.RuleSet.RuleNames). May be empty if the action could not be attributed.
+	Rules []string `json:"rules,omitempty"`
+	// Name of the rule set, for actions from a NamedRuleSet
+	RuleSet string `json:"ruleSet,omitempty"`
+	// Counter values read by those rules while processing the event, keyed by "<name>/<value>/<period>"
+	Counters map[string]int `json:"counters,omitempty"`
+}
+
+// Destination for audit log entries. Implementations must be safe for concurrent use.
+type Sink interface {
+	Write(ctx context.Context, entries []Entry) error
+	Close() error
+}
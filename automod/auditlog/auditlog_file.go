@@ -0,0 +1,71 @@
+package auditlog
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Sink which appends entries to a local file as newline-delimited JSON (NDJSON), one entry per line.
+type FileSink struct {
+	lk   sync.Mutex
+	file *os.File
+}
+
+var _ Sink = (*FileSink)(nil)
+
+// Opens (or creates) the file for appending.
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log file: %w", err)
+	}
+	return &FileSink{file: f}, nil
+}
+
+func (s *FileSink) Write(ctx context.Context, entries []Entry) error {
+	// serialize the whole batch first, so a batch is written with a single call
+	var buf []byte
+	for _, e := range entries {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf = append(buf, b...)
+		buf = append(buf, '\n')
+	}
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	_, err := s.file.Write(buf)
+	return err
+}
+
+func (s *FileSink) Close() error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return s.file.Close()
+}
+
+// Reads NDJSON audit log entries (as written by FileSink), calling the function for each. Stops at the first error.
+func ReadNDJSON(r io.Reader, fn func(Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("parsing audit log entry: %w", err)
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,37 @@
+package auditlog
+
+import (
+	"context"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Publisher implementation for Kafka. Messages are partitioned by key hash, so entries for the same account stay ordered.
+type KafkaPublisher struct {
+	w *kafka.Writer
+}
+
+var _ Publisher = (*KafkaPublisher)(nil)
+
+// Creates a publisher for the given brokers ("host:port"). The topic is set per message, by the PublisherSink.
+func NewKafkaPublisher(brokers []string) *KafkaPublisher {
+	return &KafkaPublisher{w: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 20 * time.Millisecond,
+	}}
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, topic string, key, value []byte) error {
+	return p.w.WriteMessages(ctx, kafka.Message{
+		Topic: topic,
+		Key:   key,
+		Value: value,
+	})
+}
+
+func (p *KafkaPublisher) Close() error {
+	return p.w.Close()
+}
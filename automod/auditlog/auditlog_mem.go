@@ -0,0 +1,36 @@
+package auditlog
+
+import (
+	"context"
+	"sync"
+)
+
+// In-memory Sink, mostly for tests.
+type MemSink struct {
+	lk      sync.Mutex
+	Entries []Entry
+}
+
+var _ Sink = (*MemSink)(nil)
+
+func NewMemSink() *MemSink {
+	return &MemSink{}
+}
+
+func (s *MemSink) Write(ctx context.Context, entries []Entry) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.Entries = append(s.Entries, entries...)
+	return nil
+}
+
+func (s *MemSink) Close() error {
+	return nil
+}
+
+// Returns a copy of all the entries written so far.
+func (s *MemSink) All() []Entry {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	return append([]Entry(nil), s.Entries...)
+}
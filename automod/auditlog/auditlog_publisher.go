@@ -0,0 +1,45 @@
+package auditlog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Minimal message producer interface, which can be implemented with a Kafka (or similar message queue) client library. Messages with the same key are expected to be delivered in order (eg, to the same Kafka partition).
+type Publisher interface {
+	Publish(ctx context.Context, topic string, key, value []byte) error
+	Close() error
+}
+
+// Sink which publishes each entry as a JSON message to a message queue topic, keyed by account DID (so actions against the same account stay ordered).
+type PublisherSink struct {
+	Publisher Publisher
+	Topic     string
+}
+
+var _ Sink = (*PublisherSink)(nil)
+
+func NewPublisherSink(pub Publisher, topic string) *PublisherSink {
+	return &PublisherSink{
+		Publisher: pub,
+		Topic:     topic,
+	}
+}
+
+func (s *PublisherSink) Write(ctx context.Context, entries []Entry) error {
+	for _, e := range entries {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if err := s.Publisher.Publish(ctx, s.Topic, []byte(e.DID), b); err != nil {
+			return fmt.Errorf("publishing audit log entry: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *PublisherSink) Close() error {
+	return s.Publisher.Close()
+}
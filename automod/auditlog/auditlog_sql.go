@@ -0,0 +1,97 @@
+package auditlog
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sink backed by a SQL database (eg, a local SQLite file, or Postgres), so entries can be queried.
+type SQLSink struct {
+	DB *gorm.DB
+}
+
+type AuditEntry struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index"`
+	Action    string
+	Value     string
+	Comment   string
+	DID       string `gorm:"column:did;index"`
+	URI       string `gorm:"column:uri;index"`
+	CID       string `gorm:"column:cid"`
+	// comma-separated
+	Rules   string
+	RuleSet string
+	// JSON object
+	Counters string
+}
+
+var _ Sink = (*SQLSink)(nil)
+
+// Creates the audit table, if needed. See cliutil.SetupDatabase for opening a database from a URL.
+func NewSQLSink(db *gorm.DB) (*SQLSink, error) {
+	if err := db.AutoMigrate(&AuditEntry{}); err != nil {
+		return nil, err
+	}
+	return &SQLSink{DB: db}, nil
+}
+
+func (s *SQLSink) Write(ctx context.Context, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	rows := make([]AuditEntry, 0, len(entries))
+	for _, e := range entries {
+		row := AuditEntry{
+			CreatedAt: e.Time,
+			Action:    e.Action,
+			Value:     e.Value,
+			Comment:   e.Comment,
+			DID:       e.DID,
+			URI:       e.URI,
+			CID:       e.CID,
+			Rules:     strings.Join(e.Rules, ","),
+			RuleSet:   e.RuleSet,
+		}
+		if len(e.Counters) > 0 {
+			b, err := json.Marshal(e.Counters)
+			if err != nil {
+				return err
+			}
+			row.Counters = string(b)
+		}
+		rows = append(rows, row)
+	}
+	return s.DB.WithContext(ctx).Create(&rows).Error
+}
+
+func (s *SQLSink) Close() error {
+	return nil
+}
+
+// Converts a row back in to an Entry.
+func (row *AuditEntry) Entry() (Entry, error) {
+	e := Entry{
+		Time:    row.CreatedAt,
+		Action:  row.Action,
+		Value:   row.Value,
+		Comment: row.Comment,
+		DID:     row.DID,
+		URI:     row.URI,
+		CID:     row.CID,
+		RuleSet: row.RuleSet,
+	}
+	if row.Rules != "" {
+		e.Rules = strings.Split(row.Rules, ",")
+	}
+	if row.Counters != "" {
+		if err := json.Unmarshal([]byte(row.Counters), &e.Counters); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,102 @@
+package auditlog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func testEntries() []Entry {
+	return []Entry{
+		{
+			Time:     time.Now().UTC().Truncate(time.Second),
+			Action:   "account-flag",
+			Value:    "promo",
+			DID:      "did:plc:abc111",
+			Rules:    []string{"rules.AggressivePromotionRule"},
+			Counters: map[string]int{"post/did:plc:abc111/day": 12},
+		},
+		{
+			Time:    time.Now().UTC().Truncate(time.Second),
+			Action:  "record-report",
+			Value:   "com.atproto.moderation.defs#reasonSpam",
+			Comment: "spammy",
+			DID:     "did:plc:abc111",
+			URI:     "at://did:plc:abc111/app.bsky.feed.post/abc123",
+		},
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	sink, err := NewFileSink(path)
+	assert.NoError(err)
+	entries := testEntries()
+	assert.NoError(sink.Write(ctx, entries[:1]))
+	assert.NoError(sink.Write(ctx, entries[1:]))
+	assert.NoError(sink.Close())
+
+	f, err := os.Open(path)
+	assert.NoError(err)
+	defer f.Close()
+	var out []Entry
+	assert.NoError(ReadNDJSON(f, func(e Entry) error {
+		out = append(out, e)
+		return nil
+	}))
+	assert.Equal(entries, out)
+}
+
+func TestSQLSink(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "audit.sqlite")))
+	assert.NoError(err)
+	sink, err := NewSQLSink(db)
+	assert.NoError(err)
+	entries := testEntries()
+	assert.NoError(sink.Write(ctx, entries))
+
+	var rows []AuditEntry
+	assert.NoError(db.Order("id").Find(&rows).Error)
+	assert.Equal(2, len(rows))
+	for i, row := range rows {
+		e, err := row.Entry()
+		assert.NoError(err)
+		assert.True(entries[i].Time.Equal(e.Time))
+		e.Time = entries[i].Time
+		assert.Equal(entries[i], e)
+	}
+}
+
+type memPublisher struct {
+	keys []string
+}
+
+func (p *memPublisher) Publish(ctx context.Context, topic string, key, value []byte) error {
+	p.keys = append(p.keys, topic+"/"+string(key))
+	return nil
+}
+
+func (p *memPublisher) Close() error {
+	return nil
+}
+
+func TestPublisherSink(t *testing.T) {
+	assert := assert.New(t)
+
+	pub := &memPublisher{}
+	sink := NewPublisherSink(pub, "automod-audit")
+	assert.NoError(sink.Write(context.Background(), testEntries()))
+	assert.Equal([]string{"automod-audit/did:plc:abc111", "automod-audit/did:plc:abc111"}, pub.keys)
+}
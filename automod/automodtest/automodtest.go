@@ -0,0 +1,331 @@
+// Package automodtest contains helpers for unit testing individual automod rules, without running a full engine or loading captured account data.
+//
+// Fixtures (fake accounts, posts, profiles) are constructed with the helpers in this package, and can be adjusted by setting fields directly. A typical table-driven test looks like:
+//
+//	acct := automodtest.NewAccount("alice.example.com")
+//	for _, text := range []string{"first bad post", "second bad post"} {
+//		automodtest.AssertRuleTriggers(t, rules.KeywordPostRule, automodtest.PostFixture(acct, automodtest.NewPost(text)))
+//	}
+//
+// (The package is not named "testing" to avoid clashing with the standard library package.)
+package automodtest
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod/engine"
+	"github.com/bluesky-social/indigo/automod/setstore"
+)
+
+// Placeholder CID for fixture records (rules do not generally inspect record CIDs)
+var fixtureCID = syntax.CID("bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm")
+
+// A single event for a rule to be run against, along with any engine state the rule depends on.
+type Fixture struct {
+	Account engine.AccountMeta
+	// Record operation, for record rules (including post and profile rules). Ignored for identity rules.
+	RecordOp engine.RecordOp
+	// Moderation event, for moderation event rules
+	OzoneEvent *comatproto.AdminDefs_ModEventView
+	// Account status change event, for account rules
+	AccountEvent *comatproto.SyncSubscribeRepos_Account
+	// Contents of named sets (eg, "bad-words"), for rules which call InSet
+	Sets map[string][]string
+	// Counters to increment (all time periods) before running the rule
+	Counts []Count
+}
+
+type Count struct {
+	Name string
+	Val  string
+	N    int
+}
+
+// Returns a fake account with the given handle, and a DID derived from the handle (so the same handle always gets the same DID). The account has no private metadata, labels, or flags; set fields directly as needed.
+func NewAccount(handle string) engine.AccountMeta {
+	sum := sha256.Sum256([]byte(handle))
+	suffix := strings.ToLower(base32.StdEncoding.EncodeToString(sum[:]))[:24]
+	return engine.AccountMeta{
+		Identity: &identity.Identity{
+			DID:    syntax.DID("did:plc:" + suffix),
+			Handle: syntax.Handle(handle),
+		},
+	}
+}
+
+// Same as NewAccount, with private metadata indicating the account was created the given duration ago. Useful for rules which only apply to new accounts.
+func NewAccountWithAge(handle string, age time.Duration) engine.AccountMeta {
+	acct := NewAccount(handle)
+	acct.Private = &engine.AccountPrivate{
+		IndexedAt: time.Now().Add(-age),
+	}
+	return acct
+}
+
+func NewPost(text string) *appbsky.FeedPost {
+	return &appbsky.FeedPost{
+		Text:      text,
+		CreatedAt: syntax.DatetimeNow().String(),
+	}
+}
+
+// Returns a post which is a reply to the given post, which is also used as the thread root.
+func NewReply(text string, parent syntax.ATURI) *appbsky.FeedPost {
+	post := NewPost(text)
+	ref := &comatproto.RepoStrongRef{Uri: parent.String(), Cid: fixtureCID.String()}
+	post.Reply = &appbsky.FeedPost_ReplyRef{Root: ref, Parent: ref}
+	return post
+}
+
+// Returns a post which quotes (embeds) the given post.
+func NewQuote(text string, quoted syntax.ATURI) *appbsky.FeedPost {
+	post := NewPost(text)
+	post.Embed = &appbsky.FeedPost_Embed{
+		EmbedRecord: &appbsky.EmbedRecord{
+			Record: &comatproto.RepoStrongRef{Uri: quoted.String(), Cid: fixtureCID.String()},
+		},
+	}
+	return post
+}
+
+func NewProfile(displayName, description string) *appbsky.ActorProfile {
+	return &appbsky.ActorProfile{
+		DisplayName: &displayName,
+		Description: &description,
+	}
+}
+
+func NewList(name, description string) *appbsky.GraphList {
+	purpose := "app.bsky.graph.defs#curatelist"
+	return &appbsky.GraphList{
+		Name:        name,
+		Description: &description,
+		Purpose:     &purpose,
+		CreatedAt:   syntax.DatetimeNow().String(),
+	}
+}
+
+func NewFeedGenerator(displayName, description string) *appbsky.FeedGenerator {
+	return &appbsky.FeedGenerator{
+		DisplayName: displayName,
+		Description: &description,
+		Did:         "did:web:feeds.example.com",
+		CreatedAt:   syntax.DatetimeNow().String(),
+	}
+}
+
+// Fixture for the creation of a post record by the account.
+func PostFixture(acct engine.AccountMeta, post *appbsky.FeedPost) Fixture {
+	return recordFixture(acct, "app.bsky.feed.post", syntax.RecordKey(syntax.NewTIDNow(0).String()), post)
+}
+
+// Fixture for the creation (or update) of the account's profile record.
+func ProfileFixture(acct engine.AccountMeta, profile *appbsky.ActorProfile) Fixture {
+	return recordFixture(acct, "app.bsky.actor.profile", syntax.RecordKey("self"), profile)
+}
+
+// Fixture for the creation of a list record by the account.
+func ListFixture(acct engine.AccountMeta, list *appbsky.GraphList) Fixture {
+	return recordFixture(acct, "app.bsky.graph.list", syntax.RecordKey(syntax.NewTIDNow(0).String()), list)
+}
+
+// Fixture for the creation of a feed generator record by the account.
+func FeedGenFixture(acct engine.AccountMeta, feedgen *appbsky.FeedGenerator) Fixture {
+	return recordFixture(acct, "app.bsky.feed.generator", syntax.RecordKey("feed"), feedgen)
+}
+
+// Fixture for the deletion of a record by the account.
+func DeleteFixture(acct engine.AccountMeta, collection syntax.NSID, rkey syntax.RecordKey) Fixture {
+	return Fixture{
+		Account: acct,
+		RecordOp: engine.RecordOp{
+			Action:     engine.DeleteOp,
+			DID:        acct.Identity.DID,
+			Collection: collection,
+			RecordKey:  rkey,
+		},
+	}
+}
+
+// Fixture for a moderation event (eg, by a human moderator) against the account, or one of its records if uri is not empty. The event type is determined by which field of event is set.
+func OzoneEventFixture(acct engine.AccountMeta, uri syntax.ATURI, event comatproto.AdminDefs_ModEventView_Event) Fixture {
+	subj := &comatproto.AdminDefs_ModEventView_Subject{}
+	if uri != "" {
+		subj.RepoStrongRef = &comatproto.RepoStrongRef{Uri: uri.String(), Cid: fixtureCID.String()}
+	} else {
+		subj.AdminDefs_RepoRef = &comatproto.AdminDefs_RepoRef{Did: acct.Identity.DID.String()}
+	}
+	return Fixture{
+		Account: acct,
+		OzoneEvent: &comatproto.AdminDefs_ModEventView{
+			Id:        1,
+			CreatedAt: syntax.DatetimeNow().String(),
+			CreatedBy: "did:plc:moderator",
+			Event:     &event,
+			Subject:   subj,
+		},
+	}
+}
+
+// Fixture for an account status change event. An empty status means the account is (re)activated.
+func AccountEventFixture(acct engine.AccountMeta, status string) Fixture {
+	evt := &comatproto.SyncSubscribeRepos_Account{
+		Active: status == "",
+		Did:    acct.Identity.DID.String(),
+		Seq:    1,
+		Time:   syntax.DatetimeNow().String(),
+	}
+	if status != "" {
+		evt.Status = &status
+	}
+	return Fixture{
+		Account:      acct,
+		AccountEvent: evt,
+	}
+}
+
+// Fixture for identity rules (no record).
+func AccountFixture(acct engine.AccountMeta) Fixture {
+	return Fixture{Account: acct}
+}
+
+func recordFixture(acct engine.AccountMeta, collection syntax.NSID, rkey syntax.RecordKey, val any) Fixture {
+	cid := fixtureCID
+	return Fixture{
+		Account: acct,
+		RecordOp: engine.RecordOp{
+			Action:     engine.CreateOp,
+			DID:        acct.Identity.DID,
+			Collection: collection,
+			RecordKey:  rkey,
+			CID:        &cid,
+			Value:      val,
+		},
+	}
+}
+
+// Runs a single rule against the fixture, with a fresh in-memory engine, and returns the rule's effects. The rule can be any of the rule function types (eg, a PostRuleFunc). Fails the test if the rule returns an error, or doesn't match the fixture.
+func RunRule(t testing.TB, rule any, f Fixture) engine.Effects {
+	t.Helper()
+	ctx := context.Background()
+
+	eng := engine.EngineTestFixture()
+	sets := eng.Sets.(setstore.MemSetStore)
+	for name, vals := range f.Sets {
+		m := make(map[string]bool, len(vals))
+		for _, v := range vals {
+			m[v] = true
+		}
+		sets.Sets[name] = m
+	}
+	for _, c := range f.Counts {
+		for i := 0; i < c.N; i++ {
+			if err := eng.Counters.Increment(ctx, c.Name, c.Val); err != nil {
+				t.Fatalf("setting up counters: %v", err)
+			}
+		}
+	}
+
+	var err error
+	var base *engine.BaseContext
+	switch rule := rule.(type) {
+	case engine.IdentityRuleFunc:
+		ac := engine.NewAccountContext(ctx, &eng, f.Account)
+		err = rule(&ac)
+		base = &ac.BaseContext
+	case engine.AccountRuleFunc:
+		if f.AccountEvent == nil {
+			t.Fatalf("account rule requires an account event fixture")
+		}
+		ac := engine.NewAccountEventContext(ctx, &eng, f.Account, *f.AccountEvent)
+		err = rule(&ac)
+		base = &ac.BaseContext
+	case engine.OzoneEventRuleFunc:
+		if f.OzoneEvent == nil {
+			t.Fatalf("moderation event rule requires a moderation event fixture")
+		}
+		oc := engine.NewOzoneEventContext(ctx, &eng, f.Account, *f.OzoneEvent)
+		err = rule(&oc)
+		base = &oc.BaseContext
+	case engine.RecordRuleFunc:
+		rc := engine.NewRecordContext(ctx, &eng, f.Account, f.RecordOp)
+		err = rule(&rc)
+		base = &rc.BaseContext
+	case engine.PostRuleFunc:
+		post, ok := f.RecordOp.Value.(*appbsky.FeedPost)
+		if !ok {
+			t.Fatalf("post rule requires a post fixture")
+		}
+		rc := engine.NewRecordContext(ctx, &eng, f.Account, f.RecordOp)
+		err = rule(&rc, post)
+		base = &rc.BaseContext
+	case engine.ProfileRuleFunc:
+		profile, ok := f.RecordOp.Value.(*appbsky.ActorProfile)
+		if !ok {
+			t.Fatalf("profile rule requires a profile fixture")
+		}
+		rc := engine.NewRecordContext(ctx, &eng, f.Account, f.RecordOp)
+		err = rule(&rc, profile)
+		base = &rc.BaseContext
+	case engine.ListRuleFunc:
+		list, ok := f.RecordOp.Value.(*appbsky.GraphList)
+		if !ok {
+			t.Fatalf("list rule requires a list fixture")
+		}
+		rc := engine.NewRecordContext(ctx, &eng, f.Account, f.RecordOp)
+		err = rule(&rc, list)
+		base = &rc.BaseContext
+	case engine.FeedGenRuleFunc:
+		feedgen, ok := f.RecordOp.Value.(*appbsky.FeedGenerator)
+		if !ok {
+			t.Fatalf("feed generator rule requires a feed generator fixture")
+		}
+		rc := engine.NewRecordContext(ctx, &eng, f.Account, f.RecordOp)
+		err = rule(&rc, feedgen)
+		base = &rc.BaseContext
+	default:
+		t.Fatalf("unsupported rule type: %T", rule)
+	}
+	if err != nil {
+		t.Fatalf("rule failed: %v", err)
+	}
+	if base.Err != nil {
+		t.Fatalf("rule failed (context error): %v", base.Err)
+	}
+	return engine.ExtractEffects(base)
+}
+
+// Whether the effects include any moderation actions (labels, flags, reports, or takedowns). Counter increments are not actions.
+func HasActions(eff engine.Effects) bool {
+	return len(eff.AccountLabels) > 0 || len(eff.AccountFlags) > 0 || len(eff.RemovedAccountFlags) > 0 || len(eff.AccountReports) > 0 || eff.AccountTakedown ||
+		len(eff.RecordLabels) > 0 || len(eff.RecordFlags) > 0 || len(eff.RecordReports) > 0 || eff.RecordTakedown
+}
+
+// Runs the rule against the fixture (see RunRule), and fails the test if the rule did not take any moderation action. Returns the effects, for more specific assertions.
+func AssertRuleTriggers(t testing.TB, rule any, f Fixture) engine.Effects {
+	t.Helper()
+	eff := RunRule(t, rule, f)
+	if !HasActions(eff) {
+		t.Errorf("expected rule to trigger on fixture (%s %s), but it took no action", f.Account.Identity.Handle, f.RecordOp.Collection)
+	}
+	return eff
+}
+
+// Opposite of AssertRuleTriggers: fails the test if the rule took any moderation action.
+func AssertRuleNotTriggers(t testing.TB, rule any, f Fixture) engine.Effects {
+	t.Helper()
+	eff := RunRule(t, rule, f)
+	if HasActions(eff) {
+		t.Errorf("expected rule not to trigger on fixture (%s %s), but it did: %+v", f.Account.Identity.Handle, f.RecordOp.Collection, eff)
+	}
+	return eff
+}
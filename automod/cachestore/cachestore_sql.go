@@ -0,0 +1,73 @@
+package cachestore
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CacheStore backed by a SQL database (eg, a local SQLite file), so cached account metadata survives restarts without needing Redis.
+//
+// Expired entries are ignored on read, and removed by PurgeExpired.
+type SQLCacheStore struct {
+	DB  *gorm.DB
+	TTL time.Duration
+}
+
+type CacheEntry struct {
+	Name      string `gorm:"primaryKey"`
+	Key       string `gorm:"primaryKey"`
+	Val       string
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+var _ CacheStore = (*SQLCacheStore)(nil)
+
+// Creates the cache table, if needed. See cliutil.SetupDatabase for opening a database from a URL.
+func NewSQLCacheStore(db *gorm.DB, ttl time.Duration) (*SQLCacheStore, error) {
+	if err := db.AutoMigrate(&CacheEntry{}); err != nil {
+		return nil, err
+	}
+	return &SQLCacheStore{
+		DB:  db,
+		TTL: ttl,
+	}, nil
+}
+
+func (s *SQLCacheStore) Get(ctx context.Context, name, key string) (string, error) {
+	var entry CacheEntry
+	err := s.DB.WithContext(ctx).Where("name = ? AND key = ? AND expires_at > ?", name, key, time.Now()).Take(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return entry.Val, nil
+}
+
+func (s *SQLCacheStore) Set(ctx context.Context, name, key string, val string) error {
+	entry := CacheEntry{
+		Name:      name,
+		Key:       key,
+		Val:       val,
+		ExpiresAt: time.Now().Add(s.TTL),
+	}
+	return s.DB.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}, {Name: "key"}},
+		UpdateAll: true,
+	}).Create(&entry).Error
+}
+
+func (s *SQLCacheStore) Purge(ctx context.Context, name, key string) error {
+	return s.DB.WithContext(ctx).Where("name = ? AND key = ?", name, key).Delete(&CacheEntry{}).Error
+}
+
+// Deletes all expired entries, returning the number removed.
+func (s *SQLCacheStore) PurgeExpired(ctx context.Context) (int, error) {
+	res := s.DB.WithContext(ctx).Where("expires_at <= ?", time.Now()).Delete(&CacheEntry{})
+	return int(res.RowsAffected), res.Error
+}
@@ -0,0 +1,99 @@
+package cachestore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSQLCacheStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSQLCacheStore(db, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	val, err := s.Get(ctx, "acct", "did:plc:abc")
+	assert.NoError(err)
+	assert.Empty(val)
+
+	assert.NoError(s.Set(ctx, "acct", "did:plc:abc", "first"))
+	val, err = s.Get(ctx, "acct", "did:plc:abc")
+	assert.NoError(err)
+	assert.Equal("first", val)
+
+	// names are separate namespaces
+	val, err = s.Get(ctx, "other", "did:plc:abc")
+	assert.NoError(err)
+	assert.Empty(val)
+
+	// setting again replaces the value, and extends the expiry
+	assert.NoError(db.Model(&CacheEntry{}).Where("key = ?", "did:plc:abc").Update("expires_at", time.Now().Add(time.Minute)).Error)
+	assert.NoError(s.Set(ctx, "acct", "did:plc:abc", "second"))
+	val, err = s.Get(ctx, "acct", "did:plc:abc")
+	assert.NoError(err)
+	assert.Equal("second", val)
+	var entries []CacheEntry
+	assert.NoError(db.Find(&entries).Error)
+	assert.Len(entries, 1)
+	assert.WithinDuration(time.Now().Add(time.Hour), entries[0].ExpiresAt, time.Minute)
+
+	assert.NoError(s.Purge(ctx, "acct", "did:plc:abc"))
+	val, err = s.Get(ctx, "acct", "did:plc:abc")
+	assert.NoError(err)
+	assert.Empty(val)
+	assert.NoError(s.Purge(ctx, "acct", "did:plc:missing"))
+}
+
+func TestSQLCacheStoreExpiry(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewSQLCacheStore(db, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(s.Set(ctx, "acct", "did:plc:fresh", "fresh"))
+	s.TTL = -time.Second
+	assert.NoError(s.Set(ctx, "acct", "did:plc:stale1", "stale"))
+	assert.NoError(s.Set(ctx, "acct", "did:plc:stale2", "stale"))
+
+	// expired entries are ignored on read, but not removed
+	val, err := s.Get(ctx, "acct", "did:plc:stale1")
+	assert.NoError(err)
+	assert.Empty(val)
+	val, err = s.Get(ctx, "acct", "did:plc:fresh")
+	assert.NoError(err)
+	assert.Equal("fresh", val)
+	var count int64
+	assert.NoError(db.Model(&CacheEntry{}).Count(&count).Error)
+	assert.Equal(int64(3), count)
+
+	n, err := s.PurgeExpired(ctx)
+	assert.NoError(err)
+	assert.Equal(2, n)
+	assert.NoError(db.Model(&CacheEntry{}).Count(&count).Error)
+	assert.Equal(int64(1), count)
+	n, err = s.PurgeExpired(ctx)
+	assert.NoError(err)
+	assert.Zero(n)
+
+	val, err = s.Get(ctx, "acct", "did:plc:fresh")
+	assert.NoError(err)
+	assert.Equal("fresh", val)
+}
@@ -0,0 +1,137 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/repo"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/ipfs/go-cid"
+)
+
+// Configuration for replaying existing repository content through the rules engine (eg, to retroactively evaluate new rules).
+type BackfillOptions struct {
+	// Only records created at or after this time are processed, based on the record key (TID) timestamp. Records with non-TID keys (eg, profiles) are always processed. Zero means no limit.
+	Since time.Time
+	// If non-empty, only records in these collections are processed
+	Collections []string
+}
+
+// Counts of records processed during a backfill.
+type BackfillResult struct {
+	Processed int
+	Skipped   int
+	Failed    int
+}
+
+// Fetches the full repository for an account from its PDS, and processes records through the engine.
+func FetchAndProcessRepo(ctx context.Context, eng *automod.Engine, atid syntax.AtIdentifier, opts BackfillOptions) (*BackfillResult, error) {
+	ident, err := eng.Directory.Lookup(ctx, atid)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve AT identifier: %v", err)
+	}
+	pdsURL := ident.PDSEndpoint()
+	if pdsURL == "" {
+		return nil, fmt.Errorf("could not resolve PDS endpoint for account: %s", ident.DID.String())
+	}
+	pdsClient := xrpc.Client{Host: pdsURL}
+
+	eng.Logger.Info("fetching repo", "did", ident.DID.String(), "pds", pdsURL)
+	repoBytes, err := comatproto.SyncGetRepo(ctx, &pdsClient, ident.DID.String(), "")
+	if err != nil {
+		return nil, fmt.Errorf("fetching repo CAR: %v", err)
+	}
+	return ProcessRepoCAR(ctx, eng, bytes.NewReader(repoBytes), opts)
+}
+
+// Reads a repository CAR file (eg, a snapshot from com.atproto.sync.getRepo), and processes records through the engine.
+func ProcessRepoCAR(ctx context.Context, eng *automod.Engine, r io.Reader, opts BackfillOptions) (*BackfillResult, error) {
+	rr, err := repo.ReadRepoFromCar(ctx, r)
+	if err != nil {
+		return nil, fmt.Errorf("reading repo CAR: %v", err)
+	}
+	return ProcessRepo(ctx, eng, rr, opts)
+}
+
+// Processes the records in a repository through the engine, as if each had just been created. Records are processed in repository (key) order, which is roughly oldest-first for TID record keys within each collection.
+//
+// Failures to process individual records are logged and counted, and do not stop the backfill.
+func ProcessRepo(ctx context.Context, eng *automod.Engine, rr *repo.Repo, opts BackfillOptions) (*BackfillResult, error) {
+	did, err := syntax.ParseDID(rr.RepoDid())
+	if err != nil {
+		return nil, fmt.Errorf("invalid repo DID: %v", err)
+	}
+
+	var res BackfillResult
+	err = rr.ForEach(ctx, "", func(k string, v cid.Cid) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		collection, rkey, ok := strings.Cut(k, "/")
+		if !ok || !opts.includeRecord(collection, rkey) {
+			res.Skipped++
+			return nil
+		}
+		nsid, err := syntax.ParseNSID(collection)
+		if err != nil {
+			res.Skipped++
+			return nil
+		}
+		_, rec, err := rr.GetRecord(ctx, k)
+		if err != nil {
+			eng.Logger.Warn("failed to read record from repo", "did", did, "path", k, "err", err)
+			res.Failed++
+			return nil
+		}
+		recCID := syntax.CID(v.String())
+		op := automod.RecordOp{
+			Action:     automod.CreateOp,
+			DID:        did,
+			Collection: nsid,
+			RecordKey:  syntax.RecordKey(rkey),
+			CID:        &recCID,
+			Value:      rec,
+		}
+		if err := eng.ProcessRecordOp(ctx, op); err != nil {
+			eng.Logger.Warn("failed to process record", "did", did, "path", k, "err", err)
+			res.Failed++
+			return nil
+		}
+		res.Processed++
+		return nil
+	})
+	if err != nil {
+		return &res, err
+	}
+	eng.Logger.Info("processed repo", "did", did, "processed", res.Processed, "skipped", res.Skipped, "failed", res.Failed)
+	return &res, nil
+}
+
+func (opts *BackfillOptions) includeRecord(collection, rkey string) bool {
+	if len(opts.Collections) > 0 {
+		found := false
+		for _, c := range opts.Collections {
+			if c == collection {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !opts.Since.IsZero() {
+		if tid, err := syntax.ParseTID(rkey); err == nil && tid.Time().Before(opts.Since) {
+			return false
+		}
+	}
+	return true
+}
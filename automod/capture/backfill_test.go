@@ -0,0 +1,70 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/engine"
+	"github.com/bluesky-social/indigo/repo"
+	"github.com/bluesky-social/indigo/util"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func countingPostRule(c *automod.RecordContext, post *appbsky.FeedPost) error {
+	c.Increment("backfill-post", c.Account.Identity.DID.String())
+	return nil
+}
+
+func TestProcessRepo(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	eng := engine.EngineTestFixture()
+	eng.Rules = automod.RuleSet{
+		PostRules: []automod.PostRule{
+			{Name: "countingPostRule", Func: countingPostRule},
+		},
+	}
+	did := "did:plc:abc111"
+
+	bs := blockstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	rr := repo.NewRepo(ctx, did, bs)
+	now := time.Now()
+	for _, ts := range []time.Time{now.Add(-30 * 24 * time.Hour), now.Add(-time.Hour), now} {
+		rkey := syntax.NewTIDFromTime(ts, 0).String()
+		_, err := rr.PutRecord(ctx, "app.bsky.feed.post/"+rkey, &appbsky.FeedPost{Text: "hello", CreatedAt: ts.Format(time.RFC3339)})
+		assert.NoError(err)
+	}
+	_, err := rr.PutRecord(ctx, "app.bsky.feed.like/"+syntax.NewTIDNow(0).String(), &appbsky.FeedLike{CreatedAt: now.Format(time.RFC3339)})
+	assert.NoError(err)
+	kmgr := &util.FakeKeyManager{}
+	_, _, err = rr.Commit(ctx, kmgr.SignForUser)
+	assert.NoError(err)
+
+	opts := BackfillOptions{
+		Since:       now.Add(-7 * 24 * time.Hour),
+		Collections: []string{"app.bsky.feed.post"},
+	}
+	res, err := ProcessRepo(ctx, &eng, rr, opts)
+	assert.NoError(err)
+	assert.Equal(2, res.Processed)
+	assert.Equal(2, res.Skipped)
+	assert.Equal(0, res.Failed)
+
+	c, err := eng.GetCount("backfill-post", did, automod.PeriodTotal)
+	assert.NoError(err)
+	assert.Equal(2, c)
+
+	// invalid CAR
+	_, err = ProcessRepoCAR(ctx, &eng, bytes.NewReader([]byte("not a CAR")), opts)
+	assert.Error(err)
+}
@@ -0,0 +1,274 @@
+package capture
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/cachestore"
+	"github.com/bluesky-social/indigo/automod/countstore"
+	"github.com/bluesky-social/indigo/automod/engine"
+	"github.com/bluesky-social/indigo/automod/flagstore"
+	"github.com/bluesky-social/indigo/automod/setstore"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+)
+
+// Outcome of running a single rule set configuration over a corpus of captures.
+type EvalResult struct {
+	// Number of events for which each rule (by function name) resulted in at least one moderation action.
+	RuleHits map[string]int `json:"ruleHits"`
+	// Moderation actions (eg, "flag:bad-word" or "report:spam") for each subject (account DID or record AT-URI).
+	SubjectActions map[string][]string `json:"subjectActions"`
+}
+
+// Comparison between the evaluation of two rule set configurations (a "baseline" and a "candidate") over the same corpus.
+type EvalReport struct {
+	// Difference in hit counts (candidate minus baseline) for each rule. Rules with no change are omitted.
+	RuleHitDeltas map[string]int `json:"ruleHitDeltas"`
+	// Accounts (DIDs) which had no moderation actions at all with the baseline, but have some with the candidate.
+	NewlyFlaggedAccounts []string `json:"newlyFlaggedAccounts"`
+	// Moderation actions, by subject, which only happen with the candidate.
+	AddedActions map[string][]string `json:"addedActions"`
+	// Moderation actions, by subject, which happened with the baseline but no longer happen with the candidate.
+	DisappearedActions map[string][]string `json:"disappearedActions"`
+}
+
+// Runs a rule set over a corpus of captures, using a fresh in-memory engine, and summarizes the outcome.
+//
+// No moderation actions are persisted outside of the in-memory engine.
+func EvalCaptures(rules automod.RuleSet, sets setstore.SetStore, captures []AccountCapture) (*EvalResult, error) {
+	res := EvalResult{
+		RuleHits:       make(map[string]int),
+		SubjectActions: make(map[string][]string),
+	}
+	eng := automod.Engine{
+		Logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		Rules:    instrumentRuleSet(rules, &res),
+		Counters: countstore.NewMemCountStore(),
+		Sets:     sets,
+		Flags:    flagstore.NewMemFlagStore(),
+		Cache:    cachestore.NewMemCacheStore(5_000, 30*time.Minute),
+	}
+	for _, capture := range captures {
+		if err := ProcessCaptureRules(&eng, capture); err != nil {
+			return nil, fmt.Errorf("processing capture (%s): %w", capture.AccountMeta.Identity.DID, err)
+		}
+	}
+	for subj, actions := range res.SubjectActions {
+		sort.Strings(actions)
+		res.SubjectActions[subj] = actions
+	}
+	return &res, nil
+}
+
+// Compares the results of two evaluations over the same corpus.
+func CompareEvalResults(baseline, candidate *EvalResult) EvalReport {
+	report := EvalReport{
+		RuleHitDeltas:        make(map[string]int),
+		NewlyFlaggedAccounts: []string{},
+		AddedActions:         make(map[string][]string),
+		DisappearedActions:   make(map[string][]string),
+	}
+
+	for name, hits := range candidate.RuleHits {
+		if delta := hits - baseline.RuleHits[name]; delta != 0 {
+			report.RuleHitDeltas[name] = delta
+		}
+	}
+	for name, hits := range baseline.RuleHits {
+		if _, ok := candidate.RuleHits[name]; !ok && hits != 0 {
+			report.RuleHitDeltas[name] = -hits
+		}
+	}
+
+	baselineAccounts := make(map[string]bool)
+	for subj := range baseline.SubjectActions {
+		baselineAccounts[subjectAccount(subj)] = true
+	}
+	newlyFlagged := make(map[string]bool)
+	for subj, actions := range candidate.SubjectActions {
+		if added := subtractStrings(actions, baseline.SubjectActions[subj]); len(added) > 0 {
+			report.AddedActions[subj] = added
+		}
+		if acct := subjectAccount(subj); !baselineAccounts[acct] {
+			newlyFlagged[acct] = true
+		}
+	}
+	for subj, actions := range baseline.SubjectActions {
+		if gone := subtractStrings(actions, candidate.SubjectActions[subj]); len(gone) > 0 {
+			report.DisappearedActions[subj] = gone
+		}
+	}
+	for acct := range newlyFlagged {
+		report.NewlyFlaggedAccounts = append(report.NewlyFlaggedAccounts, acct)
+	}
+	sort.Strings(report.NewlyFlaggedAccounts)
+	return report
+}
+
+// Wraps every rule in the set, to attribute moderation actions to individual rules.
+func instrumentRuleSet(rules automod.RuleSet, res *EvalResult) automod.RuleSet {
+	out := automod.RuleSet{
+		StopOnTakedown: rules.StopOnTakedown,
+	}
+	for _, rule := range rules.PostRules {
+		rule := rule
+		out.PostRules = append(out.PostRules, automod.PostRule{Name: rule.Name, Func: func(c *automod.RecordContext, post *appbsky.FeedPost) error {
+			before := engine.ExtractEffects(&c.BaseContext)
+			err := rule.Func(c, post)
+			res.observeRecord(rule.Name, c, before)
+			return err
+		}})
+	}
+	for _, rule := range rules.ProfileRules {
+		rule := rule
+		out.ProfileRules = append(out.ProfileRules, automod.ProfileRule{Name: rule.Name, Func: func(c *automod.RecordContext, profile *appbsky.ActorProfile) error {
+			before := engine.ExtractEffects(&c.BaseContext)
+			err := rule.Func(c, profile)
+			res.observeRecord(rule.Name, c, before)
+			return err
+		}})
+	}
+	for _, rule := range rules.ListRules {
+		rule := rule
+		out.ListRules = append(out.ListRules, automod.ListRule{Name: rule.Name, Func: func(c *automod.RecordContext, list *appbsky.GraphList) error {
+			before := engine.ExtractEffects(&c.BaseContext)
+			err := rule.Func(c, list)
+			res.observeRecord(rule.Name, c, before)
+			return err
+		}})
+	}
+	for _, rule := range rules.FeedGenRules {
+		rule := rule
+		out.FeedGenRules = append(out.FeedGenRules, automod.FeedGenRule{Name: rule.Name, Func: func(c *automod.RecordContext, feedgen *appbsky.FeedGenerator) error {
+			before := engine.ExtractEffects(&c.BaseContext)
+			err := rule.Func(c, feedgen)
+			res.observeRecord(rule.Name, c, before)
+			return err
+		}})
+	}
+	for _, rule := range rules.BlobRules {
+		rule := rule
+		out.BlobRules = append(out.BlobRules, automod.BlobRule{Name: rule.Name, Func: func(c *automod.RecordContext, blob lexutil.LexBlob, data []byte) error {
+			before := engine.ExtractEffects(&c.BaseContext)
+			err := rule.Func(c, blob, data)
+			res.observeRecord(rule.Name, c, before)
+			return err
+		}})
+	}
+	for _, rule := range rules.RecordRules {
+		rule := rule
+		out.RecordRules = append(out.RecordRules, automod.RecordRule{Name: rule.Name, Func: func(c *automod.RecordContext) error {
+			before := engine.ExtractEffects(&c.BaseContext)
+			err := rule.Func(c)
+			res.observeRecord(rule.Name, c, before)
+			return err
+		}})
+	}
+	for _, rule := range rules.RecordDeleteRules {
+		rule := rule
+		out.RecordDeleteRules = append(out.RecordDeleteRules, automod.RecordRule{Name: rule.Name, Func: func(c *automod.RecordContext) error {
+			before := engine.ExtractEffects(&c.BaseContext)
+			err := rule.Func(c)
+			res.observeRecord(rule.Name, c, before)
+			return err
+		}})
+	}
+	for _, rule := range rules.IdentityRules {
+		rule := rule
+		out.IdentityRules = append(out.IdentityRules, automod.IdentityRule{Name: rule.Name, Func: func(c *automod.AccountContext) error {
+			before := engine.ExtractEffects(&c.BaseContext)
+			err := rule.Func(c)
+			res.observe(rule.Name, c.Account.Identity.DID, "", before, engine.ExtractEffects(&c.BaseContext))
+			return err
+		}})
+	}
+	return out
+}
+
+func (res *EvalResult) observeRecord(name string, c *automod.RecordContext, before engine.Effects) {
+	res.observe(name, c.Account.Identity.DID, c.RecordOp.ATURI().String(), before, engine.ExtractEffects(&c.BaseContext))
+}
+
+// Records any moderation actions which a single rule added to the effects.
+func (res *EvalResult) observe(name string, did syntax.DID, uri string, before, after engine.Effects) {
+	hit := false
+	acctActions := subtractStrings(accountActions(after), accountActions(before))
+	if len(acctActions) > 0 {
+		res.SubjectActions[did.String()] = mergeStrings(res.SubjectActions[did.String()], acctActions)
+		hit = true
+	}
+	if uri != "" {
+		recActions := subtractStrings(recordActions(after), recordActions(before))
+		if len(recActions) > 0 {
+			res.SubjectActions[uri] = mergeStrings(res.SubjectActions[uri], recActions)
+			hit = true
+		}
+	}
+	if hit {
+		res.RuleHits[name]++
+	}
+}
+
+func accountActions(eff engine.Effects) []string {
+	return moderationActions(eff.AccountLabels, eff.AccountFlags, eff.AccountReports, eff.AccountTakedown)
+}
+
+func recordActions(eff engine.Effects) []string {
+	return moderationActions(eff.RecordLabels, eff.RecordFlags, eff.RecordReports, eff.RecordTakedown)
+}
+
+func moderationActions(labels, flags []string, reports []engine.ModReport, takedown bool) []string {
+	var out []string
+	for _, val := range labels {
+		out = append(out, "label:"+val)
+	}
+	for _, val := range flags {
+		out = append(out, "flag:"+val)
+	}
+	for _, mr := range reports {
+		out = append(out, "report:"+engine.ReasonShortName(mr.ReasonType))
+	}
+	if takedown {
+		out = append(out, "takedown")
+	}
+	return out
+}
+
+// Returns the account DID for a subject, which is either a DID or an AT-URI.
+func subjectAccount(subj string) string {
+	if !strings.HasPrefix(subj, "at://") {
+		return subj
+	}
+	aturi, err := syntax.ParseATURI(subj)
+	if err != nil {
+		return subj
+	}
+	return aturi.Authority().String()
+}
+
+// Returns the (de-duplicated) elements of a which are not in b.
+func subtractStrings(a, b []string) []string {
+	skip := make(map[string]bool, len(b))
+	for _, v := range b {
+		skip[v] = true
+	}
+	var out []string
+	for _, v := range a {
+		if !skip[v] {
+			out = append(out, v)
+			skip[v] = true
+		}
+	}
+	return out
+}
+
+func mergeStrings(a, b []string) []string {
+	return append(a, subtractStrings(b, a)...)
+}
@@ -0,0 +1,59 @@
+package capture
+
+import (
+	"strings"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/setstore"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func atprotoMentionRule(c *automod.RecordContext, post *appbsky.FeedPost) error {
+	if strings.Contains(strings.ToLower(post.Text), "atproto") {
+		c.AddRecordFlag("mentions-atproto")
+	}
+	return nil
+}
+
+func handleTLDRule(c *automod.AccountContext) error {
+	if strings.HasSuffix(c.Account.Identity.Handle.String(), ".com") {
+		c.AddAccountFlag("dot-com")
+	}
+	return nil
+}
+
+func TestEvalCaptures(t *testing.T) {
+	assert := assert.New(t)
+
+	captures := []AccountCapture{MustLoadCapture("testdata/capture_atprotocom.json")}
+	did := captures[0].AccountMeta.Identity.DID.String()
+
+	baseline, err := EvalCaptures(automod.RuleSet{
+		IdentityRules: []automod.IdentityRule{{Name: "handleTLDRule", Func: handleTLDRule}},
+	}, setstore.NewMemSetStore(), captures)
+	assert.NoError(err)
+	assert.Equal(1, baseline.RuleHits["handleTLDRule"])
+	assert.Equal([]string{"flag:dot-com"}, baseline.SubjectActions[did])
+
+	candidate, err := EvalCaptures(automod.RuleSet{
+		PostRules: []automod.PostRule{{Name: "atprotoMentionRule", Func: atprotoMentionRule}},
+	}, setstore.NewMemSetStore(), captures)
+	assert.NoError(err)
+	hits := candidate.RuleHits["atprotoMentionRule"]
+	assert.True(hits > 0)
+
+	report := CompareEvalResults(baseline, candidate)
+	assert.Equal(hits, report.RuleHitDeltas["atprotoMentionRule"])
+	assert.Equal(-1, report.RuleHitDeltas["handleTLDRule"])
+	assert.Equal([]string{"flag:dot-com"}, report.DisappearedActions[did])
+	assert.Equal(hits, len(report.AddedActions))
+	// account already had actions in the baseline
+	assert.Empty(report.NewlyFlaggedAccounts)
+
+	report = CompareEvalResults(&EvalResult{}, candidate)
+	assert.Equal([]string{did}, report.NewlyFlaggedAccounts)
+	assert.Empty(report.DisappearedActions)
+}
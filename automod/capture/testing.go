@@ -3,6 +3,7 @@ package capture
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 
@@ -12,22 +13,30 @@ import (
 )
 
 func MustLoadCapture(capPath string) AccountCapture {
-	f, err := os.Open(capPath)
+	capture, err := LoadCapture(capPath)
 	if err != nil {
 		panic(err)
 	}
+	return *capture
+}
+
+func LoadCapture(capPath string) (*AccountCapture, error) {
+	f, err := os.Open(capPath)
+	if err != nil {
+		return nil, err
+	}
 	defer func() { _ = f.Close() }()
 
 	raw, err := io.ReadAll(f)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	var capture AccountCapture
 	if err := json.Unmarshal(raw, &capture); err != nil {
-		panic(err)
+		return nil, fmt.Errorf("parsing capture file (%s): %w", capPath, err)
 	}
-	return capture
+	return &capture, nil
 }
 
 // Test helper which processes all the records from a capture. Intentionally exported, for use in other packages.
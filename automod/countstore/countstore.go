@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 )
 
@@ -11,13 +12,86 @@ const (
 	PeriodTotal = "total"
 	PeriodDay   = "day"
 	PeriodHour  = "hour"
+	// Sliding window over (approximately) the last hour, as opposed to the current calendar hour
+	PeriodRolling1h = "rolling-1h"
+	// Sliding window over (approximately) the last 24 hours, as opposed to the current calendar day
+	PeriodRolling24h = "rolling-24h"
 )
 
+// All the period types which are incremented by the "Increment" and "IncrementDistinct" methods.
+var allPeriods = []string{PeriodTotal, PeriodDay, PeriodHour, PeriodRolling1h, PeriodRolling24h}
+
+// A sliding window is implemented as a series of short sub-buckets, which are summed (or merged) when read. The window covers between (buckets-1) and (buckets) times the granularity, depending on how far in to the current sub-bucket we are.
+type rollingWindow struct {
+	granularity time.Duration
+	buckets     int
+}
+
+var rollingWindows = map[string]rollingWindow{
+	PeriodRolling1h:  {granularity: 5 * time.Minute, buckets: 12},
+	PeriodRolling24h: {granularity: 15 * time.Minute, buckets: 96},
+}
+
+func isRollingPeriod(period string) bool {
+	_, ok := rollingWindows[period]
+	return ok
+}
+
+// How long a sub-bucket of a rolling period needs to be retained.
+func rollingExpiration(period string) time.Duration {
+	w := rollingWindows[period]
+	return time.Duration(w.buckets+1) * w.granularity
+}
+
+// Optional interface for CountStore implementations which do not natively expire old period counters (eg, the in-memory store), and need to be pruned periodically.
+type PurgeableCountStore interface {
+	CountStore
+	// Removes hour and day period counters (including distinct counters) which ended longer ago than the store's retention, as well as out-of-window rolling period sub-buckets. All-time totals are never removed. Returns the number of counters removed.
+	PurgeExpired(ctx context.Context) (int, error)
+}
+
+// Parses the period and start time out of a counter key (as returned by periodBucket). Returns false for all-time total keys (or unparsable keys).
+func parseBucketKey(key string) (string, time.Time, bool) {
+	idx := strings.LastIndex(key, "/")
+	if idx < 0 {
+		return "", time.Time{}, false
+	}
+	suffix := key[idx+1:]
+	if t, err := time.Parse("2006-01-02T15:04", suffix); err == nil {
+		rest := key[:idx]
+		for p := range rollingWindows {
+			if strings.HasSuffix(rest, "/"+p) {
+				return p, t, true
+			}
+		}
+		return "", time.Time{}, false
+	}
+	if t, err := time.Parse("2006-01-02T15", suffix); err == nil {
+		return PeriodHour, t, true
+	}
+	if t, err := time.Parse("2006-01-02", suffix); err == nil {
+		return PeriodDay, t, true
+	}
+	return "", time.Time{}, false
+}
+
+// Returns the keys of all the sub-buckets which make up a rolling period at the given time, starting with the current sub-bucket (which is the one to increment).
+func rollingBuckets(name, val, period string, now time.Time) []string {
+	w := rollingWindows[period]
+	t := now.UTC().Truncate(w.granularity)
+	keys := make([]string, w.buckets)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("%s/%s/%s/%s", name, val, period, t.Add(-time.Duration(i)*w.granularity).Format("2006-01-02T15:04"))
+	}
+	return keys
+}
+
 // CountStore is an interface for storing incrementing event counts, bucketed into periods.
 // It is implemented by MemCountStore and by RedisCountStore.
 //
 // Period bucketing works on the basis of the current date (as determined mid-call).
 // See the `Period*` consts for the available period types.
+// The "rolling" periods are sliding windows (with a granularity of a few minutes), instead of calendar buckets, which avoids bursty behavior at bucket boundaries.
 //
 // The "GetCount" and "Increment" methods perform actual counting.
 // The "*Distinct" methods have a different behavior:
@@ -26,9 +100,11 @@ const (
 //
 // Incrementing -- both the "Increment" and "IncrementDistinct" variants -- increases
 // a count in each supported period bucket size.
-// In other words, one call to CountStore.Increment causes three increments internally:
-// one to the count for the hour, one to the count for the day, and one to the all-time count.
+// In other words, one call to CountStore.Increment causes an increment internally for each period:
+// the count for the hour, the day, the rolling hour, the rolling day, and the all-time count.
 // The "IncrementPeriod" method allows only incrementing a single period bucket. Care must be taken to match the "GetCount" period with the incremented period when using this variant.
+// The "IncrementIfBelow" method is a conditional version of "Increment", which only increments (all periods) if the count for the given period is below a threshold, and reports whether it did. The check and increment are atomic for calendar and total periods, which makes it suitable for quotas.
+// The "Decrement" method reverses an earlier "Increment", for reversible signals (eg, a record being deleted). It acts on the *current* period buckets, which may not be the buckets which were originally incremented, so counts are approximate; counts never go below zero.
 //
 // The exact implementation and precision of the "*Distinct" methods may vary:
 // in the MemCountStore implementation, it is precise (it's based on large maps);
@@ -39,12 +115,14 @@ const (
 // Memory growth and availability of information over time also varies by implementation.
 // The RedisCountStore implementation uses Redis's key expiration primitives;
 // only the all-time counts go without expiration.
-// The MemCountStore grows without bound (it's intended to be used in testing
-// and other non-production operations).
+// The MemCountStore needs to be pruned periodically with "PurgeExpired"
+// (see PurgeableCountStore), or it will grow without bound.
 type CountStore interface {
 	GetCount(ctx context.Context, name, val, period string) (int, error)
 	Increment(ctx context.Context, name, val string) error
 	IncrementPeriod(ctx context.Context, name, val, period string) error
+	IncrementIfBelow(ctx context.Context, name, val, period string, threshold int) (bool, error)
+	Decrement(ctx context.Context, name, val string) error
 	// TODO: batch increment method
 	GetCountDistinct(ctx context.Context, name, bucket, period string) (int, error)
 	IncrementDistinct(ctx context.Context, name, bucket, val string) error
@@ -60,6 +138,9 @@ func periodBucket(name, val, period string) string {
 	case PeriodHour:
 		t := time.Now().UTC().Format(time.RFC3339)[0:13]
 		return fmt.Sprintf("%s/%s/%s", name, val, t)
+	case PeriodRolling1h, PeriodRolling24h:
+		// the current sub-bucket
+		return rollingBuckets(name, val, period, time.Now())[0]
 	default:
 		slog.Warn("unhandled counter period", "period", period)
 		return fmt.Sprintf("%s/%s", name, val)
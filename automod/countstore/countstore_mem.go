@@ -2,28 +2,44 @@ package countstore
 
 import (
 	"context"
+	"time"
 
 	"github.com/puzpuzpuz/xsync/v3"
 )
 
+// In-memory CountStore implementation, intended for tests and small single-process deployments. Safe for concurrent use: counters live in concurrent maps (sharded internally), and increments are atomic read-modify-write operations on a single entry, so concurrent rule evaluation does not lose updates. Counters are not expired automatically: hour and day period counters are removed by PurgeExpired once they are older than HourRetention or DayRetention past the end of their period, rolling period buckets once they fall out of their window, and all-time totals are kept forever. PurgeExpired should be called periodically to bound memory use.
 type MemCountStore struct {
 	// Counts is keyed by a string that is a munge of "{name}/{val}[/{period}]",
 	// where period is either absent (meaning all-time total)
-	// or a string describing that timeperiod (either "YYYY-MM-DD" or that plus a literal "T" and "HH").
+	// or a string describing that timeperiod (either "YYYY-MM-DD" or that plus a literal "T" and "HH";
+	// or, for rolling periods, the period name and the start time of a short sub-bucket).
 	//
 	// (Using a values for `name` and `val` with slashes in them is perhaps inadvisable, as it may be ambiguous.)
 	Counts         *xsync.MapOf[string, int]
 	DistinctCounts *xsync.MapOf[string, *xsync.MapOf[string, bool]]
+	// How long hour and day period counters are retained after the period ends, before being removed by PurgeExpired. Defaults match the expiration used by RedisCountStore.
+	HourRetention time.Duration
+	DayRetention  time.Duration
 }
 
 func NewMemCountStore() MemCountStore {
 	return MemCountStore{
 		Counts:         xsync.NewMapOf[string, int](),
 		DistinctCounts: xsync.NewMapOf[string, *xsync.MapOf[string, bool]](),
+		HourRetention:  time.Hour,
+		DayRetention:   24 * time.Hour,
 	}
 }
 
 func (s MemCountStore) GetCount(ctx context.Context, name, val, period string) (int, error) {
+	if isRollingPeriod(period) {
+		total := 0
+		for _, k := range rollingBuckets(name, val, period, time.Now()) {
+			v, _ := s.Counts.Load(k)
+			total += v
+		}
+		return total, nil
+	}
 	v, ok := s.Counts.Load(periodBucket(name, val, period))
 	if !ok {
 		return 0, nil
@@ -32,7 +48,7 @@ func (s MemCountStore) GetCount(ctx context.Context, name, val, period string) (
 }
 
 func (s MemCountStore) Increment(ctx context.Context, name, val string) error {
-	for _, p := range []string{PeriodTotal, PeriodDay, PeriodHour} {
+	for _, p := range allPeriods {
 		if err := s.IncrementPeriod(ctx, name, val, p); err != nil {
 			return err
 		}
@@ -48,7 +64,67 @@ func (s MemCountStore) IncrementPeriod(ctx context.Context, name, val, period st
 	return nil
 }
 
+func (s MemCountStore) IncrementIfBelow(ctx context.Context, name, val, period string, threshold int) (bool, error) {
+	if isRollingPeriod(period) {
+		// sums multiple sub-buckets, so can't be checked atomically
+		c, err := s.GetCount(ctx, name, val, period)
+		if err != nil || c >= threshold {
+			return false, err
+		}
+		return true, s.Increment(ctx, name, val)
+	}
+
+	// check and increment the specified period atomically, then increment the others
+	incremented := false
+	s.Counts.Compute(periodBucket(name, val, period), func(oldVal int, _ bool) (int, bool) {
+		if oldVal >= threshold {
+			return oldVal, oldVal == 0
+		}
+		incremented = true
+		return oldVal + 1, false
+	})
+	if !incremented {
+		return false, nil
+	}
+	for _, p := range allPeriods {
+		if p == period {
+			continue
+		}
+		if err := s.IncrementPeriod(ctx, name, val, p); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
+
+func (s MemCountStore) Decrement(ctx context.Context, name, val string) error {
+	for _, p := range allPeriods {
+		s.Counts.Compute(periodBucket(name, val, p), func(oldVal int, _ bool) (int, bool) {
+			if oldVal <= 1 {
+				// delete the entry
+				return 0, true
+			}
+			return oldVal - 1, false
+		})
+	}
+	return nil
+}
+
 func (s MemCountStore) GetCountDistinct(ctx context.Context, name, bucket, period string) (int, error) {
+	if isRollingPeriod(period) {
+		union := make(map[string]bool)
+		for _, k := range rollingBuckets(name, bucket, period, time.Now()) {
+			v, ok := s.DistinctCounts.Load(k)
+			if !ok {
+				continue
+			}
+			v.Range(func(val string, _ bool) bool {
+				union[val] = true
+				return true
+			})
+		}
+		return len(union), nil
+	}
 	v, ok := s.DistinctCounts.Load(periodBucket(name, bucket, period))
 	if !ok {
 		return 0, nil
@@ -57,7 +133,7 @@ func (s MemCountStore) GetCountDistinct(ctx context.Context, name, bucket, perio
 }
 
 func (s MemCountStore) IncrementDistinct(ctx context.Context, name, bucket, val string) error {
-	for _, p := range []string{PeriodTotal, PeriodDay, PeriodHour} {
+	for _, p := range allPeriods {
 		k := periodBucket(name, bucket, p)
 		s.DistinctCounts.Compute(k, func(nested *xsync.MapOf[string, bool], _ bool) (*xsync.MapOf[string, bool], bool) {
 			if nested == nil {
@@ -69,3 +145,38 @@ func (s MemCountStore) IncrementDistinct(ctx context.Context, name, bucket, val
 	}
 	return nil
 }
+
+func (s MemCountStore) PurgeExpired(ctx context.Context) (int, error) {
+	now := time.Now()
+	expired := func(key string) bool {
+		period, start, ok := parseBucketKey(key)
+		if !ok {
+			return false
+		}
+		switch period {
+		case PeriodHour:
+			return now.After(start.Add(time.Hour + s.HourRetention))
+		case PeriodDay:
+			return now.After(start.Add(24*time.Hour + s.DayRetention))
+		default:
+			return now.After(start.Add(rollingExpiration(period)))
+		}
+	}
+
+	removed := 0
+	s.Counts.Range(func(k string, _ int) bool {
+		if expired(k) {
+			s.Counts.Delete(k)
+			removed++
+		}
+		return ctx.Err() == nil
+	})
+	s.DistinctCounts.Range(func(k string, _ *xsync.MapOf[string, bool]) bool {
+		if expired(k) {
+			s.DistinctCounts.Delete(k)
+			removed++
+		}
+		return ctx.Err() == nil
+	})
+	return removed, ctx.Err()
+}
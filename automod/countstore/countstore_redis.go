@@ -2,6 +2,7 @@ package countstore
 
 import (
 	"context"
+	"strconv"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -32,6 +33,9 @@ func NewRedisCountStore(redisURL string) (*RedisCountStore, error) {
 }
 
 func (s *RedisCountStore) GetCount(ctx context.Context, name, val, period string) (int, error) {
+	if isRollingPeriod(period) {
+		return s.getRollingCount(ctx, name, val, period)
+	}
 	key := redisCountPrefix + periodBucket(name, val, period)
 	c, err := s.Client.Get(ctx, key).Int()
 	if err == redis.Nil {
@@ -61,6 +65,12 @@ func (s *RedisCountStore) Increment(ctx context.Context, name, val string) error
 	multi.Incr(ctx, key)
 	// no expiration for total
 
+	for _, p := range []string{PeriodRolling1h, PeriodRolling24h} {
+		key = redisCountPrefix + periodBucket(name, val, p)
+		multi.Incr(ctx, key)
+		multi.Expire(ctx, key, rollingExpiration(p))
+	}
+
 	_, err := multi.Exec(ctx)
 	return err
 }
@@ -79,15 +89,91 @@ func (s *RedisCountStore) IncrementPeriod(ctx context.Context, name, val, period
 		multi.Expire(ctx, key, 2*time.Hour)
 	case PeriodDay:
 		multi.Expire(ctx, key, 48*time.Hour)
+	case PeriodRolling1h, PeriodRolling24h:
+		multi.Expire(ctx, key, rollingExpiration(period))
 	}
 
 	_, err := multi.Exec(ctx)
 	return err
 }
 
+// KEYS: the counter keys to check (summed), followed by the counter keys to increment.
+// ARGV: number of keys to check; threshold; then expiration (in seconds, or zero for none) of each key to increment.
+var redisIncrementIfBelowScript = redis.NewScript(`
+local n = tonumber(ARGV[1])
+local total = 0
+for i = 1, n do
+	total = total + tonumber(redis.call("GET", KEYS[i]) or "0")
+end
+if total >= tonumber(ARGV[2]) then
+	return 0
+end
+for i = n + 1, #KEYS do
+	redis.call("INCR", KEYS[i])
+	local ttl = tonumber(ARGV[i - n + 2])
+	if ttl > 0 then
+		redis.call("EXPIRE", KEYS[i], ttl)
+	end
+end
+return 1
+`)
+
+// Decrements every key, removing any which drop to zero (or below).
+var redisDecrementScript = redis.NewScript(`
+for i = 1, #KEYS do
+	if redis.call("DECR", KEYS[i]) <= 0 then
+		redis.call("DEL", KEYS[i])
+	end
+end
+return 0
+`)
+
+// Expiration for the counter key of the given period; zero means no expiration.
+func redisPeriodExpiration(period string) time.Duration {
+	switch period {
+	case PeriodHour:
+		return 2 * time.Hour
+	case PeriodDay:
+		return 48 * time.Hour
+	case PeriodRolling1h, PeriodRolling24h:
+		return rollingExpiration(period)
+	}
+	return 0
+}
+
+// Check and increment happen atomically in a single script execution.
+func (s *RedisCountStore) IncrementIfBelow(ctx context.Context, name, val, period string, threshold int) (bool, error) {
+	keys := []string{redisCountPrefix + periodBucket(name, val, period)}
+	if isRollingPeriod(period) {
+		keys = prefixKeys(redisCountPrefix, rollingBuckets(name, val, period, time.Now()))
+	}
+	args := []any{len(keys), threshold}
+	for _, p := range allPeriods {
+		keys = append(keys, redisCountPrefix+periodBucket(name, val, p))
+		args = append(args, int(redisPeriodExpiration(p).Seconds()))
+	}
+	ok, err := redisIncrementIfBelowScript.Run(ctx, s.Client, keys, args...).Int()
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+func (s *RedisCountStore) Decrement(ctx context.Context, name, val string) error {
+	keys := make([]string, len(allPeriods))
+	for i, p := range allPeriods {
+		keys[i] = redisCountPrefix + periodBucket(name, val, p)
+	}
+	return redisDecrementScript.Run(ctx, s.Client, keys).Err()
+}
+
 func (s *RedisCountStore) GetCountDistinct(ctx context.Context, name, val, period string) (int, error) {
-	key := redisDistinctPrefix + periodBucket(name, val, period)
-	c, err := s.Client.PFCount(ctx, key).Result()
+	keys := []string{redisDistinctPrefix + periodBucket(name, val, period)}
+	if isRollingPeriod(period) {
+		// PFCOUNT of multiple keys returns the cardinality of the union
+		keys = prefixKeys(redisDistinctPrefix, rollingBuckets(name, val, period, time.Now()))
+	}
+	c, err := s.Client.PFCount(ctx, keys...).Result()
 	if err == redis.Nil {
 		return 0, nil
 	} else if err != nil {
@@ -115,6 +201,48 @@ func (s *RedisCountStore) IncrementDistinct(ctx context.Context, name, bucket, v
 	multi.PFAdd(ctx, key, val)
 	// no expiration for total
 
+	for _, p := range []string{PeriodRolling1h, PeriodRolling24h} {
+		key = redisDistinctPrefix + periodBucket(name, bucket, p)
+		multi.PFAdd(ctx, key, val)
+		multi.Expire(ctx, key, rollingExpiration(p))
+	}
+
 	_, err := multi.Exec(ctx)
 	return err
 }
+
+// Sums all the sub-bucket counters of a rolling period, in a single round-trip.
+func (s *RedisCountStore) getRollingCount(ctx context.Context, name, val, period string) (int, error) {
+	keys := prefixKeys(redisCountPrefix, rollingBuckets(name, val, period, time.Now()))
+	vals, err := s.Client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, v := range vals {
+		str, ok := v.(string)
+		if !ok {
+			// missing (or expired) sub-bucket
+			continue
+		}
+		c, err := strconv.Atoi(str)
+		if err != nil {
+			return 0, err
+		}
+		total += c
+	}
+	return total, nil
+}
+
+func prefixKeys(prefix string, keys []string) []string {
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[i] = prefix + k
+	}
+	return out
+}
+
+// Redis keys for period counters have expirations set, so this is a no-op.
+func (s *RedisCountStore) PurgeExpired(ctx context.Context) (int, error) {
+	return 0, nil
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/puzpuzpuz/xsync/v3"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,7 +22,7 @@ func TestMemCountStoreBasics(t *testing.T) {
 	assert.NoError(cs.Increment(ctx, "test1", "val1"))
 	assert.NoError(cs.Increment(ctx, "test1", "val1"))
 
-	for _, period := range []string{PeriodTotal, PeriodDay, PeriodHour} {
+	for _, period := range allPeriods {
 		c, err = cs.GetCount(ctx, "test1", "val1", period)
 		assert.NoError(err)
 		assert.Equal(2, c)
@@ -40,13 +41,49 @@ func TestMemCountStoreBasics(t *testing.T) {
 	assert.NoError(cs.IncrementDistinct(ctx, "test2", "val2", "two"))
 	assert.NoError(cs.IncrementDistinct(ctx, "test2", "val2", "three"))
 
-	for _, period := range []string{PeriodTotal, PeriodDay, PeriodHour} {
+	for _, period := range allPeriods {
 		c, err = cs.GetCountDistinct(ctx, "test2", "val2", period)
 		assert.NoError(err)
 		assert.Equal(3, c)
 	}
 }
 
+func TestMemCountStoreConditional(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	cs := NewMemCountStore()
+	for i := 0; i < 5; i++ {
+		ok, err := cs.IncrementIfBelow(ctx, "test1", "val1", PeriodDay, 3)
+		assert.NoError(err)
+		assert.Equal(i < 3, ok)
+	}
+	for _, period := range allPeriods {
+		c, err := cs.GetCount(ctx, "test1", "val1", period)
+		assert.NoError(err)
+		assert.Equal(3, c)
+	}
+
+	ok, err := cs.IncrementIfBelow(ctx, "test1", "val1", PeriodRolling1h, 3)
+	assert.NoError(err)
+	assert.False(ok)
+
+	assert.NoError(cs.Decrement(ctx, "test1", "val1"))
+	ok, err = cs.IncrementIfBelow(ctx, "test1", "val1", PeriodRolling1h, 3)
+	assert.NoError(err)
+	assert.True(ok)
+
+	// counts never go below zero
+	for i := 0; i < 5; i++ {
+		assert.NoError(cs.Decrement(ctx, "test1", "val1"))
+	}
+	for _, period := range allPeriods {
+		c, err := cs.GetCount(ctx, "test1", "val1", period)
+		assert.NoError(err)
+		assert.Equal(0, c)
+	}
+}
+
 func TestMemCountStoreConcurrent(t *testing.T) {
 	assert := assert.New(t)
 	ctx := context.Background()
@@ -104,3 +141,90 @@ func TestMemCountStoreConcurrent(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal(1, c)
 }
+
+func TestRollingBuckets(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2024, 3, 5, 10, 7, 30, 0, time.UTC)
+	keys := rollingBuckets("test1", "val1", PeriodRolling1h, now)
+	assert.Equal(12, len(keys))
+	assert.Equal("test1/val1/rolling-1h/2024-03-05T10:05", keys[0])
+	assert.Equal("test1/val1/rolling-1h/2024-03-05T09:10", keys[11])
+
+	keys = rollingBuckets("test1", "val1", PeriodRolling24h, now)
+	assert.Equal(96, len(keys))
+	assert.Equal("test1/val1/rolling-24h/2024-03-05T10:00", keys[0])
+	assert.Equal("test1/val1/rolling-24h/2024-03-04T10:15", keys[95])
+
+	// sub-buckets which have fallen out of the window are not counted
+	cs := NewMemCountStore()
+	ctx := context.Background()
+	stale := rollingBuckets("test1", "val1", PeriodRolling1h, time.Now().Add(-2*time.Hour))[0]
+	cs.Counts.Store(stale, 5)
+	assert.NoError(cs.IncrementPeriod(ctx, "test1", "val1", PeriodRolling1h))
+	c, err := cs.GetCount(ctx, "test1", "val1", PeriodRolling1h)
+	assert.NoError(err)
+	assert.Equal(1, c)
+}
+
+func TestMemCountStorePurgeExpired(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	cs := NewMemCountStore()
+	assert.NoError(cs.Increment(ctx, "test1", "val1"))
+	assert.NoError(cs.IncrementDistinct(ctx, "test2", "val2", "one"))
+
+	old := time.Now().UTC().Add(-72 * time.Hour)
+	cs.Counts.Store("test1/val1/"+old.Format("2006-01-02"), 3)
+	cs.Counts.Store("test1/val1/"+old.Format(time.RFC3339)[0:13], 3)
+	cs.Counts.Store(rollingBuckets("test1", "val1", PeriodRolling24h, old)[0], 3)
+	cs.DistinctCounts.Store("test2/val2/"+old.Format("2006-01-02"), xsync.NewMapOf[string, bool]())
+
+	n, err := cs.PurgeExpired(ctx)
+	assert.NoError(err)
+	assert.Equal(4, n)
+
+	// current counters are untouched
+	for _, period := range allPeriods {
+		c, err := cs.GetCount(ctx, "test1", "val1", period)
+		assert.NoError(err)
+		assert.Equal(1, c)
+		c, err = cs.GetCountDistinct(ctx, "test2", "val2", period)
+		assert.NoError(err)
+		assert.Equal(1, c)
+	}
+}
+
+func benchmarkCountStore(b *testing.B, cs CountStore) {
+	ctx := context.Background()
+	vals := []string{"val1", "val2", "val3", "val4", "val5", "val6", "val7", "val8"}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			val := vals[i%len(vals)]
+			if err := cs.Increment(ctx, "bench", val); err != nil {
+				b.Fatal(err)
+			}
+			if _, err := cs.GetCount(ctx, "bench", val, PeriodRolling1h); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkMemCountStore(b *testing.B) {
+	benchmarkCountStore(b, NewMemCountStore())
+}
+
+func BenchmarkRedisCountStore(b *testing.B) {
+	b.Skip("live test, need redis running locally")
+	cs, err := NewRedisCountStore("redis://localhost:6379/0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	benchmarkCountStore(b, cs)
+}
@@ -17,12 +17,16 @@ import (
 
 var redisDirPrefix string = "dir/"
 
-// uses redis as a cache for identity lookups. includes a local cache layer as well, for hot keys
+// pub/sub channel of the identifiers purged by any instance sharing the cache, to be dropped from their local cache layer
+var redisDirInvalidateChannel string = "dir-invalidate"
+
+// uses redis as a cache for identity lookups, shared between instances. includes a local cache layer as well, for hot keys, which RunInvalidation keeps in sync with the identifiers purged by other instances
 type RedisDirectory struct {
 	Inner  identity.Directory
 	ErrTTL time.Duration
 	HitTTL time.Duration
 
+	rdb               *redis.Client
 	handleCache       *cache.Cache
 	identityCache     *cache.Cache
 	didLookupChans    sync.Map
@@ -66,6 +70,7 @@ func NewRedisDirectory(inner identity.Directory, redisURL string, hitTTL, errTTL
 		Inner:         inner,
 		ErrTTL:        errTTL,
 		HitTTL:        hitTTL,
+		rdb:           rdb,
 		handleCache:   handleCache,
 		identityCache: identityCache,
 	}, nil
@@ -312,17 +317,75 @@ func (d *RedisDirectory) Lookup(ctx context.Context, a syntax.AtIdentifier) (*id
 	return nil, fmt.Errorf("at-identifier neither a Handle nor a DID")
 }
 
+// Purge removes the identifier from the shared cache, and tells every instance (this one included) to drop it from their local cache. Purging a DID also purges the handle it was cached with, as the handle may have changed too.
 func (d *RedisDirectory) Purge(ctx context.Context, a syntax.AtIdentifier) error {
-	handle, err := a.AsHandle()
-	if nil == err { // if not an error, is a handle
-		handle = handle.Normalize()
-		return d.handleCache.Delete(ctx, handle.String())
+	var purge []syntax.AtIdentifier
+	if handle, err := a.AsHandle(); nil == err { // if not an error, is a handle
+		purge = append(purge, handle.Normalize().AtIdentifier())
+	} else if did, err := a.AsDID(); nil == err { // if not an error, is a DID
+		purge = append(purge, did.AtIdentifier())
+		var entry IdentityEntry
+		err := d.identityCache.Get(ctx, redisDirPrefix+did.String(), &entry)
+		if err == nil && entry.Identity != nil && !entry.Identity.Handle.IsInvalidHandle() {
+			purge = append(purge, entry.Identity.Handle.AtIdentifier())
+		}
+	} else {
+		return fmt.Errorf("at-identifier neither a Handle nor a DID")
 	}
-	did, err := a.AsDID()
-	if nil == err { // if not an error, is a DID
-		return d.identityCache.Delete(ctx, did.String())
+
+	for _, id := range purge {
+		if err := d.cacheFor(id).Delete(ctx, redisDirPrefix+id.String()); err != nil {
+			return err
+		}
+		if err := d.rdb.Publish(ctx, redisDirInvalidateChannel, id.String()).Err(); err != nil {
+			return fmt.Errorf("publishing invalidation: %w", err)
+		}
+	}
+	return nil
+}
+
+func (d *RedisDirectory) cacheFor(id syntax.AtIdentifier) *cache.Cache {
+	if id.IsDID() {
+		return d.identityCache
 	}
-	return fmt.Errorf("at-identifier neither a Handle nor a DID")
+	return d.handleCache
+}
+
+// RunInvalidation drops the identifiers purged by any instance sharing the cache from the local cache layer, as they are published, until the context is cancelled. Without it, an instance can keep serving stale entries from its local cache for up to HitTTL after another instance purged them, eg on #identity events.
+func (d *RedisDirectory) RunInvalidation(ctx context.Context) error {
+	sub := d.rdb.Subscribe(ctx, redisDirInvalidateChannel)
+	defer sub.Close()
+
+	// wait for the subscription to be active
+	if _, err := sub.Receive(ctx); err != nil {
+		return fmt.Errorf("subscribing to identity invalidations: %w", err)
+	}
+
+	ch := sub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("identity invalidation subscription closed")
+			}
+			id, err := syntax.ParseAtIdentifier(msg.Payload)
+			if err != nil {
+				continue
+			}
+			d.cacheFor(*id).DeleteFromLocalCache(redisDirPrefix + id.String())
+			invalidationsReceived.Inc()
+		}
+	}
+}
+
+func (d *RedisDirectory) LookupDIDs(ctx context.Context, dids []syntax.DID) []identity.LookupResult {
+	return identity.LookupDIDsWith(ctx, dids, 0, d.LookupDID)
+}
+
+func (d *RedisDirectory) LookupHandles(ctx context.Context, handles []syntax.Handle) []identity.LookupResult {
+	return identity.LookupHandlesWith(ctx, handles, 0, d.LookupHandle)
 }
 
 var handleCacheHits = promauto.NewCounter(prometheus.CounterOpts{
@@ -354,3 +417,8 @@ var handleRequestsCoalesced = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "atproto_redis_directory_handle_requests_coalesced",
 	Help: "Number of handle requests coalesced",
 })
+
+var invalidationsReceived = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "atproto_redis_directory_invalidations_received",
+	Help: "Number of identity invalidations received from instances sharing the cache",
+})
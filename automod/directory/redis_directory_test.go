@@ -0,0 +1,74 @@
+package directory
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisDirectoryInvalidation(t *testing.T) {
+	assert := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	did := syntax.DID("did:plc:redisdirtest1")
+	inner := identity.NewMockDirectory()
+	inner.Insert(identity.Identity{DID: did, Handle: syntax.Handle("before.example.com")})
+
+	// instances share an in-process redis server, which supports pub/sub
+	mr := miniredis.RunT(t)
+	newDir := func() *RedisDirectory {
+		d, err := NewRedisDirectory(&inner, "redis://"+mr.Addr()+"/0", time.Hour, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	// d1 purges; d2 runs invalidation, and d3 doesn't
+	d1, d2, d3 := newDir(), newDir(), newDir()
+	assert.NoError(d1.Purge(ctx, did.AtIdentifier()))
+
+	subscribed := make(chan error, 1)
+	go func() {
+		subscribed <- d2.RunInvalidation(ctx)
+	}()
+
+	for _, d := range []*RedisDirectory{d2, d3} {
+		ident, err := d.LookupDID(ctx, did)
+		assert.NoError(err)
+		assert.Equal("before.example.com", ident.Handle.String())
+	}
+
+	// the handle changes, and d1 sees the #identity event
+	inner.Insert(identity.Identity{DID: did, Handle: syntax.Handle("after.example.com")})
+
+	// the entry is evicted from the local cache of d2, which looks it up again. the purge is repeated, as d2 may not have been subscribed yet
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		assert.NoError(d1.Purge(ctx, did.AtIdentifier()))
+		ident, err := d2.LookupDID(ctx, did)
+		assert.NoError(err)
+		if ident.Handle.String() == "after.example.com" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("purge was not received by the second instance")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// without invalidation, d3 serves the stale entry from its local cache
+	ident, err := d3.LookupDID(ctx, did)
+	assert.NoError(err)
+	assert.Equal("before.example.com", ident.Handle.String())
+
+	assert.NoError(d1.Purge(ctx, did.AtIdentifier()))
+	cancel()
+	assert.NoError(<-subscribed)
+}
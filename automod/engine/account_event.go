@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// Context for rules reacting to account status changes (firehose `#account` events), such as takedowns, deactivation, and reactivation. These are distinct from identity changes (`#identity`, `#handle`), which run the identity rules.
+type AccountEventContext struct {
+	AccountContext
+
+	Event comatproto.SyncSubscribeRepos_Account
+}
+
+func NewAccountEventContext(ctx context.Context, eng *Engine, meta AccountMeta, evt comatproto.SyncSubscribeRepos_Account) AccountEventContext {
+	ac := NewAccountContext(ctx, eng, meta)
+	ac.BaseContext.Logger = ac.BaseContext.Logger.With("accountEventType", AccountEventType(&evt))
+	return AccountEventContext{
+		AccountContext: ac,
+		Event:          evt,
+	}
+}
+
+// Short name for the account status change: "active" if the account is (re)activated, otherwise the inactive status (like "deactivated", "takendown", "suspended", or "deleted"), or "inactive" if no status was given.
+func AccountEventType(evt *comatproto.SyncSubscribeRepos_Account) string {
+	if evt.Active {
+		return "active"
+	}
+	if evt.Status != nil && *evt.Status != "" {
+		return *evt.Status
+	}
+	return "inactive"
+}
+
+// Runs the account rules against an account status change event, and persists any resulting account-level effects.
+func (eng *Engine) ProcessAccountEvent(ctx context.Context, evt *comatproto.SyncSubscribeRepos_Account) error {
+	// similar to an HTTP server, we want to recover any panics from rule execution
+	defer func() {
+		if r := recover(); r != nil {
+			eng.Logger.Error("automod event execution exception", "err", r, "did", evt.Did, "type", AccountEventType(evt))
+		}
+	}()
+
+	did, err := syntax.ParseDID(evt.Did)
+	if err != nil {
+		return fmt.Errorf("account event: %w", err)
+	}
+	// account status is part of the cached account metadata
+	if err := eng.PurgeAccountCaches(ctx, did); err != nil {
+		return err
+	}
+	ident, err := eng.Directory.LookupDID(ctx, did)
+	if err != nil {
+		return fmt.Errorf("resolving identity: %w", err)
+	}
+	if ident == nil {
+		return fmt.Errorf("identity not found for did: %s", did)
+	}
+	am, err := eng.GetAccountMeta(ctx, ident)
+	if err != nil {
+		return err
+	}
+	ac := NewAccountEventContext(ctx, eng, *am, *evt)
+	if err := eng.Rules.CallAccountRules(&ac); err != nil {
+		return err
+	}
+	eng.callRuleSetsAccount(&ac)
+	eng.processShadowActions(&ac.effects, "did", did)
+	eng.CanonicalLogLineAccount(&ac.AccountContext)
+	if err := eng.persistAccountModActions(&ac.AccountContext); err != nil {
+		return err
+	}
+	if err := eng.persistCounters(ctx, &ac.effects); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func flagDeactivatedRule(c *AccountEventContext) error {
+	if AccountEventType(&c.Event) == "deactivated" {
+		c.AddAccountFlag("deactivated")
+	}
+	return nil
+}
+
+func TestProcessAccountEvent(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	eng := EngineTestFixture()
+	dir := identity.NewMockDirectory()
+	eng.Directory = &dir
+	eng.Rules = RuleSet{
+		AccountRules: []AccountRule{
+			{Name: "flagDeactivatedRule", Func: flagDeactivatedRule},
+		},
+	}
+
+	ident := identity.Identity{
+		DID:    syntax.DID("did:plc:abc111"),
+		Handle: syntax.Handle("handle.example.com"),
+	}
+	dir.Insert(ident)
+
+	status := "deactivated"
+	evt := comatproto.SyncSubscribeRepos_Account{
+		Did:    ident.DID.String(),
+		Status: &status,
+	}
+	assert.NoError(eng.ProcessAccountEvent(ctx, &evt))
+	flags, err := eng.Flags.Get(ctx, ident.DID.String())
+	assert.NoError(err)
+	assert.Equal([]string{"deactivated"}, flags)
+
+	evt.Status = nil
+	assert.Equal("inactive", AccountEventType(&evt))
+	evt.Active = true
+	assert.Equal("active", AccountEventType(&evt))
+
+	evt.Did = "invalid"
+	assert.Error(eng.ProcessAccountEvent(ctx, &evt))
+}
@@ -22,8 +22,8 @@ func TestAccountReportDedupe(t *testing.T) {
 	ctx := context.Background()
 	eng := EngineTestFixture()
 	eng.Rules = RuleSet{
-		RecordRules: []RecordRuleFunc{
-			alwaysReportAccountRule,
+		RecordRules: []RecordRule{
+			{Name: "alwaysReportAccountRule", Func: alwaysReportAccountRule},
 		},
 	}
 
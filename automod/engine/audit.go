@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"github.com/bluesky-social/indigo/automod/auditlog"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var auditWriteErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "automod_audit_write_errors",
+	Help: "Number of failed writes of moderation actions to the audit log",
+})
+
+// A moderation action, and the rule which queued it.
+type actionAttribution struct {
+	actionRef
+	Rule string
+	// name of the NamedRuleSet, or empty for the primary rules
+	RuleSet  string
+	Counters map[string]int
+}
+
+func (c *BaseContext) recordCounterRead(name, val, period string, count int) {
+	if c.engine.AuditLog == nil {
+		return
+	}
+	if c.countersRead == nil {
+		c.countersRead = make(map[string]int)
+	}
+	c.countersRead[name+"/"+val+"/"+period] = count
+}
+
+func (e *Effects) attribute(rule string, actions []actionRef, counters map[string]int) {
+	for _, a := range actions {
+		e.attributions = append(e.attributions, actionAttribution{
+			actionRef: a,
+			Rule:      rule,
+			Counters:  counters,
+		})
+	}
+}
+
+// Carries over attributions from a named rule set, matching how mergeRuleSet namespaces flags and shadows actions.
+func (e *Effects) mergeAttributions(rs *NamedRuleSet, sub *Effects) {
+	for _, a := range sub.attributions {
+		switch a.Kind {
+		case "account-flag", "account-unflag", "record-flag":
+			a.Val = rs.Name + ruleSetNamespaceSep + a.Val
+		}
+		if rs.Shadow {
+			a.Shadow = true
+		}
+		a.RuleSet = rs.Name
+		e.attributions = append(e.attributions, a)
+	}
+}
+
+// Collects the audit log entries for actions emitted while persisting the effects of a single event. All methods are no-ops if the engine has no audit log.
+type auditBatch struct {
+	eng     *Engine
+	effects *Effects
+	did     string
+	uri     string
+	cid     string
+	entries []auditlog.Entry
+}
+
+func (eng *Engine) newAuditBatch(eff *Effects, did, uri, cid string) *auditBatch {
+	return &auditBatch{
+		eng:     eng,
+		effects: eff,
+		did:     did,
+		uri:     uri,
+		cid:     cid,
+	}
+}
+
+func (b *auditBatch) add(kind, val, comment string) {
+	if b.eng.AuditLog == nil {
+		return
+	}
+	entry := auditlog.Entry{
+		Time:    time.Now(),
+		Action:  kind,
+		Value:   val,
+		Comment: comment,
+		DID:     b.did,
+		URI:     b.uri,
+		CID:     b.cid,
+	}
+	match := val
+	if kind == "account-report" || kind == "record-report" {
+		match = ReasonShortName(val)
+	}
+	for _, a := range b.effects.attributions {
+		if a.Shadow || a.Kind != kind || a.Val != match {
+			continue
+		}
+		entry.Rules = append(entry.Rules, a.Rule)
+		if a.RuleSet != "" {
+			entry.RuleSet = a.RuleSet
+		}
+		for k, v := range a.Counters {
+			if entry.Counters == nil {
+				entry.Counters = make(map[string]int)
+			}
+			entry.Counters[k] = v
+		}
+	}
+	b.entries = append(b.entries, entry)
+}
+
+func (b *auditBatch) addAll(kind string, vals []string) {
+	for _, v := range vals {
+		b.add(kind, v, "")
+	}
+}
+
+// Writes any collected entries to the audit log. Failures are logged and counted, but not returned: the actions have already been emitted.
+func (b *auditBatch) flush(ctx context.Context) {
+	if b.eng.AuditLog == nil || len(b.entries) == 0 {
+		return
+	}
+	if err := b.eng.AuditLog.Write(ctx, b.entries); err != nil {
+		auditWriteErrors.Inc()
+		b.eng.Logger.Error("failed to write audit log", "err", err, "count", len(b.entries))
+	}
+	b.entries = nil
+}
@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod/auditlog"
+	"github.com/bluesky-social/indigo/automod/countstore"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func auditedRule(c *RecordContext, post *appbsky.FeedPost) error {
+	if c.GetCount("post", c.Account.Identity.DID.String(), countstore.PeriodDay) >= 0 {
+		c.AddAccountFlag("audited")
+		c.AddRecordFlag("audited-post")
+	}
+	return nil
+}
+
+func TestAuditLog(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	sink := auditlog.NewMemSink()
+	eng := EngineTestFixture()
+	eng.AuditLog = sink
+	eng.Rules = RuleSet{
+		PostRules: []PostRule{{Name: "auditedRule", Func: auditedRule}, ShadowPostRule(PostRule{Name: "simpleRule", Func: simpleRule})},
+	}
+	eng.RuleSets = []NamedRuleSet{
+		{Name: "community", Rules: RuleSet{PostRules: []PostRule{{Name: "auditedRule", Func: auditedRule}}}},
+	}
+	cid1 := syntax.CID("cid123")
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        syntax.DID("did:plc:abc111"),
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		Value:      &appbsky.FeedPost{Text: "some post blah", Tags: []string{"slur"}},
+	}
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+
+	// shadowed label is not emitted, so not audited
+	entries := sink.All()
+	assert.Equal(4, len(entries))
+	byVal := make(map[string]auditlog.Entry)
+	for _, e := range entries {
+		byVal[e.Value] = e
+	}
+
+	e := byVal["audited"]
+	assert.Equal("account-flag", e.Action)
+	assert.Equal("did:plc:abc111", e.DID)
+	assert.Equal([]string{"auditedRule"}, e.Rules)
+	assert.Equal(map[string]int{"post/did:plc:abc111/day": 0}, e.Counters)
+
+	e = byVal["audited-post"]
+	assert.Equal("record-flag", e.Action)
+	assert.Equal("at://did:plc:abc111/app.bsky.feed.post/abc123", e.URI)
+	assert.Equal("cid123", e.CID)
+
+	e = byVal["community:audited"]
+	assert.Equal("community", e.RuleSet)
+	assert.Equal([]string{"auditedRule"}, e.Rules)
+	assert.Equal(map[string]int{"community:post/did:plc:abc111/day": 0}, e.Counters)
+}
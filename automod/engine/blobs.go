@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// Blobs larger than this are not fetched for blob rules
+var BlobMaxSize int64 = 10 * 1024 * 1024
+
+// Returns the blobs referenced by a record (post images, external link thumbnails, profile avatar and banner, list and feed generator avatars), de-duplicated by CID.
+func recordBlobs(val any) []lexutil.LexBlob {
+	var out []lexutil.LexBlob
+	add := func(b *lexutil.LexBlob) {
+		if b == nil {
+			return
+		}
+		for _, existing := range out {
+			if existing.Ref == b.Ref {
+				return
+			}
+		}
+		out = append(out, *b)
+	}
+	addImages := func(imgs *appbsky.EmbedImages) {
+		if imgs == nil {
+			return
+		}
+		for _, img := range imgs.Images {
+			if img != nil {
+				add(img.Image)
+			}
+		}
+	}
+	addExternal := func(ext *appbsky.EmbedExternal) {
+		if ext != nil && ext.External != nil {
+			add(ext.External.Thumb)
+		}
+	}
+
+	switch rec := val.(type) {
+	case *appbsky.FeedPost:
+		if rec.Embed == nil {
+			break
+		}
+		addImages(rec.Embed.EmbedImages)
+		addExternal(rec.Embed.EmbedExternal)
+		if rwm := rec.Embed.EmbedRecordWithMedia; rwm != nil && rwm.Media != nil {
+			addImages(rwm.Media.EmbedImages)
+			addExternal(rwm.Media.EmbedExternal)
+		}
+	case *appbsky.ActorProfile:
+		add(rec.Avatar)
+		add(rec.Banner)
+	case *appbsky.GraphList:
+		add(rec.Avatar)
+	case *appbsky.FeedGenerator:
+		add(rec.Avatar)
+	}
+	return out
+}
+
+// Fetches a blob from the account's PDS. The declared size in the record is not trusted: the response body is read up to BlobMaxSize, and larger blobs are rejected.
+func (e *Engine) fetchBlob(ctx context.Context, ident *identity.Identity, blob lexutil.LexBlob) ([]byte, error) {
+	if blob.Size > BlobMaxSize {
+		return nil, fmt.Errorf("blob too large to fetch (%d bytes)", blob.Size)
+	}
+	pds := ident.PDSEndpoint()
+	if pds == "" {
+		return nil, fmt.Errorf("no PDS endpoint for account: %s", ident.DID)
+	}
+	xrpcc := xrpc.Client{
+		Host: pds,
+	}
+	body, err := comatproto.SyncGetBlobStream(ctx, &xrpcc, blob.Ref.String(), ident.DID.String())
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	data, err := io.ReadAll(io.LimitReader(body, BlobMaxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading blob: %w", err)
+	}
+	if int64(len(data)) > BlobMaxSize {
+		return nil, fmt.Errorf("blob too large to fetch (more than %d bytes)", BlobMaxSize)
+	}
+	return data, nil
+}
+
+// Fetches each blob referenced by the record, and runs the blob rules against it. Blobs which can not be fetched are logged and skipped.
+func (r *RuleSet) callBlobRules(c *RecordContext) error {
+	if len(r.BlobRules) == 0 || c.Account.Identity == nil {
+		return nil
+	}
+	for _, blob := range recordBlobs(c.RecordOp.Value) {
+		data, err := c.engine.fetchBlob(c.Ctx, c.Account.Identity, blob)
+		if err != nil {
+			c.Logger.Warn("failed to fetch blob for rules", "cid", blob.Ref.String(), "err", err)
+			continue
+		}
+		for _, rule := range r.BlobRules {
+			if stop, err := r.runRule(&c.BaseContext, rule.Name, func() error { return rule.Func(c, blob, data) }); stop {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchBlobMaxSize(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	defer func(n int64) { BlobMaxSize = n }(BlobMaxSize)
+	BlobMaxSize = 16
+
+	body := []byte("small blob")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	eng := EngineTestFixture()
+	ident := identity.Identity{
+		DID:      syntax.DID("did:plc:abc111"),
+		Services: map[string]identity.Service{"atproto_pds": {Type: "AtprotoPersonalDataServer", URL: srv.URL}},
+	}
+	c, err := cid.Decode("bafkreibme22gw2h7y2h7tg2fhqotaqjucnbc24deqo72b6mkl2egezxhvy")
+	assert.NoError(err)
+	blob := lexutil.LexBlob{Ref: lexutil.LexLink(c), MimeType: "image/png", Size: 4}
+
+	data, err := eng.fetchBlob(ctx, &ident, blob)
+	assert.NoError(err)
+	assert.Equal(body, data)
+
+	// the declared size is not trusted
+	body = bytes.Repeat([]byte("x"), 17)
+	_, err = eng.fetchBlob(ctx, &ident, blob)
+	assert.Error(err)
+
+	blob.Size = 17
+	_, err = eng.fetchBlob(ctx, &ident, blob)
+	assert.Error(err)
+}
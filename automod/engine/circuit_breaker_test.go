@@ -31,8 +31,8 @@ func TestTakedownCircuitBreaker(t *testing.T) {
 	eng.Directory = &dir
 	// note that this is a record-level action, not account-level
 	eng.Rules = RuleSet{
-		RecordRules: []RecordRuleFunc{
-			alwaysTakedownRecordRule,
+		RecordRules: []RecordRule{
+			{Name: "alwaysTakedownRecordRule", Func: alwaysTakedownRecordRule},
 		},
 	}
 
@@ -73,8 +73,8 @@ func TestReportCircuitBreaker(t *testing.T) {
 	dir := identity.NewMockDirectory()
 	eng.Directory = &dir
 	eng.Rules = RuleSet{
-		RecordRules: []RecordRuleFunc{
-			alwaysReportRecordRule,
+		RecordRules: []RecordRule{
+			{Name: "alwaysReportRecordRule", Func: alwaysReportRecordRule},
 		},
 	}
 
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var actionClaimsLost = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_action_claims_lost",
+	Help: "Number of moderation actions skipped because another automod instance already claimed them, by type",
+}, []string{"type"})
+
+// Leases held by this instance for a set of moderation actions. See Engine.claimActions.
+type actionClaims struct {
+	keys []string
+}
+
+// Releases all the claims, so the actions can be retried (eg, by another instance re-processing the event). Errors are logged, not returned: the leases will expire in any case.
+func (eng *Engine) releaseClaims(ctx context.Context, claims *actionClaims) {
+	if eng.Locks == nil || claims == nil {
+		return
+	}
+	for _, k := range claims.keys {
+		if err := eng.Locks.Release(ctx, k); err != nil {
+			eng.Logger.Warn("failed to release action claim", "key", k, "err", err)
+		}
+	}
+}
+
+// When multiple instances are processing the same events (see Engine.Locks), filters moderation actions against a subject down to those which this instance has claimed. Claims are keyed by subject (an account DID, or a record AT-URI and CID) and action; reports are also keyed by reason type and comment, which usually identifies the rule which filed the report.
+//
+// Flags are not claimed: adding flags is idempotent.
+func (eng *Engine) claimActions(ctx context.Context, subject string, labels []string, reports []ModReport, takedown bool) ([]string, []ModReport, bool, *actionClaims, error) {
+	claims := &actionClaims{}
+	if eng.Locks == nil {
+		return labels, reports, takedown, claims, nil
+	}
+	claim := func(typ, key string) (bool, error) {
+		ok, err := eng.Locks.Acquire(ctx, key, ActionClaimPeriod)
+		if err != nil {
+			eng.releaseClaims(ctx, claims)
+			return false, fmt.Errorf("claiming moderation action: %w", err)
+		}
+		if !ok {
+			eng.Logger.Debug("skipping action claimed by another instance", "key", key)
+			actionClaimsLost.WithLabelValues(typ).Inc()
+			return false, nil
+		}
+		claims.keys = append(claims.keys, key)
+		return true, nil
+	}
+
+	claimedLabels := []string{}
+	for _, val := range labels {
+		ok, err := claim("label", fmt.Sprintf("automod/label/%s/%s", subject, val))
+		if err != nil {
+			return nil, nil, false, nil, err
+		}
+		if ok {
+			claimedLabels = append(claimedLabels, val)
+		}
+	}
+	claimedReports := []ModReport{}
+	for _, mr := range reports {
+		h := sha256.Sum256([]byte(mr.Comment))
+		ok, err := claim("report", fmt.Sprintf("automod/report/%s/%s/%s", subject, ReasonShortName(mr.ReasonType), hex.EncodeToString(h[:8])))
+		if err != nil {
+			return nil, nil, false, nil, err
+		}
+		if ok {
+			claimedReports = append(claimedReports, mr)
+		}
+	}
+	if takedown {
+		ok, err := claim("takedown", fmt.Sprintf("automod/takedown/%s", subject))
+		if err != nil {
+			return nil, nil, false, nil, err
+		}
+		takedown = ok
+	}
+	return claimedLabels, claimedReports, takedown, claims, nil
+}
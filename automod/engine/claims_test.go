@@ -0,0 +1,50 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bluesky-social/indigo/automod/lockstore"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClaimActions(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// no lock store: everything passes through
+	eng1 := EngineTestFixture()
+	reports := []ModReport{{ReasonType: ReportReasonSpam, Comment: "spam"}, {ReasonType: ReportReasonSpam, Comment: "other rule"}}
+	labels, rep, takedown, _, err := eng1.claimActions(ctx, "did:plc:abc111", []string{"spam"}, reports, true)
+	assert.NoError(err)
+	assert.Equal([]string{"spam"}, labels)
+	assert.Equal(2, len(rep))
+	assert.True(takedown)
+
+	// two instances sharing a lock store
+	locks := lockstore.NewMemLockStore()
+	eng1.Locks = locks
+	eng2 := EngineTestFixture()
+	eng2.Locks = locks
+
+	labels, rep, takedown, claims, err := eng1.claimActions(ctx, "did:plc:abc111", []string{"spam"}, reports[:1], true)
+	assert.NoError(err)
+	assert.Equal([]string{"spam"}, labels)
+	assert.Equal(1, len(rep))
+	assert.True(takedown)
+
+	labels, rep, takedown, _, err = eng2.claimActions(ctx, "did:plc:abc111", []string{"spam", "rude"}, reports, true)
+	assert.NoError(err)
+	assert.Equal([]string{"rude"}, labels)
+	assert.Equal([]ModReport{reports[1]}, rep)
+	assert.False(takedown)
+
+	// released claims (eg, after a failure) can be retried
+	eng1.releaseClaims(ctx, claims)
+	labels, rep, takedown, _, err = eng2.claimActions(ctx, "did:plc:abc111", []string{"spam"}, reports[:1], true)
+	assert.NoError(err)
+	assert.Equal([]string{"spam"}, labels)
+	assert.Equal(1, len(rep))
+	assert.True(takedown)
+}
@@ -0,0 +1,270 @@
+package engine
+
+import (
+	"fmt"
+	"log/slog"
+)
+
+// An additional, independent set of rules run by an Engine alongside the primary rules (Engine.Rules). Allows a single deployment to run rules on behalf of several moderation authorities (eg, platform rules plus community-specific rules).
+//
+// Counters and flags are namespaced by the rule set name, so rule sets can not read or clobber each other's state. Moderation actions are filtered by the rule set's EffectPolicy before being merged with those of the primary rules.
+type NamedRuleSet struct {
+	// Short identifier for the rule set, like "community-x". Must be non-empty, and unique within an Engine.
+	Name   string
+	Rules  RuleSet
+	Policy EffectPolicy
+	// If true, moderation actions permitted by the policy are recorded to the shadow log and metrics, but not persisted
+	Shadow bool
+}
+
+// Which moderation actions a NamedRuleSet is permitted to take. Actions which are not permitted are dropped (and logged). The zero value only allows flags (and counters, which are always allowed).
+type EffectPolicy struct {
+	// If true, may add account and record labels. Restricted to the values in AllowedLabels, if that is non-empty.
+	AllowLabels bool
+	// Label values which may be applied. If empty, and AllowLabels is true, any label value may be applied.
+	AllowedLabels []string
+	// If true, flags are dropped (by default, namespaced flags are allowed)
+	DisallowFlags bool
+	// If true, may file account and record reports
+	AllowReports bool
+	// If true, may take down accounts and records
+	AllowTakedowns bool
+}
+
+// Separator between a rule set name and counter or flag names
+const ruleSetNamespaceSep = ":"
+
+func (p *EffectPolicy) labelAllowed(val string) bool {
+	if !p.AllowLabels {
+		return false
+	}
+	if len(p.AllowedLabels) == 0 {
+		return true
+	}
+	for _, l := range p.AllowedLabels {
+		if l == val {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks that every named rule set has a non-empty and unique name, as names are used to namespace counters and flags, and that rule names are valid within every rule set (see RuleSet.Validate). Should be called once the Engine is configured, before processing events.
+func (eng *Engine) ValidateRuleSets() error {
+	if err := eng.Rules.Validate(); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(eng.RuleSets))
+	for i, rs := range eng.RuleSets {
+		if rs.Name == "" {
+			return fmt.Errorf("rule set %d has an empty name", i)
+		}
+		if seen[rs.Name] {
+			return fmt.Errorf("duplicate rule set name: %s", rs.Name)
+		}
+		seen[rs.Name] = true
+		if err := rs.Rules.Validate(); err != nil {
+			return fmt.Errorf("rule set %s: %w", rs.Name, err)
+		}
+	}
+	return nil
+}
+
+// Runs every named rule set against a copy of the account context, and merges the permitted effects back in to the original context.
+//
+// Errors from one rule set are logged, and do not prevent the other rule sets (or persisting effects) from running.
+func (eng *Engine) callRuleSetsIdentity(c *AccountContext) {
+	for i := range eng.RuleSets {
+		rs := &eng.RuleSets[i]
+		sub := AccountContext{
+			BaseContext: c.BaseContext.forRuleSet(rs.Name),
+			Account:     c.Account,
+		}
+		if err := rs.Rules.CallIdentityRules(&sub); err != nil {
+			sub.Logger.Error("rule set execution failed", "err", err)
+			continue
+		}
+		c.effects.mergeRuleSet(rs, &sub.effects, sub.Logger)
+	}
+}
+
+// Same as callRuleSetsIdentity, for record events.
+func (eng *Engine) callRuleSetsRecord(c *RecordContext) {
+	for i := range eng.RuleSets {
+		rs := &eng.RuleSets[i]
+		sub := RecordContext{
+			AccountContext: AccountContext{
+				BaseContext: c.BaseContext.forRuleSet(rs.Name),
+				Account:     c.Account,
+			},
+			RecordOp: c.RecordOp,
+		}
+		var err error
+		if c.RecordOp.Action == DeleteOp {
+			err = rs.Rules.CallRecordDeleteRules(&sub)
+		} else {
+			err = rs.Rules.CallRecordRules(&sub)
+		}
+		if err != nil {
+			sub.Logger.Error("rule set execution failed", "err", err)
+			continue
+		}
+		c.effects.mergeRuleSet(rs, &sub.effects, sub.Logger)
+	}
+}
+
+// Same as callRuleSetsIdentity, for account status events.
+func (eng *Engine) callRuleSetsAccount(c *AccountEventContext) {
+	for i := range eng.RuleSets {
+		rs := &eng.RuleSets[i]
+		sub := AccountEventContext{
+			AccountContext: AccountContext{
+				BaseContext: c.BaseContext.forRuleSet(rs.Name),
+				Account:     c.Account,
+			},
+			Event: c.Event,
+		}
+		if err := rs.Rules.CallAccountRules(&sub); err != nil {
+			sub.Logger.Error("rule set execution failed", "err", err)
+			continue
+		}
+		c.effects.mergeRuleSet(rs, &sub.effects, sub.Logger)
+	}
+}
+
+// Same as callRuleSetsIdentity, for moderation events.
+func (eng *Engine) callRuleSetsOzone(c *OzoneEventContext) {
+	for i := range eng.RuleSets {
+		rs := &eng.RuleSets[i]
+		sub := OzoneEventContext{
+			AccountContext: AccountContext{
+				BaseContext: c.BaseContext.forRuleSet(rs.Name),
+				Account:     c.Account,
+			},
+			Event:      c.Event,
+			SubjectURI: c.SubjectURI,
+		}
+		if err := rs.Rules.CallOzoneEventRules(&sub); err != nil {
+			sub.Logger.Error("rule set execution failed", "err", err)
+			continue
+		}
+		c.effects.mergeRuleSet(rs, &sub.effects, sub.Logger)
+	}
+}
+
+// Returns a fresh context (no effects or errors) sharing the event state of an existing context, with counters namespaced for the rule set.
+func (c *BaseContext) forRuleSet(name string) BaseContext {
+	return BaseContext{
+		Ctx:       c.Ctx,
+		Err:       nil,
+		Logger:    c.Logger.With("ruleset", name),
+		engine:    c.engine,
+		effects:   Effects{},
+		namespace: name,
+		subject:   c.subject,
+	}
+}
+
+// Prefixes a counter name with the context's rule set namespace, if any.
+func (c *BaseContext) namespaced(name string) string {
+	if c.namespace == "" {
+		return name
+	}
+	return c.namespace + ruleSetNamespaceSep + name
+}
+
+// Merges the effects of a named rule set in to these effects, dropping any actions not permitted by the rule set's policy. Counter names are expected to already be namespaced; flags are namespaced here.
+func (e *Effects) mergeRuleSet(rs *NamedRuleSet, sub *Effects, logger *slog.Logger) {
+	p := &rs.Policy
+	dropped := func(kind, val string) {
+		logger.Warn("dropping moderation action not permitted by rule set policy", "kind", kind, "val", val)
+	}
+
+	e.CounterIncrements = append(e.CounterIncrements, sub.CounterIncrements...)
+	e.CounterDecrements = append(e.CounterDecrements, sub.CounterDecrements...)
+	e.CounterDistinctIncrements = append(e.CounterDistinctIncrements, sub.CounterDistinctIncrements...)
+
+	// permitted moderation actions from shadow rule sets are only recorded
+	target := e
+	if rs.Shadow {
+		target = e.shadow()
+	}
+
+	for _, val := range sub.AccountLabels {
+		if p.labelAllowed(val) {
+			target.AddAccountLabel(val)
+		} else {
+			dropped("account-label", val)
+		}
+	}
+	for _, val := range sub.RecordLabels {
+		if p.labelAllowed(val) {
+			target.AddRecordLabel(val)
+		} else {
+			dropped("record-label", val)
+		}
+	}
+
+	for _, val := range sub.AccountFlags {
+		if p.DisallowFlags {
+			dropped("account-flag", val)
+			continue
+		}
+		target.AddAccountFlag(rs.Name + ruleSetNamespaceSep + val)
+	}
+	for _, val := range sub.RemovedAccountFlags {
+		if p.DisallowFlags {
+			dropped("account-flag-removal", val)
+			continue
+		}
+		target.RemoveAccountFlag(rs.Name + ruleSetNamespaceSep + val)
+	}
+	for _, val := range sub.RecordFlags {
+		if p.DisallowFlags {
+			dropped("record-flag", val)
+			continue
+		}
+		target.AddRecordFlag(rs.Name + ruleSetNamespaceSep + val)
+	}
+
+	for _, mr := range sub.AccountReports {
+		if !p.AllowReports {
+			dropped("account-report", mr.ReasonType)
+			continue
+		}
+		mr.Comment = fmt.Sprintf("[%s] %s", rs.Name, mr.Comment)
+		target.AccountReports = append(target.AccountReports, mr)
+	}
+	for _, mr := range sub.RecordReports {
+		if !p.AllowReports {
+			dropped("record-report", mr.ReasonType)
+			continue
+		}
+		mr.Comment = fmt.Sprintf("[%s] %s", rs.Name, mr.Comment)
+		target.RecordReports = append(target.RecordReports, mr)
+	}
+
+	if sub.AccountTakedown {
+		if p.AllowTakedowns {
+			target.TakedownAccount()
+		} else {
+			dropped("account-takedown", "")
+		}
+	}
+	if sub.RecordTakedown {
+		if p.AllowTakedowns {
+			target.TakedownRecord()
+		} else {
+			dropped("record-takedown", "")
+		}
+	}
+
+	e.mergeAttributions(rs, sub)
+
+	// actions of individual shadow rules within the rule set
+	if sub.Shadow != nil {
+		shadowRS := *rs
+		shadowRS.Shadow = false
+		e.shadow().mergeRuleSet(&shadowRS, sub.Shadow, logger)
+	}
+}
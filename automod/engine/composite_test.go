@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod/countstore"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func communityRule(c *RecordContext, post *appbsky.FeedPost) error {
+	c.Increment("posts", c.Account.Identity.DID.String())
+	if c.GetCount("posts", c.Account.Identity.DID.String(), countstore.PeriodTotal) >= 1 {
+		c.AddRecordFlag("repeat-poster")
+		c.AddRecordLabel("community-label")
+		c.AddRecordLabel("other-label")
+		c.ReportRecord(ReportReasonSpam, "too many posts")
+		c.TakedownRecord()
+	}
+	return nil
+}
+
+func TestNamedRuleSets(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	eng := EngineTestFixture()
+	eng.RuleSets = []NamedRuleSet{
+		{
+			Name:  "community",
+			Rules: RuleSet{PostRules: []PostRule{{Name: "communityRule", Func: communityRule}}},
+			Policy: EffectPolicy{
+				AllowLabels:   true,
+				AllowedLabels: []string{"community-label"},
+			},
+		},
+	}
+
+	did := syntax.DID("did:plc:abc111")
+	cid1 := syntax.CID("cid123")
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        did,
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		Value:      &appbsky.FeedPost{Text: "some post blah"},
+	}
+	am := AccountMeta{Identity: &identity.Identity{DID: did, Handle: syntax.Handle("handle.example.com")}}
+
+	// first post: only counters
+	rc := NewRecordContext(ctx, &eng, am, op)
+	eng.callRuleSetsRecord(&rc)
+	eff := ExtractEffects(&rc.BaseContext)
+	assert.Equal([]CounterRef{{Name: "community:posts", Val: did.String()}}, eff.CounterIncrements)
+	assert.Empty(eff.RecordFlags)
+	assert.NoError(eng.persistCounters(ctx, &eff))
+
+	// counters are namespaced in the store
+	count, err := eng.Counters.GetCount(ctx, "community:posts", did.String(), countstore.PeriodTotal)
+	assert.NoError(err)
+	assert.Equal(1, count)
+	count, err = eng.Counters.GetCount(ctx, "posts", did.String(), countstore.PeriodTotal)
+	assert.NoError(err)
+	assert.Equal(0, count)
+
+	// second post: actions are namespaced and filtered by policy
+	rc = NewRecordContext(ctx, &eng, am, op)
+	eng.callRuleSetsRecord(&rc)
+	eff = ExtractEffects(&rc.BaseContext)
+	assert.Equal([]string{"community:repeat-poster"}, eff.RecordFlags)
+	assert.Equal([]string{"community-label"}, eff.RecordLabels)
+	assert.Empty(eff.RecordReports)
+	assert.False(eff.RecordTakedown)
+
+	// full processing path
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+}
+
+func TestValidateRuleSets(t *testing.T) {
+	assert := assert.New(t)
+
+	eng := EngineTestFixture()
+	assert.NoError(eng.ValidateRuleSets())
+
+	eng.RuleSets = []NamedRuleSet{{Name: "one"}, {Name: "two"}}
+	assert.NoError(eng.ValidateRuleSets())
+
+	eng.RuleSets = []NamedRuleSet{{Name: "one"}, {Name: ""}}
+	assert.ErrorContains(eng.ValidateRuleSets(), "empty name")
+
+	eng.RuleSets = []NamedRuleSet{{Name: "one"}, {Name: "two"}, {Name: "one"}}
+	assert.ErrorContains(eng.ValidateRuleSets(), "duplicate rule set name: one")
+
+	// rule names must be unique across rule types, within each rule set
+	eng.RuleSets = []NamedRuleSet{{Name: "one", Rules: RuleSet{
+		PostRules:   []PostRule{{Name: "simpleRule", Func: simpleRule}},
+		RecordRules: []RecordRule{{Name: "simpleRule", Func: alwaysReportAccountRule}},
+	}}}
+	assert.ErrorContains(eng.ValidateRuleSets(), "rule set one: duplicate rule name: simpleRule")
+
+	eng.RuleSets = nil
+	eng.Rules.ProfileRules = []ProfileRule{{Func: func(c *RecordContext, profile *appbsky.ActorProfile) error { return nil }}}
+	assert.ErrorContains(eng.ValidateRuleSets(), "profile rule 0 has an empty name")
+}
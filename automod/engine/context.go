@@ -20,6 +20,14 @@ type BaseContext struct {
 
 	engine  *Engine // NOTE: pointer, but expected never to be nil
 	effects Effects
+	// name of the NamedRuleSet being executed, or empty for the primary rules. Used to namespace counters.
+	namespace string
+	// set when a rule short-circuits evaluation; no further rules are run
+	stopped bool
+	// DID or AT-URI of the account or record being processed, for RuleMonitor
+	subject string
+	// counter values read by the current rule, for the audit log (only tracked if the engine has one)
+	countersRead map[string]int
 }
 
 type AccountContext struct {
@@ -84,24 +92,26 @@ func (c *BaseContext) Directory() identity.Directory {
 
 // request external state via engine (indirect)
 func (c *BaseContext) GetCount(name, val, period string) int {
-	out, err := c.engine.Counters.GetCount(c.Ctx, name, val, period)
+	out, err := c.engine.Counters.GetCount(c.Ctx, c.namespaced(name), val, period)
 	if err != nil {
 		if nil == c.Err {
 			c.Err = err
 		}
 		return 0
 	}
+	c.recordCounterRead(c.namespaced(name), val, period, out)
 	return out
 }
 
 func (c *BaseContext) GetCountDistinct(name, bucket, period string) int {
-	out, err := c.engine.Counters.GetCountDistinct(c.Ctx, name, bucket, period)
+	out, err := c.engine.Counters.GetCountDistinct(c.Ctx, c.namespaced(name), bucket, period)
 	if err != nil {
 		if nil == c.Err {
 			c.Err = err
 		}
 		return 0
 	}
+	c.recordCounterRead(c.namespaced(name), bucket, period, out)
 	return out
 }
 
@@ -124,6 +134,7 @@ func NewAccountContext(ctx context.Context, eng *Engine, meta AccountMeta) Accou
 			Logger:  eng.Logger.With("did", meta.Identity.DID),
 			engine:  eng,
 			effects: Effects{},
+			subject: meta.Identity.DID.String(),
 		},
 		Account: meta,
 	}
@@ -132,29 +143,68 @@ func NewAccountContext(ctx context.Context, eng *Engine, meta AccountMeta) Accou
 func NewRecordContext(ctx context.Context, eng *Engine, meta AccountMeta, op RecordOp) RecordContext {
 	ac := NewAccountContext(ctx, eng, meta)
 	ac.BaseContext.Logger = ac.BaseContext.Logger.With("collection", op.Collection, "rkey", op.RecordKey)
+	ac.BaseContext.subject = fmt.Sprintf("at://%s/%s/%s", meta.Identity.DID, op.Collection, op.RecordKey)
 	return RecordContext{
 		AccountContext: ac,
 		RecordOp:       op,
 	}
 }
 
+// Returns the tag of the known blob with this exact SHA-256 hash (see hashstore.SHA256), or an empty string if there is no match (or the engine has no hash store).
+func (c *BaseContext) MatchBlobSHA256(hash string) string {
+	if c.engine.Hashes == nil {
+		return ""
+	}
+	tag, err := c.engine.Hashes.MatchSHA256(c.Ctx, hash)
+	if err != nil {
+		if nil == c.Err {
+			c.Err = err
+		}
+		return ""
+	}
+	return tag
+}
+
+// Same as MatchBlobSHA256, for perceptual hashes (see hashstore.PerceptualHash) within the given Hamming distance.
+func (c *BaseContext) MatchBlobPerceptual(hash uint64, maxDistance int) string {
+	if c.engine.Hashes == nil {
+		return ""
+	}
+	tag, err := c.engine.Hashes.MatchPerceptual(c.Ctx, hash, maxDistance)
+	if err != nil {
+		if nil == c.Err {
+			c.Err = err
+		}
+		return ""
+	}
+	return tag
+}
+
 // update effects (indirect)
 func (c *BaseContext) Increment(name, val string) {
-	c.effects.Increment(name, val)
+	c.effects.Increment(c.namespaced(name), val)
+}
+
+func (c *BaseContext) Decrement(name, val string) {
+	c.effects.Decrement(c.namespaced(name), val)
 }
 
 func (c *BaseContext) IncrementDistinct(name, bucket, val string) {
-	c.effects.IncrementDistinct(name, bucket, val)
+	c.effects.IncrementDistinct(c.namespaced(name), bucket, val)
 }
 
 func (c *BaseContext) IncrementPeriod(name, val string, period string) {
-	c.effects.IncrementPeriod(name, val, period)
+	c.effects.IncrementPeriod(c.namespaced(name), val, period)
 }
 
 func (c *AccountContext) AddAccountFlag(val string) {
 	c.effects.AddAccountFlag(val)
 }
 
+func (c *AccountContext) RemoveAccountFlag(val string) {
+	c.effects.RemoveAccountFlag(val)
+}
+
 func (c *AccountContext) AddAccountLabel(val string) {
 	c.effects.AddAccountLabel(val)
 }
@@ -7,6 +7,8 @@ import (
 var (
 	// time period within which automod will not re-report an account for the same reasonType
 	ReportDupePeriod = 7 * 24 * time.Hour
+	// how long a claim on a moderation action is held, when coordinating multiple automod instances (see Engine.Locks). Identical actions against the same subject within this period are only emitted once.
+	ActionClaimPeriod = 24 * time.Hour
 	// number of reports automod can file per day, for all subjects and types combined (circuit breaker)
 	QuotaModReportDay = 50
 	// number of takedowns automod can action per day, for all subjects combined (circuit breaker)
@@ -31,12 +33,16 @@ type CounterDistinctRef struct {
 type Effects struct {
 	// List of counters which should be incremented as part of processing this event. These are collected during rule execution and persisted in bulk at the end.
 	CounterIncrements []CounterRef
+	// List of counters which should be decremented (all time periods), to reverse earlier increments. Persisted along with the increments.
+	CounterDecrements []CounterRef
 	// Similar to "CounterIncrements", but for "distinct" style counters
 	CounterDistinctIncrements []CounterDistinctRef // TODO: better variable names
 	// Label values which should be applied to the overall account, as a result of rule execution.
 	AccountLabels []string
 	// Moderation flags (similar to labels, but private) which should be applied to the overall account, as a result of rule execution.
 	AccountFlags []string
+	// Account flags which should be removed (eg, when an appeal is approved).
+	RemovedAccountFlags []string
 	// Reports which should be filed against this account, as a result of rule execution.
 	AccountReports []ModReport
 	// If "true", indicates that a rule indicates that the entire account should have a takedown.
@@ -49,6 +55,16 @@ type Effects struct {
 	RecordReports []ModReport
 	// Same as "AccountTakedown", but at record-level
 	RecordTakedown bool
+	// Moderation actions which rules running in "shadow" mode would have taken. These are recorded to the shadow log and metrics, but never persisted. Nil if there are none.
+	Shadow *Effects
+
+	// which rules queued which actions, for the audit log (only tracked if the engine has one)
+	attributions []actionAttribution
+}
+
+// Enqueues the named counter to be decremented at the end of all rule processing. Will decrement the current bucket of all time periods (see countstore.CountStore for caveats).
+func (e *Effects) Decrement(name, val string) {
+	e.CounterDecrements = append(e.CounterDecrements, CounterRef{Name: name, Val: val})
 }
 
 // Enqueues the named counter to be incremented at the end of all rule processing. Will automatically increment for all time periods.
@@ -79,6 +95,11 @@ func (e *Effects) AddAccountFlag(val string) {
 	e.AccountFlags = append(e.AccountFlags, val)
 }
 
+// Enqueues the provided flag to be removed from the account (in the Engine's flagstore) at the end of rule processing.
+func (e *Effects) RemoveAccountFlag(val string) {
+	e.RemovedAccountFlags = append(e.RemovedAccountFlags, val)
+}
+
 // Enqueues a moderation report to be filed against the account at the end of rule processing.
 func (e *Effects) ReportAccount(reason, comment string) {
 	if comment == "" {
@@ -0,0 +1,82 @@
+package engine
+
+import (
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// Returns the record being processed if it is a post, or nil (eg, for other record types, or deletions).
+func (c *RecordContext) post() *appbsky.FeedPost {
+	post, _ := c.RecordOp.Value.(*appbsky.FeedPost)
+	return post
+}
+
+// AT-URI of the record embedded (quoted) in the current post, including quotes with media attached. Returns nil if the current record is not a post, or doesn't embed a record. Note that the embedded record may be a list or feed generator, not just a post.
+func (c *RecordContext) QuotedURI() *syntax.ATURI {
+	post := c.post()
+	if post == nil || post.Embed == nil {
+		return nil
+	}
+	var raw string
+	switch {
+	case post.Embed.EmbedRecord != nil && post.Embed.EmbedRecord.Record != nil:
+		raw = post.Embed.EmbedRecord.Record.Uri
+	case post.Embed.EmbedRecordWithMedia != nil && post.Embed.EmbedRecordWithMedia.Record != nil && post.Embed.EmbedRecordWithMedia.Record.Record != nil:
+		raw = post.Embed.EmbedRecordWithMedia.Record.Record.Uri
+	default:
+		return nil
+	}
+	uri, err := syntax.ParseATURI(raw)
+	if err != nil {
+		c.Logger.Warn("invalid embed record AT-URI", "uri", raw, "err", err)
+		return nil
+	}
+	return &uri
+}
+
+// Fetches the post quoted by the current post, with results cached. Returns nil if the current record doesn't quote a post, or the quoted post could not be fetched (eg, it was deleted).
+func (c *RecordContext) QuotedPost() *appbsky.FeedPost {
+	uri := c.QuotedURI()
+	if uri == nil || uri.Collection() != "app.bsky.feed.post" {
+		return nil
+	}
+	post, _ := c.getRecord(*uri).(*appbsky.FeedPost)
+	return post
+}
+
+// The external link card embedded in the current post, or nil if there isn't one (including if the current record is not a post).
+func (c *RecordContext) ExternalLink() *appbsky.EmbedExternal_External {
+	post := c.post()
+	if post == nil || post.Embed == nil {
+		return nil
+	}
+	if post.Embed.EmbedExternal != nil {
+		return post.Embed.EmbedExternal.External
+	}
+	if post.Embed.EmbedRecordWithMedia != nil && post.Embed.EmbedRecordWithMedia.Media != nil && post.Embed.EmbedRecordWithMedia.Media.EmbedExternal != nil {
+		return post.Embed.EmbedRecordWithMedia.Media.EmbedExternal.External
+	}
+	return nil
+}
+
+// Alt texts of any images embedded in the current post (including quotes with images attached). Empty alt texts are skipped.
+func (c *RecordContext) ImageAltTexts() []string {
+	post := c.post()
+	if post == nil || post.Embed == nil {
+		return nil
+	}
+	images := post.Embed.EmbedImages
+	if images == nil && post.Embed.EmbedRecordWithMedia != nil && post.Embed.EmbedRecordWithMedia.Media != nil {
+		images = post.Embed.EmbedRecordWithMedia.Media.EmbedImages
+	}
+	if images == nil {
+		return nil
+	}
+	var out []string
+	for _, img := range images.Images {
+		if img != nil && img.Alt != "" {
+			out = append(out, img.Alt)
+		}
+	}
+	return out
+}
@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbedHelpers(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	eng := EngineTestFixture()
+
+	am := AccountMeta{Identity: &identity.Identity{DID: syntax.DID("did:plc:abc111")}}
+	quotedURI := syntax.ATURI("at://did:plc:other222/app.bsky.feed.post/abc123")
+	post := &appbsky.FeedPost{
+		Text: "check this out",
+		Embed: &appbsky.FeedPost_Embed{
+			EmbedRecordWithMedia: &appbsky.EmbedRecordWithMedia{
+				Record: &appbsky.EmbedRecord{
+					Record: &comatproto.RepoStrongRef{Uri: quotedURI.String(), Cid: "cid"},
+				},
+				Media: &appbsky.EmbedRecordWithMedia_Media{
+					EmbedImages: &appbsky.EmbedImages{
+						Images: []*appbsky.EmbedImages_Image{{Alt: "a cat"}, {Alt: ""}},
+					},
+				},
+			},
+		},
+	}
+	cid := syntax.CID("cid123")
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        am.Identity.DID,
+		Collection: "app.bsky.feed.post",
+		RecordKey:  "abc",
+		CID:        &cid,
+		Value:      post,
+	}
+	c := NewRecordContext(ctx, &eng, am, op)
+	assert.Equal(quotedURI, *c.QuotedURI())
+	assert.Equal([]string{"a cat"}, c.ImageAltTexts())
+	assert.Nil(c.ExternalLink())
+
+	// quoted post is fetched via the record cache
+	quoted := appbsky.FeedPost{LexiconTypeID: "app.bsky.feed.post", Text: "original"}
+	b, err := json.Marshal(&lexutil.LexiconTypeDecoder{Val: &quoted})
+	assert.NoError(err)
+	assert.NoError(eng.Cache.Set(ctx, "record", quotedURI.String(), string(b)))
+	assert.Equal("original", c.QuotedPost().Text)
+
+	post.Embed = &appbsky.FeedPost_Embed{
+		EmbedExternal: &appbsky.EmbedExternal{
+			External: &appbsky.EmbedExternal_External{Uri: "https://example.com"},
+		},
+	}
+	assert.Nil(c.QuotedURI())
+	assert.Nil(c.QuotedPost())
+	assert.Nil(c.ImageAltTexts())
+	assert.Equal("https://example.com", c.ExternalLink().Uri)
+
+	// not a post
+	op.Value = &appbsky.FeedLike{}
+	c = NewRecordContext(ctx, &eng, am, op)
+	assert.Nil(c.QuotedURI())
+	assert.Nil(c.ExternalLink())
+}
@@ -8,10 +8,14 @@ import (
 
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod/auditlog"
 	"github.com/bluesky-social/indigo/automod/cachestore"
 	"github.com/bluesky-social/indigo/automod/countstore"
 	"github.com/bluesky-social/indigo/automod/flagstore"
+	"github.com/bluesky-social/indigo/automod/hashstore"
+	"github.com/bluesky-social/indigo/automod/lockstore"
 	"github.com/bluesky-social/indigo/automod/setstore"
+	"github.com/bluesky-social/indigo/automod/urlresolve"
 	"github.com/bluesky-social/indigo/xrpc"
 )
 
@@ -19,18 +23,38 @@ import (
 //
 // NOTE: careful when initializing: several fields must not be nil or zero, even though they are pointer type.
 type Engine struct {
-	Logger      *slog.Logger
-	Directory   identity.Directory
-	Rules       RuleSet
-	Counters    countstore.CountStore
-	Sets        setstore.SetStore
-	Cache       cachestore.CacheStore
-	Flags       flagstore.FlagStore
+	Logger    *slog.Logger
+	Directory identity.Directory
+	Rules     RuleSet
+	// Additional independent rule sets, run after the primary Rules, with namespaced counters and flags (optional). Names must be non-empty and unique.
+	RuleSets []NamedRuleSet
+	Counters countstore.CountStore
+	Sets     setstore.SetStore
+	Cache    cachestore.CacheStore
+	Flags    flagstore.FlagStore
+	// known blob hashes, for blob rules (optional)
+	Hashes      hashstore.HashStore
 	RelayClient *xrpc.Client
 	BskyClient  *xrpc.Client
 	// used to persist moderation actions in mod service (optional)
 	AdminClient     *xrpc.Client
 	SlackWebhookURL string
+	// If true, the whole engine runs in "shadow" (dry-run) mode: moderation actions are recorded to the shadow log and metrics, but not persisted (flags, labels, reports, takedowns). Counters are still persisted. Individual rules can be run in shadow mode with ShadowPostRule (etc).
+	Shadow bool
+	// Where to log moderation actions suppressed by shadow mode (optional; defaults to Logger)
+	ShadowLogger *slog.Logger
+	// Per-minute limits on moderation actions; when exceeded, the engine runs in shadow mode for a cooldown period (optional)
+	ActionLimiter *ActionLimiter
+	// Coordinates multiple instances processing the same events, so that each moderation action is only emitted once (optional; not needed for a single instance)
+	Locks lockstore.LockStore
+	// Resolves links through URL shorteners, for rules which inspect link destinations (optional)
+	URLResolver *urlresolve.Resolver
+	// In-process per-rule statistics and recent rule triggers, for runtime introspection (optional)
+	RuleMonitor *RuleMonitor
+	// Rules switched off at runtime (optional)
+	RuleToggles *RuleToggles
+	// Records every emitted moderation action, along with the rules and counter values behind it (optional)
+	AuditLog auditlog.Sink
 }
 
 func (eng *Engine) ProcessIdentityEvent(ctx context.Context, typ string, did syntax.DID) error {
@@ -57,6 +81,8 @@ func (eng *Engine) ProcessIdentityEvent(ctx context.Context, typ string, did syn
 	if err := eng.Rules.CallIdentityRules(&ac); err != nil {
 		return err
 	}
+	eng.callRuleSetsIdentity(&ac)
+	eng.processShadowActions(&ac.effects, "did", am.Identity.DID)
 	eng.CanonicalLogLineAccount(&ac)
 	eng.PurgeAccountCaches(ctx, am.Identity.DID)
 	if err := eng.persistAccountModActions(&ac); err != nil {
@@ -105,6 +131,8 @@ func (eng *Engine) ProcessRecordOp(ctx context.Context, op RecordOp) error {
 	default:
 		return fmt.Errorf("unexpected op action: %s", op.Action)
 	}
+	eng.callRuleSetsRecord(&rc)
+	eng.processShadowActions(&rc.effects, "did", am.Identity.DID, "uri", op.ATURI())
 	eng.CanonicalLogLineRecord(&rc)
 	// purge the account meta cache when profile is updated
 	if rc.RecordOp.Collection == "app.bsky.actor.profile" {
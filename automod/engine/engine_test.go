@@ -41,3 +41,62 @@ func TestEngineBasics(t *testing.T) {
 	op.Value = &p2
 	assert.NoError(eng.ProcessRecordOp(ctx, op))
 }
+
+func TestStopEvaluation(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	did := syntax.DID("did:plc:abc111")
+	cid1 := syntax.CID("cid123")
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        did,
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		Value:      &appbsky.FeedPost{Text: "some post blah"},
+	}
+	am := AccountMeta{Identity: &identity.Identity{DID: did, Handle: syntax.Handle("handle.example.com")}}
+
+	ran := 0
+	counting := func(c *RecordContext, post *appbsky.FeedPost) error {
+		ran++
+		return nil
+	}
+	stopping := func(c *RecordContext, post *appbsky.FeedPost) error {
+		c.AddRecordFlag("stopped")
+		return StopEvaluation
+	}
+	takedown := func(c *RecordContext, post *appbsky.FeedPost) error {
+		c.TakedownRecord()
+		return nil
+	}
+
+	eng := EngineTestFixture()
+	eng.Rules = RuleSet{PostRules: []PostRule{
+		{Name: "counting", Func: counting},
+		{Name: "stopping", Func: stopping},
+		{Name: "counting-again", Func: counting},
+	}}
+	rc := NewRecordContext(ctx, &eng, am, op)
+	assert.NoError(eng.Rules.CallRecordRules(&rc))
+	assert.Equal(1, ran)
+	assert.Equal([]string{"stopped"}, ExtractEffects(&rc.BaseContext).RecordFlags)
+
+	// takedowns only short-circuit if configured
+	ran = 0
+	eng.Rules = RuleSet{PostRules: []PostRule{
+		{Name: "takedown", Func: takedown},
+		{Name: "counting", Func: counting},
+	}}
+	rc = NewRecordContext(ctx, &eng, am, op)
+	assert.NoError(eng.Rules.CallRecordRules(&rc))
+	assert.Equal(1, ran)
+
+	ran = 0
+	eng.Rules.StopOnTakedown = true
+	rc = NewRecordContext(ctx, &eng, am, op)
+	assert.NoError(eng.Rules.CallRecordRules(&rc))
+	assert.Equal(0, ran)
+	assert.True(ExtractEffects(&rc.BaseContext).RecordTakedown)
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/xrpc"
+)
+
+// Fetches a record from the PDS of the account which owns it, with results cached. Returns nil (not an error) if the record was not found.
+func (e *Engine) fetchRecord(ctx context.Context, uri syntax.ATURI) (any, error) {
+	existing, err := e.Cache.Get(ctx, "record", uri.String())
+	if err != nil {
+		return nil, err
+	}
+	if existing != "" {
+		var rec lexutil.LexiconTypeDecoder
+		if err := json.Unmarshal([]byte(existing), &rec); err != nil {
+			return nil, fmt.Errorf("parsing record from cache: %v", err)
+		}
+		return rec.Val, nil
+	}
+
+	if uri.RecordKey() == "" {
+		return nil, fmt.Errorf("need a full, not partial, AT-URI: %s", uri)
+	}
+	ident, err := e.Directory.Lookup(ctx, uri.Authority())
+	if err != nil {
+		return nil, fmt.Errorf("resolving AT-URI authority: %w", err)
+	}
+	pds := ident.PDSEndpoint()
+	if pds == "" {
+		return nil, fmt.Errorf("no PDS endpoint for account: %s", ident.DID)
+	}
+	xrpcc := xrpc.Client{
+		Host: pds,
+	}
+	out, err := comatproto.RepoGetRecord(ctx, &xrpcc, "", uri.Collection().String(), ident.DID.String(), uri.RecordKey().String())
+	if err != nil {
+		var xe *xrpc.Error
+		if errors.As(err, &xe) && xe.StatusCode == 400 {
+			// getRecord returns HTTP 400 (RecordNotFound) for missing records
+			return nil, nil
+		}
+		return nil, fmt.Errorf("fetching record (%s): %w", uri, err)
+	}
+	if out.Value == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(out.Value)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.Cache.Set(ctx, "record", uri.String(), string(b)); err != nil {
+		return nil, err
+	}
+	return out.Value.Val, nil
+}
+
+// Fetches a list record by AT-URI (eg, a list linked from a post), with results cached. Returns nil if the record was not found, or could not be fetched (which is logged).
+func (c *BaseContext) GetList(uri syntax.ATURI) *appbsky.GraphList {
+	list, _ := c.getRecord(uri).(*appbsky.GraphList)
+	return list
+}
+
+// Same as GetList, for feed generator records.
+func (c *BaseContext) GetFeedGenerator(uri syntax.ATURI) *appbsky.FeedGenerator {
+	feedgen, _ := c.getRecord(uri).(*appbsky.FeedGenerator)
+	return feedgen
+}
+
+func (c *BaseContext) getRecord(uri syntax.ATURI) any {
+	rec, err := c.engine.fetchRecord(c.Ctx, uri)
+	if err != nil {
+		// remote records are often deleted or unavailable; this should not fail the whole event
+		c.Logger.Warn("failed to fetch record", "uri", uri, "err", err)
+		return nil
+	}
+	return rec
+}
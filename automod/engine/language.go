@@ -0,0 +1,27 @@
+package engine
+
+import (
+	"github.com/bluesky-social/indigo/automod/langdetect"
+)
+
+// Languages of the current post's text, as ISO 639-1 codes (eg, "en"), in order of confidence. Detected from the text where possible (see the langdetect package). Otherwise falls back to the languages declared by the author (the post `langs` field), skipping any which are implausible for the text (eg, declared Japanese, but written in the Latin script). Returns an empty list if the current record is not a post, or the language can't be determined.
+func (c *RecordContext) DetectedLanguages() []string {
+	post := c.post()
+	if post == nil {
+		return []string{}
+	}
+	if detected := langdetect.Detect(post.Text); len(detected) > 0 {
+		return detected
+	}
+	out := []string{}
+	for _, tag := range post.Langs {
+		lang := langdetect.Base(tag)
+		if lang != "" && langdetect.Plausible(post.Text, lang) {
+			out = append(out, lang)
+		}
+	}
+	if len(out) > 1 {
+		out = dedupeStrings(out)
+	}
+	return out
+}
@@ -0,0 +1,41 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectedLanguages(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	eng := EngineTestFixture()
+
+	am := AccountMeta{Identity: &identity.Identity{DID: syntax.DID("did:plc:abc111")}}
+	cid := syntax.CID("cid123")
+	newContext := func(text string, langs ...string) RecordContext {
+		op := RecordOp{
+			Action:     CreateOp,
+			DID:        am.Identity.DID,
+			Collection: "app.bsky.feed.post",
+			RecordKey:  "abc",
+			CID:        &cid,
+			Value:      &appbsky.FeedPost{Text: text, Langs: langs},
+		}
+		return NewRecordContext(ctx, &eng, am, op)
+	}
+
+	c := newContext("das ist nicht gut, aber es ist auch sehr schön", "en")
+	assert.Equal([]string{"de"}, c.DetectedLanguages())
+
+	// falls back to (plausible) declared languages for short texts
+	c = newContext("hello", "en-GB", "ja", "en")
+	assert.Equal([]string{"en"}, c.DetectedLanguages())
+	c = newContext("hello")
+	assert.Equal([]string{}, c.DetectedLanguages())
+}
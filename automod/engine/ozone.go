@@ -0,0 +1,125 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// Context for rules reacting to moderation events (eg, from human moderators in Ozone). The Account is the subject of the event (or the account which owns the subject record).
+type OzoneEventContext struct {
+	AccountContext
+
+	Event comatproto.AdminDefs_ModEventView
+	// Set if the subject of the event is a record, not the account as a whole
+	SubjectURI *syntax.ATURI
+}
+
+func NewOzoneEventContext(ctx context.Context, eng *Engine, meta AccountMeta, evt comatproto.AdminDefs_ModEventView) OzoneEventContext {
+	ac := NewAccountContext(ctx, eng, meta)
+	ac.BaseContext.Logger = ac.BaseContext.Logger.With("modEventID", evt.Id, "modEventType", OzoneEventType(&evt))
+	oc := OzoneEventContext{
+		AccountContext: ac,
+		Event:          evt,
+	}
+	if evt.Subject != nil && evt.Subject.RepoStrongRef != nil {
+		if uri, err := syntax.ParseATURI(evt.Subject.RepoStrongRef.Uri); err == nil {
+			oc.SubjectURI = &uri
+		}
+	}
+	return oc
+}
+
+// Short name of the type of a moderation event, like "takedown" or "reverseTakedown", or an empty string if unknown.
+func OzoneEventType(evt *comatproto.AdminDefs_ModEventView) string {
+	if evt.Event == nil {
+		return ""
+	}
+	e := evt.Event
+	switch {
+	case e.AdminDefs_ModEventTakedown != nil:
+		return "takedown"
+	case e.AdminDefs_ModEventReverseTakedown != nil:
+		return "reverseTakedown"
+	case e.AdminDefs_ModEventComment != nil:
+		return "comment"
+	case e.AdminDefs_ModEventReport != nil:
+		return "report"
+	case e.AdminDefs_ModEventLabel != nil:
+		return "label"
+	case e.AdminDefs_ModEventAcknowledge != nil:
+		return "acknowledge"
+	case e.AdminDefs_ModEventEscalate != nil:
+		return "escalate"
+	case e.AdminDefs_ModEventMute != nil:
+		return "mute"
+	case e.AdminDefs_ModEventEmail != nil:
+		return "email"
+	}
+	return ""
+}
+
+// Returns the DID of the account which is the subject of a moderation event (or owns the subject record).
+func ozoneEventSubjectDID(evt *comatproto.AdminDefs_ModEventView) (syntax.DID, error) {
+	if evt.Subject == nil {
+		return "", fmt.Errorf("moderation event has no subject")
+	}
+	if ref := evt.Subject.AdminDefs_RepoRef; ref != nil {
+		return syntax.ParseDID(ref.Did)
+	}
+	if ref := evt.Subject.RepoStrongRef; ref != nil {
+		uri, err := syntax.ParseATURI(ref.Uri)
+		if err != nil {
+			return "", err
+		}
+		return uri.Authority().AsDID()
+	}
+	return "", fmt.Errorf("unsupported moderation event subject type")
+}
+
+// Runs the moderation event rules against a moderation event (eg, from the Ozone moderation service), and persists any resulting account-level effects.
+func (eng *Engine) ProcessOzoneEvent(ctx context.Context, evt *comatproto.AdminDefs_ModEventView) error {
+	// similar to an HTTP server, we want to recover any panics from rule execution
+	defer func() {
+		if r := recover(); r != nil {
+			eng.Logger.Error("automod event execution exception", "err", r, "modEventID", evt.Id)
+		}
+	}()
+
+	did, err := ozoneEventSubjectDID(evt)
+	if err != nil {
+		return fmt.Errorf("moderation event %d: %w", evt.Id, err)
+	}
+	// moderation actions change account state, so always fetch fresh account metadata
+	if err := eng.PurgeAccountCaches(ctx, did); err != nil {
+		return err
+	}
+	ident, err := eng.Directory.LookupDID(ctx, did)
+	if err != nil {
+		return fmt.Errorf("resolving identity: %w", err)
+	}
+	if ident == nil {
+		return fmt.Errorf("identity not found for did: %s", did)
+	}
+	am, err := eng.GetAccountMeta(ctx, ident)
+	if err != nil {
+		return err
+	}
+	oc := NewOzoneEventContext(ctx, eng, *am, *evt)
+	oc.Logger.Debug("processing moderation event")
+	if err := eng.Rules.CallOzoneEventRules(&oc); err != nil {
+		return err
+	}
+	eng.callRuleSetsOzone(&oc)
+	eng.processShadowActions(&oc.effects, "did", did, "modEventID", evt.Id)
+	eng.CanonicalLogLineAccount(&oc.AccountContext)
+	if err := eng.persistAccountModActions(&oc.AccountContext); err != nil {
+		return err
+	}
+	if err := eng.persistCounters(ctx, &oc.effects); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func clearFlagOnReverseRule(c *OzoneEventContext) error {
+	if c.Event.Event.AdminDefs_ModEventReverseTakedown != nil {
+		c.RemoveAccountFlag("bad")
+	}
+	return nil
+}
+
+func TestProcessOzoneEvent(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	eng := EngineTestFixture()
+	dir := identity.NewMockDirectory()
+	eng.Directory = &dir
+	eng.Rules = RuleSet{
+		OzoneEventRules: []OzoneEventRule{
+			{Name: "clearFlagOnReverseRule", Func: clearFlagOnReverseRule},
+		},
+	}
+
+	ident := identity.Identity{
+		DID:    syntax.DID("did:plc:abc111"),
+		Handle: syntax.Handle("handle.example.com"),
+	}
+	dir.Insert(ident)
+	assert.NoError(eng.Flags.Add(ctx, ident.DID.String(), []string{"bad", "other"}))
+
+	evt := comatproto.AdminDefs_ModEventView{
+		Id:        123,
+		CreatedBy: "did:plc:moderator",
+		Event: &comatproto.AdminDefs_ModEventView_Event{
+			AdminDefs_ModEventReverseTakedown: &comatproto.AdminDefs_ModEventReverseTakedown{},
+		},
+		Subject: &comatproto.AdminDefs_ModEventView_Subject{
+			AdminDefs_RepoRef: &comatproto.AdminDefs_RepoRef{Did: ident.DID.String()},
+		},
+	}
+	assert.Equal("reverseTakedown", OzoneEventType(&evt))
+	assert.NoError(eng.ProcessOzoneEvent(ctx, &evt))
+	flags, err := eng.Flags.Get(ctx, ident.DID.String())
+	assert.NoError(err)
+	assert.Equal([]string{"other"}, flags)
+
+	// record subjects resolve to the owning account
+	evt.Subject = &comatproto.AdminDefs_ModEventView_Subject{
+		RepoStrongRef: &comatproto.RepoStrongRef{Uri: "at://did:plc:abc111/app.bsky.feed.post/abc123", Cid: "cid"},
+	}
+	did, err := ozoneEventSubjectDID(&evt)
+	assert.NoError(err)
+	assert.Equal(ident.DID, did)
+
+	evt.Subject = nil
+	assert.Error(eng.ProcessOzoneEvent(ctx, &evt))
+}
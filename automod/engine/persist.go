@@ -3,8 +3,10 @@ package engine
 import (
 	"context"
 	"fmt"
+	"time"
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/automod/countstore"
 )
 
 func (eng *Engine) persistCounters(ctx context.Context, eff *Effects) error {
@@ -22,6 +24,12 @@ func (eng *Engine) persistCounters(ctx context.Context, eff *Effects) error {
 			}
 		}
 	}
+	for _, ref := range eff.CounterDecrements {
+		err := eng.Counters.Decrement(ctx, ref.Name, ref.Val)
+		if err != nil {
+			return err
+		}
+	}
 	for _, ref := range eff.CounterDistinctIncrements {
 		err := eng.Counters.IncrementDistinct(ctx, ref.Name, ref.Bucket, ref.Val)
 		if err != nil {
@@ -31,31 +39,75 @@ func (eng *Engine) persistCounters(ctx context.Context, eff *Effects) error {
 	return nil
 }
 
+// Periodically removes expired period counters from the engine's CountStore, if it needs that (see countstore.PurgeableCountStore). Expects to be run in a goroutine; returns when the context is cancelled.
+func (eng *Engine) RunCounterPurge(ctx context.Context, interval time.Duration) error {
+	pcs, ok := eng.Counters.(countstore.PurgeableCountStore)
+	if !ok {
+		return nil
+	}
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			n, err := pcs.PurgeExpired(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				eng.Logger.Error("failed to purge expired counters", "err", err)
+				continue
+			}
+			eng.Logger.Debug("purged expired counters", "count", n)
+		}
+	}
+}
+
 // Persists account-level moderation actions: new labels, new flags, new takedowns, and reports.
 //
 // If necessary, will "purge" identity and account caches, so that state updates will be picked up for subsequent events.
 //
 // Note that this method expects to run *before* counts are persisted (it accesses and updates some counts)
-func (eng *Engine) persistAccountModActions(c *AccountContext) error {
+func (eng *Engine) persistAccountModActions(c *AccountContext) (err error) {
 	ctx := c.Ctx
 
 	// de-dupe actions
 	newLabels := dedupeLabelActions(c.effects.AccountLabels, c.Account.AccountLabels, c.Account.AccountNegatedLabels)
 	newFlags := dedupeFlagActions(c.effects.AccountFlags, c.Account.AccountFlags)
+	removedFlags := dedupeStrings(c.effects.RemovedAccountFlags)
 
 	// don't report the same account multiple times on the same day for the same reason. this is a quick check; we also query the mod service API just before creating the report.
 	partialReports, err := eng.dedupeReportActions(ctx, c.Account.Identity.DID, c.effects.AccountReports)
 	if err != nil {
 		return err
 	}
+	newLabels, partialReports, partialTakedown, claims, err := eng.claimActions(ctx, c.Account.Identity.DID.String(), newLabels, partialReports, c.effects.AccountTakedown && !c.Account.Takendown)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			eng.releaseClaims(ctx, claims)
+		}
+	}()
 	newReports, err := eng.circuitBreakReports(ctx, partialReports)
 	if err != nil {
 		return err
 	}
-	newTakedown, err := eng.circuitBreakTakedown(ctx, c.effects.AccountTakedown && !c.Account.Takendown)
+	newTakedown, err := eng.circuitBreakTakedown(ctx, partialTakedown)
 	if err != nil {
 		return err
 	}
+	newLabels, newReports, newTakedown = eng.rateLimitActions(newLabels, newReports, newTakedown)
+
+	// actions are added to the audit log once they have been emitted
+	audit := eng.newAuditBatch(&c.effects, c.Account.Identity.DID.String(), "", "")
+	defer audit.flush(ctx)
 
 	anyModActions := newTakedown || len(newLabels) > 0 || len(newFlags) > 0 || len(newReports) > 0
 	if anyModActions && eng.SlackWebhookURL != "" {
@@ -68,10 +120,21 @@ func (eng *Engine) persistAccountModActions(c *AccountContext) error {
 	// flags don't require admin auth
 	if len(newFlags) > 0 {
 		eng.Flags.Add(ctx, c.Account.Identity.DID.String(), newFlags)
+		audit.addAll("account-flag", newFlags)
+	}
+	if len(removedFlags) > 0 {
+		eng.Logger.Info("removing account flags", "removedFlags", removedFlags)
+		if err := eng.Flags.Remove(ctx, c.Account.Identity.DID.String(), removedFlags); err != nil {
+			return err
+		}
+		audit.addAll("account-unflag", removedFlags)
 	}
 
 	// if we can't actually talk to service, bail out early
 	if eng.AdminClient == nil {
+		if len(removedFlags) > 0 {
+			return eng.PurgeAccountCaches(ctx, c.Account.Identity.DID)
+		}
 		return nil
 	}
 
@@ -98,6 +161,7 @@ func (eng *Engine) persistAccountModActions(c *AccountContext) error {
 		if err != nil {
 			return err
 		}
+		audit.addAll("account-label", newLabels)
 	}
 
 	// reports are additionally de-duped when persisting the action, so track with a flag
@@ -109,6 +173,7 @@ func (eng *Engine) persistAccountModActions(c *AccountContext) error {
 		}
 		if created {
 			createdReports = true
+			audit.add("account-report", mr.ReasonType, mr.Comment)
 		}
 	}
 
@@ -131,9 +196,10 @@ func (eng *Engine) persistAccountModActions(c *AccountContext) error {
 		if err != nil {
 			return err
 		}
+		audit.add("account-takedown", "", "")
 	}
 
-	needCachePurge := newTakedown || len(newLabels) > 0 || len(newFlags) > 0 || createdReports
+	needCachePurge := newTakedown || len(newLabels) > 0 || len(newFlags) > 0 || len(removedFlags) > 0 || createdReports
 	if needCachePurge {
 		return eng.PurgeAccountCaches(ctx, c.Account.Identity.DID)
 	}
@@ -144,24 +210,44 @@ func (eng *Engine) persistAccountModActions(c *AccountContext) error {
 // Persists some record-level state: labels, takedowns, reports.
 //
 // NOTE: this method currently does *not* persist record-level flags to any storage, and does not de-dupe most actions, on the assumption that the record is new (from firehose) and has no existing mod state.
-func (eng *Engine) persistRecordModActions(c *RecordContext) error {
+func (eng *Engine) persistRecordModActions(c *RecordContext) (err error) {
 	ctx := c.Ctx
 	if err := eng.persistAccountModActions(&c.AccountContext); err != nil {
 		return err
 	}
 
-	// NOTE: record-level actions are *not* currently de-duplicated (aka, the same record could be labeled multiple times, or re-reported, etc)
-	newLabels := dedupeStrings(c.effects.RecordLabels)
+	// NOTE: record-level actions are *not* currently de-duplicated against existing moderation state (aka, the same record could be labeled multiple times, or re-reported, etc), only between instances processing the same event
+	atURI := fmt.Sprintf("at://%s/%s/%s", c.Account.Identity.DID, c.RecordOp.Collection, c.RecordOp.RecordKey)
+	subject := atURI
+	if c.RecordOp.CID != nil {
+		subject += "/" + c.RecordOp.CID.String()
+	}
+	newLabels, partialReports, partialTakedown, claims, err := eng.claimActions(ctx, subject, dedupeStrings(c.effects.RecordLabels), c.effects.RecordReports, c.effects.RecordTakedown)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			eng.releaseClaims(ctx, claims)
+		}
+	}()
 	newFlags := dedupeStrings(c.effects.RecordFlags)
-	newReports, err := eng.circuitBreakReports(ctx, c.effects.RecordReports)
+	newReports, err := eng.circuitBreakReports(ctx, partialReports)
 	if err != nil {
 		return err
 	}
-	newTakedown, err := eng.circuitBreakTakedown(ctx, c.effects.RecordTakedown)
+	newTakedown, err := eng.circuitBreakTakedown(ctx, partialTakedown)
 	if err != nil {
 		return err
 	}
-	atURI := fmt.Sprintf("at://%s/%s/%s", c.Account.Identity.DID, c.RecordOp.Collection, c.RecordOp.RecordKey)
+	newLabels, newReports, newTakedown = eng.rateLimitActions(newLabels, newReports, newTakedown)
+
+	cidStr := ""
+	if c.RecordOp.CID != nil {
+		cidStr = c.RecordOp.CID.String()
+	}
+	audit := eng.newAuditBatch(&c.effects, c.Account.Identity.DID.String(), atURI, cidStr)
+	defer audit.flush(ctx)
 
 	if newTakedown || len(newLabels) > 0 || len(newFlags) > 0 || len(newReports) > 0 {
 		if eng.SlackWebhookURL != "" {
@@ -176,6 +262,7 @@ func (eng *Engine) persistRecordModActions(c *RecordContext) error {
 	// flags don't require admin auth
 	if len(newFlags) > 0 {
 		eng.Flags.Add(ctx, atURI, newFlags)
+		audit.addAll("record-flag", newFlags)
 	}
 
 	// exit early
@@ -217,6 +304,7 @@ func (eng *Engine) persistRecordModActions(c *RecordContext) error {
 		if err != nil {
 			return err
 		}
+		audit.addAll("record-label", newLabels)
 	}
 
 	for _, mr := range newReports {
@@ -231,6 +319,7 @@ func (eng *Engine) persistRecordModActions(c *RecordContext) error {
 		if err != nil {
 			return err
 		}
+		audit.add("record-report", mr.ReasonType, mr.Comment)
 	}
 	if newTakedown {
 		eng.Logger.Warn("record-takedown")
@@ -249,6 +338,7 @@ func (eng *Engine) persistRecordModActions(c *RecordContext) error {
 		if err != nil {
 			return err
 		}
+		audit.add("record-takedown", "", "")
 	}
 	return nil
 }
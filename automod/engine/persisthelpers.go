@@ -77,18 +77,14 @@ func (eng *Engine) circuitBreakReports(ctx context.Context, reports []ModReport)
 	if len(reports) == 0 {
 		return []ModReport{}, nil
 	}
-	c, err := eng.GetCount("automod-quota", "report", countstore.PeriodDay)
+	ok, err := eng.Counters.IncrementIfBelow(ctx, "automod-quota", "report", countstore.PeriodDay, QuotaModReportDay)
 	if err != nil {
 		return nil, fmt.Errorf("checking report action quota: %w", err)
 	}
-	if c >= QuotaModReportDay {
+	if !ok {
 		eng.Logger.Warn("CIRCUIT BREAKER: automod reports")
 		return []ModReport{}, nil
 	}
-	err = eng.Counters.Increment(ctx, "automod-quota", "report")
-	if err != nil {
-		return nil, fmt.Errorf("incrementing report action quota: %w", err)
-	}
 	return reports, nil
 }
 
@@ -96,18 +92,14 @@ func (eng *Engine) circuitBreakTakedown(ctx context.Context, takedown bool) (boo
 	if !takedown {
 		return false, nil
 	}
-	c, err := eng.GetCount("automod-quota", "takedown", countstore.PeriodDay)
+	ok, err := eng.Counters.IncrementIfBelow(ctx, "automod-quota", "takedown", countstore.PeriodDay, QuotaModTakedownDay)
 	if err != nil {
 		return false, fmt.Errorf("checking takedown action quota: %w", err)
 	}
-	if c >= QuotaModTakedownDay {
+	if !ok {
 		eng.Logger.Warn("CIRCUIT BREAKER: automod takedowns")
 		return false, nil
 	}
-	err = eng.Counters.Increment(ctx, "automod-quota", "takedown")
-	if err != nil {
-		return false, fmt.Errorf("incrementing takedown action quota: %w", err)
-	}
 	return takedown, nil
 }
 
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var actionsRateLimited = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_actions_rate_limited",
+	Help: "Number of moderation actions dropped by the per-minute action rate limiter, by type",
+}, []string{"type"})
+
+var actionLimiterTrips = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_action_limiter_trips",
+	Help: "Number of times the action rate limiter tripped the engine in to shadow mode, by the type of action which exceeded its limit",
+}, []string{"type"})
+
+var actionLimiterTripped = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "automod_action_limiter_tripped",
+	Help: "Whether the engine is currently in shadow mode because the action rate limiter tripped (1) or not (0)",
+})
+
+// Per-minute limits on moderation actions, across all subjects and rules. A zero limit means no limit for that type of action.
+type ActionLimits struct {
+	LabelsPerMinute    int
+	ReportsPerMinute   int
+	TakedownsPerMinute int
+	// How long the engine stays in shadow mode after a limit is exceeded
+	Cooldown time.Duration
+}
+
+func DefaultActionLimits() ActionLimits {
+	return ActionLimits{
+		LabelsPerMinute:    100,
+		ReportsPerMinute:   20,
+		TakedownsPerMinute: 5,
+		Cooldown:           10 * time.Minute,
+	}
+}
+
+// Rate limiter and circuit breaker for moderation actions, protecting the moderation service from a misbehaving rule (eg, one which reports every post in the firehose).
+//
+// When any per-minute limit is exceeded, the actions which would exceed it are dropped, and the limiter "trips": the engine runs in shadow mode (see Engine.Shadow) until the cooldown has passed. This is tracked in the automod_action_limiter_tripped metric, which is intended for alerting.
+//
+// Limits are counted in fixed one-minute windows, in memory, so they apply per-process. This is in addition to the daily quotas (QuotaModReportDay, QuotaModTakedownDay), which are shared via the CountStore. Safe for concurrent use.
+type ActionLimiter struct {
+	Limits ActionLimits
+
+	lk           sync.Mutex
+	window       time.Time
+	counts       map[string]int
+	trippedUntil time.Time
+}
+
+func NewActionLimiter(limits ActionLimits) *ActionLimiter {
+	return &ActionLimiter{
+		Limits: limits,
+		counts: make(map[string]int),
+	}
+}
+
+func (l *ActionLimiter) limit(typ string) int {
+	switch typ {
+	case "label":
+		return l.Limits.LabelsPerMinute
+	case "report":
+		return l.Limits.ReportsPerMinute
+	case "takedown":
+		return l.Limits.TakedownsPerMinute
+	}
+	return 0
+}
+
+// Records n actions of the given type ("label", "report", or "takedown"), returning false if they should be dropped. Actions are dropped if they would exceed the limit (which trips the limiter), or if the limiter is already tripped. A nil limiter allows everything.
+func (l *ActionLimiter) Allow(typ string, n int) bool {
+	if l == nil || n <= 0 {
+		return true
+	}
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	now := time.Now()
+	if now.Before(l.trippedUntil) {
+		actionsRateLimited.WithLabelValues(typ).Add(float64(n))
+		return false
+	}
+	window := now.Truncate(time.Minute)
+	if !window.Equal(l.window) {
+		l.window = window
+		clear(l.counts)
+	}
+	limit := l.limit(typ)
+	if limit > 0 && l.counts[typ]+n > limit {
+		l.trippedUntil = now.Add(l.Limits.Cooldown)
+		actionsRateLimited.WithLabelValues(typ).Add(float64(n))
+		actionLimiterTrips.WithLabelValues(typ).Inc()
+		actionLimiterTripped.Set(1)
+		return false
+	}
+	l.counts[typ] += n
+	return true
+}
+
+// Whether the limiter is currently tripped (in cooldown). A nil limiter is never tripped.
+func (l *ActionLimiter) Tripped() bool {
+	if l == nil {
+		return false
+	}
+	l.lk.Lock()
+	defer l.lk.Unlock()
+	if time.Now().Before(l.trippedUntil) {
+		return true
+	}
+	actionLimiterTripped.Set(0)
+	return false
+}
+
+// Drops any moderation actions which exceed the engine's action rate limits (if configured).
+func (eng *Engine) rateLimitActions(labels []string, reports []ModReport, takedown bool) ([]string, []ModReport, bool) {
+	l := eng.ActionLimiter
+	if l == nil {
+		return labels, reports, takedown
+	}
+	if !l.Allow("label", len(labels)) {
+		eng.Logger.Warn("RATE LIMIT: automod labels", "labels", labels)
+		labels = []string{}
+	}
+	if !l.Allow("report", len(reports)) {
+		eng.Logger.Warn("RATE LIMIT: automod reports", "count", len(reports))
+		reports = []ModReport{}
+	}
+	if takedown && !l.Allow("takedown", 1) {
+		eng.Logger.Warn("RATE LIMIT: automod takedowns")
+		takedown = false
+	}
+	return labels, reports, takedown
+}
@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func labelAndFlagRecordRule(c *RecordContext) error {
+	c.AddRecordLabel("spam")
+	c.AddRecordFlag("spammy")
+	return nil
+}
+
+func TestActionLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	var nilLimiter *ActionLimiter
+	assert.True(nilLimiter.Allow("report", 100))
+	assert.False(nilLimiter.Tripped())
+
+	l := NewActionLimiter(ActionLimits{ReportsPerMinute: 3, Cooldown: time.Minute})
+	assert.True(l.Allow("report", 2))
+	assert.True(l.Allow("label", 100))
+	assert.False(l.Allow("report", 2))
+	assert.True(l.Tripped())
+	// everything is dropped while tripped
+	assert.False(l.Allow("label", 1))
+
+	l.trippedUntil = time.Now().Add(-time.Second)
+	assert.False(l.Tripped())
+}
+
+func TestActionLimiterShadow(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	eng := EngineTestFixture()
+	dir := identity.NewMockDirectory()
+	eng.Directory = &dir
+	eng.ActionLimiter = NewActionLimiter(ActionLimits{LabelsPerMinute: 2, Cooldown: time.Hour})
+	eng.Rules = RuleSet{
+		RecordRules: []RecordRule{
+			{Name: "labelAndFlagRecordRule", Func: labelAndFlagRecordRule},
+		},
+	}
+
+	cid1 := syntax.CID("cid123")
+	p1 := appbsky.FeedPost{Text: "some post blah"}
+	var uris []string
+	for i := 0; i < 5; i++ {
+		ident := identity.Identity{
+			DID:    syntax.DID(fmt.Sprintf("did:plc:abc%d", i)),
+			Handle: syntax.Handle("handle.example.com"),
+		}
+		dir.Insert(ident)
+		op := RecordOp{
+			Action:     CreateOp,
+			DID:        ident.DID,
+			Collection: syntax.NSID("app.bsky.feed.post"),
+			RecordKey:  syntax.RecordKey("abc123"),
+			CID:        &cid1,
+			Value:      &p1,
+		}
+		assert.NoError(eng.ProcessRecordOp(ctx, op))
+		uris = append(uris, fmt.Sprintf("at://%s/app.bsky.feed.post/abc123", ident.DID))
+	}
+
+	// the third label exceeds the limit and trips the limiter; subsequent events run in shadow mode, so even flags are not persisted
+	assert.True(eng.ActionLimiter.Tripped())
+	for i, uri := range uris {
+		flags, err := eng.Flags.Get(ctx, uri)
+		assert.NoError(err)
+		if i < 3 {
+			assert.Equal([]string{"spammy"}, flags)
+		} else {
+			assert.Empty(flags)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var ruleEvaluations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_rule_evaluations",
+	Help: "Number of times each rule has been run",
+}, []string{"rule"})
+
+var ruleTriggers = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_rule_triggers",
+	Help: "Number of rule runs which resulted in a moderation action (including shadow actions)",
+}, []string{"rule"})
+
+var ruleErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_rule_errors",
+	Help: "Number of rule runs which returned an error",
+}, []string{"rule"})
+
+var ruleDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "automod_rule_duration_seconds",
+	Help:    "Time taken by each rule run",
+	Buckets: prometheus.ExponentialBuckets(0.00005, 4, 10),
+}, []string{"rule"})
+
+// Runs a single rule, recording metrics about the run, labeled with the rule name (see NamedRule).
+func observeRule(name string, eff *Effects, call func() error) error {
+	before := eff.actionCount()
+	start := time.Now()
+	err := call()
+	ruleDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+	ruleEvaluations.WithLabelValues(name).Inc()
+	if err != nil && !errors.Is(err, StopEvaluation) {
+		ruleErrors.WithLabelValues(name).Inc()
+	}
+	if eff.actionCount() > before {
+		ruleTriggers.WithLabelValues(name).Inc()
+	}
+	return err
+}
+
+// Total number of moderation actions (not counter updates) in the effects, including shadowed actions.
+func (e *Effects) actionCount() int {
+	n := len(e.AccountLabels) + len(e.AccountFlags) + len(e.RemovedAccountFlags) + len(e.AccountReports) + len(e.RecordLabels) + len(e.RecordFlags) + len(e.RecordReports)
+	if e.AccountTakedown {
+		n++
+	}
+	if e.RecordTakedown {
+		n++
+	}
+	if e.Shadow != nil {
+		n += e.Shadow.actionCount()
+	}
+	return n
+}
@@ -0,0 +1,71 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func failingRule(c *RecordContext, post *appbsky.FeedPost) error {
+	return fmt.Errorf("rule failure")
+}
+
+func TestRuleMetrics(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	eng := EngineTestFixture()
+	did := syntax.DID("did:plc:abc111")
+	cid1 := syntax.CID("cid123")
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        did,
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		Value:      &appbsky.FeedPost{Text: "some post blah"},
+	}
+	am := AccountMeta{Identity: &identity.Identity{DID: did, Handle: syntax.Handle("handle.example.com")}}
+
+	evals := testutil.ToFloat64(ruleEvaluations.WithLabelValues("simpleRule"))
+	triggers := testutil.ToFloat64(ruleTriggers.WithLabelValues("simpleRule"))
+	errs := testutil.ToFloat64(ruleErrors.WithLabelValues("failingRule"))
+
+	rc := NewRecordContext(ctx, &eng, am, op)
+	assert.NoError(eng.Rules.CallRecordRules(&rc))
+	op.Value = &appbsky.FeedPost{Text: "some post blah", Tags: []string{"slur"}}
+	rc = NewRecordContext(ctx, &eng, am, op)
+	assert.NoError(eng.Rules.CallRecordRules(&rc))
+	assert.Equal(evals+2, testutil.ToFloat64(ruleEvaluations.WithLabelValues("simpleRule")))
+	assert.Equal(triggers+1, testutil.ToFloat64(ruleTriggers.WithLabelValues("simpleRule")))
+
+	eng.Rules.PostRules = []PostRule{{Name: "failingRule", Func: failingRule}}
+	rc = NewRecordContext(ctx, &eng, am, op)
+	assert.Error(eng.Rules.CallRecordRules(&rc))
+	assert.Equal(errs+1, testutil.ToFloat64(ruleErrors.WithLabelValues("failingRule")))
+
+	// closures from the same code are still counted separately, by rule name
+	flagRule := func(flag string) PostRuleFunc {
+		return func(c *RecordContext, post *appbsky.FeedPost) error {
+			c.AddRecordFlag(flag)
+			return nil
+		}
+	}
+	eng.Rules.PostRules = []PostRule{
+		{Name: "flag-one", Func: flagRule("one")},
+		ShadowPostRule(PostRule{Name: "flag-two", Func: flagRule("two")}),
+	}
+	oneTriggers := testutil.ToFloat64(ruleTriggers.WithLabelValues("flag-one"))
+	twoTriggers := testutil.ToFloat64(ruleTriggers.WithLabelValues("shadow:flag-two"))
+	rc = NewRecordContext(ctx, &eng, am, op)
+	assert.NoError(eng.Rules.CallRecordRules(&rc))
+	assert.Equal(oneTriggers+1, testutil.ToFloat64(ruleTriggers.WithLabelValues("flag-one")))
+	assert.Equal(twoTriggers+1, testutil.ToFloat64(ruleTriggers.WithLabelValues("shadow:flag-two")))
+}
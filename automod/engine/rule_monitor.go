@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Summary statistics for a single rule, since the RuleMonitor was created.
+type RuleStats struct {
+	Evaluations int64 `json:"evaluations"`
+	Triggers    int64 `json:"triggers"`
+	Errors      int64 `json:"errors"`
+	// total time spent running the rule
+	DurationSeconds float64 `json:"durationSeconds"`
+}
+
+// A single rule run which resulted in moderation actions (including shadow actions).
+type RuleTrigger struct {
+	Time time.Time `json:"time"`
+	Rule string    `json:"rule"`
+	// name of the NamedRuleSet, or empty for the primary rules
+	RuleSet string `json:"ruleSet,omitempty"`
+	// DID or AT-URI of the account or record being processed
+	Subject string `json:"subject"`
+	// short descriptions of the actions, like "record-label:spam" or "shadow:account-flag:promo"
+	Actions []string `json:"actions"`
+}
+
+// Keeps in-process statistics for each rule, and a fixed-size buffer of the most recent rule triggers, for runtime introspection (eg, an admin API). These complement the prometheus metrics, which are not easily queried from inside the process. Safe for concurrent use.
+type RuleMonitor struct {
+	lk     sync.Mutex
+	stats  map[string]*RuleStats
+	recent []RuleTrigger
+	// index in recent of the next trigger to be written
+	next int
+}
+
+// Creates a monitor which retains the most recent 'size' rule triggers.
+func NewRuleMonitor(size int) *RuleMonitor {
+	if size <= 0 {
+		size = 1
+	}
+	return &RuleMonitor{
+		stats:  make(map[string]*RuleStats),
+		recent: make([]RuleTrigger, 0, size),
+	}
+}
+
+func (m *RuleMonitor) observe(name string, dur time.Duration, err error, trig *RuleTrigger) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	st, ok := m.stats[name]
+	if !ok {
+		st = &RuleStats{}
+		m.stats[name] = st
+	}
+	st.Evaluations++
+	st.DurationSeconds += dur.Seconds()
+	if err != nil {
+		st.Errors++
+	}
+	if trig == nil {
+		return
+	}
+	st.Triggers++
+	if len(m.recent) < cap(m.recent) {
+		m.recent = append(m.recent, *trig)
+	} else {
+		m.recent[m.next] = *trig
+	}
+	m.next = (m.next + 1) % cap(m.recent)
+}
+
+// Returns a copy of the statistics for every rule which has been run, by rule name.
+func (m *RuleMonitor) Stats() map[string]RuleStats {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	out := make(map[string]RuleStats, len(m.stats))
+	for name, st := range m.stats {
+		out[name] = *st
+	}
+	return out
+}
+
+// Returns up to 'limit' of the most recent rule triggers, newest first. A limit of zero or less returns all retained triggers.
+func (m *RuleMonitor) Recent(limit int) []RuleTrigger {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	n := len(m.recent)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	out := make([]RuleTrigger, 0, limit)
+	for i := 1; i <= limit; i++ {
+		out = append(out, m.recent[(m.next-i+n)%n])
+	}
+	return out
+}
+
+// Rules which can be switched off at runtime, by name (see NamedRule and RuleSet.RuleNames). Disabled rules are skipped in all rule sets. Safe for concurrent use.
+type RuleToggles struct {
+	lk       sync.RWMutex
+	disabled map[string]bool
+}
+
+func NewRuleToggles() *RuleToggles {
+	return &RuleToggles{
+		disabled: make(map[string]bool),
+	}
+}
+
+func (t *RuleToggles) Disable(name string) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.disabled[name] = true
+}
+
+func (t *RuleToggles) Enable(name string) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	delete(t.disabled, name)
+}
+
+func (t *RuleToggles) IsDisabled(name string) bool {
+	t.lk.RLock()
+	defer t.lk.RUnlock()
+	return t.disabled[name]
+}
+
+// Names of all the currently disabled rules, sorted.
+func (t *RuleToggles) Disabled() []string {
+	t.lk.RLock()
+	defer t.lk.RUnlock()
+	names := make([]string, 0, len(t.disabled))
+	for name := range t.disabled {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Names of the rules in the set, by rule type (eg, "post" or "identity"), in the order they are run. Types with no rules are omitted.
+func (r *RuleSet) RuleNames() map[string][]string {
+	out := make(map[string][]string)
+	r.eachRuleType(func(typ string, names []string) {
+		if len(names) > 0 {
+			out[typ] = names
+		}
+	})
+	return out
+}
+
+// Shallow copy of the effects, for comparison with newActions after running a rule.
+func (e *Effects) snapshot() Effects {
+	snap := *e
+	if e.Shadow != nil {
+		shadow := *e.Shadow
+		snap.Shadow = &shadow
+	}
+	return snap
+}
+
+// A moderation action queued by a rule.
+type actionRef struct {
+	// eg, "account-label" or "record-takedown"
+	Kind string
+	// label or flag value, or short report reason (empty for takedowns)
+	Val    string
+	Shadow bool
+}
+
+func (a actionRef) String() string {
+	s := a.Kind
+	if a.Val != "" {
+		s += ":" + a.Val
+	}
+	if a.Shadow {
+		s = "shadow:" + s
+	}
+	return s
+}
+
+// Lists the moderation actions which were added to 'after' since the 'before' snapshot was taken. Relies on effects only ever being appended to.
+func newActions(before, after *Effects, shadow bool) []actionRef {
+	var out []actionRef
+	add := func(kind string, vals []string, from int) {
+		for _, v := range vals[min(from, len(vals)):] {
+			out = append(out, actionRef{Kind: kind, Val: v, Shadow: shadow})
+		}
+	}
+	addReports := func(kind string, reports []ModReport, from int) {
+		for _, r := range reports[min(from, len(reports)):] {
+			out = append(out, actionRef{Kind: kind, Val: ReasonShortName(r.ReasonType), Shadow: shadow})
+		}
+	}
+	add("account-label", after.AccountLabels, len(before.AccountLabels))
+	add("account-flag", after.AccountFlags, len(before.AccountFlags))
+	add("account-unflag", after.RemovedAccountFlags, len(before.RemovedAccountFlags))
+	addReports("account-report", after.AccountReports, len(before.AccountReports))
+	if after.AccountTakedown && !before.AccountTakedown {
+		out = append(out, actionRef{Kind: "account-takedown", Shadow: shadow})
+	}
+	add("record-label", after.RecordLabels, len(before.RecordLabels))
+	add("record-flag", after.RecordFlags, len(before.RecordFlags))
+	addReports("record-report", after.RecordReports, len(before.RecordReports))
+	if after.RecordTakedown && !before.RecordTakedown {
+		out = append(out, actionRef{Kind: "record-takedown", Shadow: shadow})
+	}
+	if after.Shadow != nil {
+		prev := before.Shadow
+		if prev == nil {
+			prev = &Effects{}
+		}
+		out = append(out, newActions(prev, after.Shadow, true)...)
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleMonitor(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	eng := EngineTestFixture()
+	eng.RuleMonitor = NewRuleMonitor(2)
+	eng.RuleToggles = NewRuleToggles()
+	did := syntax.DID("did:plc:abc111")
+	cid1 := syntax.CID("cid123")
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        did,
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		Value:      &appbsky.FeedPost{Text: "some post blah", Tags: []string{"slur"}},
+	}
+	am := AccountMeta{Identity: &identity.Identity{DID: did, Handle: syntax.Handle("handle.example.com")}}
+
+	assert.Equal(map[string][]string{"post": {"simpleRule"}}, eng.Rules.RuleNames())
+
+	for i := 0; i < 3; i++ {
+		rc := NewRecordContext(ctx, &eng, am, op)
+		assert.NoError(eng.Rules.CallRecordRules(&rc))
+	}
+	stats := eng.RuleMonitor.Stats()["simpleRule"]
+	assert.Equal(int64(3), stats.Evaluations)
+	assert.Equal(int64(3), stats.Triggers)
+	recent := eng.RuleMonitor.Recent(0)
+	assert.Equal(2, len(recent))
+	assert.Equal("at://did:plc:abc111/app.bsky.feed.post/abc123", recent[0].Subject)
+	assert.Equal([]string{"record-label:bad-hashtag"}, recent[0].Actions)
+	assert.Equal(1, len(eng.RuleMonitor.Recent(1)))
+
+	// disabled rules are skipped entirely
+	eng.RuleToggles.Disable("simpleRule")
+	assert.Equal([]string{"simpleRule"}, eng.RuleToggles.Disabled())
+	rc := NewRecordContext(ctx, &eng, am, op)
+	assert.NoError(eng.Rules.CallRecordRules(&rc))
+	assert.Empty(rc.effects.RecordLabels)
+	assert.Equal(int64(3), eng.RuleMonitor.Stats()["simpleRule"].Evaluations)
+
+	eng.RuleToggles.Enable("simpleRule")
+	rc = NewRecordContext(ctx, &eng, am, op)
+	assert.NoError(eng.Rules.CallRecordRules(&rc))
+	assert.Equal([]string{"bad-hashtag"}, rc.effects.RecordLabels)
+}
+
+func TestRuleTogglesByName(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// closures share a function pointer, so are only told apart by their names
+	flagRule := func(flag string) PostRuleFunc {
+		return func(c *RecordContext, post *appbsky.FeedPost) error {
+			c.AddRecordFlag(flag)
+			return nil
+		}
+	}
+	eng := EngineTestFixture()
+	eng.RuleToggles = NewRuleToggles()
+	eng.Rules = RuleSet{PostRules: []PostRule{
+		{Name: "flag-one", Func: flagRule("one")},
+		{Name: "flag-two", Func: flagRule("two")},
+	}}
+	did := syntax.DID("did:plc:abc111")
+	cid1 := syntax.CID("cid123")
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        did,
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		Value:      &appbsky.FeedPost{Text: "some post blah"},
+	}
+	am := AccountMeta{Identity: &identity.Identity{DID: did, Handle: syntax.Handle("handle.example.com")}}
+
+	eng.RuleToggles.Disable("flag-one")
+	rc := NewRecordContext(ctx, &eng, am, op)
+	assert.NoError(eng.Rules.CallRecordRules(&rc))
+	assert.Equal([]string{"two"}, rc.effects.RecordFlags)
+}
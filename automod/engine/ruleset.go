@@ -1,24 +1,99 @@
 package engine
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
 	appbsky "github.com/bluesky-social/indigo/api/bsky"
 )
 
+// Sentinel error which a rule can return to skip all remaining rules for the current event (eg, once a terminal action like a takedown has been queued, or to avoid running expensive rules). Effects queued so far are still persisted, and it is not treated as a failure.
+var StopEvaluation = errors.New("automod: stop rule evaluation")
+
+// Rules are run in order, so the order of each list is the rule priority: cheap or decisive rules should come first, and expensive ones (eg, those which make network requests) last. Generic RecordRules run before the record-type-specific rules (PostRules, ProfileRules, etc).
 type RuleSet struct {
-	PostRules         []PostRuleFunc
-	ProfileRules      []ProfileRuleFunc
-	RecordRules       []RecordRuleFunc
-	RecordDeleteRules []RecordRuleFunc
-	IdentityRules     []IdentityRuleFunc
+	PostRules         []PostRule
+	ProfileRules      []ProfileRule
+	ListRules         []ListRule
+	FeedGenRules      []FeedGenRule
+	RecordRules       []RecordRule
+	RecordDeleteRules []RecordRule
+	IdentityRules     []IdentityRule
+	// Run against account status changes (eg, deactivation and reactivation), see Engine.ProcessAccountEvent
+	AccountRules []AccountRule
+	// Run against moderation events (eg, actions by human moderators), see Engine.ProcessOzoneEvent
+	OzoneEventRules []OzoneEventRule
+	// Run against each blob referenced by created or updated records, after all the other record rules. Blobs are fetched from the account's PDS, which is relatively expensive.
+	BlobRules []BlobRule
+	// If true, no further rules are run for an event once a rule has queued an account or record takedown
+	StopOnTakedown bool
+}
+
+// Runs a single rule. Returns true if no further rules should be run for the event: because of an error, or short-circuiting (see StopEvaluation and StopOnTakedown).
+func (r *RuleSet) runRule(c *BaseContext, name string, call func() error) (bool, error) {
+	if c.stopped {
+		return true, nil
+	}
+	if t := c.engine.RuleToggles; t != nil && t.IsDisabled(name) {
+		return false, nil
+	}
+	mon := c.engine.RuleMonitor
+	audit := c.engine.AuditLog != nil
+	var before Effects
+	if mon != nil || audit {
+		before = c.effects.snapshot()
+	}
+	if audit {
+		c.countersRead = nil
+	}
+	start := time.Now()
+	err := observeRule(name, &c.effects, call)
+	if mon != nil || audit {
+		actions := newActions(&before, &c.effects, false)
+		if audit && len(actions) > 0 {
+			c.effects.attribute(name, actions, c.countersRead)
+		}
+		if mon != nil {
+			var trig *RuleTrigger
+			if len(actions) > 0 {
+				trig = &RuleTrigger{
+					Time:    start,
+					Rule:    name,
+					RuleSet: c.namespace,
+					Subject: c.subject,
+				}
+				for _, a := range actions {
+					trig.Actions = append(trig.Actions, a.String())
+				}
+			}
+			ruleErr := err
+			if errors.Is(err, StopEvaluation) {
+				ruleErr = nil
+			}
+			mon.observe(name, time.Since(start), ruleErr, trig)
+		}
+	}
+	if errors.Is(err, StopEvaluation) {
+		c.Logger.Debug("rule stopped evaluation", "rule", name)
+		c.stopped = true
+		return true, nil
+	}
+	if err != nil {
+		return true, err
+	}
+	if r.StopOnTakedown && (c.effects.AccountTakedown || c.effects.RecordTakedown) {
+		c.Logger.Debug("takedown queued, skipping remaining rules", "rule", name)
+		c.stopped = true
+		return true, nil
+	}
+	return false, nil
 }
 
 func (r *RuleSet) CallRecordRules(c *RecordContext) error {
 	// first the generic rules
-	for _, f := range r.RecordRules {
-		err := f(c)
-		if err != nil {
+	for _, rule := range r.RecordRules {
+		if stop, err := r.runRule(&c.BaseContext, rule.Name, func() error { return rule.Func(c) }); stop {
 			return err
 		}
 	}
@@ -29,9 +104,8 @@ func (r *RuleSet) CallRecordRules(c *RecordContext) error {
 		if !ok {
 			return fmt.Errorf("mismatch between collection (%s) and type", c.RecordOp.Collection)
 		}
-		for _, f := range r.PostRules {
-			err := f(c, post)
-			if err != nil {
+		for _, rule := range r.PostRules {
+			if stop, err := r.runRule(&c.BaseContext, rule.Name, func() error { return rule.Func(c, post) }); stop {
 				return err
 			}
 		}
@@ -40,20 +114,39 @@ func (r *RuleSet) CallRecordRules(c *RecordContext) error {
 		if !ok {
 			return fmt.Errorf("mismatch between collection (%s) and type", c.RecordOp.Collection)
 		}
-		for _, f := range r.ProfileRules {
-			err := f(c, profile)
-			if err != nil {
+		for _, rule := range r.ProfileRules {
+			if stop, err := r.runRule(&c.BaseContext, rule.Name, func() error { return rule.Func(c, profile) }); stop {
+				return err
+			}
+		}
+	case "app.bsky.graph.list":
+		list, ok := c.RecordOp.Value.(*appbsky.GraphList)
+		if !ok {
+			return fmt.Errorf("mismatch between collection (%s) and type", c.RecordOp.Collection)
+		}
+		for _, rule := range r.ListRules {
+			if stop, err := r.runRule(&c.BaseContext, rule.Name, func() error { return rule.Func(c, list) }); stop {
+				return err
+			}
+		}
+	case "app.bsky.feed.generator":
+		feedgen, ok := c.RecordOp.Value.(*appbsky.FeedGenerator)
+		if !ok {
+			return fmt.Errorf("mismatch between collection (%s) and type", c.RecordOp.Collection)
+		}
+		for _, rule := range r.FeedGenRules {
+			if stop, err := r.runRule(&c.BaseContext, rule.Name, func() error { return rule.Func(c, feedgen) }); stop {
 				return err
 			}
 		}
 	}
-	return nil
+	// finally rules against any blobs
+	return r.callBlobRules(c)
 }
 
 func (r *RuleSet) CallRecordDeleteRules(c *RecordContext) error {
-	for _, f := range r.RecordDeleteRules {
-		err := f(c)
-		if err != nil {
+	for _, rule := range r.RecordDeleteRules {
+		if stop, err := r.runRule(&c.BaseContext, rule.Name, func() error { return rule.Func(c) }); stop {
 			return err
 		}
 	}
@@ -61,11 +154,70 @@ func (r *RuleSet) CallRecordDeleteRules(c *RecordContext) error {
 }
 
 func (r *RuleSet) CallIdentityRules(c *AccountContext) error {
-	for _, f := range r.IdentityRules {
-		err := f(c)
-		if err != nil {
+	for _, rule := range r.IdentityRules {
+		if stop, err := r.runRule(&c.BaseContext, rule.Name, func() error { return rule.Func(c) }); stop {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RuleSet) CallAccountRules(c *AccountEventContext) error {
+	for _, rule := range r.AccountRules {
+		if stop, err := r.runRule(&c.BaseContext, rule.Name, func() error { return rule.Func(c) }); stop {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RuleSet) CallOzoneEventRules(c *OzoneEventContext) error {
+	for _, rule := range r.OzoneEventRules {
+		if stop, err := r.runRule(&c.BaseContext, rule.Name, func() error { return rule.Func(c) }); stop {
 			return err
 		}
 	}
 	return nil
 }
+
+// Checks that every rule in the set has a non-empty name, and that names are unique across all rule types, since rules are identified by name in metrics, rule toggles and the admin API.
+func (r *RuleSet) Validate() error {
+	seen := make(map[string]bool)
+	var err error
+	r.eachRuleType(func(typ string, names []string) {
+		for i, name := range names {
+			if err != nil {
+				return
+			}
+			if name == "" {
+				err = fmt.Errorf("%s rule %d has an empty name", typ, i)
+			} else if seen[name] {
+				err = fmt.Errorf("duplicate rule name: %s", name)
+			}
+			seen[name] = true
+		}
+	})
+	return err
+}
+
+// Calls fn with the names of the rules of each type, in a fixed order.
+func (r *RuleSet) eachRuleType(fn func(typ string, names []string)) {
+	fn("post", namesOf(r.PostRules))
+	fn("profile", namesOf(r.ProfileRules))
+	fn("list", namesOf(r.ListRules))
+	fn("feedgen", namesOf(r.FeedGenRules))
+	fn("record", namesOf(r.RecordRules))
+	fn("recordDelete", namesOf(r.RecordDeleteRules))
+	fn("identity", namesOf(r.IdentityRules))
+	fn("account", namesOf(r.AccountRules))
+	fn("ozoneEvent", namesOf(r.OzoneEventRules))
+	fn("blob", namesOf(r.BlobRules))
+}
+
+func namesOf[F any](rules []NamedRule[F]) []string {
+	var names []string
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+	}
+	return names
+}
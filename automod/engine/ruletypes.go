@@ -2,9 +2,33 @@ package engine
 
 import (
 	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
 )
 
 type IdentityRuleFunc = func(c *AccountContext) error
+type AccountRuleFunc = func(c *AccountEventContext) error
+type OzoneEventRuleFunc = func(c *OzoneEventContext) error
 type RecordRuleFunc = func(c *RecordContext) error
 type PostRuleFunc = func(c *RecordContext, post *appbsky.FeedPost) error
 type ProfileRuleFunc = func(c *RecordContext, profile *appbsky.ActorProfile) error
+type ListRuleFunc = func(c *RecordContext, list *appbsky.GraphList) error
+type FeedGenRuleFunc = func(c *RecordContext, feedgen *appbsky.FeedGenerator) error
+
+// Invoked with each blob (eg, image) referenced by a new record, along with the fetched blob data.
+type BlobRuleFunc = func(c *RecordContext, blob lexutil.LexBlob, data []byte) error
+
+// A rule function, along with the name which identifies it in metrics, rule toggles, rules configuration and the admin API. Names should be stable across releases (usually the Go function name, like "KeywordPostRule"), and must be unique within a RuleSet.
+type NamedRule[F any] struct {
+	Name string
+	Func F
+}
+
+type IdentityRule = NamedRule[IdentityRuleFunc]
+type AccountRule = NamedRule[AccountRuleFunc]
+type OzoneEventRule = NamedRule[OzoneEventRuleFunc]
+type RecordRule = NamedRule[RecordRuleFunc]
+type PostRule = NamedRule[PostRuleFunc]
+type ProfileRule = NamedRule[ProfileRuleFunc]
+type ListRule = NamedRule[ListRuleFunc]
+type FeedGenRule = NamedRule[FeedGenRuleFunc]
+type BlobRule = NamedRule[BlobRuleFunc]
@@ -0,0 +1,223 @@
+package engine
+
+import (
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var shadowActions = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_shadow_actions",
+	Help: "Number of moderation actions which would have been taken by rules running in shadow mode, by type",
+}, []string{"type"})
+
+// Prefix added to the name of rules wrapped with ShadowPostRule (etc), so that shadowed rules can be told apart from live rules in metrics and the admin API.
+const ShadowRulePrefix = "shadow:"
+
+// Runs a post rule in "shadow" mode: any moderation actions (labels, flags, reports, takedowns) it takes are recorded to the shadow log and metrics, instead of being persisted. Counters are still incremented. Useful for trialing new rules.
+//
+// The returned rule is named with ShadowRulePrefix (eg, "shadow:KeywordPostRule").
+func ShadowPostRule(rule PostRule) PostRule {
+	f := rule.Func
+	return PostRule{Name: ShadowRulePrefix + rule.Name, Func: func(c *RecordContext, post *appbsky.FeedPost) error {
+		m := c.effects.mark()
+		defer c.effects.shadowSince(m)
+		return f(c, post)
+	}}
+}
+
+// Same as ShadowPostRule, for profile rules.
+func ShadowProfileRule(rule ProfileRule) ProfileRule {
+	f := rule.Func
+	return ProfileRule{Name: ShadowRulePrefix + rule.Name, Func: func(c *RecordContext, profile *appbsky.ActorProfile) error {
+		m := c.effects.mark()
+		defer c.effects.shadowSince(m)
+		return f(c, profile)
+	}}
+}
+
+// Same as ShadowPostRule, for list rules.
+func ShadowListRule(rule ListRule) ListRule {
+	f := rule.Func
+	return ListRule{Name: ShadowRulePrefix + rule.Name, Func: func(c *RecordContext, list *appbsky.GraphList) error {
+		m := c.effects.mark()
+		defer c.effects.shadowSince(m)
+		return f(c, list)
+	}}
+}
+
+// Same as ShadowPostRule, for feed generator rules.
+func ShadowFeedGenRule(rule FeedGenRule) FeedGenRule {
+	f := rule.Func
+	return FeedGenRule{Name: ShadowRulePrefix + rule.Name, Func: func(c *RecordContext, feedgen *appbsky.FeedGenerator) error {
+		m := c.effects.mark()
+		defer c.effects.shadowSince(m)
+		return f(c, feedgen)
+	}}
+}
+
+// Same as ShadowPostRule, for generic record (and record delete) rules.
+func ShadowRecordRule(rule RecordRule) RecordRule {
+	f := rule.Func
+	return RecordRule{Name: ShadowRulePrefix + rule.Name, Func: func(c *RecordContext) error {
+		m := c.effects.mark()
+		defer c.effects.shadowSince(m)
+		return f(c)
+	}}
+}
+
+// Same as ShadowPostRule, for blob rules.
+func ShadowBlobRule(rule BlobRule) BlobRule {
+	f := rule.Func
+	return BlobRule{Name: ShadowRulePrefix + rule.Name, Func: func(c *RecordContext, blob lexutil.LexBlob, data []byte) error {
+		m := c.effects.mark()
+		defer c.effects.shadowSince(m)
+		return f(c, blob, data)
+	}}
+}
+
+// Same as ShadowPostRule, for identity rules.
+func ShadowIdentityRule(rule IdentityRule) IdentityRule {
+	f := rule.Func
+	return IdentityRule{Name: ShadowRulePrefix + rule.Name, Func: func(c *AccountContext) error {
+		m := c.effects.mark()
+		defer c.effects.shadowSince(m)
+		return f(c)
+	}}
+}
+
+// Same as ShadowPostRule, for account status rules.
+func ShadowAccountRule(rule AccountRule) AccountRule {
+	f := rule.Func
+	return AccountRule{Name: ShadowRulePrefix + rule.Name, Func: func(c *AccountEventContext) error {
+		m := c.effects.mark()
+		defer c.effects.shadowSince(m)
+		return f(c)
+	}}
+}
+
+// Same as ShadowPostRule, for moderation event rules.
+func ShadowOzoneEventRule(rule OzoneEventRule) OzoneEventRule {
+	f := rule.Func
+	return OzoneEventRule{Name: ShadowRulePrefix + rule.Name, Func: func(c *OzoneEventContext) error {
+		m := c.effects.mark()
+		defer c.effects.shadowSince(m)
+		return f(c)
+	}}
+}
+
+// Position in the (append-only) moderation action fields of an Effects.
+type effectsMark struct {
+	accountLabels   int
+	accountFlags    int
+	removedFlags    int
+	accountReports  int
+	accountTakedown bool
+	recordLabels    int
+	recordFlags     int
+	recordReports   int
+	recordTakedown  bool
+}
+
+func (e *Effects) mark() effectsMark {
+	return effectsMark{
+		accountLabels:   len(e.AccountLabels),
+		accountFlags:    len(e.AccountFlags),
+		removedFlags:    len(e.RemovedAccountFlags),
+		accountReports:  len(e.AccountReports),
+		accountTakedown: e.AccountTakedown,
+		recordLabels:    len(e.RecordLabels),
+		recordFlags:     len(e.RecordFlags),
+		recordReports:   len(e.RecordReports),
+		recordTakedown:  e.RecordTakedown,
+	}
+}
+
+// Returns the shadow effects, allocating them if needed.
+func (e *Effects) shadow() *Effects {
+	if e.Shadow == nil {
+		e.Shadow = &Effects{}
+	}
+	return e.Shadow
+}
+
+// Moves any moderation actions added after the mark in to the shadow effects.
+func (e *Effects) shadowSince(m effectsMark) {
+	s := e.shadow()
+	s.AccountLabels = append(s.AccountLabels, e.AccountLabels[m.accountLabels:]...)
+	e.AccountLabels = e.AccountLabels[:m.accountLabels]
+	s.AccountFlags = append(s.AccountFlags, e.AccountFlags[m.accountFlags:]...)
+	e.AccountFlags = e.AccountFlags[:m.accountFlags]
+	s.RemovedAccountFlags = append(s.RemovedAccountFlags, e.RemovedAccountFlags[m.removedFlags:]...)
+	e.RemovedAccountFlags = e.RemovedAccountFlags[:m.removedFlags]
+	s.AccountReports = append(s.AccountReports, e.AccountReports[m.accountReports:]...)
+	e.AccountReports = e.AccountReports[:m.accountReports]
+	if e.AccountTakedown && !m.accountTakedown {
+		s.AccountTakedown = true
+		e.AccountTakedown = false
+	}
+	s.RecordLabels = append(s.RecordLabels, e.RecordLabels[m.recordLabels:]...)
+	e.RecordLabels = e.RecordLabels[:m.recordLabels]
+	s.RecordFlags = append(s.RecordFlags, e.RecordFlags[m.recordFlags:]...)
+	e.RecordFlags = e.RecordFlags[:m.recordFlags]
+	s.RecordReports = append(s.RecordReports, e.RecordReports[m.recordReports:]...)
+	e.RecordReports = e.RecordReports[:m.recordReports]
+	if e.RecordTakedown && !m.recordTakedown {
+		s.RecordTakedown = true
+		e.RecordTakedown = false
+	}
+}
+
+// Records any shadowed moderation actions to the shadow log and metrics. If the engine as a whole is in shadow mode (including because the action rate limiter has tripped), all actions are shadowed first. "attrs" identify the event (eg, DID and record URI) in the shadow log.
+func (eng *Engine) processShadowActions(e *Effects, attrs ...any) {
+	if eng.Shadow || eng.ActionLimiter.Tripped() {
+		e.shadowSince(effectsMark{})
+	}
+	s := e.Shadow
+	if s == nil {
+		return
+	}
+	counts := map[string]int{
+		"account-label":        len(s.AccountLabels),
+		"account-flag":         len(s.AccountFlags),
+		"account-flag-removal": len(s.RemovedAccountFlags),
+		"account-report":       len(s.AccountReports),
+		"record-label":         len(s.RecordLabels),
+		"record-flag":          len(s.RecordFlags),
+		"record-report":        len(s.RecordReports),
+	}
+	if s.AccountTakedown {
+		counts["account-takedown"] = 1
+	}
+	if s.RecordTakedown {
+		counts["record-takedown"] = 1
+	}
+	total := 0
+	for typ, n := range counts {
+		if n > 0 {
+			shadowActions.WithLabelValues(typ).Add(float64(n))
+			total += n
+		}
+	}
+	if total == 0 {
+		return
+	}
+
+	logger := eng.ShadowLogger
+	if logger == nil {
+		logger = eng.Logger
+	}
+	logger.With(attrs...).Info("shadow-moderation-actions",
+		"accountLabels", s.AccountLabels,
+		"accountFlags", s.AccountFlags,
+		"removedAccountFlags", s.RemovedAccountFlags,
+		"accountReports", s.AccountReports,
+		"accountTakedown", s.AccountTakedown,
+		"recordLabels", s.RecordLabels,
+		"recordFlags", s.RecordFlags,
+		"recordReports", s.RecordReports,
+		"recordTakedown", s.RecordTakedown,
+	)
+}
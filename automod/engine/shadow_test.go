@@ -0,0 +1,115 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func flagEveryPostRule(c *RecordContext, post *appbsky.FeedPost) error {
+	c.AddAccountFlag("trial-flag")
+	c.AddRecordLabel("trial-label")
+	c.TakedownRecord()
+	return nil
+}
+
+func TestShadowRules(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	did := syntax.DID("did:plc:abc111")
+	cid1 := syntax.CID("cid123")
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        did,
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		Value:      &appbsky.FeedPost{Text: "some post blah", Tags: []string{"slur"}},
+	}
+	am := AccountMeta{Identity: &identity.Identity{DID: did, Handle: syntax.Handle("handle.example.com")}}
+
+	// a single shadow rule, alongside a regular rule
+	eng := EngineTestFixture()
+	eng.Rules.PostRules = append(eng.Rules.PostRules, ShadowPostRule(PostRule{Name: "flagEveryPostRule", Func: flagEveryPostRule}))
+	rc := NewRecordContext(ctx, &eng, am, op)
+	assert.NoError(eng.Rules.CallRecordRules(&rc))
+	eff := ExtractEffects(&rc.BaseContext)
+	assert.Equal([]string{"bad-hashtag"}, eff.RecordLabels)
+	assert.Empty(eff.AccountFlags)
+	assert.False(eff.RecordTakedown)
+	assert.NotNil(eff.Shadow)
+	assert.Equal([]string{"trial-flag"}, eff.Shadow.AccountFlags)
+	assert.Equal([]string{"trial-label"}, eff.Shadow.RecordLabels)
+	assert.True(eff.Shadow.RecordTakedown)
+	assert.Equal(map[string][]string{"post": {"simpleRule", "shadow:flagEveryPostRule"}}, eng.Rules.RuleNames())
+
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+	flags, err := eng.Flags.Get(ctx, did.String())
+	assert.NoError(err)
+	assert.Empty(flags)
+
+	// the whole engine in shadow mode
+	eng = EngineTestFixture()
+	eng.Shadow = true
+	eng.Rules.PostRules = append(eng.Rules.PostRules, PostRule{Name: "flagEveryPostRule", Func: flagEveryPostRule})
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+	flags, err = eng.Flags.Get(ctx, did.String())
+	assert.NoError(err)
+	assert.Empty(flags)
+	flags, err = eng.Flags.Get(ctx, op.ATURI().String())
+	assert.NoError(err)
+	assert.Empty(flags)
+
+	// shadow rule sets
+	eng = EngineTestFixture()
+	eng.RuleSets = []NamedRuleSet{{
+		Name:   "trial",
+		Rules:  RuleSet{PostRules: []PostRule{{Name: "flagEveryPostRule", Func: flagEveryPostRule}}},
+		Shadow: true,
+	}}
+	rc = NewRecordContext(ctx, &eng, am, op)
+	eng.callRuleSetsRecord(&rc)
+	eff = ExtractEffects(&rc.BaseContext)
+	assert.Empty(eff.AccountFlags)
+	assert.NotNil(eff.Shadow)
+	assert.Equal([]string{"trial:trial-flag"}, eff.Shadow.AccountFlags)
+	// not permitted by the rule set's policy
+	assert.Empty(eff.Shadow.RecordLabels)
+	assert.False(eff.Shadow.RecordTakedown)
+}
+
+func TestShadowListRule(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	did := syntax.DID("did:plc:abc111")
+	cid1 := syntax.CID("cid123")
+	op := RecordOp{
+		Action:     CreateOp,
+		DID:        did,
+		Collection: syntax.NSID("app.bsky.graph.list"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		Value:      &appbsky.GraphList{Name: "some list"},
+	}
+	am := AccountMeta{Identity: &identity.Identity{DID: did, Handle: syntax.Handle("handle.example.com")}}
+
+	flagEveryListRule := func(c *RecordContext, list *appbsky.GraphList) error {
+		c.AddRecordFlag("trial-flag")
+		return nil
+	}
+	eng := EngineTestFixture()
+	eng.Rules = RuleSet{ListRules: []ListRule{ShadowListRule(ListRule{Name: "flagEveryListRule", Func: flagEveryListRule})}}
+	rc := NewRecordContext(ctx, &eng, am, op)
+	assert.NoError(eng.Rules.CallRecordRules(&rc))
+	eff := ExtractEffects(&rc.BaseContext)
+	assert.Empty(eff.RecordFlags)
+	assert.NotNil(eff.Shadow)
+	assert.Equal([]string{"trial-flag"}, eff.Shadow.RecordFlags)
+}
@@ -38,8 +38,8 @@ func simpleRule(c *RecordContext, post *appbsky.FeedPost) error {
 
 func EngineTestFixture() Engine {
 	rules := RuleSet{
-		PostRules: []PostRuleFunc{
-			simpleRule,
+		PostRules: []PostRule{
+			{Name: "simpleRule", Func: simpleRule},
 		},
 	}
 	cache := cachestore.NewMemCacheStore(10, time.Hour)
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"strings"
+)
+
+// Reputation of a domain, as returned by DomainReputation
+const (
+	DomainAllow   = "allow"
+	DomainDeny    = "deny"
+	DomainUnknown = "unknown"
+)
+
+// Resolves a link through any URL shortener services (see the urlresolve package), with results cached. Returns the original URL if the engine has no resolver configured, or if resolution fails (which is logged).
+func (c *BaseContext) ResolveURL(raw string) string {
+	if c.engine.URLResolver == nil {
+		return raw
+	}
+	cached, err := c.engine.Cache.Get(c.Ctx, "url", raw)
+	if err != nil {
+		c.Logger.Warn("URL cache lookup failed", "err", err)
+	} else if cached != "" {
+		return cached
+	}
+	out, err := c.engine.URLResolver.Resolve(c.Ctx, raw)
+	if err != nil {
+		c.Logger.Warn("failed to resolve URL", "url", raw, "err", err)
+		return raw
+	}
+	if err := c.engine.Cache.Set(c.Ctx, "url", raw, out); err != nil {
+		c.Logger.Warn("URL cache update failed", "err", err)
+	}
+	return out
+}
+
+// Looks up a domain (or hostname) in the domain allow and deny lists (the "domain-allow" and "domain-deny" sets), including parent domains: eg, "spam.example.com" matches "example.com". The allowlist takes precedence. Returns DomainAllow, DomainDeny, or DomainUnknown.
+func (c *BaseContext) DomainReputation(domain string) string {
+	domain = strings.TrimPrefix(strings.TrimSuffix(strings.ToLower(domain), "."), "www.")
+	if domain == "" {
+		return DomainUnknown
+	}
+	candidates := []string{}
+	for d := domain; strings.Contains(d, "."); d = d[strings.Index(d, ".")+1:] {
+		candidates = append(candidates, d)
+	}
+	for _, d := range candidates {
+		if c.InSet("domain-allow", d) {
+			return DomainAllow
+		}
+	}
+	for _, d := range candidates {
+		if c.InSet("domain-deny", d) {
+			return DomainDeny
+		}
+	}
+	return DomainUnknown
+}
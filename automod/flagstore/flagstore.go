@@ -2,10 +2,25 @@ package flagstore
 
 import (
 	"context"
+	"time"
 )
 
 type FlagStore interface {
 	Get(ctx context.Context, key string) ([]string, error)
 	Add(ctx context.Context, key string, flags []string) error
 	Remove(ctx context.Context, key string, flags []string) error
+	// Enumerates keys with any flags set, optionally filtered by key prefix. Pass an empty cursor to start; an empty returned cursor means there are no more results. The limit is a hint, and implementations may return somewhat more or fewer entries per page.
+	ListFlags(ctx context.Context, prefix, cursor string, limit int) ([]FlagEntry, string, error)
+}
+
+// All the flags set for a single key (usually an account DID).
+type FlagEntry struct {
+	Key   string `json:"key"`
+	Flags []Flag `json:"flags"`
+}
+
+type Flag struct {
+	Name string `json:"name"`
+	// When the flag was first added. May be zero for flags set before timestamps were tracked.
+	CreatedAt time.Time `json:"createdAt"`
 }
@@ -2,15 +2,21 @@ package flagstore
 
 import (
 	"context"
+	"sort"
+	"strings"
+	"time"
 )
 
 type MemFlagStore struct {
 	Data map[string][]string
+	// when each flag was added, by key then flag name
+	Times map[string]map[string]time.Time
 }
 
 func NewMemFlagStore() MemFlagStore {
 	return MemFlagStore{
-		Data: make(map[string][]string),
+		Data:  make(map[string][]string),
+		Times: make(map[string]map[string]time.Time),
 	}
 }
 
@@ -27,8 +33,17 @@ func (s MemFlagStore) Add(ctx context.Context, key string, flags []string) error
 	if !ok {
 		v = []string{}
 	}
+	t, ok := s.Times[key]
+	if !ok && s.Times != nil {
+		t = make(map[string]time.Time)
+		s.Times[key] = t
+	}
+	now := time.Now().UTC()
 	for _, f := range flags {
 		v = append(v, f)
+		if _, ok := t[f]; !ok && t != nil {
+			t[f] = now
+		}
 	}
 	v = dedupeStrings(v)
 	s.Data[key] = v
@@ -50,6 +65,7 @@ func (s MemFlagStore) Remove(ctx context.Context, key string, flags []string) er
 	}
 	for _, f := range flags {
 		delete(m, f)
+		delete(s.Times[key], f)
 	}
 	out := []string{}
 	for f, _ := range m {
@@ -58,3 +74,31 @@ func (s MemFlagStore) Remove(ctx context.Context, key string, flags []string) er
 	s.Data[key] = out
 	return nil
 }
+
+// Returns entries in key order. The cursor is the last key returned.
+func (s MemFlagStore) ListFlags(ctx context.Context, prefix, cursor string, limit int) ([]FlagEntry, string, error) {
+	keys := []string{}
+	for k, v := range s.Data {
+		if len(v) > 0 && strings.HasPrefix(k, prefix) && k > cursor {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	more := false
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+		more = true
+	}
+	out := make([]FlagEntry, 0, len(keys))
+	for _, k := range keys {
+		entry := FlagEntry{Key: k}
+		for _, f := range s.Data[k] {
+			entry.Flags = append(entry.Flags, Flag{Name: f, CreatedAt: s.Times[k][f]})
+		}
+		out = append(out, entry)
+	}
+	if !more {
+		return out, "", nil
+	}
+	return out, keys[len(keys)-1], nil
+}
@@ -2,12 +2,19 @@ package flagstore
 
 import (
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
 var redisFlagsPrefix string = "flags/"
 
+// hash of flag name to unix timestamp (seconds) of when the flag was first added
+var redisFlagTimesPrefix string = "flagtimes/"
+
 type RedisFlagStore struct {
 	Client *redis.Client
 }
@@ -49,7 +56,16 @@ func (s *RedisFlagStore) Add(ctx context.Context, key string, flags []string) er
 		l = append(l, v)
 	}
 	rkey := redisFlagsPrefix + key
-	return s.Client.SAdd(ctx, rkey, l...).Err()
+	tkey := redisFlagTimesPrefix + key
+	now := time.Now().Unix()
+	_, err := s.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, rkey, l...)
+		for _, f := range flags {
+			pipe.HSetNX(ctx, tkey, f, now)
+		}
+		return nil
+	})
+	return err
 }
 
 func (s *RedisFlagStore) Remove(ctx context.Context, key string, flags []string) error {
@@ -61,5 +77,73 @@ func (s *RedisFlagStore) Remove(ctx context.Context, key string, flags []string)
 		l = append(l, v)
 	}
 	rkey := redisFlagsPrefix + key
-	return s.Client.SRem(ctx, rkey, l...).Err()
+	tkey := redisFlagTimesPrefix + key
+	_, err := s.Client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SRem(ctx, rkey, l...)
+		pipe.HDel(ctx, tkey, flags...)
+		return nil
+	})
+	return err
+}
+
+// Uses redis SCAN, so the cursor is opaque, results are not ordered, and a key may be returned more than once if modified during iteration.
+func (s *RedisFlagStore) ListFlags(ctx context.Context, prefix, cursor string, limit int) ([]FlagEntry, string, error) {
+	var scanCursor uint64
+	if cursor != "" {
+		c, err := strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid flag list cursor: %s", cursor)
+		}
+		scanCursor = c
+	}
+	if limit <= 0 {
+		limit = 100
+	}
+	match := redisFlagsPrefix + escapeGlob(prefix) + "*"
+	rkeys, next, err := s.Client.Scan(ctx, scanCursor, match, int64(limit)).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	out := []FlagEntry{}
+	for _, rkey := range rkeys {
+		key := strings.TrimPrefix(rkey, redisFlagsPrefix)
+		names, err := s.Client.SMembers(ctx, rkey).Result()
+		if err != nil {
+			return nil, "", err
+		}
+		if len(names) == 0 {
+			continue
+		}
+		times, err := s.Client.HGetAll(ctx, redisFlagTimesPrefix+key).Result()
+		if err != nil {
+			return nil, "", err
+		}
+		entry := FlagEntry{Key: key}
+		for _, name := range names {
+			f := Flag{Name: name}
+			if ts, err := strconv.ParseInt(times[name], 10, 64); err == nil {
+				f.CreatedAt = time.Unix(ts, 0).UTC()
+			}
+			entry.Flags = append(entry.Flags, f)
+		}
+		out = append(out, entry)
+	}
+	if next == 0 {
+		return out, "", nil
+	}
+	return out, strconv.FormatUint(next, 10), nil
+}
+
+// escapes redis glob-style pattern characters
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
 }
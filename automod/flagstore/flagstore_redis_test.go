@@ -31,5 +31,11 @@ func TestRedisFlagStoreBasics(t *testing.T) {
 	l, err = fs.Get(ctx, "test1")
 	assert.NoError(err)
 	assert.Equal([]string{"green"}, l)
+
+	l2, _, err := fs.ListFlags(ctx, "test1", "", 100)
+	assert.NoError(err)
+	assert.Equal(1, len(l2))
+	assert.Equal("green", l2[0].Flags[0].Name)
+	assert.False(l2[0].Flags[0].CreatedAt.IsZero())
 	assert.NoError(fs.Remove(ctx, "test1", []string{"green"}))
 }
@@ -28,3 +28,34 @@ func TestFlagStoreBasics(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal([]string{"green"}, l)
 }
+
+func TestFlagStoreList(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	fs := NewMemFlagStore()
+	assert.NoError(fs.Add(ctx, "did:plc:aaa", []string{"red"}))
+	assert.NoError(fs.Add(ctx, "did:plc:bbb", []string{"red", "green"}))
+	assert.NoError(fs.Add(ctx, "did:plc:ccc", []string{"blue"}))
+	assert.NoError(fs.Add(ctx, "did:web:example.com", []string{"blue"}))
+	assert.NoError(fs.Remove(ctx, "did:plc:ccc", []string{"blue"}))
+
+	l, cursor, err := fs.ListFlags(ctx, "did:plc:", "", 1)
+	assert.NoError(err)
+	assert.Equal(1, len(l))
+	assert.Equal("did:plc:aaa", l[0].Key)
+	assert.Equal("red", l[0].Flags[0].Name)
+	assert.False(l[0].Flags[0].CreatedAt.IsZero())
+	assert.Equal("did:plc:aaa", cursor)
+
+	l, cursor, err = fs.ListFlags(ctx, "did:plc:", cursor, 10)
+	assert.NoError(err)
+	assert.Equal(1, len(l))
+	assert.Equal("did:plc:bbb", l[0].Key)
+	assert.Equal(2, len(l[0].Flags))
+	assert.Equal("", cursor)
+
+	l, _, err = fs.ListFlags(ctx, "", "", 0)
+	assert.NoError(err)
+	assert.Equal(3, len(l))
+}
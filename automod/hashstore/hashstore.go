@@ -0,0 +1,17 @@
+package hashstore
+
+import (
+	"context"
+)
+
+// Stores hashes of known blobs (eg, known-bad images), each associated with a short tag describing the match (eg, "spam-image"), for matching against blobs seen in the firehose.
+//
+// Two kinds of hashes are supported: exact SHA-256 hashes (lower-case hex), and 64-bit perceptual hashes (see PerceptualHash), which match visually similar images within a maximum Hamming distance.
+//
+// The match methods return the tag of the matching entry, or an empty string if there was no match.
+type HashStore interface {
+	MatchSHA256(ctx context.Context, hash string) (string, error)
+	MatchPerceptual(ctx context.Context, hash uint64, maxDistance int) (string, error)
+	AddSHA256(ctx context.Context, hash, tag string) error
+	AddPerceptual(ctx context.Context, hash uint64, tag string) error
+}
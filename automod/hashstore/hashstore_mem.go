@@ -0,0 +1,46 @@
+package hashstore
+
+import (
+	"context"
+	"sync"
+)
+
+type MemHashStore struct {
+	lk         sync.RWMutex
+	sha256     map[string]string
+	perceptual map[uint64]string
+}
+
+func NewMemHashStore() *MemHashStore {
+	return &MemHashStore{
+		sha256:     make(map[string]string),
+		perceptual: make(map[uint64]string),
+	}
+}
+
+func (s *MemHashStore) MatchSHA256(ctx context.Context, hash string) (string, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	return s.sha256[hash], nil
+}
+
+// Linear scan over all perceptual hashes; returns the closest match.
+func (s *MemHashStore) MatchPerceptual(ctx context.Context, hash uint64, maxDistance int) (string, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+	return closestPerceptual(hash, maxDistance, s.perceptual), nil
+}
+
+func (s *MemHashStore) AddSHA256(ctx context.Context, hash, tag string) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.sha256[hash] = tag
+	return nil
+}
+
+func (s *MemHashStore) AddPerceptual(ctx context.Context, hash uint64, tag string) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.perceptual[hash] = tag
+	return nil
+}
@@ -0,0 +1,67 @@
+package hashstore
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var redisSHA256Key string = "hashes/sha256"
+var redisPerceptualKey string = "hashes/perceptual"
+
+// Stores each kind of hash in a single redis hash. Perceptual matching fetches every perceptual hash and does a linear scan, so is only suitable for modest numbers of entries (thousands).
+type RedisHashStore struct {
+	Client *redis.Client
+}
+
+func NewRedisHashStore(redisURL string) (*RedisHashStore, error) {
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	rdb := redis.NewClient(opt)
+	// check redis connection
+	_, err = rdb.Ping(context.TODO()).Result()
+	if err != nil {
+		return nil, err
+	}
+	rhs := RedisHashStore{
+		Client: rdb,
+	}
+	return &rhs, nil
+}
+
+func (s *RedisHashStore) MatchSHA256(ctx context.Context, hash string) (string, error) {
+	tag, err := s.Client.HGet(ctx, redisSHA256Key, hash).Result()
+	if err == redis.Nil {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return tag, nil
+}
+
+func (s *RedisHashStore) MatchPerceptual(ctx context.Context, hash uint64, maxDistance int) (string, error) {
+	all, err := s.Client.HGetAll(ctx, redisPerceptualKey).Result()
+	if err != nil {
+		return "", err
+	}
+	hashes := make(map[uint64]string, len(all))
+	for k, tag := range all {
+		h, err := strconv.ParseUint(k, 16, 64)
+		if err != nil {
+			continue
+		}
+		hashes[h] = tag
+	}
+	return closestPerceptual(hash, maxDistance, hashes), nil
+}
+
+func (s *RedisHashStore) AddSHA256(ctx context.Context, hash, tag string) error {
+	return s.Client.HSet(ctx, redisSHA256Key, hash, tag).Err()
+}
+
+func (s *RedisHashStore) AddPerceptual(ctx context.Context, hash uint64, tag string) error {
+	return s.Client.HSet(ctx, redisPerceptualKey, strconv.FormatUint(hash, 16), tag).Err()
+}
@@ -0,0 +1,80 @@
+package hashstore
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Renders a horizontal gradient (optionally reversed) as PNG.
+func gradientPNG(t *testing.T, w, h int, reverse bool) []byte {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := uint8(x * 255 / w)
+			if reverse {
+				v = 255 - v
+			}
+			img.SetGray(x, y, color.Gray{Y: v})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPerceptualHash(t *testing.T) {
+	assert := assert.New(t)
+
+	small, err := PerceptualHash(gradientPNG(t, 90, 80, false))
+	assert.NoError(err)
+	large, err := PerceptualHash(gradientPNG(t, 450, 400, false))
+	assert.NoError(err)
+	reversed, err := PerceptualHash(gradientPNG(t, 90, 80, true))
+	assert.NoError(err)
+
+	// resized copies of the same image are near-identical
+	assert.LessOrEqual(HammingDistance(small, large), 4)
+	assert.Greater(HammingDistance(small, reversed), 32)
+
+	_, err = PerceptualHash([]byte("not an image"))
+	assert.Error(err)
+
+	// images over the pixel limit are rejected before decoding
+	defer func(n int) { MaxImagePixels = n }(MaxImagePixels)
+	MaxImagePixels = 450 * 399
+	_, err = PerceptualHash(gradientPNG(t, 450, 400, false))
+	assert.Error(err)
+}
+
+func TestMemHashStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	hs := NewMemHashStore()
+
+	sum := SHA256([]byte("known bad"))
+	tag, err := hs.MatchSHA256(ctx, sum)
+	assert.NoError(err)
+	assert.Empty(tag)
+	assert.NoError(hs.AddSHA256(ctx, sum, "spam-image"))
+	tag, err = hs.MatchSHA256(ctx, sum)
+	assert.NoError(err)
+	assert.Equal("spam-image", tag)
+
+	assert.NoError(hs.AddPerceptual(ctx, 0xFF00FF00FF00FF00, "far"))
+	assert.NoError(hs.AddPerceptual(ctx, 0x00000000000000FF, "near"))
+	tag, err = hs.MatchPerceptual(ctx, 0x000000000000000F, 4)
+	assert.NoError(err)
+	assert.Equal("near", tag)
+	tag, err = hs.MatchPerceptual(ctx, 0x000000000000000F, 3)
+	assert.NoError(err)
+	assert.Empty(tag)
+}
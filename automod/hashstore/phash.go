@@ -0,0 +1,92 @@
+package hashstore
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math/bits"
+)
+
+// Lower-case hex-encoded SHA-256 hash of the data, as used for exact matching.
+func SHA256(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Images with more pixels than this (width times height) are not decoded for perceptual hashing
+var MaxImagePixels = 40 * 1000 * 1000
+
+// Computes a 64-bit perceptual "difference hash" (dHash) of an image (JPEG, PNG, or GIF). Visually similar images (eg, re-encoded or resized) have hashes with a small Hamming distance; a distance of up to about 10 bits is usually considered a match.
+//
+// The image is reduced to a 9x8 grid of average grayscale values, and each bit records whether a cell is brighter than its right-hand neighbor. Large images are sampled (nearest-neighbor) down to at most 16 pixels per grid cell in each direction before averaging, and images over MaxImagePixels are rejected without being decoded.
+func PerceptualHash(data []byte) (uint64, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("decoding image config: %w", err)
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > int64(MaxImagePixels) {
+		return 0, fmt.Errorf("image too large to hash (%dx%d)", cfg.Width, cfg.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("decoding image: %w", err)
+	}
+	b := img.Bounds()
+	if b.Dx() < 1 || b.Dy() < 1 {
+		return 0, fmt.Errorf("empty image")
+	}
+
+	const w, h = 9, 8
+	var sums [h][w]float64
+	var counts [h][w]int
+	// downscaled sample grid; the same as the full image if it is small enough
+	sw, sh := min(b.Dx(), 16*w), min(b.Dy(), 16*h)
+	for sy := 0; sy < sh; sy++ {
+		y := b.Min.Y + sy*b.Dy()/sh
+		cy := sy * h / sh
+		for sx := 0; sx < sw; sx++ {
+			x := b.Min.X + sx*b.Dx()/sw
+			cx := sx * w / sw
+			r, g, bl, _ := img.At(x, y).RGBA()
+			// ITU-R 601 luma
+			sums[cy][cx] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+			counts[cy][cx]++
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			left := sums[y][x] / float64(max(counts[y][x], 1))
+			right := sums[y][x+1] / float64(max(counts[y][x+1], 1))
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return hash, nil
+}
+
+// Number of differing bits between two perceptual hashes.
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Returns the tag of the closest hash within maxDistance, or an empty string.
+func closestPerceptual(hash uint64, maxDistance int, hashes map[uint64]string) string {
+	best := ""
+	bestDist := maxDistance + 1
+	for h, tag := range hashes {
+		if d := HammingDistance(hash, h); d < bestDist {
+			best = tag
+			bestDist = d
+		}
+	}
+	return best
+}
@@ -0,0 +1,176 @@
+// Lightweight, heuristic natural language detection for short texts (like posts), with no external model or dependencies.
+//
+// Languages with a distinctive writing system (eg, Japanese, Korean, Greek) are detected by script. Languages using the Latin script are detected by matching very common words ("stopwords"), which works reasonably well for sentences, but not for very short texts or single words. Languages are identified by ISO 639-1 codes (eg, "en", "ja").
+package langdetect
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// minimum number of stopword matches for a Latin-script language to be detected
+const minStopwordHits = 2
+
+// Detects the languages of the text, returned in order of confidence. Returns an empty list if the language could not be determined (eg, the text is too short, or has no letters).
+func Detect(text string) []string {
+	script, letters := dominantScript(text)
+	if letters == 0 {
+		return []string{}
+	}
+	switch script {
+	case "":
+		return []string{}
+	case "Latin":
+		return detectLatin(text)
+	case "Cyrillic":
+		return []string{detectCyrillic(text)}
+	case "Arabic":
+		if strings.ContainsAny(text, "پچژگ") {
+			return []string{"fa"}
+		}
+		return []string{"ar"}
+	default:
+		if lang, ok := scriptLanguages[script]; ok {
+			return []string{lang}
+		}
+	}
+	return []string{}
+}
+
+// Returns whether the text could plausibly be in the given language, based on the script of the text. For example, text entirely in the Latin script is not plausibly Japanese. Texts with no letters, and unknown languages, are always plausible.
+func Plausible(text, lang string) bool {
+	lang = Base(lang)
+	script, letters := dominantScript(text)
+	if letters == 0 || script == "" {
+		return true
+	}
+	want, ok := languageScripts[lang]
+	if !ok {
+		return true
+	}
+	if script == "Han" && lang == "ja" {
+		// Japanese text can be written mostly with kanji
+		return true
+	}
+	return script == want
+}
+
+// Normalizes a language tag (eg, "en-US" or "PT_br") to its lower-case primary language subtag (eg, "en", "pt").
+func Base(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag
+}
+
+var scripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Greek", unicode.Greek},
+	{"Arabic", unicode.Arabic},
+	{"Hebrew", unicode.Hebrew},
+	{"Hangul", unicode.Hangul},
+	{"Hiragana", unicode.Hiragana},
+	{"Katakana", unicode.Katakana},
+	{"Han", unicode.Han},
+	{"Thai", unicode.Thai},
+	{"Devanagari", unicode.Devanagari},
+	{"Georgian", unicode.Georgian},
+	{"Armenian", unicode.Armenian},
+}
+
+// languages which are (nearly) the only user of a script, for the purpose of detection
+var scriptLanguages = map[string]string{
+	"Greek":      "el",
+	"Hebrew":     "he",
+	"Hangul":     "ko",
+	"Hiragana":   "ja",
+	"Katakana":   "ja",
+	"Han":        "zh",
+	"Thai":       "th",
+	"Devanagari": "hi",
+	"Georgian":   "ka",
+	"Armenian":   "hy",
+}
+
+// primary script for each language which can be detected
+var languageScripts = map[string]string{
+	"en": "Latin", "es": "Latin", "pt": "Latin", "fr": "Latin", "de": "Latin", "it": "Latin", "nl": "Latin", "pl": "Latin", "tr": "Latin", "id": "Latin",
+	"ru": "Cyrillic", "uk": "Cyrillic",
+	"ar": "Arabic", "fa": "Arabic",
+	"el": "Greek", "he": "Hebrew", "ko": "Hangul", "ja": "Hiragana", "zh": "Han", "th": "Thai", "hi": "Devanagari", "ka": "Georgian", "hy": "Armenian",
+}
+
+// Returns the script with the most letters in the text, and the total number of letters. Japanese kana take priority over Han characters, since Japanese text mixes the two.
+func dominantScript(text string) (string, int) {
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, s := range scripts {
+			if unicode.Is(s.table, r) {
+				counts[s.name]++
+				break
+			}
+		}
+	}
+	kana := counts["Hiragana"] + counts["Katakana"]
+	if kana > 0 && kana+counts["Han"] >= counts["Latin"] {
+		return "Hiragana", letters
+	}
+	best, bestCount := "", 0
+	for _, s := range scripts {
+		if counts[s.name] > bestCount {
+			best, bestCount = s.name, counts[s.name]
+		}
+	}
+	return best, letters
+}
+
+func detectCyrillic(text string) string {
+	// letters used in Ukrainian but not Russian
+	if strings.ContainsAny(strings.ToLower(text), "іїєґ") {
+		return "uk"
+	}
+	return "ru"
+}
+
+func detectLatin(text string) []string {
+	tokens := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+	scores := make(map[string]int)
+	for _, tok := range tokens {
+		for _, lang := range stopwordLangs[tok] {
+			scores[lang]++
+		}
+	}
+	out := []string{}
+	for lang, n := range scores {
+		if n >= minStopwordHits {
+			out = append(out, lang)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if scores[out[i]] != scores[out[j]] {
+			return scores[out[i]] > scores[out[j]]
+		}
+		return out[i] < out[j]
+	})
+	// only keep languages which are reasonably close to the best match
+	for i, lang := range out {
+		if scores[lang]*2 < scores[out[0]] {
+			out = out[:i]
+			break
+		}
+	}
+	return out
+}
@@ -0,0 +1,59 @@
+package langdetect
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetect(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		text string
+		lang string
+	}{
+		{"this is a test of the language detection, and it should work", "en"},
+		{"el perro está en la casa y no quiere salir porque hace frío", "es"},
+		{"eu não sei o que fazer com isso, mas está muito bom", "pt"},
+		{"je ne sais pas ce que c'est, mais c'est très bien pour nous", "fr"},
+		{"ich weiß nicht, was das ist, aber es ist sehr gut", "de"},
+		{"non so che cosa sia, ma è molto bello anche questo", "it"},
+		{"ik weet niet wat het is, maar het is ook een mooi ding", "nl"},
+		{"今日はとても良い天気ですね", "ja"},
+		{"오늘 날씨가 정말 좋네요", "ko"},
+		{"今天天气很好", "zh"},
+		{"Сегодня очень хорошая погода", "ru"},
+		{"Сьогодні дуже гарна погода, і я щасливий", "uk"},
+		{"Σήμερα ο καιρός είναι πολύ καλός", "el"},
+		{"الطقس جميل اليوم", "ar"},
+		{"שלום עולם", "he"},
+	}
+	for _, f := range fixtures {
+		out := Detect(f.text)
+		if assert.NotEmpty(out, f.text) {
+			assert.Equal(f.lang, out[0], f.text)
+		}
+	}
+
+	assert.Empty(Detect(""))
+	assert.Empty(Detect("123 !!! 🎉"))
+	// too short to tell
+	assert.Empty(Detect("hello"))
+}
+
+func TestPlausible(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.True(Plausible("hello", "en"))
+	assert.True(Plausible("hello", "en-US"))
+	assert.False(Plausible("hello", "ja"))
+	assert.True(Plausible("今日は", "ja"))
+	assert.True(Plausible("日本語", "ja"))
+	assert.False(Plausible("今日は", "en"))
+	assert.True(Plausible("🎉", "ja"))
+	assert.True(Plausible("hello", "xx"))
+
+	assert.Equal("pt", Base("PT_br"))
+	assert.Equal("en", Base("en-US"))
+}
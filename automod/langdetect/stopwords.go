@@ -0,0 +1,26 @@
+package langdetect
+
+// Very common words for each Latin-script language. Words which are common in several of these languages (like "a" or "de") are mostly left out, since they don't help distinguish languages.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "was", "were", "this", "that", "with", "you", "have", "has", "for", "not", "but", "what", "just", "they", "from", "will", "would", "your", "about", "it's", "i'm", "don't", "of", "to", "be", "my", "it", "on", "in"},
+	"es": {"el", "los", "las", "del", "que", "por", "para", "con", "una", "pero", "como", "más", "está", "esto", "muy", "también", "porque", "cuando", "hay", "yo", "es", "lo", "y", "se", "mi"},
+	"pt": {"o", "os", "que", "não", "uma", "para", "com", "mais", "mas", "como", "você", "isso", "muito", "também", "porque", "quando", "está", "eu", "é", "do", "da", "em", "um", "meu"},
+	"fr": {"le", "les", "des", "est", "et", "une", "pour", "pas", "dans", "qui", "sur", "avec", "mais", "c'est", "je", "vous", "nous", "très", "aussi", "parce", "quand", "il", "du", "au", "ce"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "mit", "sie", "auf", "für", "ein", "eine", "auch", "aber", "wie", "wenn", "noch", "sehr", "schon", "mir", "den", "dem", "zu", "es"},
+	"it": {"il", "che", "della", "non", "per", "una", "sono", "anche", "questo", "ma", "come", "più", "perché", "quando", "molto", "gli", "ho", "è", "di", "mi", "lo", "ci"},
+	"nl": {"het", "een", "van", "niet", "ik", "maar", "ook", "zijn", "wat", "dat", "met", "voor", "je", "nog", "als", "heb", "er", "op", "deze", "naar"},
+	"pl": {"nie", "jest", "się", "że", "na", "jak", "ale", "to", "co", "tak", "już", "czy", "mnie", "tylko", "jestem", "bardzo", "dla", "ten", "przez"},
+	"tr": {"ve", "bir", "bu", "da", "de", "için", "çok", "ne", "ama", "gibi", "daha", "ben", "sen", "mı", "mi", "var", "yok", "olan", "değil"},
+	"id": {"yang", "dan", "di", "ini", "itu", "dengan", "untuk", "tidak", "ada", "saya", "aku", "kamu", "juga", "dari", "akan", "sudah", "bisa", "karena"},
+}
+
+// index from word to the languages it is common in
+var stopwordLangs = func() map[string][]string {
+	m := make(map[string][]string)
+	for lang, words := range stopwords {
+		for _, w := range words {
+			m[w] = append(m[w], lang)
+		}
+	}
+	return m
+}()
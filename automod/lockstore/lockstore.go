@@ -0,0 +1,16 @@
+package lockstore
+
+import (
+	"context"
+	"time"
+)
+
+// Coordinates multiple automod instances processing the same events (eg, a horizontally scaled deployment all consuming the same firehose), so that each moderation action is only emitted by a single instance.
+//
+// Keys are leased for a limited time: the first instance to acquire a key holds it until it expires or is released, and attempts by other instances fail in the meanwhile.
+type LockStore interface {
+	// Attempts to take a lease on the key. Returns false (not an error) if the key is already held by another instance.
+	Acquire(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Releases a lease held by this instance (eg, if the action failed, and can be retried by another instance). Does nothing if the key is not held by this instance.
+	Release(ctx context.Context, key string) error
+}
@@ -0,0 +1,45 @@
+package lockstore
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// In-process implementation, for tests and single-instance deployments.
+type MemLockStore struct {
+	mu     sync.Mutex
+	leases map[string]time.Time
+}
+
+func NewMemLockStore() *MemLockStore {
+	return &MemLockStore{
+		leases: make(map[string]time.Time),
+	}
+}
+
+func (s *MemLockStore) Acquire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if exp, ok := s.leases[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+	s.leases[key] = now.Add(ttl)
+	// opportunistically clean up expired leases, to bound memory use
+	if len(s.leases) > 10_000 {
+		for k, exp := range s.leases {
+			if !now.Before(exp) {
+				delete(s.leases, k)
+			}
+		}
+	}
+	return true, nil
+}
+
+func (s *MemLockStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.leases, key)
+	return nil
+}
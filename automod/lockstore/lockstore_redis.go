@@ -0,0 +1,56 @@
+package lockstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var redisLockPrefix string = "lock/"
+
+// only deletes the key if it still holds this instance's token
+var redisReleaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+type RedisLockStore struct {
+	Client *redis.Client
+	// Random value identifying this instance as the holder of leases
+	Token string
+}
+
+func NewRedisLockStore(redisURL string) (*RedisLockStore, error) {
+	opt, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	rdb := redis.NewClient(opt)
+	// check redis connection
+	_, err = rdb.Ping(context.TODO()).Result()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	rls := RedisLockStore{
+		Client: rdb,
+		Token:  hex.EncodeToString(b),
+	}
+	return &rls, nil
+}
+
+func (s *RedisLockStore) Acquire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return s.Client.SetNX(ctx, redisLockPrefix+key, s.Token, ttl).Result()
+}
+
+func (s *RedisLockStore) Release(ctx context.Context, key string) error {
+	return redisReleaseScript.Run(ctx, s.Client, []string{redisLockPrefix + key}, s.Token).Err()
+}
@@ -0,0 +1,66 @@
+package lockstore
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemLockStore(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	ls := NewMemLockStore()
+	ok, err := ls.Acquire(ctx, "abc", time.Hour)
+	assert.NoError(err)
+	assert.True(ok)
+	ok, err = ls.Acquire(ctx, "abc", time.Hour)
+	assert.NoError(err)
+	assert.False(ok)
+
+	assert.NoError(ls.Release(ctx, "abc"))
+	ok, err = ls.Acquire(ctx, "abc", time.Millisecond)
+	assert.NoError(err)
+	assert.True(ok)
+
+	// expired leases can be re-acquired
+	time.Sleep(2 * time.Millisecond)
+	ok, err = ls.Acquire(ctx, "abc", time.Hour)
+	assert.NoError(err)
+	assert.True(ok)
+}
+
+func TestRedisLockStore(t *testing.T) {
+	t.Skip("live test, need redis running locally")
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	ls1, err := NewRedisLockStore("redis://localhost:6379/0")
+	if err != nil {
+		t.Fail()
+	}
+	ls2, err := NewRedisLockStore("redis://localhost:6379/0")
+	if err != nil {
+		t.Fail()
+	}
+
+	ok, err := ls1.Acquire(ctx, "test1", time.Minute)
+	assert.NoError(err)
+	assert.True(ok)
+	ok, err = ls2.Acquire(ctx, "test1", time.Minute)
+	assert.NoError(err)
+	assert.False(ok)
+
+	// only the holder can release
+	assert.NoError(ls2.Release(ctx, "test1"))
+	ok, err = ls2.Acquire(ctx, "test1", time.Minute)
+	assert.NoError(err)
+	assert.False(ok)
+	assert.NoError(ls1.Release(ctx, "test1"))
+	ok, err = ls2.Acquire(ctx, "test1", time.Minute)
+	assert.NoError(err)
+	assert.True(ok)
+	assert.NoError(ls2.Release(ctx, "test1"))
+}
@@ -8,15 +8,40 @@ import (
 type Engine = engine.Engine
 type AccountMeta = engine.AccountMeta
 type RuleSet = engine.RuleSet
+type NamedRuleSet = engine.NamedRuleSet
+type EffectPolicy = engine.EffectPolicy
+type ActionLimits = engine.ActionLimits
+type ActionLimiter = engine.ActionLimiter
+type RuleMonitor = engine.RuleMonitor
+type RuleStats = engine.RuleStats
+type RuleTrigger = engine.RuleTrigger
+type RuleToggles = engine.RuleToggles
 
 type AccountContext = engine.AccountContext
 type RecordContext = engine.RecordContext
 type RecordOp = engine.RecordOp
+type OzoneEventContext = engine.OzoneEventContext
+type AccountEventContext = engine.AccountEventContext
 
 type IdentityRuleFunc = engine.IdentityRuleFunc
+type AccountRuleFunc = engine.AccountRuleFunc
+type OzoneEventRuleFunc = engine.OzoneEventRuleFunc
 type RecordRuleFunc = engine.RecordRuleFunc
 type PostRuleFunc = engine.PostRuleFunc
 type ProfileRuleFunc = engine.ProfileRuleFunc
+type ListRuleFunc = engine.ListRuleFunc
+type FeedGenRuleFunc = engine.FeedGenRuleFunc
+type BlobRuleFunc = engine.BlobRuleFunc
+
+type IdentityRule = engine.IdentityRule
+type AccountRule = engine.AccountRule
+type OzoneEventRule = engine.OzoneEventRule
+type RecordRule = engine.RecordRule
+type PostRule = engine.PostRule
+type ProfileRule = engine.ProfileRule
+type ListRule = engine.ListRule
+type FeedGenRule = engine.FeedGenRule
+type BlobRule = engine.BlobRule
 
 var (
 	ReportReasonSpam       = engine.ReportReasonSpam
@@ -30,7 +55,33 @@ var (
 	PeriodDay   = countstore.PeriodDay
 	PeriodHour  = countstore.PeriodHour
 
+	PeriodRolling1h  = countstore.PeriodRolling1h
+	PeriodRolling24h = countstore.PeriodRolling24h
+
 	CreateOp = engine.CreateOp
 	UpdateOp = engine.UpdateOp
 	DeleteOp = engine.DeleteOp
+
+	AccountEventType = engine.AccountEventType
+
+	DomainAllow   = engine.DomainAllow
+	DomainDeny    = engine.DomainDeny
+	DomainUnknown = engine.DomainUnknown
+
+	ShadowPostRule       = engine.ShadowPostRule
+	ShadowProfileRule    = engine.ShadowProfileRule
+	ShadowListRule       = engine.ShadowListRule
+	ShadowFeedGenRule    = engine.ShadowFeedGenRule
+	ShadowRecordRule     = engine.ShadowRecordRule
+	ShadowBlobRule       = engine.ShadowBlobRule
+	ShadowIdentityRule   = engine.ShadowIdentityRule
+	ShadowAccountRule    = engine.ShadowAccountRule
+	ShadowOzoneEventRule = engine.ShadowOzoneEventRule
+
+	StopEvaluation = engine.StopEvaluation
+
+	NewActionLimiter    = engine.NewActionLimiter
+	DefaultActionLimits = engine.DefaultActionLimits
+	NewRuleMonitor      = engine.NewRuleMonitor
+	NewRuleToggles      = engine.NewRuleToggles
 )
@@ -0,0 +1,32 @@
+package rules
+
+import (
+	"fmt"
+
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/countstore"
+)
+
+var accountChurnDailyThreshold = 3
+
+var _ automod.AccountRuleFunc = AccountChurnRule
+
+// tracks account deactivation and reactivation, and flags accounts which repeatedly cycle between them (eg, to evade moderation or rate limits)
+func AccountChurnRule(c *automod.AccountEventContext) error {
+	did := c.Account.Identity.DID.String()
+	typ := automod.AccountEventType(&c.Event)
+	// global counts of status changes by type, for tracking mass deactivation or reactivation
+	c.Increment("acct-status", typ)
+
+	switch typ {
+	case "deactivated":
+		c.Increment("acct-deactivate", did)
+	case "active":
+		cycles := c.GetCount("acct-deactivate", did, countstore.PeriodDay)
+		if cycles >= threshold(&accountChurnDailyThreshold) {
+			c.AddAccountFlag("account-churn")
+			c.ReportAccount(automod.ReportReasonSpam, fmt.Sprintf("account deactivated and reactivated %d times today", cycles))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/bluesky-social/indigo/automod/automodtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccountChurnRule(t *testing.T) {
+	assert := assert.New(t)
+
+	acct := automodtest.NewAccount("alice.example.com")
+	did := acct.Identity.DID.String()
+
+	eff := automodtest.AssertRuleNotTriggers(t, AccountChurnRule, automodtest.AccountEventFixture(acct, "deactivated"))
+	assert.Equal(2, len(eff.CounterIncrements))
+
+	automodtest.AssertRuleNotTriggers(t, AccountChurnRule, automodtest.AccountEventFixture(acct, ""))
+
+	f := automodtest.AccountEventFixture(acct, "")
+	f.Counts = []automodtest.Count{{Name: "acct-deactivate", Val: did, N: accountChurnDailyThreshold}}
+	eff = automodtest.AssertRuleTriggers(t, AccountChurnRule, f)
+	assert.Equal([]string{"account-churn"}, eff.AccountFlags)
+
+	// takedowns are not counted as churn
+	f = automodtest.AccountEventFixture(acct, "takendown")
+	f.Counts = []automodtest.Count{{Name: "acct-deactivate", Val: did, N: accountChurnDailyThreshold}}
+	automodtest.AssertRuleNotTriggers(t, AccountChurnRule, f)
+}
@@ -6,33 +6,51 @@ import (
 
 func DefaultRules() automod.RuleSet {
 	rules := automod.RuleSet{
-		PostRules: []automod.PostRuleFunc{
-			//MisleadingURLPostRule,
-			//MisleadingMentionPostRule,
-			ReplyCountPostRule,
-			BadHashtagsPostRule,
-			//TooManyHashtagsPostRule,
-			//AccountDemoPostRule,
-			AccountPrivateDemoPostRule,
-			GtubePostRule,
-			KeywordPostRule,
-			ReplySingleKeywordPostRule,
-			AggressivePromotionRule,
-			IdenticalReplyPostRule,
-			DistinctMentionsRule,
-		},
-		ProfileRules: []automod.ProfileRuleFunc{
-			GtubeProfileRule,
-			KeywordProfileRule,
-		},
-		RecordRules: []automod.RecordRuleFunc{
-			InteractionChurnRule,
-		},
-		RecordDeleteRules: []automod.RecordRuleFunc{
-			DeleteInteractionRule,
-		},
-		IdentityRules: []automod.IdentityRuleFunc{
-			NewAccountRule,
+		PostRules: []automod.PostRule{
+			//{Name: "MisleadingURLPostRule", Func: MisleadingURLPostRule},
+			//{Name: "MisleadingMentionPostRule", Func: MisleadingMentionPostRule},
+			{Name: "ReplyCountPostRule", Func: ReplyCountPostRule},
+			{Name: "BadHashtagsPostRule", Func: BadHashtagsPostRule},
+			//{Name: "TooManyHashtagsPostRule", Func: TooManyHashtagsPostRule},
+			//{Name: "AccountDemoPostRule", Func: AccountDemoPostRule},
+			{Name: "AccountPrivateDemoPostRule", Func: AccountPrivateDemoPostRule},
+			{Name: "GtubePostRule", Func: GtubePostRule},
+			{Name: "KeywordPostRule", Func: KeywordPostRule},
+			{Name: "ReplySingleKeywordPostRule", Func: ReplySingleKeywordPostRule},
+			{Name: "AggressivePromotionRule", Func: AggressivePromotionRule},
+			{Name: "IdenticalReplyPostRule", Func: IdenticalReplyPostRule},
+			{Name: "DistinctMentionsRule", Func: DistinctMentionsRule},
+			{Name: "QuoteSpamRule", Func: QuoteSpamRule},
+			{Name: "LanguageMismatchPostRule", Func: LanguageMismatchPostRule},
+			{Name: "BadDomainLinkPostRule", Func: BadDomainLinkPostRule},
+		},
+		ProfileRules: []automod.ProfileRule{
+			{Name: "GtubeProfileRule", Func: GtubeProfileRule},
+			{Name: "KeywordProfileRule", Func: KeywordProfileRule},
+		},
+		ListRules: []automod.ListRule{
+			{Name: "KeywordListRule", Func: KeywordListRule},
+			{Name: "ListFarmRule", Func: ListFarmRule},
+		},
+		FeedGenRules: []automod.FeedGenRule{
+			{Name: "KeywordFeedGenRule", Func: KeywordFeedGenRule},
+		},
+		RecordRules: []automod.RecordRule{
+			{Name: "InteractionChurnRule", Func: InteractionChurnRule},
+		},
+		RecordDeleteRules: []automod.RecordRule{
+			{Name: "DeleteInteractionRule", Func: DeleteInteractionRule},
+			{Name: "DeleteReplyRule", Func: DeleteReplyRule},
+		},
+		IdentityRules: []automod.IdentityRule{
+			{Name: "NewAccountRule", Func: NewAccountRule},
+		},
+		AccountRules: []automod.AccountRule{
+			{Name: "AccountChurnRule", Func: AccountChurnRule},
+		},
+		OzoneEventRules: []automod.OzoneEventRule{
+			{Name: "RepeatTakedownOzoneRule", Func: RepeatTakedownOzoneRule},
+			{Name: "AppealClearFlagsOzoneRule", Func: AppealClearFlagsOzoneRule},
 		},
 	}
 	return rules
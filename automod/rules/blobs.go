@@ -0,0 +1,35 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/hashstore"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+)
+
+// Maximum Hamming distance (in bits, out of 64) for a perceptual hash to be considered a match
+var blobPerceptualDistance = 6
+
+var _ automod.BlobRuleFunc = KnownBlobHashRule
+
+// Matches blobs (eg, images) against the engine's store of known hashes. Exact SHA-256 matches apply to any blob; perceptual hash matches only to images.
+func KnownBlobHashRule(c *automod.RecordContext, blob lexutil.LexBlob, data []byte) error {
+	tag := c.MatchBlobSHA256(hashstore.SHA256(data))
+	if tag == "" && strings.HasPrefix(blob.MimeType, "image/") {
+		phash, err := hashstore.PerceptualHash(data)
+		if err != nil {
+			// unsupported image formats (eg, webp) are expected; not an error for the rule
+			c.Logger.Debug("failed to compute perceptual hash", "cid", blob.Ref.String(), "err", err)
+			return nil
+		}
+		tag = c.MatchBlobPerceptual(phash, threshold(&blobPerceptualDistance))
+	}
+	if tag == "" {
+		return nil
+	}
+	c.AddRecordFlag("known-blob-" + tag)
+	c.ReportRecord(automod.ReportReasonViolation, fmt.Sprintf("matched known blob hash (%s): %s", tag, blob.Ref.String()))
+	return nil
+}
@@ -0,0 +1,54 @@
+package rules
+
+import (
+	"context"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod/engine"
+	"github.com/bluesky-social/indigo/automod/hashstore"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKnownBlobHashRule(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	eng := engine.EngineTestFixture()
+	hs := hashstore.NewMemHashStore()
+	eng.Hashes = hs
+
+	data := []byte("not really an image")
+	assert.NoError(hs.AddSHA256(ctx, hashstore.SHA256(data), "test"))
+
+	c, err := cid.Decode("bafkreibme22gw2h7y2h7tg2fhqotaqjucnbc24deqo72b6mkl2egezxhvy")
+	assert.NoError(err)
+	blob := lexutil.LexBlob{Ref: lexutil.LexLink(c), MimeType: "image/png", Size: int64(len(data))}
+
+	am := engine.AccountMeta{Identity: &identity.Identity{DID: syntax.DID("did:plc:abc111")}}
+	op := engine.RecordOp{
+		Action:     engine.CreateOp,
+		DID:        am.Identity.DID,
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		Value:      &appbsky.FeedPost{Text: "hello"},
+	}
+
+	rc := engine.NewRecordContext(ctx, &eng, am, op)
+	assert.NoError(KnownBlobHashRule(&rc, blob, data))
+	eff := engine.ExtractEffects(&rc.BaseContext)
+	assert.Equal([]string{"known-blob-test"}, eff.RecordFlags)
+	assert.Equal(1, len(eff.RecordReports))
+
+	// undecodable image with no exact match: no action, and no error
+	rc = engine.NewRecordContext(ctx, &eng, am, op)
+	assert.NoError(KnownBlobHashRule(&rc, blob, []byte("something else")))
+	eff = engine.ExtractEffects(&rc.BaseContext)
+	assert.Empty(eff.RecordFlags)
+	assert.Empty(eff.RecordReports)
+}
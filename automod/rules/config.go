@@ -0,0 +1,310 @@
+package rules
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/engine"
+	"github.com/bluesky-social/indigo/automod/setstore"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Operator configuration for building a RuleSet from the rules in this package, as an alternative to hard-coding DefaultRules. Usually loaded from a YAML (or JSON) file with LoadRulesConfig.
+//
+// Rules are referred to by their rule name, which is the Go function name (eg, "ReplyCountPostRule"); see RuleNames.
+type RulesConfig struct {
+	// Rules to run. If empty, starts from the rules in DefaultRules.
+	Enable []string `yaml:"enable,omitempty" json:"enable,omitempty"`
+	// Rules not to run, removed after "enable" is applied.
+	Disable []string `yaml:"disable,omitempty" json:"disable,omitempty"`
+	// Rules to run in shadow mode: their moderation actions are logged but not persisted (see automod.ShadowPostRule). Shadowed rules are renamed with a "shadow:" prefix in metrics and the admin API.
+	Shadow []string `yaml:"shadow,omitempty" json:"shadow,omitempty"`
+	// Overrides for numeric rule thresholds; see ThresholdNames.
+	Thresholds map[string]int `yaml:"thresholds,omitempty" json:"thresholds,omitempty"`
+	// Named sets used by rules (eg, "bad-words", "bad-hashtags", "promo-domain"). Replace any set of the same name when applied with ApplySets.
+	Sets map[string][]string `yaml:"sets,omitempty" json:"sets,omitempty"`
+}
+
+var (
+	postRules = map[string]automod.PostRuleFunc{
+		"MisleadingURLPostRule":      MisleadingURLPostRule,
+		"MisleadingMentionPostRule":  MisleadingMentionPostRule,
+		"ReplyCountPostRule":         ReplyCountPostRule,
+		"BadHashtagsPostRule":        BadHashtagsPostRule,
+		"TooManyHashtagsPostRule":    TooManyHashtagsPostRule,
+		"AccountDemoPostRule":        AccountDemoPostRule,
+		"AccountPrivateDemoPostRule": AccountPrivateDemoPostRule,
+		"GtubePostRule":              GtubePostRule,
+		"KeywordPostRule":            KeywordPostRule,
+		"ReplySingleKeywordPostRule": ReplySingleKeywordPostRule,
+		"AggressivePromotionRule":    AggressivePromotionRule,
+		"IdenticalReplyPostRule":     IdenticalReplyPostRule,
+		"DistinctMentionsRule":       DistinctMentionsRule,
+		"QuoteSpamRule":              QuoteSpamRule,
+		"LanguageMismatchPostRule":   LanguageMismatchPostRule,
+		"BadDomainLinkPostRule":      BadDomainLinkPostRule,
+	}
+	profileRules = map[string]automod.ProfileRuleFunc{
+		"GtubeProfileRule":   GtubeProfileRule,
+		"KeywordProfileRule": KeywordProfileRule,
+	}
+	listRules = map[string]automod.ListRuleFunc{
+		"KeywordListRule": KeywordListRule,
+		"ListFarmRule":    ListFarmRule,
+	}
+	feedGenRules = map[string]automod.FeedGenRuleFunc{
+		"KeywordFeedGenRule": KeywordFeedGenRule,
+	}
+	recordRules = map[string]automod.RecordRuleFunc{
+		"InteractionChurnRule": InteractionChurnRule,
+	}
+	recordDeleteRules = map[string]automod.RecordRuleFunc{
+		"DeleteInteractionRule": DeleteInteractionRule,
+		"DeleteReplyRule":       DeleteReplyRule,
+	}
+	identityRules = map[string]automod.IdentityRuleFunc{
+		"NewAccountRule": NewAccountRule,
+	}
+	accountRules = map[string]automod.AccountRuleFunc{
+		"AccountChurnRule": AccountChurnRule,
+	}
+	ozoneEventRules = map[string]automod.OzoneEventRuleFunc{
+		"RepeatTakedownOzoneRule":   RepeatTakedownOzoneRule,
+		"AppealClearFlagsOzoneRule": AppealClearFlagsOzoneRule,
+	}
+	blobRules = map[string]automod.BlobRuleFunc{
+		"KnownBlobHashRule": KnownBlobHashRule,
+	}
+
+	thresholds = map[string]*int{
+		"interaction-daily":        &interactionDailyThreshold,
+		"mention-hourly":           &mentionHourlyThreshold,
+		"identical-reply-limit":    &identicalReplyLimit,
+		"blob-perceptual-distance": &blobPerceptualDistance,
+		"list-daily":               &listDailyThreshold,
+		"repeat-takedown":          &repeatTakedownThreshold,
+		"account-churn-daily":      &accountChurnDailyThreshold,
+		"quote-spam-hourly":        &quoteSpamLimit,
+		"lang-mismatch-daily":      &langMismatchDailyThreshold,
+	}
+	// guards the values of thresholds
+	thresholdsLock sync.RWMutex
+)
+
+func LoadRulesConfig(path string) (*RulesConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is a subset of YAML, so this handles both
+	var config RulesConfig
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("parsing rules config (%s): %w", path, err)
+	}
+	return &config, nil
+}
+
+// Names of all the rules in this package which can be referenced from a RulesConfig, sorted.
+func RuleNames() []string {
+	var names []string
+	names = appendKeys(names, postRules)
+	names = appendKeys(names, profileRules)
+	names = appendKeys(names, listRules)
+	names = appendKeys(names, feedGenRules)
+	names = appendKeys(names, recordRules)
+	names = appendKeys(names, recordDeleteRules)
+	names = appendKeys(names, identityRules)
+	names = appendKeys(names, accountRules)
+	names = appendKeys(names, ozoneEventRules)
+	names = appendKeys(names, blobRules)
+	sort.Strings(names)
+	return names
+}
+
+// Names of all the numeric thresholds which can be overridden from a RulesConfig, sorted.
+func ThresholdNames() []string {
+	names := appendKeys(nil, thresholds)
+	sort.Strings(names)
+	return names
+}
+
+// Builds a RuleSet from the configuration, and applies any threshold overrides. Returns an error if any rule or threshold name is unknown, or if a rule is enabled more than once.
+//
+// NOTE: thresholds are package-level state, so overrides apply to all rule sets in the process. This is expected to be called once, at startup; use SetThreshold to adjust thresholds at runtime.
+func (config *RulesConfig) RuleSet() (automod.RuleSet, error) {
+	for name := range config.Thresholds {
+		if _, ok := thresholds[name]; !ok {
+			return automod.RuleSet{}, fmt.Errorf("unknown rule threshold: %s", name)
+		}
+	}
+
+	rs := DefaultRules()
+	if len(config.Enable) > 0 {
+		rs = automod.RuleSet{}
+		for _, name := range config.Enable {
+			if f, ok := postRules[name]; ok {
+				rs.PostRules = append(rs.PostRules, automod.PostRule{Name: name, Func: f})
+			} else if f, ok := profileRules[name]; ok {
+				rs.ProfileRules = append(rs.ProfileRules, automod.ProfileRule{Name: name, Func: f})
+			} else if f, ok := listRules[name]; ok {
+				rs.ListRules = append(rs.ListRules, automod.ListRule{Name: name, Func: f})
+			} else if f, ok := feedGenRules[name]; ok {
+				rs.FeedGenRules = append(rs.FeedGenRules, automod.FeedGenRule{Name: name, Func: f})
+			} else if f, ok := recordRules[name]; ok {
+				rs.RecordRules = append(rs.RecordRules, automod.RecordRule{Name: name, Func: f})
+			} else if f, ok := recordDeleteRules[name]; ok {
+				rs.RecordDeleteRules = append(rs.RecordDeleteRules, automod.RecordRule{Name: name, Func: f})
+			} else if f, ok := identityRules[name]; ok {
+				rs.IdentityRules = append(rs.IdentityRules, automod.IdentityRule{Name: name, Func: f})
+			} else if f, ok := accountRules[name]; ok {
+				rs.AccountRules = append(rs.AccountRules, automod.AccountRule{Name: name, Func: f})
+			} else if f, ok := ozoneEventRules[name]; ok {
+				rs.OzoneEventRules = append(rs.OzoneEventRules, automod.OzoneEventRule{Name: name, Func: f})
+			} else if f, ok := blobRules[name]; ok {
+				rs.BlobRules = append(rs.BlobRules, automod.BlobRule{Name: name, Func: f})
+			} else {
+				return automod.RuleSet{}, fmt.Errorf("unknown rule: %s", name)
+			}
+		}
+	}
+
+	disabled := make(map[string]bool)
+	for _, name := range config.Disable {
+		if !knownRule(name) {
+			return automod.RuleSet{}, fmt.Errorf("unknown rule: %s", name)
+		}
+		disabled[name] = true
+	}
+	rs.PostRules = withoutRules(rs.PostRules, disabled)
+	rs.ProfileRules = withoutRules(rs.ProfileRules, disabled)
+	rs.ListRules = withoutRules(rs.ListRules, disabled)
+	rs.FeedGenRules = withoutRules(rs.FeedGenRules, disabled)
+	rs.RecordRules = withoutRules(rs.RecordRules, disabled)
+	rs.RecordDeleteRules = withoutRules(rs.RecordDeleteRules, disabled)
+	rs.IdentityRules = withoutRules(rs.IdentityRules, disabled)
+	rs.AccountRules = withoutRules(rs.AccountRules, disabled)
+	rs.OzoneEventRules = withoutRules(rs.OzoneEventRules, disabled)
+	rs.BlobRules = withoutRules(rs.BlobRules, disabled)
+
+	shadow := make(map[string]bool)
+	for _, name := range config.Shadow {
+		if !knownRule(name) {
+			return automod.RuleSet{}, fmt.Errorf("unknown rule: %s", name)
+		}
+		shadow[name] = true
+	}
+	rs.PostRules = shadowRules(rs.PostRules, shadow, automod.ShadowPostRule)
+	rs.ProfileRules = shadowRules(rs.ProfileRules, shadow, automod.ShadowProfileRule)
+	rs.ListRules = shadowRules(rs.ListRules, shadow, automod.ShadowListRule)
+	rs.FeedGenRules = shadowRules(rs.FeedGenRules, shadow, automod.ShadowFeedGenRule)
+	rs.RecordRules = shadowRules(rs.RecordRules, shadow, automod.ShadowRecordRule)
+	rs.RecordDeleteRules = shadowRules(rs.RecordDeleteRules, shadow, automod.ShadowRecordRule)
+	rs.IdentityRules = shadowRules(rs.IdentityRules, shadow, automod.ShadowIdentityRule)
+	rs.AccountRules = shadowRules(rs.AccountRules, shadow, automod.ShadowAccountRule)
+	rs.OzoneEventRules = shadowRules(rs.OzoneEventRules, shadow, automod.ShadowOzoneEventRule)
+	rs.BlobRules = shadowRules(rs.BlobRules, shadow, automod.ShadowBlobRule)
+	if err := rs.Validate(); err != nil {
+		return automod.RuleSet{}, err
+	}
+
+	thresholdsLock.Lock()
+	for name, val := range config.Thresholds {
+		*thresholds[name] = val
+	}
+	thresholdsLock.Unlock()
+	return rs, nil
+}
+
+// Current values of all the numeric rule thresholds, by name.
+func Thresholds() map[string]int {
+	thresholdsLock.RLock()
+	defer thresholdsLock.RUnlock()
+	out := make(map[string]int, len(thresholds))
+	for name, p := range thresholds {
+		out[name] = *p
+	}
+	return out
+}
+
+// Overrides a single numeric rule threshold at runtime (eg, from an admin API). Like RulesConfig thresholds, this applies to all rule sets in the process.
+func SetThreshold(name string, val int) error {
+	p, ok := thresholds[name]
+	if !ok {
+		return fmt.Errorf("unknown rule threshold: %s", name)
+	}
+	if val < 0 {
+		return fmt.Errorf("rule threshold can not be negative: %s", name)
+	}
+	thresholdsLock.Lock()
+	defer thresholdsLock.Unlock()
+	*p = val
+	return nil
+}
+
+// Reads a threshold variable. Rules should use this instead of reading thresholds directly, because they may be adjusted concurrently (see SetThreshold).
+func threshold(p *int) int {
+	thresholdsLock.RLock()
+	defer thresholdsLock.RUnlock()
+	return *p
+}
+
+// Loads the configured sets in to a set store, replacing any existing sets with the same names.
+func (config *RulesConfig) ApplySets(sets setstore.MemSetStore) {
+	for name, vals := range config.Sets {
+		m := make(map[string]bool, len(vals))
+		for _, v := range vals {
+			m[v] = true
+		}
+		sets.Sets[name] = m
+	}
+}
+
+func withoutRules[F any](rules []engine.NamedRule[F], disabled map[string]bool) []engine.NamedRule[F] {
+	var out []engine.NamedRule[F]
+	for _, rule := range rules {
+		if !disabled[rule.Name] {
+			out = append(out, rule)
+		}
+	}
+	return out
+}
+
+func shadowRules[F any](rules []engine.NamedRule[F], shadow map[string]bool, wrap func(engine.NamedRule[F]) engine.NamedRule[F]) []engine.NamedRule[F] {
+	for i, rule := range rules {
+		if shadow[rule.Name] {
+			rules[i] = wrap(rule)
+		}
+	}
+	return rules
+}
+
+func knownRule(name string) bool {
+	for _, n := range RuleNames() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func appendKeys[T any](names []string, m map[string]T) []string {
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Exposes the package-level rule thresholds through an interface (eg, for adminapi.Server).
+type PackageThresholds struct{}
+
+func (PackageThresholds) Thresholds() map[string]int {
+	return Thresholds()
+}
+
+func (PackageThresholds) SetThreshold(name string, val int) error {
+	return SetThreshold(name, val)
+}
@@ -0,0 +1,78 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/bluesky-social/indigo/automod/setstore"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRulesConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	defaults := DefaultRules()
+	origLimit := identicalReplyLimit
+	defer func() { identicalReplyLimit = origLimit }()
+
+	config, err := LoadRulesConfig("testdata/rules_config.yaml")
+	assert.NoError(err)
+	rs, err := config.RuleSet()
+	assert.NoError(err)
+	assert.Equal(len(defaults.PostRules), len(rs.PostRules))
+	assert.Equal(len(defaults.RecordRules)-1, len(rs.RecordRules))
+	assert.Equal(len(defaults.IdentityRules)-1, len(rs.IdentityRules))
+	assert.Equal(3, identicalReplyLimit)
+	assert.Contains(rs.RuleNames()["post"], "shadow:KeywordPostRule")
+	assert.NotContains(rs.RuleNames()["post"], "KeywordPostRule")
+
+	sets := setstore.NewMemSetStore()
+	config.ApplySets(sets)
+	assert.True(sets.Sets["bad-words"]["hardlyfilteredword"])
+
+	config = &RulesConfig{Enable: []string{"GtubePostRule", "DeleteReplyRule"}}
+	rs, err = config.RuleSet()
+	assert.NoError(err)
+	assert.Equal(1, len(rs.PostRules))
+	assert.Equal(1, len(rs.RecordDeleteRules))
+	assert.Empty(rs.ProfileRules)
+
+	config = &RulesConfig{Disable: []string{"NoSuchRule"}}
+	_, err = config.RuleSet()
+	assert.Error(err)
+
+	config = &RulesConfig{Shadow: []string{"NoSuchRule"}}
+	_, err = config.RuleSet()
+	assert.Error(err)
+
+	config = &RulesConfig{Thresholds: map[string]int{"no-such-threshold": 1}}
+	_, err = config.RuleSet()
+	assert.Error(err)
+
+	config = &RulesConfig{Enable: []string{"GtubePostRule", "GtubePostRule"}}
+	_, err = config.RuleSet()
+	assert.ErrorContains(err, "duplicate rule name: GtubePostRule")
+
+	assert.Contains(RuleNames(), "KeywordPostRule")
+
+	// the default rules use the same names as the config
+	for _, names := range defaults.RuleNames() {
+		for _, name := range names {
+			assert.Contains(RuleNames(), name)
+		}
+	}
+	assert.NoError(defaults.Validate())
+}
+
+func TestSetThreshold(t *testing.T) {
+	assert := assert.New(t)
+
+	origLimit := identicalReplyLimit
+	defer func() { identicalReplyLimit = origLimit }()
+
+	assert.NoError(SetThreshold("identical-reply-limit", 9))
+	assert.Equal(9, Thresholds()["identical-reply-limit"])
+	assert.Error(SetThreshold("no-such-threshold", 9))
+	assert.Error(SetThreshold("identical-reply-limit", -1))
+	assert.Equal(len(ThresholdNames()), len(Thresholds()))
+}
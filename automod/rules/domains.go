@@ -0,0 +1,56 @@
+package rules
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/automod"
+)
+
+var _ automod.PostRuleFunc = BadDomainLinkPostRule
+
+// flags and reports posts linking to denylisted domains (the "domain-deny" set), including through URL shorteners. Also counts the distinct accounts linking to each domain not on either list, to help surface new spam domains.
+func BadDomainLinkPostRule(c *automod.RecordContext, post *appbsky.FeedPost) error {
+	var links []string
+	facets, err := ExtractFacets(post)
+	if err != nil {
+		c.Logger.Warn("invalid facets", "err", err)
+	}
+	for _, facet := range facets {
+		if facet.URL != nil {
+			links = append(links, *facet.URL)
+		}
+	}
+	if ext := c.ExternalLink(); ext != nil {
+		links = append(links, ext.Uri)
+	}
+
+	did := c.Account.Identity.DID.String()
+	reported := false
+	for _, link := range dedupeStrings(links) {
+		resolved := c.ResolveURL(link)
+		u, err := url.Parse(resolved)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+		switch c.DomainReputation(host) {
+		case automod.DomainDeny:
+			c.AddRecordFlag("bad-domain-link")
+			comment := fmt.Sprintf("links to denylisted domain: %s", host)
+			if resolved != link {
+				c.AddRecordFlag("shortened-bad-domain-link")
+				comment += fmt.Sprintf(" (via %s)", link)
+			}
+			if !reported {
+				c.ReportRecord(automod.ReportReasonSpam, comment)
+				reported = true
+			}
+		case automod.DomainUnknown:
+			c.IncrementDistinct("domain-unknown", strings.TrimPrefix(host, "www."), did)
+		}
+	}
+	return nil
+}
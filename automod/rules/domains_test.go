@@ -0,0 +1,80 @@
+package rules
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod/automodtest"
+	"github.com/bluesky-social/indigo/automod/engine"
+	"github.com/bluesky-social/indigo/automod/setstore"
+	"github.com/bluesky-social/indigo/automod/urlresolve"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBadDomainLinkPostRule(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// fake URL shortener
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://spam.evil.com/landing", http.StatusFound)
+	}))
+	defer srv.Close()
+	srvURL, err := url.Parse(srv.URL)
+	assert.NoError(err)
+
+	eng := engine.EngineTestFixture()
+	opts := urlresolve.DefaultResolverOptions()
+	opts.Shorteners = []string{srvURL.Hostname()}
+	eng.URLResolver = urlresolve.NewResolver(opts)
+	sets := eng.Sets.(setstore.MemSetStore)
+	sets.Sets["domain-deny"] = map[string]bool{"evil.com": true}
+	sets.Sets["domain-allow"] = map[string]bool{"good.evil.com": true}
+
+	acct := automodtest.NewAccount("alice.example.com")
+	run := func(link string) engine.Effects {
+		post := automodtest.NewPost("check out my site")
+		post.Embed = &appbsky.FeedPost_Embed{
+			EmbedExternal: &appbsky.EmbedExternal{
+				External: &appbsky.EmbedExternal_External{Uri: link},
+			},
+		}
+		cid := syntax.CID("cid123")
+		op := engine.RecordOp{
+			Action:     engine.CreateOp,
+			DID:        acct.Identity.DID,
+			Collection: "app.bsky.feed.post",
+			RecordKey:  "abc123",
+			CID:        &cid,
+			Value:      post,
+		}
+		c := engine.NewRecordContext(ctx, &eng, acct, op)
+		assert.NoError(BadDomainLinkPostRule(&c, post))
+		return engine.ExtractEffects(&c.BaseContext)
+	}
+
+	eff := run("https://evil.com/page")
+	assert.Equal([]string{"bad-domain-link"}, eff.RecordFlags)
+	assert.Equal(1, len(eff.RecordReports))
+
+	eff = run(srv.URL + "/xyz")
+	assert.Equal([]string{"bad-domain-link", "shortened-bad-domain-link"}, eff.RecordFlags)
+
+	eff = run("https://good.evil.com/page")
+	assert.False(automodtest.HasActions(eff))
+
+	eff = run("https://www.unknown.example.com/page")
+	assert.False(automodtest.HasActions(eff))
+	assert.Equal([]engine.CounterDistinctRef{{Name: "domain-unknown", Bucket: "unknown.example.com", Val: acct.Identity.DID.String()}}, eff.CounterDistinctIncrements)
+
+	// no resolver configured: links are not resolved
+	eng.URLResolver = nil
+	eff = run(srv.URL + "/xyz")
+	assert.Empty(eff.RecordFlags)
+}
@@ -15,23 +15,23 @@ func InteractionChurnRule(c *automod.RecordContext) error {
 	switch c.RecordOp.Collection {
 	case "app.bsky.feed.like":
 		c.Increment("like", did)
-		created := c.GetCount("like", did, countstore.PeriodDay)
-		deleted := c.GetCount("unlike", did, countstore.PeriodDay)
+		created := c.GetCount("like", did, countstore.PeriodRolling24h)
+		deleted := c.GetCount("unlike", did, countstore.PeriodRolling24h)
 		ratio := float64(deleted) / float64(created)
-		if created > interactionDailyThreshold && deleted > interactionDailyThreshold && ratio > 0.5 {
-			c.Logger.Info("high-like-churn", "created-today", created, "deleted-today", deleted)
+		if limit := threshold(&interactionDailyThreshold); created > limit && deleted > limit && ratio > 0.5 {
+			c.Logger.Info("high-like-churn", "created-24h", created, "deleted-24h", deleted)
 			c.AddAccountFlag("high-like-churn")
-			c.ReportAccount(automod.ReportReasonSpam, fmt.Sprintf("interaction churn: %d likes, %d unlikes today (so far)", created, deleted))
+			c.ReportAccount(automod.ReportReasonSpam, fmt.Sprintf("interaction churn: %d likes, %d unlikes in the past day", created, deleted))
 		}
 	case "app.bsky.graph.follow":
 		c.Increment("follow", did)
-		created := c.GetCount("follow", did, countstore.PeriodDay)
-		deleted := c.GetCount("unfollow", did, countstore.PeriodDay)
+		created := c.GetCount("follow", did, countstore.PeriodRolling24h)
+		deleted := c.GetCount("unfollow", did, countstore.PeriodRolling24h)
 		ratio := float64(deleted) / float64(created)
-		if created > interactionDailyThreshold && deleted > interactionDailyThreshold && ratio > 0.5 {
-			c.Logger.Info("high-follow-churn", "created-today", created, "deleted-today", deleted)
+		if limit := threshold(&interactionDailyThreshold); created > limit && deleted > limit && ratio > 0.5 {
+			c.Logger.Info("high-follow-churn", "created-24h", created, "deleted-24h", deleted)
 			c.AddAccountFlag("high-follow-churn")
-			c.ReportAccount(automod.ReportReasonSpam, fmt.Sprintf("interaction churn: %d follows, %d unfollows today (so far)", created, deleted))
+			c.ReportAccount(automod.ReportReasonSpam, fmt.Sprintf("interaction churn: %d follows, %d unfollows in the past day", created, deleted))
 		}
 	}
 	return nil
@@ -7,9 +7,14 @@ import (
 	"github.com/bluesky-social/indigo/automod"
 )
 
+// also checks the language-specific set for the post's (most likely) language, eg "bad-words-de"
 func KeywordPostRule(c *automod.RecordContext, post *appbsky.FeedPost) error {
+	langSet := ""
+	if langs := c.DetectedLanguages(); len(langs) > 0 {
+		langSet = "bad-words-" + langs[0]
+	}
 	for _, tok := range ExtractTextTokensPost(post) {
-		if c.InSet("bad-words", tok) {
+		if c.InSet("bad-words", tok) || (langSet != "" && c.InSet(langSet, tok)) {
 			c.AddRecordFlag("bad-word")
 			c.ReportRecord(automod.ReportReasonRude, fmt.Sprintf("bad-word: %s", tok))
 			break
@@ -0,0 +1,43 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/bluesky-social/indigo/automod/automodtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeywordRules(t *testing.T) {
+	assert := assert.New(t)
+
+	acct := automodtest.NewAccount("alice.example.com")
+	sets := map[string][]string{"bad-words": {"hardlyfilteredword"}}
+
+	for _, text := range []string{"hardlyfilteredword", "this post has a HardlyFilteredWord in it"} {
+		f := automodtest.PostFixture(acct, automodtest.NewPost(text))
+		f.Sets = sets
+		eff := automodtest.AssertRuleTriggers(t, KeywordPostRule, f)
+		assert.Equal([]string{"bad-word"}, eff.RecordFlags)
+	}
+	for _, text := range []string{"", "a perfectly fine post"} {
+		f := automodtest.PostFixture(acct, automodtest.NewPost(text))
+		f.Sets = sets
+		automodtest.AssertRuleNotTriggers(t, KeywordPostRule, f)
+	}
+
+	// language-specific sets only apply to posts in that language
+	langSets := map[string][]string{"bad-words-de": {"schlimmeswort"}}
+	f := automodtest.PostFixture(acct, automodtest.NewPost("das ist ein schlimmeswort und nicht gut"))
+	f.Sets = langSets
+	automodtest.AssertRuleTriggers(t, KeywordPostRule, f)
+	f = automodtest.PostFixture(acct, automodtest.NewPost("this is a schlimmeswort but the post is in english"))
+	f.Sets = langSets
+	automodtest.AssertRuleNotTriggers(t, KeywordPostRule, f)
+
+	f = automodtest.ProfileFixture(acct, automodtest.NewProfile("Alice", "i am hardlyfilteredword"))
+	f.Sets = sets
+	automodtest.AssertRuleTriggers(t, KeywordProfileRule, f)
+
+	automodtest.AssertRuleTriggers(t, GtubePostRule, automodtest.PostFixture(acct, automodtest.NewPost(gtubeString)))
+}
@@ -0,0 +1,41 @@
+package rules
+
+import (
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/countstore"
+	"github.com/bluesky-social/indigo/automod/langdetect"
+)
+
+var langMismatchDailyThreshold = 10
+
+var _ automod.PostRuleFunc = LanguageMismatchPostRule
+
+// flags posts where the declared languages don't match the detected language of the text (a common spam signal, eg from automated cross-posting), and accounts which do this frequently
+func LanguageMismatchPostRule(c *automod.RecordContext, post *appbsky.FeedPost) error {
+	if len(post.Langs) == 0 {
+		return nil
+	}
+	// only use the detected language, not the fallback to declared languages
+	detected := langdetect.Detect(post.Text)
+	if len(detected) == 0 {
+		return nil
+	}
+	for _, tag := range post.Langs {
+		lang := langdetect.Base(tag)
+		for _, d := range detected {
+			if d == lang {
+				return nil
+			}
+		}
+	}
+
+	did := c.Account.Identity.DID.String()
+	c.AddRecordFlag("lang-mismatch")
+	c.Increment("lang-mismatch", did)
+	// note: does not include the current post (counters are incremented after rules run)
+	if c.GetCount("lang-mismatch", did, countstore.PeriodDay)+1 >= threshold(&langMismatchDailyThreshold) {
+		c.AddAccountFlag("frequent-lang-mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/bluesky-social/indigo/automod/automodtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLanguageMismatchPostRule(t *testing.T) {
+	assert := assert.New(t)
+
+	acct := automodtest.NewAccount("alice.example.com")
+	post := func(text string, langs ...string) automodtest.Fixture {
+		p := automodtest.NewPost(text)
+		p.Langs = langs
+		return automodtest.PostFixture(acct, p)
+	}
+
+	automodtest.AssertRuleNotTriggers(t, LanguageMismatchPostRule, post("this is a post in english, with the declared language", "en-US"))
+	automodtest.AssertRuleNotTriggers(t, LanguageMismatchPostRule, post("this is a post in english, with no declared language"))
+	// too short to detect
+	automodtest.AssertRuleNotTriggers(t, LanguageMismatchPostRule, post("hello", "ja"))
+
+	eff := automodtest.AssertRuleTriggers(t, LanguageMismatchPostRule, post("今日はとても良い天気ですね", "en"))
+	assert.Equal([]string{"lang-mismatch"}, eff.RecordFlags)
+	assert.Empty(eff.AccountFlags)
+
+	f := post("this is a post in english, but declared as japanese", "ja")
+	f.Counts = []automodtest.Count{{Name: "lang-mismatch", Val: acct.Identity.DID.String(), N: langMismatchDailyThreshold - 1}}
+	eff = automodtest.AssertRuleTriggers(t, LanguageMismatchPostRule, f)
+	assert.Equal([]string{"frequent-lang-mismatch"}, eff.AccountFlags)
+}
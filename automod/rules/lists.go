@@ -0,0 +1,61 @@
+package rules
+
+import (
+	"fmt"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/countstore"
+)
+
+var listDailyThreshold = 20
+
+var _ automod.ListRuleFunc = KeywordListRule
+
+func KeywordListRule(c *automod.RecordContext, list *appbsky.GraphList) error {
+	s := list.Name
+	if list.Description != nil {
+		s += " " + *list.Description
+	}
+	for _, tok := range ExtractTextTokens(s) {
+		if c.InSet("bad-words", tok) {
+			c.AddRecordFlag("bad-word")
+			c.ReportRecord(automod.ReportReasonRude, fmt.Sprintf("bad-word: %s", tok))
+			break
+		}
+	}
+	return nil
+}
+
+var _ automod.FeedGenRuleFunc = KeywordFeedGenRule
+
+func KeywordFeedGenRule(c *automod.RecordContext, feedgen *appbsky.FeedGenerator) error {
+	s := feedgen.DisplayName
+	if feedgen.Description != nil {
+		s += " " + *feedgen.Description
+	}
+	for _, tok := range ExtractTextTokens(s) {
+		if c.InSet("bad-words", tok) {
+			c.AddRecordFlag("bad-word")
+			c.ReportRecord(automod.ReportReasonRude, fmt.Sprintf("bad-word: %s", tok))
+			break
+		}
+	}
+	return nil
+}
+
+var _ automod.ListRuleFunc = ListFarmRule
+
+// looks for accounts which create many lists in a short period, a pattern of spam list "farms"
+func ListFarmRule(c *automod.RecordContext, list *appbsky.GraphList) error {
+	did := c.Account.Identity.DID.String()
+	c.Increment("list", did)
+	// note: does not include the current list (counters are incremented after rules run)
+	created := c.GetCount("list", did, countstore.PeriodRolling24h) + 1
+	if created > threshold(&listDailyThreshold) {
+		c.Logger.Info("high-list-creation", "created-24h", created)
+		c.AddAccountFlag("high-list-creation")
+		c.ReportAccount(automod.ReportReasonSpam, fmt.Sprintf("list farm: %d lists created in the past day", created))
+	}
+	return nil
+}
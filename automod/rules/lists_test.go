@@ -0,0 +1,37 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/bluesky-social/indigo/automod/automodtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListRules(t *testing.T) {
+	assert := assert.New(t)
+
+	acct := automodtest.NewAccount("alice.example.com")
+	sets := map[string][]string{"bad-words": {"hardlyfilteredword"}}
+
+	f := automodtest.ListFixture(acct, automodtest.NewList("Cool People", "hardlyfilteredword fans"))
+	f.Sets = sets
+	eff := automodtest.AssertRuleTriggers(t, KeywordListRule, f)
+	assert.Equal([]string{"bad-word"}, eff.RecordFlags)
+
+	f = automodtest.ListFixture(acct, automodtest.NewList("Cool People", "a perfectly fine list"))
+	f.Sets = sets
+	automodtest.AssertRuleNotTriggers(t, KeywordListRule, f)
+
+	f = automodtest.FeedGenFixture(acct, automodtest.NewFeedGenerator("Hardlyfilteredword Feed", ""))
+	f.Sets = sets
+	automodtest.AssertRuleTriggers(t, KeywordFeedGenRule, f)
+
+	f = automodtest.ListFixture(acct, automodtest.NewList("list", ""))
+	eff = automodtest.AssertRuleNotTriggers(t, ListFarmRule, f)
+	assert.Equal(1, len(eff.CounterIncrements))
+
+	f.Counts = []automodtest.Count{{Name: "list", Val: acct.Identity.DID.String(), N: listDailyThreshold}}
+	eff = automodtest.AssertRuleTriggers(t, ListFarmRule, f)
+	assert.Equal([]string{"high-list-creation"}, eff.AccountFlags)
+}
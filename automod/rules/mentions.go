@@ -31,7 +31,7 @@ func DistinctMentionsRule(c *automod.RecordContext, post *appbsky.FeedPost) erro
 	if !newMentions {
 		return nil
 	}
-	if mentionHourlyThreshold <= c.GetCountDistinct("mentions", did, countstore.PeriodHour) {
+	if threshold(&mentionHourlyThreshold) <= c.GetCountDistinct("mentions", did, countstore.PeriodHour) {
 		c.AddAccountFlag("high-distinct-mentions")
 	}
 
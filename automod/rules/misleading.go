@@ -92,9 +92,18 @@ func MisleadingURLPostRule(c *automod.RecordContext, post *appbsky.FeedPost) err
 	}
 	for _, facet := range facets {
 		if facet.URL != nil {
-			if isMisleadingURLFacet(facet, c.Logger) {
-				c.AddRecordFlag("misleading-link")
+			if !isMisleadingURLFacet(facet, c.Logger) {
+				continue
+			}
+			// links through URL shorteners are only misleading if the destination doesn't match the text either
+			if resolved := c.ResolveURL(*facet.URL); resolved != *facet.URL {
+				rf := facet
+				rf.URL = &resolved
+				if !isMisleadingURLFacet(rf, c.Logger) {
+					continue
+				}
 			}
+			c.AddRecordFlag("misleading-link")
 		}
 	}
 	return nil
@@ -0,0 +1,41 @@
+package rules
+
+import (
+	"fmt"
+
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/countstore"
+)
+
+var repeatTakedownThreshold = 3
+
+var _ automod.OzoneEventRuleFunc = RepeatTakedownOzoneRule
+
+// counts record takedowns by moderators against each account, and escalates accounts which accrue several for account-level review
+func RepeatTakedownOzoneRule(c *automod.OzoneEventContext) error {
+	if c.Event.Event == nil || c.Event.Event.AdminDefs_ModEventTakedown == nil || c.SubjectURI == nil {
+		return nil
+	}
+	did := c.Account.Identity.DID.String()
+	c.Increment("mod-record-takedown", did)
+	// note: does not include the current takedown (counters are incremented after rules run)
+	count := c.GetCount("mod-record-takedown", did, countstore.PeriodTotal) + 1
+	if count >= threshold(&repeatTakedownThreshold) {
+		c.AddAccountFlag("repeat-takedowns")
+		c.ReportAccount(automod.ReportReasonViolation, fmt.Sprintf("%d records taken down by moderators", count))
+	}
+	return nil
+}
+
+var _ automod.OzoneEventRuleFunc = AppealClearFlagsOzoneRule
+
+// clears all automod flags from an account when a moderator reverses an account takedown (eg, after a successful appeal)
+func AppealClearFlagsOzoneRule(c *automod.OzoneEventContext) error {
+	if c.Event.Event == nil || c.Event.Event.AdminDefs_ModEventReverseTakedown == nil || c.SubjectURI != nil {
+		return nil
+	}
+	for _, f := range c.Account.AccountFlags {
+		c.RemoveAccountFlag(f)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package rules
+
+import (
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod/automodtest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOzoneEventRules(t *testing.T) {
+	assert := assert.New(t)
+
+	acct := automodtest.NewAccount("alice.example.com")
+	did := acct.Identity.DID.String()
+	uri := syntax.ATURI("at://" + did + "/app.bsky.feed.post/abc123")
+	takedown := comatproto.AdminDefs_ModEventView_Event{AdminDefs_ModEventTakedown: &comatproto.AdminDefs_ModEventTakedown{}}
+	reverse := comatproto.AdminDefs_ModEventView_Event{AdminDefs_ModEventReverseTakedown: &comatproto.AdminDefs_ModEventReverseTakedown{}}
+
+	f := automodtest.OzoneEventFixture(acct, uri, takedown)
+	eff := automodtest.AssertRuleNotTriggers(t, RepeatTakedownOzoneRule, f)
+	assert.Equal(1, len(eff.CounterIncrements))
+
+	f.Counts = []automodtest.Count{{Name: "mod-record-takedown", Val: did, N: repeatTakedownThreshold - 1}}
+	eff = automodtest.AssertRuleTriggers(t, RepeatTakedownOzoneRule, f)
+	assert.Equal([]string{"repeat-takedowns"}, eff.AccountFlags)
+
+	// account-level takedowns are not counted
+	automodtest.AssertRuleNotTriggers(t, RepeatTakedownOzoneRule, automodtest.OzoneEventFixture(acct, "", takedown))
+
+	flagged := acct
+	flagged.AccountFlags = []string{"repeat-takedowns", "new-account"}
+	eff = automodtest.AssertRuleTriggers(t, AppealClearFlagsOzoneRule, automodtest.OzoneEventFixture(flagged, "", reverse))
+	assert.Equal([]string{"repeat-takedowns", "new-account"}, eff.RemovedAccountFlags)
+	automodtest.AssertRuleNotTriggers(t, AppealClearFlagsOzoneRule, automodtest.OzoneEventFixture(flagged, uri, reverse))
+}
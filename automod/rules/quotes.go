@@ -0,0 +1,63 @@
+package rules
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/countstore"
+)
+
+// triggers on quoting the Nth distinct account with the same content in an hour
+var quoteSpamLimit = 5
+
+var _ automod.PostRuleFunc = QuoteSpamRule
+
+// Looks for accounts quoting posts from many other accounts with the same content (text, link card, and image alt text), a common pattern for spam riding on popular posts.
+func QuoteSpamRule(c *automod.RecordContext, post *appbsky.FeedPost) error {
+	uri := c.QuotedURI()
+	if uri == nil || uri.Collection() != "app.bsky.feed.post" {
+		return nil
+	}
+	did := c.Account.Identity.DID.String()
+	quotedDID := uri.Authority().String()
+	if quotedDID == did {
+		return nil
+	}
+
+	content := strings.TrimSpace(post.Text)
+	if link := c.ExternalLink(); link != nil {
+		content += "\n" + link.Uri
+	}
+	for _, alt := range c.ImageAltTexts() {
+		content += "\n" + alt
+	}
+	// don't action short quotes (eg, "this!")
+	if utf8.RuneCountInString(content) <= 10 {
+		return nil
+	}
+
+	bucket := did + "/" + HashOfString(content)
+	c.IncrementDistinct("quote-content", bucket, quotedDID)
+	// note: does not include the current quote (counters are incremented after rules run)
+	count := c.GetCountDistinct("quote-content", bucket, countstore.PeriodHour) + 1
+	if count < threshold(&quoteSpamLimit) {
+		return nil
+	}
+	c.AddAccountFlag("quote-spam")
+	comment := fmt.Sprintf("quoted %d accounts with identical content in the past hour", count)
+	if quoted := c.QuotedPost(); quoted != nil {
+		comment += fmt.Sprintf(". eg, quoting: %q", truncateString(quoted.Text, 100))
+	}
+	c.ReportAccount(automod.ReportReasonSpam, comment)
+	return nil
+}
+
+func truncateString(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
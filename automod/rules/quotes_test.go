@@ -0,0 +1,55 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/automodtest"
+	"github.com/bluesky-social/indigo/automod/engine"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoteSpamRule(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	acct := automodtest.NewAccount("alice.example.com")
+	did := acct.Identity.DID
+
+	// self-quotes and short quotes are ignored
+	automodtest.AssertRuleNotTriggers(t, QuoteSpamRule, automodtest.PostFixture(acct, automodtest.NewQuote("buy followers at example.com", syntax.ATURI("at://"+did+"/app.bsky.feed.post/abc"))))
+	automodtest.AssertRuleNotTriggers(t, QuoteSpamRule, automodtest.PostFixture(acct, automodtest.NewQuote("this!", "at://did:plc:other/app.bsky.feed.post/abc")))
+
+	// engine test fixture only resolves this DID
+	did = syntax.DID("did:plc:abc111")
+	eng := engine.EngineTestFixture()
+	eng.Rules = automod.RuleSet{
+		PostRules: []automod.PostRule{
+			{Name: "QuoteSpamRule", Func: QuoteSpamRule},
+		},
+	}
+	cid := syntax.CID("cid123")
+	for i := 0; i < quoteSpamLimit; i++ {
+		quoted := syntax.ATURI(fmt.Sprintf("at://did:plc:other%d/app.bsky.feed.post/abc", i))
+		op := engine.RecordOp{
+			Action:     engine.CreateOp,
+			DID:        did,
+			Collection: "app.bsky.feed.post",
+			RecordKey:  syntax.RecordKey(fmt.Sprintf("rkey%d", i)),
+			CID:        &cid,
+			Value:      automodtest.NewQuote("buy followers at example.com", quoted),
+		}
+		assert.NoError(eng.ProcessRecordOp(ctx, op))
+		flags, err := eng.Flags.Get(ctx, did.String())
+		assert.NoError(err)
+		if i < quoteSpamLimit-1 {
+			assert.Empty(flags)
+		} else {
+			assert.Equal([]string{"quote-spam"}, flags)
+		}
+	}
+}
@@ -22,6 +22,8 @@ func ReplyCountPostRule(c *automod.RecordContext, post *appbsky.FeedPost) error
 		//c.AddAccountFlag("frequent-replier")
 	}
 	c.Increment("reply", did)
+	// short-lived marker of the replies which were counted, so deletions can be reversed by DeleteReplyRule
+	c.IncrementPeriod("reply-uri", c.RecordOp.ATURI().String(), countstore.PeriodDay)
 
 	parentURI, err := syntax.ParseATURI(post.Reply.Parent.Uri)
 	if err != nil {
@@ -32,6 +34,22 @@ func ReplyCountPostRule(c *automod.RecordContext, post *appbsky.FeedPost) error
 	return nil
 }
 
+// reverses the "reply" count increment of ReplyCountPostRule, if the deleted post was counted recently (the same UTC day).
+//
+// The per-URI marker is incremented again instead of decremented, so only a marker count of exactly one means a counted reply which hasn't been deleted yet. Repeated deletes of the same record, or deletes of posts which were never counted as replies, don't change the "reply" count.
+func DeleteReplyRule(c *automod.RecordContext) error {
+	if c.RecordOp.Collection != "app.bsky.feed.post" {
+		return nil
+	}
+	uri := c.RecordOp.ATURI().String()
+	if c.GetCount("reply-uri", uri, countstore.PeriodDay) != 1 {
+		return nil
+	}
+	c.Decrement("reply", c.Account.Identity.DID.String())
+	c.IncrementPeriod("reply-uri", uri, countstore.PeriodDay)
+	return nil
+}
+
 // triggers on the N+1 post, so 6th identical reply
 var identicalReplyLimit = 5
 
@@ -59,7 +77,7 @@ func IdenticalReplyPostRule(c *automod.RecordContext, post *appbsky.FeedPost) er
 		}
 	}
 
-	if c.GetCount("reply-text", bucket, period) >= identicalReplyLimit {
+	if c.GetCount("reply-text", bucket, period) >= threshold(&identicalReplyLimit) {
 		c.AddAccountFlag("multi-identical-reply")
 	}
 
@@ -4,6 +4,9 @@ import (
 	"context"
 	"testing"
 
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
 	"github.com/bluesky-social/indigo/automod"
 	"github.com/bluesky-social/indigo/automod/capture"
 	"github.com/bluesky-social/indigo/automod/engine"
@@ -17,8 +20,8 @@ func TestIdenticalReplyPostRule(t *testing.T) {
 
 	eng := engine.EngineTestFixture()
 	eng.Rules = automod.RuleSet{
-		PostRules: []automod.PostRuleFunc{
-			IdenticalReplyPostRule,
+		PostRules: []automod.PostRule{
+			{Name: "IdenticalReplyPostRule", Func: IdenticalReplyPostRule},
 		},
 	}
 
@@ -29,3 +32,70 @@ func TestIdenticalReplyPostRule(t *testing.T) {
 	assert.NoError(err)
 	assert.Equal([]string{"multi-identical-reply"}, f)
 }
+
+func TestDeleteReplyRule(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	eng := engine.EngineTestFixture()
+	eng.Rules = automod.RuleSet{
+		PostRules: []automod.PostRule{
+			{Name: "ReplyCountPostRule", Func: ReplyCountPostRule},
+		},
+		RecordDeleteRules: []automod.RecordRule{
+			{Name: "DeleteReplyRule", Func: DeleteReplyRule},
+		},
+	}
+
+	did := syntax.DID("did:plc:abc111")
+	cid1 := syntax.CID("cid123")
+	p1 := appbsky.FeedPost{
+		Text: "a reply",
+		Reply: &appbsky.FeedPost_ReplyRef{
+			Root:   &comatproto.RepoStrongRef{Uri: "at://did:plc:other222/app.bsky.feed.post/root", Cid: "cid"},
+			Parent: &comatproto.RepoStrongRef{Uri: "at://did:plc:other222/app.bsky.feed.post/root", Cid: "cid"},
+		},
+	}
+	op := engine.RecordOp{
+		Action:     engine.CreateOp,
+		DID:        did,
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  syntax.RecordKey("abc123"),
+		CID:        &cid1,
+		Value:      &p1,
+	}
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+	c, err := eng.GetCount("reply", did.String(), automod.PeriodDay)
+	assert.NoError(err)
+	assert.Equal(1, c)
+
+	del := engine.RecordOp{
+		Action:     engine.DeleteOp,
+		DID:        did,
+		Collection: syntax.NSID("app.bsky.feed.post"),
+		RecordKey:  op.RecordKey,
+	}
+	assert.NoError(eng.ProcessRecordOp(ctx, del))
+	c, err = eng.GetCount("reply", did.String(), automod.PeriodDay)
+	assert.NoError(err)
+	assert.Equal(0, c)
+
+	// a second reply is counted; deleting the first one again doesn't reverse it
+	op.RecordKey = syntax.RecordKey("abc456")
+	assert.NoError(eng.ProcessRecordOp(ctx, op))
+	assert.NoError(eng.ProcessRecordOp(ctx, del))
+	c, err = eng.GetCount("reply", did.String(), automod.PeriodDay)
+	assert.NoError(err)
+	assert.Equal(1, c)
+
+	// neither does creating and deleting a top-level post
+	top := op
+	top.RecordKey = syntax.RecordKey("abc789")
+	top.Value = &appbsky.FeedPost{Text: "not a reply"}
+	assert.NoError(eng.ProcessRecordOp(ctx, top))
+	del.RecordKey = top.RecordKey
+	assert.NoError(eng.ProcessRecordOp(ctx, del))
+	c, err = eng.GetCount("reply", did.String(), automod.PeriodDay)
+	assert.NoError(err)
+	assert.Equal(1, c)
+}
@@ -0,0 +1,168 @@
+package setstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// SetStore which periodically re-loads sets from a local JSON file or a remote (HTTP) JSON document, so that updated lists (eg, bad words or hashtags) are picked up at runtime. Safe for concurrent use.
+//
+// The JSON format is the same as for MemSetStore.LoadFromFileJSON: an object mapping set names to arrays of strings. Loaded sets replace any "base" sets of the same name; base sets which are not in the source are kept.
+//
+// If a reload fails, the previously loaded sets remain in use.
+type ReloadingSetStore struct {
+	// Local file path, or "http://" or "https://" URL
+	Source string
+	Client *http.Client
+	Logger *slog.Logger
+
+	base  map[string]map[string]bool
+	sets  atomic.Pointer[map[string]map[string]bool]
+	mtime time.Time
+	etag  string
+}
+
+var setReloads = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "automod_setstore_reloads",
+	Help: "Number of attempts to reload sets from source, by status (success, unchanged, failure)",
+}, []string{"status"})
+
+var setLastReload = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "automod_setstore_last_reload_timestamp_seconds",
+	Help: "Unix time of the most recent successful reload of sets from source",
+})
+
+// Creates a new store, with the sets from base (which is not modified) as a starting point. Does not load from source; call Reload (or RunReload) for that.
+func NewReloadingSetStore(source string, base MemSetStore) *ReloadingSetStore {
+	s := ReloadingSetStore{
+		Source: source,
+		Client: http.DefaultClient,
+		Logger: slog.Default(),
+		base:   base.Sets,
+	}
+	sets := make(map[string]map[string]bool, len(base.Sets))
+	for name, set := range base.Sets {
+		sets[name] = set
+	}
+	s.sets.Store(&sets)
+	return &s
+}
+
+func (s *ReloadingSetStore) InSet(ctx context.Context, name, val string) (bool, error) {
+	set, ok := (*s.sets.Load())[name]
+	if !ok {
+		// NOTE: currently returns false when entire set isn't found
+		return false, nil
+	}
+	return set[val], nil
+}
+
+// Loads sets from the source, if it has changed since the last reload. Not safe to call concurrently with itself.
+func (s *ReloadingSetStore) Reload(ctx context.Context) error {
+	raw, err := s.fetch(ctx)
+	if err != nil {
+		setReloads.WithLabelValues("failure").Inc()
+		return err
+	}
+	if raw == nil {
+		setReloads.WithLabelValues("unchanged").Inc()
+		return nil
+	}
+
+	var loaded map[string][]string
+	if err := json.Unmarshal(raw, &loaded); err != nil {
+		setReloads.WithLabelValues("failure").Inc()
+		return fmt.Errorf("parsing sets from %s: %w", s.Source, err)
+	}
+	sets := make(map[string]map[string]bool, len(s.base)+len(loaded))
+	for name, set := range s.base {
+		sets[name] = set
+	}
+	for name, l := range loaded {
+		m := make(map[string]bool, len(l))
+		for _, val := range l {
+			m[val] = true
+		}
+		sets[name] = m
+	}
+	s.sets.Store(&sets)
+
+	setReloads.WithLabelValues("success").Inc()
+	setLastReload.SetToCurrentTime()
+	s.Logger.Info("reloaded sets", "source", s.Source, "sets", len(loaded))
+	return nil
+}
+
+// Reloads sets from source immediately, then every interval, until the context is cancelled. Failures are logged, and do not stop the loop.
+func (s *ReloadingSetStore) RunReload(ctx context.Context, interval time.Duration) error {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.Reload(ctx); err != nil {
+			s.Logger.Error("failed to reload sets", "source", s.Source, "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Returns the raw source document, or nil if it has not changed since the last fetch.
+func (s *ReloadingSetStore) fetch(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.Source, "http://") && !strings.HasPrefix(s.Source, "https://") {
+		info, err := os.Stat(s.Source)
+		if err != nil {
+			return nil, err
+		}
+		if info.ModTime().Equal(s.mtime) {
+			return nil, nil
+		}
+		raw, err := os.ReadFile(s.Source)
+		if err != nil {
+			return nil, err
+		}
+		s.mtime = info.ModTime()
+		return raw, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Source, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching sets from %s: HTTP status %d", s.Source, resp.StatusCode)
+	}
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	s.etag = resp.Header.Get("ETag")
+	return raw, nil
+}
@@ -0,0 +1,188 @@
+package setstore
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testBaseSets() MemSetStore {
+	base := NewMemSetStore()
+	base.Sets["bad-words"] = map[string]bool{"hardcoded": true}
+	base.Sets["bad-hashtags"] = map[string]bool{"spam": true}
+	return base
+}
+
+func assertInSet(t *testing.T, s SetStore, name, val string, expected bool) {
+	t.Helper()
+	ok, err := s.InSet(context.Background(), name, val)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, ok, "%s in %s", val, name)
+}
+
+func TestReloadingSetStoreFile(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	p := filepath.Join(t.TempDir(), "sets.json")
+	write := func(content string, mtime time.Time) {
+		assert.NoError(os.WriteFile(p, []byte(content), 0644))
+		assert.NoError(os.Chtimes(p, mtime, mtime))
+	}
+	mtime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	s := NewReloadingSetStore(p, testBaseSets())
+	s.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	// base sets are used until the first reload
+	assertInSet(t, s, "bad-words", "hardcoded", true)
+	assert.Error(s.Reload(ctx))
+	assertInSet(t, s, "bad-words", "hardcoded", true)
+
+	// loaded sets replace base sets of the same name, and other base sets are kept
+	write(`{"bad-words": ["loaded"], "bad-domains": ["evil.example.com"]}`, mtime)
+	assert.NoError(s.Reload(ctx))
+	assertInSet(t, s, "bad-words", "loaded", true)
+	assertInSet(t, s, "bad-words", "hardcoded", false)
+	assertInSet(t, s, "bad-domains", "evil.example.com", true)
+	assertInSet(t, s, "bad-hashtags", "spam", true)
+	assertInSet(t, s, "missing", "loaded", false)
+
+	// not re-read while the mtime is unchanged
+	write(`{"bad-words": ["changed"]}`, mtime)
+	assert.NoError(s.Reload(ctx))
+	assertInSet(t, s, "bad-words", "loaded", true)
+	assertInSet(t, s, "bad-words", "changed", false)
+
+	mtime = mtime.Add(time.Minute)
+	write(`{"bad-words": ["changed"]}`, mtime)
+	assert.NoError(s.Reload(ctx))
+	assertInSet(t, s, "bad-words", "changed", true)
+	assertInSet(t, s, "bad-words", "loaded", false)
+	// sets missing from the new version are dropped, unless they are base sets
+	assertInSet(t, s, "bad-domains", "evil.example.com", false)
+	assertInSet(t, s, "bad-hashtags", "spam", true)
+
+	// an invalid file keeps the previous sets
+	mtime = mtime.Add(time.Minute)
+	write(`{"bad-words": [`, mtime)
+	assert.ErrorContains(s.Reload(ctx), "parsing sets")
+	assertInSet(t, s, "bad-words", "changed", true)
+
+	// as does a missing one
+	assert.NoError(os.Remove(p))
+	assert.Error(s.Reload(ctx))
+	assertInSet(t, s, "bad-words", "changed", true)
+
+	// the base sets were not modified
+	assert.Equal(map[string]bool{"hardcoded": true}, s.base["bad-words"])
+}
+
+func TestReloadingSetStoreHTTP(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var lk sync.Mutex
+	body, etag, status := `{"bad-words": ["remote"]}`, `"v1"`, http.StatusOK
+	var requests, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lk.Lock()
+		defer lk.Unlock()
+		requests++
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		io.WriteString(w, body)
+	}))
+	defer srv.Close()
+	set := func(b, e string, code int) {
+		lk.Lock()
+		defer lk.Unlock()
+		body, etag, status = b, e, code
+	}
+
+	s := NewReloadingSetStore(srv.URL+"/sets.json", testBaseSets())
+	s.Client = srv.Client()
+	s.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	assert.NoError(s.Reload(ctx))
+	assertInSet(t, s, "bad-words", "remote", true)
+	assertInSet(t, s, "bad-hashtags", "spam", true)
+
+	// the ETag is sent back, and a 304 keeps the current sets
+	assert.NoError(s.Reload(ctx))
+	assert.Equal(1, notModified)
+	assertInSet(t, s, "bad-words", "remote", true)
+
+	set(`{"bad-words": ["updated"]}`, `"v2"`, http.StatusOK)
+	assert.NoError(s.Reload(ctx))
+	assertInSet(t, s, "bad-words", "updated", true)
+	assertInSet(t, s, "bad-words", "remote", false)
+
+	// errors keep the previous sets
+	set("", "", http.StatusInternalServerError)
+	assert.ErrorContains(s.Reload(ctx), "HTTP status 500")
+	assertInSet(t, s, "bad-words", "updated", true)
+
+	set(`not json`, `"v3"`, http.StatusOK)
+	assert.ErrorContains(s.Reload(ctx), "parsing sets")
+	assertInSet(t, s, "bad-words", "updated", true)
+
+	assert.Equal(5, requests)
+
+	srv.Close()
+	assert.Error(s.Reload(ctx))
+	assertInSet(t, s, "bad-words", "updated", true)
+}
+
+func TestReloadingSetStoreRunReload(t *testing.T) {
+	assert := assert.New(t)
+	p := filepath.Join(t.TempDir(), "sets.json")
+	assert.NoError(os.WriteFile(p, []byte(`{"bad-words": ["first"]}`), 0644))
+
+	s := NewReloadingSetStore(p, NewMemSetStore())
+	s.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- s.RunReload(ctx, 10*time.Millisecond)
+	}()
+
+	// loads immediately, then again once the file changes
+	waitFor := func(val string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if ok, _ := s.InSet(context.Background(), "bad-words", val); ok {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("%q was never loaded", val)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	waitFor("first")
+	assert.NoError(os.WriteFile(p, []byte(`{"bad-words": ["second"]}`), 0644))
+	later := time.Now().Add(time.Hour)
+	assert.NoError(os.Chtimes(p, later, later))
+	waitFor("second")
+
+	cancel()
+	assert.NoError(<-done)
+}
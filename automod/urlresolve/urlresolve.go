@@ -0,0 +1,145 @@
+// Resolves links through URL shortener services (like bit.ly) to their final destination, so rules can inspect where a link actually goes.
+//
+// Only hosts in the configured set of shorteners are ever requested: redirects to any other host are returned without being fetched. This limits outbound requests to well-known services, instead of arbitrary (possibly malicious, or internal) hosts linked from content.
+package urlresolve
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Hosts of commonly used URL shortener services
+var DefaultShorteners = []string{
+	"bit.ly",
+	"buff.ly",
+	"cutt.ly",
+	"dlvr.it",
+	"goo.gl",
+	"is.gd",
+	"lnkd.in",
+	"ow.ly",
+	"rb.gy",
+	"rebrand.ly",
+	"s.id",
+	"shorturl.at",
+	"t.co",
+	"t.ly",
+	"tiny.cc",
+	"tinyurl.com",
+}
+
+type ResolverOptions struct {
+	// Timeout for each request to a shortener service
+	Timeout time.Duration
+	// Maximum number of redirects to follow (eg, one shortener linking to another)
+	MaxRedirects int
+	// Hosts of URL shortener services to resolve (lower-case)
+	Shorteners []string
+	UserAgent  string
+}
+
+func DefaultResolverOptions() ResolverOptions {
+	return ResolverOptions{
+		Timeout:      5 * time.Second,
+		MaxRedirects: 5,
+		Shorteners:   DefaultShorteners,
+		UserAgent:    "indigo-automod",
+	}
+}
+
+type Resolver struct {
+	Client       *http.Client
+	MaxRedirects int
+	UserAgent    string
+	shorteners   map[string]bool
+}
+
+func NewResolver(opts ResolverOptions) *Resolver {
+	shorteners := make(map[string]bool, len(opts.Shorteners))
+	for _, h := range opts.Shorteners {
+		shorteners[strings.ToLower(h)] = true
+	}
+	return &Resolver{
+		Client: &http.Client{
+			Timeout: opts.Timeout,
+			// redirects are handled manually, one hop at a time
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		MaxRedirects: opts.MaxRedirects,
+		UserAgent:    opts.UserAgent,
+		shorteners:   shorteners,
+	}
+}
+
+// Whether the URL is on a known shortener service
+func (r *Resolver) IsShortener(u *url.URL) bool {
+	return r.shorteners[strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")]
+}
+
+// Follows redirects from shortener services, and returns the first URL which is not on a shortener (which is not itself fetched). URLs which are not on a shortener are returned unchanged.
+func (r *Resolver) Resolve(ctx context.Context, raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+	for i := 0; r.IsShortener(u); i++ {
+		if i >= r.MaxRedirects {
+			return "", fmt.Errorf("too many redirects resolving URL: %s", raw)
+		}
+		next, err := r.next(ctx, u)
+		if err != nil {
+			return "", err
+		}
+		u = next
+	}
+	return u.String(), nil
+}
+
+// Fetches a single URL and returns the redirect target.
+func (r *Resolver) next(ctx context.Context, u *url.URL) (*url.URL, error) {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported URL scheme: %s", u.Scheme)
+	}
+	resp, err := r.do(ctx, http.MethodHead, u)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		resp, err = r.do(ctx, http.MethodGet, u)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("shortener did not redirect (HTTP %d): %s", resp.StatusCode, u)
+	}
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return nil, fmt.Errorf("shortener redirect had no location: %s", u)
+	}
+	// location may be relative
+	return u.Parse(loc)
+}
+
+func (r *Resolver) do(ctx context.Context, method string, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if r.UserAgent != "" {
+		req.Header.Set("User-Agent", r.UserAgent)
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// only the headers are needed
+	resp.Body.Close()
+	return resp, nil
+}
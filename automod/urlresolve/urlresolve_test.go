@@ -0,0 +1,60 @@
+package urlresolve
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/abc":
+			http.Redirect(w, r, "/def", http.StatusMovedPermanently)
+		case "/def":
+			http.Redirect(w, r, "https://example.com/landing?x=1", http.StatusFound)
+		case "/get-only":
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			http.Redirect(w, r, "https://example.com/other", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	srvURL, err := url.Parse(srv.URL)
+	assert.NoError(err)
+
+	opts := DefaultResolverOptions()
+	opts.Shorteners = []string{srvURL.Hostname()}
+	r := NewResolver(opts)
+
+	out, err := r.Resolve(ctx, srv.URL+"/abc")
+	assert.NoError(err)
+	assert.Equal("https://example.com/landing?x=1", out)
+
+	out, err = r.Resolve(ctx, srv.URL+"/get-only")
+	assert.NoError(err)
+	assert.Equal("https://example.com/other", out)
+
+	// not a shortener: returned as-is, without a request
+	out, err = r.Resolve(ctx, "https://example.com/abc")
+	assert.NoError(err)
+	assert.Equal("https://example.com/abc", out)
+
+	_, err = r.Resolve(ctx, srv.URL+"/loop")
+	assert.Error(err)
+	_, err = r.Resolve(ctx, srv.URL+"/missing")
+	assert.Error(err)
+}
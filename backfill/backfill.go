@@ -6,7 +6,6 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
-	"net/http"
 	"sync"
 	"time"
 
@@ -18,7 +17,6 @@ import (
 	"github.com/bluesky-social/indigo/repomgr"
 	"github.com/ipfs/go-cid"
 	typegen "github.com/whyrusleeping/cbor-gen"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	"golang.org/x/time/rate"
 )
@@ -66,9 +64,19 @@ type Backfiller struct {
 	// Number of records to process in parallel for each backfill
 	ParallelRecordCreates int
 	// Prefix match for records to backfill i.e. app.bsky.feed.app/
-	// If empty, all records will be backfilled
-	NSIDFilter   string
+	// If empty (and NSIDFilters is too), all records will be backfilled
+	NSIDFilter string
+	// Additional prefixes; records matching NSIDFilter or any of these are backfilled
+	NSIDFilters []string
+	// If set, only records (matching the prefixes) for which it returns true are backfilled, or handled in HandleEvent
+	RecordFilter func(collection, rkey string) bool
 	CheckoutPath string
+	// Where repos are fetched from; if nil, from CheckoutPath
+	Source RepoSource
+	// Priority of jobs created for repos first seen in an event, if the store supports priorities (see PriorityStore)
+	DiscoveredPriority int
+	// If set, repos are processed as they are downloaded (see repo.StreamReader), rather than loaded in memory first. Records are then backfilled in the order of the CAR file, so resumable jobs start over instead of resuming from their cursors.
+	StreamRepos bool
 
 	syncLimiter *rate.Limiter
 
@@ -76,6 +84,13 @@ type Backfiller struct {
 	magicHeaderVal string
 
 	stop chan chan struct{}
+
+	// protects paused, inFlight, and finished
+	ctlLk    sync.Mutex
+	paused   bool
+	inFlight int
+	// finished jobs, for throughput
+	finished *throughputTracker
 }
 
 var (
@@ -102,8 +117,15 @@ type BackfillOptions struct {
 	ParallelBackfills     int
 	ParallelRecordCreates int
 	NSIDFilter            string
+	NSIDFilters           []string
+	RecordFilter          func(collection, rkey string) bool
 	SyncRequestsPerSecond int
 	CheckoutPath          string
+	// If set, repos are fetched from this source instead of CheckoutPath (and SyncRequestsPerSecond does not apply)
+	Source     RepoSource
+	Priorities JobPriorities
+	// Process repos as they are downloaded, with bounded memory, see Backfiller.StreamRepos
+	StreamRepos bool
 }
 
 func DefaultBackfillOptions() *BackfillOptions {
@@ -113,6 +135,7 @@ func DefaultBackfillOptions() *BackfillOptions {
 		NSIDFilter:            "",
 		SyncRequestsPerSecond: 2,
 		CheckoutPath:          "https://bsky.social/xrpc/com.atproto.sync.getRepo",
+		Priorities:            DefaultJobPriorities(),
 	}
 }
 
@@ -137,12 +160,33 @@ func NewBackfiller(
 		ParallelBackfills:     opts.ParallelBackfills,
 		ParallelRecordCreates: opts.ParallelRecordCreates,
 		NSIDFilter:            opts.NSIDFilter,
+		NSIDFilters:           opts.NSIDFilters,
+		RecordFilter:          opts.RecordFilter,
 		syncLimiter:           rate.NewLimiter(rate.Limit(opts.SyncRequestsPerSecond), 1),
 		CheckoutPath:          opts.CheckoutPath,
+		Source:                opts.Source,
+		DiscoveredPriority:    opts.Priorities.Discovered,
+		StreamRepos:           opts.StreamRepos,
 		stop:                  make(chan chan struct{}),
 	}
 }
 
+// The configured Source, or else the getRepo endpoint at CheckoutPath.
+func (b *Backfiller) source() RepoSource {
+	if b.Source != nil {
+		return b.Source
+	}
+	src := &HTTPSource{
+		CheckoutPath: b.CheckoutPath,
+		UserAgent:    fmt.Sprintf("atproto-backfill-%s/0.0.1", b.Name),
+		Limiter:      b.syncLimiter,
+	}
+	if b.magicHeaderKey != "" && b.magicHeaderVal != "" {
+		src.Headers = map[string]string{b.magicHeaderKey: b.magicHeaderVal}
+	}
+	return src
+}
+
 // Start starts the backfill processor routine
 func (b *Backfiller) Start() {
 	ctx := context.Background()
@@ -152,6 +196,11 @@ func (b *Backfiller) Start() {
 
 	sem := make(chan struct{}, b.ParallelBackfills)
 
+	// NOTE: separate from ctx, so stopping doesn't cancel in-progress jobs
+	statusCtx, cancelStatus := context.WithCancel(context.Background())
+	defer cancelStatus()
+	go b.reportStatus(statusCtx, 30*time.Second)
+
 	for {
 		select {
 		case stopped := <-b.stop:
@@ -161,20 +210,29 @@ func (b *Backfiller) Start() {
 		default:
 		}
 
+		// reserve an in-flight slot before fetching a job, so that Drain can't miss a job which is being fetched
+		if !b.reserveJob() {
+			time.Sleep(1 * time.Second)
+			continue
+		}
+
 		// Get the next job
 		job, err := b.Store.GetNextEnqueuedJob(ctx)
 		if err != nil {
+			b.releaseJob()
 			log.Error("failed to get next enqueued job", "error", err)
 			time.Sleep(1 * time.Second)
 			continue
 		} else if job == nil {
-			time.Sleep(1 * time.Second)
+			b.releaseJob()
+			b.waitForJobs()
 			continue
 		}
 
 		// Mark the backfill as "in progress"
 		err = job.SetState(ctx, StateInProgress)
 		if err != nil {
+			b.releaseJob()
 			log.Error("failed to set job state", "error", err)
 			continue
 		}
@@ -183,11 +241,83 @@ func (b *Backfiller) Start() {
 		go func(j Job) {
 			b.BackfillRepo(ctx, j)
 			backfillJobsProcessed.WithLabelValues(b.Name).Inc()
+			b.throughput().record(time.Now())
 			<-sem
+			b.releaseJob()
 		}(job)
 	}
 }
 
+// Pause stops the backfill processor from starting any new jobs. Jobs which are already in progress continue to run. Has no effect if already paused.
+func (b *Backfiller) Pause() {
+	b.ctlLk.Lock()
+	defer b.ctlLk.Unlock()
+	if !b.paused {
+		slog.Info("pausing backfill processor", "source", "backfiller", "name", b.Name)
+		backfillPaused.WithLabelValues(b.Name).Set(1)
+	}
+	b.paused = true
+}
+
+// Resume allows the backfill processor to start new jobs again, after Pause or Drain.
+func (b *Backfiller) Resume() {
+	b.ctlLk.Lock()
+	defer b.ctlLk.Unlock()
+	if b.paused {
+		slog.Info("resuming backfill processor", "source", "backfiller", "name", b.Name)
+		backfillPaused.WithLabelValues(b.Name).Set(0)
+	}
+	b.paused = false
+}
+
+// Drain pauses the backfill processor (see Pause), then blocks until all in-progress jobs have finished, or the context is done. The processor remains paused afterwards; call Resume to continue.
+func (b *Backfiller) Drain(ctx context.Context) error {
+	b.Pause()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if b.InFlight() == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Paused returns true if the backfill processor is not starting new jobs.
+func (b *Backfiller) Paused() bool {
+	b.ctlLk.Lock()
+	defer b.ctlLk.Unlock()
+	return b.paused
+}
+
+// InFlight returns the number of jobs currently being processed.
+func (b *Backfiller) InFlight() int {
+	b.ctlLk.Lock()
+	defer b.ctlLk.Unlock()
+	return b.inFlight
+}
+
+// returns false (without reserving) if paused
+func (b *Backfiller) reserveJob() bool {
+	b.ctlLk.Lock()
+	defer b.ctlLk.Unlock()
+	if b.paused {
+		return false
+	}
+	b.inFlight++
+	return true
+}
+
+func (b *Backfiller) releaseJob() {
+	b.ctlLk.Lock()
+	defer b.ctlLk.Unlock()
+	b.inFlight--
+}
+
 // Stop stops the backfill processor
 func (b *Backfiller) Stop() {
 	log := slog.With("source", "backfiller", "name", b.Name)
@@ -253,11 +383,15 @@ func (b *Backfiller) FlushBuffer(ctx context.Context, job Job) int {
 }
 
 type recordQueueItem struct {
+	seq        int
 	recordPath string
 	nodeCid    cid.Cid
+	// set when streaming the repo
+	data []byte
 }
 
 type recordResult struct {
+	seq        int
 	recordPath string
 	err        error
 }
@@ -277,41 +411,11 @@ func (b *Backfiller) BackfillRepo(ctx context.Context, job Job) {
 	}
 	log.Info(fmt.Sprintf("processing backfill for %s", repoDid))
 
-	url := fmt.Sprintf("%s?did=%s", b.CheckoutPath, repoDid)
-
-	if job.Rev() != "" {
-		url = url + fmt.Sprintf("&since=%s", job.Rev())
-	}
-
-	// GET and CAR decode the body
-	client := &http.Client{
-		Transport: otelhttp.NewTransport(http.DefaultTransport),
-		Timeout:   600 * time.Second,
-	}
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		log.Error("failed to create request", "error", err)
-		return
-	}
-
-	req.Header.Set("Accept", "application/vnd.ipld.car")
-	req.Header.Set("User-Agent", fmt.Sprintf("atproto-backfill-%s/0.0.1", b.Name))
-	if b.magicHeaderKey != "" && b.magicHeaderVal != "" {
-		req.Header.Set(b.magicHeaderKey, b.magicHeaderVal)
-	}
-
-	b.syncLimiter.Wait(ctx)
-
-	resp, err := client.Do(req)
+	body, err := b.source().GetRepo(ctx, repoDid, job.Rev())
 	if err != nil {
-		log.Error("failed to send request", "error", err)
-		return
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		log.Info("failed to get repo", "status", resp.StatusCode)
+		log.Info("failed to get repo", "error", err)
 		reason := "unknown error"
-		if resp.StatusCode == http.StatusBadRequest {
+		if errors.Is(err, ErrRepoNotFound) {
 			reason = "repo not found"
 		}
 		state := fmt.Sprintf("failed (%s)", reason)
@@ -331,13 +435,29 @@ func (b *Backfiller) BackfillRepo(ctx context.Context, job Job) {
 	}
 
 	instrumentedReader := instrumentedReader{
-		source:  resp.Body,
+		source:  body,
 		counter: backfillBytesProcessed.WithLabelValues(b.Name),
 	}
 
 	defer instrumentedReader.Close()
 
-	r, err := repo.ReadRepoFromCar(ctx, instrumentedReader)
+	var r *repo.Repo
+	var sr *repo.StreamReader
+	var rev string
+	if b.StreamRepos {
+		sr, err = repo.NewStreamReader(instrumentedReader, nil)
+		if err == nil {
+			var sc *repo.SignedCommit
+			if sc, err = sr.Commit(ctx); err == nil {
+				rev = sc.Rev
+			}
+		}
+	} else {
+		r, err = repo.ReadRepoFromCar(ctx, instrumentedReader)
+		if err == nil {
+			rev = r.SignedCommit().Rev
+		}
+	}
 	if err != nil {
 		log.Error("failed to read repo from car", "error", err)
 
@@ -357,7 +477,18 @@ func (b *Backfiller) BackfillRepo(ctx context.Context, job Job) {
 		return
 	}
 
+	// resume from where a previous attempt got to, if the job records it
+	rj, resumable := job.(ResumableJob)
+	var tracker *cursorTracker
+	if resumable && sr == nil {
+		tracker = newCursorTracker(rj.Cursors())
+		if len(tracker.resume) > 0 {
+			log.Info("resuming backfill from previous attempt", "collections", len(tracker.resume))
+		}
+	}
+
 	numRecords := 0
+	numSkipped := 0
 	numRoutines := b.ParallelRecordCreates
 	recordQueue := make(chan recordQueueItem, numRoutines)
 	recordResults := make(chan recordResult, numRoutines)
@@ -367,48 +498,71 @@ func (b *Backfiller) BackfillRepo(ctx context.Context, job Job) {
 	// Producer routine
 	go func() {
 		defer close(recordQueue)
-		if err := r.ForEach(ctx, b.NSIDFilter, func(recordPath string, nodeCid cid.Cid) error {
+		if sr != nil {
+			if err := sr.ForEach(ctx, func(recordPath string, nodeCid cid.Cid, data []byte) error {
+				if !b.wantRecord(recordPath) {
+					return nil
+				}
+				recordQueue <- recordQueueItem{seq: numRecords, recordPath: recordPath, nodeCid: nodeCid, data: data}
+				numRecords++
+				return ctx.Err()
+			}); err != nil {
+				log.Error("failed to stream records in repo", "err", err)
+			}
+			return
+		}
+		if err := b.forEachRecord(ctx, r, func(recordPath string, nodeCid cid.Cid) error {
+			if tracker != nil && tracker.skip(recordPath) {
+				numSkipped++
+				return nil
+			}
+			recordQueue <- recordQueueItem{seq: numRecords, recordPath: recordPath, nodeCid: nodeCid}
 			numRecords++
-			recordQueue <- recordQueueItem{recordPath: recordPath, nodeCid: nodeCid}
-			return nil
+			return ctx.Err()
 		}); err != nil {
 			log.Error("failed to iterated records in repo", "err", err)
 		}
 	}()
 
-	rev := r.SignedCommit().Rev
-
 	// Consumer routines
 	for i := 0; i < numRoutines; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			for item := range recordQueue {
-				blk, err := r.Blockstore().Get(ctx, item.nodeCid)
-				if err != nil {
-					recordResults <- recordResult{recordPath: item.recordPath, err: fmt.Errorf("failed to get blocks for record: %w", err)}
+				data := item.data
+				if sr != nil && data == nil {
+					recordResults <- recordResult{seq: item.seq, recordPath: item.recordPath, err: fmt.Errorf("record %s was streamed under another path already", item.nodeCid)}
 					continue
 				}
-				rec, err := lexutil.CborDecodeValue(blk.RawData())
+				if sr == nil {
+					blk, err := r.Blockstore().Get(ctx, item.nodeCid)
+					if err != nil {
+						recordResults <- recordResult{seq: item.seq, recordPath: item.recordPath, err: fmt.Errorf("failed to get blocks for record: %w", err)}
+						continue
+					}
+					data = blk.RawData()
+				}
+				rec, err := lexutil.CborDecodeValue(data)
 				if err != nil {
-					recordResults <- recordResult{recordPath: item.recordPath, err: fmt.Errorf("failed to decode record: %w", err)}
+					recordResults <- recordResult{seq: item.seq, recordPath: item.recordPath, err: fmt.Errorf("failed to decode record: %w", err)}
 					continue
 				}
 
 				recM, ok := rec.(typegen.CBORMarshaler)
 				if !ok {
-					recordResults <- recordResult{recordPath: item.recordPath, err: fmt.Errorf("failed to cast record to CBORMarshaler")}
+					recordResults <- recordResult{seq: item.seq, recordPath: item.recordPath, err: fmt.Errorf("failed to cast record to CBORMarshaler")}
 					continue
 				}
 
 				err = b.HandleCreateRecord(ctx, repoDid, rev, item.recordPath, recM, &item.nodeCid)
 				if err != nil {
-					recordResults <- recordResult{recordPath: item.recordPath, err: fmt.Errorf("failed to handle create record: %w", err)}
+					recordResults <- recordResult{seq: item.seq, recordPath: item.recordPath, err: fmt.Errorf("failed to handle create record: %w", err)}
 					continue
 				}
 
 				backfillRecordsProcessed.WithLabelValues(b.Name).Inc()
-				recordResults <- recordResult{recordPath: item.recordPath, err: err}
+				recordResults <- recordResult{seq: item.seq, recordPath: item.recordPath, err: err}
 			}
 		}()
 	}
@@ -422,6 +576,12 @@ func (b *Backfiller) BackfillRepo(ctx context.Context, job Job) {
 			if result.err != nil {
 				log.Error("Error processing record", "record", result.recordPath, "error", result.err)
 			}
+			// NOTE: records which failed are not retried, so they count as processed
+			if tracker != nil && tracker.finish(result.seq, result.recordPath) && ctx.Err() == nil {
+				if err := rj.SetCursors(ctx, tracker.checkpoint()); err != nil {
+					log.Error("failed to checkpoint backfill cursors", "error", err)
+				}
+			}
 		}
 	}()
 
@@ -429,9 +589,29 @@ func (b *Backfiller) BackfillRepo(ctx context.Context, job Job) {
 	close(recordResults)
 	resultWG.Wait()
 
-	if err := job.SetRev(ctx, r.SignedCommit().Rev); err != nil {
+	if ctx.Err() != nil {
+		// leave the job to be retried, resuming from the last record processed
+		log.Warn("backfill interrupted", "records_backfilled", numRecords, "error", ctx.Err())
+		ctx := context.WithoutCancel(ctx)
+		if tracker != nil {
+			if err := rj.SetCursors(ctx, tracker.checkpoint()); err != nil {
+				log.Error("failed to checkpoint backfill cursors", "error", err)
+			}
+		}
+		if err := job.SetState(ctx, "failed (interrupted)"); err != nil {
+			log.Error("failed to set job state", "error", err)
+		}
+		return
+	}
+
+	if err := job.SetRev(ctx, rev); err != nil {
 		log.Error("failed to update rev after backfilling repo", "err", err)
 	}
+	if tracker != nil {
+		if err := rj.SetCursors(ctx, nil); err != nil {
+			log.Error("failed to clear backfill cursors", "error", err)
+		}
+	}
 
 	// Process buffered operations, marking the job as "complete" when done
 	numProcessed := b.FlushBuffer(ctx, job)
@@ -439,6 +619,7 @@ func (b *Backfiller) BackfillRepo(ctx context.Context, job Job) {
 	log.Info("backfill complete",
 		"buffered_records_processed", numProcessed,
 		"records_backfilled", numRecords,
+		"records_skipped", numSkipped,
 		"duration", time.Since(start),
 	)
 }
@@ -476,6 +657,9 @@ func (bf *Backfiller) HandleEvent(ctx context.Context, evt *atproto.SyncSubscrib
 
 	var ops []*bufferedOp
 	for _, op := range evt.Ops {
+		if !bf.wantRecord(op.Path) {
+			continue
+		}
 		switch op.Action {
 		case "create", "update":
 			cc, rec, err := bf.getRecord(ctx, r, op)
@@ -547,7 +731,13 @@ func (bf *Backfiller) BufferOps(ctx context.Context, repo string, since *string,
 		if !errors.Is(err, ErrJobNotFound) {
 			return false, err
 		}
-		if qerr := bf.Store.EnqueueJob(ctx, repo); qerr != nil {
+		var qerr error
+		if ps, ok := bf.Store.(PriorityStore); ok {
+			qerr = ps.EnqueueJobWithPriority(ctx, repo, bf.DiscoveredPriority)
+		} else {
+			qerr = bf.Store.EnqueueJob(ctx, repo)
+		}
+		if qerr != nil {
 			return false, fmt.Errorf("failed to enqueue job for unknown repo: %w", qerr)
 		}
 
@@ -562,9 +752,5 @@ func (bf *Backfiller) BufferOps(ctx context.Context, repo string, since *string,
 	return j.BufferOps(ctx, since, rev, ops)
 }
 
-// MaxRetries is the maximum number of times to retry a backfill job
+// MaxRetries is the default maximum number of times to retry a backfill job (see RetryPolicy)
 var MaxRetries = 10
-
-func computeExponentialBackoff(attempt int) time.Duration {
-	return time.Duration(1<<uint(attempt)) * 10 * time.Second
-}
@@ -0,0 +1,79 @@
+package backfill
+
+import (
+	"context"
+	"maps"
+	"strings"
+)
+
+// CursorCheckpointInterval is how many records are processed between saves of a resumable job's cursors.
+var CursorCheckpointInterval = 1000
+
+// ResumableJob is implemented by jobs which record how far through each collection a backfill has got, so that a backfill which fails or is interrupted mid-repo resumes from that point instead of re-processing every record. The repo is still downloaded again.
+type ResumableJob interface {
+	Job
+	// Cursors returns the last record key processed in each collection
+	Cursors() map[string]string
+	// SetCursors replaces (and persists) the cursors; nil clears them
+	SetCursors(ctx context.Context, cursors map[string]string) error
+}
+
+// Tracks how far through each collection a backfill has got. Records are processed in parallel, so a record only counts once every record before it (in repo order) has also been processed. finish is only called from a single goroutine.
+type cursorTracker struct {
+	// from the previous attempt; read-only
+	resume map[string]string
+
+	cursors map[string]string
+	// seq of the first unfinished record
+	next int
+	// finished records after next, by seq
+	done map[int]string
+	// records processed since the last checkpoint
+	pending int
+}
+
+func newCursorTracker(resume map[string]string) *cursorTracker {
+	return &cursorTracker{
+		resume:  resume,
+		cursors: maps.Clone(resume),
+		done:    map[int]string{},
+	}
+}
+
+func splitRecordPath(path string) (string, string) {
+	collection, rkey, _ := strings.Cut(path, "/")
+	return collection, rkey
+}
+
+// Whether the record was processed by a previous attempt. Repos are iterated in key order, so that is any record up to the collection's cursor.
+func (t *cursorTracker) skip(path string) bool {
+	collection, rkey := splitRecordPath(path)
+	cursor, ok := t.resume[collection]
+	return ok && rkey <= cursor
+}
+
+// Records that the record with the given sequence number (in the order records were queued) has been processed, and returns whether the cursors are due to be checkpointed.
+func (t *cursorTracker) finish(seq int, path string) bool {
+	t.done[seq] = path
+	for {
+		p, ok := t.done[t.next]
+		if !ok {
+			break
+		}
+		delete(t.done, t.next)
+		t.next++
+		t.pending++
+		if t.cursors == nil {
+			t.cursors = map[string]string{}
+		}
+		collection, rkey := splitRecordPath(p)
+		t.cursors[collection] = rkey
+	}
+	return t.pending >= CursorCheckpointInterval
+}
+
+// Returns a copy of the cursors, and resets the checkpoint counter.
+func (t *cursorTracker) checkpoint() map[string]string {
+	t.pending = 0
+	return maps.Clone(t.cursors)
+}
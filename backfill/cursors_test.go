@@ -0,0 +1,68 @@
+package backfill
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestCursorTracker(t *testing.T) {
+	assert := assert.New(t)
+
+	tracker := newCursorTracker(map[string]string{"app.bsky.feed.like": "3kb"})
+	assert.True(tracker.skip("app.bsky.feed.like/3ka"))
+	assert.True(tracker.skip("app.bsky.feed.like/3kb"))
+	assert.False(tracker.skip("app.bsky.feed.like/3kc"))
+	assert.False(tracker.skip("app.bsky.feed.post/3ka"))
+
+	paths := []string{
+		"app.bsky.feed.like/3kc",
+		"app.bsky.feed.like/3kd",
+		"app.bsky.feed.post/3ka",
+		"app.bsky.feed.post/3kb",
+	}
+	// finished out of order: nothing counts until the first record is done
+	tracker.finish(1, paths[1])
+	tracker.finish(3, paths[3])
+	assert.Equal(map[string]string{"app.bsky.feed.like": "3kb"}, tracker.checkpoint())
+
+	tracker.finish(0, paths[0])
+	assert.Equal(map[string]string{"app.bsky.feed.like": "3kd"}, tracker.checkpoint())
+
+	tracker.finish(2, paths[2])
+	assert.Equal(map[string]string{"app.bsky.feed.like": "3kd", "app.bsky.feed.post": "3kb"}, tracker.checkpoint())
+}
+
+func TestGormstoreResume(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(db.AutoMigrate(&GormDBJob{}))
+
+	store := NewGormstore(db)
+	assert.NoError(store.EnqueueJob(ctx, "did:plc:a"))
+	job, err := store.GetNextEnqueuedJob(ctx)
+	assert.NoError(err)
+	assert.NoError(job.SetState(ctx, StateInProgress))
+	assert.NoError(job.(ResumableJob).SetCursors(ctx, map[string]string{"app.bsky.feed.post": "3kabc"}))
+
+	// a new process picks up the interrupted job, with its cursors
+	store = NewGormstore(db)
+	n, err := store.ResumeInterrupted(ctx)
+	assert.NoError(err)
+	assert.Equal(int64(1), n)
+	assert.NoError(store.LoadJobs(ctx))
+	job, err = store.GetNextEnqueuedJob(ctx)
+	assert.NoError(err)
+	if assert.NotNil(job) {
+		assert.Equal("did:plc:a", job.Repo())
+		assert.Equal(map[string]string{"app.bsky.feed.post": "3kabc"}, job.(ResumableJob).Cursors())
+	}
+}
@@ -0,0 +1,75 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/bluesky-social/indigo/repo"
+	"github.com/ipfs/go-cid"
+)
+
+// The prefixes to walk repos from, sorted, and without any which are covered by a shorter one, so each record is visited once and in key order. A single empty prefix walks the whole repo.
+func walkPrefixes(single string, multi []string) []string {
+	all := append([]string{single}, multi...)
+	if len(multi) > 0 && single == "" {
+		all = multi
+	}
+	all = slices.Clone(all)
+	slices.Sort(all)
+	out := all[:0]
+	for _, p := range all {
+		if len(out) > 0 && strings.HasPrefix(p, out[len(out)-1]) {
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// Whether a record is backfilled, according to the prefix filters and RecordFilter.
+func (b *Backfiller) wantRecord(path string) bool {
+	matched := b.NSIDFilter == "" && len(b.NSIDFilters) == 0
+	if b.NSIDFilter != "" && strings.HasPrefix(path, b.NSIDFilter) {
+		matched = true
+	}
+	for _, prefix := range b.NSIDFilters {
+		if matched {
+			break
+		}
+		matched = strings.HasPrefix(path, prefix)
+	}
+	if !matched {
+		return false
+	}
+	if b.RecordFilter != nil {
+		collection, rkey := splitRecordPath(path)
+		return b.RecordFilter(collection, rkey)
+	}
+	return true
+}
+
+// Calls cb for each record in the repo which is backfilled, in key order. Only the parts of the repo matching the prefix filters are walked.
+func (b *Backfiller) forEachRecord(ctx context.Context, r *repo.Repo, cb func(path string, nodeCid cid.Cid) error) error {
+	for _, prefix := range walkPrefixes(b.NSIDFilter, b.NSIDFilters) {
+		err := r.ForEach(ctx, prefix, func(path string, nodeCid cid.Cid) error {
+			// the walk starts at the prefix, and continues to the end of the repo
+			if !strings.HasPrefix(path, prefix) {
+				return repo.ErrDoneIterating
+			}
+			if b.RecordFilter != nil {
+				collection, rkey := splitRecordPath(path)
+				if !b.RecordFilter(collection, rkey) {
+					return nil
+				}
+			}
+			return cb(path, nodeCid)
+		})
+		// NOTE: ForEach only ignores ErrDoneIterating when it is not wrapped, which it is when returned from deeper in the tree
+		if err != nil && !errors.Is(err, repo.ErrDoneIterating) {
+			return err
+		}
+	}
+	return nil
+}
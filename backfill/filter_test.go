@@ -0,0 +1,91 @@
+package backfill_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bluesky-social/indigo/backfill"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	typegen "github.com/whyrusleeping/cbor-gen"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Backfills the test repo with the given options, and returns the number of records by collection.
+func backfillTestRepo(t *testing.T, opts *backfill.BackfillOptions) map[string]int {
+	ctx := context.Background()
+
+	car, err := os.ReadFile("../testing/testdata/paul_staging.repo.car")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "did:plc:abc123.car"), car, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&backfill.GormDBJob{}); err != nil {
+		t.Fatal(err)
+	}
+	store := backfill.NewGormstore(db)
+	if err := store.EnqueueJob(ctx, "did:plc:abc123"); err != nil {
+		t.Fatal(err)
+	}
+
+	var lk sync.Mutex
+	counts := map[string]int{}
+	opts.Source = backfill.NewDirSource(dir, nil)
+	bf := backfill.NewBackfiller("filter-test", store, func(ctx context.Context, repo string, rev string, path string, rec typegen.CBORMarshaler, cid *cid.Cid) error {
+		collection, _, _ := strings.Cut(path, "/")
+		lk.Lock()
+		counts[collection]++
+		lk.Unlock()
+		return nil
+	}, nil, nil, opts)
+
+	job, err := store.GetJob(ctx, "did:plc:abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bf.BackfillRepo(ctx, job)
+	return counts
+}
+
+func TestRecordFilters(t *testing.T) {
+	assert := assert.New(t)
+
+	all := backfillTestRepo(t, backfill.DefaultBackfillOptions())
+	assert.Greater(len(all), 2)
+
+	// a single prefix only matches records with that prefix, not everything after it
+	opts := backfill.DefaultBackfillOptions()
+	opts.NSIDFilter = "app.bsky.feed.post/"
+	assert.Equal(map[string]int{"app.bsky.feed.post": all["app.bsky.feed.post"]}, backfillTestRepo(t, opts))
+
+	// several prefixes, including overlapping ones
+	opts = backfill.DefaultBackfillOptions()
+	opts.NSIDFilters = []string{"app.bsky.graph.", "app.bsky.feed.post/", "app.bsky.graph.follow/"}
+	want := map[string]int{"app.bsky.feed.post": all["app.bsky.feed.post"]}
+	for collection, n := range all {
+		if strings.HasPrefix(collection, "app.bsky.graph.") {
+			want[collection] = n
+		}
+	}
+	assert.Equal(want, backfillTestRepo(t, opts))
+
+	// a predicate
+	opts = backfill.DefaultBackfillOptions()
+	opts.RecordFilter = func(collection, rkey string) bool {
+		return collection == "app.bsky.actor.profile" && rkey == "self"
+	}
+	assert.Equal(map[string]int{"app.bsky.actor.profile": 1}, backfillTestRepo(t, opts))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"maps"
 	"strings"
 	"sync"
 	"time"
@@ -29,6 +30,11 @@ type Gormjob struct {
 
 	retryCount int
 	retryAfter *time.Time
+	policy     *RetryPolicy
+
+	priority int
+
+	cursors map[string]string
 }
 
 type GormDBJob struct {
@@ -38,23 +44,36 @@ type GormDBJob struct {
 	Rev        string
 	RetryCount int
 	RetryAfter *time.Time
+	// Higher priority jobs are dequeued first. Not null, so existing rows get the default when the column is added.
+	Priority int `gorm:"index;not null;default:0"`
+	// Last record key processed in each collection, for resuming an interrupted backfill
+	Cursors map[string]string `gorm:"serializer:json"`
 }
 
 // Gormstore is a gorm-backed implementation of the Backfill Store interface
 type Gormstore struct {
+	// How failed jobs are retried; set before using the store
+	RetryPolicy RetryPolicy
+	// If set, enqueued jobs are announced on this Postgres notification channel, for ListenPostgres in other processes
+	NotifyChannel string
+	// signalled when jobs are enqueued
+	enqueued chan struct{}
+
 	lk   sync.RWMutex
 	jobs map[string]*Gormjob
 
 	qlk       sync.Mutex
-	taskQueue []string
+	taskQueue jobQueue
 
 	db *gorm.DB
 }
 
 func NewGormstore(db *gorm.DB) *Gormstore {
 	return &Gormstore{
-		jobs: make(map[string]*Gormjob),
-		db:   db,
+		RetryPolicy: DefaultRetryPolicy(),
+		enqueued:    make(chan struct{}, 1),
+		jobs:        make(map[string]*Gormjob),
+		db:          db,
 	}
 }
 
@@ -65,18 +84,30 @@ func (s *Gormstore) LoadJobs(ctx context.Context) error {
 }
 
 func (s *Gormstore) loadJobs(ctx context.Context, limit int) error {
-	var todo []string
-	if err := s.db.Model(GormDBJob{}).Limit(limit).Select("repo").
-		Where("state = 'enqueued' OR (state = 'failed' AND (retry_after = NULL OR retry_after < ?))", time.Now()).Scan(&todo).Error; err != nil {
+	var todo []GormDBJob
+	if err := s.db.Model(GormDBJob{}).Limit(limit).Select("repo", "priority").
+		Where("state = ? OR (state LIKE 'failed%' AND retry_after IS NOT NULL AND retry_after < ?)", StateEnqueued, time.Now()).
+		Order("priority DESC, id ASC").Scan(&todo).Error; err != nil {
 		return err
 	}
 
-	s.taskQueue = append(s.taskQueue, todo...)
+	for _, dbj := range todo {
+		s.taskQueue.push(dbj.Repo, dbj.Priority)
+	}
 
 	return nil
 }
 
 func (s *Gormstore) GetOrCreateJob(ctx context.Context, repo, state string) (Job, error) {
+	return s.GetOrCreateJobWithPriority(ctx, repo, state, 0)
+}
+
+// GetOrCreateJobWithPriority is like GetOrCreateJob, with the given priority for a new job. The priority of an existing job is not changed.
+func (s *Gormstore) GetOrCreateJobWithPriority(ctx context.Context, repo, state string, priority int) (Job, error) {
+	return s.getOrCreateJob(ctx, repo, state, priority)
+}
+
+func (s *Gormstore) getOrCreateJob(ctx context.Context, repo, state string, priority int) (*Gormjob, error) {
 	j, err := s.getJob(ctx, repo)
 	if err == nil {
 		return j, nil
@@ -86,7 +117,7 @@ func (s *Gormstore) GetOrCreateJob(ctx context.Context, repo, state string) (Job
 		return nil, err
 	}
 
-	if err := s.createJobForRepo(repo, state); err != nil {
+	if err := s.createJobForRepo(repo, state, priority); err != nil {
 		return nil, err
 	}
 
@@ -94,22 +125,33 @@ func (s *Gormstore) GetOrCreateJob(ctx context.Context, repo, state string) (Job
 }
 
 func (s *Gormstore) EnqueueJob(ctx context.Context, repo string) error {
-	_, err := s.GetOrCreateJob(ctx, repo, StateEnqueued)
+	return s.EnqueueJobWithPriority(ctx, repo, 0)
+}
+
+func (s *Gormstore) EnqueueJobWithPriority(ctx context.Context, repo string, priority int) error {
+	j, err := s.getOrCreateJob(ctx, repo, StateEnqueued, priority)
 	if err != nil {
 		return err
 	}
+	if j.Priority() < priority {
+		if err := j.SetPriority(ctx, priority); err != nil {
+			return err
+		}
+	}
 
 	s.qlk.Lock()
-	s.taskQueue = append(s.taskQueue, repo)
+	s.taskQueue.push(repo, j.Priority())
 	s.qlk.Unlock()
 
+	s.notifyEnqueued(ctx, repo)
 	return nil
 }
 
-func (s *Gormstore) createJobForRepo(repo, state string) error {
+func (s *Gormstore) createJobForRepo(repo, state string, priority int) error {
 	dbj := &GormDBJob{
-		Repo:  repo,
-		State: StateEnqueued,
+		Repo:     repo,
+		State:    state,
+		Priority: priority,
 	}
 	if err := s.db.Create(dbj).Error; err != nil {
 		if err == gorm.ErrDuplicatedKey {
@@ -132,9 +174,12 @@ func (s *Gormstore) createJobForRepo(repo, state string) error {
 		createdAt: time.Now(),
 		updatedAt: time.Now(),
 		state:     state,
+		priority:  priority,
 
 		dbj: dbj,
 		db:  s.db,
+
+		policy: &s.RetryPolicy,
 	}
 	s.jobs[repo] = j
 
@@ -197,6 +242,11 @@ func (s *Gormstore) loadJob(ctx context.Context, repo string) (*Gormjob, error)
 
 		retryCount: dbj.RetryCount,
 		retryAfter: dbj.RetryAfter,
+		policy:     &s.RetryPolicy,
+
+		priority: dbj.Priority,
+
+		cursors: dbj.Cursors,
 	}
 	s.lk.Lock()
 	defer s.lk.Unlock()
@@ -223,19 +273,18 @@ func (s *Gormstore) checkJobCache(ctx context.Context, repo string) *Gormjob {
 func (s *Gormstore) GetNextEnqueuedJob(ctx context.Context) (Job, error) {
 	s.qlk.Lock()
 	defer s.qlk.Unlock()
-	if len(s.taskQueue) == 0 {
+	if s.taskQueue.Len() == 0 {
 		if err := s.loadJobs(ctx, 1000); err != nil {
 			return nil, err
 		}
 
-		if len(s.taskQueue) == 0 {
+		if s.taskQueue.Len() == 0 {
 			return nil, nil
 		}
 	}
 
-	for len(s.taskQueue) > 0 {
-		first := s.taskQueue[0]
-		s.taskQueue = s.taskQueue[1:]
+	for s.taskQueue.Len() > 0 {
+		first := s.taskQueue.pop()
 
 		j, err := s.getJob(ctx, first)
 		if err != nil {
@@ -262,6 +311,43 @@ func (j *Gormjob) State() string {
 	return j.state
 }
 
+func (j *Gormjob) Priority() int {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+
+	return j.priority
+}
+
+// SetPriority persists a new priority for the job. Note that it does not re-enqueue the job.
+func (j *Gormjob) SetPriority(ctx context.Context, priority int) error {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+
+	j.priority = priority
+	j.updatedAt = time.Now()
+
+	j.dbj.Priority = priority
+	return j.db.Save(j.dbj).Error
+}
+
+func (j *Gormjob) Cursors() map[string]string {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+
+	return maps.Clone(j.cursors)
+}
+
+func (j *Gormjob) SetCursors(ctx context.Context, cursors map[string]string) error {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+
+	j.cursors = cursors
+	j.updatedAt = time.Now()
+
+	j.dbj.Cursors = cursors
+	return j.db.Save(j.dbj).Error
+}
+
 func (j *Gormjob) SetRev(ctx context.Context, r string) error {
 	j.lk.Lock()
 	defer j.lk.Unlock()
@@ -285,21 +371,18 @@ func (j *Gormjob) SetState(ctx context.Context, state string) error {
 	j.lk.Lock()
 	defer j.lk.Unlock()
 
-	j.state = state
 	j.updatedAt = time.Now()
 
 	if strings.HasPrefix(state, "failed") {
-		if j.retryCount < MaxRetries {
-			next := time.Now().Add(computeExponentialBackoff(j.retryCount))
-			j.retryAfter = &next
-			j.retryCount++
-		} else {
-			j.retryAfter = nil
-		}
+		j.retryCount++
+		state, j.retryAfter = j.policy.onFailure(state, j.retryCount, j.updatedAt)
 	}
+	j.state = state
 
 	// Persist the job to the database
 	j.dbj.State = state
+	j.dbj.RetryCount = j.retryCount
+	j.dbj.RetryAfter = j.retryAfter
 	return j.db.Save(j.dbj).Error
 }
 
@@ -362,3 +445,88 @@ func (s *Gormstore) UpdateRev(ctx context.Context, repo, rev string) error {
 
 	return j.SetRev(ctx, rev)
 }
+
+func (s *Gormstore) ListDeadJobs(ctx context.Context, after string, limit int) ([]DeadJob, error) {
+	var rows []GormDBJob
+	if err := s.db.WithContext(ctx).Where("state LIKE ? AND repo > ?", StateDead+"%", after).
+		Order("repo").Limit(limit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make([]DeadJob, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, DeadJob{
+			Repo:      row.Repo,
+			State:     row.State,
+			Attempts:  row.RetryCount,
+			UpdatedAt: row.UpdatedAt,
+		})
+	}
+	return out, nil
+}
+
+func (s *Gormstore) RequeueDeadJob(ctx context.Context, repo string) error {
+	j, err := s.getJob(ctx, repo)
+	if err != nil {
+		return err
+	}
+
+	j.lk.Lock()
+	if !IsDead(j.state) {
+		j.lk.Unlock()
+		return ErrJobNotFound
+	}
+	j.state = StateEnqueued
+	j.retryCount = 0
+	j.retryAfter = nil
+	j.updatedAt = time.Now()
+	j.dbj.State = j.state
+	j.dbj.RetryCount = 0
+	j.dbj.RetryAfter = nil
+	err = j.db.Save(j.dbj).Error
+	priority := j.priority
+	j.lk.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.qlk.Lock()
+	s.taskQueue.push(repo, priority)
+	s.qlk.Unlock()
+
+	s.notifyEnqueued(ctx, repo)
+	return nil
+}
+
+// ResumeInterrupted re-enqueues jobs left in progress, eg by a previous process which was stopped mid-backfill, so they resume from their cursors. It must only be called before processing starts, and when no other process is using the same jobs.
+func (s *Gormstore) ResumeInterrupted(ctx context.Context) (int64, error) {
+	res := s.db.WithContext(ctx).Model(&GormDBJob{}).Where("state = ?", StateInProgress).Update("state", StateEnqueued)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+
+	// drop any cached copies
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	for repo, j := range s.jobs {
+		if j.State() == StateInProgress {
+			delete(s.jobs, repo)
+		}
+	}
+	return res.RowsAffected, nil
+}
+
+// CountJobs counts the jobs in the database, by state.
+func (s *Gormstore) CountJobs(ctx context.Context) (JobCounts, error) {
+	var rows []struct {
+		State string
+		Count int64
+	}
+	var counts JobCounts
+	if err := s.db.WithContext(ctx).Model(&GormDBJob{}).Select("state, count(*) AS count").Group("state").Scan(&rows).Error; err != nil {
+		return counts, err
+	}
+	for _, row := range rows {
+		counts.count(row.State, row.Count)
+	}
+	return counts, nil
+}
@@ -3,6 +3,9 @@ package backfill
 import (
 	"context"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -29,6 +32,12 @@ type Memjob struct {
 	rev         string
 	lk          sync.Mutex
 	bufferedOps []*opSet
+	priority    int
+	cursors     map[string]string
+
+	retryCount int
+	retryAfter *time.Time
+	policy     *RetryPolicy
 
 	createdAt time.Time
 	updatedAt time.Time
@@ -36,13 +45,20 @@ type Memjob struct {
 
 // Memstore is a simple in-memory implementation of the Backfill Store interface
 type Memstore struct {
+	// How failed jobs are retried; set before using the store
+	RetryPolicy RetryPolicy
+	// signalled when jobs are enqueued
+	enqueued chan struct{}
+
 	lk   sync.RWMutex
 	jobs map[string]*Memjob
 }
 
 func NewMemstore() *Memstore {
 	return &Memstore{
-		jobs: make(map[string]*Memjob),
+		RetryPolicy: DefaultRetryPolicy(),
+		enqueued:    make(chan struct{}, 1),
+		jobs:        make(map[string]*Memjob),
 	}
 }
 
@@ -59,8 +75,34 @@ func (s *Memstore) EnqueueJob(repo string) error {
 		createdAt: time.Now(),
 		updatedAt: time.Now(),
 		state:     StateEnqueued,
+		policy:    &s.RetryPolicy,
 	}
 	s.jobs[repo] = j
+	signalEnqueued(s.enqueued)
+	return nil
+}
+
+// EnqueueJobWithPriority is like EnqueueJob, with the given priority. Unlike EnqueueJob, an existing job is not an error: its priority is raised if lower.
+func (s *Memstore) EnqueueJobWithPriority(ctx context.Context, repo string, priority int) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if j, ok := s.jobs[repo]; ok {
+		j.lk.Lock()
+		j.priority = max(j.priority, priority)
+		j.lk.Unlock()
+		return nil
+	}
+
+	s.jobs[repo] = &Memjob{
+		repo:      repo,
+		createdAt: time.Now(),
+		updatedAt: time.Now(),
+		state:     StateEnqueued,
+		priority:  priority,
+		policy:    &s.RetryPolicy,
+	}
+	signalEnqueued(s.enqueued)
 	return nil
 }
 
@@ -133,16 +175,25 @@ func (s *Memstore) GetJob(ctx context.Context, repo string) (Job, error) {
 	return j, nil
 }
 
+// GetNextEnqueuedJob returns the enqueued job (or failed job due a retry) with the highest priority, and the oldest among those.
 func (s *Memstore) GetNextEnqueuedJob(ctx context.Context) (Job, error) {
 	s.lk.RLock()
 	defer s.lk.RUnlock()
 
+	now := time.Now()
+	var next *Memjob
 	for _, j := range s.jobs {
-		if j.State() == StateEnqueued {
-			return j, nil
+		if !j.ready(now) {
+			continue
 		}
+		if next == nil || j.Priority() > next.Priority() || (j.Priority() == next.Priority() && j.createdAt.Before(next.createdAt)) {
+			next = j
+		}
+	}
+	if next == nil {
+		return nil, nil
 	}
-	return nil, nil
+	return next, nil
 }
 
 func (j *Memjob) Repo() string {
@@ -156,11 +207,47 @@ func (j *Memjob) State() string {
 	return j.state
 }
 
+func (j *Memjob) Priority() int {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+
+	return j.priority
+}
+
+// Whether the job is enqueued, or failed and due a retry.
+func (j *Memjob) ready(now time.Time) bool {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+
+	if j.state == StateEnqueued {
+		return true
+	}
+	return strings.HasPrefix(j.state, "failed") && j.retryAfter != nil && now.After(*j.retryAfter)
+}
+
 func (j *Memjob) SetState(ctx context.Context, state string) error {
 	j.lk.Lock()
 	defer j.lk.Unlock()
 
+	j.updatedAt = time.Now()
+	if strings.HasPrefix(state, "failed") && j.policy != nil {
+		j.retryCount++
+		state, j.retryAfter = j.policy.onFailure(state, j.retryCount, j.updatedAt)
+	}
 	j.state = state
+	return nil
+}
+
+func (j *Memjob) Cursors() map[string]string {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+	return maps.Clone(j.cursors)
+}
+
+func (j *Memjob) SetCursors(ctx context.Context, cursors map[string]string) error {
+	j.lk.Lock()
+	defer j.lk.Unlock()
+	j.cursors = cursors
 	j.updatedAt = time.Now()
 	return nil
 }
@@ -207,5 +294,71 @@ func (j *Memjob) ClearBufferedOps(ctx context.Context) error {
 func (j *Memjob) RetryCount() int {
 	j.lk.Lock()
 	defer j.lk.Unlock()
-	return 0
+	return j.retryCount
+}
+
+func (s *Memstore) ListDeadJobs(ctx context.Context, after string, limit int) ([]DeadJob, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+
+	var out []DeadJob
+	for _, j := range s.jobs {
+		if j.repo <= after {
+			continue
+		}
+		j.lk.Lock()
+		if IsDead(j.state) {
+			out = append(out, DeadJob{
+				Repo:      j.repo,
+				State:     j.state,
+				Attempts:  j.retryCount,
+				UpdatedAt: j.updatedAt,
+			})
+		}
+		j.lk.Unlock()
+	}
+	slices.SortFunc(out, func(a, b DeadJob) int {
+		return strings.Compare(a.Repo, b.Repo)
+	})
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (s *Memstore) RequeueDeadJob(ctx context.Context, repo string) error {
+	s.lk.RLock()
+	j, ok := s.jobs[repo]
+	s.lk.RUnlock()
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	j.lk.Lock()
+	defer j.lk.Unlock()
+	if !IsDead(j.state) {
+		return ErrJobNotFound
+	}
+	j.state = StateEnqueued
+	j.retryCount = 0
+	j.retryAfter = nil
+	j.updatedAt = time.Now()
+	signalEnqueued(s.enqueued)
+	return nil
+}
+
+// CountJobs counts the jobs in the store, by state.
+func (s *Memstore) CountJobs(ctx context.Context) (JobCounts, error) {
+	s.lk.RLock()
+	defer s.lk.RUnlock()
+
+	var counts JobCounts
+	for _, j := range s.jobs {
+		counts.count(j.State(), 1)
+	}
+	return counts, nil
+}
+
+func (s *Memstore) JobsEnqueued() <-chan struct{} {
+	return s.enqueued
 }
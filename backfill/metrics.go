@@ -29,3 +29,23 @@ var backfillBytesProcessed = promauto.NewCounterVec(prometheus.CounterOpts{
 	Name: "backfill_bytes_processed_total",
 	Help: "The total number of backfill bytes processed",
 }, []string{"backfiller_name"})
+
+var backfillPaused = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "backfill_paused",
+	Help: "Whether the backfill processor is paused (1) or running (0)",
+}, []string{"backfiller_name"})
+
+var backfillJobs = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "backfill_jobs",
+	Help: "The number of backfill jobs in each state",
+}, []string{"backfiller_name", "state"})
+
+var backfillThroughput = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "backfill_throughput_jobs_per_second",
+	Help: "The number of backfill jobs finished per second, over the last few minutes",
+}, []string{"backfiller_name"})
+
+var backfillETASeconds = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "backfill_eta_seconds",
+	Help: "Estimated time until all enqueued backfill jobs are finished, at the current throughput (-1 if unknown)",
+}, []string{"backfiller_name"})
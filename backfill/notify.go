@@ -0,0 +1,96 @@
+package backfill
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Notifier is implemented by stores which signal when jobs are enqueued, so that an idle Backfiller starts them immediately instead of at its next poll.
+type Notifier interface {
+	// JobsEnqueued returns a channel which receives a value after jobs are enqueued
+	JobsEnqueued() <-chan struct{}
+}
+
+// How long an idle Backfiller waits before checking for jobs again, if the store is not a Notifier or no notification arrives.
+var idlePollInterval = time.Second
+
+// Waits until the store signals that jobs were enqueued, or for the poll interval.
+func (b *Backfiller) waitForJobs() {
+	n, ok := b.Store.(Notifier)
+	if !ok {
+		time.Sleep(idlePollInterval)
+		return
+	}
+	t := time.NewTimer(idlePollInterval)
+	defer t.Stop()
+	select {
+	case <-n.JobsEnqueued():
+	case <-t.C:
+	}
+}
+
+// Wakes a waiting Backfiller, if any, without blocking.
+func signalEnqueued(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Gormstore) JobsEnqueued() <-chan struct{} {
+	return s.enqueued
+}
+
+// Signals a local Backfiller, and if NotifyChannel is set, those of other processes sharing the database.
+func (s *Gormstore) notifyEnqueued(ctx context.Context, repo string) {
+	signalEnqueued(s.enqueued)
+	if s.NotifyChannel == "" {
+		return
+	}
+	if err := s.db.WithContext(ctx).Exec("SELECT pg_notify(?, ?)", s.NotifyChannel, repo).Error; err != nil {
+		slog.Warn("failed to notify of enqueued backfill job", "source", "backfill_gormstore", "repo", repo, "error", err)
+	}
+}
+
+// ListenPostgres listens for notifications of jobs enqueued by other processes sharing the Postgres database at connURL (on NotifyChannel), and wakes this store's Backfiller for each. It runs until the context is cancelled, reconnecting after errors.
+func (s *Gormstore) ListenPostgres(ctx context.Context, connURL string) error {
+	if s.NotifyChannel == "" {
+		return fmt.Errorf("no notification channel configured")
+	}
+	log := slog.With("source", "backfill_gormstore", "channel", s.NotifyChannel)
+	for {
+		err := s.listenPostgres(ctx, connURL)
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Warn("backfill job notifications failed, reconnecting", "error", err)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (s *Gormstore) listenPostgres(ctx context.Context, connURL string) error {
+	conn, err := pgx.Connect(ctx, connURL)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.WithoutCancel(ctx))
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{s.NotifyChannel}.Sanitize()); err != nil {
+		return err
+	}
+	for {
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		// NOTE: jobs from other processes are loaded from the database once the queue is empty, so there is no need to look up the job here
+		signalEnqueued(s.enqueued)
+	}
+}
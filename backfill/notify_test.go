@@ -0,0 +1,48 @@
+package backfill_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/backfill"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	typegen "github.com/whyrusleeping/cbor-gen"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestEnqueueWakesBackfiller(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(db.AutoMigrate(&backfill.GormDBJob{}))
+	store := backfill.NewGormstore(db)
+
+	opts := backfill.DefaultBackfillOptions()
+	// not a CAR file, so jobs fail straight away
+	opts.Source = staticSource("not a car")
+	noop := func(ctx context.Context, repo string, rev string, path string, rec typegen.CBORMarshaler, cid *cid.Cid) error {
+		return nil
+	}
+	bf := backfill.NewBackfiller("notify-test", store, noop, noop, nil, opts)
+	go bf.Start()
+	defer bf.Stop()
+
+	// let the backfiller go idle
+	time.Sleep(1500 * time.Millisecond)
+
+	start := time.Now()
+	assert.NoError(store.EnqueueJob(ctx, "did:plc:abc123"))
+	job, err := store.GetJob(ctx, "did:plc:abc123")
+	assert.NoError(err)
+	waitFor(t, func() bool { return job.State() != backfill.StateEnqueued })
+	// well within the poll interval
+	assert.Less(time.Since(start), 500*time.Millisecond)
+}
@@ -0,0 +1,86 @@
+package backfill_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/backfill"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	typegen "github.com/whyrusleeping/cbor-gen"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBackfillPauseDrain(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// repo fetches block until released, then fail
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(db.AutoMigrate(&backfill.GormDBJob{}))
+	store := backfill.NewGormstore(db)
+
+	opts := backfill.DefaultBackfillOptions()
+	opts.CheckoutPath = srv.URL
+	opts.SyncRequestsPerSecond = 100
+	noop := func(ctx context.Context, repo string, rev string, path string, rec typegen.CBORMarshaler, cid *cid.Cid) error {
+		return nil
+	}
+	bf := backfill.NewBackfiller("pause-test", store, noop, noop, func(ctx context.Context, repo string, rev string, path string) error {
+		return nil
+	}, opts)
+
+	assert.NoError(store.EnqueueJob(ctx, "did:plc:abc111"))
+	go bf.Start()
+	defer bf.Stop()
+
+	waitFor(t, func() bool { return bf.InFlight() == 1 })
+
+	// drain times out while the job is blocked
+	shortCtx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(bf.Drain(shortCtx), context.DeadlineExceeded)
+	assert.True(bf.Paused())
+
+	// new jobs don't start while paused
+	assert.NoError(store.EnqueueJob(ctx, "did:plc:abc222"))
+	close(release)
+	assert.NoError(bf.Drain(ctx))
+	assert.Equal(0, bf.InFlight())
+	time.Sleep(1500 * time.Millisecond)
+	job, err := store.GetJob(ctx, "did:plc:abc222")
+	assert.NoError(err)
+	assert.Equal(backfill.StateEnqueued, job.State())
+
+	bf.Resume()
+	assert.False(bf.Paused())
+	waitFor(t, func() bool {
+		job, err := store.GetJob(ctx, "did:plc:abc222")
+		return err == nil && job.State() != backfill.StateEnqueued && bf.InFlight() == 0
+	})
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,99 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+	"golang.org/x/time/rate"
+)
+
+// Upper bound on the number of PDS hosts with a rate limiter at once; the least recently used are dropped.
+const maxPDSLimiters = 50_000
+
+// PDSSource fetches repos directly from each account's PDS (resolved through the identity directory) rather than from a relay, with a separate rate limit for each PDS host. That lets a backfill run quickly against many small PDSs, without sending too many requests to any single one.
+type PDSSource struct {
+	Directory identity.Directory
+	UserAgent string
+	Client    *http.Client
+	// Limits the rate of requests across all hosts, if not nil
+	Limiter *rate.Limiter
+
+	perHost rate.Limit
+	burst   int
+
+	lk       sync.Mutex
+	limiters *lru.Cache[string, *rate.Limiter]
+}
+
+// NewPDSSource returns a source which fetches each repo from its PDS, at up to requestsPerSecond (with the given burst) to each PDS host.
+func NewPDSSource(dir identity.Directory, requestsPerSecond float64, burst int) *PDSSource {
+	limiters, err := lru.New[string, *rate.Limiter](maxPDSLimiters)
+	if err != nil {
+		// only for an invalid size
+		panic(err)
+	}
+	return &PDSSource{
+		Directory: dir,
+		UserAgent: "atproto-backfill/0.0.1",
+		Client:    defaultRepoClient(),
+		perHost:   rate.Limit(requestsPerSecond),
+		burst:     max(burst, 1),
+		limiters:  limiters,
+	}
+}
+
+// The rate limiter for a PDS host, created on first use.
+func (s *PDSSource) hostLimiter(host string) *rate.Limiter {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	lim, ok := s.limiters.Get(host)
+	if !ok {
+		lim = rate.NewLimiter(s.perHost, s.burst)
+		s.limiters.Add(host, lim)
+	}
+	return lim
+}
+
+func (s *PDSSource) GetRepo(ctx context.Context, did, since string) (io.ReadCloser, error) {
+	d, err := syntax.ParseDID(did)
+	if err != nil {
+		return nil, err
+	}
+	ident, err := s.Directory.LookupDID(ctx, d)
+	if err != nil {
+		if errors.Is(err, identity.ErrDIDNotFound) {
+			return nil, ErrRepoNotFound
+		}
+		return nil, fmt.Errorf("resolving PDS: %w", err)
+	}
+	pds := ident.PDSEndpoint()
+	if pds == "" {
+		return nil, ErrRepoNotFound
+	}
+	u, err := url.Parse(pds)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid PDS endpoint for %s: %q", did, pds)
+	}
+
+	if s.Limiter != nil {
+		if err := s.Limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	src := HTTPSource{
+		CheckoutPath: u.JoinPath("/xrpc/com.atproto.sync.getRepo").String(),
+		UserAgent:    s.UserAgent,
+		Limiter:      s.hostLimiter(u.Host),
+		Client:       s.Client,
+	}
+	return src.GetRepo(ctx, did, since)
+}
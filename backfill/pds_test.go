@@ -0,0 +1,74 @@
+package backfill_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/backfill"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPDSSource(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	newPDS := func(name string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal("/xrpc/com.atproto.sync.getRepo", r.URL.Path)
+			if r.URL.Query().Get("did") == "did:plc:gone" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(name))
+		}))
+	}
+	pds1 := newPDS("pds1")
+	defer pds1.Close()
+	pds2 := newPDS("pds2")
+	defer pds2.Close()
+
+	dir := identity.NewMockDirectory()
+	for did, pds := range map[string]string{
+		"did:plc:a":    pds1.URL,
+		"did:plc:b":    pds1.URL,
+		"did:plc:c":    pds2.URL,
+		"did:plc:gone": pds2.URL,
+	} {
+		dir.Insert(identity.Identity{
+			DID:      syntax.DID(did),
+			Services: map[string]identity.Service{"atproto_pds": {Type: "AtprotoPersonalDataServer", URL: pds}},
+		})
+	}
+
+	// one request every 200ms to each host
+	src := backfill.NewPDSSource(&dir, 5, 1)
+	get := func(did string) string {
+		rc, err := src.GetRepo(ctx, did, "")
+		if !assert.NoError(err) {
+			return ""
+		}
+		defer rc.Close()
+		b, _ := io.ReadAll(rc)
+		return string(b)
+	}
+
+	start := time.Now()
+	assert.Equal("pds1", get("did:plc:a"))
+	assert.Equal("pds2", get("did:plc:c"))
+	// a different host is not limited
+	assert.Less(time.Since(start), 150*time.Millisecond)
+	assert.Equal("pds1", get("did:plc:b"))
+	assert.GreaterOrEqual(time.Since(start), 150*time.Millisecond)
+
+	_, err := src.GetRepo(ctx, "did:plc:gone", "")
+	assert.ErrorIs(err, backfill.ErrRepoNotFound)
+	_, err = src.GetRepo(ctx, "did:plc:unknown", "")
+	assert.ErrorIs(err, backfill.ErrRepoNotFound)
+}
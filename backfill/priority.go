@@ -0,0 +1,71 @@
+package backfill
+
+import (
+	"container/heap"
+	"context"
+)
+
+// Priorities for backfill jobs, by how a repo came to be enqueued. Jobs with a higher priority are dequeued first, and jobs with the same priority in the order they were enqueued.
+type JobPriorities struct {
+	// Repos enqueued in bulk, eg every repo listed by a relay
+	Bulk int
+	// Repos first seen in a firehose event, without an existing job
+	Discovered int
+	// Repos enqueued on request, eg by an operator
+	Requested int
+}
+
+func DefaultJobPriorities() JobPriorities {
+	return JobPriorities{
+		Bulk:       0,
+		Discovered: 10,
+		Requested:  20,
+	}
+}
+
+// PriorityStore is implemented by stores which dequeue jobs by priority.
+type PriorityStore interface {
+	// EnqueueJobWithPriority is like EnqueueJob, with the given priority. If the repo already has a job with a lower priority, its priority is raised.
+	EnqueueJobWithPriority(ctx context.Context, repo string, priority int) error
+}
+
+type queuedJob struct {
+	repo     string
+	priority int
+	// insertion order, for FIFO within a priority
+	seq uint64
+}
+
+// A max-heap of queued jobs, by priority and then insertion order. Implements heap.Interface.
+type jobQueue struct {
+	items []queuedJob
+	seq   uint64
+}
+
+func (q *jobQueue) Len() int { return len(q.items) }
+
+func (q *jobQueue) Less(i, j int) bool {
+	if q.items[i].priority != q.items[j].priority {
+		return q.items[i].priority > q.items[j].priority
+	}
+	return q.items[i].seq < q.items[j].seq
+}
+
+func (q *jobQueue) Swap(i, j int) { q.items[i], q.items[j] = q.items[j], q.items[i] }
+
+func (q *jobQueue) Push(x any) { q.items = append(q.items, x.(queuedJob)) }
+
+func (q *jobQueue) Pop() any {
+	last := q.items[len(q.items)-1]
+	q.items = q.items[:len(q.items)-1]
+	return last
+}
+
+func (q *jobQueue) push(repo string, priority int) {
+	q.seq++
+	heap.Push(q, queuedJob{repo: repo, priority: priority, seq: q.seq})
+}
+
+func (q *jobQueue) pop() string {
+	return heap.Pop(q).(queuedJob).repo
+}
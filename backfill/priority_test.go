@@ -0,0 +1,76 @@
+package backfill_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bluesky-social/indigo/backfill"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGormstorePriority(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(db.AutoMigrate(&backfill.GormDBJob{}))
+
+	// bulk jobs, created directly in the database
+	store := backfill.NewGormstore(db)
+	for _, repo := range []string{"did:plc:bulk1", "did:plc:bulk2", "did:plc:bulk3"} {
+		_, err := store.GetOrCreateJobWithPriority(ctx, repo, backfill.StateEnqueued, 0)
+		assert.NoError(err)
+	}
+
+	// a fresh store loads jobs from the database
+	store = backfill.NewGormstore(db)
+	assert.NoError(store.LoadJobs(ctx))
+	assert.NoError(store.EnqueueJobWithPriority(ctx, "did:plc:discovered", 10))
+	assert.NoError(store.EnqueueJobWithPriority(ctx, "did:plc:requested", 20))
+	// raises the priority of a queued bulk job
+	assert.NoError(store.EnqueueJobWithPriority(ctx, "did:plc:bulk3", 20))
+
+	var order []string
+	for {
+		j, err := store.GetNextEnqueuedJob(ctx)
+		assert.NoError(err)
+		if j == nil {
+			break
+		}
+		order = append(order, j.Repo())
+		assert.NoError(j.SetState(ctx, backfill.StateInProgress))
+	}
+	assert.Equal([]string{"did:plc:requested", "did:plc:bulk3", "did:plc:discovered", "did:plc:bulk1", "did:plc:bulk2"}, order)
+
+	var dbj backfill.GormDBJob
+	assert.NoError(db.Find(&dbj, "repo = ?", "did:plc:bulk3").Error)
+	assert.Equal(20, dbj.Priority)
+}
+
+func TestMemstorePriority(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store := backfill.NewMemstore()
+	assert.NoError(store.EnqueueJob("did:plc:bulk1"))
+	assert.NoError(store.EnqueueJobWithPriority(ctx, "did:plc:requested", 20))
+	assert.NoError(store.EnqueueJobWithPriority(ctx, "did:plc:discovered", 10))
+
+	var order []string
+	for {
+		j, err := store.GetNextEnqueuedJob(ctx)
+		assert.NoError(err)
+		if j == nil {
+			break
+		}
+		order = append(order, j.Repo())
+		assert.NoError(j.SetState(ctx, backfill.StateInProgress))
+	}
+	assert.Equal([]string{"did:plc:requested", "did:plc:discovered", "did:plc:bulk1"}, order)
+}
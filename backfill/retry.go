@@ -0,0 +1,71 @@
+package backfill
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// StateDead prefixes the state of a job which failed too many times, followed by the reason for the last failure, eg "dead (repo not found)". Dead jobs are not retried unless they are requeued.
+var StateDead = "dead"
+
+// RetryPolicy controls how failed backfill jobs are retried.
+type RetryPolicy struct {
+	// Failed attempts after which a job is moved to the dead-letter state; zero or less retries forever
+	MaxAttempts int
+	// Delay before the first retry, doubled for each subsequent one
+	InitialBackoff time.Duration
+	// Upper bound on the delay between retries
+	MaxBackoff time.Duration
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    MaxRetries + 1,
+		InitialBackoff: 10 * time.Second,
+		MaxBackoff:     24 * time.Hour,
+	}
+}
+
+// Applies the policy to a job which has now failed the given number of times, with the given "failed (...)" state. Returns the state to store, and when to retry the job (nil if it is dead).
+func (p RetryPolicy) onFailure(state string, failures int, now time.Time) (string, *time.Time) {
+	if p.MaxAttempts > 0 && failures >= p.MaxAttempts {
+		return StateDead + strings.TrimPrefix(state, "failed"), nil
+	}
+	next := now.Add(p.backoff(failures))
+	return state, &next
+}
+
+// The delay before retrying a job which has failed the given number of times.
+func (p RetryPolicy) backoff(failures int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < failures && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 {
+		d = min(d, p.MaxBackoff)
+	}
+	return d
+}
+
+// IsDead returns whether a job state is the dead-letter state.
+func IsDead(state string) bool {
+	return strings.HasPrefix(state, StateDead)
+}
+
+// A job which failed too many times.
+type DeadJob struct {
+	Repo string `json:"repo"`
+	// the job state, including the reason for the last failure
+	State     string    `json:"state"`
+	Attempts  int       `json:"attempts"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// DeadLetterStore is implemented by stores which keep jobs that failed too many times (see RetryPolicy) in the dead-letter state.
+type DeadLetterStore interface {
+	// ListDeadJobs lists up to limit dead jobs, ordered by repo, starting after the given repo (or from the start, if empty)
+	ListDeadJobs(ctx context.Context, after string, limit int) ([]DeadJob, error)
+	// RequeueDeadJob enqueues a dead job again, with its attempts reset. Returns ErrJobNotFound if there is no dead job for the repo.
+	RequeueDeadJob(ctx context.Context, repo string) error
+}
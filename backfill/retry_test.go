@@ -0,0 +1,100 @@
+package backfill_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/backfill"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGormstoreDeadLetter(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(db.AutoMigrate(&backfill.GormDBJob{}))
+
+	policy := backfill.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+	store := backfill.NewGormstore(db)
+	store.RetryPolicy = policy
+	assert.NoError(store.EnqueueJob(ctx, "did:plc:a"))
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		// a fresh store, to check the retry state is persisted
+		store = backfill.NewGormstore(db)
+		store.RetryPolicy = policy
+		time.Sleep(5 * time.Millisecond)
+		job, err := store.GetNextEnqueuedJob(ctx)
+		assert.NoError(err)
+		if !assert.NotNil(job, "attempt %d", attempt) {
+			return
+		}
+		assert.Equal(attempt-1, job.RetryCount())
+		assert.NoError(job.SetState(ctx, backfill.StateInProgress))
+		assert.NoError(job.SetState(ctx, "failed (repo not found)"))
+	}
+
+	// dead jobs are not retried
+	time.Sleep(5 * time.Millisecond)
+	job, err := store.GetNextEnqueuedJob(ctx)
+	assert.NoError(err)
+	assert.Nil(job)
+
+	dead, err := store.ListDeadJobs(ctx, "", 10)
+	assert.NoError(err)
+	if assert.Len(dead, 1) {
+		assert.Equal("did:plc:a", dead[0].Repo)
+		assert.Equal("dead (repo not found)", dead[0].State)
+		assert.Equal(3, dead[0].Attempts)
+	}
+	dead, err = store.ListDeadJobs(ctx, "did:plc:a", 10)
+	assert.NoError(err)
+	assert.Empty(dead)
+
+	assert.ErrorIs(store.RequeueDeadJob(ctx, "did:plc:unknown"), backfill.ErrJobNotFound)
+	assert.NoError(store.RequeueDeadJob(ctx, "did:plc:a"))
+	job, err = store.GetNextEnqueuedJob(ctx)
+	assert.NoError(err)
+	if assert.NotNil(job) {
+		assert.Equal("did:plc:a", job.Repo())
+		assert.Equal(0, job.RetryCount())
+	}
+}
+
+func TestMemstoreDeadLetter(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	store := backfill.NewMemstore()
+	store.RetryPolicy = backfill.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Hour}
+	assert.NoError(store.EnqueueJob("did:plc:a"))
+
+	job, err := store.GetNextEnqueuedJob(ctx)
+	assert.NoError(err)
+	assert.NoError(job.SetState(ctx, "failed (unknown error)"))
+	// backing off
+	job, err = store.GetNextEnqueuedJob(ctx)
+	assert.NoError(err)
+	assert.Nil(job)
+
+	job, err = store.GetJob(ctx, "did:plc:a")
+	assert.NoError(err)
+	assert.NoError(job.SetState(ctx, "failed (unknown error)"))
+	assert.Equal("dead (unknown error)", job.State())
+
+	dead, err := store.ListDeadJobs(ctx, "", 10)
+	assert.NoError(err)
+	assert.Len(dead, 1)
+	assert.NoError(store.RequeueDeadJob(ctx, "did:plc:a"))
+	job, err = store.GetNextEnqueuedJob(ctx)
+	assert.NoError(err)
+	assert.NotNil(job)
+}
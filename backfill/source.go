@@ -0,0 +1,154 @@
+package backfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/time/rate"
+)
+
+// RepoSource provides repo exports (CAR files) for backfill jobs.
+type RepoSource interface {
+	// GetRepo returns the repo as a CAR stream. If since is set, the source may only include blocks created after that rev. Returns ErrRepoNotFound if the source does not have the repo.
+	GetRepo(ctx context.Context, did, since string) (io.ReadCloser, error)
+}
+
+// ErrRepoNotFound is returned by a RepoSource which does not have the requested repo
+var ErrRepoNotFound = errors.New("repo not found")
+
+// HTTPSource fetches repos from a com.atproto.sync.getRepo endpoint, such as a relay's.
+type HTTPSource struct {
+	// Full URL of the getRepo endpoint
+	CheckoutPath string
+	UserAgent    string
+	// Extra headers sent with each request
+	Headers map[string]string
+	// Limits the rate of requests, if not nil
+	Limiter *rate.Limiter
+	Client  *http.Client
+}
+
+// NewHTTPSource returns a source which fetches repos from checkoutPath, at up to requestsPerSecond.
+func NewHTTPSource(checkoutPath string, requestsPerSecond int) *HTTPSource {
+	return &HTTPSource{
+		CheckoutPath: checkoutPath,
+		UserAgent:    "atproto-backfill/0.0.1",
+		Limiter:      rate.NewLimiter(rate.Limit(requestsPerSecond), 1),
+		Client:       defaultRepoClient(),
+	}
+}
+
+func defaultRepoClient() *http.Client {
+	return &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+		Timeout:   600 * time.Second,
+	}
+}
+
+func (s *HTTPSource) GetRepo(ctx context.Context, did, since string) (io.ReadCloser, error) {
+	q := url.Values{"did": {did}}
+	if since != "" {
+		q.Set("since", since)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", s.CheckoutPath+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/vnd.ipld.car")
+	if s.UserAgent != "" {
+		req.Header.Set("User-Agent", s.UserAgent)
+	}
+	for k, v := range s.Headers {
+		req.Header.Set(k, v)
+	}
+
+	if s.Limiter != nil {
+		if err := s.Limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	client := s.Client
+	if client == nil {
+		client = defaultRepoClient()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusBadRequest {
+			return nil, ErrRepoNotFound
+		}
+		return nil, fmt.Errorf("unexpected status fetching repo: %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// DirSource reads repos from a directory of CAR files, such as a bulk repo export. Each file is named after the repo's DID, with a ".car" extension; colons in the DID may be replaced with underscores (eg, "did_plc_abc123.car"), for filesystems which don't allow them. Files always contain the full repo, whatever the since rev.
+type DirSource struct {
+	Dir string
+	// Used for repos not in the directory, if not nil
+	Fallback RepoSource
+}
+
+func NewDirSource(dir string, fallback RepoSource) *DirSource {
+	return &DirSource{
+		Dir:      dir,
+		Fallback: fallback,
+	}
+}
+
+func (s *DirSource) GetRepo(ctx context.Context, did, since string) (io.ReadCloser, error) {
+	// DIDs can't contain path separators, but check anyway, as they come from the network
+	if strings.ContainsAny(did, `/\`) || strings.HasPrefix(did, ".") {
+		return nil, fmt.Errorf("invalid DID: %q", did)
+	}
+	for _, name := range []string{did + ".car", strings.ReplaceAll(did, ":", "_") + ".car"} {
+		f, err := os.Open(filepath.Join(s.Dir, name))
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if s.Fallback != nil {
+		return s.Fallback.GetRepo(ctx, did, since)
+	}
+	return nil, ErrRepoNotFound
+}
+
+// Repos lists the DIDs of the repos in the directory, in directory order.
+func (s *DirSource) Repos() ([]string, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var dids []string
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".car")
+		if !ok || e.IsDir() {
+			continue
+		}
+		if !strings.HasPrefix(name, "did:") {
+			name = strings.Replace(name, "_", ":", 2)
+		}
+		if !strings.HasPrefix(name, "did:") {
+			continue
+		}
+		dids = append(dids, name)
+	}
+	return dids, nil
+}
@@ -0,0 +1,121 @@
+package backfill_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bluesky-social/indigo/backfill"
+
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+	typegen "github.com/whyrusleeping/cbor-gen"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type staticSource string
+
+func (s staticSource) GetRepo(ctx context.Context, did, since string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(string(s))), nil
+}
+
+func TestDirSource(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	car, err := os.ReadFile("../testing/testdata/greenground.repo.car")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	assert.NoError(os.WriteFile(filepath.Join(dir, "did_plc_abc123.car"), car, 0o644))
+	assert.NoError(os.WriteFile(filepath.Join(dir, "README.txt"), nil, 0o644))
+
+	src := backfill.NewDirSource(dir, nil)
+	dids, err := src.Repos()
+	assert.NoError(err)
+	assert.Equal([]string{"did:plc:abc123"}, dids)
+
+	_, err = src.GetRepo(ctx, "did:plc:other", "")
+	assert.ErrorIs(err, backfill.ErrRepoNotFound)
+	_, err = src.GetRepo(ctx, "../did:plc:abc123", "")
+	assert.Error(err)
+
+	src.Fallback = staticSource("fallback")
+	rc, err := src.GetRepo(ctx, "did:plc:other", "")
+	if assert.NoError(err) {
+		b, _ := io.ReadAll(rc)
+		assert.Equal("fallback", string(b))
+	}
+
+	// a backfill reads the whole repo from the file
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(db.AutoMigrate(&backfill.GormDBJob{}))
+	store := backfill.NewGormstore(db)
+	assert.NoError(store.EnqueueJob(ctx, "did:plc:abc123"))
+	var created atomic.Int64
+	opts := backfill.DefaultBackfillOptions()
+	opts.Source = backfill.NewDirSource(dir, nil)
+	bf := backfill.NewBackfiller("dir-test", store, func(ctx context.Context, repo string, rev string, path string, rec typegen.CBORMarshaler, cid *cid.Cid) error {
+		created.Add(1)
+		return nil
+	}, nil, nil, opts)
+
+	job, err := store.GetJob(ctx, "did:plc:abc123")
+	assert.NoError(err)
+	bf.BackfillRepo(ctx, job)
+	assert.Equal(backfill.StateComplete, job.State())
+	assert.Positive(created.Load())
+}
+
+func TestStreamRepos(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	car, err := os.ReadFile("../testing/testdata/paul_staging.repo.car")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same records whether the repo is streamed or not
+	backfilled := func(stream bool) map[string]cid.Cid {
+		db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NoError(db.AutoMigrate(&backfill.GormDBJob{}))
+		store := backfill.NewGormstore(db)
+		assert.NoError(store.EnqueueJob(ctx, "did:plc:abc123"))
+
+		var lk sync.Mutex
+		created := make(map[string]cid.Cid)
+		opts := backfill.DefaultBackfillOptions()
+		opts.Source = staticSource(car)
+		opts.StreamRepos = stream
+		bf := backfill.NewBackfiller("stream-test", store, func(ctx context.Context, repo string, rev string, path string, rec typegen.CBORMarshaler, cid *cid.Cid) error {
+			lk.Lock()
+			defer lk.Unlock()
+			created[path] = *cid
+			return nil
+		}, nil, nil, opts)
+
+		job, err := store.GetJob(ctx, "did:plc:abc123")
+		assert.NoError(err)
+		bf.BackfillRepo(ctx, job)
+		assert.Equal(backfill.StateComplete, job.State())
+		return created
+	}
+
+	loaded := backfilled(false)
+	assert.NotEmpty(loaded)
+	assert.Equal(loaded, backfilled(true))
+}
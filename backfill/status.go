@@ -0,0 +1,159 @@
+package backfill
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ThroughputWindow is the period over which backfill throughput is measured.
+var ThroughputWindow = 5 * time.Minute
+
+// JobCounts are the numbers of backfill jobs in each state.
+type JobCounts struct {
+	Enqueued   int64 `json:"enqueued"`
+	InProgress int64 `json:"inProgress"`
+	Complete   int64 `json:"complete"`
+	// Any "failed (...)" state, including jobs waiting to be retried
+	Failed int64 `json:"failed"`
+	// Jobs which failed too many times (see RetryPolicy)
+	Dead int64 `json:"dead"`
+}
+
+// JobCounter is implemented by stores which can count their jobs by state.
+type JobCounter interface {
+	CountJobs(ctx context.Context) (JobCounts, error)
+}
+
+// count adds n jobs in the given state.
+func (c *JobCounts) count(state string, n int64) {
+	switch {
+	case state == StateEnqueued:
+		c.Enqueued += n
+	case state == StateInProgress:
+		c.InProgress += n
+	case state == StateComplete:
+		c.Complete += n
+	case strings.HasPrefix(state, "failed"):
+		c.Failed += n
+	case IsDead(state):
+		c.Dead += n
+	}
+}
+
+// Status is a snapshot of a backfill's progress.
+type Status struct {
+	Name     string `json:"name"`
+	Paused   bool   `json:"paused"`
+	InFlight int    `json:"inFlight"`
+	// Nil if the store does not implement JobCounter
+	Jobs *JobCounts `json:"jobs,omitempty"`
+	// Jobs finished (complete or failed) per second, over the last ThroughputWindow
+	Throughput float64 `json:"throughput"`
+	// When the enqueued and in-progress jobs will be finished, at the current throughput; nil if unknown (no job counts, or no throughput yet)
+	ETA *time.Time `json:"eta,omitempty"`
+}
+
+// Status returns the current progress of the backfill, and updates the corresponding metrics.
+func (b *Backfiller) Status(ctx context.Context) (*Status, error) {
+	now := time.Now()
+	st := &Status{
+		Name:       b.Name,
+		Paused:     b.Paused(),
+		InFlight:   b.InFlight(),
+		Throughput: b.throughput().rate(now),
+	}
+	backfillThroughput.WithLabelValues(b.Name).Set(st.Throughput)
+
+	jc, ok := b.Store.(JobCounter)
+	if !ok {
+		return st, nil
+	}
+	counts, err := jc.CountJobs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	st.Jobs = &counts
+	backfillJobs.WithLabelValues(b.Name, "enqueued").Set(float64(counts.Enqueued))
+	backfillJobs.WithLabelValues(b.Name, "in_progress").Set(float64(counts.InProgress))
+	backfillJobs.WithLabelValues(b.Name, "complete").Set(float64(counts.Complete))
+	backfillJobs.WithLabelValues(b.Name, "failed").Set(float64(counts.Failed))
+	backfillJobs.WithLabelValues(b.Name, "dead").Set(float64(counts.Dead))
+
+	remaining := counts.Enqueued + counts.InProgress
+	switch {
+	case remaining == 0:
+		st.ETA = &now
+		backfillETASeconds.WithLabelValues(b.Name).Set(0)
+	case st.Throughput > 0:
+		eta := now.Add(time.Duration(float64(remaining) / st.Throughput * float64(time.Second)))
+		st.ETA = &eta
+		backfillETASeconds.WithLabelValues(b.Name).Set(eta.Sub(now).Seconds())
+	default:
+		// unknown
+		backfillETASeconds.WithLabelValues(b.Name).Set(-1)
+	}
+	return st, nil
+}
+
+// Periodically updates the status metrics, until the context is cancelled.
+func (b *Backfiller) reportStatus(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if _, err := b.Status(ctx); err != nil {
+			slog.Warn("failed to get backfill status", "source", "backfiller", "name", b.Name, "error", err)
+		}
+	}
+}
+
+func (b *Backfiller) throughput() *throughputTracker {
+	b.ctlLk.Lock()
+	defer b.ctlLk.Unlock()
+	if b.finished == nil {
+		b.finished = &throughputTracker{start: time.Now()}
+	}
+	return b.finished
+}
+
+// Measures events per second over the last ThroughputWindow.
+type throughputTracker struct {
+	lk    sync.Mutex
+	start time.Time
+	times []time.Time
+}
+
+func (t *throughputTracker) record(now time.Time) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.times = append(t.times, now)
+	t.prune(now)
+}
+
+func (t *throughputTracker) rate(now time.Time) float64 {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.prune(now)
+	// shorter than the window, until the tracker has been running that long
+	window := min(ThroughputWindow, now.Sub(t.start))
+	if window <= 0 {
+		return 0
+	}
+	return float64(len(t.times)) / window.Seconds()
+}
+
+func (t *throughputTracker) prune(now time.Time) {
+	cutoff := now.Add(-ThroughputWindow)
+	i := 0
+	for i < len(t.times) && t.times[i].Before(cutoff) {
+		i++
+	}
+	t.times = t.times[i:]
+}
@@ -0,0 +1,57 @@
+package backfill_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bluesky-social/indigo/backfill"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBackfillStatus(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(db.AutoMigrate(&backfill.GormDBJob{}))
+
+	store := backfill.NewGormstore(db)
+	for repo, state := range map[string]string{
+		"did:plc:a": backfill.StateEnqueued,
+		"did:plc:b": backfill.StateEnqueued,
+		"did:plc:c": backfill.StateInProgress,
+		"did:plc:d": backfill.StateComplete,
+		"did:plc:e": "failed (not found)",
+		"did:plc:f": "failed (couldn't fetch CAR)",
+	} {
+		_, err := store.GetOrCreateJob(ctx, repo, state)
+		assert.NoError(err)
+	}
+
+	counts, err := store.CountJobs(ctx)
+	assert.NoError(err)
+	assert.Equal(backfill.JobCounts{Enqueued: 2, InProgress: 1, Complete: 1, Failed: 2}, counts)
+
+	bf := &backfill.Backfiller{Name: "test", Store: store}
+	st, err := bf.Status(ctx)
+	assert.NoError(err)
+	assert.Equal(&counts, st.Jobs)
+	// nothing finished yet
+	assert.Zero(st.Throughput)
+	assert.Nil(st.ETA)
+
+	// the same counts from the in-memory store
+	mem := backfill.NewMemstore()
+	for _, repo := range []string{"did:plc:a", "did:plc:b"} {
+		assert.NoError(mem.EnqueueJob(repo))
+	}
+	counts, err = mem.CountJobs(ctx)
+	assert.NoError(err)
+	assert.Equal(backfill.JobCounts{Enqueued: 2}, counts)
+}
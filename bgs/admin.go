@@ -9,6 +9,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/bluesky-social/indigo/api"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/indexer"
 	"github.com/bluesky-social/indigo/models"
 	"github.com/labstack/echo/v4"
 	dto "github.com/prometheus/client_model/go"
@@ -107,6 +110,8 @@ type enrichedPDS struct {
 	IngestRate             rateLimit `json:"IngestRate"`
 	CrawlRate              rateLimit `json:"CrawlRate"`
 	UserCount              int64     `json:"UserCount"`
+	// The adaptive crawl rate limit, if the PDS was crawled since startup
+	CrawlLimit *indexer.CrawlLimitStatus `json:"CrawlLimit,omitempty"`
 }
 
 type UserCount struct {
@@ -178,11 +183,184 @@ func (bgs *BGS) handleListPDSs(e echo.Context) error {
 		}
 
 		enrichedPDSs[i].CrawlRate = crawlRate
+		enrichedPDSs[i].CrawlLimit = bgs.repoFetcher.CrawlLimitStatus(p.ID)
 	}
 
 	return e.JSON(200, enrichedPDSs)
 }
 
+// Lists all known hosts with the state of their subscriptions, in the format of the api.RelayAdminClient.
+func (bgs *BGS) handleAdminListHosts(e echo.Context) error {
+	var pds []models.PDS
+	if err := bgs.db.Find(&pds).Error; err != nil {
+		return err
+	}
+
+	var userCounts []UserCount
+	if err := bgs.db.Model(&User{}).
+		Select("pds, count(*) as user_count").
+		Group("pds").
+		Find(&userCounts).Error; err != nil {
+		return err
+	}
+	userCountMap := make(map[uint]int64)
+	for _, count := range userCounts {
+		userCountMap[count.PDSID] = count.UserCount
+	}
+
+	stats := bgs.slurper.GetHostStats()
+	now := time.Now()
+
+	hosts := make([]api.RelayHost, len(pds))
+	for i, p := range pds {
+		h := api.RelayHost{
+			ID:              p.ID,
+			Host:            p.Host,
+			Registered:      p.Registered,
+			Blocked:         p.Blocked,
+			Paused:          p.Paused,
+			RepoLimit:       p.RepoLimit,
+			RepoCount:       userCountMap[p.ID],
+			Cursor:          p.Cursor,
+			IngestRateLimit: p.RateLimit,
+			CrawlRateLimit:  p.CrawlRateLimit,
+		}
+
+		var m = &dto.Metric{}
+		if err := eventsReceivedCounter.WithLabelValues(p.Host).Write(m); err == nil {
+			h.EventsSinceStartup = uint64(m.Counter.GetValue())
+		}
+
+		if st, ok := stats[p.Host]; ok {
+			// the cursor in the DB is only flushed periodically
+			h.Cursor = st.Cursor
+			if !st.ConnectedAt.IsZero() {
+				h.Connected = true
+				connectedAt := st.ConnectedAt
+				h.ConnectedAt = &connectedAt
+				h.EventsSinceConnect = st.Events
+				last := st.ConnectedAt
+				if !st.LastEvent.IsZero() {
+					lastEvent := st.LastEvent
+					h.LastEventAt = &lastEvent
+					last = lastEvent
+				}
+				h.Lag = now.Sub(last).Seconds()
+			}
+		}
+
+		hosts[i] = h
+	}
+
+	return e.JSON(200, hosts)
+}
+
+func (bgs *BGS) handleAdminPauseHost(e echo.Context) error {
+	host := strings.TrimSpace(e.QueryParam("host"))
+	if host == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must pass a valid host",
+		}
+	}
+
+	if err := bgs.slurper.PauseHost(host); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{
+				Code:    404,
+				Message: "unknown host",
+			}
+		}
+		return err
+	}
+
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+func (bgs *BGS) handleAdminResumeHost(e echo.Context) error {
+	host := strings.TrimSpace(e.QueryParam("host"))
+	if host == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must pass a valid host",
+		}
+	}
+
+	if err := bgs.slurper.ResumeHost(host); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{
+				Code:    404,
+				Message: "unknown host",
+			}
+		}
+		return err
+	}
+
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+func (bgs *BGS) handleAdminChangeHostRepoLimit(e echo.Context) error {
+	host := strings.TrimSpace(e.QueryParam("host"))
+	if host == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must pass a valid host",
+		}
+	}
+
+	limit, err := strconv.ParseInt(e.QueryParam("limit"), 10, 64)
+	if err != nil || limit < 0 {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must pass a valid limit",
+		}
+	}
+
+	if err := bgs.SetHostRepoLimit(e.Request().Context(), host, limit); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{
+				Code:    404,
+				Message: "unknown host",
+			}
+		}
+		return err
+	}
+
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+func (bgs *BGS) handleAdminPurgeHost(e echo.Context) error {
+	host := strings.TrimSpace(e.QueryParam("host"))
+	if host == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must pass a valid host",
+		}
+	}
+
+	purged, err := bgs.PurgeHost(e.Request().Context(), host)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{
+				Code:    404,
+				Message: "unknown host",
+			}
+		}
+		return fmt.Errorf("purging host (after deleting %d repos): %w", purged, err)
+	}
+
+	return e.JSON(200, api.RelayPurgeResult{
+		Host:         host,
+		ReposDeleted: purged,
+	})
+}
+
 type consumer struct {
 	ID             uint64    `json:"id"`
 	RemoteAddr     string    `json:"remote_addr"`
@@ -409,15 +587,45 @@ func (bgs *BGS) handleAdminChangePDSCrawlLimit(e echo.Context) error {
 		return err
 	}
 
-	// Update the crawl limit in the limiter
-	limiter := bgs.repoFetcher.GetOrCreateLimiter(pds.ID, limit)
-	limiter.SetLimit(rate.Limit(limit))
+	// Update the crawl limit in the limiter, which adapts to the PDS up to that limit
+	bgs.repoFetcher.SetCrawlLimit(&pds, limit)
 
 	return e.JSON(200, map[string]any{
 		"success": "true",
 	})
 }
 
+// Pins the crawl rate limit of a PDS until the relay restarts, instead of adapting it to the PDS's responses; a limit of 0 returns to the adaptive limit.
+func (bgs *BGS) handleAdminOverridePDSCrawlLimit(e echo.Context) error {
+	host := strings.TrimSpace(e.QueryParam("host"))
+	if host == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must pass a valid host",
+		}
+	}
+
+	limit, err := strconv.ParseFloat(e.QueryParam("limit"), 64)
+	if err != nil || limit < 0 {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must pass a valid limit",
+		}
+	}
+
+	var pds models.PDS
+	if err := bgs.db.Where("host = ?", host).First(&pds).Error; err != nil {
+		return err
+	}
+
+	bgs.repoFetcher.OverrideCrawlLimit(&pds, limit)
+
+	return e.JSON(200, map[string]any{
+		"success":    "true",
+		"crawlLimit": bgs.repoFetcher.CrawlLimitStatus(pds.ID),
+	})
+}
+
 func (bgs *BGS) handleAdminCompactRepo(e echo.Context) error {
 	ctx, span := otel.Tracer("bgs").Start(context.Background(), "adminCompactRepo")
 	defer span.End()
@@ -477,6 +685,42 @@ func (bgs *BGS) handleAdminCompactAllRepos(e echo.Context) error {
 	})
 }
 
+func (bgs *BGS) handleAdminGetCompactionStatus(e echo.Context) error {
+	return e.JSON(200, bgs.compactor.Status())
+}
+
+func (bgs *BGS) handleAdminSetCompactionThrottle(e echo.Context) error {
+	st := bgs.compactor.Status()
+	duty, maxRate := st.DutyCycle, st.MaxIngestRate
+
+	if v := e.QueryParam("dutyCycle"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 || f > 1 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "dutyCycle must be in (0, 1]",
+			}
+		}
+		duty = f
+	}
+	if v := e.QueryParam("maxIngestRate"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			return &echo.HTTPError{
+				Code:    400,
+				Message: "maxIngestRate must be a non-negative number",
+			}
+		}
+		maxRate = f
+	}
+
+	bgs.SetCompactorThrottle(duty, maxRate)
+
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
 func (bgs *BGS) handleAdminPostResyncPDS(e echo.Context) error {
 	host := strings.TrimSpace(e.QueryParam("host"))
 	if host == "" {
@@ -553,6 +797,34 @@ func (bgs *BGS) handleAdminResetRepo(e echo.Context) error {
 	})
 }
 
+func (bgs *BGS) handleAdminVerifyHandle(e echo.Context) error {
+	ctx := e.Request().Context()
+
+	did := e.QueryParam("did")
+	if did == "" {
+		return &echo.HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "must pass a did",
+		}
+	}
+
+	res, err := bgs.RecheckHandle(ctx, did)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{
+				Code:    http.StatusNotFound,
+				Message: "repo not found",
+			}
+		}
+		return &echo.HTTPError{
+			Code:    http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return e.JSON(200, res)
+}
+
 func (bgs *BGS) handleAdminAddTrustedDomain(e echo.Context) error {
 	domain := e.QueryParam("domain")
 	if domain == "" {
@@ -567,3 +839,245 @@ func (bgs *BGS) handleAdminAddTrustedDomain(e echo.Context) error {
 		"success": true,
 	})
 }
+
+// a single persisted event, as returned by the repo event history endpoint
+type repoEventHistoryItem struct {
+	Seq   int64                   `json:"seq"`
+	Type  string                  `json:"type"`
+	Event *events.XRPCStreamEvent `json:"event"`
+}
+
+var errRepoEventHistoryLimit = errors.New("reached limit")
+
+// Returns persisted events (within the relay's replay window) for a single account, for debugging.
+func (bgs *BGS) handleAdminGetRepoEvents(e echo.Context) error {
+	ctx, span := otel.Tracer("bgs").Start(e.Request().Context(), "adminGetRepoEvents")
+	defer span.End()
+
+	did := e.QueryParam("did")
+	if did == "" {
+		return &echo.HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "must pass a did",
+		}
+	}
+
+	var since int64
+	if s := e.QueryParam("since"); s != "" {
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || v < 0 {
+			return &echo.HTTPError{
+				Code:    http.StatusBadRequest,
+				Message: "invalid value for 'since'",
+			}
+		}
+		since = v
+	}
+
+	limit := 100
+	if l := e.QueryParam("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			return &echo.HTTPError{
+				Code:    http.StatusBadRequest,
+				Message: "invalid value for 'limit' (must be between 1 and 1000)",
+			}
+		}
+		limit = v
+	}
+
+	u, err := bgs.lookupUserByDid(ctx, did)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &echo.HTTPError{
+				Code:    http.StatusNotFound,
+				Message: "repo not found",
+			}
+		}
+		return err
+	}
+
+	out := []repoEventHistoryItem{}
+	err = bgs.events.PlaybackUser(ctx, u.ID, u.Did, since, func(evt *events.XRPCStreamEvent) error {
+		out = append(out, repoEventHistoryItem{
+			Seq:   evt.Sequence(),
+			Type:  evt.MessageType(),
+			Event: evt,
+		})
+		if len(out) >= limit {
+			return errRepoEventHistoryLimit
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errRepoEventHistoryLimit) {
+		return fmt.Errorf("playing back events: %w", err)
+	}
+
+	resp := map[string]any{
+		"events": out,
+	}
+	if len(out) >= limit {
+		// cursor for fetching the next page
+		resp["cursor"] = out[len(out)-1].Seq
+	}
+	return e.JSON(200, resp)
+}
+
+// Streams the persisted events (within the relay's replay window) with sequence numbers from 'from' to 'to' as a dump, which can be replayed with events.Replay or 'gosky debug replay-dump'.
+func (bgs *BGS) handleAdminExportEvents(e echo.Context) error {
+	ctx, span := otel.Tracer("bgs").Start(e.Request().Context(), "adminExportEvents")
+	defer span.End()
+
+	var from, to int64
+	for _, p := range []struct {
+		name string
+		v    *int64
+	}{{"from", &from}, {"to", &to}} {
+		s := e.QueryParam(p.name)
+		if s == "" {
+			continue
+		}
+		v, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || v < 0 {
+			return &echo.HTTPError{
+				Code:    http.StatusBadRequest,
+				Message: fmt.Sprintf("invalid value for '%s'", p.name),
+			}
+		}
+		*p.v = v
+	}
+	if to > 0 && to < from {
+		return &echo.HTTPError{
+			Code:    http.StatusBadRequest,
+			Message: "'to' must not be before 'from'",
+		}
+	}
+
+	resp := e.Response()
+	resp.Header().Set(echo.HeaderContentType, echo.MIMEOctetStream)
+	resp.Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=events-%d-%d.dump", from, to))
+	resp.WriteHeader(http.StatusOK)
+	n, err := bgs.events.ExportRange(ctx, from, to, resp)
+	if err != nil {
+		// the response already started, so the dump is left truncated
+		log.Errorw("failed to export events", "from", from, "to", to, "exported", n, "err", err)
+		return nil
+	}
+	log.Infow("exported events", "from", from, "to", to, "exported", n)
+	return nil
+}
+
+func (bgs *BGS) handleAdminListFilters(e echo.Context) error {
+	return e.JSON(200, bgs.filter.List())
+}
+
+func (bgs *BGS) handleAdminBlockDid(e echo.Context) error {
+	return bgs.handleAdminSetDidFilter(e, false)
+}
+
+func (bgs *BGS) handleAdminAllowDid(e echo.Context) error {
+	return bgs.handleAdminSetDidFilter(e, true)
+}
+
+func (bgs *BGS) handleAdminSetDidFilter(e echo.Context, allow bool) error {
+	ctx := e.Request().Context()
+
+	did := strings.TrimSpace(e.QueryParam("did"))
+	if !strings.HasPrefix(did, "did:") {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must pass a valid did",
+		}
+	}
+	reason := e.QueryParam("reason")
+
+	var err error
+	if allow {
+		err = bgs.filter.AllowDid(ctx, did, reason)
+	} else {
+		err = bgs.filter.BlockDid(ctx, did, reason)
+	}
+	if err != nil {
+		return err
+	}
+
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+func (bgs *BGS) handleAdminRemoveDidFilter(e echo.Context) error {
+	ctx := e.Request().Context()
+
+	did := strings.TrimSpace(e.QueryParam("did"))
+	if did == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must pass a valid did",
+		}
+	}
+
+	if err := bgs.filter.RemoveDid(ctx, did); err != nil {
+		return err
+	}
+
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+func (bgs *BGS) handleAdminBlockHost(e echo.Context) error {
+	ctx := e.Request().Context()
+
+	host := strings.TrimSpace(e.QueryParam("host"))
+	if host == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must pass a valid host",
+		}
+	}
+
+	if err := bgs.filter.BlockHost(ctx, host, e.QueryParam("reason")); err != nil {
+		return err
+	}
+
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+func (bgs *BGS) handleAdminUnblockHost(e echo.Context) error {
+	ctx := e.Request().Context()
+
+	host := strings.TrimSpace(e.QueryParam("host"))
+	if host == "" {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: "must pass a valid host",
+		}
+	}
+
+	if err := bgs.filter.UnblockHost(ctx, host); err != nil {
+		return err
+	}
+
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
+
+func (bgs *BGS) handleAdminSetAllowlistOnly(e echo.Context) error {
+	only, err := strconv.ParseBool(e.QueryParam("enabled"))
+	if err != nil {
+		return &echo.HTTPError{
+			Code:    400,
+			Message: err.Error(),
+		}
+	}
+
+	bgs.filter.SetAllowlistOnly(only)
+
+	return e.JSON(200, map[string]any{
+		"success": "true",
+	})
+}
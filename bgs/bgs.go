@@ -13,6 +13,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"contrib.go.opencensus.io/exporter/prometheus"
@@ -88,6 +89,24 @@ type BGS struct {
 
 	// Management of Compaction
 	compactor *Compactor
+
+	// Total number of inbound events, for the compactor to measure the ingest rate
+	eventsIngested atomic.Uint64
+
+	// Pruning of repo data in non-archival mode (disabled by default)
+	pruner *ArchivePruner
+
+	// Periodic re-verification of handles (disabled by default)
+	handleChecker *HandleChecker
+
+	// Moving of older shards to the cold tier of the carstore (disabled by default)
+	coldMover *ColdTierMover
+
+	// DID and host filters of inbound events
+	filter *EventFilter
+
+	// Per-host event quota alerts (disabled by default)
+	hostQuotas *HostQuotaTracker
 }
 
 type PDSResync struct {
@@ -130,6 +149,13 @@ func NewBGS(db *gorm.DB, ix *indexer.Indexer, repoman *repomgr.RepoManager, evtm
 
 		pdsResyncs: make(map[uint]*PDSResync),
 	}
+	bgs.hostQuotas = NewHostQuotaTracker(nil, bgs.throttleHost)
+
+	filter, err := NewEventFilter(db)
+	if err != nil {
+		return nil, err
+	}
+	bgs.filter = filter
 
 	ix.CreateExternalUser = bgs.createExternalUser
 	slOpts := DefaultSlurperOptions()
@@ -152,6 +178,35 @@ func NewBGS(db *gorm.DB, ix *indexer.Indexer, repoman *repomgr.RepoManager, evtm
 	return bgs, nil
 }
 
+// Changes the throttling of the compactor, see CompactorOptions.
+func (bgs *BGS) SetCompactorThrottle(dutyCycle, maxIngestRate float64) {
+	bgs.compactor.SetThrottle(dutyCycle, maxIngestRate)
+}
+
+// Filter returns the DID and host filters of inbound events.
+func (bgs *BGS) Filter() *EventFilter {
+	return bgs.filter
+}
+
+// Configures per-host quota alerts (and optional throttling).
+func (bgs *BGS) SetHostQuotas(opts *HostQuotaOptions) {
+	bgs.hostQuotas.SetOptions(opts)
+}
+
+// reduces the ingest rate limit of a host, if it isn't already lower
+func (bgs *BGS) throttleHost(host *models.PDS, limit float64) {
+	limiter := bgs.slurper.GetOrCreateLimiter(host.ID, limit)
+	if limiter.Limit() > rate.Limit(limit) {
+		limiter.SetLimit(rate.Limit(limit))
+	}
+}
+
+// Starts pruning the repo data left in the carstore, for relays in non-archival mode.
+func (bgs *BGS) StartArchivePruner(opts *ArchivePrunerOptions) {
+	bgs.pruner = NewArchivePruner(opts)
+	bgs.pruner.Start(bgs)
+}
+
 func (bgs *BGS) StartMetrics(listen string) error {
 	http.Handle("/metrics", promhttp.Handler())
 	return http.ListenAndServe(listen, nil)
@@ -343,7 +398,14 @@ func (bgs *BGS) StartWithListener(listen net.Listener) error {
 	admin.POST("/repo/reverseTakedown", bgs.handleAdminReverseTakedown)
 	admin.POST("/repo/compact", bgs.handleAdminCompactRepo)
 	admin.POST("/repo/compactAll", bgs.handleAdminCompactAllRepos)
+	admin.GET("/compaction/status", bgs.handleAdminGetCompactionStatus)
+	admin.POST("/compaction/setThrottle", bgs.handleAdminSetCompactionThrottle)
 	admin.POST("/repo/reset", bgs.handleAdminResetRepo)
+	admin.POST("/repo/verifyHandle", bgs.handleAdminVerifyHandle)
+	admin.GET("/repo/events", bgs.handleAdminGetRepoEvents)
+
+	// Event-related Admin API
+	admin.GET("/events/export", bgs.handleAdminExportEvents)
 
 	// PDS-related Admin API
 	admin.GET("/pds/list", bgs.handleListPDSs)
@@ -351,6 +413,12 @@ func (bgs *BGS) StartWithListener(listen net.Listener) error {
 	admin.GET("/pds/resync", bgs.handleAdminGetResyncPDS)
 	admin.POST("/pds/changeIngestRateLimit", bgs.handleAdminChangePDSRateLimit)
 	admin.POST("/pds/changeCrawlRateLimit", bgs.handleAdminChangePDSCrawlLimit)
+	admin.POST("/pds/overrideCrawlRateLimit", bgs.handleAdminOverridePDSCrawlLimit)
+	admin.GET("/pds/hosts", bgs.handleAdminListHosts)
+	admin.POST("/pds/pause", bgs.handleAdminPauseHost)
+	admin.POST("/pds/resume", bgs.handleAdminResumeHost)
+	admin.POST("/pds/changeRepoLimit", bgs.handleAdminChangeHostRepoLimit)
+	admin.POST("/pds/purge", bgs.handleAdminPurgeHost)
 	admin.POST("/pds/block", bgs.handleBlockPDS)
 	admin.POST("/pds/unblock", bgs.handleUnblockPDS)
 	admin.POST("/pds/addTrustedDomain", bgs.handleAdminAddTrustedDomain)
@@ -358,6 +426,15 @@ func (bgs *BGS) StartWithListener(listen net.Listener) error {
 	// Consumer-related Admin API
 	admin.GET("/consumers/list", bgs.handleAdminListConsumers)
 
+	// Filters of inbound events
+	admin.GET("/filters/list", bgs.handleAdminListFilters)
+	admin.POST("/filters/blockDid", bgs.handleAdminBlockDid)
+	admin.POST("/filters/allowDid", bgs.handleAdminAllowDid)
+	admin.POST("/filters/removeDid", bgs.handleAdminRemoveDidFilter)
+	admin.POST("/filters/blockHost", bgs.handleAdminBlockHost)
+	admin.POST("/filters/unblockHost", bgs.handleAdminUnblockHost)
+	admin.POST("/filters/setAllowlistOnly", bgs.handleAdminSetAllowlistOnly)
+
 	// In order to support booting on random ports in tests, we need to tell the
 	// Echo instance it's already got a port, and then use its StartServer
 	// method to re-use that listener.
@@ -375,6 +452,18 @@ func (bgs *BGS) Shutdown() []error {
 
 	bgs.compactor.Shutdown()
 
+	if bgs.pruner != nil {
+		bgs.pruner.Shutdown()
+	}
+
+	if bgs.handleChecker != nil {
+		bgs.handleChecker.Shutdown()
+	}
+
+	if bgs.coldMover != nil {
+		bgs.coldMover.Shutdown()
+	}
+
 	return errs
 }
 
@@ -645,6 +734,12 @@ func (bgs *BGS) EventsHandler(c echo.Context) error {
 			case evt.RepoTombstone != nil:
 				header.MsgType = "#tombstone"
 				obj = evt.RepoTombstone
+			case evt.RepoIdentity != nil:
+				header.MsgType = "#identity"
+				obj = evt.RepoIdentity
+			case evt.RepoAccount != nil:
+				header.MsgType = "#account"
+				obj = evt.RepoAccount
 			default:
 				return fmt.Errorf("unrecognized event kind")
 			}
@@ -789,6 +884,15 @@ func (bgs *BGS) handleFedEvent(ctx context.Context, host *models.PDS, env *event
 	}()
 
 	eventsReceivedCounter.WithLabelValues(host.Host).Add(1)
+	bgs.eventsIngested.Add(1)
+
+	if reason := bgs.filter.Check(host.Host, env.RepoDID()); reason != "" {
+		eventsFilteredCounter.WithLabelValues(host.Host, reason).Inc()
+		log.Debugw("dropping filtered event", "host", host.Host, "repo", env.RepoDID(), "reason", reason)
+		return nil
+	}
+
+	bgs.hostQuotas.RecordEvent(host)
 
 	switch {
 	case env.RepoCommit != nil:
@@ -802,6 +906,7 @@ func (bgs *BGS) handleFedEvent(ctx context.Context, host *models.PDS, env *event
 			}
 
 			newUsersDiscovered.Inc()
+			bgs.hostQuotas.RecordNewRepo(host)
 			subj, err := bgs.createExternalUser(ctx, evt.Repo)
 			if err != nil {
 				return fmt.Errorf("fed event create external user: %w", err)
@@ -1151,6 +1256,16 @@ func (s *BGS) createExternalUser(ctx context.Context, did string) (*models.Actor
 		return nil, err
 	}
 
+	if peering.RepoLimit > 0 {
+		var count int64
+		if err := s.db.Model(User{}).Where("pds = ?", peering.ID).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("failed to count repos of pds: %w", err)
+		}
+		if count >= peering.RepoLimit {
+			return nil, fmt.Errorf("pds %s has %d repos: %w", peering.Host, count, ErrRepoLimitExceeded)
+		}
+	}
+
 	// TODO: request this users info from their server to fill out our data...
 	u := User{
 		Did:         did,
@@ -1247,6 +1362,70 @@ func (bgs *BGS) ReverseTakedown(ctx context.Context, did string) error {
 	return nil
 }
 
+var ErrRepoLimitExceeded = fmt.Errorf("pds reached its repo limit")
+
+// SetHostRepoLimit sets the maximum number of repos accepted from a PDS; zero removes the limit. Existing repos are kept even if they exceed it.
+func (bgs *BGS) SetHostRepoLimit(ctx context.Context, host string, limit int64) error {
+	res := bgs.db.WithContext(ctx).Model(models.PDS{}).Where("host = ?", host).UpdateColumn("repo_limit", limit)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// PurgeHost disconnects from a PDS, and deletes all of its repos (with their data and events) and the PDS itself. The PDS can be added again later, like a new one. It returns the number of repos deleted.
+func (bgs *BGS) PurgeHost(ctx context.Context, host string) (int64, error) {
+	ctx, span := otel.Tracer("bgs").Start(ctx, "PurgeHost")
+	defer span.End()
+
+	var pds models.PDS
+	if err := bgs.db.WithContext(ctx).Where("host = ?", host).First(&pds).Error; err != nil {
+		return 0, err
+	}
+
+	// stop the subscription first, so no new repos show up while purging
+	if err := bgs.slurper.PauseHost(host); err != nil {
+		return 0, err
+	}
+
+	var purged int64
+	for {
+		var users []User
+		if err := bgs.db.WithContext(ctx).Unscoped().Where("pds = ?", pds.ID).Limit(500).Find(&users).Error; err != nil {
+			return purged, err
+		}
+		if len(users) == 0 {
+			break
+		}
+
+		for _, u := range users {
+			if err := bgs.repoman.TakeDownRepo(ctx, u.ID); err != nil {
+				return purged, fmt.Errorf("failed to delete repo data of %s: %w", u.Did, err)
+			}
+			if err := bgs.events.TakeDownRepo(ctx, u.ID); err != nil {
+				return purged, fmt.Errorf("failed to delete events of %s: %w", u.Did, err)
+			}
+			if err := bgs.db.WithContext(ctx).Unscoped().Where("uid = ?", u.ID).Delete(&models.ActorInfo{}).Error; err != nil {
+				return purged, err
+			}
+			if err := bgs.db.WithContext(ctx).Unscoped().Delete(&User{}, u.ID).Error; err != nil {
+				return purged, err
+			}
+			purged++
+		}
+	}
+
+	if err := bgs.db.WithContext(ctx).Unscoped().Delete(&models.PDS{}, pds.ID).Error; err != nil {
+		return purged, err
+	}
+
+	log.Warnw("purged pds", "host", host, "repos", purged)
+	return purged, nil
+}
+
 type revCheckResult struct {
 	ai  *models.ActorInfo
 	err error
@@ -0,0 +1,113 @@
+package bgs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/carstore"
+	"go.opentelemetry.io/otel"
+)
+
+// ColdTierMover moves the older carstore shards to the cold tier of the carstore, in the background.
+type ColdTierMover struct {
+	cs           *carstore.CarStore
+	age          time.Duration
+	batchSize    int
+	interval     time.Duration
+	idleInterval time.Duration
+	exit         chan struct{}
+	exited       chan struct{}
+}
+
+type ColdTierMoverOptions struct {
+	// Shards older than this are moved
+	Age time.Duration
+	// Number of shards moved per batch
+	BatchSize int
+	// Pause between batches, to limit the load on the carstore
+	Interval time.Duration
+	// Pause once there are no shards left to move, before looking again
+	IdleInterval time.Duration
+}
+
+func DefaultColdTierMoverOptions() *ColdTierMoverOptions {
+	return &ColdTierMoverOptions{
+		Age:          30 * 24 * time.Hour,
+		BatchSize:    100,
+		Interval:     time.Second,
+		IdleInterval: 10 * time.Minute,
+	}
+}
+
+func NewColdTierMover(cs *carstore.CarStore, opts *ColdTierMoverOptions) *ColdTierMover {
+	if opts == nil {
+		opts = DefaultColdTierMoverOptions()
+	}
+	return &ColdTierMover{
+		cs:           cs,
+		age:          opts.Age,
+		batchSize:    opts.BatchSize,
+		interval:     opts.Interval,
+		idleInterval: opts.IdleInterval,
+		exit:         make(chan struct{}),
+		exited:       make(chan struct{}),
+	}
+}
+
+// Start starts the cold tier mover
+func (m *ColdTierMover) Start() {
+	log.Infow("starting cold tier mover", "age", m.age, "batchSize", m.batchSize)
+	go m.doWork()
+}
+
+// Shutdown shuts down the cold tier mover
+func (m *ColdTierMover) Shutdown() {
+	log.Info("stopping cold tier mover")
+	close(m.exit)
+	<-m.exited
+	log.Info("cold tier mover stopped")
+}
+
+func (m *ColdTierMover) doWork() {
+	defer close(m.exited)
+
+	for {
+		n, err := m.moveBatch(context.Background())
+		if err != nil {
+			log.Errorw("failed to move shards to cold tier", "err", err)
+		}
+
+		pause := m.interval
+		if n == 0 {
+			pause = m.idleInterval
+		}
+		select {
+		case <-m.exit:
+			return
+		case <-time.After(pause):
+		}
+	}
+}
+
+func (m *ColdTierMover) moveBatch(ctx context.Context) (int, error) {
+	ctx, span := otel.Tracer("coldtier").Start(ctx, "moveBatch")
+	defer span.End()
+
+	n, err := m.cs.MoveShardsToColdTier(ctx, time.Now().Add(-m.age), m.batchSize)
+	if n > 0 {
+		log.Debugw("moved shards to cold tier", "shards", n)
+	}
+	return n, err
+}
+
+// Starts moving the older shards to the cold tier of the carstore, which must be a CarStore (the files backend) with a cold tier set.
+func (bgs *BGS) StartColdTierMover(opts *ColdTierMoverOptions) error {
+	cs, ok := bgs.repoman.CarStore().(*carstore.CarStore)
+	if !ok {
+		return fmt.Errorf("cold tier requires the files carstore backend")
+	}
+	bgs.coldMover = NewColdTierMover(cs, opts)
+	bgs.coldMover.Start()
+	return nil
+}
@@ -105,7 +105,7 @@ type CompactorState struct {
 	stats     *carstore.CompactionStats
 }
 
-// Compactor is a compactor daemon that compacts repos in the background
+// Compactor is a compactor daemon that compacts repos in the background, the most fragmented first, throttling itself and pausing while the ingest rate is high
 type Compactor struct {
 	q                 *uniQueue
 	state             *CompactorState
@@ -116,6 +116,14 @@ type Compactor struct {
 	requeueLimit      int
 	requeueShardCount int
 	requeueFast       bool
+
+	// guarded by stateLk
+	dutyCycle     float64
+	maxIngestRate float64
+	ingestRate    float64
+	paused        bool
+	passTargets   int
+	passCompleted int
 }
 
 type CompactorOptions struct {
@@ -123,6 +131,10 @@ type CompactorOptions struct {
 	RequeueLimit      int
 	RequeueShardCount int
 	RequeueFast       bool
+	// Fraction of the time spent compacting, in (0, 1]: after each compaction, the compactor sleeps in proportion to its duration, leaving IO and CPU to ingestion
+	DutyCycle float64
+	// Compaction pauses while the rate of inbound events is above this, in events per second, and resumes below 80% of it (0 disables)
+	MaxIngestRate float64
 }
 
 func DefaultCompactorOptions() *CompactorOptions {
@@ -131,9 +143,14 @@ func DefaultCompactorOptions() *CompactorOptions {
 		RequeueLimit:      0,
 		RequeueShardCount: 50,
 		RequeueFast:       true,
+		DutyCycle:         0.5,
+		MaxIngestRate:     0,
 	}
 }
 
+// How often the ingest rate is measured.
+const compactorLoadInterval = 5 * time.Second
+
 func NewCompactor(opts *CompactorOptions) *Compactor {
 	if opts == nil {
 		opts = DefaultCompactorOptions()
@@ -150,6 +167,122 @@ func NewCompactor(opts *CompactorOptions) *Compactor {
 		requeueLimit:      opts.RequeueLimit,
 		requeueFast:       opts.RequeueFast,
 		requeueShardCount: opts.RequeueShardCount,
+		dutyCycle:         opts.DutyCycle,
+		maxIngestRate:     opts.MaxIngestRate,
+	}
+}
+
+// SetThrottle changes the duty cycle and the maximum ingest rate of a running compactor (see CompactorOptions).
+func (c *Compactor) SetThrottle(dutyCycle, maxIngestRate float64) {
+	c.stateLk.Lock()
+	defer c.stateLk.Unlock()
+
+	c.dutyCycle = dutyCycle
+	c.maxIngestRate = maxIngestRate
+	if maxIngestRate <= 0 {
+		c.paused = false
+		compactionPaused.Set(0)
+	}
+}
+
+// CompactorStatus is the progress of the compactor, as reported by the admin API.
+type CompactorStatus struct {
+	QueueDepth int `json:"QueueDepth"`
+	// Repos enqueued by the last requeue, and how many of them were compacted since
+	PassTargets   int `json:"PassTargets"`
+	PassCompleted int `json:"PassCompleted"`
+	// Whether compaction is paused because of the ingest rate, in events per second
+	Paused        bool    `json:"Paused"`
+	IngestRate    float64 `json:"IngestRate"`
+	MaxIngestRate float64 `json:"MaxIngestRate"`
+	DutyCycle     float64 `json:"DutyCycle"`
+	LatestDid     string  `json:"LatestDid"`
+	LatestStatus  string  `json:"LatestStatus"`
+}
+
+func (c *Compactor) Status() *CompactorStatus {
+	c.q.lk.Lock()
+	depth := len(c.q.q)
+	c.q.lk.Unlock()
+
+	c.stateLk.RLock()
+	defer c.stateLk.RUnlock()
+
+	return &CompactorStatus{
+		QueueDepth:    depth,
+		PassTargets:   c.passTargets,
+		PassCompleted: c.passCompleted,
+		Paused:        c.paused,
+		IngestRate:    c.ingestRate,
+		MaxIngestRate: c.maxIngestRate,
+		DutyCycle:     c.dutyCycle,
+		LatestDid:     c.state.latestDID,
+		LatestStatus:  c.state.status,
+	}
+}
+
+// Measures the ingest rate of the BGS, and pauses or resumes compaction accordingly.
+func (c *Compactor) watchLoad(bgs *BGS) {
+	t := time.NewTicker(compactorLoadInterval)
+	defer t.Stop()
+
+	last := bgs.eventsIngested.Load()
+	lastAt := time.Now()
+	for {
+		select {
+		case <-c.exit:
+			return
+		case now := <-t.C:
+			cur := bgs.eventsIngested.Load()
+			rate := float64(cur-last) / now.Sub(lastAt).Seconds()
+			last, lastAt = cur, now
+			c.observeIngestRate(rate)
+		}
+	}
+}
+
+func (c *Compactor) observeIngestRate(rate float64) {
+	c.stateLk.Lock()
+	defer c.stateLk.Unlock()
+
+	c.ingestRate = rate
+	compactionIngestRate.Set(rate)
+	if c.maxIngestRate <= 0 {
+		return
+	}
+
+	switch {
+	case !c.paused && rate > c.maxIngestRate:
+		log.Infow("pausing compaction during high ingest", "rate", rate, "max", c.maxIngestRate)
+		c.paused = true
+		compactionPaused.Set(1)
+	case c.paused && rate < c.maxIngestRate*0.8:
+		log.Infow("resuming compaction", "rate", rate, "max", c.maxIngestRate)
+		c.paused = false
+		compactionPaused.Set(0)
+	}
+}
+
+func (c *Compactor) isPaused() bool {
+	c.stateLk.RLock()
+	defer c.stateLk.RUnlock()
+	return c.paused
+}
+
+// Sleeps after a compaction which took d, according to the duty cycle; returns false if the compactor is shutting down.
+func (c *Compactor) throttle(d time.Duration) bool {
+	c.stateLk.RLock()
+	duty := c.dutyCycle
+	c.stateLk.RUnlock()
+
+	if duty <= 0 || duty >= 1 {
+		return true
+	}
+	select {
+	case <-c.exit:
+		return false
+	case <-time.After(time.Duration(float64(d) * (1 - duty) / duty)):
+		return true
 	}
 }
 
@@ -186,6 +319,7 @@ var errNoReposToCompact = fmt.Errorf("no repos to compact")
 func (c *Compactor) Start(bgs *BGS) {
 	log.Info("starting compactor")
 	go c.doWork(bgs)
+	go c.watchLoad(bgs)
 	go func() {
 		log.Infow("starting compactor requeue routine",
 			"interval", c.requeueInterval,
@@ -237,6 +371,11 @@ func (c *Compactor) doWork(bgs *BGS) {
 		default:
 		}
 
+		if c.isPaused() {
+			time.Sleep(time.Second)
+			continue
+		}
+
 		ctx := context.Background()
 		start := time.Now()
 		state, err := c.compactNext(ctx, bgs)
@@ -255,6 +394,7 @@ func (c *Compactor) doWork(bgs *BGS) {
 				"stats", state.stats,
 				"duration", time.Since(start),
 			)
+			compactionsCounter.WithLabelValues("failed").Inc()
 			// Pause for a bit to avoid spamming failed compactions
 			time.Sleep(time.Millisecond * 100)
 		} else {
@@ -265,7 +405,16 @@ func (c *Compactor) doWork(bgs *BGS) {
 				"stats", state.stats,
 				"duration", time.Since(start),
 			)
+			compactionsCounter.WithLabelValues("ok").Inc()
+			compactionShardsDeleted.Add(float64(state.stats.ShardsDeleted))
 		}
+
+		c.stateLk.Lock()
+		c.passCompleted++
+		compactionPassCompleted.Set(float64(c.passCompleted))
+		c.stateLk.Unlock()
+
+		c.throttle(time.Since(start))
 	}
 }
 
@@ -360,6 +509,13 @@ func (c *Compactor) EnqueueAllRepos(ctx context.Context, bgs *BGS, lim int, shar
 		c.q.Append(r.Usr, fast)
 	}
 
+	c.stateLk.Lock()
+	c.passTargets = len(repos)
+	c.passCompleted = 0
+	c.stateLk.Unlock()
+	compactionPassTargets.Set(float64(len(repos)))
+	compactionPassCompleted.Set(0)
+
 	log.Infow("done enqueueing all repos", "repos_enqueued", len(repos))
 
 	return nil
@@ -65,6 +65,11 @@ type activeSub struct {
 	lk     sync.RWMutex
 	ctx    context.Context
 	cancel func()
+
+	// stats of the current connection, guarded by lk
+	connectedAt time.Time
+	lastEvent   time.Time
+	events      uint64
 }
 
 func NewSlurper(db *gorm.DB, cb IndexCallback, opts *SlurperOptions) (*Slurper, error) {
@@ -301,6 +306,10 @@ func (s *Slurper) SubscribeToPds(ctx context.Context, host string, reg bool) err
 		return fmt.Errorf("cannot subscribe to blocked pds")
 	}
 
+	if peering.Paused {
+		return ErrHostPaused
+	}
+
 	if peering.ID == 0 {
 		// New PDS!
 		npds := models.PDS{
@@ -324,19 +333,24 @@ func (s *Slurper) SubscribeToPds(ctx context.Context, host string, reg bool) err
 		}
 	}
 
+	s.startSubLocked(&peering)
+
+	return nil
+}
+
+// must be called with the lock held
+func (s *Slurper) startSubLocked(pds *models.PDS) {
 	ctx, cancel := context.WithCancel(context.Background())
 	sub := activeSub{
-		pds:    &peering,
+		pds:    pds,
 		ctx:    ctx,
 		cancel: cancel,
 	}
-	s.active[host] = &sub
-
-	s.GetOrCreateLimiter(peering.ID, peering.RateLimit)
+	s.active[pds.Host] = &sub
 
-	go s.subscribeWithRedialer(ctx, &peering, &sub)
-
-	return nil
+	// Check if we've already got a limiter for this PDS
+	s.GetOrCreateLimiter(pds.ID, pds.RateLimit)
+	go s.subscribeWithRedialer(ctx, pds, &sub)
 }
 
 func (s *Slurper) RestartAll() error {
@@ -344,24 +358,13 @@ func (s *Slurper) RestartAll() error {
 	defer s.lk.Unlock()
 
 	var all []models.PDS
-	if err := s.db.Find(&all, "registered = true AND blocked = false").Error; err != nil {
+	if err := s.db.Find(&all, "registered = true AND blocked = false AND paused = false").Error; err != nil {
 		return err
 	}
 
 	for _, pds := range all {
 		pds := pds
-
-		ctx, cancel := context.WithCancel(context.Background())
-		sub := activeSub{
-			pds:    &pds,
-			ctx:    ctx,
-			cancel: cancel,
-		}
-		s.active[pds.Host] = &sub
-
-		// Check if we've already got a limiter for this PDS
-		s.GetOrCreateLimiter(pds.ID, pds.RateLimit)
-		go s.subscribeWithRedialer(ctx, &pds, &sub)
+		s.startSubLocked(&pds)
 	}
 
 	return nil
@@ -372,7 +375,10 @@ func (s *Slurper) subscribeWithRedialer(ctx context.Context, host *models.PDS, s
 		s.lk.Lock()
 		defer s.lk.Unlock()
 
-		delete(s.active, host.Host)
+		// the host may have been paused and resumed since, with a new subscription
+		if s.active[host.Host] == sub {
+			delete(s.active, host.Host)
+		}
 	}()
 
 	d := websocket.Dialer{
@@ -450,6 +456,17 @@ func (s *Slurper) handleConnection(ctx context.Context, host *models.PDS, con *w
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	sub.lk.Lock()
+	sub.connectedAt = time.Now()
+	sub.lastEvent = time.Time{}
+	sub.events = 0
+	sub.lk.Unlock()
+	defer func() {
+		sub.lk.Lock()
+		sub.connectedAt = time.Time{}
+		sub.lk.Unlock()
+	}()
+
 	rsc := &events.RepoStreamCallbacks{
 		RepoCommit: func(evt *comatproto.SyncSubscribeRepos_Commit) error {
 			log.Debugw("got remote repo event", "host", host.Host, "repo", evt.Repo, "seq", evt.Seq)
@@ -553,6 +570,8 @@ func (s *Slurper) updateCursor(sub *activeSub, curs int64) error {
 	sub.lk.Lock()
 	defer sub.lk.Unlock()
 	sub.pds.Cursor = curs
+	sub.lastEvent = time.Now()
+	sub.events++
 	return nil
 }
 
@@ -626,3 +645,83 @@ func (s *Slurper) KillUpstreamConnection(host string, block bool) error {
 
 	return nil
 }
+
+var ErrHostPaused = fmt.Errorf("host is paused")
+
+// PauseHost disconnects from a host, and prevents subscribing to it again (including after restarts) until it's resumed.
+func (s *Slurper) PauseHost(host string) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	var pds models.PDS
+	if err := s.db.Where("host = ?", host).First(&pds).Error; err != nil {
+		return err
+	}
+
+	updates := map[string]any{"paused": true}
+	if ac, ok := s.active[host]; ok {
+		ac.cancel()
+		// the cursor of the subscription won't be flushed anymore
+		ac.lk.RLock()
+		updates["cursor"] = ac.pds.Cursor
+		ac.lk.RUnlock()
+		delete(s.active, host)
+	}
+
+	if err := s.db.Model(models.PDS{}).Where("id = ?", pds.ID).UpdateColumns(updates).Error; err != nil {
+		return fmt.Errorf("failed to set host as paused: %w", err)
+	}
+
+	return nil
+}
+
+// ResumeHost lifts the pause of a host, and subscribes to it again from its last cursor if it's registered.
+func (s *Slurper) ResumeHost(host string) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	var pds models.PDS
+	if err := s.db.Where("host = ?", host).First(&pds).Error; err != nil {
+		return err
+	}
+
+	if err := s.db.Model(models.PDS{}).Where("id = ?", pds.ID).UpdateColumn("paused", false).Error; err != nil {
+		return fmt.Errorf("failed to resume host: %w", err)
+	}
+	pds.Paused = false
+
+	if _, ok := s.active[host]; ok || !pds.Registered || pds.Blocked {
+		return nil
+	}
+	s.startSubLocked(&pds)
+
+	return nil
+}
+
+// hostStats are the stats of the current subscription to a host.
+type hostStats struct {
+	Cursor      int64
+	ConnectedAt time.Time
+	LastEvent   time.Time
+	Events      uint64
+}
+
+// GetHostStats returns the stats of the active subscriptions, by host.
+func (s *Slurper) GetHostStats() map[string]hostStats {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	out := make(map[string]hostStats, len(s.active))
+	for host, sub := range s.active {
+		sub.lk.RLock()
+		out[host] = hostStats{
+			Cursor:      sub.pds.Cursor,
+			ConnectedAt: sub.connectedAt,
+			LastEvent:   sub.lastEvent,
+			Events:      sub.events,
+		}
+		sub.lk.RUnlock()
+	}
+
+	return out
+}
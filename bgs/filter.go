@@ -0,0 +1,216 @@
+package bgs
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Reasons for dropping inbound events, as reported by EventFilter.Check.
+const (
+	FilterDidBlocked    = "did_blocked"
+	FilterDidNotAllowed = "did_not_allowed"
+	FilterHostBlocked   = "host_blocked"
+)
+
+// EventFilter drops inbound events by DID or PDS host, before they're processed. The filters are stored in the database, and kept in memory.
+type EventFilter struct {
+	db *gorm.DB
+
+	lk            sync.RWMutex
+	dids          map[string]*models.DidFilter
+	hosts         map[string]*models.HostFilter
+	allowlistOnly bool
+}
+
+// EventFilterList is the current state of the filters of an EventFilter.
+type EventFilterList struct {
+	Dids  []models.DidFilter  `json:"Dids"`
+	Hosts []models.HostFilter `json:"Hosts"`
+	// Whether only the events about allowed DIDs are accepted
+	AllowlistOnly bool `json:"AllowlistOnly"`
+}
+
+func NewEventFilter(db *gorm.DB) (*EventFilter, error) {
+	if err := db.AutoMigrate(&models.DidFilter{}, &models.HostFilter{}); err != nil {
+		return nil, err
+	}
+
+	f := &EventFilter{
+		db:    db,
+		dids:  make(map[string]*models.DidFilter),
+		hosts: make(map[string]*models.HostFilter),
+	}
+
+	var dids []*models.DidFilter
+	if err := db.Find(&dids).Error; err != nil {
+		return nil, fmt.Errorf("loading did filters: %w", err)
+	}
+	for _, df := range dids {
+		f.dids[df.Did] = df
+	}
+
+	var hosts []*models.HostFilter
+	if err := db.Find(&hosts).Error; err != nil {
+		return nil, fmt.Errorf("loading host filters: %w", err)
+	}
+	for _, hf := range hosts {
+		f.hosts[hf.Host] = hf
+	}
+
+	return f, nil
+}
+
+// Check returns why an event about a DID from a host should be dropped, or an empty string if it should be accepted. The DID is empty for events which aren't about a repo.
+func (f *EventFilter) Check(host, did string) string {
+	f.lk.RLock()
+	defer f.lk.RUnlock()
+
+	if len(f.hosts) > 0 && f.hostBlockedLocked(host) {
+		return FilterHostBlocked
+	}
+
+	if did == "" {
+		return ""
+	}
+	df, ok := f.dids[did]
+	switch {
+	case ok && !df.Allow:
+		return FilterDidBlocked
+	case !ok && f.allowlistOnly:
+		return FilterDidNotAllowed
+	}
+	return ""
+}
+
+// Matches the host itself (with or without its port), then its parent domains.
+func (f *EventFilter) hostBlockedLocked(host string) bool {
+	if _, ok := f.hosts[host]; ok {
+		return true
+	}
+
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	for {
+		if _, ok := f.hosts[host]; ok {
+			return true
+		}
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok || !strings.Contains(parent, ".") {
+			return false
+		}
+		host = parent
+	}
+}
+
+// SetAllowlistOnly sets whether only the events about allowed DIDs are accepted. It isn't persisted.
+func (f *EventFilter) SetAllowlistOnly(only bool) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.allowlistOnly = only
+}
+
+// BlockDid drops the events about a DID, replacing any allowlist entry for it.
+func (f *EventFilter) BlockDid(ctx context.Context, did, reason string) error {
+	return f.setDid(ctx, did, false, reason)
+}
+
+// AllowDid adds a DID to the allowlist, replacing any blocklist entry for it.
+func (f *EventFilter) AllowDid(ctx context.Context, did, reason string) error {
+	return f.setDid(ctx, did, true, reason)
+}
+
+func (f *EventFilter) setDid(ctx context.Context, did string, allow bool, reason string) error {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	df := &models.DidFilter{Did: did, Allow: allow, Reason: reason}
+	if err := f.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "did"}},
+		DoUpdates: clause.AssignmentColumns([]string{"allow", "reason", "updated_at"}),
+	}).Create(df).Error; err != nil {
+		return fmt.Errorf("saving did filter: %w", err)
+	}
+	// the created row, or the existing one on conflict
+	if err := f.db.WithContext(ctx).Where("did = ?", did).Take(df).Error; err != nil {
+		return err
+	}
+	f.dids[did] = df
+	return nil
+}
+
+// RemoveDid removes a DID from the blocklist or the allowlist.
+func (f *EventFilter) RemoveDid(ctx context.Context, did string) error {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	if err := f.db.WithContext(ctx).Unscoped().Where("did = ?", did).Delete(&models.DidFilter{}).Error; err != nil {
+		return err
+	}
+	delete(f.dids, did)
+	return nil
+}
+
+// BlockHost drops the events from a host, and from its subdomains.
+func (f *EventFilter) BlockHost(ctx context.Context, host, reason string) error {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	host = strings.ToLower(host)
+	hf := &models.HostFilter{Host: host, Reason: reason}
+	if err := f.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "host"}},
+		DoUpdates: clause.AssignmentColumns([]string{"reason", "updated_at"}),
+	}).Create(hf).Error; err != nil {
+		return fmt.Errorf("saving host filter: %w", err)
+	}
+	if err := f.db.WithContext(ctx).Where("host = ?", host).Take(hf).Error; err != nil {
+		return err
+	}
+	f.hosts[host] = hf
+	return nil
+}
+
+// UnblockHost removes a host from the blocklist.
+func (f *EventFilter) UnblockHost(ctx context.Context, host string) error {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	host = strings.ToLower(host)
+	if err := f.db.WithContext(ctx).Unscoped().Where("host = ?", host).Delete(&models.HostFilter{}).Error; err != nil {
+		return err
+	}
+	delete(f.hosts, host)
+	return nil
+}
+
+// List returns all the filters.
+func (f *EventFilter) List() *EventFilterList {
+	f.lk.RLock()
+	defer f.lk.RUnlock()
+
+	out := &EventFilterList{
+		Dids:          make([]models.DidFilter, 0, len(f.dids)),
+		Hosts:         make([]models.HostFilter, 0, len(f.hosts)),
+		AllowlistOnly: f.allowlistOnly,
+	}
+	for _, df := range f.dids {
+		out.Dids = append(out.Dids, *df)
+	}
+	for _, hf := range f.hosts {
+		out.Hosts = append(out.Hosts, *hf)
+	}
+	slices.SortFunc(out.Dids, func(a, b models.DidFilter) int { return strings.Compare(a.Did, b.Did) })
+	slices.SortFunc(out.Hosts, func(a, b models.HostFilter) int { return strings.Compare(a.Host, b.Host) })
+	return out
+}
@@ -0,0 +1,273 @@
+package bgs
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util"
+
+	"go.opentelemetry.io/otel"
+)
+
+// The handle of accounts whose handle can't be verified, in #identity events.
+const invalidHandle = "handle.invalid"
+
+// HandleChecker periodically re-verifies the handles of active accounts, resolving their DID documents and their handles again, and emits #identity events for the handles which changed or stopped (or started) being valid.
+type HandleChecker struct {
+	interval    time.Duration
+	batchSize   int
+	concurrency int
+	exit        chan struct{}
+	exited      chan struct{}
+}
+
+type HandleCheckOptions struct {
+	// Time for a full pass over all active accounts; each account is checked about once per interval
+	Interval time.Duration
+	// Number of accounts loaded at once
+	BatchSize int
+	// Number of accounts checked in parallel
+	Concurrency int
+}
+
+func DefaultHandleCheckOptions() *HandleCheckOptions {
+	return &HandleCheckOptions{
+		Interval:    24 * time.Hour,
+		BatchSize:   100,
+		Concurrency: 4,
+	}
+}
+
+func NewHandleChecker(opts *HandleCheckOptions) *HandleChecker {
+	if opts == nil {
+		opts = DefaultHandleCheckOptions()
+	}
+	return &HandleChecker{
+		interval:    opts.Interval,
+		batchSize:   opts.BatchSize,
+		concurrency: max(opts.Concurrency, 1),
+		exit:        make(chan struct{}),
+		exited:      make(chan struct{}),
+	}
+}
+
+// HandleCheckResult is the outcome of re-verifying the handle of an account.
+type HandleCheckResult struct {
+	Did string `json:"Did"`
+	// The handle claimed by the DID document
+	Handle string `json:"Handle"`
+	Valid  bool   `json:"Valid"`
+	// Set if the stored handle (or its validity) was updated, and an #identity event emitted
+	Changed bool `json:"Changed"`
+}
+
+// Start starts the handle checker
+func (hc *HandleChecker) Start(bgs *BGS) {
+	log.Infow("starting handle checker", "interval", hc.interval, "batchSize", hc.batchSize, "concurrency", hc.concurrency)
+	go hc.doWork(bgs)
+}
+
+// Shutdown shuts down the handle checker
+func (hc *HandleChecker) Shutdown() {
+	log.Info("stopping handle checker")
+	close(hc.exit)
+	<-hc.exited
+	log.Info("handle checker stopped")
+}
+
+func (hc *HandleChecker) doWork(bgs *BGS) {
+	defer close(hc.exited)
+
+	for {
+		start := time.Now()
+		if err := hc.checkAll(bgs); err != nil {
+			log.Errorw("handle check pass failed", "err", err)
+		}
+
+		// don't start over before the end of the interval, in case the pass went faster
+		select {
+		case <-hc.exit:
+			return
+		case <-time.After(hc.interval - time.Since(start)):
+		}
+	}
+}
+
+// Checks all active accounts, spreading the batches over the interval.
+func (hc *HandleChecker) checkAll(bgs *BGS) error {
+	ctx := context.Background()
+
+	var total int64
+	if err := bgs.db.Model(User{}).Where("taken_down = false AND tombstoned = false").Count(&total).Error; err != nil {
+		return err
+	}
+	if total == 0 {
+		return nil
+	}
+	pause := time.Duration(float64(hc.interval) * float64(hc.batchSize) / float64(total))
+
+	var after models.Uid
+	for {
+		var users []User
+		if err := bgs.db.Model(User{}).Where("id > ? AND taken_down = false AND tombstoned = false", after).Order("id asc").Limit(hc.batchSize).Find(&users).Error; err != nil {
+			return err
+		}
+		if len(users) == 0 {
+			return nil
+		}
+		after = users[len(users)-1].ID
+
+		start := time.Now()
+		hc.checkBatch(ctx, bgs, users)
+
+		select {
+		case <-hc.exit:
+			return nil
+		case <-time.After(pause - time.Since(start)):
+		}
+	}
+}
+
+func (hc *HandleChecker) checkBatch(ctx context.Context, bgs *BGS, users []User) {
+	ctx, span := otel.Tracer("handlecheck").Start(ctx, "checkBatch")
+	defer span.End()
+
+	sem := make(chan struct{}, hc.concurrency)
+	var wg sync.WaitGroup
+	for i := range users {
+		u := &users[i]
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if _, err := bgs.checkHandle(ctx, u); err != nil {
+				log.Warnw("failed to check handle", "did", u.Did, "err", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Starts re-verifying the handles of accounts periodically (disabled by default).
+func (bgs *BGS) StartHandleChecker(opts *HandleCheckOptions) {
+	bgs.handleChecker = NewHandleChecker(opts)
+	bgs.handleChecker.Start(bgs)
+}
+
+// RecheckHandle re-verifies the handle of an account right away, emitting an #identity event if it changed.
+func (bgs *BGS) RecheckHandle(ctx context.Context, did string) (*HandleCheckResult, error) {
+	u, err := bgs.lookupUserByDid(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	return bgs.checkHandle(ctx, u)
+}
+
+func (bgs *BGS) checkHandle(ctx context.Context, u *User) (*HandleCheckResult, error) {
+	ctx, span := otel.Tracer("handlecheck").Start(ctx, "checkHandle")
+	defer span.End()
+
+	// the document may have changed without an event from the PDS
+	bgs.didr.FlushCacheFor(u.Did)
+	doc, err := bgs.didr.GetDocument(ctx, u.Did)
+	if err != nil {
+		// not the fault of the handle, which is left as is
+		handleChecks.WithLabelValues("error").Inc()
+		handleCheckFailures.WithLabelValues("did_resolution").Inc()
+		return nil, fmt.Errorf("resolving did: %w", err)
+	}
+
+	res := &HandleCheckResult{Did: u.Did}
+	if len(doc.AlsoKnownAs) > 0 {
+		if hurl, err := url.Parse(doc.AlsoKnownAs[0]); err == nil {
+			res.Handle = hurl.Host
+		}
+	}
+
+	switch {
+	case res.Handle == "":
+		handleCheckFailures.WithLabelValues("no_handle").Inc()
+	default:
+		resdid, err := bgs.hr.ResolveHandleToDid(ctx, res.Handle)
+		switch {
+		case err != nil:
+			handleCheckFailures.WithLabelValues("handle_resolution").Inc()
+			log.Debugw("failed to resolve handle", "did", u.Did, "handle", res.Handle, "err", err)
+		case resdid != u.Did:
+			handleCheckFailures.WithLabelValues("did_mismatch").Inc()
+			log.Debugw("handle resolved to another did", "did", u.Did, "handle", res.Handle, "resolved", resdid)
+		default:
+			res.Valid = true
+		}
+	}
+
+	if res.Valid {
+		handleChecks.WithLabelValues("valid").Inc()
+	} else {
+		handleChecks.WithLabelValues("invalid").Inc()
+	}
+
+	if res.Valid == u.ValidHandle && (!res.Valid || res.Handle == u.Handle.String) {
+		return res, nil
+	}
+	res.Changed = true
+	handleChanges.Inc()
+
+	log.Infow("handle changed on recheck", "did", u.Did, "old", u.Handle.String, "oldValid", u.ValidHandle, "new", res.Handle, "valid", res.Valid)
+
+	if err := bgs.updateHandle(ctx, u, res.Handle, res.Valid); err != nil {
+		return nil, err
+	}
+
+	evtHandle := invalidHandle
+	if res.Valid {
+		evtHandle = res.Handle
+	}
+	if err := bgs.events.AddEvent(ctx, &events.XRPCStreamEvent{
+		RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{
+			Did:    u.Did,
+			Handle: &evtHandle,
+			Time:   time.Now().Format(util.ISO8601),
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to broadcast identity event: %w", err)
+	}
+
+	return res, nil
+}
+
+// Stores the new handle of an account, clearing it if it isn't valid.
+func (bgs *BGS) updateHandle(ctx context.Context, u *User, handle string, valid bool) error {
+	var h sql.NullString
+	if valid {
+		h = sql.NullString{String: handle, Valid: true}
+
+		// whoever had the handle before doesn't control it anymore
+		if err := bgs.db.Model(User{}).Where("handle = ? AND id != ?", handle, u.ID).Updates(map[string]any{"handle": nil, "valid_handle": false}).Error; err != nil {
+			return fmt.Errorf("failed to clear outdated user handle: %w", err)
+		}
+		if err := bgs.db.Model(models.ActorInfo{}).Where("handle = ? AND uid != ?", handle, u.ID).Updates(map[string]any{"handle": nil, "valid_handle": false}).Error; err != nil {
+			return fmt.Errorf("failed to clear outdated actorInfo handle: %w", err)
+		}
+	}
+
+	if err := bgs.db.Model(User{}).Where("id = ?", u.ID).Updates(map[string]any{"handle": h, "valid_handle": valid}).Error; err != nil {
+		return fmt.Errorf("failed to update user handle: %w", err)
+	}
+	if err := bgs.db.Model(models.ActorInfo{}).Where("uid = ?", u.ID).Updates(map[string]any{"handle": h, "valid_handle": valid}).Error; err != nil {
+		return fmt.Errorf("failed to update actorInfo handle: %w", err)
+	}
+
+	u.Handle = h
+	u.ValidHandle = valid
+	return nil
+}
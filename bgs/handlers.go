@@ -16,6 +16,7 @@ import (
 	"github.com/bluesky-social/indigo/blobs"
 	"github.com/bluesky-social/indigo/carstore"
 	"github.com/bluesky-social/indigo/mst"
+	"github.com/bluesky-social/indigo/repomgr"
 	"gorm.io/gorm"
 
 	"github.com/bluesky-social/indigo/xrpc"
@@ -48,6 +49,9 @@ func (s *BGS) handleComAtprotoSyncGetRecord(ctx context.Context, collection stri
 		if errors.Is(err, mst.ErrNotFound) {
 			return nil, echo.NewHTTPError(http.StatusNotFound, "record not found in repo")
 		}
+		if errors.Is(err, repomgr.ErrNonArchival) {
+			return nil, echo.NewHTTPError(http.StatusNotImplemented, "this relay does not keep repo data")
+		}
 		log.Errorw("failed to get record from repo", "err", err, "did", did, "collection", collection, "rkey", rkey)
 		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to get record from repo")
 	}
@@ -91,6 +95,9 @@ func (s *BGS) handleComAtprotoSyncGetRepo(ctx context.Context, did string, since
 	// TODO: stream the response
 	buf := new(bytes.Buffer)
 	if err := s.repoman.ReadRepo(ctx, u.ID, since, buf); err != nil {
+		if errors.Is(err, repomgr.ErrNonArchival) {
+			return nil, echo.NewHTTPError(http.StatusNotImplemented, "this relay does not keep repo data")
+		}
 		log.Errorw("failed to read repo into buffer", "err", err, "did", did)
 		return nil, echo.NewHTTPError(http.StatusInternalServerError, "failed to read repo into buffer")
 	}
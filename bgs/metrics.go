@@ -53,6 +53,11 @@ var compactionQueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
 	Help: "The current depth of the compaction queue",
 })
 
+var hostQuotaAlerts = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "bgs_host_quota_alerts",
+	Help: "The total number of alerts raised for hosts exceeding event quotas",
+}, []string{"pds", "quota"})
+
 var newUsersDiscovered = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "bgs_new_users_discovered",
 	Help: "The total number of new users discovered directly from the firehose (not from refs)",
@@ -144,3 +149,58 @@ func computeApproximateRequestSize(r *http.Request) int {
 	}
 	return s
 }
+
+var archivePrunedRepos = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "archive_pruned_repos",
+	Help: "The number of repos whose archived data was pruned in non-archival mode",
+})
+
+var handleChecks = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "handle_checks_total",
+	Help: "The number of handles re-verified, by result (valid, invalid or error)",
+}, []string{"result"})
+
+var handleCheckFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "handle_check_failures_total",
+	Help: "The number of handle re-verifications which failed, by reason",
+}, []string{"reason"})
+
+var handleChanges = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "handle_check_changes_total",
+	Help: "The number of handles (or handle validities) which changed on re-verification",
+})
+
+var eventsFilteredCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "events_filtered_counter",
+	Help: "The total number of inbound events dropped by the DID and host filters, by reason",
+}, []string{"pds", "reason"})
+
+var compactionsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "compactions_total",
+	Help: "The number of repo compactions, by result",
+}, []string{"result"})
+
+var compactionShardsDeleted = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "compaction_shards_deleted",
+	Help: "The number of shards deleted by compactions",
+})
+
+var compactionPassTargets = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "compaction_pass_targets",
+	Help: "The number of repos enqueued by the last compaction requeue",
+})
+
+var compactionPassCompleted = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "compaction_pass_completed",
+	Help: "The number of repos compacted since the last compaction requeue",
+})
+
+var compactionPaused = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "compaction_paused",
+	Help: "Whether compaction is paused because of the ingest rate",
+})
+
+var compactionIngestRate = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "compaction_ingest_rate",
+	Help: "The rate of inbound events measured by the compactor, in events per second",
+})
@@ -0,0 +1,112 @@
+package bgs
+
+import (
+	"context"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"go.opentelemetry.io/otel"
+)
+
+// ArchivePruner deletes repo data left in the carstore by a relay switched to non-archival mode, in the background, until there is none left.
+type ArchivePruner struct {
+	batchSize int
+	interval  time.Duration
+	exit      chan struct{}
+	exited    chan struct{}
+}
+
+type ArchivePrunerOptions struct {
+	// Number of repos pruned per batch
+	BatchSize int
+	// Pause between batches, to limit the load on the carstore
+	Interval time.Duration
+}
+
+func DefaultArchivePrunerOptions() *ArchivePrunerOptions {
+	return &ArchivePrunerOptions{
+		BatchSize: 100,
+		Interval:  time.Second,
+	}
+}
+
+func NewArchivePruner(opts *ArchivePrunerOptions) *ArchivePruner {
+	if opts == nil {
+		opts = DefaultArchivePrunerOptions()
+	}
+	return &ArchivePruner{
+		batchSize: opts.BatchSize,
+		interval:  opts.Interval,
+		exit:      make(chan struct{}),
+		exited:    make(chan struct{}),
+	}
+}
+
+// Start starts the pruner
+func (p *ArchivePruner) Start(bgs *BGS) {
+	log.Info("starting archive pruner")
+	go p.doWork(bgs)
+}
+
+// Shutdown shuts down the pruner
+func (p *ArchivePruner) Shutdown() {
+	log.Info("stopping archive pruner")
+	close(p.exit)
+	<-p.exited
+	log.Info("archive pruner stopped")
+}
+
+func (p *ArchivePruner) doWork(bgs *BGS) {
+	defer close(p.exited)
+
+	var after models.Uid
+	var pruned int
+	for {
+		select {
+		case <-p.exit:
+			return
+		default:
+		}
+
+		n, last, err := p.pruneBatch(context.Background(), bgs, after)
+		if err != nil {
+			log.Errorw("failed to prune archived repos", "err", err, "after", after)
+		}
+		if n == 0 && err == nil {
+			log.Infow("archive pruner done, no archived repos left", "pruned", pruned)
+			return
+		}
+		after = last
+		pruned += n
+
+		select {
+		case <-p.exit:
+			return
+		case <-time.After(p.interval):
+		}
+	}
+}
+
+// Prunes the next batch of repos with data in the carstore, returning how many were pruned and the last one.
+func (p *ArchivePruner) pruneBatch(ctx context.Context, bgs *BGS, after models.Uid) (int, models.Uid, error) {
+	ctx, span := otel.Tracer("pruner").Start(ctx, "pruneBatch")
+	defer span.End()
+
+	uids, err := bgs.repoman.CarStore().UsersWithShards(ctx, after, p.batchSize)
+	if err != nil {
+		return 0, after, err
+	}
+
+	var n int
+	for _, uid := range uids {
+		if err := bgs.repoman.PruneArchivedRepo(ctx, uid); err != nil {
+			// skip it, rather than retrying forever
+			log.Errorw("failed to prune archived repo", "err", err, "uid", uid)
+		} else {
+			archivePrunedRepos.Inc()
+		}
+		after = uid
+		n++
+	}
+	return n, after, nil
+}
@@ -0,0 +1,189 @@
+package bgs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util"
+)
+
+// HostQuotaOptions configures per-host alert thresholds, evaluated over fixed one-hour windows. A zero threshold disables that check.
+type HostQuotaOptions struct {
+	// Number of events received from a single host per hour
+	EventsPerHour int64
+	// Number of previously unknown repos discovered from a single host per hour
+	NewReposPerHour int64
+	// If set, alerts are POSTed to this URL as JSON (compatible with Slack incoming webhooks)
+	WebhookURL string
+	// If non-zero, the ingest rate limit (events per second) of a host is reduced to this value when it exceeds a quota. The reduced limit is not persisted, and can be reverted with the admin rate limit endpoint.
+	ThrottleLimit float64
+}
+
+func DefaultHostQuotaOptions() *HostQuotaOptions {
+	return &HostQuotaOptions{
+		EventsPerHour:   0,
+		NewReposPerHour: 0,
+		WebhookURL:      "",
+		ThrottleLimit:   0,
+	}
+}
+
+// HostQuotaAlert is the body of webhook notifications.
+type HostQuotaAlert struct {
+	// Human-readable summary; the field name is what Slack expects
+	Text      string `json:"text"`
+	Host      string `json:"host"`
+	Quota     string `json:"quota"`
+	Count     int64  `json:"count"`
+	Threshold int64  `json:"threshold"`
+	Throttled bool   `json:"throttled"`
+}
+
+type hostQuotaWindow struct {
+	start          time.Time
+	events         int64
+	newRepos       int64
+	alertedEvents  bool
+	alertedNewRepo bool
+}
+
+// HostQuotaTracker counts events and new repos per host, and raises alerts (and optionally throttles the host) when a quota is exceeded. Each quota alerts at most once per host per window.
+type HostQuotaTracker struct {
+	client *http.Client
+	// called to reduce the ingest rate limit of a host
+	throttle func(host *models.PDS, limit float64)
+
+	lk    sync.Mutex
+	opts  HostQuotaOptions
+	hosts map[uint]*hostQuotaWindow
+}
+
+const hostQuotaWindowDuration = time.Hour
+
+func NewHostQuotaTracker(opts *HostQuotaOptions, throttle func(host *models.PDS, limit float64)) *HostQuotaTracker {
+	if opts == nil {
+		opts = DefaultHostQuotaOptions()
+	}
+	return &HostQuotaTracker{
+		opts:     *opts,
+		client:   util.RobustHTTPClient(),
+		throttle: throttle,
+		hosts:    make(map[uint]*hostQuotaWindow),
+	}
+}
+
+// SetOptions replaces the quota configuration. Counts in the current windows are kept.
+func (qt *HostQuotaTracker) SetOptions(opts *HostQuotaOptions) {
+	qt.lk.Lock()
+	defer qt.lk.Unlock()
+	qt.opts = *opts
+}
+
+// must be called with the lock held
+func (qt *HostQuotaTracker) window(host *models.PDS, now time.Time) *hostQuotaWindow {
+	w, ok := qt.hosts[host.ID]
+	if !ok || now.Sub(w.start) >= hostQuotaWindowDuration {
+		w = &hostQuotaWindow{start: now}
+		qt.hosts[host.ID] = w
+	}
+	return w
+}
+
+// RecordEvent counts a single event received from the host.
+func (qt *HostQuotaTracker) RecordEvent(host *models.PDS) {
+	qt.lk.Lock()
+	opts := qt.opts
+	if opts.EventsPerHour <= 0 {
+		qt.lk.Unlock()
+		return
+	}
+	w := qt.window(host, time.Now())
+	w.events++
+	exceeded := !w.alertedEvents && w.events > opts.EventsPerHour
+	if exceeded {
+		w.alertedEvents = true
+	}
+	count := w.events
+	qt.lk.Unlock()
+
+	if exceeded {
+		qt.alert(&opts, host, "events-per-hour", count, opts.EventsPerHour)
+	}
+}
+
+// RecordNewRepo counts a previously unknown repo discovered from the host.
+func (qt *HostQuotaTracker) RecordNewRepo(host *models.PDS) {
+	qt.lk.Lock()
+	opts := qt.opts
+	if opts.NewReposPerHour <= 0 {
+		qt.lk.Unlock()
+		return
+	}
+	w := qt.window(host, time.Now())
+	w.newRepos++
+	exceeded := !w.alertedNewRepo && w.newRepos > opts.NewReposPerHour
+	if exceeded {
+		w.alertedNewRepo = true
+	}
+	count := w.newRepos
+	qt.lk.Unlock()
+
+	if exceeded {
+		qt.alert(&opts, host, "new-repos-per-hour", count, opts.NewReposPerHour)
+	}
+}
+
+func (qt *HostQuotaTracker) alert(opts *HostQuotaOptions, host *models.PDS, quota string, count, threshold int64) {
+	throttled := false
+	if opts.ThrottleLimit > 0 && qt.throttle != nil {
+		qt.throttle(host, opts.ThrottleLimit)
+		throttled = true
+	}
+
+	log.Warnw("host exceeded quota", "host", host.Host, "quota", quota, "count", count, "threshold", threshold, "throttled", throttled)
+	hostQuotaAlerts.WithLabelValues(host.Host, quota).Inc()
+
+	if opts.WebhookURL == "" {
+		return
+	}
+	msg := HostQuotaAlert{
+		Text:      fmt.Sprintf("⚠️ Relay host quota exceeded ⚠️\nhost: `%s`\nquota: %s (%d > %d)\nthrottled: %t", host.Host, quota, count, threshold, throttled),
+		Host:      host.Host,
+		Quota:     quota,
+		Count:     count,
+		Threshold: threshold,
+		Throttled: throttled,
+	}
+	go func() {
+		if err := qt.sendWebhook(context.Background(), opts.WebhookURL, &msg); err != nil {
+			log.Errorw("failed to send host quota webhook", "host", host.Host, "err", err)
+		}
+	}()
+}
+
+func (qt *HostQuotaTracker) sendWebhook(ctx context.Context, webhookURL string, msg *HostQuotaAlert) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := qt.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("webhook request failed: status=%d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package bgs
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Starts the current window of a host an hour ago, so the next count starts a new one.
+func expireQuotaWindow(qt *HostQuotaTracker, host *models.PDS) {
+	qt.lk.Lock()
+	defer qt.lk.Unlock()
+	qt.hosts[host.ID].start = time.Now().Add(-hostQuotaWindowDuration)
+}
+
+func TestHostQuotaAlertsOncePerWindow(t *testing.T) {
+	assert := assert.New(t)
+	host := &models.PDS{Host: "pds.example.com"}
+	host.ID = 1
+
+	var throttled []float64
+	qt := NewHostQuotaTracker(&HostQuotaOptions{EventsPerHour: 3, NewReposPerHour: 1}, func(h *models.PDS, limit float64) {
+		throttled = append(throttled, limit)
+	})
+
+	for i := 0; i < 3; i++ {
+		qt.RecordEvent(host)
+	}
+	assert.False(qt.hosts[host.ID].alertedEvents)
+	qt.RecordEvent(host)
+	assert.True(qt.hosts[host.ID].alertedEvents)
+	for i := 0; i < 10; i++ {
+		qt.RecordEvent(host)
+	}
+	assert.Equal(int64(14), qt.hosts[host.ID].events)
+
+	// quotas are tracked separately
+	assert.False(qt.hosts[host.ID].alertedNewRepo)
+	qt.RecordNewRepo(host)
+	qt.RecordNewRepo(host)
+	assert.True(qt.hosts[host.ID].alertedNewRepo)
+
+	// without a throttle limit, hosts are not throttled
+	assert.Empty(throttled)
+
+	// a new window starts from zero, and can alert again
+	expireQuotaWindow(qt, host)
+	qt.RecordEvent(host)
+	assert.Equal(int64(1), qt.hosts[host.ID].events)
+	assert.Zero(qt.hosts[host.ID].newRepos)
+	assert.False(qt.hosts[host.ID].alertedEvents)
+	assert.False(qt.hosts[host.ID].alertedNewRepo)
+	for i := 0; i < 3; i++ {
+		qt.RecordEvent(host)
+	}
+	assert.True(qt.hosts[host.ID].alertedEvents)
+
+	// hosts have separate windows
+	other := &models.PDS{Host: "other.example.com"}
+	other.ID = 2
+	qt.RecordEvent(other)
+	assert.Equal(int64(1), qt.hosts[other.ID].events)
+	assert.False(qt.hosts[other.ID].alertedEvents)
+}
+
+func TestHostQuotaDisabled(t *testing.T) {
+	assert := assert.New(t)
+	host := &models.PDS{Host: "pds.example.com"}
+	host.ID = 1
+
+	qt := NewHostQuotaTracker(nil, func(h *models.PDS, limit float64) {
+		t.Fatal("host should not be throttled")
+	})
+	for i := 0; i < 100; i++ {
+		qt.RecordEvent(host)
+		qt.RecordNewRepo(host)
+	}
+	assert.Empty(qt.hosts)
+}
+
+func TestHostQuotaThrottleAndWebhook(t *testing.T) {
+	assert := assert.New(t)
+	host := &models.PDS{Host: "pds.example.com"}
+	host.ID = 1
+
+	alerts := make(chan HostQuotaAlert, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("POST", r.Method)
+		assert.Equal("application/json", r.Header.Get("Content-Type"))
+		var msg HostQuotaAlert
+		assert.NoError(json.NewDecoder(r.Body).Decode(&msg))
+		alerts <- msg
+	}))
+	defer srv.Close()
+
+	var lk sync.Mutex
+	throttled := make(map[string]float64)
+	qt := NewHostQuotaTracker(&HostQuotaOptions{NewReposPerHour: 2, WebhookURL: srv.URL, ThrottleLimit: 5}, func(h *models.PDS, limit float64) {
+		lk.Lock()
+		defer lk.Unlock()
+		throttled[h.Host] = limit
+	})
+
+	for i := 0; i < 5; i++ {
+		qt.RecordNewRepo(host)
+	}
+	select {
+	case msg := <-alerts:
+		assert.Equal(HostQuotaAlert{
+			Text:      msg.Text,
+			Host:      "pds.example.com",
+			Quota:     "new-repos-per-hour",
+			Count:     3,
+			Threshold: 2,
+			Throttled: true,
+		}, msg)
+		assert.Contains(msg.Text, "`pds.example.com`")
+		assert.Contains(msg.Text, "new-repos-per-hour (3 > 2)")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook received")
+	}
+	lk.Lock()
+	assert.Equal(map[string]float64{"pds.example.com": 5}, throttled)
+	lk.Unlock()
+
+	// only once per window
+	select {
+	case msg := <-alerts:
+		t.Fatalf("unexpected second alert: %+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// options can be changed at runtime, keeping the counts
+	qt.SetOptions(&HostQuotaOptions{NewReposPerHour: 2, EventsPerHour: 1, WebhookURL: srv.URL})
+	assert.Equal(int64(5), qt.hosts[host.ID].newRepos)
+	qt.RecordEvent(host)
+	qt.RecordEvent(host)
+	select {
+	case msg := <-alerts:
+		assert.Equal("events-per-hour", msg.Quota)
+		assert.Equal(int64(2), msg.Count)
+		assert.False(msg.Throttled)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no webhook received")
+	}
+}
@@ -0,0 +1,759 @@
+package carstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"github.com/dgraph-io/badger/v4"
+	blockformat "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	ipld "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-libipfs/blocks"
+	car "github.com/ipld/go-car"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Key prefixes in the badger database, each followed by the big-endian uid of the user.
+const (
+	// the head of the repo: a badgerHead
+	badgerHeadPrefix = 'h'
+	// a block of the repo, followed by its cid
+	badgerBlockPrefix = 'b'
+	// a commit of the repo, followed by its big-endian seq: a badgerCommit
+	badgerCommitPrefix = 'c'
+	// the blocks superseded by a commit, followed by its big-endian seq: packed cids
+	badgerStalePrefix = 's'
+)
+
+// BadgerCarStore stores the blocks of user repos in an embedded badger database, keyed by user and cid, instead of CAR files and a SQL index. It keeps the commits of each repo (with the cids of the blocks they added) for incremental exports and compaction, which deletes the blocks superseded by later commits.
+type BadgerCarStore struct {
+	db *badger.DB
+
+	// serializes the commits and compactions of each user, striped by uid
+	userLks [64]sync.Mutex
+}
+
+var _ Store = (*BadgerCarStore)(nil)
+
+type badgerHead struct {
+	Root []byte
+	Rev  string
+	Seq  int
+	// Number of commits, and of stale block entries, since the last compaction
+	Commits int
+	Stale   int
+}
+
+type badgerCommit struct {
+	Root    []byte
+	Rev     string
+	Created time.Time
+	// The packed cids of the blocks added by the commit
+	Cids []byte
+}
+
+type BadgerOptions struct {
+	// Whether to sync every write to disk before returning
+	SyncWrites bool
+	// Size of the cache of decompressed table blocks, in bytes
+	BlockCacheSize int64
+}
+
+func DefaultBadgerOptions() *BadgerOptions {
+	return &BadgerOptions{
+		SyncWrites:     false,
+		BlockCacheSize: 256 << 20,
+	}
+}
+
+func NewBadgerCarStore(dir string, opts *BadgerOptions) (*BadgerCarStore, error) {
+	if opts == nil {
+		opts = DefaultBadgerOptions()
+	}
+
+	bopts := badger.DefaultOptions(dir).
+		WithSyncWrites(opts.SyncWrites).
+		WithBlockCacheSize(opts.BlockCacheSize).
+		WithLogger(badgerLogger{})
+	db, err := badger.Open(bopts)
+	if err != nil {
+		return nil, fmt.Errorf("opening badger database: %w", err)
+	}
+
+	return &BadgerCarStore{
+		db: db,
+	}, nil
+}
+
+// Close closes the badger database.
+func (cs *BadgerCarStore) Close() error {
+	return cs.db.Close()
+}
+
+// Routes the logs of badger to the carstore logger.
+type badgerLogger struct{}
+
+func (badgerLogger) Errorf(f string, args ...any)   { log.Errorf(f, args...) }
+func (badgerLogger) Warningf(f string, args ...any) { log.Warnf(f, args...) }
+func (badgerLogger) Infof(f string, args ...any)    { log.Debugf(f, args...) }
+func (badgerLogger) Debugf(f string, args ...any)   { log.Debugf(f, args...) }
+
+func (cs *BadgerCarStore) lockUser(user models.Uid) func() {
+	lk := &cs.userLks[uint64(user)%uint64(len(cs.userLks))]
+	lk.Lock()
+	return lk.Unlock
+}
+
+func badgerUserPrefix(prefix byte, user models.Uid) []byte {
+	k := make([]byte, 9)
+	k[0] = prefix
+	binary.BigEndian.PutUint64(k[1:], uint64(user))
+	return k
+}
+
+func badgerBlockKey(user models.Uid, c cid.Cid) []byte {
+	return append(badgerUserPrefix(badgerBlockPrefix, user), c.Bytes()...)
+}
+
+func badgerSeqKey(prefix byte, user models.Uid, seq int) []byte {
+	return binary.BigEndian.AppendUint64(badgerUserPrefix(prefix, user), uint64(seq))
+}
+
+func badgerKeySeq(k []byte) int {
+	return int(binary.BigEndian.Uint64(k[9:]))
+}
+
+func getJSON(txn *badger.Txn, k []byte, out any) (bool, error) {
+	it, err := txn.Get(k)
+	if err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := it.Value(func(v []byte) error {
+		return json.Unmarshal(v, out)
+	}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func setJSON(txn *badger.Txn, k []byte, v any) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return txn.Set(k, b)
+}
+
+// Returns the head of the repo of a user, with a zero Seq if the user has no data.
+func (cs *BadgerCarStore) getHead(user models.Uid) (*badgerHead, error) {
+	var head badgerHead
+	if err := cs.db.View(func(txn *badger.Txn) error {
+		_, err := getJSON(txn, badgerUserPrefix(badgerHeadPrefix, user), &head)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	return &head, nil
+}
+
+func (h *badgerHead) root() (cid.Cid, error) {
+	if len(h.Root) == 0 {
+		return cid.Undef, nil
+	}
+	return cid.Cast(h.Root)
+}
+
+type badgerCommitEntry struct {
+	Seq int
+	badgerCommit
+}
+
+// Returns the commits of a user, in seq order.
+func (cs *BadgerCarStore) getCommits(txn *badger.Txn, user models.Uid) ([]badgerCommitEntry, error) {
+	var out []badgerCommitEntry
+	prefix := badgerUserPrefix(badgerCommitPrefix, user)
+	it := txn.NewIterator(badger.IteratorOptions{Prefix: prefix, PrefetchValues: true, PrefetchSize: 100})
+	defer it.Close()
+	for it.Rewind(); it.Valid(); it.Next() {
+		e := badgerCommitEntry{Seq: badgerKeySeq(it.Item().Key())}
+		if err := it.Item().Value(func(v []byte) error {
+			return json.Unmarshal(v, &e.badgerCommit)
+		}); err != nil {
+			return nil, err
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+type badgerUserView struct {
+	cs   *BadgerCarStore
+	user models.Uid
+}
+
+var _ blockstore.Blockstore = (*badgerUserView)(nil)
+
+func (uv *badgerUserView) HashOnRead(hor bool) {
+	//noop
+}
+
+func (uv *badgerUserView) Has(ctx context.Context, k cid.Cid) (bool, error) {
+	var has bool
+	err := uv.cs.db.View(func(txn *badger.Txn) error {
+		_, err := txn.Get(badgerBlockKey(uv.user, k))
+		switch {
+		case err == nil:
+			has = true
+			return nil
+		case errors.Is(err, badger.ErrKeyNotFound):
+			return nil
+		default:
+			return err
+		}
+	})
+	return has, err
+}
+
+func (uv *badgerUserView) Get(ctx context.Context, k cid.Cid) (blockformat.Block, error) {
+	if !k.Defined() {
+		return nil, fmt.Errorf("attempted to 'get' undefined cid")
+	}
+
+	var data []byte
+	if err := uv.cs.db.View(func(txn *badger.Txn) error {
+		it, err := txn.Get(badgerBlockKey(uv.user, k))
+		if err != nil {
+			return err
+		}
+		data, err = it.ValueCopy(nil)
+		return err
+	}); err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return nil, ipld.ErrNotFound{Cid: k}
+		}
+		return nil, err
+	}
+
+	return blocks.NewBlockWithCid(data, k)
+}
+
+func (uv *badgerUserView) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func (uv *badgerUserView) Put(ctx context.Context, blk blockformat.Block) error {
+	return fmt.Errorf("puts not supported to car view blockstores")
+}
+
+func (uv *badgerUserView) PutMany(ctx context.Context, blks []blockformat.Block) error {
+	return fmt.Errorf("puts not supported to car view blockstores")
+}
+
+func (uv *badgerUserView) DeleteBlock(ctx context.Context, k cid.Cid) error {
+	return fmt.Errorf("deletes not supported to car view blockstore")
+}
+
+func (uv *badgerUserView) GetSize(ctx context.Context, k cid.Cid) (int, error) {
+	var size int
+	if err := uv.cs.db.View(func(txn *badger.Txn) error {
+		it, err := txn.Get(badgerBlockKey(uv.user, k))
+		if err != nil {
+			return err
+		}
+		size = int(it.ValueSize())
+		return nil
+	}); err != nil {
+		if errors.Is(err, badger.ErrKeyNotFound) {
+			return 0, ipld.ErrNotFound{Cid: k}
+		}
+		return 0, err
+	}
+	return size, nil
+}
+
+func (cs *BadgerCarStore) NewDeltaSession(ctx context.Context, user models.Uid, since *string) (*DeltaSession, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "NewSession")
+	defer span.End()
+
+	head, err := cs.getHead(user)
+	if err != nil {
+		return nil, err
+	}
+
+	if since != nil && *since != head.Rev {
+		return nil, fmt.Errorf("revision mismatch: %s != %s: %w", *since, head.Rev, ErrRepoBaseMismatch)
+	}
+
+	root, err := head.root()
+	if err != nil {
+		return nil, err
+	}
+
+	return &DeltaSession{
+		fresh: blockstore.NewBlockstore(datastore.NewMapDatastore()),
+		blks:  make(map[cid.Cid]blockformat.Block),
+		base: &badgerUserView{
+			user: user,
+			cs:   cs,
+		},
+		user:    user,
+		baseCid: root,
+		cs:      cs,
+		seq:     head.Seq + 1,
+		lastRev: head.Rev,
+	}, nil
+}
+
+func (cs *BadgerCarStore) ReadOnlySession(user models.Uid) (*DeltaSession, error) {
+	return &DeltaSession{
+		base: &badgerUserView{
+			user: user,
+			cs:   cs,
+		},
+		readonly: true,
+		user:     user,
+		cs:       cs,
+	}, nil
+}
+
+func (cs *BadgerCarStore) ReadUserCar(ctx context.Context, user models.Uid, sinceRev string, incremental bool, w io.Writer) error {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "ReadUserCar")
+	defer span.End()
+
+	head, err := cs.getHead(user)
+	if err != nil {
+		return err
+	}
+	if head.Seq == 0 {
+		return fmt.Errorf("no data found for user %d", user)
+	}
+	root, err := head.root()
+	if err != nil {
+		return err
+	}
+
+	if sinceRev != "" && !incremental {
+		// have to do it the ugly way
+		return fmt.Errorf("nyi")
+	}
+
+	return cs.db.View(func(txn *badger.Txn) error {
+		var commits []badgerCommitEntry
+		if sinceRev != "" {
+			all, err := cs.getCommits(txn, user)
+			if err != nil {
+				return err
+			}
+			for i, c := range all {
+				if c.Rev >= sinceRev {
+					commits = all[i:]
+					break
+				}
+			}
+			if len(commits) == 0 {
+				return fmt.Errorf("finding early shard: no commit since rev %s", sinceRev)
+			}
+		}
+
+		if err := car.WriteHeader(&car.CarHeader{
+			Roots:   []cid.Cid{root},
+			Version: 1,
+		}, w); err != nil {
+			return err
+		}
+
+		if sinceRev == "" {
+			// all the blocks of the repo, in key order
+			prefix := badgerUserPrefix(badgerBlockPrefix, user)
+			it := txn.NewIterator(badger.IteratorOptions{Prefix: prefix, PrefetchValues: true, PrefetchSize: 100})
+			defer it.Close()
+			for it.Rewind(); it.Valid(); it.Next() {
+				k := it.Item().Key()[len(prefix):]
+				if err := it.Item().Value(func(v []byte) error {
+					_, err := LdWrite(w, k, v)
+					return err
+				}); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+
+		// the blocks of the commits since the rev, newest first, like the shards of a CarStore
+		seen := make(map[cid.Cid]bool)
+		for i := len(commits) - 1; i >= 0; i-- {
+			cids, err := unpackCids(commits[i].Cids)
+			if err != nil {
+				return err
+			}
+			for _, c := range cids {
+				if seen[c] {
+					continue
+				}
+				seen[c] = true
+
+				it, err := txn.Get(badgerBlockKey(user, c))
+				if err != nil {
+					return fmt.Errorf("reading block %s of commit %d: %w", c, commits[i].Seq, err)
+				}
+				if err := it.Value(func(v []byte) error {
+					_, err := LdWrite(w, c.Bytes(), v)
+					return err
+				}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (cs *BadgerCarStore) ImportSlice(ctx context.Context, uid models.Uid, since *string, carslice []byte) (cid.Cid, *DeltaSession, error) {
+	return importSlice(ctx, cs, uid, since, carslice)
+}
+
+func (cs *BadgerCarStore) writeNewShard(ctx context.Context, root cid.Cid, rev string, user models.Uid, seq int, blks map[cid.Cid]blockformat.Block, rmcids map[cid.Cid]bool) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if _, err := WriteCarHeader(buf, root); err != nil {
+		return nil, fmt.Errorf("failed to write car header: %w", err)
+	}
+	for k, blk := range blks {
+		if _, err := LdWrite(buf, k.Bytes(), blk.RawData()); err != nil {
+			return nil, fmt.Errorf("failed to write block: %w", err)
+		}
+	}
+
+	if err := cs.putCommit(ctx, user, seq, root, rev, time.Now(), blks, rmcids); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Stores the blocks of a commit, then the commit itself, and makes it the head of the repo.
+func (cs *BadgerCarStore) putCommit(ctx context.Context, user models.Uid, seq int, root cid.Cid, rev string, created time.Time, blks map[cid.Cid]blockformat.Block, rmcids map[cid.Cid]bool) error {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "putCommit")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("blocks", len(blks)))
+
+	unlock := cs.lockUser(user)
+	defer unlock()
+
+	head, err := cs.getHead(user)
+	if err != nil {
+		return err
+	}
+	if seq <= head.Seq {
+		return fmt.Errorf("commit %d is not after the head (%d): %w", seq, head.Seq, ErrRepoBaseMismatch)
+	}
+
+	// the blocks can be too many for a single transaction, and are harmless until the head points to them
+	wb := cs.db.NewWriteBatch()
+	defer wb.Cancel()
+	cids := make([]cid.Cid, 0, len(blks))
+	for k, blk := range blks {
+		if err := wb.Set(badgerBlockKey(user, k), blk.RawData()); err != nil {
+			return fmt.Errorf("failed to write block: %w", err)
+		}
+		cids = append(cids, k)
+	}
+	if err := wb.Flush(); err != nil {
+		return fmt.Errorf("failed to write blocks: %w", err)
+	}
+
+	return cs.db.Update(func(txn *badger.Txn) error {
+		if err := setJSON(txn, badgerSeqKey(badgerCommitPrefix, user, seq), &badgerCommit{
+			Root:    root.Bytes(),
+			Rev:     rev,
+			Created: created,
+			Cids:    packCids(cids),
+		}); err != nil {
+			return fmt.Errorf("failed to write commit: %w", err)
+		}
+
+		if len(rmcids) > 0 {
+			if err := txn.Set(badgerSeqKey(badgerStalePrefix, user, seq), packCids(setToSlice(rmcids))); err != nil {
+				return fmt.Errorf("failed to write stale refs: %w", err)
+			}
+			head.Stale++
+		}
+
+		head.Root = root.Bytes()
+		head.Rev = rev
+		head.Seq = seq
+		head.Commits++
+		return setJSON(txn, badgerUserPrefix(badgerHeadPrefix, user), head)
+	})
+}
+
+func (cs *BadgerCarStore) GetUserRepoHead(ctx context.Context, user models.Uid) (cid.Cid, error) {
+	head, err := cs.getHead(user)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return head.root()
+}
+
+func (cs *BadgerCarStore) GetUserRepoRev(ctx context.Context, user models.Uid) (string, error) {
+	head, err := cs.getHead(user)
+	if err != nil {
+		return "", err
+	}
+	return head.Rev, nil
+}
+
+func (cs *BadgerCarStore) Stat(ctx context.Context, usr models.Uid) ([]UserStat, error) {
+	var out []UserStat
+	err := cs.db.View(func(txn *badger.Txn) error {
+		commits, err := cs.getCommits(txn, usr)
+		if err != nil {
+			return err
+		}
+		for _, c := range commits {
+			root, err := cid.Cast(c.Root)
+			if err != nil {
+				return err
+			}
+			out = append(out, UserStat{
+				Seq:     c.Seq,
+				Root:    root.String(),
+				Created: c.Created,
+			})
+		}
+		return nil
+	})
+	return out, err
+}
+
+func (cs *BadgerCarStore) WipeUserData(ctx context.Context, user models.Uid) error {
+	unlock := cs.lockUser(user)
+	defer unlock()
+
+	// the head goes first, for the repo to be empty even if the rest fails
+	for _, prefix := range []byte{badgerHeadPrefix, badgerCommitPrefix, badgerStalePrefix, badgerBlockPrefix} {
+		if err := cs.deletePrefix(badgerUserPrefix(prefix, user)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (cs *BadgerCarStore) deletePrefix(prefix []byte) error {
+	wb := cs.db.NewWriteBatch()
+	defer wb.Cancel()
+
+	if err := cs.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prefix})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			if err := wb.Delete(it.Item().KeyCopy(nil)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	return wb.Flush()
+}
+
+// UsersWithShards returns up to limit users which have data in the carstore, with uids greater than after, in order.
+func (cs *BadgerCarStore) UsersWithShards(ctx context.Context, after models.Uid, limit int) ([]models.Uid, error) {
+	var users []models.Uid
+	err := cs.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: []byte{badgerHeadPrefix}})
+		defer it.Close()
+		for it.Seek(badgerUserPrefix(badgerHeadPrefix, after+1)); it.Valid() && len(users) < limit; it.Next() {
+			users = append(users, models.Uid(binary.BigEndian.Uint64(it.Item().Key()[1:])))
+		}
+		return nil
+	})
+	return users, err
+}
+
+// GetCompactionTargets returns the repos with more than shardCount commits since their last compaction, the most fragmented first.
+func (cs *BadgerCarStore) GetCompactionTargets(ctx context.Context, shardCount int) ([]CompactionTarget, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "GetCompactionTargets")
+	defer span.End()
+
+	var targets []CompactionTarget
+	if err := cs.db.View(func(txn *badger.Txn) error {
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: []byte{badgerHeadPrefix}, PrefetchValues: true, PrefetchSize: 100})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			var head badgerHead
+			if err := it.Item().Value(func(v []byte) error {
+				return json.Unmarshal(v, &head)
+			}); err != nil {
+				return err
+			}
+			if head.Commits <= shardCount {
+				continue
+			}
+			targets = append(targets, CompactionTarget{
+				Usr:          models.Uid(binary.BigEndian.Uint64(it.Item().Key()[1:])),
+				NumShards:    head.Commits,
+				NumStaleRefs: head.Stale,
+				Score:        head.Commits + head.Stale,
+			})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(targets, func(i, j int) bool {
+		return targets[i].Score > targets[j].Score
+	})
+
+	return targets, nil
+}
+
+// CompactUserShards deletes the stale blocks of a repo, and merges all of its commits but the last one. Blocks which were added by more than one commit are kept, like in a CarStore, as they may have been added back after going stale. There are no big shard files to skip.
+func (cs *BadgerCarStore) CompactUserShards(ctx context.Context, user models.Uid, skipBigShards bool) (*CompactionStats, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "CompactUserShards")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int64("user", int64(user)))
+
+	unlock := cs.lockUser(user)
+	defer unlock()
+
+	var commits []badgerCommitEntry
+	stale := make(map[cid.Cid]bool)
+	var staleSeqs []int
+	if err := cs.db.View(func(txn *badger.Txn) error {
+		var err error
+		commits, err = cs.getCommits(txn, user)
+		if err != nil {
+			return err
+		}
+
+		prefix := badgerUserPrefix(badgerStalePrefix, user)
+		it := txn.NewIterator(badger.IteratorOptions{Prefix: prefix, PrefetchValues: true})
+		defer it.Close()
+		for it.Rewind(); it.Valid(); it.Next() {
+			staleSeqs = append(staleSeqs, badgerKeySeq(it.Item().Key()))
+			if err := it.Item().Value(func(v []byte) error {
+				cids, err := unpackCids(v)
+				if err != nil {
+					return err
+				}
+				for _, c := range cids {
+					stale[c] = true
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	stats := &CompactionStats{
+		StartShards: len(commits),
+	}
+	if len(commits) == 0 {
+		return stats, nil
+	}
+
+	// the cids added by each commit, without the deleted ones
+	commitCids := make([][]cid.Cid, len(commits))
+	seen := make(map[cid.Cid]bool)
+	for i, c := range commits {
+		cids, err := unpackCids(c.Cids)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unpack cids of commit %d: %w", c.Seq, err)
+		}
+		stats.TotalRefs += len(cids)
+		for _, c := range cids {
+			if seen[c] {
+				stats.DupeCount++
+				delete(stale, c)
+			}
+			seen[c] = true
+		}
+		commitCids[i] = cids
+	}
+
+	span.SetAttributes(attribute.Int("commits", len(commits)), attribute.Int("staleBlocks", len(stale)))
+
+	wb := cs.db.NewWriteBatch()
+	defer wb.Cancel()
+	for c := range stale {
+		if err := wb.Delete(badgerBlockKey(user, c)); err != nil {
+			return nil, err
+		}
+	}
+	if err := wb.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to delete stale blocks: %w", err)
+	}
+
+	// all the commits but the last are merged into the newest of them
+	var merged []cid.Cid
+	inMerged := make(map[cid.Cid]bool)
+	for _, cids := range commitCids[:len(commits)-1] {
+		for _, c := range cids {
+			if !stale[c] && !inMerged[c] {
+				inMerged[c] = true
+				merged = append(merged, c)
+			}
+		}
+	}
+
+	err := cs.db.Update(func(txn *badger.Txn) error {
+		for _, seq := range staleSeqs {
+			if err := txn.Delete(badgerSeqKey(badgerStalePrefix, user, seq)); err != nil {
+				return err
+			}
+		}
+
+		if len(commits) > 1 {
+			for _, c := range commits[:len(commits)-2] {
+				if err := txn.Delete(badgerSeqKey(badgerCommitPrefix, user, c.Seq)); err != nil {
+					return err
+				}
+			}
+			into := commits[len(commits)-2]
+			into.Cids = packCids(merged)
+			if err := setJSON(txn, badgerSeqKey(badgerCommitPrefix, user, into.Seq), &into.badgerCommit); err != nil {
+				return err
+			}
+			stats.NewShards = 1
+			stats.ShardsDeleted = len(commits) - 2
+		}
+
+		var head badgerHead
+		if _, err := getJSON(txn, badgerUserPrefix(badgerHeadPrefix, user), &head); err != nil {
+			return err
+		}
+		head.Commits = min(len(commits), 2)
+		head.Stale = 0
+		return setJSON(txn, badgerUserPrefix(badgerHeadPrefix, user), &head)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to update compacted commits: %w", err)
+	}
+
+	return stats, nil
+}
@@ -39,12 +39,37 @@ const MaxSliceLength = 2 << 20
 
 const BigShardThreshold = 2 << 20
 
+// Store stores the blocks of user repos, and the head of each repo.
+type Store interface {
+	NewDeltaSession(ctx context.Context, user models.Uid, since *string) (*DeltaSession, error)
+	ReadOnlySession(user models.Uid) (*DeltaSession, error)
+	ReadUserCar(ctx context.Context, user models.Uid, sinceRev string, incremental bool, w io.Writer) error
+	ImportSlice(ctx context.Context, uid models.Uid, since *string, carslice []byte) (cid.Cid, *DeltaSession, error)
+	GetUserRepoHead(ctx context.Context, user models.Uid) (cid.Cid, error)
+	GetUserRepoRev(ctx context.Context, user models.Uid) (string, error)
+	Stat(ctx context.Context, usr models.Uid) ([]UserStat, error)
+	WipeUserData(ctx context.Context, user models.Uid) error
+	UsersWithShards(ctx context.Context, after models.Uid, limit int) ([]models.Uid, error)
+	GetCompactionTargets(ctx context.Context, shardCount int) ([]CompactionTarget, error)
+	CompactUserShards(ctx context.Context, user models.Uid, skipBigShards bool) (*CompactionStats, error)
+}
+
+// The part of a Store which delta sessions write their new blocks to.
+type shardWriter interface {
+	writeNewShard(ctx context.Context, root cid.Cid, rev string, user models.Uid, seq int, blks map[cid.Cid]blockformat.Block, rmcids map[cid.Cid]bool) ([]byte, error)
+}
+
+var _ Store = (*CarStore)(nil)
+
+// CarStore stores the blocks of each commit as a CAR file on disk (a shard), with an index of the blocks in the database.
 type CarStore struct {
 	meta    *gorm.DB
 	rootDir string
 
 	lscLk          sync.Mutex
 	lastShardCache map[models.Uid]*CarShard
+
+	cold *ColdTier
 }
 
 func NewCarStore(meta *gorm.DB, root string) (*CarStore, error) {
@@ -86,6 +111,8 @@ type CarShard struct {
 	Path      string
 	Usr       models.Uid `gorm:"index:idx_car_shards_usr;index:idx_car_shards_usr_seq,priority:1"`
 	Rev       string
+	// Set once the shard was moved to the cold tier, Path being its key there
+	Cold bool
 }
 
 type blockRef struct {
@@ -188,11 +215,12 @@ func (uv *userView) Get(ctx context.Context, k cid.Cid) (blockformat.Block, erro
 	// directly? tradeoff of time vs space
 	var info struct {
 		Path   string
+		Cold   bool
 		Offset int64
 	}
 	if err := uv.cs.meta.
 		Model(blockRef{}).
-		Select("path, block_refs.offset").
+		Select("path, cold, block_refs.offset").
 		Joins("left join car_shards on block_refs.shard = car_shards.id").
 		Where("usr = ? AND cid = ?", uv.user, models.DbCID{k}).
 		Find(&info).Error; err != nil {
@@ -203,19 +231,19 @@ func (uv *userView) Get(ctx context.Context, k cid.Cid) (blockformat.Block, erro
 	}
 
 	if uv.prefetch {
-		return uv.prefetchRead(ctx, k, info.Path, info.Offset)
+		return uv.prefetchRead(ctx, k, info.Path, info.Cold, info.Offset)
 	} else {
-		return uv.singleRead(ctx, k, info.Path, info.Offset)
+		return uv.singleRead(ctx, k, info.Path, info.Cold, info.Offset)
 	}
 }
 
 const prefetchThreshold = 512 << 10
 
-func (uv *userView) prefetchRead(ctx context.Context, k cid.Cid, path string, offset int64) (blockformat.Block, error) {
+func (uv *userView) prefetchRead(ctx context.Context, k cid.Cid, path string, cold bool, offset int64) (blockformat.Block, error) {
 	ctx, span := otel.Tracer("carstore").Start(ctx, "getLastShard")
 	defer span.End()
 
-	fi, err := os.Open(path)
+	fi, err := uv.cs.openShard(ctx, path, cold)
 	if err != nil {
 		return nil, err
 	}
@@ -258,8 +286,8 @@ func (uv *userView) prefetchRead(ctx context.Context, k cid.Cid, path string, of
 	return outblk, nil
 }
 
-func (uv *userView) singleRead(ctx context.Context, k cid.Cid, path string, offset int64) (blockformat.Block, error) {
-	fi, err := os.Open(path)
+func (uv *userView) singleRead(ctx context.Context, k cid.Cid, path string, cold bool, offset int64) (blockformat.Block, error) {
+	fi, err := uv.cs.openShard(ctx, path, cold)
 	if err != nil {
 		return nil, err
 	}
@@ -326,7 +354,7 @@ type DeltaSession struct {
 	baseCid  cid.Cid
 	seq      int
 	readonly bool
-	cs       *CarStore
+	cs       shardWriter
 	lastRev  string
 }
 
@@ -475,7 +503,7 @@ func (cs *CarStore) writeShardBlocks(ctx context.Context, sh *CarShard, w io.Wri
 	ctx, span := otel.Tracer("carstore").Start(ctx, "writeShardBlocks")
 	defer span.End()
 
-	fi, err := os.Open(sh.Path)
+	fi, err := cs.openShard(ctx, sh.Path, sh.Cold)
 	if err != nil {
 		return err
 	}
@@ -495,7 +523,7 @@ func (cs *CarStore) writeShardBlocks(ctx context.Context, sh *CarShard, w io.Wri
 }
 
 func (cs *CarStore) writeBlockFromShard(ctx context.Context, sh *CarShard, w io.Writer, c cid.Cid) error {
-	fi, err := os.Open(sh.Path)
+	fi, err := cs.openShard(ctx, sh.Path, sh.Cold)
 	if err != nil {
 		return err
 	}
@@ -520,7 +548,7 @@ func (cs *CarStore) writeBlockFromShard(ctx context.Context, sh *CarShard, w io.
 }
 
 func (cs *CarStore) iterateShardBlocks(ctx context.Context, sh *CarShard, cb func(blk blockformat.Block) error) error {
-	fi, err := os.Open(sh.Path)
+	fi, err := cs.openShard(ctx, sh.Path, sh.Cold)
 	if err != nil {
 		return err
 	}
@@ -647,9 +675,26 @@ func (cs *CarStore) writeNewShardFile(ctx context.Context, user models.Uid, seq
 }
 
 func (cs *CarStore) deleteShardFile(ctx context.Context, sh *CarShard) error {
+	if sh.Cold {
+		if cs.cold == nil {
+			return fmt.Errorf("shard %d is in the cold tier, which isn't configured", sh.ID)
+		}
+		return cs.cold.remove(ctx, sh.Path)
+	}
 	return os.Remove(sh.Path)
 }
 
+// Opens a shard file, from the cold tier if the shard was moved there.
+func (cs *CarStore) openShard(ctx context.Context, path string, cold bool) (*os.File, error) {
+	if !cold {
+		return os.Open(path)
+	}
+	if cs.cold == nil {
+		return nil, fmt.Errorf("shard %q is in the cold tier, which isn't configured", path)
+	}
+	return cs.cold.open(ctx, path)
+}
+
 // CloseWithRoot writes all new blocks in a car file to the writer with the
 // given cid as the 'root'
 func (ds *DeltaSession) CloseWithRoot(ctx context.Context, root cid.Cid, rev string) ([]byte, error) {
@@ -926,6 +971,11 @@ func BlockDiff(ctx context.Context, bs blockstore.Blockstore, oldroot cid.Cid, n
 }
 
 func (cs *CarStore) ImportSlice(ctx context.Context, uid models.Uid, since *string, carslice []byte) (cid.Cid, *DeltaSession, error) {
+	return importSlice(ctx, cs, uid, since, carslice)
+}
+
+// Reads the blocks of a CAR slice into a new delta session on top of the repo of the user.
+func importSlice(ctx context.Context, cs Store, uid models.Uid, since *string, carslice []byte) (cid.Cid, *DeltaSession, error) {
 	ctx, span := otel.Tracer("carstore").Start(ctx, "ImportSlice")
 	defer span.End()
 
@@ -1033,11 +1083,25 @@ func (cs *CarStore) WipeUserData(ctx context.Context, user models.Uid) error {
 		}
 	}
 
+	// the stale blocks were all in the deleted shards
+	if err := cs.meta.Delete(&staleRef{}, "usr = ?", user).Error; err != nil {
+		return err
+	}
+
 	cs.removeLastShardCache(user)
 
 	return nil
 }
 
+// UsersWithShards returns up to limit users which have data in the carstore, with uids greater than after, in order.
+func (cs *CarStore) UsersWithShards(ctx context.Context, after models.Uid, limit int) ([]models.Uid, error) {
+	var users []models.Uid
+	if err := cs.meta.WithContext(ctx).Model(&CarShard{}).Distinct("usr").Where("usr > ?", after).Order("usr asc").Limit(limit).Pluck("usr", &users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
 func (cs *CarStore) deleteShards(ctx context.Context, shs []*CarShard) error {
 	ctx, span := otel.Tracer("carstore").Start(ctx, "deleteShards")
 	defer span.End()
@@ -1175,7 +1239,7 @@ func (cb *compBucket) isEmpty() bool {
 }
 
 func (cs *CarStore) copyShardBlocksFiltered(ctx context.Context, sh *CarShard, w io.Writer, keep map[cid.Cid]bool) error {
-	fi, err := os.Open(sh.Path)
+	fi, err := cs.openShard(ctx, sh.Path, sh.Cold)
 	if err != nil {
 		return err
 	}
@@ -1212,17 +1276,29 @@ func (cs *CarStore) openNewCompactedShardFile(ctx context.Context, user models.U
 type CompactionTarget struct {
 	Usr       models.Uid
 	NumShards int
+	// Number of stale ref entries (blocks superseded by later commits, to be deleted by compaction)
+	NumStaleRefs int
+	// Fragmentation score of the repo: its shards, which compaction merges, plus its stale ref entries, which compaction deletes
+	Score int
 }
 
+// GetCompactionTargets returns the repos with more than shardCount shards, the most fragmented first.
 func (cs *CarStore) GetCompactionTargets(ctx context.Context, shardCount int) ([]CompactionTarget, error) {
 	ctx, span := otel.Tracer("carstore").Start(ctx, "GetCompactionTargets")
 	defer span.End()
 
 	var targets []CompactionTarget
-	if err := cs.meta.Raw(`select usr, count(*) as num_shards from car_shards group by usr having count(*) > ? order by num_shards desc`, shardCount).Scan(&targets).Error; err != nil {
+	if err := cs.meta.Raw(`select usr, count(*) as num_shards, (select count(*) from stale_refs where stale_refs.usr = car_shards.usr) as num_stale_refs from car_shards group by usr having count(*) > ?`, shardCount).Scan(&targets).Error; err != nil {
 		return nil, err
 	}
 
+	for i := range targets {
+		targets[i].Score = targets[i].NumShards + targets[i].NumStaleRefs
+	}
+	sort.SliceStable(targets, func(i, j int) bool {
+		return targets[i].Score > targets[j].Score
+	})
+
 	return targets, nil
 }
 
@@ -1254,6 +1330,11 @@ func (cs *CarStore) getBlockRefsForShards(ctx context.Context, shardIds []uint)
 }
 
 func shardSize(sh *CarShard) (int64, error) {
+	if sh.Cold {
+		// not worth fetching to find out; cold shards are old, and left alone like big ones
+		return BigShardThreshold + 1, nil
+	}
+
 	st, err := os.Stat(sh.Path)
 	if err != nil {
 		return 0, fmt.Errorf("stat %q: %w", sh.Path, err)
@@ -0,0 +1,373 @@
+package carstore
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/sync/singleflight"
+)
+
+// ObjectStore stores the shards of the cold tier, by key.
+type ObjectStore interface {
+	PutObject(ctx context.Context, key string, data []byte) error
+	// GetObject returns ErrObjectNotFound if there's no object with the key.
+	GetObject(ctx context.Context, key string) ([]byte, error)
+	DeleteObject(ctx context.Context, key string) error
+}
+
+var ErrObjectNotFound = errors.New("object not found")
+
+// S3ObjectStore is an ObjectStore on S3, or on any S3-compatible object storage.
+type S3ObjectStore struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+type S3Options struct {
+	// Host (and port) of the S3 API, like "s3.amazonaws.com"
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// Prepended to the keys of all objects, like "shards/"
+	Prefix string
+	// Use plain HTTP instead of HTTPS
+	Insecure bool
+}
+
+func NewS3ObjectStore(opts *S3Options) (*S3ObjectStore, error) {
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: !opts.Insecure,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating s3 client: %w", err)
+	}
+
+	return &S3ObjectStore{
+		client: client,
+		bucket: opts.Bucket,
+		prefix: opts.Prefix,
+	}, nil
+}
+
+func (s *S3ObjectStore) PutObject(ctx context.Context, key string, data []byte) error {
+	_, err := s.client.PutObject(ctx, s.bucket, s.prefix+key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: "application/vnd.ipld.car",
+	})
+	return err
+}
+
+func (s *S3ObjectStore) GetObject(ctx context.Context, key string) ([]byte, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, s.prefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, fmt.Errorf("%s: %w", key, ErrObjectNotFound)
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *S3ObjectStore) DeleteObject(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, s.prefix+key, minio.RemoveObjectOptions{})
+}
+
+// ColdTier keeps the older shards of a CarStore in an ObjectStore, and fetches them back on read into a local cache, which keeps the most recently read shards up to a total size.
+type ColdTier struct {
+	objects   ObjectStore
+	cacheDir  string
+	cacheSize int64
+
+	fetches singleflight.Group
+
+	lk     sync.Mutex
+	lru    *list.List // of *cachedShard, the most recently read first
+	cached map[string]*list.Element
+	used   int64
+}
+
+type cachedShard struct {
+	key  string
+	size int64
+}
+
+type ColdTierOptions struct {
+	// Directory of the local cache of shards fetched from the object store
+	CacheDir string
+	// Total size of the cached shards, in bytes
+	CacheSize int64
+}
+
+func DefaultColdTierOptions() *ColdTierOptions {
+	return &ColdTierOptions{
+		CacheSize: 10 << 30,
+	}
+}
+
+func NewColdTier(objects ObjectStore, opts *ColdTierOptions) (*ColdTier, error) {
+	if opts == nil {
+		opts = DefaultColdTierOptions()
+	}
+	if opts.CacheDir == "" {
+		return nil, fmt.Errorf("cold tier requires a cache directory")
+	}
+	if err := os.MkdirAll(opts.CacheDir, 0775); err != nil {
+		return nil, err
+	}
+
+	ct := &ColdTier{
+		objects:   objects,
+		cacheDir:  opts.CacheDir,
+		cacheSize: opts.CacheSize,
+		lru:       list.New(),
+		cached:    make(map[string]*list.Element),
+	}
+
+	// keep what was cached before a restart, the most recently modified first
+	ents, err := os.ReadDir(opts.CacheDir)
+	if err != nil {
+		return nil, err
+	}
+	type cacheFile struct {
+		name  string
+		size  int64
+		mtime time.Time
+	}
+	var files []cacheFile
+	for _, ent := range ents {
+		if ent.IsDir() {
+			continue
+		}
+		if filepath.Ext(ent.Name()) == ".tmp" {
+			// an interrupted fetch
+			_ = os.Remove(filepath.Join(opts.CacheDir, ent.Name()))
+			continue
+		}
+		info, err := ent.Info()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, cacheFile{name: ent.Name(), size: info.Size(), mtime: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].mtime.After(files[j].mtime)
+	})
+	for _, f := range files {
+		ct.cached[f.name] = ct.lru.PushBack(&cachedShard{key: f.name, size: f.size})
+		ct.used += f.size
+	}
+	ct.lk.Lock()
+	ct.evictLocked()
+	ct.lk.Unlock()
+
+	return ct, nil
+}
+
+func (ct *ColdTier) cachePath(key string) string {
+	return filepath.Join(ct.cacheDir, key)
+}
+
+// Opens a shard from the cache, fetching it from the object store first if needed.
+func (ct *ColdTier) open(ctx context.Context, key string) (*os.File, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "coldTierOpen")
+	defer span.End()
+
+	ct.lk.Lock()
+	el, ok := ct.cached[key]
+	if ok {
+		ct.lru.MoveToFront(el)
+	}
+	ct.lk.Unlock()
+
+	span.SetAttributes(attribute.Bool("cached", ok))
+	if ok {
+		coldShardReads.WithLabelValues("cache").Inc()
+		fi, err := os.Open(ct.cachePath(key))
+		if err == nil || !os.IsNotExist(err) {
+			return fi, err
+		}
+		// evicted since
+	}
+
+	coldShardReads.WithLabelValues("fetch").Inc()
+	if _, err, _ := ct.fetches.Do(key, func() (any, error) {
+		return nil, ct.fetch(ctx, key)
+	}); err != nil {
+		return nil, err
+	}
+
+	// may in theory be evicted again already, by a lot of concurrent fetches
+	return os.Open(ct.cachePath(key))
+}
+
+func (ct *ColdTier) fetch(ctx context.Context, key string) error {
+	start := time.Now()
+	data, err := ct.objects.GetObject(ctx, key)
+	if err != nil {
+		return fmt.Errorf("fetching shard %q from cold tier: %w", key, err)
+	}
+	coldShardFetchDuration.Observe(time.Since(start).Seconds())
+	coldShardFetchedBytes.Add(float64(len(data)))
+
+	return ct.addToCache(key, data)
+}
+
+// Writes a shard to the cache, atomically, evicting the least recently read ones if needed.
+func (ct *ColdTier) addToCache(key string, data []byte) error {
+	tmp := ct.cachePath(key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0664); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, ct.cachePath(key)); err != nil {
+		return err
+	}
+
+	ct.lk.Lock()
+	defer ct.lk.Unlock()
+
+	if el, ok := ct.cached[key]; ok {
+		cs := el.Value.(*cachedShard)
+		ct.used += int64(len(data)) - cs.size
+		cs.size = int64(len(data))
+		ct.lru.MoveToFront(el)
+	} else {
+		ct.cached[key] = ct.lru.PushFront(&cachedShard{key: key, size: int64(len(data))})
+		ct.used += int64(len(data))
+	}
+	ct.evictLocked()
+	return nil
+}
+
+// Deletes the least recently read shards until the cache fits, but always keeps the most recent one.
+func (ct *ColdTier) evictLocked() {
+	for ct.used > ct.cacheSize && ct.lru.Len() > 1 {
+		el := ct.lru.Back()
+		cs := el.Value.(*cachedShard)
+		ct.lru.Remove(el)
+		delete(ct.cached, cs.key)
+		ct.used -= cs.size
+
+		// shards being read stay readable until they're closed
+		if err := os.Remove(ct.cachePath(cs.key)); err != nil && !os.IsNotExist(err) {
+			log.Warnw("failed to evict cold shard from cache", "key", cs.key, "err", err)
+		}
+	}
+	coldCacheBytes.Set(float64(ct.used))
+}
+
+func (ct *ColdTier) put(ctx context.Context, key string, data []byte) error {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "coldTierPut")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int("size", len(data)))
+
+	return ct.objects.PutObject(ctx, key, data)
+}
+
+// Deletes a shard from the object store, and from the cache.
+func (ct *ColdTier) remove(ctx context.Context, key string) error {
+	if err := ct.objects.DeleteObject(ctx, key); err != nil {
+		return fmt.Errorf("deleting shard %q from cold tier: %w", key, err)
+	}
+
+	ct.lk.Lock()
+	defer ct.lk.Unlock()
+
+	if el, ok := ct.cached[key]; ok {
+		ct.lru.Remove(el)
+		delete(ct.cached, key)
+		ct.used -= el.Value.(*cachedShard).size
+		coldCacheBytes.Set(float64(ct.used))
+		if err := os.Remove(ct.cachePath(key)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetColdTier sets the cold tier that older shards can be moved to, with MoveShardsToColdTier.
+func (cs *CarStore) SetColdTier(ct *ColdTier) {
+	cs.cold = ct
+}
+
+// MoveShardsToColdTier moves up to limit shards created before a time to the cold tier, oldest first, and returns how many were moved. The last shard of each repo always stays local, as it's read by every new commit.
+func (cs *CarStore) MoveShardsToColdTier(ctx context.Context, before time.Time, limit int) (int, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "MoveShardsToColdTier")
+	defer span.End()
+
+	if cs.cold == nil {
+		return 0, fmt.Errorf("no cold tier configured")
+	}
+
+	var shards []CarShard
+	if err := cs.meta.WithContext(ctx).
+		Where("cold = false AND created_at < ? AND seq < (select max(seq) from car_shards newer where newer.usr = car_shards.usr)", before).
+		Order("id asc").
+		Limit(limit).
+		Find(&shards).Error; err != nil {
+		return 0, err
+	}
+
+	span.SetAttributes(attribute.Int("shards", len(shards)))
+
+	var moved int
+	for _, sh := range shards {
+		data, err := os.ReadFile(sh.Path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// deleted by a compaction since
+				continue
+			}
+			return moved, err
+		}
+
+		key := filepath.Base(sh.Path)
+		if err := cs.cold.put(ctx, key, data); err != nil {
+			return moved, fmt.Errorf("uploading shard %d: %w", sh.ID, err)
+		}
+
+		res := cs.meta.WithContext(ctx).Model(&CarShard{}).Where("id = ? AND cold = false", sh.ID).Updates(map[string]any{"cold": true, "path": key})
+		if res.Error != nil {
+			return moved, res.Error
+		}
+		if res.RowsAffected == 0 {
+			// deleted by a compaction in the meantime
+			if err := cs.cold.objects.DeleteObject(ctx, key); err != nil {
+				log.Warnw("failed to delete orphaned cold shard", "key", key, "err", err)
+			}
+			continue
+		}
+
+		if err := os.Remove(sh.Path); err != nil && !os.IsNotExist(err) {
+			log.Warnw("failed to delete shard moved to cold tier", "path", sh.Path, "err", err)
+		}
+		moved++
+		coldShardsMoved.Inc()
+		coldBytesMoved.Add(float64(len(data)))
+	}
+
+	return moved, nil
+}
@@ -0,0 +1,33 @@
+package carstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/repo"
+)
+
+// ExportCollections streams a CAR file of the head of a repo with only the records in the given collections, and the MST nodes proving that they are all of them. See repo.Repo.ExportCollections.
+func ExportCollections(ctx context.Context, cs Store, user models.Uid, collections []string, w io.Writer) error {
+	head, err := cs.GetUserRepoHead(ctx, user)
+	if err != nil {
+		return err
+	}
+	if !head.Defined() {
+		return fmt.Errorf("no data found for user %d", user)
+	}
+
+	ds, err := cs.ReadOnlySession(user)
+	if err != nil {
+		return err
+	}
+
+	r, err := repo.OpenRepo(ctx, ds, head)
+	if err != nil {
+		return fmt.Errorf("opening repo of user %d: %w", user, err)
+	}
+
+	return r.ExportCollections(ctx, collections, w)
+}
@@ -0,0 +1,37 @@
+package carstore
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var coldShardReads = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "carstore_cold_shard_reads_total",
+	Help: "Number of cold tier shards opened, by whether they were in the local cache or fetched",
+}, []string{"source"})
+
+var coldShardFetchDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "carstore_cold_shard_fetch_duration_seconds",
+	Help:    "Time to fetch a shard from the cold tier object store",
+	Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+})
+
+var coldShardFetchedBytes = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "carstore_cold_shard_fetched_bytes_total",
+	Help: "Total size of the shards fetched from the cold tier object store",
+})
+
+var coldCacheBytes = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "carstore_cold_cache_bytes",
+	Help: "Total size of the cold tier shards in the local cache",
+})
+
+var coldShardsMoved = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "carstore_cold_shards_moved_total",
+	Help: "Number of shards moved to the cold tier",
+})
+
+var coldBytesMoved = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "carstore_cold_bytes_moved_total",
+	Help: "Total size of the shards moved to the cold tier",
+})
@@ -0,0 +1,67 @@
+package carstore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/models"
+
+	blockformat "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// CopyUserToBadger copies the repo of a user from a CarStore to a BadgerCarStore, replacing its data there, and returns the number of blocks copied. Each shard becomes a commit with the same seq, and the stale refs of the user are attached to the last one, for compaction to delete them.
+func CopyUserToBadger(ctx context.Context, from *CarStore, to *BadgerCarStore, user models.Uid) (int, error) {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "CopyUserToBadger")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int64("user", int64(user)))
+
+	var shards []CarShard
+	if err := from.meta.WithContext(ctx).Order("seq asc").Find(&shards, "usr = ?", user).Error; err != nil {
+		return 0, err
+	}
+
+	var staleRefs []staleRef
+	if err := from.meta.WithContext(ctx).Find(&staleRefs, "usr = ?", user).Error; err != nil {
+		return 0, err
+	}
+	stale := make(map[cid.Cid]bool)
+	for _, sr := range staleRefs {
+		cids, err := sr.getCids()
+		if err != nil {
+			return 0, fmt.Errorf("failed to unpack cids from staleRefs record (%d): %w", sr.ID, err)
+		}
+		for _, c := range cids {
+			stale[c] = true
+		}
+	}
+
+	if err := to.WipeUserData(ctx, user); err != nil {
+		return 0, fmt.Errorf("wiping previous copy: %w", err)
+	}
+
+	var copied int
+	for i, sh := range shards {
+		blks := make(map[cid.Cid]blockformat.Block)
+		if err := from.iterateShardBlocks(ctx, &sh, func(blk blockformat.Block) error {
+			blks[blk.Cid()] = blk
+			return nil
+		}); err != nil {
+			return copied, fmt.Errorf("reading shard %d: %w", sh.ID, err)
+		}
+
+		var rmcids map[cid.Cid]bool
+		if i == len(shards)-1 {
+			rmcids = stale
+		}
+		if err := to.putCommit(ctx, user, sh.Seq, sh.Root.CID, sh.Rev, sh.CreatedAt, blks, rmcids); err != nil {
+			return copied, fmt.Errorf("writing shard %d: %w", sh.ID, err)
+		}
+		copied += len(blks)
+	}
+
+	return copied, nil
+}
@@ -0,0 +1,90 @@
+package carstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/models"
+
+	"github.com/ipfs/go-cid"
+	"go.opentelemetry.io/otel"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NonArchivalCarstore only keeps the head commit (CID and rev) of each repo, instead of their blocks. It's enough for a relay to check that commits follow each other and to re-emit them, but not to serve repos or records.
+type NonArchivalCarstore struct {
+	meta *gorm.DB
+}
+
+type commitRefInfo struct {
+	ID   uint       `gorm:"primarykey"`
+	Uid  models.Uid `gorm:"uniqueIndex"`
+	Head models.DbCID
+	Rev  string
+}
+
+func NewNonArchivalCarstore(meta *gorm.DB) (*NonArchivalCarstore, error) {
+	if err := meta.AutoMigrate(&commitRefInfo{}); err != nil {
+		return nil, err
+	}
+
+	return &NonArchivalCarstore{
+		meta: meta,
+	}, nil
+}
+
+func (cs *NonArchivalCarstore) getCommitRef(ctx context.Context, user models.Uid) (*commitRefInfo, error) {
+	var ref commitRefInfo
+	if err := cs.meta.WithContext(ctx).Where("uid = ?", user).Take(&ref).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &ref, nil
+}
+
+// GetUserRepoHead returns the CID of the head commit of a repo, or cid.Undef if it isn't known.
+func (cs *NonArchivalCarstore) GetUserRepoHead(ctx context.Context, user models.Uid) (cid.Cid, error) {
+	ref, err := cs.getCommitRef(ctx, user)
+	if err != nil || ref == nil {
+		return cid.Undef, err
+	}
+	return ref.Head.CID, nil
+}
+
+// GetUserRepoRev returns the rev of the head commit of a repo, or an empty string if it isn't known.
+func (cs *NonArchivalCarstore) GetUserRepoRev(ctx context.Context, user models.Uid) (string, error) {
+	ref, err := cs.getCommitRef(ctx, user)
+	if err != nil || ref == nil {
+		return "", err
+	}
+	return ref.Rev, nil
+}
+
+// UpdateUserRepoHead records a new head commit for a repo.
+func (cs *NonArchivalCarstore) UpdateUserRepoHead(ctx context.Context, user models.Uid, head cid.Cid, rev string) error {
+	ctx, span := otel.Tracer("carstore").Start(ctx, "UpdateUserRepoHead")
+	defer span.End()
+
+	ref := commitRefInfo{
+		Uid:  user,
+		Head: models.DbCID{CID: head},
+		Rev:  rev,
+	}
+	err := cs.meta.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "uid"}},
+		DoUpdates: clause.AssignmentColumns([]string{"head", "rev"}),
+	}).Create(&ref).Error
+	if err != nil {
+		return fmt.Errorf("updating repo head: %w", err)
+	}
+	return nil
+}
+
+// WipeUserData forgets the head commit of a repo, so that the next commit is accepted as if the repo was new.
+func (cs *NonArchivalCarstore) WipeUserData(ctx context.Context, user models.Uid) error {
+	return cs.meta.WithContext(ctx).Where("uid = ?", user).Delete(&commitRefInfo{}).Error
+}
@@ -8,6 +8,8 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -54,6 +56,15 @@ func testCarStore() (*CarStore, func(), error) {
 	}, nil
 }
 
+func testBadgerCarStore(tb testing.TB) *BadgerCarStore {
+	cs, err := NewBadgerCarStore(tb.TempDir(), nil)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = cs.Close() })
+	return cs
+}
+
 func testFlatfsBs() (blockstore.Blockstore, func(), error) {
 	tempdir, err := os.MkdirTemp("", "msttest-")
 	if err != nil {
@@ -73,14 +84,22 @@ func testFlatfsBs() (blockstore.Blockstore, func(), error) {
 }
 
 func TestBasicOperation(t *testing.T) {
-	ctx := context.TODO()
-
 	cs, cleanup, err := testCarStore()
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer cleanup()
 
+	testBasicOperation(t, cs)
+}
+
+func TestBasicOperationBadger(t *testing.T) {
+	testBasicOperation(t, testBadgerCarStore(t))
+}
+
+func testBasicOperation(t *testing.T, cs Store) {
+	ctx := context.TODO()
+
 	ds, err := cs.NewDeltaSession(ctx, 1, nil)
 	if err != nil {
 		t.Fatal(err)
@@ -154,14 +173,22 @@ func TestBasicOperation(t *testing.T) {
 }
 
 func TestRepeatedCompactions(t *testing.T) {
-	ctx := context.TODO()
-
 	cs, cleanup, err := testCarStore()
 	if err != nil {
 		t.Fatal(err)
 	}
 	defer cleanup()
 
+	testRepeatedCompactions(t, cs)
+}
+
+func TestRepeatedCompactionsBadger(t *testing.T) {
+	testRepeatedCompactions(t, testBadgerCarStore(t))
+}
+
+func testRepeatedCompactions(t *testing.T, cs Store) {
+	ctx := context.TODO()
+
 	ds, err := cs.NewDeltaSession(ctx, 1, nil)
 	if err != nil {
 		t.Fatal(err)
@@ -227,6 +254,19 @@ func TestRepeatedCompactions(t *testing.T) {
 
 			head = nroot
 		}
+		if loop == 0 {
+			targets, err := cs.GetCompactionTargets(ctx, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(targets) != 1 || targets[0].Usr != 1 || targets[0].NumShards != 21 {
+				t.Fatalf("unexpected compaction targets: %+v", targets)
+			}
+			if targets[0].NumStaleRefs == 0 || targets[0].Score != targets[0].NumShards+targets[0].NumStaleRefs {
+				t.Fatalf("unexpected fragmentation score: %+v", targets[0])
+			}
+		}
+
 		fmt.Println("Run compaction", loop)
 		st, err := cs.CompactUserShards(ctx, 1, false)
 		if err != nil {
@@ -249,7 +289,7 @@ func TestRepeatedCompactions(t *testing.T) {
 	checkRepo(t, cs, buf, recs)
 }
 
-func checkRepo(t *testing.T, cs *CarStore, r io.Reader, expRecs []cid.Cid) {
+func checkRepo(t *testing.T, cs Store, r io.Reader, expRecs []cid.Cid) {
 	t.Helper()
 	rep, err := repo.ReadRepoFromCar(context.TODO(), r)
 	if err != nil {
@@ -307,15 +347,290 @@ func setupRepo(ctx context.Context, bs blockstore.Blockstore) (cid.Cid, string,
 	return ncid, rev, nil
 }
 
-func BenchmarkRepoWritesCarstore(b *testing.B) {
+func TestCopyUserToBadger(t *testing.T) {
+	ctx := context.TODO()
+
+	fcs, cleanup, err := testCarStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	head, rev, recs := writeTestRecords(t, fcs, 30)
+
+	if _, err := fcs.CompactUserShards(ctx, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	head, rev, recs = appendTestRecords(t, fcs, head, rev, recs, 10)
+
+	bcs := testBadgerCarStore(t)
+	n, err := CopyUserToBadger(ctx, fcs, bcs, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Fatal("no blocks copied")
+	}
+
+	bhead, err := bcs.GetUserRepoHead(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	brev, err := bcs.GetUserRepoRev(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bhead != head || brev != rev {
+		t.Fatalf("copied head (%s, %s) does not match (%s, %s)", bhead, brev, head, rev)
+	}
+
+	fstat, err := fcs.Stat(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bstat, err := bcs.Stat(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bstat) != len(fstat) {
+		t.Fatalf("copied %d commits, expected %d", len(bstat), len(fstat))
+	}
+
+	buf := new(bytes.Buffer)
+	if err := bcs.ReadUserCar(ctx, 1, "", true, buf); err != nil {
+		t.Fatal(err)
+	}
+	checkRepo(t, bcs, buf, recs)
+
+	// the copy keeps working as the repo grows, and is compacted
+	head, rev, recs = appendTestRecords(t, bcs, head, rev, recs, 10)
+	if _, err := bcs.CompactUserShards(ctx, 1, false); err != nil {
+		t.Fatal(err)
+	}
+
+	buf = new(bytes.Buffer)
+	if err := bcs.ReadUserCar(ctx, 1, "", true, buf); err != nil {
+		t.Fatal(err)
+	}
+	checkRepo(t, bcs, buf, recs)
+
+	users, err := bcs.UsersWithShards(ctx, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0] != 1 {
+		t.Fatalf("unexpected users with shards: %v", users)
+	}
+
+	if err := bcs.WipeUserData(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if h, err := bcs.GetUserRepoHead(ctx, 1); err != nil || h.Defined() {
+		t.Fatalf("expected no head after wipe: %s %v", h, err)
+	}
+}
+
+type memObjectStore struct {
+	lk      sync.Mutex
+	objects map[string][]byte
+	gets    int
+}
+
+func (m *memObjectStore) PutObject(ctx context.Context, key string, data []byte) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.objects[key] = bytes.Clone(data)
+	return nil
+}
+
+func (m *memObjectStore) GetObject(ctx context.Context, key string) ([]byte, error) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	m.gets++
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", key, ErrObjectNotFound)
+	}
+	return bytes.Clone(data), nil
+}
+
+func (m *memObjectStore) DeleteObject(ctx context.Context, key string) error {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func TestColdTier(t *testing.T) {
 	ctx := context.TODO()
 
+	cs, cleanup, err := testCarStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	objects := &memObjectStore{objects: make(map[string][]byte)}
+	// small enough for shards to be evicted
+	ct, err := NewColdTier(objects, &ColdTierOptions{CacheDir: t.TempDir(), CacheSize: 4 << 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cs.SetColdTier(ct)
+
+	head, rev, recs := writeTestRecords(t, cs, 20)
+
+	moved, err := cs.MoveShardsToColdTier(ctx, time.Now().Add(time.Hour), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// all the shards but the last one
+	if moved != 20 || len(objects.objects) != 20 {
+		t.Fatalf("moved %d shards (%d objects), expected 20", moved, len(objects.objects))
+	}
+	if moved, err := cs.MoveShardsToColdTier(ctx, time.Now().Add(time.Hour), 100); err != nil || moved != 0 {
+		t.Fatalf("moved %d shards again: %v", moved, err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := cs.ReadUserCar(ctx, 1, "", true, buf); err != nil {
+		t.Fatal(err)
+	}
+	checkRepo(t, cs, buf, recs)
+	if objects.gets == 0 {
+		t.Fatal("no shards fetched from the cold tier")
+	}
+
+	// new commits read the cold shards through the cache
+	_, _, recs = appendTestRecords(t, cs, head, rev, recs, 5)
+
+	if _, err := cs.CompactUserShards(ctx, 1, false); err != nil {
+		t.Fatal(err)
+	}
+	// the compacted shards are local again, and the old ones are deleted from the cold tier
+	if len(objects.objects) != 0 {
+		t.Fatalf("%d objects left in the cold tier after compaction", len(objects.objects))
+	}
+
+	buf = new(bytes.Buffer)
+	if err := cs.ReadUserCar(ctx, 1, "", true, buf); err != nil {
+		t.Fatal(err)
+	}
+	checkRepo(t, cs, buf, recs)
+}
+
+func TestExportCollections(t *testing.T) {
+	ctx := context.TODO()
+
+	cs := testBadgerCarStore(t)
+	_, _, recs := writeTestRecords(t, cs, 20)
+
+	buf := new(bytes.Buffer)
+	if err := ExportCollections(ctx, cs, 1, []string{"app.bsky.feed.post"}, buf); err != nil {
+		t.Fatal(err)
+	}
+	checkRepo(t, cs, buf, recs)
+
+	// only the nodes on the way to the (missing) collection
+	buf = new(bytes.Buffer)
+	if err := ExportCollections(ctx, cs, 1, []string{"app.bsky.feed.like"}, buf); err != nil {
+		t.Fatal(err)
+	}
+	r, err := repo.ReadRepoFromCar(ctx, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.ForEach(ctx, "app.bsky.feed.like/", func(k string, v cid.Cid) error {
+		if !strings.HasPrefix(k, "app.bsky.feed.like/") {
+			return repo.ErrDoneIterating
+		}
+		return fmt.Errorf("unexpected record %s", k)
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Creates a repo for user 1, and commits n records to it.
+func writeTestRecords(t testing.TB, cs Store, n int) (cid.Cid, string, []cid.Cid) {
+	ctx := context.TODO()
+
+	ds, err := cs.NewDeltaSession(ctx, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, rev, err := setupRepo(ctx, ds)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ds.CloseWithRoot(ctx, head, rev); err != nil {
+		t.Fatal(err)
+	}
+
+	return appendTestRecords(t, cs, head, rev, nil, n)
+}
+
+// Commits n more records to the repo of user 1, one per commit.
+func appendTestRecords(t testing.TB, cs Store, head cid.Cid, rev string, recs []cid.Cid, n int) (cid.Cid, string, []cid.Cid) {
+	ctx := context.TODO()
+
+	for i := 0; i < n; i++ {
+		ds, err := cs.NewDeltaSession(ctx, 1, &rev)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr, err := repo.OpenRepo(ctx, ds, head)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rc, _, err := rr.CreateRecord(ctx, "app.bsky.feed.post", &appbsky.FeedPost{
+			Text: fmt.Sprintf("hey look its a tweet %d", time.Now().UnixNano()),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rc)
+
+		kmgr := &util.FakeKeyManager{}
+		nroot, nrev, err := rr.Commit(ctx, kmgr.SignForUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ds.CalcDiff(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ds.CloseWithRoot(ctx, nroot, nrev); err != nil {
+			t.Fatal(err)
+		}
+
+		head, rev = nroot, nrev
+	}
+
+	return head, rev, recs
+}
+
+func BenchmarkRepoWritesCarstore(b *testing.B) {
 	cs, cleanup, err := testCarStore()
 	if err != nil {
 		b.Fatal(err)
 	}
 	defer cleanup()
 
+	benchmarkRepoWrites(b, cs)
+}
+
+func BenchmarkRepoWritesBadger(b *testing.B) {
+	benchmarkRepoWrites(b, testBadgerCarStore(b))
+}
+
+func benchmarkRepoWrites(b *testing.B, cs Store) {
+	ctx := context.TODO()
+
 	ds, err := cs.NewDeltaSession(ctx, 1, nil)
 	if err != nil {
 		b.Fatal(err)
@@ -444,3 +759,88 @@ func BenchmarkRepoWritesSqlite(b *testing.B) {
 		head = nroot
 	}
 }
+
+func BenchmarkRepoReadsCarstore(b *testing.B) {
+	cs, cleanup, err := testCarStore()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer cleanup()
+
+	benchmarkRepoReads(b, cs)
+}
+
+func BenchmarkRepoReadsBadger(b *testing.B) {
+	benchmarkRepoReads(b, testBadgerCarStore(b))
+}
+
+// Reads single records from a repo, through a read-only session.
+func benchmarkRepoReads(b *testing.B, cs Store) {
+	ctx := context.TODO()
+
+	head, _, _ := writeTestRecords(b, cs, 200)
+
+	ds, err := cs.ReadOnlySession(1)
+	if err != nil {
+		b.Fatal(err)
+	}
+	rr, err := repo.OpenRepo(ctx, ds, head)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var rpaths []string
+	if err := rr.ForEach(ctx, "", func(k string, v cid.Cid) error {
+		rpaths = append(rpaths, k)
+		return nil
+	}); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ds, err := cs.ReadOnlySession(1)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		rr, err := repo.OpenRepo(ctx, ds, head)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if _, _, err := rr.GetRecord(ctx, rpaths[i%len(rpaths)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadUserCarCarstore(b *testing.B) {
+	cs, cleanup, err := testCarStore()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer cleanup()
+
+	benchmarkReadUserCar(b, cs)
+}
+
+func BenchmarkReadUserCarBadger(b *testing.B) {
+	benchmarkReadUserCar(b, testBadgerCarStore(b))
+}
+
+// Exports a whole repo, reporting the throughput in bytes.
+func benchmarkReadUserCar(b *testing.B, cs Store) {
+	ctx := context.TODO()
+
+	writeTestRecords(b, cs, 200)
+
+	buf := new(bytes.Buffer)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := cs.ReadUserCar(ctx, 1, "", true, buf); err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(buf.Len()))
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/bluesky-social/indigo/carstore"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/util/cliutil"
+
+	"github.com/urfave/cli/v2"
+)
+
+var migrateCarstoreCmd = &cli.Command{
+	Name:  "migrate-carstore",
+	Usage: "copy the repos of the 'files' carstore backend to the 'badger' one, while the BGS is stopped",
+	Flags: []cli.Flag{
+		&cli.Uint64Flag{
+			Name:  "after",
+			Usage: "only copy the repos of users with uids greater than this, to resume an interrupted migration",
+		},
+		&cli.IntFlag{
+			Name:  "batch-size",
+			Usage: "number of users listed at once",
+			Value: 1000,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := cctx.Context
+
+		datadir := cctx.String("data-dir")
+		csdb, err := cliutil.SetupDatabase(cctx.String("carstore-db-url"), cctx.Int("max-carstore-connections"))
+		if err != nil {
+			return err
+		}
+
+		from, err := carstore.NewCarStore(csdb, filepath.Join(datadir, "carstore"))
+		if err != nil {
+			return err
+		}
+
+		bdir := filepath.Join(datadir, "carstore-badger")
+		if err := os.MkdirAll(bdir, os.ModePerm); err != nil {
+			return err
+		}
+		to, err := carstore.NewBadgerCarStore(bdir, nil)
+		if err != nil {
+			return err
+		}
+		defer to.Close()
+
+		start := time.Now()
+		after := models.Uid(cctx.Uint64("after"))
+		var users, blocks int
+		for {
+			uids, err := from.UsersWithShards(ctx, after, cctx.Int("batch-size"))
+			if err != nil {
+				return err
+			}
+			if len(uids) == 0 {
+				break
+			}
+
+			for _, uid := range uids {
+				n, err := carstore.CopyUserToBadger(ctx, from, to, uid)
+				if err != nil {
+					return fmt.Errorf("copying repo of user %d (resume with --after=%d): %w", uid, after, err)
+				}
+				after = uid
+				users++
+				blocks += n
+			}
+			log.Infow("copied repos", "users", users, "blocks", blocks, "lastUid", after, "elapsed", time.Since(start))
+		}
+
+		log.Infow("carstore migration complete", "users", users, "blocks", blocks, "elapsed", time.Since(start))
+		return nil
+	},
+}
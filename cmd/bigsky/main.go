@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/bluesky-social/indigo/api"
+	"github.com/bluesky-social/indigo/atproto/identity"
 	libbgs "github.com/bluesky-social/indigo/bgs"
 	"github.com/bluesky-social/indigo/blobs"
 	"github.com/bluesky-social/indigo/carstore"
@@ -86,6 +87,12 @@ func run(args []string) {
 			Value:   "data/bigsky",
 			EnvVars: []string{"DATA_DIR"},
 		},
+		&cli.StringFlag{
+			Name:    "carstore-backend",
+			Usage:   "storage of repo blocks: 'files' (CAR files, indexed in the carstore database) or 'badger' (embedded key-value store in the data directory)",
+			Value:   "files",
+			EnvVars: []string{"BGS_CARSTORE_BACKEND"},
+		},
 		&cli.StringFlag{
 			Name:    "plc-host",
 			Usage:   "method, hostname, and port of PLC registry",
@@ -121,6 +128,44 @@ func run(args []string) {
 			Name:  "disk-persister-dir",
 			Usage: "set directory for disk persister (implicitly enables disk persister)",
 		},
+		&cli.DurationFlag{
+			Name:    "disk-persister-retention",
+			Usage:   "how long the disk persister keeps events for playback",
+			EnvVars: []string{"BGS_DISK_PERSISTER_RETENTION"},
+			Value:   events.DefaultDiskPersistOptions().Retention,
+		},
+		&cli.Int64Flag{
+			Name:    "disk-persister-max-bytes",
+			Usage:   "if non-zero, the disk persister deletes its oldest events files when they add up to more than this many bytes",
+			EnvVars: []string{"BGS_DISK_PERSISTER_MAX_BYTES"},
+		},
+		&cli.BoolFlag{
+			Name:    "disk-persister-compact",
+			Usage:   "rewrite disk persister events files to reclaim the space of taken down events",
+			EnvVars: []string{"BGS_DISK_PERSISTER_COMPACT"},
+		},
+		&cli.BoolFlag{
+			Name:    "non-archival",
+			Usage:   "only keep the head commit of each repo instead of full repos, and prune repo data already stored (requires the disk persister)",
+			EnvVars: []string{"BGS_NON_ARCHIVAL"},
+		},
+		&cli.BoolFlag{
+			Name:    "strict-commit-ops",
+			Usage:   "reject commits whose ops don't match the changes to the repo, instead of only logging them",
+			EnvVars: []string{"BGS_STRICT_COMMIT_OPS"},
+		},
+		&cli.IntFlag{
+			Name:    "non-archival-prune-batch",
+			Usage:   "number of repos pruned per batch in non-archival mode",
+			EnvVars: []string{"BGS_NON_ARCHIVAL_PRUNE_BATCH"},
+			Value:   libbgs.DefaultArchivePrunerOptions().BatchSize,
+		},
+		&cli.DurationFlag{
+			Name:    "non-archival-prune-interval",
+			Usage:   "pause between batches of pruned repos in non-archival mode",
+			EnvVars: []string{"BGS_NON_ARCHIVAL_PRUNE_INTERVAL"},
+			Value:   libbgs.DefaultArchivePrunerOptions().Interval,
+		},
 		&cli.StringFlag{
 			Name:    "admin-key",
 			EnvVars: []string{"BGS_ADMIN_KEY"},
@@ -139,9 +184,104 @@ func run(args []string) {
 			EnvVars: []string{"MAX_METADB_CONNECTIONS"},
 			Value:   40,
 		},
+		&cli.Int64Flag{
+			Name:    "host-quota-events-per-hour",
+			Usage:   "alert when a single PDS host emits more events than this per hour (0 disables)",
+			EnvVars: []string{"BGS_HOST_QUOTA_EVENTS_PER_HOUR"},
+		},
+		&cli.Int64Flag{
+			Name:    "host-quota-new-repos-per-hour",
+			Usage:   "alert when more new repos than this are discovered from a single PDS host per hour (0 disables)",
+			EnvVars: []string{"BGS_HOST_QUOTA_NEW_REPOS_PER_HOUR"},
+		},
+		&cli.StringFlag{
+			Name:    "host-quota-webhook-url",
+			Usage:   "full URL of webhook (eg, Slack) to notify of host quota alerts",
+			EnvVars: []string{"BGS_HOST_QUOTA_WEBHOOK_URL"},
+		},
+		&cli.Float64Flag{
+			Name:    "host-quota-throttle-limit",
+			Usage:   "if non-zero, reduce the ingest rate limit (events/sec) of hosts which exceed a quota to this value",
+			EnvVars: []string{"BGS_HOST_QUOTA_THROTTLE_LIMIT"},
+		},
+		&cli.Float64Flag{
+			Name:    "compaction-duty-cycle",
+			Usage:   "fraction of the time the compactor spends compacting, in (0, 1]; it sleeps the rest of the time",
+			EnvVars: []string{"BGS_COMPACTION_DUTY_CYCLE"},
+			Value:   libbgs.DefaultCompactorOptions().DutyCycle,
+		},
+		&cli.Float64Flag{
+			Name:    "compaction-max-ingest-rate",
+			Usage:   "pause compaction while more events than this per second are received (0 disables)",
+			EnvVars: []string{"BGS_COMPACTION_MAX_INGEST_RATE"},
+		},
+		&cli.BoolFlag{
+			Name:    "did-allowlist-only",
+			Usage:   "only accept events about the DIDs on the allowlist (managed with the admin API)",
+			EnvVars: []string{"BGS_DID_ALLOWLIST_ONLY"},
+		},
+		&cli.DurationFlag{
+			Name:    "handle-recheck-interval",
+			Usage:   "re-verify the handles of all active accounts over this interval, emitting #identity events on changes (0 disables)",
+			EnvVars: []string{"BGS_HANDLE_RECHECK_INTERVAL"},
+		},
+		&cli.StringFlag{
+			Name:    "cold-tier-s3-bucket",
+			Usage:   "move carstore shards older than --cold-tier-age to this S3 bucket (files carstore backend only; disabled if empty)",
+			EnvVars: []string{"BGS_COLD_TIER_S3_BUCKET"},
+		},
+		&cli.StringFlag{
+			Name:    "cold-tier-s3-endpoint",
+			Usage:   "host of the S3-compatible object storage API",
+			Value:   "s3.amazonaws.com",
+			EnvVars: []string{"BGS_COLD_TIER_S3_ENDPOINT"},
+		},
+		&cli.StringFlag{
+			Name:    "cold-tier-s3-region",
+			EnvVars: []string{"BGS_COLD_TIER_S3_REGION", "AWS_REGION"},
+		},
+		&cli.StringFlag{
+			Name:    "cold-tier-s3-prefix",
+			Usage:   "prefix of the keys of the shards in the bucket",
+			EnvVars: []string{"BGS_COLD_TIER_S3_PREFIX"},
+		},
+		&cli.StringFlag{
+			Name:    "cold-tier-s3-access-key",
+			EnvVars: []string{"BGS_COLD_TIER_S3_ACCESS_KEY", "AWS_ACCESS_KEY_ID"},
+		},
+		&cli.StringFlag{
+			Name:    "cold-tier-s3-secret-key",
+			EnvVars: []string{"BGS_COLD_TIER_S3_SECRET_KEY", "AWS_SECRET_ACCESS_KEY"},
+		},
+		&cli.BoolFlag{
+			Name:    "cold-tier-s3-insecure",
+			Usage:   "use plain HTTP for the object storage API",
+			EnvVars: []string{"BGS_COLD_TIER_S3_INSECURE"},
+		},
+		&cli.DurationFlag{
+			Name:    "cold-tier-age",
+			Usage:   "age of the carstore shards moved to the cold tier",
+			Value:   libbgs.DefaultColdTierMoverOptions().Age,
+			EnvVars: []string{"BGS_COLD_TIER_AGE"},
+		},
+		&cli.Int64Flag{
+			Name:    "cold-tier-cache-size",
+			Usage:   "total size of the local cache of shards fetched from the cold tier, in bytes",
+			Value:   carstore.DefaultColdTierOptions().CacheSize,
+			EnvVars: []string{"BGS_COLD_TIER_CACHE_SIZE"},
+		},
+		&cli.IntFlag{
+			Name:    "handle-recheck-concurrency",
+			Usage:   "number of handles re-verified in parallel",
+			EnvVars: []string{"BGS_HANDLE_RECHECK_CONCURRENCY"},
+			Value:   libbgs.DefaultHandleCheckOptions().Concurrency,
+		},
 	}
 
 	app.Action = Bigsky
+	app.Commands = []*cli.Command{
+		migrateCarstoreCmd,
+	}
 	err := app.Run(os.Args)
 	if err != nil {
 		log.Fatal(err)
@@ -239,10 +379,48 @@ func Bigsky(cctx *cli.Context) error {
 		}
 	}
 
-	os.MkdirAll(filepath.Dir(csdir), os.ModePerm)
-	cstore, err := carstore.NewCarStore(csdb, csdir)
-	if err != nil {
-		return err
+	var cstore carstore.Store
+	switch backend := cctx.String("carstore-backend"); backend {
+	case "files":
+		os.MkdirAll(filepath.Dir(csdir), os.ModePerm)
+		fcs, err := carstore.NewCarStore(csdb, csdir)
+		if err != nil {
+			return err
+		}
+		if bucket := cctx.String("cold-tier-s3-bucket"); bucket != "" {
+			log.Infow("setting up carstore cold tier", "bucket", bucket)
+			objects, err := carstore.NewS3ObjectStore(&carstore.S3Options{
+				Endpoint:  cctx.String("cold-tier-s3-endpoint"),
+				Region:    cctx.String("cold-tier-s3-region"),
+				Bucket:    bucket,
+				AccessKey: cctx.String("cold-tier-s3-access-key"),
+				SecretKey: cctx.String("cold-tier-s3-secret-key"),
+				Prefix:    cctx.String("cold-tier-s3-prefix"),
+				Insecure:  cctx.Bool("cold-tier-s3-insecure"),
+			})
+			if err != nil {
+				return err
+			}
+			ct, err := carstore.NewColdTier(objects, &carstore.ColdTierOptions{
+				CacheDir:  filepath.Join(datadir, "cold-cache"),
+				CacheSize: cctx.Int64("cold-tier-cache-size"),
+			})
+			if err != nil {
+				return fmt.Errorf("setting up cold tier: %w", err)
+			}
+			fcs.SetColdTier(ct)
+		}
+		cstore = fcs
+	case "badger":
+		log.Infow("setting up badger carstore")
+		bcs, err := carstore.NewBadgerCarStore(filepath.Join(datadir, "carstore-badger"), nil)
+		if err != nil {
+			return err
+		}
+		defer bcs.Close()
+		cstore = bcs
+	default:
+		return fmt.Errorf("unknown carstore backend: %q", backend)
 	}
 
 	mr := did.NewMultiResolver()
@@ -262,11 +440,42 @@ func Bigsky(cctx *cli.Context) error {
 
 	repoman := repomgr.NewRepoManager(cstore, kmgr)
 
+	// the identity directory has no support for did:web over plain http, which the key manager's resolver covers
+	if !cctx.Bool("crawl-insecure-ws") {
+		base := identity.BaseDirectory{
+			PLCURL: cctx.String("plc-host"),
+			HTTPClient: http.Client{
+				Timeout: time.Second * 15,
+			},
+		}
+		dir := identity.NewCacheDirectory(&base, 500_000, time.Hour*24, time.Minute*2)
+		repoman.SetDirectory(&dir)
+	}
+
+	repoman.SetStrictCommitOps(cctx.Bool("strict-commit-ops"))
+
+	if cctx.Bool("non-archival") {
+		// db persistence reads the blocks of events from the carstore
+		if cctx.String("disk-persister-dir") == "" {
+			return fmt.Errorf("non-archival mode requires --disk-persister-dir")
+		}
+		log.Infow("setting up non-archival mode")
+		nacs, err := carstore.NewNonArchivalCarstore(csdb)
+		if err != nil {
+			return fmt.Errorf("setting up non-archival carstore: %w", err)
+		}
+		repoman.SetNonArchival(nacs)
+	}
+
 	var persister events.EventPersistence
 
 	if dpd := cctx.String("disk-persister-dir"); dpd != "" {
 		log.Infow("setting up disk persister")
-		dp, err := events.NewDiskPersistence(dpd, "", db, events.DefaultDiskPersistOptions())
+		dpOpts := events.DefaultDiskPersistOptions()
+		dpOpts.Retention = cctx.Duration("disk-persister-retention")
+		dpOpts.MaxBytes = cctx.Int64("disk-persister-max-bytes")
+		dpOpts.CompactTakedowns = cctx.Bool("disk-persister-compact")
+		dp, err := events.NewDiskPersistence(dpd, "", db, dpOpts)
 		if err != nil {
 			return fmt.Errorf("setting up disk persister: %w", err)
 		}
@@ -342,6 +551,41 @@ func Bigsky(cctx *cli.Context) error {
 		return err
 	}
 
+	if cctx.Int64("host-quota-events-per-hour") > 0 || cctx.Int64("host-quota-new-repos-per-hour") > 0 {
+		quotaOpts := libbgs.DefaultHostQuotaOptions()
+		quotaOpts.EventsPerHour = cctx.Int64("host-quota-events-per-hour")
+		quotaOpts.NewReposPerHour = cctx.Int64("host-quota-new-repos-per-hour")
+		quotaOpts.WebhookURL = cctx.String("host-quota-webhook-url")
+		quotaOpts.ThrottleLimit = cctx.Float64("host-quota-throttle-limit")
+		bgs.SetHostQuotas(quotaOpts)
+	}
+
+	bgs.SetCompactorThrottle(cctx.Float64("compaction-duty-cycle"), cctx.Float64("compaction-max-ingest-rate"))
+
+	bgs.Filter().SetAllowlistOnly(cctx.Bool("did-allowlist-only"))
+
+	if ival := cctx.Duration("handle-recheck-interval"); ival > 0 {
+		hcOpts := libbgs.DefaultHandleCheckOptions()
+		hcOpts.Interval = ival
+		hcOpts.Concurrency = cctx.Int("handle-recheck-concurrency")
+		bgs.StartHandleChecker(hcOpts)
+	}
+
+	if cctx.String("cold-tier-s3-bucket") != "" {
+		ctOpts := libbgs.DefaultColdTierMoverOptions()
+		ctOpts.Age = cctx.Duration("cold-tier-age")
+		if err := bgs.StartColdTierMover(ctOpts); err != nil {
+			return err
+		}
+	}
+
+	if cctx.Bool("non-archival") {
+		pruneOpts := libbgs.DefaultArchivePrunerOptions()
+		pruneOpts.BatchSize = cctx.Int("non-archival-prune-batch")
+		pruneOpts.Interval = cctx.Duration("non-archival-prune-interval")
+		bgs.StartArchivePruner(pruneOpts)
+	}
+
 	if tok := cctx.String("admin-key"); tok != "" {
 		if err := bgs.CreateAdminToken(tok); err != nil {
 			return fmt.Errorf("failed to set up admin token: %w", err)
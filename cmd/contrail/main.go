@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bluesky-social/indigo/events/firehose"
+	"github.com/bluesky-social/indigo/events/jetstream"
+
+	"github.com/carlmjohnson/versioninfo"
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	cli "github.com/urfave/cli/v2"
+)
+
+func main() {
+	if err := run(os.Args); err != nil {
+		slog.Error("exiting", "err", err)
+		os.Exit(-1)
+	}
+}
+
+func run(args []string) error {
+
+	app := cli.App{
+		Name:    "contrail",
+		Usage:   "serves the firehose as a Jetstream-compatible JSON event stream",
+		Version: versioninfo.Short(),
+	}
+
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "atp-relay-host",
+			Usage:   "method, hostname, and port of the relay to subscribe to",
+			Value:   "wss://bsky.network",
+			EnvVars: []string{"ATP_RELAY_HOST"},
+		},
+		&cli.StringFlag{
+			Name:    "bind",
+			Usage:   "IP or address, and port, to listen on for subscribers",
+			Value:   ":6008",
+			EnvVars: []string{"CONTRAIL_BIND"},
+		},
+		&cli.IntFlag{
+			Name:    "buffer-size",
+			Usage:   "number of recent events kept in memory, for subscribers which connect with a cursor",
+			Value:   jetstream.DefaultServerConfig().BufferSize,
+			EnvVars: []string{"CONTRAIL_BUFFER_SIZE"},
+		},
+		&cli.IntFlag{
+			Name:    "subscriber-buffer",
+			Usage:   "number of events queued for a subscriber before it is disconnected for being too slow",
+			Value:   jetstream.DefaultServerConfig().SubscriberBuffer,
+			EnvVars: []string{"CONTRAIL_SUBSCRIBER_BUFFER"},
+		},
+		&cli.StringFlag{
+			Name:    "cursor-file",
+			Usage:   "path of the file where the firehose cursor is persisted",
+			Value:   "contrail_cursor.json",
+			EnvVars: []string{"CONTRAIL_CURSOR_FILE"},
+		},
+		&cli.StringFlag{
+			Name:    "metrics-listen",
+			Usage:   "IP or address, and port, to listen on for metrics APIs",
+			Value:   ":3999",
+			EnvVars: []string{"CONTRAIL_METRICS_LISTEN"},
+		},
+	}
+
+	app.Action = runContrail
+
+	return app.Run(args)
+}
+
+func runContrail(cctx *cli.Context) error {
+	ctx, stop := signal.NotifyContext(cctx.Context, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	scfg := jetstream.DefaultServerConfig()
+	scfg.BufferSize = cctx.Int("buffer-size")
+	scfg.SubscriberBuffer = cctx.Int("subscriber-buffer")
+	scfg.Logger = logger
+	srv := jetstream.NewServer(scfg)
+
+	// prometheus HTTP endpoint: /metrics
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		if err := http.ListenAndServe(cctx.String("metrics-listen"), mux); err != nil {
+			logger.Error("failed to start metrics endpoint", "err", err)
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/subscribe", srv)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "This is a Jetstream-compatible event stream. Subscribe over WebSocket at /subscribe\n")
+	})
+	httpd := &http.Server{
+		Addr:    cctx.String("bind"),
+		Handler: mux,
+	}
+	go func() {
+		logger.Info("listening for subscribers", "bind", httpd.Addr)
+		if err := httpd.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("failed to start subscriber endpoint", "err", err)
+			stop()
+		}
+	}()
+
+	// events are handled in order, by the default sequential scheduler
+	cfg := firehose.DefaultConsumerConfig()
+	cfg.UserAgent = fmt.Sprintf("contrail/%s", versioninfo.Short())
+	cfg.Logger = logger
+	cfg.Cursors = firehose.NewFileCursorStore(cctx.String("cursor-file"))
+	consumer := firehose.NewConsumer(cctx.String("atp-relay-host"), srv.HandleEvent, cfg)
+
+	err := consumer.Run(ctx)
+	logger.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// WebSocket connections are hijacked, so they aren't waited for
+	_ = httpd.Shutdown(shutdownCtx)
+	return err
+}
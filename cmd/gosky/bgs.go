@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"strconv"
 
+	"github.com/bluesky-social/indigo/api"
 	"github.com/bluesky-social/indigo/xrpc"
 	cli "github.com/urfave/cli/v2"
 )
@@ -35,6 +38,12 @@ var bgsAdminCmd = &cli.Command{
 		bgsCompactRepo,
 		bgsCompactAll,
 		bgsResetRepo,
+		bgsExportEventsCmd,
+		bgsListHostsCmd,
+		bgsPauseHostCmd,
+		bgsResumeHostCmd,
+		bgsSetHostRepoLimitCmd,
+		bgsPurgeHostCmd,
 	},
 }
 
@@ -516,3 +525,165 @@ var bgsSetTrustedDomains = &cli.Command{
 		return nil
 	},
 }
+
+var bgsExportEventsCmd = &cli.Command{
+	Name:      "export-events",
+	Usage:     "export a range of persisted events to a dump file, which can be replayed with 'debug replay-dump'",
+	ArgsUsage: "<file>",
+	Flags: []cli.Flag{
+		&cli.Int64Flag{
+			Name:  "from",
+			Usage: "sequence number of the first event to export",
+		},
+		&cli.Int64Flag{
+			Name:  "to",
+			Usage: "sequence number of the last event to export (default: the latest)",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return fmt.Errorf("must specify the dump file to write")
+		}
+		uu := fmt.Sprintf("%s/admin/events/export?from=%d&to=%d", cctx.String("bgs"), cctx.Int64("from"), cctx.Int64("to"))
+		req, err := http.NewRequestWithContext(cctx.Context, "GET", uu, nil)
+		if err != nil {
+			return err
+		}
+
+		auth := cctx.String("key")
+		req.Header.Set("Authorization", "Bearer "+auth)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			var e xrpc.XRPCError
+			if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+				return err
+			}
+
+			return &e
+		}
+
+		f, err := os.Create(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+		n, err := io.Copy(f, resp.Body)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "wrote %d bytes to %s\n", n, cctx.Args().First())
+		return nil
+	},
+}
+
+func relayAdminClient(cctx *cli.Context) *api.RelayAdminClient {
+	return &api.RelayAdminClient{
+		Host:     cctx.String("bgs"),
+		AdminKey: cctx.String("key"),
+	}
+}
+
+var bgsListHostsCmd = &cli.Command{
+	Name:  "list-hosts",
+	Usage: "list the PDS hosts known to the Relay/BGS, with the state of their subscriptions",
+	Action: func(cctx *cli.Context) error {
+		hosts, err := relayAdminClient(cctx).ListHosts(cctx.Context)
+		if err != nil {
+			return err
+		}
+
+		for _, h := range hosts {
+			state := "disconnected"
+			switch {
+			case h.Blocked:
+				state = "blocked"
+			case h.Paused:
+				state = "paused"
+			case h.Connected:
+				state = fmt.Sprintf("connected (lag %.0fs)", h.Lag)
+			}
+			limit := "-"
+			if h.RepoLimit > 0 {
+				limit = strconv.FormatInt(h.RepoLimit, 10)
+			}
+			fmt.Printf("%s\t%s\trepos=%d/%s\tcursor=%d\n", h.Host, state, h.RepoCount, limit, h.Cursor)
+		}
+
+		return nil
+	},
+}
+
+var bgsPauseHostCmd = &cli.Command{
+	Name:      "pause-host",
+	Usage:     "disconnect from a PDS host until it's resumed",
+	ArgsUsage: "<host>",
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return fmt.Errorf("must specify a host")
+		}
+		return relayAdminClient(cctx).PauseHost(cctx.Context, cctx.Args().First())
+	},
+}
+
+var bgsResumeHostCmd = &cli.Command{
+	Name:      "resume-host",
+	Usage:     "subscribe to a paused PDS host again",
+	ArgsUsage: "<host>",
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return fmt.Errorf("must specify a host")
+		}
+		return relayAdminClient(cctx).ResumeHost(cctx.Context, cctx.Args().First())
+	},
+}
+
+var bgsSetHostRepoLimitCmd = &cli.Command{
+	Name:      "set-host-repo-limit",
+	Usage:     "set the maximum number of repos accepted from a PDS host (0 for no limit)",
+	ArgsUsage: "<host> <limit>",
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 2 {
+			return fmt.Errorf("must specify a host and a limit")
+		}
+		limit, err := strconv.ParseInt(cctx.Args().Get(1), 10, 64)
+		if err != nil {
+			return err
+		}
+		return relayAdminClient(cctx).SetHostRepoLimit(cctx.Context, cctx.Args().First(), limit)
+	},
+}
+
+var bgsPurgeHostCmd = &cli.Command{
+	Name:      "purge-host",
+	Usage:     "delete a PDS host and all of its repos from the Relay/BGS",
+	ArgsUsage: "<host>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "yes",
+			Usage: "confirm the deletion",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return fmt.Errorf("must specify a host")
+		}
+		if !cctx.Bool("yes") {
+			return fmt.Errorf("purging deletes all the repos of the host; pass --yes to confirm")
+		}
+		res, err := relayAdminClient(cctx).PurgeHost(cctx.Context, cctx.Args().First())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("purged %s: %d repos deleted\n", res.Host, res.ReposDeleted)
+		return nil
+	},
+}
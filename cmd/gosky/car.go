@@ -12,6 +12,8 @@ import (
 	"github.com/bluesky-social/indigo/repo"
 
 	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	cli "github.com/urfave/cli/v2"
 )
 
@@ -20,6 +22,7 @@ var carCmd = &cli.Command{
 	Usage: "sub-commands to work with CAR files on local disk",
 	Subcommands: []*cli.Command{
 		carUnpackCmd,
+		carVerifyMSTCmd,
 	},
 }
 
@@ -123,3 +126,42 @@ var carUnpackCmd = &cli.Command{
 		return nil
 	},
 }
+
+var carVerifyMSTCmd = &cli.Command{
+	Name:      "verify-mst",
+	Usage:     "check the structure of the MST of a repo export CAR file, and that all of its records are present",
+	ArgsUsage: `<car-file>`,
+	Action: func(cctx *cli.Context) error {
+		ctx := context.Background()
+		arg := cctx.Args().First()
+		if arg == "" {
+			return fmt.Errorf("CAR file path arg is required")
+		}
+
+		fi, err := os.Open(arg)
+		if err != nil {
+			return err
+		}
+		defer fi.Close()
+
+		bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+		root, err := repo.IngestRepo(ctx, bs, fi)
+		if err != nil {
+			return err
+		}
+
+		report, err := repo.VerifyMST(ctx, bs, root)
+		if err != nil {
+			return err
+		}
+
+		for _, p := range report.Problems {
+			fmt.Println(p)
+		}
+		fmt.Printf("%d nodes, %d leaves, root on layer %d\n", report.Nodes, report.Leaves, report.Layer)
+		if !report.OK() {
+			return fmt.Errorf("found %d problems in MST", len(report.Problems))
+		}
+		return nil
+	},
+}
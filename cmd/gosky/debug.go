@@ -48,6 +48,7 @@ var debugCmd = &cli.Command{
 		compareStreamsCmd,
 		debugGetRepoCmd,
 		debugCompareReposCmd,
+		debugReplayDumpCmd,
 	},
 }
 
@@ -983,3 +984,106 @@ var debugCompareReposCmd = &cli.Command{
 		return nil
 	},
 }
+
+var debugReplayDumpCmd = &cli.Command{
+	Name:      "replay-dump",
+	Usage:     "serve the events of a dump file (see 'bgs export-events') as a subscribeRepos stream, at a configurable speed",
+	ArgsUsage: "<file>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "listen",
+			Usage: "address to listen on; consumers subscribe at /xrpc/com.atproto.sync.subscribeRepos, optionally with a cursor",
+			Value: ":2480",
+		},
+		&cli.Float64Flag{
+			Name:  "speed",
+			Usage: "replay speed relative to the original time between events; 0 replays as fast as possible",
+			Value: 1,
+		},
+		&cli.Float64Flag{
+			Name:  "rate",
+			Usage: "if set, replay at this fixed rate (events per second) instead",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return fmt.Errorf("must specify the dump file to replay")
+		}
+		path := cctx.Args().First()
+		// fail early on files which aren't dumps
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		_, err = events.NewDumpReader(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+
+		upgrader := websocket.Upgrader{}
+		mux := http.NewServeMux()
+		mux.HandleFunc("/xrpc/com.atproto.sync.subscribeRepos", func(w http.ResponseWriter, r *http.Request) {
+			opts := events.ReplayOptions{
+				Speed: cctx.Float64("speed"),
+				Rate:  cctx.Float64("rate"),
+			}
+			if c := r.URL.Query().Get("cursor"); c != "" {
+				cursor, err := strconv.ParseInt(c, 10, 64)
+				if err != nil {
+					http.Error(w, "invalid cursor", http.StatusBadRequest)
+					return
+				}
+				opts.From = cursor + 1
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer f.Close()
+
+			con, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer con.Close()
+
+			// notices when the consumer disconnects
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			go func() {
+				defer cancel()
+				for {
+					if _, _, err := con.ReadMessage(); err != nil {
+						return
+					}
+				}
+			}()
+
+			fmt.Fprintf(os.Stderr, "replaying to %s from seq %d\n", r.RemoteAddr, opts.From)
+			start, n := time.Now(), 0
+			err = events.Replay(ctx, f, opts, func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+				wc, err := con.NextWriter(websocket.BinaryMessage)
+				if err != nil {
+					return err
+				}
+				if err := evt.WriteFrame(wc); err != nil {
+					return err
+				}
+				n++
+				return wc.Close()
+			})
+			if err != nil && ctx.Err() == nil {
+				fmt.Fprintf(os.Stderr, "replay to %s failed: %s\n", r.RemoteAddr, err)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "replayed %d events to %s in %s\n", n, r.RemoteAddr, time.Since(start))
+			_ = con.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		})
+
+		fmt.Fprintf(os.Stderr, "serving %s on %s\n", path, cctx.String("listen"))
+		return http.ListenAndServe(cctx.String("listen"), mux)
+	},
+}
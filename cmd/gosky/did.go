@@ -4,8 +4,10 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/bluesky-social/indigo/api"
+	"github.com/bluesky-social/indigo/plc"
 	"github.com/bluesky-social/indigo/util/cliutil"
 
 	cli "github.com/urfave/cli/v2"
@@ -19,6 +21,7 @@ var didCmd = &cli.Command{
 		didGetCmd,
 		didCreateCmd,
 		didKeyCmd,
+		didAuditCmd,
 	},
 }
 
@@ -117,3 +120,53 @@ var didKeyCmd = &cli.Command{
 		return nil
 	},
 }
+
+var didAuditCmd = &cli.Command{
+	Name:      "audit",
+	Usage:     "fetch and verify the full operation log of a did:plc",
+	ArgsUsage: `<did>`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "json",
+			Usage: "print the verified history as JSON",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		args, err := needArgs(cctx, "did")
+		if err != nil {
+			return err
+		}
+
+		audit, err := plc.AuditDID(cctx.Context, nil, cctx.String("plc"), args[0])
+		if err != nil {
+			return err
+		}
+
+		if cctx.Bool("json") {
+			b, err := json.MarshalIndent(audit, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(b))
+		} else {
+			for _, op := range audit.Ops {
+				status := "ok"
+				if op.Nullified {
+					status = "nullified"
+				}
+				if !op.Valid {
+					status += ", INVALID"
+				}
+				fmt.Printf("%s\t%s\t%s\tkey %d\t%s\n", op.CreatedAt.Format(time.RFC3339), op.CID, op.Type, op.KeyIndex, status)
+			}
+			for _, p := range audit.Problems {
+				fmt.Println(p)
+			}
+		}
+
+		if !audit.OK() {
+			return fmt.Errorf("found %d problems in the operation log", len(audit.Problems))
+		}
+		return nil
+	},
+}
@@ -95,6 +95,7 @@ func run(args []string) {
 		readRepoStreamCmd,
 		parseRkey,
 		listLabelsCmd,
+		replCmd,
 	}
 
 	app.RunAndExitOnError()
@@ -0,0 +1,479 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/util/cliutil"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+var replCmd = &cli.Command{
+	Name:  "repl",
+	Usage: "interactive session with shorthand commands for common API calls",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "history-file",
+			Usage:   "path to file for persistent command history (empty to disable)",
+			Value:   defaultReplHistoryPath(),
+			EnvVars: []string{"GOSKY_HISTORY_FILE"},
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		xrpcc, err := cliutil.GetXrpcClient(cctx, false)
+		if err != nil {
+			return err
+		}
+		sess := &replSession{
+			xrpcc:       xrpcc,
+			dir:         identity.DefaultDirectory(),
+			authPath:    cctx.String("auth"),
+			historyPath: cctx.String("history-file"),
+			out:         os.Stdout,
+		}
+		if err := sess.loadHistory(); err != nil {
+			return err
+		}
+		return sess.run(cctx.Context, os.Stdin)
+	},
+}
+
+func defaultReplHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".gosky_history")
+}
+
+// State which persists between commands in a REPL session.
+type replSession struct {
+	xrpcc       *xrpc.Client
+	dir         identity.Directory
+	authPath    string
+	historyPath string
+	history     []string
+	out         io.Writer
+}
+
+type replVerb struct {
+	usage string
+	help  string
+	fn    func(ctx context.Context, s *replSession, args []string) error
+}
+
+var replVerbs = map[string]replVerb{
+	"login":   {"login <handle> <password>", "create a new auth session, and save it to the auth file", replLogin},
+	"refresh": {"refresh", "refresh the current auth session", replRefresh},
+	"whoami":  {"whoami", "describe the current auth session", replWhoami},
+	"host":    {"host [<url>]", "show or change the PDS or AppView host requests are sent to", replHost},
+	"get":     {"get <at-uri>", "fetch a single record", replGetRecord},
+	"resolve": {"resolve <handle>", "resolve a handle to a DID, using the current host", replResolveHandle},
+	"id":      {"id <handle-or-did>", "resolve a full identity (DID document, handle, PDS) from the network", replIdentity},
+	"profile": {"profile <handle-or-did>", "fetch an actor profile", replProfile},
+	"search":  {"search <query>", "search posts", replSearchPosts},
+	"people":  {"people <query>", "search actors", replSearchActors},
+	"call":    {"call <nsid> [<param>=<value> ...]", "make an arbitrary XRPC query (GET) request", replCall},
+}
+
+// Returned by exec when the session should end.
+var errReplExit = errors.New("exit")
+
+func (s *replSession) run(ctx context.Context, in io.Reader) error {
+	scan := bufio.NewScanner(in)
+	for {
+		fmt.Fprintf(s.out, "%s> ", s.prompt())
+		if !scan.Scan() {
+			fmt.Fprintln(s.out)
+			return scan.Err()
+		}
+		if err := s.exec(ctx, scan.Text()); err != nil {
+			if errors.Is(err, errReplExit) {
+				return nil
+			}
+			fmt.Fprintln(s.out, "error:", err)
+		}
+	}
+}
+
+// Runs a single line of input: expands history references, records the line in the history, and dispatches the command.
+func (s *replSession) exec(ctx context.Context, line string) error {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+
+	// history expansion, shell-style: "!!" for the last command, "!N" for entry N
+	if strings.HasPrefix(line, "!") {
+		expanded, err := s.expandHistory(line)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(s.out, expanded)
+		line = expanded
+	}
+	s.appendHistory(line)
+
+	args := strings.Fields(line)
+	switch args[0] {
+	case "exit", "quit":
+		return errReplExit
+	case "help", "?":
+		s.printHelp()
+		return nil
+	case "history":
+		for i, h := range s.history {
+			fmt.Fprintf(s.out, "%5d  %s\n", i+1, h)
+		}
+		return nil
+	}
+
+	verb, ok := replVerbs[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command: %s (try 'help')", args[0])
+	}
+	return verb.fn(ctx, s, args[1:])
+}
+
+func (s *replSession) prompt() string {
+	if s.xrpcc.Auth != nil && s.xrpcc.Auth.Handle != "" {
+		return s.xrpcc.Auth.Handle
+	}
+	return "gosky"
+}
+
+func (s *replSession) printHelp() {
+	var names []string
+	for name := range replVerbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		v := replVerbs[name]
+		fmt.Fprintf(s.out, "  %-36s %s\n", v.usage, v.help)
+	}
+	fmt.Fprintf(s.out, "  %-36s %s\n", "history", "list previous commands; re-run with !N or !!")
+	fmt.Fprintf(s.out, "  %-36s %s\n", "exit", "end the session")
+}
+
+func (s *replSession) loadHistory() error {
+	if s.historyPath == "" {
+		return nil
+	}
+	b, err := os.ReadFile(s.historyPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading history file: %w", err)
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			s.history = append(s.history, line)
+		}
+	}
+	return nil
+}
+
+func (s *replSession) appendHistory(line string) {
+	// don't persist credentials
+	if strings.HasPrefix(line, "login ") {
+		line = "login"
+	}
+	s.history = append(s.history, line)
+	if s.historyPath == "" {
+		return
+	}
+	fi, err := os.OpenFile(s.historyPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		log.Warnw("failed to open history file", "path", s.historyPath, "err", err)
+		return
+	}
+	defer fi.Close()
+	if _, err := fmt.Fprintln(fi, line); err != nil {
+		log.Warnw("failed to write history file", "path", s.historyPath, "err", err)
+	}
+}
+
+func (s *replSession) expandHistory(line string) (string, error) {
+	if len(s.history) == 0 {
+		return "", fmt.Errorf("history is empty")
+	}
+	if line == "!!" {
+		return s.history[len(s.history)-1], nil
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 || n > len(s.history) {
+		return "", fmt.Errorf("no such history entry: %s", line[1:])
+	}
+	return s.history[n-1], nil
+}
+
+// Runs an authenticated request, refreshing the session and retrying once if the access token has expired.
+func (s *replSession) withAuth(ctx context.Context, fn func() error) error {
+	err := fn()
+	if err == nil || s.xrpcc.Auth == nil || !isExpiredToken(err) {
+		return err
+	}
+	if err := s.refreshSession(ctx); err != nil {
+		return fmt.Errorf("refreshing expired session: %w", err)
+	}
+	return fn()
+}
+
+func isExpiredToken(err error) bool {
+	return xrpc.IsErrorName(err, xrpc.ErrNameExpiredToken)
+}
+
+func (s *replSession) refreshSession(ctx context.Context) error {
+	if s.xrpcc.Auth == nil {
+		return fmt.Errorf("not logged in")
+	}
+	// the refresh request is authenticated with the refresh token, not the access token
+	refreshClient := *s.xrpcc
+	refreshClient.Auth = &xrpc.AuthInfo{AccessJwt: s.xrpcc.Auth.RefreshJwt}
+	out, err := comatproto.ServerRefreshSession(ctx, &refreshClient)
+	if err != nil {
+		return err
+	}
+	return s.saveAuth(&xrpc.AuthInfo{
+		AccessJwt:  out.AccessJwt,
+		RefreshJwt: out.RefreshJwt,
+		Handle:     out.Handle,
+		Did:        out.Did,
+	})
+}
+
+func (s *replSession) saveAuth(auth *xrpc.AuthInfo) error {
+	s.xrpcc.Auth = auth
+	if s.authPath == "" {
+		return nil
+	}
+	b, err := json.Marshal(auth)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.authPath, b, 0600)
+}
+
+func (s *replSession) printJSON(v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, string(b))
+	return nil
+}
+
+func replNeedArgs(args []string, names ...string) error {
+	if len(args) < len(names) {
+		return fmt.Errorf("argument %q required at position %d", names[len(args)], len(args)+1)
+	}
+	return nil
+}
+
+func replLogin(ctx context.Context, s *replSession, args []string) error {
+	if err := replNeedArgs(args, "handle", "password"); err != nil {
+		return err
+	}
+	// don't send a stale session along with the login request
+	s.xrpcc.Auth = nil
+	out, err := comatproto.ServerCreateSession(ctx, s.xrpcc, &comatproto.ServerCreateSession_Input{
+		Identifier: args[0],
+		Password:   args[1],
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.saveAuth(&xrpc.AuthInfo{
+		AccessJwt:  out.AccessJwt,
+		RefreshJwt: out.RefreshJwt,
+		Handle:     out.Handle,
+		Did:        out.Did,
+	}); err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "logged in as %s (%s)\n", out.Handle, out.Did)
+	return nil
+}
+
+func replRefresh(ctx context.Context, s *replSession, args []string) error {
+	return s.refreshSession(ctx)
+}
+
+func replWhoami(ctx context.Context, s *replSession, args []string) error {
+	fmt.Fprintf(s.out, "host: %s\n", s.xrpcc.Host)
+	if s.xrpcc.Auth == nil {
+		fmt.Fprintln(s.out, "not logged in")
+		return nil
+	}
+	var out *comatproto.ServerGetSession_Output
+	err := s.withAuth(ctx, func() error {
+		var err error
+		out, err = comatproto.ServerGetSession(ctx, s.xrpcc)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return s.printJSON(out)
+}
+
+func replHost(ctx context.Context, s *replSession, args []string) error {
+	if len(args) > 0 {
+		s.xrpcc.Host = strings.TrimSuffix(args[0], "/")
+	}
+	fmt.Fprintln(s.out, s.xrpcc.Host)
+	return nil
+}
+
+func replGetRecord(ctx context.Context, s *replSession, args []string) error {
+	if err := replNeedArgs(args, "at-uri"); err != nil {
+		return err
+	}
+	aturi, err := syntax.ParseATURI(args[0])
+	if err != nil {
+		return err
+	}
+	if aturi.Collection() == "" || aturi.RecordKey() == "" {
+		return fmt.Errorf("AT-URI must include collection and record key")
+	}
+	var out *comatproto.RepoGetRecord_Output
+	err = s.withAuth(ctx, func() error {
+		var err error
+		out, err = comatproto.RepoGetRecord(ctx, s.xrpcc, "", aturi.Collection().String(), aturi.Authority().String(), aturi.RecordKey().String())
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return s.printJSON(out)
+}
+
+func replResolveHandle(ctx context.Context, s *replSession, args []string) error {
+	if err := replNeedArgs(args, "handle"); err != nil {
+		return err
+	}
+	out, err := comatproto.IdentityResolveHandle(ctx, s.xrpcc, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(s.out, out.Did)
+	return nil
+}
+
+func replIdentity(ctx context.Context, s *replSession, args []string) error {
+	if err := replNeedArgs(args, "handle-or-did"); err != nil {
+		return err
+	}
+	atid, err := syntax.ParseAtIdentifier(args[0])
+	if err != nil {
+		return err
+	}
+	ident, err := s.dir.Lookup(ctx, *atid)
+	if err != nil {
+		return err
+	}
+	return s.printJSON(ident)
+}
+
+func replProfile(ctx context.Context, s *replSession, args []string) error {
+	if err := replNeedArgs(args, "handle-or-did"); err != nil {
+		return err
+	}
+	var out *appbsky.ActorDefs_ProfileViewDetailed
+	err := s.withAuth(ctx, func() error {
+		var err error
+		out, err = appbsky.ActorGetProfile(ctx, s.xrpcc, args[0])
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return s.printJSON(out)
+}
+
+func replSearchPosts(ctx context.Context, s *replSession, args []string) error {
+	if err := replNeedArgs(args, "query"); err != nil {
+		return err
+	}
+	var out *appbsky.FeedSearchPosts_Output
+	err := s.withAuth(ctx, func() error {
+		var err error
+		out, err = appbsky.FeedSearchPosts(ctx, s.xrpcc, "", 25, strings.Join(args, " "))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range out.Posts {
+		text := ""
+		if post, ok := p.Record.Val.(*appbsky.FeedPost); ok {
+			text = strings.ReplaceAll(post.Text, "\n", " ")
+		}
+		fmt.Fprintf(s.out, "%s\t@%s\t%s\n", p.Uri, p.Author.Handle, text)
+	}
+	return nil
+}
+
+func replSearchActors(ctx context.Context, s *replSession, args []string) error {
+	if err := replNeedArgs(args, "query"); err != nil {
+		return err
+	}
+	var out *appbsky.ActorSearchActors_Output
+	err := s.withAuth(ctx, func() error {
+		var err error
+		out, err = appbsky.ActorSearchActors(ctx, s.xrpcc, "", 25, strings.Join(args, " "), "")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for _, a := range out.Actors {
+		name := ""
+		if a.DisplayName != nil {
+			name = *a.DisplayName
+		}
+		fmt.Fprintf(s.out, "%s\t@%s\t%s\n", a.Did, a.Handle, name)
+	}
+	return nil
+}
+
+func replCall(ctx context.Context, s *replSession, args []string) error {
+	if err := replNeedArgs(args, "nsid"); err != nil {
+		return err
+	}
+	if _, err := syntax.ParseNSID(args[0]); err != nil {
+		return err
+	}
+	params := make(map[string]interface{})
+	for _, kv := range args[1:] {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return fmt.Errorf("params must be in the form <param>=<value>: %s", kv)
+		}
+		params[k] = v
+	}
+	var out json.RawMessage
+	err := s.withAuth(ctx, func() error {
+		return s.xrpcc.Do(ctx, xrpc.Query, "", args[0], params, nil, &out)
+	})
+	if err != nil {
+		return err
+	}
+	return s.printJSON(out)
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Fake XRPC host, which resolves any handle to a fixed DID, rejects logins, and echoes the params of other queries.
+func testReplSession(t *testing.T) (*replSession, *bytes.Buffer) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/xrpc/com.atproto.identity.resolveHandle":
+			json.NewEncoder(w).Encode(map[string]string{"did": "did:plc:abc123"})
+		case "/xrpc/com.atproto.server.createSession":
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "AuthenticationRequired", "message": "Invalid identifier or password"})
+		default:
+			params := map[string]string{"nsid": strings.TrimPrefix(r.URL.Path, "/xrpc/")}
+			for k := range r.URL.Query() {
+				params[k] = r.URL.Query().Get(k)
+			}
+			json.NewEncoder(w).Encode(params)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	var out bytes.Buffer
+	return &replSession{
+		xrpcc:       &xrpc.Client{Host: srv.URL},
+		historyPath: filepath.Join(t.TempDir(), "history"),
+		out:         &out,
+	}, &out
+}
+
+func TestReplDispatch(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	s, out := testReplSession(t)
+
+	assert.NoError(s.exec(ctx, "   "))
+	assert.Empty(out.String())
+	assert.Empty(s.history)
+
+	assert.ErrorContains(s.exec(ctx, "frobnicate"), "unknown command: frobnicate")
+	assert.True(errors.Is(s.exec(ctx, "exit"), errReplExit))
+	assert.True(errors.Is(s.exec(ctx, "quit"), errReplExit))
+
+	out.Reset()
+	assert.NoError(s.exec(ctx, "help"))
+	assert.Contains(out.String(), "resolve <handle>")
+	assert.Contains(out.String(), "history")
+
+	out.Reset()
+	assert.NoError(s.exec(ctx, "resolve alice.example.com"))
+	assert.Equal("did:plc:abc123\n", out.String())
+	assert.ErrorContains(s.exec(ctx, "resolve"), `argument "handle" required at position 1`)
+
+	out.Reset()
+	assert.NoError(s.exec(ctx, "call com.example.echo limit=5 q=cats"))
+	var echoed map[string]string
+	assert.NoError(json.Unmarshal(out.Bytes(), &echoed))
+	assert.Equal(map[string]string{"nsid": "com.example.echo", "limit": "5", "q": "cats"}, echoed)
+	assert.ErrorContains(s.exec(ctx, "call com.example.echo cats"), "params must be in the form")
+	assert.Error(s.exec(ctx, "call not-an-nsid"))
+
+	out.Reset()
+	assert.NoError(s.exec(ctx, "host https://pds.example.com/"))
+	assert.Equal("https://pds.example.com", s.xrpcc.Host)
+}
+
+func TestReplHistory(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	s, out := testReplSession(t)
+
+	assert.ErrorContains(s.exec(ctx, "!!"), "history is empty")
+
+	assert.NoError(s.exec(ctx, "resolve alice.example.com"))
+	// credentials are not recorded
+	assert.ErrorContains(s.exec(ctx, "login alice.example.com hunter2"), "AuthenticationRequired")
+	assert.NoError(s.exec(ctx, "whoami"))
+	assert.Equal([]string{"resolve alice.example.com", "login", "whoami"}, s.history)
+
+	out.Reset()
+	assert.NoError(s.exec(ctx, "!1"))
+	assert.Equal("resolve alice.example.com\ndid:plc:abc123\n", out.String())
+	out.Reset()
+	assert.NoError(s.exec(ctx, "!!"))
+	assert.Equal("resolve alice.example.com\ndid:plc:abc123\n", out.String())
+	assert.ErrorContains(s.exec(ctx, "!9"), "no such history entry: 9")
+	assert.ErrorContains(s.exec(ctx, "!x"), "no such history entry: x")
+
+	out.Reset()
+	assert.NoError(s.exec(ctx, "history"))
+	assert.Contains(out.String(), "    2  login\n")
+
+	// persisted, and loaded by a new session
+	b, err := os.ReadFile(s.historyPath)
+	assert.NoError(err)
+	assert.NotContains(string(b), "hunter2")
+	next := &replSession{historyPath: s.historyPath}
+	assert.NoError(next.loadHistory())
+	assert.Equal(s.history, next.history)
+}
+
+func TestReplRun(t *testing.T) {
+	assert := assert.New(t)
+	s, out := testReplSession(t)
+
+	in := strings.NewReader("resolve alice.example.com\nfrobnicate\nexit\nresolve bob.example.com\n")
+	assert.NoError(s.run(context.Background(), in))
+	assert.Equal("gosky> did:plc:abc123\ngosky> error: unknown command: frobnicate (try 'help')\ngosky> ", out.String())
+}
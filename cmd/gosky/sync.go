@@ -3,11 +3,13 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/repo"
 	"github.com/bluesky-social/indigo/util/cliutil"
 
 	cli "github.com/urfave/cli/v2"
@@ -31,6 +33,10 @@ var syncGetRepoCmd = &cli.Command{
 		&cli.StringFlag{
 			Name: "host",
 		},
+		&cli.StringSliceFlag{
+			Name:  "collection",
+			Usage: "only keep the records of this collection (NSID), with the MST nodes proving they're all of them; can be repeated",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		ctx := context.Background()
@@ -67,17 +73,39 @@ var syncGetRepoCmd = &cli.Command{
 		}
 
 		log.Infof("downloading from %s to: %s", xrpcc.Host, carPath)
-		repoBytes, err := comatproto.SyncGetRepo(ctx, xrpcc, ident.DID.String(), "")
+		repoStream, err := comatproto.SyncGetRepoStream(ctx, xrpcc, ident.DID.String(), "")
 		if err != nil {
 			return err
 		}
+		defer repoStream.Close()
+
+		// copies the repo, or exports the collections
+		writeRepo := func(w io.Writer) error {
+			_, err := io.Copy(w, repoStream)
+			return err
+		}
+		if colls := cctx.StringSlice("collection"); len(colls) > 0 {
+			writeRepo = func(w io.Writer) error {
+				r, err := repo.ReadRepoFromCar(ctx, repoStream)
+				if err != nil {
+					return err
+				}
+				return r.ExportCollections(ctx, colls, w)
+			}
+		}
 
 		if carPath == "-" {
-			_, err = os.Stdout.Write(repoBytes)
+			return writeRepo(os.Stdout)
+		}
+		f, err := os.Create(carPath)
+		if err != nil {
+			return err
+		}
+		if err := writeRepo(f); err != nil {
+			f.Close()
 			return err
-		} else {
-			return os.WriteFile(carPath, repoBytes, 0666)
 		}
+		return f.Close()
 	},
 }
 
@@ -4,9 +4,8 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"net/http"
-	"net/url"
 	"strings"
+	"time"
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/atproto/syntax"
@@ -15,44 +14,18 @@ import (
 	lexutil "github.com/bluesky-social/indigo/lex/util"
 
 	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/events/firehose"
 	"github.com/bluesky-social/indigo/repo"
 	"github.com/bluesky-social/indigo/repomgr"
 	"github.com/carlmjohnson/versioninfo"
-	"github.com/gorilla/websocket"
 )
 
 func (s *Server) RunConsumer(ctx context.Context) error {
-
-	// TODO: persist cursor in a database or local disk
-	cur, err := s.ReadLastCursor(ctx)
-	if err != nil {
-		return err
-	}
-
-	dialer := websocket.DefaultDialer
-	u, err := url.Parse(s.bgshost)
-	if err != nil {
-		return fmt.Errorf("invalid bgshost URI: %w", err)
-	}
-	u.Path = "xrpc/com.atproto.sync.subscribeRepos"
-	if cur != 0 {
-		u.RawQuery = fmt.Sprintf("cursor=%d", cur)
-	}
-	s.logger.Info("subscribing to repo event stream", "upstream", s.bgshost, "cursor", cur)
-	con, _, err := dialer.Dial(u.String(), http.Header{
-		"User-Agent": []string{fmt.Sprintf("hepa/%s", versioninfo.Short())},
-	})
-	if err != nil {
-		return fmt.Errorf("subscribing to firehose failed (dialing): %w", err)
-	}
-
 	rsc := &events.RepoStreamCallbacks{
 		RepoCommit: func(evt *comatproto.SyncSubscribeRepos_Commit) error {
-			s.lastSeq = evt.Seq
 			return s.HandleRepoCommit(ctx, evt)
 		},
 		RepoHandle: func(evt *comatproto.SyncSubscribeRepos_Handle) error {
-			s.lastSeq = evt.Seq
 			did, err := syntax.ParseDID(evt.Did)
 			if err != nil {
 				s.logger.Error("bad DID in RepoHandle event", "did", evt.Did, "handle", evt.Handle, "seq", evt.Seq, "err", err)
@@ -64,7 +37,6 @@ func (s *Server) RunConsumer(ctx context.Context) error {
 			return nil
 		},
 		RepoMigrate: func(evt *comatproto.SyncSubscribeRepos_Migrate) error {
-			s.lastSeq = evt.Seq
 			did, err := syntax.ParseDID(evt.Did)
 			if err != nil {
 				s.logger.Error("bad DID in RepoMigrate event", "did", evt.Did, "seq", evt.Seq, "err", err)
@@ -75,19 +47,49 @@ func (s *Server) RunConsumer(ctx context.Context) error {
 			}
 			return nil
 		},
+		RepoIdentity: func(evt *comatproto.SyncSubscribeRepos_Identity) error {
+			did, err := syntax.ParseDID(evt.Did)
+			if err != nil {
+				s.logger.Error("bad DID in RepoIdentity event", "did", evt.Did, "seq", evt.Seq, "err", err)
+				return nil
+			}
+			// the event signals that any cached identity is stale
+			if err := s.engine.PurgeAccountCaches(ctx, did); err != nil {
+				s.logger.Error("failed to purge identity cache", "did", evt.Did, "err", err)
+			}
+			if err := s.engine.ProcessIdentityEvent(ctx, "identity", did); err != nil {
+				s.logger.Error("processing identity update failed", "did", evt.Did, "seq", evt.Seq, "err", err)
+			}
+			return nil
+		},
+		RepoAccount: func(evt *comatproto.SyncSubscribeRepos_Account) error {
+			if err := s.engine.ProcessAccountEvent(ctx, evt); err != nil {
+				s.logger.Error("processing account status update failed", "did", evt.Did, "seq", evt.Seq, "err", err)
+			}
+			return nil
+		},
 		// TODO: other event callbacks as needed
 	}
 
-	// start at higher parallelism (somewhat arbitrary)
-	scaleSettings := autoscaling.DefaultAutoscaleSettings()
-	scaleSettings.Concurrency = 6
-	return events.HandleRepoStream(
-		ctx, con, autoscaling.NewScheduler(
-			scaleSettings,
-			s.bgshost,
-			rsc.EventHandler,
-		),
-	)
+	cfg := firehose.DefaultConsumerConfig()
+	cfg.UserAgent = fmt.Sprintf("hepa/%s", versioninfo.Short())
+	cfg.Logger = s.logger
+	if s.rdb != nil {
+		cfg.Cursors = &firehose.RedisCursorStore{
+			Client: s.rdb,
+			Key:    func(string) string { return cursorKey },
+			TTL:    14 * 24 * time.Hour,
+		}
+	} else {
+		s.logger.Info("redis not configured, the firehose cursor is not persisted")
+	}
+	cfg.NewScheduler = func(ident string, do func(context.Context, *events.XRPCStreamEvent) error) events.Scheduler {
+		// start at higher parallelism (somewhat arbitrary)
+		scaleSettings := autoscaling.DefaultAutoscaleSettings()
+		scaleSettings.Concurrency = 6
+		return autoscaling.NewScheduler(scaleSettings, ident, do)
+	}
+	return firehose.NewConsumer(s.bgshost, rsc.EventHandler, cfg).Run(ctx)
 }
 
 // TODO: move this to a "ParsePath" helper in syntax package?
@@ -7,12 +7,17 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/automod"
 	"github.com/bluesky-social/indigo/automod/capture"
 	"github.com/bluesky-social/indigo/automod/directory"
+	"github.com/bluesky-social/indigo/automod/flagstore"
+	"github.com/bluesky-social/indigo/automod/rules"
+	"github.com/bluesky-social/indigo/automod/setstore"
 
 	"github.com/carlmjohnson/versioninfo"
 	_ "github.com/joho/godotenv/autoload"
@@ -88,11 +93,125 @@ func run(args []string) error {
 			Value:   100,
 			EnvVars: []string{"HEPA_PLC_RATE_LIMIT"},
 		},
+		&cli.StringSliceFlag{
+			Name:    "dns-resolvers",
+			Usage:   "DNS resolvers for handle resolution, tried in order: DNS-over-HTTPS URLs, 'host:port' of DNS servers, or 'system'",
+			EnvVars: []string{"HEPA_DNS_RESOLVERS"},
+		},
+		&cli.DurationFlag{
+			Name:    "dns-resolver-timeout",
+			Usage:   "timeout of each DNS resolver for handle resolution",
+			Value:   3 * time.Second,
+			EnvVars: []string{"HEPA_DNS_RESOLVER_TIMEOUT"},
+		},
+		&cli.BoolFlag{
+			Name:    "parallel-handle-resolution",
+			Usage:   "resolve handles over DNS and HTTP well-known concurrently",
+			EnvVars: []string{"HEPA_PARALLEL_HANDLE_RESOLUTION"},
+		},
 		&cli.StringFlag{
 			Name:    "sets-json-path",
 			Usage:   "file path of JSON file containing static sets",
 			EnvVars: []string{"HEPA_SETS_JSON_PATH"},
 		},
+		&cli.StringFlag{
+			Name:    "rules-config",
+			Usage:   "file path of YAML or JSON file configuring which rules run, thresholds, and sets",
+			EnvVars: []string{"HEPA_RULES_CONFIG"},
+		},
+		&cli.StringFlag{
+			Name:    "sets-reload-source",
+			Usage:   "file path or URL of JSON file containing sets, which is re-loaded periodically (overrides static sets with the same name)",
+			EnvVars: []string{"HEPA_SETS_RELOAD_SOURCE"},
+		},
+		&cli.DurationFlag{
+			Name:    "sets-reload-interval",
+			Usage:   "how often to re-load sets from --sets-reload-source",
+			Value:   5 * time.Minute,
+			EnvVars: []string{"HEPA_SETS_RELOAD_INTERVAL"},
+		},
+		&cli.BoolFlag{
+			Name:    "shadow",
+			Usage:   "dry-run mode: log moderation actions (and count them in metrics), but don't persist them",
+			EnvVars: []string{"HEPA_SHADOW"},
+		},
+		&cli.IntFlag{
+			Name:    "max-labels-per-minute",
+			Usage:   "rate limit on labels applied (0 for no limit); exceeding any action limit switches to shadow mode for a cooldown period",
+			Value:   automod.DefaultActionLimits().LabelsPerMinute,
+			EnvVars: []string{"HEPA_MAX_LABELS_PER_MINUTE"},
+		},
+		&cli.IntFlag{
+			Name:    "max-reports-per-minute",
+			Usage:   "rate limit on reports created (0 for no limit)",
+			Value:   automod.DefaultActionLimits().ReportsPerMinute,
+			EnvVars: []string{"HEPA_MAX_REPORTS_PER_MINUTE"},
+		},
+		&cli.IntFlag{
+			Name:    "max-takedowns-per-minute",
+			Usage:   "rate limit on takedowns (0 for no limit)",
+			Value:   automod.DefaultActionLimits().TakedownsPerMinute,
+			EnvVars: []string{"HEPA_MAX_TAKEDOWNS_PER_MINUTE"},
+		},
+		&cli.DurationFlag{
+			Name:    "action-limit-cooldown",
+			Usage:   "how long to stay in shadow mode after an action rate limit is exceeded",
+			Value:   automod.DefaultActionLimits().Cooldown,
+			EnvVars: []string{"HEPA_ACTION_LIMIT_COOLDOWN"},
+		},
+		&cli.StringFlag{
+			Name:    "cache-db-url",
+			Usage:   "database URL (eg, 'sqlite://data/hepa/cache.sqlite') for a persistent account metadata cache, which survives restarts. takes precedence over redis for caching",
+			EnvVars: []string{"HEPA_CACHE_DB_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "audit-log-path",
+			Usage:   "local file path to append an NDJSON audit log of all emitted moderation actions",
+			EnvVars: []string{"HEPA_AUDIT_LOG_PATH"},
+		},
+		&cli.StringFlag{
+			Name:    "audit-log-db-url",
+			Usage:   "database URL (eg, 'sqlite://data/hepa/audit.sqlite') for an audit log of all emitted moderation actions. takes precedence over --audit-log-path",
+			EnvVars: []string{"HEPA_AUDIT_LOG_DB_URL"},
+		},
+		&cli.StringSliceFlag{
+			Name:    "audit-log-kafka-brokers",
+			Usage:   "Kafka brokers ('host:port') to publish an audit log of all emitted moderation actions to, as JSON messages keyed by account DID. takes precedence over --audit-log-path",
+			EnvVars: []string{"HEPA_AUDIT_LOG_KAFKA_BROKERS"},
+		},
+		&cli.StringFlag{
+			Name:    "audit-log-kafka-topic",
+			Usage:   "Kafka topic for the audit log",
+			Value:   "automod-audit",
+			EnvVars: []string{"HEPA_AUDIT_LOG_KAFKA_TOPIC"},
+		},
+		&cli.DurationFlag{
+			Name:    "cache-ttl",
+			Usage:   "how long account metadata is cached",
+			Value:   30 * time.Minute,
+			EnvVars: []string{"HEPA_CACHE_TTL"},
+		},
+		&cli.DurationFlag{
+			Name:    "ozone-events-interval",
+			Usage:   "how often to poll the mod service for new moderation events, which are run through moderation event rules (0 to disable; requires mod service admin access)",
+			EnvVars: []string{"HEPA_OZONE_EVENTS_INTERVAL"},
+		},
+		&cli.StringFlag{
+			Name:    "mod-service-did",
+			Usage:   "DID which automod's moderation actions are attributed to by the mod service, so its own moderation events are skipped (defaults to the DID of the --mod-handle account)",
+			EnvVars: []string{"HEPA_MOD_SERVICE_DID"},
+		},
+		&cli.BoolFlag{
+			Name:    "resolve-short-urls",
+			Usage:   "follow redirects of known URL shortener links in posts, so rules can check the destination domain",
+			EnvVars: []string{"HEPA_RESOLVE_SHORT_URLS"},
+		},
+		&cli.DurationFlag{
+			Name:    "url-resolve-timeout",
+			Usage:   "timeout for resolving a single shortened URL",
+			Value:   5 * time.Second,
+			EnvVars: []string{"HEPA_URL_RESOLVE_TIMEOUT"},
+		},
 	}
 
 	app.Commands = []*cli.Command{
@@ -100,6 +219,9 @@ func run(args []string) error {
 		processRecordCmd,
 		processRecentCmd,
 		captureRecentCmd,
+		backfillCmd,
+		evalCapturesCmd,
+		exportFlagsCmd,
 	}
 
 	return app.Run(args)
@@ -111,9 +233,17 @@ func configDirectory(cctx *cli.Context) (identity.Directory, error) {
 		HTTPClient: http.Client{
 			Timeout: time.Second * 15,
 		},
-		PLCLimiter:            rate.NewLimiter(rate.Limit(cctx.Int("plc-rate-limit")), 1),
-		TryAuthoritativeDNS:   true,
-		SkipDNSDomainSuffixes: []string{".bsky.social", ".staging.bsky.dev"},
+		PLCLimiter:               rate.NewLimiter(rate.Limit(cctx.Int("plc-rate-limit")), 1),
+		TryAuthoritativeDNS:      true,
+		SkipDNSDomainSuffixes:    []string{".bsky.social", ".staging.bsky.dev"},
+		ParallelHandleResolution: cctx.Bool("parallel-handle-resolution"),
+	}
+	for _, spec := range cctx.StringSlice("dns-resolvers") {
+		r, err := identity.ParseDNSResolver(spec, cctx.Duration("dns-resolver-timeout"))
+		if err != nil {
+			return nil, err
+		}
+		baseDir.DNSResolvers = append(baseDir.DNSResolvers, r)
 	}
 	var dir identity.Directory
 	if cctx.String("redis-url") != "" {
@@ -121,9 +251,17 @@ func configDirectory(cctx *cli.Context) (identity.Directory, error) {
 		if err != nil {
 			return nil, err
 		}
+		// drop identities purged by other instances (eg, on #identity events) from the local cache layer
+		go func() {
+			if err := rdir.RunInvalidation(context.Background()); err != nil {
+				slog.Error("identity invalidation routine failed", "err", err)
+			}
+		}()
 		dir = rdir
 	} else {
 		cdir := identity.NewCacheDirectory(&baseDir, 1_500_000, time.Hour*24, time.Minute*2)
+		// keep frequently used identities (eg, very active accounts) warm in the cache
+		go cdir.RunPrefetch(context.Background(), identity.PrefetchConfig{})
 		dir = &cdir
 	}
 	return dir, nil
@@ -139,6 +277,17 @@ var runCmd = &cli.Command{
 			Value:   ":3989",
 			EnvVars: []string{"HEPA_METRICS_LISTEN"},
 		},
+		&cli.StringFlag{
+			Name:    "admin-listen",
+			Usage:   "IP or address, and port, to listen on for the automod admin API (only enabled if --admin-token is set)",
+			Value:   ":3990",
+			EnvVars: []string{"HEPA_ADMIN_LISTEN"},
+		},
+		&cli.StringFlag{
+			Name:    "admin-token",
+			Usage:   "bearer token required for the automod admin API (introspection, toggling rules, and adjusting thresholds at runtime)",
+			EnvVars: []string{"HEPA_ADMIN_TOKEN"},
+		},
 		&cli.StringFlag{
 			Name: "slack-webhook-url",
 			// eg: https://hooks.slack.com/services/X1234
@@ -163,16 +312,36 @@ var runCmd = &cli.Command{
 		srv, err := NewServer(
 			dir,
 			Config{
-				BGSHost:         cctx.String("atp-bgs-host"),
-				BskyHost:        cctx.String("atp-bsky-host"),
-				Logger:          logger,
-				ModHost:         cctx.String("atp-mod-host"),
-				ModAdminToken:   cctx.String("mod-admin-token"),
-				ModUsername:     cctx.String("mod-handle"),
-				ModPassword:     cctx.String("mod-password"),
-				SetsFileJSON:    cctx.String("sets-json-path"),
-				RedisURL:        cctx.String("redis-url"),
-				SlackWebhookURL: cctx.String("slack-webhook-url"),
+				BGSHost:              cctx.String("atp-bgs-host"),
+				BskyHost:             cctx.String("atp-bsky-host"),
+				Logger:               logger,
+				ModHost:              cctx.String("atp-mod-host"),
+				ModAdminToken:        cctx.String("mod-admin-token"),
+				ModUsername:          cctx.String("mod-handle"),
+				ModPassword:          cctx.String("mod-password"),
+				SetsFileJSON:         cctx.String("sets-json-path"),
+				RulesConfigPath:      cctx.String("rules-config"),
+				RedisURL:             cctx.String("redis-url"),
+				SlackWebhookURL:      cctx.String("slack-webhook-url"),
+				SetsReloadSource:     cctx.String("sets-reload-source"),
+				SetsReloadInterval:   cctx.Duration("sets-reload-interval"),
+				Shadow:               cctx.Bool("shadow"),
+				CacheDBURL:           cctx.String("cache-db-url"),
+				CacheTTL:             cctx.Duration("cache-ttl"),
+				AuditLogPath:         cctx.String("audit-log-path"),
+				AuditLogDBURL:        cctx.String("audit-log-db-url"),
+				AuditLogKafkaBrokers: cctx.StringSlice("audit-log-kafka-brokers"),
+				AuditLogKafkaTopic:   cctx.String("audit-log-kafka-topic"),
+				OzoneEventsInterval:  cctx.Duration("ozone-events-interval"),
+				ModServiceDID:        cctx.String("mod-service-did"),
+				ResolveShortURLs:     cctx.Bool("resolve-short-urls"),
+				URLResolveTimeout:    cctx.Duration("url-resolve-timeout"),
+				ActionLimits: automod.ActionLimits{
+					LabelsPerMinute:    cctx.Int("max-labels-per-minute"),
+					ReportsPerMinute:   cctx.Int("max-reports-per-minute"),
+					TakedownsPerMinute: cctx.Int("max-takedowns-per-minute"),
+					Cooldown:           cctx.Duration("action-limit-cooldown"),
+				},
 			},
 		)
 		if err != nil {
@@ -187,9 +356,38 @@ var runCmd = &cli.Command{
 			}
 		}()
 
+		// automod admin HTTP API: /admin/*
+		if token := cctx.String("admin-token"); token != "" {
+			go func() {
+				if err := srv.RunAdminAPI(cctx.String("admin-listen"), token); err != nil {
+					slog.Error("failed to start admin API", "error", err)
+					panic(fmt.Errorf("failed to start admin API: %w", err))
+				}
+			}()
+		}
+
 		go func() {
-			if err := srv.RunPersistCursor(ctx); err != nil {
-				slog.Error("cursor routine failed", "err", err)
+			if err := srv.RunReloadSets(ctx); err != nil {
+				slog.Error("sets reload routine failed", "err", err)
+			}
+		}()
+
+		go func() {
+			if err := srv.RunPurgeCache(ctx); err != nil {
+				slog.Error("cache purge routine failed", "err", err)
+			}
+		}()
+
+		go func() {
+			if err := srv.RunOzoneConsumer(ctx); err != nil {
+				slog.Error("moderation event consumer failed", "err", err)
+			}
+		}()
+
+		// prunes in-memory counters (no-op with redis)
+		go func() {
+			if err := srv.engine.RunCounterPurge(ctx, 10*time.Minute); err != nil {
+				slog.Error("counter purge routine failed", "err", err)
 			}
 		}()
 
@@ -225,15 +423,23 @@ func configEphemeralServer(cctx *cli.Context) (*Server, error) {
 	return NewServer(
 		dir,
 		Config{
-			BGSHost:       cctx.String("atp-bgs-host"),
-			BskyHost:      cctx.String("atp-bsky-host"),
-			Logger:        logger,
-			ModHost:       cctx.String("atp-mod-host"),
-			ModAdminToken: cctx.String("mod-admin-token"),
-			ModUsername:   cctx.String("mod-handle"),
-			ModPassword:   cctx.String("mod-password"),
-			SetsFileJSON:  cctx.String("sets-json-path"),
-			RedisURL:      cctx.String("redis-url"),
+			BGSHost:         cctx.String("atp-bgs-host"),
+			BskyHost:        cctx.String("atp-bsky-host"),
+			Logger:          logger,
+			ModHost:         cctx.String("atp-mod-host"),
+			ModAdminToken:   cctx.String("mod-admin-token"),
+			ModUsername:     cctx.String("mod-handle"),
+			ModPassword:     cctx.String("mod-password"),
+			SetsFileJSON:    cctx.String("sets-json-path"),
+			RulesConfigPath: cctx.String("rules-config"),
+			RedisURL:        cctx.String("redis-url"),
+			Shadow:          cctx.Bool("shadow"),
+			ActionLimits: automod.ActionLimits{
+				LabelsPerMinute:    cctx.Int("max-labels-per-minute"),
+				ReportsPerMinute:   cctx.Int("max-reports-per-minute"),
+				TakedownsPerMinute: cctx.Int("max-takedowns-per-minute"),
+				Cooldown:           cctx.Duration("action-limit-cooldown"),
+			},
 		},
 	)
 }
@@ -335,3 +541,219 @@ var captureRecentCmd = &cli.Command{
 		return nil
 	},
 }
+
+var exportFlagsCmd = &cli.Command{
+	Name:  "export-flags",
+	Usage: "dump all flagged accounts and records (with flag names and timestamps) from redis as NDJSON to stdout",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "prefix",
+			Usage: "only export flags with keys (account DIDs or record AT-URIs) starting with this prefix (eg, 'did:web:' or 'at://')",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := context.Background()
+		if cctx.String("redis-url") == "" {
+			return fmt.Errorf("flags are only persisted in redis; --redis-url is required")
+		}
+		flags, err := flagstore.NewRedisFlagStore(cctx.String("redis-url"))
+		if err != nil {
+			return fmt.Errorf("initializing redis flagstore: %v", err)
+		}
+
+		// entries are keyed by account DID or record AT-URI
+		enc := json.NewEncoder(os.Stdout)
+		cursor := ""
+		for {
+			entries, next, err := flags.ListFlags(ctx, cctx.String("prefix"), cursor, 1000)
+			if err != nil {
+				return err
+			}
+			for _, e := range entries {
+				if err := enc.Encode(e); err != nil {
+					return err
+				}
+			}
+			if next == "" {
+				return nil
+			}
+			cursor = next
+		}
+	},
+}
+
+var backfillCmd = &cli.Command{
+	Name:      "backfill",
+	Usage:     "replay historical records for accounts through the rules, eg to retroactively evaluate new rules",
+	ArgsUsage: `<at-identifier>...`,
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:  "days",
+			Usage: "only process records created in the last N days (based on record key timestamp; 0 for all records)",
+			Value: 7,
+		},
+		&cli.StringSliceFlag{
+			Name:  "collection",
+			Usage: "only process records in this collection (can be repeated; default all collections)",
+		},
+		&cli.StringFlag{
+			Name:  "accounts-file",
+			Usage: "file with additional account identifiers (handles or DIDs) to process, one per line",
+		},
+		&cli.StringSliceFlag{
+			Name:  "car",
+			Usage: "process a local repo CAR file (snapshot), instead of fetching repos from PDS instances (can be repeated)",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		ctx := context.Background()
+
+		opts := capture.BackfillOptions{
+			Collections: cctx.StringSlice("collection"),
+		}
+		if days := cctx.Int("days"); days > 0 {
+			opts.Since = time.Now().Add(-time.Duration(days) * 24 * time.Hour)
+		}
+
+		ids := cctx.Args().Slice()
+		if path := cctx.String("accounts-file"); path != "" {
+			b, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			for _, line := range strings.Split(string(b), "\n") {
+				if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+					ids = append(ids, line)
+				}
+			}
+		}
+		carPaths := cctx.StringSlice("car")
+		if len(ids) == 0 && len(carPaths) == 0 {
+			return fmt.Errorf("expected at least one AT identifier (handle or DID) or CAR file")
+		}
+
+		srv, err := configEphemeralServer(cctx)
+		if err != nil {
+			return err
+		}
+
+		var total capture.BackfillResult
+		add := func(res *capture.BackfillResult) {
+			if res != nil {
+				total.Processed += res.Processed
+				total.Skipped += res.Skipped
+				total.Failed += res.Failed
+			}
+		}
+		for _, p := range carPaths {
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			res, err := capture.ProcessRepoCAR(ctx, srv.engine, f, opts)
+			f.Close()
+			if err != nil {
+				slog.Error("failed to backfill CAR file", "path", p, "err", err)
+			}
+			add(res)
+		}
+		for _, raw := range ids {
+			atid, err := syntax.ParseAtIdentifier(raw)
+			if err != nil {
+				slog.Error("not a valid handle or DID", "identifier", raw, "err", err)
+				continue
+			}
+			res, err := capture.FetchAndProcessRepo(ctx, srv.engine, *atid, opts)
+			if err != nil {
+				slog.Error("failed to backfill account", "identifier", raw, "err", err)
+			}
+			add(res)
+		}
+		slog.Info("backfill complete", "processed", total.Processed, "skipped", total.Skipped, "failed", total.Failed)
+		return nil
+	},
+}
+
+var evalCapturesCmd = &cli.Command{
+	Name:      "eval-captures",
+	Usage:     "run two rule configurations over captured accounts, dump JSON comparison report to stdout",
+	ArgsUsage: `<capture-file>...`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "baseline-rules-config",
+			Usage: "file path of YAML or JSON rules config, for the baseline configuration (default rules if not set)",
+		},
+		&cli.StringFlag{
+			Name:  "candidate-rules-config",
+			Usage: "file path of YAML or JSON rules config, for the candidate configuration (default rules if not set)",
+		},
+		&cli.StringFlag{
+			Name:  "baseline-sets-json",
+			Usage: "file path of JSON file containing static sets, for the baseline configuration",
+		},
+		&cli.StringFlag{
+			Name:  "candidate-sets-json",
+			Usage: "file path of JSON file containing static sets, for the candidate configuration",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() == 0 {
+			return fmt.Errorf("expected at least one capture file argument")
+		}
+		var captures []capture.AccountCapture
+		for _, p := range cctx.Args().Slice() {
+			c, err := capture.LoadCapture(p)
+			if err != nil {
+				return err
+			}
+			captures = append(captures, *c)
+		}
+
+		// rule thresholds are process-wide, so each configuration starts from the defaults
+		defaultThresholds := rules.Thresholds()
+		configs := []struct{ rulesPath, setsPath string }{
+			{cctx.String("baseline-rules-config"), cctx.String("baseline-sets-json")},
+			{cctx.String("candidate-rules-config"), cctx.String("candidate-sets-json")},
+		}
+		var results []*capture.EvalResult
+		for _, c := range configs {
+			for name, val := range defaultThresholds {
+				if err := rules.SetThreshold(name, val); err != nil {
+					return err
+				}
+			}
+			sets := setstore.NewMemSetStore()
+			if c.setsPath != "" {
+				if err := sets.LoadFromFileJSON(c.setsPath); err != nil {
+					return fmt.Errorf("loading sets JSON (%s): %v", c.setsPath, err)
+				}
+			}
+			ruleset := rules.DefaultRules()
+			if c.rulesPath != "" {
+				rc, err := rules.LoadRulesConfig(c.rulesPath)
+				if err != nil {
+					return fmt.Errorf("loading rules config (%s): %v", c.rulesPath, err)
+				}
+				ruleset, err = rc.RuleSet()
+				if err != nil {
+					return fmt.Errorf("invalid rules config (%s): %v", c.rulesPath, err)
+				}
+				rc.ApplySets(sets)
+			}
+			res, err := capture.EvalCaptures(ruleset, sets, captures)
+			if err != nil {
+				return err
+			}
+			results = append(results, res)
+		}
+
+		report := capture.CompareEvalResults(results[0], results[1])
+		outJSON, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(string(outJSON))
+		return nil
+	},
+}
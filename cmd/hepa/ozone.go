@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var ozoneCursorKey = "hepa/ozoneEventID"
+var ozoneLeaseKey = "hepa/ozonePoll"
+
+// Polls the moderation service for new moderation events (eg, actions by human moderators), and runs them through the engine's moderation event rules.
+//
+// Events created by automod itself (by the configured mod service DID) are skipped, to avoid feedback loops. The ID of the last processed event is persisted in redis (if configured); with no prior state, processing starts after the most recent event.
+func (s *Server) RunOzoneConsumer(ctx context.Context) error {
+	if s.engine.AdminClient == nil || s.ozoneEventsInterval <= 0 {
+		return nil
+	}
+
+	if s.ozoneServiceDID == "" {
+		return fmt.Errorf("polling moderation events requires the mod service DID, to skip automod's own events")
+	}
+
+	lastID, err := s.readOzoneCursor(ctx)
+	if err != nil {
+		return err
+	}
+	s.logger.Info("polling moderation events", "host", s.engine.AdminClient.Host, "lastID", lastID)
+
+	ticker := time.NewTicker(s.ozoneEventsInterval)
+	defer ticker.Stop()
+	for {
+		if s.acquireOzoneLease(ctx) {
+			// another instance may have made progress since we last polled
+			if cur, err := s.readOzoneCursor(ctx); err == nil && cur > lastID {
+				lastID = cur
+			}
+			lastID, err = s.pollOzoneEvents(ctx, lastID)
+			if err != nil {
+				s.logger.Error("failed to poll moderation events", "err", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Fetches and processes all events newer than lastID, oldest first. Returns the ID of the last processed event.
+func (s *Server) pollOzoneEvents(ctx context.Context, lastID int64) (int64, error) {
+	xrpcc := s.engine.AdminClient
+
+	// events are returned newest first; page back until reaching already-processed events
+	var pending []*comatproto.AdminDefs_ModEventView
+	cursor := ""
+	for {
+		resp, err := comatproto.AdminQueryModerationEvents(ctx, xrpcc, "", cursor, false, 100, "desc", "", nil)
+		if err != nil {
+			return lastID, err
+		}
+		if lastID == 0 {
+			// no prior state: skip the backlog
+			if len(resp.Events) > 0 {
+				lastID = resp.Events[0].Id
+				return lastID, s.persistOzoneCursor(ctx, lastID)
+			}
+			return lastID, nil
+		}
+		done := false
+		for _, evt := range resp.Events {
+			if evt.Id <= lastID {
+				done = true
+				break
+			}
+			pending = append(pending, evt)
+		}
+		if done || resp.Cursor == nil || *resp.Cursor == "" || len(resp.Events) == 0 {
+			break
+		}
+		cursor = *resp.Cursor
+	}
+	if len(pending) == 0 {
+		return lastID, nil
+	}
+
+	for i := len(pending) - 1; i >= 0; i-- {
+		evt := pending[i]
+		if evt.CreatedBy != s.ozoneServiceDID.String() {
+			if err := s.engine.ProcessOzoneEvent(ctx, evt); err != nil {
+				s.logger.Error("processing moderation event failed", "modEventID", evt.Id, "err", err)
+			}
+		}
+		lastID = evt.Id
+	}
+	return lastID, s.persistOzoneCursor(ctx, lastID)
+}
+
+// When running multiple instances, only one should poll for each interval, to avoid processing events multiple times. Returns true if this instance should poll.
+func (s *Server) acquireOzoneLease(ctx context.Context) bool {
+	if s.engine.Locks == nil {
+		return true
+	}
+	ok, err := s.engine.Locks.Acquire(ctx, ozoneLeaseKey, s.ozoneEventsInterval)
+	if err != nil {
+		s.logger.Error("failed to acquire moderation event polling lease", "err", err)
+		return false
+	}
+	return ok
+}
+
+func (s *Server) readOzoneCursor(ctx context.Context) (int64, error) {
+	// if redis isn't configured, just skip
+	if s.rdb == nil {
+		return 0, nil
+	}
+	val, err := s.rdb.Get(ctx, ozoneCursorKey).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return val, err
+}
+
+func (s *Server) persistOzoneCursor(ctx context.Context, lastID int64) error {
+	// if redis isn't configured, just skip
+	if s.rdb == nil {
+		return nil
+	}
+	return s.rdb.Set(ctx, ozoneCursorKey, lastID, 14*24*time.Hour).Err()
+}
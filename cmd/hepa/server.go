@@ -11,13 +11,20 @@ import (
 
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
 	"github.com/bluesky-social/indigo/automod"
+	"github.com/bluesky-social/indigo/automod/adminapi"
+	"github.com/bluesky-social/indigo/automod/auditlog"
 	"github.com/bluesky-social/indigo/automod/cachestore"
 	"github.com/bluesky-social/indigo/automod/countstore"
 	"github.com/bluesky-social/indigo/automod/flagstore"
+	"github.com/bluesky-social/indigo/automod/hashstore"
+	"github.com/bluesky-social/indigo/automod/lockstore"
 	"github.com/bluesky-social/indigo/automod/rules"
 	"github.com/bluesky-social/indigo/automod/setstore"
+	"github.com/bluesky-social/indigo/automod/urlresolve"
 	"github.com/bluesky-social/indigo/util"
+	"github.com/bluesky-social/indigo/util/cliutil"
 	"github.com/bluesky-social/indigo/xrpc"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -29,7 +36,14 @@ type Server struct {
 	logger  *slog.Logger
 	engine  *automod.Engine
 	rdb     *redis.Client
-	lastSeq int64
+
+	// optional; periodically re-loads sets from a file or URL
+	setsReloader       *setstore.ReloadingSetStore
+	setsReloadInterval time.Duration
+	sqlCache           *cachestore.SQLCacheStore
+	// how often to poll for moderation events (zero to disable)
+	ozoneEventsInterval time.Duration
+	ozoneServiceDID     syntax.DID
 }
 
 type Config struct {
@@ -40,9 +54,33 @@ type Config struct {
 	ModUsername     string
 	ModPassword     string
 	SetsFileJSON    string
+	RulesConfigPath string
+	// file path or URL of JSON sets, re-loaded periodically (optional)
+	SetsReloadSource   string
+	SetsReloadInterval time.Duration
+	// if true, moderation actions are only logged, not persisted
+	Shadow bool
+	// per-minute moderation action limits (zero for no limit)
+	ActionLimits    automod.ActionLimits
 	RedisURL        string
 	SlackWebhookURL string
-	Logger          *slog.Logger
+	// database URL (eg, "sqlite://data/hepa/cache.sqlite") for a persistent account metadata cache. takes precedence over redis for caching (optional)
+	CacheDBURL string
+	CacheTTL   time.Duration
+	// NDJSON file path, or database URL, for an audit log of emitted moderation actions (optional)
+	AuditLogPath  string
+	AuditLogDBURL string
+	// Kafka brokers and topic for an audit log (optional; used if AuditLogDBURL is not set)
+	AuditLogKafkaBrokers []string
+	AuditLogKafkaTopic   string
+	// how often to poll the mod service for moderation events, for moderation event rules (zero to disable)
+	OzoneEventsInterval time.Duration
+	// DID which automod's own moderation events are created by, to skip them when polling (optional; defaults to the DID of the mod service login)
+	ModServiceDID string
+	// if true, links to known URL shorteners are resolved, so rules can check the destination domain
+	ResolveShortURLs  bool
+	URLResolveTimeout time.Duration
+	Logger            *slog.Logger
 }
 
 func NewServer(dir identity.Directory, config Config) (*Server, error) {
@@ -62,7 +100,6 @@ func NewServer(dir identity.Directory, config Config) (*Server, error) {
 	var xrpcc *xrpc.Client
 	if config.ModAdminToken != "" {
 		xrpcc = &xrpc.Client{
-			Client:     util.RobustHTTPClient(),
 			Host:       config.ModHost,
 			AdminToken: &config.ModAdminToken,
 			Auth:       &xrpc.AuthInfo{},
@@ -81,6 +118,17 @@ func NewServer(dir identity.Directory, config Config) (*Server, error) {
 		xrpcc.Auth.Handle = auth.Handle
 	}
 
+	var ozoneServiceDID syntax.DID
+	if config.ModServiceDID != "" {
+		did, err := syntax.ParseDID(config.ModServiceDID)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mod service DID: %v", err)
+		}
+		ozoneServiceDID = did
+	} else if xrpcc != nil && xrpcc.Auth.Did != "" {
+		ozoneServiceDID = syntax.DID(xrpcc.Auth.Did)
+	}
+
 	sets := setstore.NewMemSetStore()
 	if config.SetsFileJSON != "" {
 		if err := sets.LoadFromFileJSON(config.SetsFileJSON); err != nil {
@@ -90,9 +138,39 @@ func NewServer(dir identity.Directory, config Config) (*Server, error) {
 		}
 	}
 
+	ruleset := rules.DefaultRules()
+	if config.RulesConfigPath != "" {
+		rc, err := rules.LoadRulesConfig(config.RulesConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading rules config: %v", err)
+		}
+		ruleset, err = rc.RuleSet()
+		if err != nil {
+			return nil, fmt.Errorf("invalid rules config: %v", err)
+		}
+		rc.ApplySets(sets)
+		logger.Info("loaded rules config", "path", config.RulesConfigPath)
+	}
+
+	var setStore setstore.SetStore = sets
+	var setsReloader *setstore.ReloadingSetStore
+	if config.SetsReloadSource != "" {
+		setsReloader = setstore.NewReloadingSetStore(config.SetsReloadSource, sets)
+		setsReloader.Client = util.RobustHTTPClient()
+		setsReloader.Logger = logger
+		setStore = setsReloader
+	}
+
+	cacheTTL := config.CacheTTL
+	if cacheTTL <= 0 {
+		cacheTTL = 30 * time.Minute
+	}
+
 	var counters countstore.CountStore
 	var cache cachestore.CacheStore
 	var flags flagstore.FlagStore
+	var hashes hashstore.HashStore
+	var locks lockstore.LockStore
 	var rdb *redis.Client
 	if config.RedisURL != "" {
 		// generic client, for cursor state
@@ -113,7 +191,7 @@ func NewServer(dir identity.Directory, config Config) (*Server, error) {
 		}
 		counters = cnt
 
-		csh, err := cachestore.NewRedisCacheStore(config.RedisURL, 30*time.Minute)
+		csh, err := cachestore.NewRedisCacheStore(config.RedisURL, cacheTTL)
 		if err != nil {
 			return nil, fmt.Errorf("initializing redis cachestore: %v", err)
 		}
@@ -124,26 +202,95 @@ func NewServer(dir identity.Directory, config Config) (*Server, error) {
 			return nil, fmt.Errorf("initializing redis flagstore: %v", err)
 		}
 		flags = flg
+
+		hsh, err := hashstore.NewRedisHashStore(config.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("initializing redis hashstore: %v", err)
+		}
+		hashes = hsh
+
+		// lets multiple instances share the same redis without duplicating moderation actions
+		lck, err := lockstore.NewRedisLockStore(config.RedisURL)
+		if err != nil {
+			return nil, fmt.Errorf("initializing redis lockstore: %v", err)
+		}
+		locks = lck
 	} else {
 		counters = countstore.NewMemCountStore()
-		cache = cachestore.NewMemCacheStore(5_000, 30*time.Minute)
+		cache = cachestore.NewMemCacheStore(5_000, cacheTTL)
 		flags = flagstore.NewMemFlagStore()
+		hashes = hashstore.NewMemHashStore()
+	}
+
+	var sqlCache *cachestore.SQLCacheStore
+	if config.CacheDBURL != "" {
+		db, err := cliutil.SetupDatabase(config.CacheDBURL, 4)
+		if err != nil {
+			return nil, fmt.Errorf("opening cache database: %v", err)
+		}
+		sqlCache, err = cachestore.NewSQLCacheStore(db, cacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("initializing sql cachestore: %v", err)
+		}
+		cache = sqlCache
+	}
+
+	var auditLog auditlog.Sink
+	if config.AuditLogDBURL != "" {
+		db, err := cliutil.SetupDatabase(config.AuditLogDBURL, 4)
+		if err != nil {
+			return nil, fmt.Errorf("opening audit log database: %v", err)
+		}
+		auditLog, err = auditlog.NewSQLSink(db)
+		if err != nil {
+			return nil, fmt.Errorf("initializing audit log: %v", err)
+		}
+	} else if len(config.AuditLogKafkaBrokers) > 0 {
+		if config.AuditLogKafkaTopic == "" {
+			return nil, fmt.Errorf("audit log Kafka topic is required")
+		}
+		auditLog = auditlog.NewPublisherSink(auditlog.NewKafkaPublisher(config.AuditLogKafkaBrokers), config.AuditLogKafkaTopic)
+	} else if config.AuditLogPath != "" {
+		fileSink, err := auditlog.NewFileSink(config.AuditLogPath)
+		if err != nil {
+			return nil, err
+		}
+		auditLog = fileSink
+	}
+
+	var urlResolver *urlresolve.Resolver
+	if config.ResolveShortURLs {
+		opts := urlresolve.DefaultResolverOptions()
+		if config.URLResolveTimeout > 0 {
+			opts.Timeout = config.URLResolveTimeout
+		}
+		urlResolver = urlresolve.NewResolver(opts)
 	}
 
 	engine := automod.Engine{
 		Logger:      logger,
 		Directory:   dir,
 		Counters:    counters,
-		Sets:        sets,
+		Sets:        setStore,
 		Flags:       flags,
+		Hashes:      hashes,
 		Cache:       cache,
-		Rules:       rules.DefaultRules(),
+		Rules:       ruleset,
 		AdminClient: xrpcc,
 		BskyClient: &xrpc.Client{
-			Client: util.RobustHTTPClient(),
-			Host:   config.BskyHost,
+			Host: config.BskyHost,
 		},
 		SlackWebhookURL: config.SlackWebhookURL,
+		Shadow:          config.Shadow,
+		ActionLimiter:   automod.NewActionLimiter(config.ActionLimits),
+		Locks:           locks,
+		URLResolver:     urlResolver,
+		RuleMonitor:     automod.NewRuleMonitor(500),
+		RuleToggles:     automod.NewRuleToggles(),
+		AuditLog:        auditLog,
+	}
+	if err := engine.ValidateRuleSets(); err != nil {
+		return nil, err
 	}
 
 	s := &Server{
@@ -151,46 +298,67 @@ func NewServer(dir identity.Directory, config Config) (*Server, error) {
 		logger:  logger,
 		engine:  &engine,
 		rdb:     rdb,
+
+		setsReloader:        setsReloader,
+		setsReloadInterval:  config.SetsReloadInterval,
+		sqlCache:            sqlCache,
+		ozoneEventsInterval: config.OzoneEventsInterval,
+		ozoneServiceDID:     ozoneServiceDID,
 	}
 
 	return s, nil
 }
 
-func (s *Server) RunMetrics(listen string) error {
-	http.Handle("/metrics", promhttp.Handler())
-	return http.ListenAndServe(listen, nil)
+// Periodically re-loads sets from the configured source. A no-op if no source is configured.
+func (s *Server) RunReloadSets(ctx context.Context) error {
+	if s.setsReloader == nil {
+		return nil
+	}
+	return s.setsReloader.RunReload(ctx, s.setsReloadInterval)
 }
 
-var cursorKey = "hepa/seq"
-
-func (s *Server) ReadLastCursor(ctx context.Context) (int64, error) {
-	// if redis isn't configured, just skip
-	if s.rdb == nil {
-		s.logger.Info("redis not configured, skipping cursor read")
-		return 0, nil
+// Periodically deletes expired entries from the persistent account metadata cache, if configured.
+func (s *Server) RunPurgeCache(ctx context.Context) error {
+	if s.sqlCache == nil {
+		return nil
 	}
-
-	val, err := s.rdb.Get(ctx, cursorKey).Int64()
-	if err == redis.Nil {
-		s.logger.Info("no pre-existing cursor in redis")
-		return 0, nil
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for {
+		n, err := s.sqlCache.PurgeExpired(ctx)
+		if err != nil {
+			s.logger.Error("failed to purge expired cache entries", "err", err)
+		} else {
+			s.logger.Debug("purged expired cache entries", "count", n)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
 	}
-	s.logger.Info("successfully found prior subscription cursor seq in redis", "seq", val)
-	return val, err
 }
 
-func (s *Server) PersistCursor(ctx context.Context) error {
-	// if redis isn't configured, just skip
-	if s.rdb == nil {
-		return nil
-	}
-	if s.lastSeq <= 0 {
-		return nil
+func (s *Server) RunMetrics(listen string) error {
+	http.Handle("/metrics", promhttp.Handler())
+	return http.ListenAndServe(listen, nil)
+}
+
+// Serves the automod admin API on a separate listener from metrics, so it can be firewalled independently.
+func (s *Server) RunAdminAPI(listen, token string) error {
+	api := adminapi.Server{
+		Engine:     s.engine,
+		Token:      token,
+		Thresholds: rules.PackageThresholds{},
+		Logger:     s.logger,
 	}
-	err := s.rdb.Set(ctx, cursorKey, s.lastSeq, 14*24*time.Hour).Err()
-	return err
+	s.logger.Info("starting automod admin API", "listen", listen)
+	return http.ListenAndServe(listen, api.Handler())
 }
 
+// The Redis key of the firehose cursor.
+var cursorKey = "hepa/seq"
+
 // Periodically refreshes the engine's admin XRPC client JWT auth token.
 //
 // Expects to be run in a goroutine, and to be the only running code which touches the auth fields (aka, there is no locking).
@@ -228,33 +396,3 @@ func (s *Server) RunRefreshAdminClient(ctx context.Context) error {
 		}
 	}
 }
-
-// this method runs in a loop, persisting the current cursor state every 5 seconds
-func (s *Server) RunPersistCursor(ctx context.Context) error {
-
-	// if redis isn't configured, just skip
-	if s.rdb == nil {
-		return nil
-	}
-	ticker := time.NewTicker(5 * time.Second)
-	for {
-		select {
-		case <-ctx.Done():
-			if s.lastSeq >= 1 {
-				s.logger.Info("persisting final cursor seq value", "seq", s.lastSeq)
-				err := s.PersistCursor(ctx)
-				if err != nil {
-					s.logger.Error("failed to persist cursor", "err", err, "seq", s.lastSeq)
-				}
-			}
-			return nil
-		case <-ticker.C:
-			if s.lastSeq >= 1 {
-				err := s.PersistCursor(ctx)
-				if err != nil {
-					s.logger.Error("failed to persist cursor", "err", err, "seq", s.lastSeq)
-				}
-			}
-		}
-	}
-}
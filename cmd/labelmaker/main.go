@@ -5,6 +5,8 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/crypto/awskms"
 	"github.com/bluesky-social/indigo/carstore"
 	"github.com/bluesky-social/indigo/labeler"
 	"github.com/bluesky-social/indigo/util/cliutil"
@@ -103,6 +105,16 @@ func run(args []string) error {
 			Usage:   "signing key for labelmaker repo, in JWK serialization",
 			EnvVars: []string{"LABELMAKER_SIGNING_SECRET_KEY_JWK"},
 		},
+		&cli.StringFlag{
+			Name:    "signing-key-aws-kms",
+			Usage:   "ID, ARN, or alias of an AWS KMS key (P-256 or K-256) to sign the labelmaker repo with, instead of a local key. AWS credentials are read from the environment",
+			EnvVars: []string{"LABELMAKER_SIGNING_KEY_AWS_KMS"},
+		},
+		&cli.StringFlag{
+			Name:    "aws-region",
+			Usage:   "AWS region of the KMS signing key",
+			EnvVars: []string{"AWS_REGION"},
+		},
 		&cli.StringFlag{
 			Name:    "bind",
 			Usage:   "IP or address, and port, to listen on for HTTP and WebSocket APIs",
@@ -222,7 +234,16 @@ func run(args []string) error {
 		}
 
 		var serkey *did.PrivKey
-		if signingSecretKeyJwk != "" {
+		var signer crypto.Signer
+		if kmsKey := cctx.String("signing-key-aws-kms"); kmsKey != "" {
+			signer, err = awskms.NewSigner(cctx.Context, awskms.Config{
+				KeyID:  kmsKey,
+				Region: cctx.String("aws-region"),
+			})
+			if err != nil {
+				return err
+			}
+		} else if signingSecretKeyJwk != "" {
 			serkey, err = labeler.ParseSecretKey(signingSecretKeyJwk)
 			if err != nil {
 				return err
@@ -240,6 +261,7 @@ func run(args []string) error {
 			Password:   repoPassword,
 			SigningKey: serkey,
 			UserId:     1,
+			Signer:     signer,
 		}
 
 		srv, err := labeler.NewServer(db, cstore, repoUser, plcURL, blobPdsURL, xrpcProxyURL, xrpcProxyAdminPassword, useWss)
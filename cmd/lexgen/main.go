@@ -73,9 +73,21 @@ func main() {
 		&cli.BoolFlag{
 			Name: "gen-handlers",
 		},
+		&cli.BoolFlag{
+			Name:  "gen-interfaces",
+			Usage: "with --gen-server, generate an interface per method and a RegisterHandlers function, instead of Server methods",
+		},
 		&cli.StringSliceFlag{
 			Name: "types-import",
 		},
+		&cli.BoolFlag{
+			Name:  "params-structs",
+			Usage: "also generate a variant of each query or procedure function which takes its parameters as a struct, with optional ones as pointers",
+		},
+		&cli.BoolFlag{
+			Name:  "validate",
+			Usage: "generate Validate methods on object and union types, checking lengths, enums, ranges and required fields from the lexicons",
+		},
 		&cli.StringFlag{
 			Name:  "package",
 			Value: "schemagen",
@@ -122,6 +134,10 @@ func main() {
 				importmap[parts[0]] = parts[1]
 			}
 
+			if cctx.Bool("gen-interfaces") {
+				return lex.CreateHandlerInterfaces(pkgname, importmap, outdir, schemas)
+			}
+
 			handlers := cctx.Bool("gen-handlers")
 
 			if err := lex.CreateHandlerStub(pkgname, importmap, outdir, schemas, handlers); err != nil {
@@ -142,7 +158,12 @@ func main() {
 
 				fname := filepath.Join(outdir, s.Name()+".go")
 
-				if err := lex.GenCodeForSchema(pkgname, prefix, fname, true, s, defmap, imports); err != nil {
+				opts := lex.GenOptions{
+					ReqCode:       true,
+					ParamsStructs: cctx.Bool("params-structs"),
+					Validate:      cctx.Bool("validate"),
+				}
+				if err := lex.GenCodeForSchemaWithOptions(pkgname, prefix, fname, s, defmap, imports, opts); err != nil {
 					return fmt.Errorf("failed to process schema %q: %w", paths[i], err)
 				}
 			}
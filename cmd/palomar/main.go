@@ -22,6 +22,7 @@ import (
 	"golang.org/x/time/rate"
 
 	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/backfill"
 	"github.com/bluesky-social/indigo/search"
 	"github.com/bluesky-social/indigo/util/cliutil"
 
@@ -74,6 +75,36 @@ func run(args []string) error {
 			Value:   "http://localhost:9200",
 			EnvVars: []string{"ES_HOSTS", "ELASTIC_HOSTS", "OPENSEARCH_URL", "ELASTICSEARCH_URL"},
 		},
+		&cli.IntFlag{
+			Name:    "elastic-max-retries",
+			Usage:   "how many times to retry requests which fail with a network error or a 429, 502, 503, or 504 status",
+			Value:   3,
+			EnvVars: []string{"ES_MAX_RETRIES"},
+		},
+		&cli.DurationFlag{
+			Name:    "elastic-retry-backoff",
+			Usage:   "delay before the first retry, doubled (with jitter) for each subsequent retry",
+			Value:   250 * time.Millisecond,
+			EnvVars: []string{"ES_RETRY_BACKOFF"},
+		},
+		&cli.DurationFlag{
+			Name:    "elastic-retry-max-backoff",
+			Usage:   "upper bound on the delay between retries",
+			Value:   10 * time.Second,
+			EnvVars: []string{"ES_RETRY_MAX_BACKOFF"},
+		},
+		&cli.IntFlag{
+			Name:    "elastic-breaker-threshold",
+			Usage:   "consecutive failed requests which open the circuit breaker, pausing firehose consumption (0 to disable)",
+			Value:   10,
+			EnvVars: []string{"ES_BREAKER_THRESHOLD"},
+		},
+		&cli.DurationFlag{
+			Name:    "elastic-breaker-cooldown",
+			Usage:   "how long the circuit breaker stays open before requests are attempted again",
+			Value:   30 * time.Second,
+			EnvVars: []string{"ES_BREAKER_COOLDOWN"},
+		},
 		&cli.StringFlag{
 			Name:    "es-post-index",
 			Usage:   "ES index for 'post' documents",
@@ -86,12 +117,23 @@ func run(args []string) error {
 			Value:   "palomar_profile",
 			EnvVars: []string{"ES_PROFILE_INDEX"},
 		},
+		&cli.StringFlag{
+			Name:    "es-feed-index",
+			Usage:   "ES index for feed generator and list documents",
+			Value:   "palomar_feed",
+			EnvVars: []string{"ES_FEED_INDEX"},
+		},
 		&cli.StringFlag{
 			Name:    "atp-bgs-host",
 			Usage:   "hostname and port of BGS to subscribe to",
 			Value:   "wss://bsky.social",
 			EnvVars: []string{"ATP_BGS_HOST"},
 		},
+		&cli.StringSliceFlag{
+			Name:    "atp-bgs-fallback-hosts",
+			Usage:   "relays (websocket URLs) to consume the firehose from, in order, if the BGS host is unavailable",
+			EnvVars: []string{"ATP_BGS_FALLBACK_HOSTS"},
+		},
 		&cli.StringFlag{
 			Name:    "atp-plc-host",
 			Usage:   "method, hostname, and port of PLC registry",
@@ -110,6 +152,7 @@ func run(args []string) error {
 		elasticCheckCmd,
 		searchPostCmd,
 		searchProfileCmd,
+		reindexCmd,
 	}
 
 	return app.Run(args)
@@ -140,12 +183,74 @@ var runCmd = &cli.Command{
 			Value:   ":3998",
 			EnvVars: []string{"PALOMAR_METRICS_LISTEN"},
 		},
+		&cli.DurationFlag{
+			Name:    "relay-failback-interval",
+			Usage:   "while consuming from a fallback relay, how often to check whether the primary BGS is available again",
+			Value:   5 * time.Minute,
+			EnvVars: []string{"PALOMAR_RELAY_FAILBACK_INTERVAL"},
+		},
 		&cli.IntFlag{
 			Name:    "bgs-sync-rate-limit",
 			Usage:   "max repo sync (checkout) requests per second to upstream (BGS)",
 			Value:   8,
 			EnvVars: []string{"PALOMAR_BGS_SYNC_RATE_LIMIT"},
 		},
+		&cli.StringFlag{
+			Name:    "backfill-car-dir",
+			Usage:   "directory of repo CAR files (eg, from a bulk export) to backfill from, named by DID; repos not in it are fetched from the relay",
+			EnvVars: []string{"PALOMAR_BACKFILL_CAR_DIR"},
+		},
+		&cli.BoolFlag{
+			Name:    "backfill-stream-repos",
+			Usage:   "index backfilled repos as they are downloaded, with bounded memory, instead of loading each one in memory first; interrupted backfills then start over",
+			EnvVars: []string{"PALOMAR_BACKFILL_STREAM_REPOS"},
+		},
+		&cli.Float64Flag{
+			Name:    "backfill-pds-rate-limit",
+			Usage:   "if positive, backfill repos directly from each account's PDS instead of the relay, at up to this many requests per second to each PDS host",
+			EnvVars: []string{"PALOMAR_BACKFILL_PDS_RATE_LIMIT"},
+		},
+		&cli.BoolFlag{
+			Name:    "backfill-notify",
+			Usage:   "announce enqueued backfill jobs with Postgres LISTEN/NOTIFY, so the indexer starts them immediately, even if enqueued by another process (requires a Postgres database-url)",
+			EnvVars: []string{"PALOMAR_BACKFILL_NOTIFY"},
+		},
+		&cli.IntFlag{
+			Name:    "backfill-max-attempts",
+			Usage:   "failed attempts after which a backfill job is moved to the dead-letter state (0 to retry forever)",
+			Value:   backfill.DefaultRetryPolicy().MaxAttempts,
+			EnvVars: []string{"PALOMAR_BACKFILL_MAX_ATTEMPTS"},
+		},
+		&cli.DurationFlag{
+			Name:    "backfill-retry-backoff",
+			Usage:   "delay before retrying a failed backfill job, doubled for each subsequent retry",
+			Value:   backfill.DefaultRetryPolicy().InitialBackoff,
+			EnvVars: []string{"PALOMAR_BACKFILL_RETRY_BACKOFF"},
+		},
+		&cli.DurationFlag{
+			Name:    "backfill-retry-max-backoff",
+			Usage:   "upper bound on the delay between retries of a failed backfill job",
+			Value:   backfill.DefaultRetryPolicy().MaxBackoff,
+			EnvVars: []string{"PALOMAR_BACKFILL_RETRY_MAX_BACKOFF"},
+		},
+		&cli.IntFlag{
+			Name:    "backfill-priority-bulk",
+			Usage:   "backfill job priority for repos discovered by listing every repo on the relay (higher priorities are backfilled first)",
+			Value:   backfill.DefaultJobPriorities().Bulk,
+			EnvVars: []string{"PALOMAR_BACKFILL_PRIORITY_BULK"},
+		},
+		&cli.IntFlag{
+			Name:    "backfill-priority-discovered",
+			Usage:   "backfill job priority for repos first seen on the firehose",
+			Value:   backfill.DefaultJobPriorities().Discovered,
+			EnvVars: []string{"PALOMAR_BACKFILL_PRIORITY_DISCOVERED"},
+		},
+		&cli.IntFlag{
+			Name:    "backfill-priority-requested",
+			Usage:   "backfill job priority for repos enqueued through indexRepos (or by repairs and opt-out removals)",
+			Value:   backfill.DefaultJobPriorities().Requested,
+			EnvVars: []string{"PALOMAR_BACKFILL_PRIORITY_REQUESTED"},
+		},
 		&cli.IntFlag{
 			Name:    "index-max-concurrency",
 			Usage:   "max number of concurrent index requests (HTTP POST) to search index",
@@ -158,6 +263,106 @@ var runCmd = &cli.Command{
 			Value:   100,
 			EnvVars: []string{"PALOMAR_PLC_RATE_LIMIT"},
 		},
+		&cli.StringFlag{
+			Name:    "query-filter-config",
+			Usage:   "path to JSON file with query stopwords and blocked terms",
+			EnvVars: []string{"PALOMAR_QUERY_FILTER_CONFIG"},
+		},
+		&cli.IntFlag{
+			Name:    "bulk-batch-size",
+			Usage:   "max number of documents per OpenSearch bulk indexing request (0 to index documents individually)",
+			Value:   500,
+			EnvVars: []string{"PALOMAR_BULK_BATCH_SIZE"},
+		},
+		&cli.DurationFlag{
+			Name:    "bulk-flush-interval",
+			Usage:   "how often partial bulk indexing batches are sent",
+			Value:   time.Second,
+			EnvVars: []string{"PALOMAR_BULK_FLUSH_INTERVAL"},
+		},
+		&cli.IntFlag{
+			Name:    "bulk-max-retries",
+			Usage:   "how many times bulk indexing requests rejected as rate-limited (HTTP 429) are retried",
+			Value:   5,
+			EnvVars: []string{"PALOMAR_BULK_MAX_RETRIES"},
+		},
+		&cli.DurationFlag{
+			Name:    "consistency-check-interval",
+			Usage:   "how often to compare a sample of repos against the search indices (0 to disable)",
+			EnvVars: []string{"PALOMAR_CONSISTENCY_CHECK_INTERVAL"},
+		},
+		&cli.IntFlag{
+			Name:    "consistency-check-sample-size",
+			Usage:   "number of repos compared against the search indices per consistency check",
+			Value:   20,
+			EnvVars: []string{"PALOMAR_CONSISTENCY_CHECK_SAMPLE_SIZE"},
+		},
+		&cli.BoolFlag{
+			Name:    "consistency-check-repair",
+			Usage:   "re-backfill repos found to have drifted from the search indices",
+			EnvVars: []string{"PALOMAR_CONSISTENCY_CHECK_REPAIR"},
+		},
+		&cli.DurationFlag{
+			Name:    "optout-scrub-interval",
+			Usage:   "how often posts and profiles of opted-out accounts are deleted from the indices (0 to disable)",
+			Value:   time.Hour,
+			EnvVars: []string{"PALOMAR_OPTOUT_SCRUB_INTERVAL"},
+		},
+		&cli.BoolFlag{
+			Name:    "relevance-ranking",
+			Usage:   "rank post results by relevance (recency and engagement) instead of by time",
+			EnvVars: []string{"PALOMAR_RELEVANCE_RANKING"},
+		},
+		&cli.StringFlag{
+			Name:    "recency-decay",
+			Usage:   "decay function for post age when ranking by relevance: gauss, exp, or none",
+			Value:   "gauss",
+			EnvVars: []string{"PALOMAR_RECENCY_DECAY"},
+		},
+		&cli.DurationFlag{
+			Name:    "recency-scale",
+			Usage:   "post age (beyond the offset) at which the relevance score is halved",
+			Value:   7 * 24 * time.Hour,
+			EnvVars: []string{"PALOMAR_RECENCY_SCALE"},
+		},
+		&cli.DurationFlag{
+			Name:    "recency-offset",
+			Usage:   "post age below which there is no recency decay",
+			Value:   12 * time.Hour,
+			EnvVars: []string{"PALOMAR_RECENCY_OFFSET"},
+		},
+		&cli.Float64Flag{
+			Name:    "like-boost",
+			Usage:   "weight of like counts in relevance ranking (0 to disable)",
+			EnvVars: []string{"PALOMAR_LIKE_BOOST"},
+		},
+		&cli.Float64Flag{
+			Name:    "repost-boost",
+			Usage:   "weight of repost counts in relevance ranking (0 to disable)",
+			EnvVars: []string{"PALOMAR_REPOST_BOOST"},
+		},
+		&cli.StringFlag{
+			Name:    "post-field-weights",
+			Usage:   "weights of post text fields when ranking by relevance, eg 'text=2,everything=1'",
+			EnvVars: []string{"PALOMAR_POST_FIELD_WEIGHTS"},
+		},
+		&cli.StringFlag{
+			Name:    "profile-field-weights",
+			Usage:   "weights of profile text fields when ranking by relevance, eg 'display_name=2,everything=1'",
+			EnvVars: []string{"PALOMAR_PROFILE_FIELD_WEIGHTS"},
+		},
+		&cli.StringFlag{
+			Name:    "appview-host",
+			Usage:   "method, hostname, and port of AppView to fetch post engagement counts from",
+			Value:   "https://api.bsky.app",
+			EnvVars: []string{"PALOMAR_APPVIEW_HOST"},
+		},
+		&cli.DurationFlag{
+			Name:    "engagement-refresh-interval",
+			Usage:   "how often a batch of post engagement counts is refreshed from the AppView",
+			Value:   time.Minute,
+			EnvVars: []string{"PALOMAR_ENGAGEMENT_REFRESH_INTERVAL"},
+		},
 	},
 	Action: func(cctx *cli.Context) error {
 		logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
@@ -205,7 +410,20 @@ var runCmd = &cli.Command{
 			return err
 		}
 
-		escli, err := createEsClient(cctx)
+		var backfillNotifyURL string
+		if cctx.Bool("backfill-notify") {
+			dbURL := cctx.String("database-url")
+			switch {
+			case strings.HasPrefix(dbURL, "postgres://"), strings.HasPrefix(dbURL, "postgresql://"):
+				backfillNotifyURL = dbURL
+			case strings.HasPrefix(dbURL, "postgres="):
+				backfillNotifyURL = strings.TrimPrefix(dbURL, "postgres=")
+			default:
+				return fmt.Errorf("backfill notifications require a Postgres database")
+			}
+		}
+
+		escli, breaker, err := createEsClient(cctx)
 		if err != nil {
 			return fmt.Errorf("failed to get elasticsearch: %w", err)
 		}
@@ -221,18 +439,97 @@ var runCmd = &cli.Command{
 			SkipDNSDomainSuffixes: []string{".bsky.social"},
 		}
 		dir := identity.NewCacheDirectory(&base, 1_500_000, time.Hour*24, time.Minute*2)
+		go dir.RunPrefetch(context.Background(), identity.PrefetchConfig{})
+
+		var queryFilter *search.QueryFilterConfig
+		if p := cctx.String("query-filter-config"); p != "" {
+			queryFilter, err = search.LoadQueryFilterConfig(p)
+			if err != nil {
+				return err
+			}
+		}
+
+		var bulkIndex *search.BulkIndexerConfig
+		if n := cctx.Int("bulk-batch-size"); n > 0 {
+			bc := search.DefaultBulkIndexerConfig()
+			bc.BatchSize = n
+			bc.FlushInterval = cctx.Duration("bulk-flush-interval")
+			bc.MaxRetries = cctx.Int("bulk-max-retries")
+			bulkIndex = &bc
+		}
+
+		var relevance *search.RelevanceConfig
+		if cctx.Bool("relevance-ranking") {
+			rc := search.DefaultRelevanceConfig()
+			rc.RecencyDecay = cctx.String("recency-decay")
+			if rc.RecencyDecay == "none" {
+				rc.RecencyDecay = ""
+			}
+			rc.RecencyScale = cctx.Duration("recency-scale")
+			rc.RecencyOffset = cctx.Duration("recency-offset")
+			rc.LikeWeight = cctx.Float64("like-boost")
+			rc.RepostWeight = cctx.Float64("repost-boost")
+			rc.PostFieldWeights, err = search.ParseFieldWeights(cctx.String("post-field-weights"))
+			if err != nil {
+				return err
+			}
+			rc.ProfileFieldWeights, err = search.ParseFieldWeights(cctx.String("profile-field-weights"))
+			if err != nil {
+				return err
+			}
+			rc.AppViewHost = cctx.String("appview-host")
+			rc.EngagementRefreshInterval = cctx.Duration("engagement-refresh-interval")
+			relevance = &rc
+		}
+
+		var consistencyCheck *search.ConsistencyCheckConfig
+		if d := cctx.Duration("consistency-check-interval"); d > 0 {
+			cc := search.DefaultConsistencyCheckConfig()
+			cc.Interval = d
+			cc.SampleSize = cctx.Int("consistency-check-sample-size")
+			cc.Repair = cctx.Bool("consistency-check-repair")
+			consistencyCheck = &cc
+		}
+
+		optOutScrubInterval := cctx.Duration("optout-scrub-interval")
+		if optOutScrubInterval == 0 {
+			optOutScrubInterval = -1
+		}
 
 		srv, err := search.NewServer(
 			db,
 			escli,
 			&dir,
 			search.Config{
-				BGSHost:             cctx.String("atp-bgs-host"),
-				ProfileIndex:        cctx.String("es-profile-index"),
-				PostIndex:           cctx.String("es-post-index"),
-				Logger:              logger,
-				BGSSyncRateLimit:    cctx.Int("bgs-sync-rate-limit"),
-				IndexMaxConcurrency: cctx.Int("index-max-concurrency"),
+				BGSHost:              cctx.String("atp-bgs-host"),
+				ProfileIndex:         cctx.String("es-profile-index"),
+				PostIndex:            cctx.String("es-post-index"),
+				FeedIndex:            cctx.String("es-feed-index"),
+				Logger:               logger,
+				BGSSyncRateLimit:     cctx.Int("bgs-sync-rate-limit"),
+				IndexMaxConcurrency:  cctx.Int("index-max-concurrency"),
+				QueryFilter:          queryFilter,
+				BulkIndex:            bulkIndex,
+				Relevance:            relevance,
+				FallbackBGSHosts:     cctx.StringSlice("atp-bgs-fallback-hosts"),
+				FailbackInterval:     cctx.Duration("relay-failback-interval"),
+				ConsistencyCheck:     consistencyCheck,
+				OpenSearchBreaker:    breaker,
+				OptOutScrubInterval:  optOutScrubInterval,
+				BackfillCARDir:       cctx.String("backfill-car-dir"),
+				BackfillPDSRateLimit: cctx.Float64("backfill-pds-rate-limit"),
+				BackfillStreamRepos:  cctx.Bool("backfill-stream-repos"),
+				BackfillNotifyURL:    backfillNotifyURL,
+				BackfillRetry: &backfill.RetryPolicy{
+					MaxAttempts:    cctx.Int("backfill-max-attempts"),
+					InitialBackoff: cctx.Duration("backfill-retry-backoff"),
+					MaxBackoff:     cctx.Duration("backfill-retry-max-backoff"),
+				},
+				BackfillPriorities: &backfill.JobPriorities{
+					Bulk:       cctx.Int("backfill-priority-bulk"),
+					Discovered: cctx.Int("backfill-priority-discovered"),
+					Requested:  cctx.Int("backfill-priority-requested"),
+				},
 			},
 		)
 		if err != nil {
@@ -270,7 +567,7 @@ var elasticCheckCmd = &cli.Command{
 	Name:  "elastic-check",
 	Flags: []cli.Flag{},
 	Action: func(cctx *cli.Context) error {
-		escli, err := createEsClient(cctx)
+		escli, _, err := createEsClient(cctx)
 		if err != nil {
 			return err
 		}
@@ -314,7 +611,7 @@ var searchPostCmd = &cli.Command{
 	Name:  "search-post",
 	Usage: "run a simple query against posts index",
 	Action: func(cctx *cli.Context) error {
-		escli, err := createEsClient(cctx)
+		escli, _, err := createEsClient(cctx)
 		if err != nil {
 			return err
 		}
@@ -344,7 +641,7 @@ var searchProfileCmd = &cli.Command{
 		},
 	},
 	Action: func(cctx *cli.Context) error {
-		escli, err := createEsClient(cctx)
+		escli, _, err := createEsClient(cctx)
 		if err != nil {
 			return err
 		}
@@ -379,7 +676,66 @@ var searchProfileCmd = &cli.Command{
 	},
 }
 
-func createEsClient(cctx *cli.Context) (*es.Client, error) {
+var reindexCmd = &cli.Command{
+	Name:      "reindex",
+	Usage:     "control a zero-downtime reindex on a running indexer, via its admin API",
+	ArgsUsage: "<status|start|finish|cancel>",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "admin-url",
+			Usage:   "base URL of the indexer's metrics (admin) listener",
+			Value:   "http://localhost:3998",
+			EnvVars: []string{"PALOMAR_ADMIN_URL"},
+		},
+		&cli.BoolFlag{
+			Name:  "force",
+			Usage: "for 'finish': swap the aliases even if the reindex backfill is incomplete",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		action := cctx.Args().First()
+		method := http.MethodPost
+		switch action {
+		case "", "status":
+			action = "status"
+			method = http.MethodGet
+		case "start", "finish", "cancel":
+		default:
+			return fmt.Errorf("unknown reindex action: %q", action)
+		}
+		u := strings.TrimSuffix(cctx.String("admin-url"), "/") + "/admin/reindex/" + action
+		if action == "finish" && cctx.Bool("force") {
+			u += "?force=true"
+		}
+
+		req, err := http.NewRequestWithContext(cctx.Context, method, u, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("admin request failed: %w", err)
+		}
+		defer resp.Body.Close()
+
+		var out map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			return fmt.Errorf("failed to parse admin response (status %d): %w", resp.StatusCode, err)
+		}
+		b, err := json.MarshalIndent(out, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("reindex %s failed: %v", action, out["error"])
+		}
+		return nil
+	},
+}
+
+// The returned circuit breaker is nil if disabled.
+func createEsClient(cctx *cli.Context) (*es.Client, *search.CircuitBreaker, error) {
 
 	addrs := []string{}
 	if hosts := cctx.String("elastic-hosts"); hosts != "" {
@@ -391,7 +747,7 @@ func createEsClient(cctx *cli.Context) (*es.Client, error) {
 	if certfi != "" {
 		b, err := os.ReadFile(certfi)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		cert = b
@@ -412,17 +768,28 @@ func createEsClient(cctx *cli.Context) (*es.Client, error) {
 		},
 	}
 
+	rc := search.DefaultOpenSearchRetryConfig()
+	rc.MaxRetries = cctx.Int("elastic-max-retries")
+	rc.InitialBackoff = cctx.Duration("elastic-retry-backoff")
+	rc.MaxBackoff = cctx.Duration("elastic-retry-max-backoff")
+	rc.BreakerThreshold = cctx.Int("elastic-breaker-threshold")
+	rc.BreakerCooldown = cctx.Duration("elastic-breaker-cooldown")
+	breaker, err := rc.Apply(&cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	escli, err := es.NewClient(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to set up client: %w", err)
+		return nil, nil, fmt.Errorf("failed to set up client: %w", err)
 	}
 
 	info, err := escli.Info()
 	if err != nil {
-		return nil, fmt.Errorf("cannot get escli info: %w", err)
+		return nil, nil, fmt.Errorf("cannot get escli info: %w", err)
 	}
 	defer info.Body.Close()
 	slog.Debug("opensearch client initialized", "info", info)
 
-	return escli, nil
+	return escli, breaker, nil
 }
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bluesky-social/indigo/plc"
+	"github.com/bluesky-social/indigo/util/cliutil"
+
+	"github.com/carlmjohnson/versioninfo"
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	cli "github.com/urfave/cli/v2"
+)
+
+func main() {
+	if err := run(os.Args); err != nil {
+		slog.Error("exiting", "err", err)
+		os.Exit(-1)
+	}
+}
+
+func run(args []string) error {
+
+	app := cli.App{
+		Name:    "plcmirror",
+		Usage:   "mirrors a PLC directory into a local database, and resolves DIDs from it",
+		Version: versioninfo.Short(),
+	}
+
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "atp-plc-host",
+			Usage:   "method, hostname, and port of the PLC directory to mirror",
+			Value:   "https://plc.directory",
+			EnvVars: []string{"ATP_PLC_HOST"},
+		},
+		&cli.StringFlag{
+			Name:    "db-url",
+			Usage:   "database connection string for the mirror",
+			Value:   "sqlite://data/plcmirror/mirror.sqlite",
+			EnvVars: []string{"DATABASE_URL"},
+		},
+		&cli.IntFlag{
+			Name:    "max-db-connections",
+			Usage:   "max number of database connections",
+			Value:   40,
+			EnvVars: []string{"PLCMIRROR_MAX_DB_CONNECTIONS"},
+		},
+		&cli.StringFlag{
+			Name:    "bind",
+			Usage:   "IP or address, and port, to listen on for resolution requests",
+			Value:   ":2582",
+			EnvVars: []string{"PLCMIRROR_BIND"},
+		},
+		&cli.StringFlag{
+			Name:    "metrics-listen",
+			Usage:   "IP or address, and port, to listen on for metrics APIs",
+			Value:   ":3998",
+			EnvVars: []string{"PLCMIRROR_METRICS_LISTEN"},
+		},
+		&cli.DurationFlag{
+			Name:    "poll-interval",
+			Usage:   "how long to wait between polls of the export, once caught up",
+			Value:   plc.DefaultMirrorOptions().PollInterval,
+			EnvVars: []string{"PLCMIRROR_POLL_INTERVAL"},
+		},
+		&cli.Float64Flag{
+			Name:    "rate-limit",
+			Usage:   "max number of export requests per second to the PLC directory",
+			Value:   plc.DefaultMirrorOptions().RateLimit,
+			EnvVars: []string{"PLCMIRROR_RATE_LIMIT"},
+		},
+	}
+
+	app.Action = runMirror
+
+	return app.Run(args)
+}
+
+func runMirror(cctx *cli.Context) error {
+	ctx, stop := signal.NotifyContext(cctx.Context, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	db, err := cliutil.SetupDatabase(cctx.String("db-url"), cctx.Int("max-db-connections"))
+	if err != nil {
+		return fmt.Errorf("setting up database: %w", err)
+	}
+
+	opts := plc.DefaultMirrorOptions()
+	opts.Host = cctx.String("atp-plc-host")
+	opts.PollInterval = cctx.Duration("poll-interval")
+	opts.RateLimit = cctx.Float64("rate-limit")
+	opts.Logger = logger
+	mirror, err := plc.NewMirror(db, opts)
+	if err != nil {
+		return err
+	}
+
+	// prometheus HTTP endpoint: /metrics
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		if err := http.ListenAndServe(cctx.String("metrics-listen"), mux); err != nil {
+			logger.Error("failed to start metrics endpoint", "err", err)
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, "{\"status\":\"ok\",\"staleness_seconds\":%d}\n", int64(mirror.Staleness().Seconds()))
+	})
+	mux.Handle("/", mirror)
+	httpd := &http.Server{
+		Addr:         cctx.String("bind"),
+		Handler:      mux,
+		ReadTimeout:  time.Minute,
+		WriteTimeout: time.Minute,
+	}
+	go func() {
+		logger.Info("listening for resolution requests", "bind", httpd.Addr)
+		if err := httpd.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("failed to start resolution endpoint", "err", err)
+			stop()
+		}
+	}()
+
+	err = mirror.Run(ctx)
+	logger.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = httpd.Shutdown(shutdownCtx)
+	return err
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/events/bridge"
+	"github.com/bluesky-social/indigo/events/firehose"
+	"github.com/bluesky-social/indigo/events/schedulers/bounded"
+
+	"github.com/carlmjohnson/versioninfo"
+	_ "github.com/joho/godotenv/autoload"
+	"github.com/nats-io/nats.go"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	cli "github.com/urfave/cli/v2"
+)
+
+func main() {
+	if err := run(os.Args); err != nil {
+		slog.Error("exiting", "err", err)
+		os.Exit(-1)
+	}
+}
+
+func run(args []string) error {
+
+	app := cli.App{
+		Name:    "sluice",
+		Usage:   "republishes the firehose to Kafka or NATS",
+		Version: versioninfo.Short(),
+	}
+
+	app.Flags = []cli.Flag{
+		&cli.StringFlag{
+			Name:    "atp-relay-host",
+			Usage:   "method, hostname, and port of the relay to subscribe to",
+			Value:   "wss://bsky.network",
+			EnvVars: []string{"ATP_RELAY_HOST"},
+		},
+		&cli.StringFlag{
+			Name:    "encoding",
+			Usage:   "how events are published: 'cbor' (event stream frames) or 'json' (with decoded records)",
+			Value:   string(bridge.EncodingCBOR),
+			EnvVars: []string{"SLUICE_ENCODING"},
+		},
+		&cli.StringFlag{
+			Name:    "kafka-brokers",
+			Usage:   "comma-separated Kafka brokers (host:port) to publish to",
+			EnvVars: []string{"SLUICE_KAFKA_BROKERS"},
+		},
+		&cli.StringFlag{
+			Name:    "kafka-topic",
+			Usage:   "Kafka topic to publish to; events are keyed by DID",
+			Value:   "atproto-firehose",
+			EnvVars: []string{"SLUICE_KAFKA_TOPIC"},
+		},
+		&cli.StringFlag{
+			Name:    "nats-url",
+			Usage:   "NATS server URL to publish to",
+			EnvVars: []string{"SLUICE_NATS_URL"},
+		},
+		&cli.StringFlag{
+			Name:    "nats-subject",
+			Usage:   "prefix of the NATS subjects to publish to, followed by the partition number",
+			Value:   "atproto.firehose",
+			EnvVars: []string{"SLUICE_NATS_SUBJECT"},
+		},
+		&cli.IntFlag{
+			Name:    "nats-partitions",
+			Usage:   "number of NATS subjects to partition events over, by DID",
+			Value:   1,
+			EnvVars: []string{"SLUICE_NATS_PARTITIONS"},
+		},
+		&cli.BoolFlag{
+			Name:    "nats-jetstream",
+			Usage:   "publish to NATS JetStream (with acknowledgements), instead of core NATS",
+			EnvVars: []string{"SLUICE_NATS_JETSTREAM"},
+		},
+		&cli.StringFlag{
+			Name:    "cursor-file",
+			Usage:   "path of the file where the firehose cursor is persisted",
+			Value:   "sluice_cursor.json",
+			EnvVars: []string{"SLUICE_CURSOR_FILE"},
+		},
+		&cli.IntFlag{
+			Name:    "workers",
+			Usage:   "number of events published concurrently (events of a given DID are always published in order)",
+			Value:   bounded.DefaultSettings().Concurrency,
+			EnvVars: []string{"SLUICE_WORKERS"},
+		},
+		&cli.StringFlag{
+			Name:    "metrics-listen",
+			Usage:   "IP or address, and port, to listen on for metrics APIs",
+			Value:   ":3999",
+			EnvVars: []string{"SLUICE_METRICS_LISTEN"},
+		},
+	}
+
+	app.Action = runSluice
+
+	return app.Run(args)
+}
+
+func runSluice(cctx *cli.Context) error {
+	ctx, stop := signal.NotifyContext(cctx.Context, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+	slog.SetDefault(logger)
+
+	var sink bridge.Sink
+	switch {
+	case cctx.String("kafka-brokers") != "" && cctx.String("nats-url") != "":
+		return fmt.Errorf("only one of --kafka-brokers and --nats-url can be set")
+	case cctx.String("kafka-brokers") != "":
+		sink = bridge.NewKafkaSink(strings.Split(cctx.String("kafka-brokers"), ","), cctx.String("kafka-topic"))
+	case cctx.String("nats-url") != "":
+		nc, err := nats.Connect(cctx.String("nats-url"), nats.Name("sluice"))
+		if err != nil {
+			return fmt.Errorf("connecting to NATS: %w", err)
+		}
+		sink, err = bridge.NewNATSSink(nc, cctx.String("nats-subject"), cctx.Int("nats-partitions"), cctx.Bool("nats-jetstream"))
+		if err != nil {
+			nc.Close()
+			return err
+		}
+	default:
+		return fmt.Errorf("one of --kafka-brokers or --nats-url must be set")
+	}
+	defer func() {
+		if err := sink.Close(); err != nil {
+			logger.Error("failed to close sink", "err", err)
+		}
+	}()
+
+	bcfg := bridge.DefaultConfig()
+	bcfg.Encoding = bridge.Encoding(cctx.String("encoding"))
+	bcfg.Logger = logger
+	br, err := bridge.NewBridge(sink, bcfg)
+	if err != nil {
+		return err
+	}
+
+	// prometheus HTTP endpoint: /metrics
+	go func() {
+		http.Handle("/metrics", promhttp.Handler())
+		if err := http.ListenAndServe(cctx.String("metrics-listen"), nil); err != nil {
+			logger.Error("failed to start metrics endpoint", "err", err)
+		}
+	}()
+
+	cfg := firehose.DefaultConsumerConfig()
+	cfg.UserAgent = fmt.Sprintf("sluice/%s", versioninfo.Short())
+	cfg.Logger = logger
+	cfg.Cursors = firehose.NewFileCursorStore(cctx.String("cursor-file"))
+	cfg.NewScheduler = func(ident string, do func(context.Context, *events.XRPCStreamEvent) error) events.Scheduler {
+		settings := bounded.DefaultSettings()
+		settings.Concurrency = cctx.Int("workers")
+		return bounded.NewScheduler(settings, ident, do)
+	}
+	consumer := firehose.NewConsumer(cctx.String("atp-relay-host"), br.HandleEvent, cfg)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- consumer.Run(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	// stop retrying events which can't be published, so the consumer can shut down
+	logger.Info("shutting down")
+	br.Close()
+	return <-done
+}
@@ -0,0 +1,161 @@
+// Package bridge republishes the events of a repo stream to a message broker (Kafka or NATS), partitioned by DID, so that data pipelines can consume them without speaking WebSocket and CAR.
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"time"
+
+	"github.com/bluesky-social/indigo/events"
+)
+
+// Encoding is how events are encoded in published messages.
+type Encoding string
+
+const (
+	// The event stream frame, as received over WebSocket: the CBOR frame header, followed by the CBOR message
+	EncodingCBOR Encoding = "cbor"
+	// A JSON object with the message, and for commits, the records of their operations decoded from the CAR slice (see EncodeJSON)
+	EncodingJSON Encoding = "json"
+)
+
+// Message is an event encoded for publishing.
+type Message struct {
+	// The DID of the repo the event is about, by which messages are partitioned
+	Key string
+	// The message type of the event, like "#commit"
+	Type     string
+	Seq      int64
+	Encoding Encoding
+	Value    []byte
+}
+
+// Sink publishes messages to a broker. Publish must be safe to call concurrently, and return once the message was accepted by the broker.
+type Sink interface {
+	Publish(ctx context.Context, msg *Message) error
+	Close() error
+}
+
+type Config struct {
+	Encoding Encoding
+	// Delay before retrying a failed publish, doubled after each failure, up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	Logger     *slog.Logger
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Encoding:   EncodingCBOR,
+		MinBackoff: 100 * time.Millisecond,
+		MaxBackoff: 10 * time.Second,
+	}
+}
+
+// Bridge encodes events and publishes them to a Sink.
+type Bridge struct {
+	sink   Sink
+	cfg    Config
+	logger *slog.Logger
+
+	closed chan struct{}
+}
+
+func NewBridge(sink Sink, cfg Config) (*Bridge, error) {
+	switch cfg.Encoding {
+	case EncodingCBOR, EncodingJSON:
+	default:
+		return nil, fmt.Errorf("unknown bridge encoding: %q", cfg.Encoding)
+	}
+	def := DefaultConfig()
+	if cfg.MinBackoff == 0 {
+		cfg.MinBackoff = def.MinBackoff
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = def.MaxBackoff
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Bridge{
+		sink:   sink,
+		cfg:    cfg,
+		logger: logger.With("component", "bridge"),
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// HandleEvent publishes an event, retrying until the sink accepts it, or until the bridge is closed; it can be used as the handler of a firehose.Consumer or a scheduler. Messages which aren't about the contents of the stream, like info messages and error frames, are skipped.
+//
+// Events of the same repo are only published in order if they are handled in order, like by the sequential or bounded schedulers.
+func (b *Bridge) HandleEvent(ctx context.Context, xev *events.XRPCStreamEvent) error {
+	if xev.Sequence() < 0 {
+		return nil
+	}
+	msg, err := Encode(xev, b.cfg.Encoding)
+	if err != nil {
+		encodeErrors.Inc()
+		b.logger.Error("failed to encode event", "seq", xev.Sequence(), "err", err)
+		return err
+	}
+
+	backoff := b.cfg.MinBackoff
+	for {
+		err := b.sink.Publish(ctx, msg)
+		if err == nil {
+			published.WithLabelValues(msg.Type).Inc()
+			return nil
+		}
+		publishErrors.Inc()
+		b.logger.Warn("failed to publish event, retrying", "seq", msg.Seq, "err", err, "wait", backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.closed:
+			return fmt.Errorf("bridge closed before event %d could be published: %w", msg.Seq, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, b.cfg.MaxBackoff)
+	}
+}
+
+// Close stops retrying failed publishes, so that a consumer can shut down while the broker is unavailable. It doesn't close the sink.
+func (b *Bridge) Close() {
+	close(b.closed)
+}
+
+// Encode encodes an event as a message.
+func Encode(xev *events.XRPCStreamEvent, enc Encoding) (*Message, error) {
+	msg := &Message{
+		Key:      xev.RepoDID(),
+		Type:     xev.MessageType(),
+		Seq:      xev.Sequence(),
+		Encoding: enc,
+	}
+	var err error
+	switch enc {
+	case EncodingCBOR:
+		msg.Value, err = EncodeCBOR(xev)
+	case EncodingJSON:
+		msg.Value, err = EncodeJSON(xev)
+	default:
+		err = fmt.Errorf("unknown bridge encoding: %q", enc)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// Partition returns the partition of a message key (a DID), out of n.
+func Partition(key string, n int) int {
+	if n <= 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
@@ -0,0 +1,156 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/ipfs/go-cid"
+	car "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"github.com/stretchr/testify/assert"
+)
+
+type memSink struct {
+	lk       sync.Mutex
+	failures int
+	msgs     []*Message
+}
+
+func (s *memSink) Publish(ctx context.Context, msg *Message) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("broker unavailable")
+	}
+	s.msgs = append(s.msgs, msg)
+	return nil
+}
+
+func (s *memSink) Close() error { return nil }
+
+func testCommit(t *testing.T) *events.XRPCStreamEvent {
+	post := &bsky.FeedPost{LexiconTypeID: "app.bsky.feed.post", Text: "hello", CreatedAt: "2024-01-01T00:00:00Z"}
+	rec := new(bytes.Buffer)
+	if err := post.MarshalCBOR(rec); err != nil {
+		t.Fatal(err)
+	}
+	c, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: 0x12}.Sum(rec.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := new(bytes.Buffer)
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{c}, Version: 1}, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if err := carutil.LdWrite(blocks, c.Bytes(), rec.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	link := lexutil.LexLink(c)
+	return &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+		Repo:   "did:plc:one",
+		Seq:    42,
+		Commit: link,
+		Blocks: blocks.Bytes(),
+		Blobs:  []lexutil.LexLink{},
+		Ops: []*comatproto.SyncSubscribeRepos_RepoOp{
+			{Action: "create", Path: "app.bsky.feed.post/1", Cid: &link},
+			{Action: "delete", Path: "app.bsky.feed.post/2"},
+		},
+	}}
+}
+
+func TestEncode(t *testing.T) {
+	assert := assert.New(t)
+	xev := testCommit(t)
+
+	msg, err := Encode(xev, EncodingCBOR)
+	assert.NoError(err)
+	assert.Equal("did:plc:one", msg.Key)
+	assert.Equal("#commit", msg.Type)
+	assert.Equal(int64(42), msg.Seq)
+	// the frame round-trips through the stream decoder
+	var hdr events.EventHeader
+	r := bytes.NewReader(msg.Value)
+	assert.NoError(hdr.UnmarshalCBOR(r))
+	assert.Equal("#commit", hdr.MsgType)
+	var evt comatproto.SyncSubscribeRepos_Commit
+	assert.NoError(evt.UnmarshalCBOR(r))
+	assert.Equal(xev.RepoCommit.Blocks, evt.Blocks)
+
+	msg, err = Encode(xev, EncodingJSON)
+	assert.NoError(err)
+	var out struct {
+		Type    string
+		Seq     int64
+		Did     string
+		Event   map[string]any
+		Records []struct {
+			Action string
+			Path   string
+			Cid    string
+			Record map[string]any
+		}
+	}
+	assert.NoError(json.Unmarshal(msg.Value, &out))
+	assert.Equal("#commit", out.Type)
+	assert.Equal(int64(42), out.Seq)
+	assert.Equal("did:plc:one", out.Did)
+	assert.NotContains(out.Event, "blocks")
+	if assert.Len(out.Records, 2) {
+		assert.Equal("app.bsky.feed.post/1", out.Records[0].Path)
+		assert.Equal(cid.Cid(*xev.RepoCommit.Ops[0].Cid).String(), out.Records[0].Cid)
+		assert.Equal("hello", out.Records[0].Record["text"])
+		assert.Equal("app.bsky.feed.post", out.Records[0].Record["$type"])
+		assert.Equal("delete", out.Records[1].Action)
+		assert.Nil(out.Records[1].Record)
+	}
+	// the original event is left alone
+	assert.NotEmpty(xev.RepoCommit.Blocks)
+}
+
+func TestBridge(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	sink := &memSink{failures: 2}
+	b, err := NewBridge(sink, Config{Encoding: EncodingJSON, MinBackoff: time.Millisecond})
+	assert.NoError(err)
+
+	// retried until published
+	assert.NoError(b.HandleEvent(ctx, testCommit(t)))
+	// not about the stream's contents
+	assert.NoError(b.HandleEvent(ctx, &events.XRPCStreamEvent{RepoInfo: &comatproto.SyncSubscribeRepos_Info{Name: "OutdatedCursor"}}))
+	if assert.Len(sink.msgs, 1) {
+		assert.Equal(int64(42), sink.msgs[0].Seq)
+	}
+
+	// stops retrying once closed
+	sink.failures = 1000
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.Close()
+	}()
+	assert.ErrorContains(b.HandleEvent(ctx, testCommit(t)), "bridge closed")
+
+	_, err = NewBridge(sink, Config{Encoding: "xml"})
+	assert.Error(err)
+}
+
+func TestPartition(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(0, Partition("did:plc:one", 1))
+	p := Partition("did:plc:one", 8)
+	assert.Equal(p, Partition("did:plc:one", 8))
+	assert.True(p >= 0 && p < 8)
+}
@@ -0,0 +1,91 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+)
+
+// EncodeCBOR encodes an event as an event stream frame.
+func EncodeCBOR(xev *events.XRPCStreamEvent) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if err := xev.WriteFrame(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// The JSON encoding of an event.
+type jsonEvent struct {
+	// The message type, like "#commit"
+	Type string `json:"type"`
+	Seq  int64  `json:"seq"`
+	Did  string `json:"did,omitempty"`
+	// The message, without the CAR slice of commits
+	Event any `json:"event"`
+	// For commits, the record operations with their records
+	Records []*jsonRecord `json:"records,omitempty"`
+}
+
+type jsonRecord struct {
+	Action string `json:"action"`
+	Path   string `json:"path"`
+	Cid    string `json:"cid,omitempty"`
+	// The record, if it was created or updated; records of unknown types are encoded as {"$bytes": <base64 CBOR>}
+	Record any `json:"record,omitempty"`
+}
+
+// EncodeJSON encodes an event as a JSON object, with the fields "type" (like "#commit"), "seq", "did", and "event" (the message). The CAR slice of commits is left out of the message; instead, their "records" are a list of objects with the "action", "path", "cid" and "record" of each operation.
+func EncodeJSON(xev *events.XRPCStreamEvent) ([]byte, error) {
+	out := &jsonEvent{
+		Type: xev.MessageType(),
+		Seq:  xev.Sequence(),
+		Did:  xev.RepoDID(),
+	}
+	switch {
+	case xev.RepoCommit != nil:
+		evt := *xev.RepoCommit
+		recs, err := events.CommitRecords(&evt)
+		if err != nil {
+			return nil, err
+		}
+		for i, rec := range recs {
+			jr := &jsonRecord{Action: rec.Action, Path: evt.Ops[i].Path}
+			if rec.Cid != nil {
+				jr.Cid = rec.Cid.String()
+			}
+			if rec.Record != nil {
+				if v, err := lexutil.CborDecodeValue(rec.Record); err == nil {
+					jr.Record = v
+				} else {
+					jr.Record = lexutil.LexBytes(rec.Record)
+				}
+			}
+			out.Records = append(out.Records, jr)
+		}
+		evt.Blocks = nil
+		out.Event = &evt
+	case xev.RepoHandle != nil:
+		out.Event = xev.RepoHandle
+	case xev.RepoInfo != nil:
+		out.Event = xev.RepoInfo
+	case xev.RepoMigrate != nil:
+		out.Event = xev.RepoMigrate
+	case xev.RepoTombstone != nil:
+		out.Event = xev.RepoTombstone
+	case xev.RepoIdentity != nil:
+		out.Event = xev.RepoIdentity
+	case xev.RepoAccount != nil:
+		out.Event = xev.RepoAccount
+	case xev.LabelLabels != nil:
+		out.Event = xev.LabelLabels
+	case xev.LabelInfo != nil:
+		out.Event = xev.LabelInfo
+	case xev.Error != nil:
+		out.Type = "#error"
+		out.Event = xev.Error
+	}
+	return json.Marshal(out)
+}
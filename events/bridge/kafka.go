@@ -0,0 +1,41 @@
+package bridge
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaSink publishes messages to a Kafka topic, keyed (and so partitioned) by DID. The type, sequence number and encoding of each message are in its headers.
+type KafkaSink struct {
+	w *kafka.Writer
+}
+
+// NewKafkaSink returns a sink publishing to topic on the given brokers ("host:port"). Concurrent publishes are batched, so the sink should be used with several workers.
+func NewKafkaSink(brokers []string, topic string) *KafkaSink {
+	return &KafkaSink{w: &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		BatchTimeout: 20 * time.Millisecond,
+	}}
+}
+
+func (s *KafkaSink) Publish(ctx context.Context, msg *Message) error {
+	return s.w.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(msg.Key),
+		Value: msg.Value,
+		Headers: []kafka.Header{
+			{Key: "type", Value: []byte(msg.Type)},
+			{Key: "seq", Value: []byte(strconv.FormatInt(msg.Seq, 10))},
+			{Key: "encoding", Value: []byte(msg.Encoding)},
+		},
+	})
+}
+
+func (s *KafkaSink) Close() error {
+	return s.w.Close()
+}
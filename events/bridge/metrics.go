@@ -0,0 +1,21 @@
+package bridge
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var published = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_bridge_published_total",
+	Help: "Total number of events published, by message type",
+}, []string{"type"})
+
+var publishErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indigo_bridge_publish_errors_total",
+	Help: "Total number of failed attempts to publish an event",
+})
+
+var encodeErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indigo_bridge_encode_errors_total",
+	Help: "Total number of events which could not be encoded",
+})
@@ -0,0 +1,62 @@
+package bridge
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSSink publishes messages to NATS subjects "<prefix>.<partition>", where the partition is derived from the DID (see Partition), so that the events of a repo are always on the same subject. The DID, type, sequence number and encoding of each message are in its headers.
+type NATSSink struct {
+	nc         *nats.Conn
+	js         nats.JetStreamContext
+	prefix     string
+	partitions int
+}
+
+// NewNATSSink returns a sink publishing over nc. If jetStream is set, messages are published to JetStream (which must have a stream for the subjects), waiting for each to be acknowledged, and de-duplicated by sequence number; otherwise, they are published with core NATS, without delivery guarantees.
+func NewNATSSink(nc *nats.Conn, prefix string, partitions int, jetStream bool) (*NATSSink, error) {
+	s := &NATSSink{
+		nc:         nc,
+		prefix:     prefix,
+		partitions: max(partitions, 1),
+	}
+	if jetStream {
+		js, err := nc.JetStream()
+		if err != nil {
+			return nil, fmt.Errorf("getting JetStream context: %w", err)
+		}
+		s.js = js
+	}
+	return s, nil
+}
+
+// Subject returns the subject which the messages of a DID are published to.
+func (s *NATSSink) Subject(did string) string {
+	return s.prefix + "." + strconv.Itoa(Partition(did, s.partitions))
+}
+
+func (s *NATSSink) Publish(ctx context.Context, msg *Message) error {
+	m := nats.NewMsg(s.Subject(msg.Key))
+	m.Data = msg.Value
+	m.Header.Set("Atproto-Did", msg.Key)
+	m.Header.Set("Atproto-Type", msg.Type)
+	m.Header.Set("Atproto-Seq", strconv.FormatInt(msg.Seq, 10))
+	m.Header.Set("Atproto-Encoding", string(msg.Encoding))
+	if s.js == nil {
+		return s.nc.PublishMsg(m)
+	}
+	m.Header.Set(nats.MsgIdHdr, strconv.FormatInt(msg.Seq, 10))
+	_, err := s.js.PublishMsg(m, nats.Context(ctx))
+	return err
+}
+
+// Close flushes the messages buffered by the connection, and closes it.
+func (s *NATSSink) Close() error {
+	if err := s.nc.Drain(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -21,6 +21,8 @@ type RepoStreamCallbacks struct {
 	RepoInfo      func(evt *comatproto.SyncSubscribeRepos_Info) error
 	RepoMigrate   func(evt *comatproto.SyncSubscribeRepos_Migrate) error
 	RepoTombstone func(evt *comatproto.SyncSubscribeRepos_Tombstone) error
+	RepoIdentity  func(evt *comatproto.SyncSubscribeRepos_Identity) error
+	RepoAccount   func(evt *comatproto.SyncSubscribeRepos_Account) error
 	LabelLabels   func(evt *label.SubscribeLabels_Labels) error
 	LabelInfo     func(evt *label.SubscribeLabels_Info) error
 	Error         func(evt *ErrorFrame) error
@@ -38,6 +40,10 @@ func (rsc *RepoStreamCallbacks) EventHandler(ctx context.Context, xev *XRPCStrea
 		return rsc.RepoMigrate(xev.RepoMigrate)
 	case xev.RepoTombstone != nil && rsc.RepoTombstone != nil:
 		return rsc.RepoTombstone(xev.RepoTombstone)
+	case xev.RepoIdentity != nil && rsc.RepoIdentity != nil:
+		return rsc.RepoIdentity(xev.RepoIdentity)
+	case xev.RepoAccount != nil && rsc.RepoAccount != nil:
+		return rsc.RepoAccount(xev.RepoAccount)
 	case xev.LabelLabels != nil && rsc.LabelLabels != nil:
 		return rsc.LabelLabels(xev.LabelLabels)
 	case xev.LabelInfo != nil && rsc.LabelInfo != nil:
@@ -79,6 +85,13 @@ func (sr *instrumentedReader) Read(p []byte) (int, error) {
 }
 
 func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler) error {
+	return HandleRepoStreamWithDecodePool(ctx, con, sched, 1)
+}
+
+// Like HandleRepoStream, but decodes frames concurrently with a pool of decodeWorkers goroutines. Events are still passed to the scheduler in stream order, from the calling goroutine.
+//
+// In either case, frame buffers and CBOR decoding state are re-used between frames. Concurrent decoding helps full-network consumers for which decoding, not event handling, is the bottleneck.
+func HandleRepoStreamWithDecodePool(ctx context.Context, con *websocket.Conn, sched Scheduler, decodeWorkers int) error {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	defer sched.Shutdown()
@@ -121,22 +134,16 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler)
 		return nil
 	})
 
-	lastSeq := int64(-1)
-	for {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
-
+	// reads the next frame from the websocket, in to a pooled decoder
+	nextFrame := func() (*frameDecoder, error) {
 		mt, rawReader, err := con.NextReader()
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		switch mt {
 		default:
-			return fmt.Errorf("expected binary message from subscription endpoint")
+			return nil, fmt.Errorf("expected binary message from subscription endpoint")
 		case websocket.BinaryMessage:
 			// ok
 		}
@@ -147,127 +154,115 @@ func HandleRepoStream(ctx context.Context, con *websocket.Conn, sched Scheduler)
 			bytesCounter: bytesFromStreamCounter.WithLabelValues(remoteAddr),
 		}
 
-		var header EventHeader
-		if err := header.UnmarshalCBOR(r); err != nil {
-			return fmt.Errorf("reading header: %w", err)
+		d := getFrameDecoder()
+		if err := d.readFrame(r); err != nil {
+			putFrameDecoder(d)
+			return nil, fmt.Errorf("reading frame: %w", err)
 		}
 
 		eventsFromStreamCounter.WithLabelValues(remoteAddr).Inc()
+		return d, nil
+	}
 
-		switch header.Op {
-		case EvtKindMessage:
-			switch header.MsgType {
-			case "#commit":
-				var evt comatproto.SyncSubscribeRepos_Commit
-				if err := evt.UnmarshalCBOR(r); err != nil {
-					return fmt.Errorf("reading repoCommit event: %w", err)
-				}
-
-				if evt.Seq < lastSeq {
-					log.Errorf("Got events out of order from stream (seq = %d, prev = %d)", evt.Seq, lastSeq)
-				}
-
-				lastSeq = evt.Seq
-
-				if err := sched.AddWork(ctx, evt.Repo, &XRPCStreamEvent{
-					RepoCommit: &evt,
-				}); err != nil {
-					return err
-				}
-			case "#handle":
-				var evt comatproto.SyncSubscribeRepos_Handle
-				if err := evt.UnmarshalCBOR(r); err != nil {
-					return err
-				}
-
-				if evt.Seq < lastSeq {
-					log.Errorf("Got events out of order from stream (seq = %d, prev = %d)", evt.Seq, lastSeq)
-				}
-				lastSeq = evt.Seq
-
-				if err := sched.AddWork(ctx, evt.Did, &XRPCStreamEvent{
-					RepoHandle: &evt,
-				}); err != nil {
-					return err
-				}
-			case "#info":
-				// TODO: this might also be a LabelInfo (as opposed to RepoInfo)
-				var evt comatproto.SyncSubscribeRepos_Info
-				if err := evt.UnmarshalCBOR(r); err != nil {
-					return err
-				}
-
-				if err := sched.AddWork(ctx, "", &XRPCStreamEvent{
-					RepoInfo: &evt,
-				}); err != nil {
-					return err
-				}
-			case "#migrate":
-				var evt comatproto.SyncSubscribeRepos_Migrate
-				if err := evt.UnmarshalCBOR(r); err != nil {
-					return err
-				}
-
-				if evt.Seq < lastSeq {
-					log.Errorf("Got events out of order from stream (seq = %d, prev = %d)", evt.Seq, lastSeq)
-				}
-				lastSeq = evt.Seq
-
-				if err := sched.AddWork(ctx, evt.Did, &XRPCStreamEvent{
-					RepoMigrate: &evt,
-				}); err != nil {
-					return err
-				}
-			case "#tombstone":
-				var evt comatproto.SyncSubscribeRepos_Tombstone
-				if err := evt.UnmarshalCBOR(r); err != nil {
-					return err
-				}
+	lastSeq := int64(-1)
+	handleFrame := func(df *decodedFrame) error {
+		if df.evt == nil {
+			return nil
+		}
+		if df.seq >= 0 {
+			if df.seq < lastSeq {
+				log.Errorf("Got events out of order from stream (seq = %d, prev = %d)", df.seq, lastSeq)
+			} else if lastSeq >= 0 && df.seq > lastSeq+1 {
+				seqGapsCounter.WithLabelValues(remoteAddr).Inc()
+				missedSeqsCounter.WithLabelValues(remoteAddr).Add(float64(df.seq - lastSeq - 1))
+			}
+			lastSeq = df.seq
+		}
+		return sched.AddWork(ctx, df.repo, df.evt)
+	}
 
-				if evt.Seq < lastSeq {
-					log.Errorf("Got events out of order from stream (seq = %d, prev = %d)", evt.Seq, lastSeq)
-				}
-				lastSeq = evt.Seq
+	if decodeWorkers <= 1 {
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
 
-				if err := sched.AddWork(ctx, evt.Did, &XRPCStreamEvent{
-					RepoTombstone: &evt,
-				}); err != nil {
-					return err
-				}
-			case "#labebatch":
-				var evt label.SubscribeLabels_Labels
-				if err := evt.UnmarshalCBOR(r); err != nil {
-					return fmt.Errorf("reading Labels event: %w", err)
-				}
+			d, err := nextFrame()
+			if err != nil {
+				return err
+			}
+			df, err := d.decode()
+			putFrameDecoder(d)
+			if err != nil {
+				return err
+			}
+			if err := handleFrame(df); err != nil {
+				return err
+			}
+		}
+	}
 
-				if evt.Seq < lastSeq {
-					log.Errorf("Got events out of order from stream (seq = %d, prev = %d)", evt.Seq, lastSeq)
-				}
+	type decodeJob struct {
+		d    *frameDecoder
+		df   *decodedFrame
+		err  error
+		done chan struct{}
+	}
 
-				lastSeq = evt.Seq
+	// jobs are handed to workers via 'jobs', and in stream order to this goroutine via 'ordered', which also bounds the number of frames in flight
+	jobs := make(chan *decodeJob)
+	ordered := make(chan *decodeJob, 2*decodeWorkers)
+
+	for i := 0; i < decodeWorkers; i++ {
+		go func() {
+			for job := range jobs {
+				job.df, job.err = job.d.decode()
+				putFrameDecoder(job.d)
+				job.d = nil
+				close(job.done)
+			}
+		}()
+	}
 
-				if err := sched.AddWork(ctx, "", &XRPCStreamEvent{
-					LabelLabels: &evt,
-				}); err != nil {
-					return err
+	go func() {
+		defer close(jobs)
+		for {
+			d, err := nextFrame()
+			if err != nil {
+				job := &decodeJob{err: err, done: make(chan struct{})}
+				close(job.done)
+				select {
+				case ordered <- job:
+				case <-ctx.Done():
 				}
+				return
 			}
 
-		case EvtKindErrorFrame:
-			var errframe ErrorFrame
-			if err := errframe.UnmarshalCBOR(r); err != nil {
-				return err
+			job := &decodeJob{d: d, done: make(chan struct{})}
+			select {
+			case ordered <- job:
+			case <-ctx.Done():
+				putFrameDecoder(d)
+				return
 			}
+			jobs <- job
+		}
+	}()
 
-			if err := sched.AddWork(ctx, "", &XRPCStreamEvent{
-				Error: &errframe,
-			}); err != nil {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case job := <-ordered:
+			<-job.done
+			if job.err != nil {
+				return job.err
+			}
+			if err := handleFrame(job.df); err != nil {
 				return err
 			}
-
-		default:
-			return fmt.Errorf("unrecognized event stream type: %d", header.Op)
 		}
-
 	}
 }
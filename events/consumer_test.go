@@ -0,0 +1,161 @@
+package events_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	atproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/gorilla/websocket"
+	"github.com/ipfs/go-cid"
+	car "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"github.com/multiformats/go-multihash"
+)
+
+type collectScheduler struct {
+	lk   sync.Mutex
+	evts []*events.XRPCStreamEvent
+}
+
+func (s *collectScheduler) AddWork(ctx context.Context, repo string, val *events.XRPCStreamEvent) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.evts = append(s.evts, val)
+	return nil
+}
+
+func (s *collectScheduler) Shutdown() {}
+
+// serves a fixed sequence of frames over websocket, then closes the connection
+func serveFrames(t *testing.T, frames [][]byte) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		con, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer con.Close()
+		for _, f := range frames {
+			if err := con.WriteMessage(websocket.BinaryMessage, f); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		con.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	}))
+}
+
+func commitFrame(t *testing.T, seq int64) []byte {
+	var buf bytes.Buffer
+	hdr := events.EventHeader{Op: events.EvtKindMessage, MsgType: "#commit"}
+	if err := hdr.MarshalCBOR(&buf); err != nil {
+		t.Fatal(err)
+	}
+	evt := atproto.SyncSubscribeRepos_Commit{
+		Repo:   fmt.Sprintf("did:example:%d", seq%7),
+		Seq:    seq,
+		Blocks: bytes.Repeat([]byte{byte(seq)}, int(seq%5)*100),
+		Ops:    []*atproto.SyncSubscribeRepos_RepoOp{},
+		Blobs:  []lexutil.LexLink{},
+		Time:   "2024-01-01T00:00:00.000Z",
+	}
+	c, err := cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256).Sum(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	evt.Commit = lexutil.LexLink(c)
+	if err := evt.MarshalCBOR(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestHandleRepoStreamDecodePool(t *testing.T) {
+	var frames [][]byte
+	for i := int64(1); i <= 500; i++ {
+		frames = append(frames, commitFrame(t, i))
+	}
+
+	for _, workers := range []int{1, 4} {
+		srv := serveFrames(t, frames)
+		con, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sched := &collectScheduler{}
+		err = events.HandleRepoStreamWithDecodePool(context.Background(), con, sched, workers)
+		if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+			t.Fatalf("unexpected error (workers=%d): %v", workers, err)
+		}
+		srv.Close()
+
+		if len(sched.evts) != len(frames) {
+			t.Fatalf("expected %d events (workers=%d), got %d", len(frames), workers, len(sched.evts))
+		}
+		for i, evt := range sched.evts {
+			c := evt.RepoCommit
+			seq := int64(i + 1)
+			if c == nil || c.Seq != seq {
+				t.Fatalf("event out of order (workers=%d) at %d", workers, i)
+			}
+			if len(c.Blocks) != int(seq%5)*100 || (len(c.Blocks) > 0 && c.Blocks[0] != byte(seq)) {
+				t.Fatalf("corrupted blocks (workers=%d) at seq %d", workers, seq)
+			}
+		}
+	}
+}
+
+func TestReadCommitBlocks(t *testing.T) {
+	var cids []cid.Cid
+	buf := new(bytes.Buffer)
+	for i := 0; i < 3; i++ {
+		data := []byte(fmt.Sprintf("block %d", i))
+		c, err := cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256).Sum(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{c}, Version: 1}, buf); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := carutil.LdWrite(buf, c.Bytes(), data); err != nil {
+			t.Fatal(err)
+		}
+		cids = append(cids, c)
+	}
+	evt := &atproto.SyncSubscribeRepos_Commit{Blocks: buf.Bytes()}
+
+	// twice, so the second read goes through a pooled reader
+	for round := 0; round < 2; round++ {
+		var got []string
+		err := events.ReadCommitBlocks(evt, func(c cid.Cid, data []byte) error {
+			if c != cids[len(got)] {
+				t.Fatalf("unexpected block CID %s", c)
+			}
+			got = append(got, string(data))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(got, ",") != "block 0,block 1,block 2" {
+			t.Fatalf("unexpected blocks: %q", got)
+		}
+	}
+
+	if err := events.ReadCommitBlocks(&atproto.SyncSubscribeRepos_Commit{Blocks: []byte("not a car")}, func(cid.Cid, []byte) error { return nil }); err == nil {
+		t.Fatal("expected an error reading an invalid CAR slice")
+	}
+}
@@ -51,7 +51,7 @@ func DefaultOptions() *Options {
 type DbPersistence struct {
 	db *gorm.DB
 
-	cs *carstore.CarStore
+	cs carstore.Store
 
 	lk sync.Mutex
 
@@ -82,7 +82,7 @@ type RepoEventRecord struct {
 	Ops []byte
 }
 
-func NewDbPersistence(db *gorm.DB, cs *carstore.CarStore, options *Options) (*DbPersistence, error) {
+func NewDbPersistence(db *gorm.DB, cs carstore.Store, options *Options) (*DbPersistence, error) {
 	if err := db.AutoMigrate(&RepoEventRecord{}); err != nil {
 		return nil, err
 	}
@@ -167,6 +167,8 @@ func (p *DbPersistence) flushBatchLocked(ctx context.Context) error {
 			e.RepoHandle.Seq = int64(item.Seq)
 		case e.RepoTombstone != nil:
 			e.RepoTombstone.Seq = int64(item.Seq)
+		case e.RepoIdentity != nil:
+			e.RepoIdentity.Seq = int64(item.Seq)
 		default:
 			return fmt.Errorf("unknown event type")
 		}
@@ -216,6 +218,11 @@ func (p *DbPersistence) Persist(ctx context.Context, e *XRPCStreamEvent) error {
 		if err != nil {
 			return err
 		}
+	case e.RepoIdentity != nil:
+		rer, err = p.RecordFromIdentity(ctx, e.RepoIdentity)
+		if err != nil {
+			return err
+		}
 	default:
 		return nil
 	}
@@ -264,6 +271,25 @@ func (p *DbPersistence) RecordFromTombstone(ctx context.Context, evt *comatproto
 	}, nil
 }
 
+func (p *DbPersistence) RecordFromIdentity(ctx context.Context, evt *comatproto.SyncSubscribeRepos_Identity) (*RepoEventRecord, error) {
+	t, err := time.Parse(util.ISO8601, evt.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := p.uidForDid(ctx, evt.Did)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RepoEventRecord{
+		Repo:      uid,
+		Type:      "repo_identity",
+		Time:      t,
+		NewHandle: evt.Handle,
+	}, nil
+}
+
 func (p *DbPersistence) RecordFromRepoCommit(ctx context.Context, evt *comatproto.SyncSubscribeRepos_Commit) (*RepoEventRecord, error) {
 	// TODO: hack hack hack
 	if len(evt.Ops) > 8192 {
@@ -394,6 +420,8 @@ func (p *DbPersistence) hydrateBatch(ctx context.Context, batch []*RepoEventReco
 			switch {
 			case record.Commit != nil:
 				streamEvent, err = p.hydrateCommit(ctx, record)
+			case record.Type == "repo_identity":
+				streamEvent, err = p.hydrateIdentity(ctx, record)
 			case record.NewHandle != nil:
 				streamEvent, err = p.hydrateHandleChange(ctx, record)
 			case record.Type == "repo_tombstone":
@@ -493,6 +521,21 @@ func (p *DbPersistence) hydrateTombstone(ctx context.Context, rer *RepoEventReco
 	}, nil
 }
 
+func (p *DbPersistence) hydrateIdentity(ctx context.Context, rer *RepoEventRecord) (*XRPCStreamEvent, error) {
+	did, err := p.didForUid(ctx, rer.Repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &XRPCStreamEvent{
+		RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{
+			Did:    did,
+			Handle: rer.NewHandle,
+			Time:   rer.Time.Format(util.ISO8601),
+		},
+	}, nil
+}
+
 func (p *DbPersistence) hydrateCommit(ctx context.Context, rer *RepoEventRecord) (*XRPCStreamEvent, error) {
 	if rer.Commit == nil {
 		return nil, fmt.Errorf("commit is nil")
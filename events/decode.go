@@ -0,0 +1,220 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	label "github.com/bluesky-social/indigo/api/label"
+
+	cid "github.com/ipfs/go-cid"
+	car "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// Reusable state for decoding a single event stream frame: a buffer holding the raw frame bytes, and a CBOR reader over that buffer.
+//
+// Decoded events never reference the buffer (cbor-gen copies strings and byte slices), so a decoder can be returned to the pool as soon as decoding is done.
+type frameDecoder struct {
+	buf bytes.Buffer
+	br  bytes.Reader
+	cr  *cbg.CborReader
+}
+
+var frameDecoderPool = sync.Pool{
+	New: func() any {
+		d := &frameDecoder{}
+		d.cr = cbg.NewCborReader(&d.br)
+		return d
+	},
+}
+
+func getFrameDecoder() *frameDecoder {
+	return frameDecoderPool.Get().(*frameDecoder)
+}
+
+// don't hang on to unusually large buffers (eg, from a huge commit) in the pool
+const maxPooledFrameSize = 4 << 20
+
+func putFrameDecoder(d *frameDecoder) {
+	if d.buf.Cap() > maxPooledFrameSize {
+		return
+	}
+	d.buf.Reset()
+	d.br.Reset(nil)
+	frameDecoderPool.Put(d)
+}
+
+// Reads an entire frame in to the decoder's buffer.
+func (d *frameDecoder) readFrame(r io.Reader) error {
+	d.buf.Reset()
+	if _, err := d.buf.ReadFrom(r); err != nil {
+		return err
+	}
+	d.br.Reset(d.buf.Bytes())
+	return nil
+}
+
+// Reusable state for reading the CAR slice of a commit: a reader over the slice, and the buffered reader which the CAR functions read through.
+//
+// Block data read from it is freshly allocated (by carutil.LdRead), so it can be kept after the reader is returned to the pool.
+type carReader struct {
+	br  bytes.Reader
+	buf *bufio.Reader
+}
+
+var carReaderPool = sync.Pool{
+	New: func() any {
+		r := &carReader{}
+		r.buf = bufio.NewReader(&r.br)
+		return r
+	},
+}
+
+func getCarReader(data []byte) *carReader {
+	r := carReaderPool.Get().(*carReader)
+	r.br.Reset(data)
+	r.buf.Reset(&r.br)
+	return r
+}
+
+func putCarReader(r *carReader) {
+	r.br.Reset(nil)
+	r.buf.Reset(&r.br)
+	carReaderPool.Put(r)
+}
+
+// Reads the header of the CAR slice, returning its roots.
+func (r *carReader) readHeader() ([]cid.Cid, error) {
+	hdr, err := car.ReadHeader(r.buf)
+	if err != nil {
+		return nil, err
+	}
+	return hdr.Roots, nil
+}
+
+// Reads the next block of the CAR slice, returning io.EOF at the end. The data is not checked against the CID.
+func (r *carReader) next() (cid.Cid, []byte, error) {
+	data, err := carutil.LdRead(r.buf)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+	c, n, err := carutil.ReadCid(data)
+	if err != nil {
+		return cid.Undef, nil, err
+	}
+	return c, data[n:], nil
+}
+
+// ReadCommitBlocks calls cb with the CID and data of each block in the CAR slice of a commit, in order, using pooled reading state. Blocks are not checked against their CIDs.
+func ReadCommitBlocks(evt *comatproto.SyncSubscribeRepos_Commit, cb func(c cid.Cid, data []byte) error) error {
+	r := getCarReader(evt.Blocks)
+	defer putCarReader(r)
+
+	if _, err := r.readHeader(); err != nil {
+		return fmt.Errorf("reading commit CAR header (seq %d): %w", evt.Seq, err)
+	}
+	for {
+		c, data, err := r.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading commit CAR block (seq %d): %w", evt.Seq, err)
+		}
+		if err := cb(c, data); err != nil {
+			return err
+		}
+	}
+}
+
+// The result of decoding a single frame.
+type decodedFrame struct {
+	// nil if the frame was an unknown message type, which should be skipped
+	evt *XRPCStreamEvent
+	// scheduler key (repo DID), or empty string
+	repo string
+	// sequence number, or -1 for frames without one
+	seq int64
+}
+
+// Decodes a frame previously read with readFrame.
+func (d *frameDecoder) decode() (*decodedFrame, error) {
+	r := d.cr
+
+	var header EventHeader
+	if err := header.UnmarshalCBOR(r); err != nil {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+
+	switch header.Op {
+	case EvtKindMessage:
+		switch header.MsgType {
+		case "#commit":
+			var evt comatproto.SyncSubscribeRepos_Commit
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return nil, fmt.Errorf("reading repoCommit event: %w", err)
+			}
+			return &decodedFrame{evt: &XRPCStreamEvent{RepoCommit: &evt}, repo: evt.Repo, seq: evt.Seq}, nil
+		case "#handle":
+			var evt comatproto.SyncSubscribeRepos_Handle
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return nil, err
+			}
+			return &decodedFrame{evt: &XRPCStreamEvent{RepoHandle: &evt}, repo: evt.Did, seq: evt.Seq}, nil
+		case "#info":
+			// TODO: this might also be a LabelInfo (as opposed to RepoInfo)
+			var evt comatproto.SyncSubscribeRepos_Info
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return nil, err
+			}
+			return &decodedFrame{evt: &XRPCStreamEvent{RepoInfo: &evt}, seq: -1}, nil
+		case "#migrate":
+			var evt comatproto.SyncSubscribeRepos_Migrate
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return nil, err
+			}
+			return &decodedFrame{evt: &XRPCStreamEvent{RepoMigrate: &evt}, repo: evt.Did, seq: evt.Seq}, nil
+		case "#tombstone":
+			var evt comatproto.SyncSubscribeRepos_Tombstone
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return nil, err
+			}
+			return &decodedFrame{evt: &XRPCStreamEvent{RepoTombstone: &evt}, repo: evt.Did, seq: evt.Seq}, nil
+		case "#identity":
+			var evt comatproto.SyncSubscribeRepos_Identity
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return nil, err
+			}
+			return &decodedFrame{evt: &XRPCStreamEvent{RepoIdentity: &evt}, repo: evt.Did, seq: evt.Seq}, nil
+		case "#account":
+			var evt comatproto.SyncSubscribeRepos_Account
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return nil, err
+			}
+			return &decodedFrame{evt: &XRPCStreamEvent{RepoAccount: &evt}, repo: evt.Did, seq: evt.Seq}, nil
+		case "#labebatch":
+			var evt label.SubscribeLabels_Labels
+			if err := evt.UnmarshalCBOR(r); err != nil {
+				return nil, fmt.Errorf("reading Labels event: %w", err)
+			}
+			return &decodedFrame{evt: &XRPCStreamEvent{LabelLabels: &evt}, seq: evt.Seq}, nil
+		default:
+			return &decodedFrame{seq: -1}, nil
+		}
+
+	case EvtKindErrorFrame:
+		var errframe ErrorFrame
+		if err := errframe.UnmarshalCBOR(r); err != nil {
+			return nil, err
+		}
+		return &decodedFrame{evt: &XRPCStreamEvent{Error: &errframe}, seq: -1}, nil
+
+	default:
+		return nil, fmt.Errorf("unrecognized event stream type: %d", header.Op)
+	}
+}
@@ -28,6 +28,9 @@ type DiskPersistence struct {
 	eventsPerFile   int64
 	writeBufferSize int
 	retention       time.Duration
+	maxBytes        int64
+	compact         bool
+	gcInterval      time.Duration
 
 	meta *gorm.DB
 
@@ -50,6 +53,11 @@ type DiskPersistence struct {
 	shutdown chan struct{}
 
 	lk sync.Mutex
+
+	// held while events files are mutated by takedowns, or rewritten by compaction
+	compactLk sync.Mutex
+	// paths of the events files in which events were taken down since they were last compacted
+	dirtyLogs map[string]bool
 }
 
 type persistJob struct {
@@ -75,7 +83,14 @@ type DiskPersistOptions struct {
 	DIDCacheSize    int
 	EventsPerFile   int64
 	WriteBufferSize int
-	Retention       time.Duration
+	// Events files created longer ago than this are deleted
+	Retention time.Duration
+	// If non-zero, the oldest events files are deleted while all of them add up to more than this many bytes
+	MaxBytes int64
+	// Rewrite events files without the events which were taken down in them, to reclaim their space
+	CompactTakedowns bool
+	// How often retention and compaction run; an hour if zero
+	GCInterval time.Duration
 }
 
 func DefaultDiskPersistOptions() *DiskPersistOptions {
@@ -85,6 +100,7 @@ func DefaultDiskPersistOptions() *DiskPersistOptions {
 		DIDCacheSize:    100_000,
 		WriteBufferSize: 50,
 		Retention:       time.Hour * 24 * 3, // 3 days
+		GCInterval:      time.Hour,
 	}
 }
 
@@ -123,6 +139,9 @@ func NewDiskPersistence(primaryDir, archiveDir string, db *gorm.DB, opts *DiskPe
 		archiveDir:      archiveDir,
 		buffers:         bufpool,
 		retention:       opts.Retention,
+		maxBytes:        opts.MaxBytes,
+		compact:         opts.CompactTakedowns,
+		gcInterval:      opts.GCInterval,
 		writers:         wrpool,
 		uidCache:        uidCache,
 		didCache:        didCache,
@@ -131,6 +150,10 @@ func NewDiskPersistence(primaryDir, archiveDir string, db *gorm.DB, opts *DiskPe
 		outbuf:          new(bytes.Buffer),
 		writeBufferSize: opts.WriteBufferSize,
 		shutdown:        make(chan struct{}),
+		dirtyLogs:       make(map[string]bool),
+	}
+	if dp.gcInterval == 0 {
+		dp.gcInterval = time.Hour
 	}
 
 	if err := dp.resumeLog(); err != nil {
@@ -276,6 +299,7 @@ const (
 	evtKindCommit    = 1
 	evtKindHandle    = 2
 	evtKindTombstone = 3
+	evtKindIdentity  = 4
 )
 
 var emptyHeader = make([]byte, headerSize)
@@ -341,7 +365,7 @@ func (dp *DiskPersistence) flushLog(ctx context.Context) error {
 }
 
 func (dp *DiskPersistence) garbageCollectRoutine() {
-	t := time.NewTicker(time.Hour)
+	t := time.NewTicker(dp.gcInterval)
 
 	for {
 		ctx := context.Background()
@@ -379,6 +403,36 @@ var filesGarbageCollected = promauto.NewCounterVec(prometheus.CounterOpts{
 	Help: "Number of files collected during garbage collection",
 }, []string{})
 
+var bytesCompacted = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "disk_persister_compaction_bytes_reclaimed",
+	Help: "Number of bytes of taken down events reclaimed by compaction",
+}, []string{})
+
+var playbackWindowBytes = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "disk_persister_playback_window_bytes",
+	Help: "Total size of the events files available for playback",
+})
+
+var playbackWindowFiles = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "disk_persister_playback_window_files",
+	Help: "Number of events files available for playback",
+})
+
+var playbackWindowEvents = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "disk_persister_playback_window_events",
+	Help: "Number of sequence numbers available for playback, from the oldest events file",
+})
+
+var playbackWindowSeconds = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "disk_persister_playback_window_seconds",
+	Help: "Age of the oldest events file available for playback",
+})
+
+// GarbageCollect deletes the events files which are past the retention period (or over the size limit), and compacts those in which events were taken down, if enabled. It runs periodically in the background, and can also be called directly.
+func (dp *DiskPersistence) GarbageCollect(ctx context.Context) error {
+	return errors.Join(dp.garbageCollect(ctx)...)
+}
+
 func (dp *DiskPersistence) garbageCollect(ctx context.Context) []error {
 	garbageCollectionsExecuted.WithLabelValues().Inc()
 
@@ -395,48 +449,197 @@ func (dp *DiskPersistence) garbageCollect(ctx context.Context) []error {
 	}
 
 	oldRefsFound := len(refs)
-	refsDeleted := 0
 	filesDeleted := 0
 
 	// In the future if we want to support Archiving, we could do that here instead of deleting
 	for _, r := range refs {
-		dp.lk.Lock()
-		currentLogfile := dp.logfi.Name()
-		dp.lk.Unlock()
-
-		if filepath.Join(dp.primaryDir, r.Path) == currentLogfile {
+		if dp.isCurrentLogfile(r) {
 			// Don't delete the current log file
 			log.Info("skipping deletion of current log file")
 			continue
 		}
 
-		// Delete the ref in the database to prevent playback from finding it
-		if err := dp.meta.WithContext(ctx).Delete(&r).Error; err != nil {
+		if err := dp.deleteLogfile(ctx, r); err != nil {
 			errs = append(errs, err)
 			continue
 		}
-		refsDeleted++
+		filesDeleted++
+	}
 
-		// Delete the file from disk
-		if err := os.Remove(filepath.Join(dp.primaryDir, r.Path)); err != nil {
-			errs = append(errs, err)
+	if dp.compact {
+		errs = append(errs, dp.compactLogfiles(ctx)...)
+	}
+
+	// with the remaining files, enforce the size limit (oldest first) and update the playback window metrics
+	if err := dp.meta.WithContext(ctx).Order("seq_start asc").Find(&refs, "archived = ?", false).Error; err != nil {
+		return append(errs, err)
+	}
+	sizes := make([]int64, len(refs))
+	var total int64
+	for i, r := range refs {
+		st, err := os.Stat(filepath.Join(dp.primaryDir, r.Path))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, err)
+			}
 			continue
 		}
+		sizes[i] = st.Size()
+		total += sizes[i]
+	}
+	for dp.maxBytes > 0 && total > dp.maxBytes && len(refs) > 0 && !dp.isCurrentLogfile(refs[0]) {
+		if err := dp.deleteLogfile(ctx, refs[0]); err != nil {
+			errs = append(errs, err)
+			break
+		}
 		filesDeleted++
+		total -= sizes[0]
+		refs, sizes = refs[1:], sizes[1:]
 	}
 
-	refsGarbageCollected.WithLabelValues().Add(float64(refsDeleted))
-	filesGarbageCollected.WithLabelValues().Add(float64(filesDeleted))
+	playbackWindowBytes.Set(float64(total))
+	playbackWindowFiles.Set(float64(len(refs)))
+	if len(refs) > 0 {
+		dp.lk.Lock()
+		curSeq := dp.curSeq
+		dp.lk.Unlock()
+		playbackWindowEvents.Set(float64(curSeq - refs[0].SeqStart))
+		playbackWindowSeconds.Set(time.Since(refs[0].CreatedAt).Seconds())
+	}
 
 	log.Infow("garbage collection complete",
 		"filesDeleted", filesDeleted,
-		"refsDeleted", refsDeleted,
 		"oldRefsFound", oldRefsFound,
+		"totalBytes", total,
 	)
 
 	return errs
 }
 
+func (dp *DiskPersistence) isCurrentLogfile(r LogFileRef) bool {
+	dp.lk.Lock()
+	defer dp.lk.Unlock()
+	return filepath.Join(dp.primaryDir, r.Path) == dp.logfi.Name()
+}
+
+// Deletes the ref of an events file, and then the file.
+func (dp *DiskPersistence) deleteLogfile(ctx context.Context, r LogFileRef) error {
+	// Delete the ref in the database to prevent playback from finding it
+	if err := dp.meta.WithContext(ctx).Delete(&r).Error; err != nil {
+		return err
+	}
+	refsGarbageCollected.WithLabelValues().Inc()
+
+	// Delete the file from disk
+	if err := os.Remove(filepath.Join(dp.primaryDir, r.Path)); err != nil {
+		return err
+	}
+	filesGarbageCollected.WithLabelValues().Inc()
+	return nil
+}
+
+// Rewrites the events files (other than the current one) in which events were taken down.
+func (dp *DiskPersistence) compactLogfiles(ctx context.Context) []error {
+	dp.compactLk.Lock()
+	defer dp.compactLk.Unlock()
+
+	dp.lk.Lock()
+	current := dp.logfi.Name()
+	dp.lk.Unlock()
+
+	var errs []error
+	for fn := range dp.dirtyLogs {
+		if fn == current {
+			continue
+		}
+		reclaimed, err := compactLogfile(fn)
+		if err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("compacting %s: %w", fn, err))
+			continue
+		}
+		bytesCompacted.WithLabelValues().Add(float64(reclaimed))
+		delete(dp.dirtyLogs, fn)
+	}
+	return errs
+}
+
+// Rewrites an events file without its taken down events, and returns how many bytes were reclaimed. If the last event of the file was taken down, its header is kept (without the event itself), as its sequence number tells playback whether the file was full.
+func compactLogfile(fn string) (int64, error) {
+	in, err := os.Open(fn)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	st, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	tmp := fn + ".compact"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	// a no-op once it's renamed
+	defer os.Remove(tmp)
+	defer out.Close()
+
+	bufr := bufio.NewReader(in)
+	bufw := bufio.NewWriter(out)
+	scratch := make([]byte, headerSize)
+	// the header of the last event, if it was taken down
+	var dropped []byte
+	var written int64
+	for {
+		h, err := readHeader(bufr, scratch)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return 0, err
+		}
+
+		if h.Flags&EvtFlagTakedown != 0 {
+			if _, err := io.CopyN(io.Discard, bufr, h.Len64()); err != nil {
+				return 0, err
+			}
+			dropped = append(dropped[:0], scratch...)
+			continue
+		}
+		dropped = dropped[:0]
+
+		if _, err := bufw.Write(scratch); err != nil {
+			return 0, err
+		}
+		n, err := io.CopyN(bufw, bufr, h.Len64())
+		if err != nil {
+			return 0, err
+		}
+		written += headerSize + n
+	}
+	if len(dropped) > 0 {
+		binary.LittleEndian.PutUint32(dropped[8:12], 0)
+		if _, err := bufw.Write(dropped); err != nil {
+			return 0, err
+		}
+		written += headerSize
+	}
+
+	if err := bufw.Flush(); err != nil {
+		return 0, err
+	}
+	if err := out.Sync(); err != nil {
+		return 0, err
+	}
+	if err := out.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, fn); err != nil {
+		return 0, err
+	}
+	return st.Size() - written, nil
+}
+
 func (dp *DiskPersistence) doPersist(ctx context.Context, j persistJob) error {
 	b := j.Bytes
 	e := j.Evt
@@ -453,8 +656,10 @@ func (dp *DiskPersistence) doPersist(ctx context.Context, j persistJob) error {
 		e.RepoHandle.Seq = seq
 	case e.RepoTombstone != nil:
 		e.RepoTombstone.Seq = seq
+	case e.RepoIdentity != nil:
+		e.RepoIdentity.Seq = seq
 	default:
-		// only those three get peristed right now
+		// only those four get peristed right now
 		// we should not actually ever get here...
 		return nil
 	}
@@ -511,6 +716,12 @@ func (dp *DiskPersistence) Persist(ctx context.Context, e *XRPCStreamEvent) erro
 		if err := e.RepoTombstone.MarshalCBOR(cw); err != nil {
 			return fmt.Errorf("failed to marshal: %w", err)
 		}
+	case e.RepoIdentity != nil:
+		evtKind = evtKindIdentity
+		did = e.RepoIdentity.Did
+		if err := e.RepoIdentity.MarshalCBOR(cw); err != nil {
+			return fmt.Errorf("failed to marshal: %w", err)
+		}
 	default:
 		return nil
 		// only those two get peristed right now
@@ -614,6 +825,19 @@ func (dp *DiskPersistence) uidForDid(ctx context.Context, did string) (models.Ui
 }
 
 func (dp *DiskPersistence) Playback(ctx context.Context, since int64, cb func(*XRPCStreamEvent) error) error {
+	return dp.playback(ctx, since, 0, cb)
+}
+
+// PlaybackUser replays persisted events for a single account, skipping over the events of other accounts without decoding them.
+func (dp *DiskPersistence) PlaybackUser(ctx context.Context, usr models.Uid, since int64, cb func(*XRPCStreamEvent) error) error {
+	if usr == 0 {
+		return fmt.Errorf("must specify a user for playback")
+	}
+	return dp.playback(ctx, since, usr, cb)
+}
+
+// if usr is non-zero, only events for that user are played back
+func (dp *DiskPersistence) playback(ctx context.Context, since int64, usr models.Uid, cb func(*XRPCStreamEvent) error) error {
 	base := since - (since % dp.eventsPerFile)
 	var logs []LogFileRef
 	if err := dp.meta.Debug().Order("seq_start asc").Find(&logs, "seq_start >= ?", base).Error; err != nil {
@@ -621,7 +845,7 @@ func (dp *DiskPersistence) Playback(ctx context.Context, since int64, cb func(*X
 	}
 
 	for i := 0; i < 10; i++ {
-		lastSeq, err := dp.PlaybackLogfiles(ctx, since, cb, logs)
+		lastSeq, err := dp.playbackLogfiles(ctx, since, usr, cb, logs)
 		if err != nil {
 			return err
 		}
@@ -641,8 +865,12 @@ func (dp *DiskPersistence) Playback(ctx context.Context, since int64, cb func(*X
 }
 
 func (dp *DiskPersistence) PlaybackLogfiles(ctx context.Context, since int64, cb func(*XRPCStreamEvent) error, logFiles []LogFileRef) (*int64, error) {
+	return dp.playbackLogfiles(ctx, since, 0, cb, logFiles)
+}
+
+func (dp *DiskPersistence) playbackLogfiles(ctx context.Context, since int64, usr models.Uid, cb func(*XRPCStreamEvent) error, logFiles []LogFileRef) (*int64, error) {
 	for i, lf := range logFiles {
-		lastSeq, err := dp.readEventsFrom(ctx, since, filepath.Join(dp.primaryDir, lf.Path), cb)
+		lastSeq, err := dp.readEventsFrom(ctx, since, usr, filepath.Join(dp.primaryDir, lf.Path), cb)
 		if err != nil {
 			return nil, err
 		}
@@ -666,7 +894,8 @@ func postDoNotEmit(flags uint32) bool {
 	return false
 }
 
-func (dp *DiskPersistence) readEventsFrom(ctx context.Context, since int64, fn string, cb func(*XRPCStreamEvent) error) (*int64, error) {
+// if usr is non-zero, events for other users are skipped
+func (dp *DiskPersistence) readEventsFrom(ctx context.Context, since int64, usr models.Uid, fn string, cb func(*XRPCStreamEvent) error) (*int64, error) {
 	fi, err := os.OpenFile(fn, os.O_RDONLY, 0)
 	if err != nil {
 		return nil, err
@@ -704,8 +933,8 @@ func (dp *DiskPersistence) readEventsFrom(ctx context.Context, since int64, fn s
 
 		lastSeq = h.Seq
 
-		if postDoNotEmit(h.Flags) {
-			// event taken down, skip
+		if postDoNotEmit(h.Flags) || (usr != 0 && h.Usr != usr) {
+			// event taken down (or for another user), skip
 			_, err := io.CopyN(io.Discard, bufr, h.Len64()) // would be really nice if the buffered reader had a 'skip' method that does a seek under the hood
 			if err != nil {
 				return nil, fmt.Errorf("failed while skipping event (seq: %d, fn: %q): %w", h.Seq, fn, err)
@@ -741,6 +970,15 @@ func (dp *DiskPersistence) readEventsFrom(ctx context.Context, since int64, fn s
 			if err := cb(&XRPCStreamEvent{RepoTombstone: &evt}); err != nil {
 				return nil, err
 			}
+		case evtKindIdentity:
+			var evt atproto.SyncSubscribeRepos_Identity
+			if err := evt.UnmarshalCBOR(io.LimitReader(bufr, h.Len64())); err != nil {
+				return nil, err
+			}
+			evt.Seq = h.Seq
+			if err := cb(&XRPCStreamEvent{RepoIdentity: &evt}); err != nil {
+				return nil, err
+			}
 		default:
 			log.Warnw("unrecognized event kind coming from log file", "seq", h.Seq, "kind", h.Kind)
 			return nil, fmt.Errorf("halting on unrecognized event kind")
@@ -757,6 +995,9 @@ type UserAction struct {
 }
 
 func (dp *DiskPersistence) TakeDownRepo(ctx context.Context, usr models.Uid) error {
+	dp.compactLk.Lock()
+	defer dp.compactLk.Unlock()
+
 	/*
 		if err := p.meta.Create(&UserAction{
 			Usr:      usr,
@@ -822,6 +1063,7 @@ func (dp *DiskPersistence) deleteEventsForUser(ctx context.Context, usr models.U
 	return dp.mutateUserEventsInLog(ctx, usr, fn, EvtFlagTakedown, true)
 }
 
+// must only be called while holding dp.compactLk
 func (dp *DiskPersistence) mutateUserEventsInLog(ctx context.Context, usr models.Uid, fn string, flag uint32, zeroEvts bool) error {
 	fi, err := os.OpenFile(fn, os.O_RDWR, 0)
 	if err != nil {
@@ -843,6 +1085,7 @@ func (dp *DiskPersistence) mutateUserEventsInLog(ctx context.Context, usr models
 		}
 
 		if h.Usr == usr && h.Flags&flag == 0 {
+			dp.dirtyLogs[fn] = true
 			nflag := h.Flags | flag
 
 			binary.LittleEndian.PutUint32(scratch, nflag)
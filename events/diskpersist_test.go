@@ -339,6 +339,21 @@ func runEventManagerTest(t *testing.T, cs *carstore.CarStore, db *gorm.DB, p eve
 	testSize := 100 // you can adjust this number as needed
 	inEvts := make([]*events.XRPCStreamEvent, testSize)
 	for i := 0; i < testSize; i++ {
+		if i%10 == 5 {
+			handle := fmt.Sprintf("alice%d.test", i)
+			inEvts[i] = &events.XRPCStreamEvent{
+				RepoIdentity: &atproto.SyncSubscribeRepos_Identity{
+					Did:    "did:example:123",
+					Handle: &handle,
+					Time:   time.Now().Format(util.ISO8601),
+				},
+			}
+			if err := evtman.AddEvent(ctx, inEvts[i]); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+
 		cidLink := lexutil.LexLink(cid)
 		headLink := lexutil.LexLink(userRepoHead)
 		inEvts[i] = &events.XRPCStreamEvent{
@@ -483,6 +498,21 @@ func runTakedownTest(t *testing.T, cs *carstore.CarStore, db *gorm.DB, p events.
 		t.Fatal(err)
 	}
 
+	// Per-user playback only returns that user's events
+	userEvts := 0
+	if err := evtman.PlaybackUser(ctx, users[2].Uid, users[2].Did, 0, func(evt *events.XRPCStreamEvent) error {
+		userEvts++
+		if evt.RepoCommit.Repo != users[2].Did {
+			t.Fatalf("found event for another user (%s) in user playback", evt.RepoCommit.Repo)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if userEvts != testSize {
+		t.Fatalf("expected %d events in user playback, got %d", testSize, userEvts)
+	}
+
 	// Pick a user to take down
 	takeDownUser := users[5] // For example, user with UID 6 (0-indexed)
 
@@ -490,6 +520,13 @@ func runTakedownTest(t *testing.T, cs *carstore.CarStore, db *gorm.DB, p events.
 		t.Fatal(err)
 	}
 
+	if err := evtman.PlaybackUser(ctx, takeDownUser.Uid, takeDownUser.Did, 0, func(evt *events.XRPCStreamEvent) error {
+		t.Fatalf("found event for user %d in user playback after takedown", takeDownUser.Uid)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
 	// Verify that the events of the user have been removed from the event stream
 	var evtsCount int
 	if err := p.Playback(ctx, 0, func(evt *events.XRPCStreamEvent) error {
@@ -507,3 +544,95 @@ func runTakedownTest(t *testing.T, cs *carstore.CarStore, db *gorm.DB, p events.
 		t.Fatalf("wrong number of events out: %d != %d", evtsCount, exp)
 	}
 }
+
+func TestDiskPersisterRetention(t *testing.T) {
+	ctx := context.Background()
+
+	db, _, cs, tempPath, err := setupDBs(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(tempPath)
+
+	primaryDir := filepath.Join(tempPath, "diskPrimary")
+	dp, err := events.NewDiskPersistence(primaryDir, filepath.Join(tempPath, "diskArchive"), db, &events.DiskPersistOptions{
+		EventsPerFile:    10,
+		UIDCacheSize:     100000,
+		DIDCacheSize:     100000,
+		Retention:        time.Hour,
+		CompactTakedowns: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// leaves a tenth of the events taken down
+	runTakedownTest(t, cs, db, dp)
+
+	dirSize := func() int64 {
+		var total int64
+		entries, err := os.ReadDir(primaryDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range entries {
+			info, err := e.Info()
+			if err != nil {
+				t.Fatal(err)
+			}
+			total += info.Size()
+		}
+		return total
+	}
+	countEvents := func(p events.EventPersistence) int {
+		n := 0
+		if err := p.Playback(ctx, 0, func(evt *events.XRPCStreamEvent) error {
+			n++
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	before := dirSize()
+	if err := dp.GarbageCollect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	after := dirSize()
+	if after >= before*95/100 {
+		t.Fatalf("compaction did not reclaim space: %d bytes before, %d after", before, after)
+	}
+	// nothing is past the retention period, and playback skips over the compacted events
+	if n := countEvents(dp); n != 900 {
+		t.Fatalf("wrong number of events after compaction: %d", n)
+	}
+
+	if err := dp.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	dp2, err := events.NewDiskPersistence(primaryDir, filepath.Join(tempPath, "diskArchive"), db, &events.DiskPersistOptions{
+		EventsPerFile: 10,
+		UIDCacheSize:  100000,
+		DIDCacheSize:  100000,
+		Retention:     time.Hour,
+		MaxBytes:      after / 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dp2.Shutdown(ctx)
+
+	if err := dp2.GarbageCollect(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if size := dirSize(); size > after/2 {
+		t.Fatalf("events files add up to %d bytes, over the limit of %d", size, after/2)
+	}
+	// the oldest events were deleted, and playback starts from the oldest remaining
+	if n := countEvents(dp2); n < 400 || n > 450 {
+		t.Fatalf("wrong number of events after enforcing the size limit: %d", n)
+	}
+}
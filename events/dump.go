@@ -0,0 +1,234 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"golang.org/x/time/rate"
+)
+
+// Dumps start with this line, followed by the events as length-prefixed (unsigned varint) event stream frames.
+const dumpMagic = "indigo-events-dump-v1\n"
+
+// frames larger than this are assumed to be corrupted dumps
+const maxDumpFrameSize = 32 << 20
+
+// DumpWriter writes events to a dump, which can be read back with a DumpReader or Replay. Flush must be called once all events were written.
+type DumpWriter struct {
+	w   *bufio.Writer
+	buf bytes.Buffer
+	len [binary.MaxVarintLen64]byte
+}
+
+func NewDumpWriter(w io.Writer) (*DumpWriter, error) {
+	dw := &DumpWriter{w: bufio.NewWriter(w)}
+	if _, err := dw.w.WriteString(dumpMagic); err != nil {
+		return nil, err
+	}
+	return dw, nil
+}
+
+func (dw *DumpWriter) Write(evt *XRPCStreamEvent) error {
+	dw.buf.Reset()
+	if err := evt.WriteFrame(&dw.buf); err != nil {
+		return err
+	}
+	n := binary.PutUvarint(dw.len[:], uint64(dw.buf.Len()))
+	if _, err := dw.w.Write(dw.len[:n]); err != nil {
+		return err
+	}
+	_, err := dw.w.Write(dw.buf.Bytes())
+	return err
+}
+
+func (dw *DumpWriter) Flush() error {
+	return dw.w.Flush()
+}
+
+// DumpReader reads the events of a dump, in the order they were written.
+type DumpReader struct {
+	r *bufio.Reader
+}
+
+func NewDumpReader(r io.Reader) (*DumpReader, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(dumpMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != dumpMagic {
+		return nil, fmt.Errorf("not an events dump")
+	}
+	return &DumpReader{r: br}, nil
+}
+
+// Next returns the next event of the dump, or io.EOF after the last one. Frames of unknown message types are skipped.
+func (dr *DumpReader) Next() (*XRPCStreamEvent, error) {
+	for {
+		size, err := binary.ReadUvarint(dr.r)
+		if err != nil {
+			// io.EOF if the dump ended cleanly, after a frame
+			return nil, err
+		}
+		if size > maxDumpFrameSize {
+			return nil, fmt.Errorf("dump frame too large (%d bytes)", size)
+		}
+
+		d := getFrameDecoder()
+		if err := d.readFrame(io.LimitReader(dr.r, int64(size))); err != nil {
+			putFrameDecoder(d)
+			return nil, err
+		}
+		if d.buf.Len() < int(size) {
+			putFrameDecoder(d)
+			return nil, io.ErrUnexpectedEOF
+		}
+		df, err := d.decode()
+		putFrameDecoder(d)
+		if err != nil {
+			return nil, fmt.Errorf("decoding dump frame: %w", err)
+		}
+		if df.evt != nil {
+			return df.evt, nil
+		}
+	}
+}
+
+var errExportDone = errors.New("export done")
+
+// ExportRange writes the persisted events with sequence numbers from from to to (both included; zero for no upper bound) to w, as a dump. It returns the number of events written.
+func ExportRange(ctx context.Context, p EventPersistence, from, to int64, w io.Writer) (int, error) {
+	dw, err := NewDumpWriter(w)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = p.Playback(ctx, max(from-1, 0), func(evt *XRPCStreamEvent) error {
+		seq := evt.Sequence()
+		if to > 0 && seq > to {
+			return errExportDone
+		}
+		if seq < from {
+			return nil
+		}
+		if err := dw.Write(evt); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if err != nil && !errors.Is(err, errExportDone) {
+		return n, err
+	}
+	return n, dw.Flush()
+}
+
+// ExportRange writes a range of persisted events to w, as a dump; see the ExportRange function.
+func (em *EventManager) ExportRange(ctx context.Context, from, to int64, w io.Writer) (int, error) {
+	return ExportRange(ctx, em.persister, from, to, w)
+}
+
+type ReplayOptions struct {
+	// Replay speed, relative to the time between events (according to their "time" field): 1 replays at the original pace, 10 ten times faster; zero replays as fast as possible
+	Speed float64
+	// If set, events are instead replayed at this fixed rate, in events per second
+	Rate float64
+	// Only events with sequence numbers from From to To (both included; zero for no bound) are replayed
+	From int64
+	To   int64
+}
+
+// Replay reads the events of a dump, and passes them to cb (like the AddWork method of a scheduler, or the handler of a firehose.Consumer) at the pace set by opts, until the end of the dump, or until cb returns an error.
+func Replay(ctx context.Context, r io.Reader, opts ReplayOptions, cb func(context.Context, *XRPCStreamEvent) error) error {
+	dr, err := NewDumpReader(r)
+	if err != nil {
+		return err
+	}
+	var limiter *rate.Limiter
+	if opts.Rate > 0 {
+		limiter = rate.NewLimiter(rate.Limit(opts.Rate), 1)
+	}
+	// the time of the first event, and when it was replayed
+	var first, start time.Time
+	for {
+		evt, err := dr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if seq := evt.Sequence(); seq >= 0 {
+			if seq < opts.From {
+				continue
+			}
+			if opts.To > 0 && seq > opts.To {
+				return nil
+			}
+		}
+
+		switch {
+		case limiter != nil:
+			if err := limiter.Wait(ctx); err != nil {
+				return err
+			}
+		case opts.Speed > 0:
+			t, ok := eventTime(evt)
+			if !ok {
+				break
+			}
+			if first.IsZero() {
+				first, start = t, time.Now()
+				break
+			}
+			wait := time.Until(start.Add(time.Duration(float64(t.Sub(first)) / opts.Speed)))
+			if wait <= 0 {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(wait):
+			}
+		default:
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		if err := cb(ctx, evt); err != nil {
+			return err
+		}
+	}
+}
+
+// Returns the time at which an event was emitted, if it has one.
+func eventTime(evt *XRPCStreamEvent) (time.Time, bool) {
+	var raw string
+	switch {
+	case evt.RepoCommit != nil:
+		raw = evt.RepoCommit.Time
+	case evt.RepoHandle != nil:
+		raw = evt.RepoHandle.Time
+	case evt.RepoMigrate != nil:
+		raw = evt.RepoMigrate.Time
+	case evt.RepoTombstone != nil:
+		raw = evt.RepoTombstone.Time
+	case evt.RepoIdentity != nil:
+		raw = evt.RepoIdentity.Time
+	case evt.RepoAccount != nil:
+		raw = evt.RepoAccount.Time
+	default:
+		return time.Time{}, false
+	}
+	dt, err := syntax.ParseDatetimeLenient(raw)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return dt.Time(), true
+}
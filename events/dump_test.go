@@ -0,0 +1,75 @@
+package events_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	atproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpExportReplay(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// events one second apart
+	mp := events.NewMemPersister()
+	mp.SetEventBroadcaster(func(*events.XRPCStreamEvent) {})
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		evt := &events.XRPCStreamEvent{RepoIdentity: &atproto.SyncSubscribeRepos_Identity{
+			Did:  fmt.Sprintf("did:plc:%d", i),
+			Time: base.Add(time.Duration(i) * time.Second).Format(time.RFC3339Nano),
+		}}
+		assert.NoError(mp.Persist(ctx, evt))
+	}
+
+	buf := new(bytes.Buffer)
+	n, err := events.ExportRange(ctx, mp, 3, 8, buf)
+	assert.NoError(err)
+	assert.Equal(6, n)
+	dump := buf.Bytes()
+
+	replay := func(opts events.ReplayOptions, r io.Reader) ([]int64, error) {
+		var seqs []int64
+		err := events.Replay(ctx, r, opts, func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+			seqs = append(seqs, evt.Sequence())
+			return nil
+		})
+		return seqs, err
+	}
+
+	seqs, err := replay(events.ReplayOptions{}, bytes.NewReader(dump))
+	assert.NoError(err)
+	assert.Equal([]int64{3, 4, 5, 6, 7, 8}, seqs)
+
+	seqs, err = replay(events.ReplayOptions{From: 5, To: 6}, bytes.NewReader(dump))
+	assert.NoError(err)
+	assert.Equal([]int64{5, 6}, seqs)
+
+	// two seconds of events, twenty times faster
+	start := time.Now()
+	seqs, err = replay(events.ReplayOptions{Speed: 20, From: 4, To: 6}, bytes.NewReader(dump))
+	assert.NoError(err)
+	assert.Equal([]int64{4, 5, 6}, seqs)
+	assert.GreaterOrEqual(time.Since(start), 90*time.Millisecond)
+
+	// errors from the callback stop the replay
+	stop := errors.New("stop")
+	err = events.Replay(ctx, bytes.NewReader(dump), events.ReplayOptions{}, func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+		return stop
+	})
+	assert.ErrorIs(err, stop)
+
+	_, err = replay(events.ReplayOptions{}, bytes.NewReader(dump[:len(dump)-3]))
+	assert.ErrorIs(err, io.ErrUnexpectedEOF)
+	_, err = replay(events.ReplayOptions{}, bytes.NewReader([]byte("not a dump at all, really")))
+	assert.ErrorContains(err, "not an events dump")
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 
 	logging "github.com/ipfs/go-log"
+	cbg "github.com/whyrusleeping/cbor-gen"
 	"go.opentelemetry.io/otel"
 )
 
@@ -141,6 +143,8 @@ type XRPCStreamEvent struct {
 	RepoInfo      *comatproto.SyncSubscribeRepos_Info
 	RepoMigrate   *comatproto.SyncSubscribeRepos_Migrate
 	RepoTombstone *comatproto.SyncSubscribeRepos_Tombstone
+	RepoIdentity  *comatproto.SyncSubscribeRepos_Identity
+	RepoAccount   *comatproto.SyncSubscribeRepos_Account
 	LabelLabels   *label.SubscribeLabels_Labels
 	LabelInfo     *label.SubscribeLabels_Info
 
@@ -207,7 +211,7 @@ func (em *EventManager) Subscribe(ctx context.Context, ident string, filter func
 			case <-done:
 				return ErrPlaybackShutdown
 			case out <- e:
-				seq := sequenceForEvent(e)
+				seq := e.Sequence()
 				if seq > 0 {
 					lastSeq = seq
 				}
@@ -232,8 +236,8 @@ func (em *EventManager) Subscribe(ctx context.Context, ident string, filter func
 
 		// run playback again to get us to the events that have started buffering
 		if err := em.persister.Playback(ctx, lastSeq, func(e *XRPCStreamEvent) error {
-			seq := sequenceForEvent(e)
-			if seq > sequenceForEvent(first) {
+			seq := e.Sequence()
+			if seq > first.Sequence() {
 				return ErrCaughtUp
 			}
 
@@ -268,7 +272,63 @@ func (em *EventManager) Subscribe(ctx context.Context, ident string, filter func
 	return out, sub.cleanup, nil
 }
 
-func sequenceForEvent(evt *XRPCStreamEvent) int64 {
+func (em *EventManager) rmSubscriber(sub *Subscriber) {
+	em.subsLk.Lock()
+	defer em.subsLk.Unlock()
+
+	for i, s := range em.subs {
+		if s == sub {
+			em.subs[i] = em.subs[len(em.subs)-1]
+			em.subs = em.subs[:len(em.subs)-1]
+			break
+		}
+	}
+}
+
+func (em *EventManager) addSubscriber(sub *Subscriber) {
+	em.subsLk.Lock()
+	defer em.subsLk.Unlock()
+
+	em.subs = append(em.subs, sub)
+}
+
+// PlaybackUser replays the persisted events (within the persister's retention window) for a single account, starting after the given sequence number. The account is identified by both uid and DID: persisters which implement UserEventPlayback look up events by uid, and otherwise a full playback is filtered by DID.
+//
+// Playback can be stopped early by returning an error from the callback, which is passed through.
+func (em *EventManager) PlaybackUser(ctx context.Context, usr models.Uid, did string, since int64, cb func(*XRPCStreamEvent) error) error {
+	if up, ok := em.persister.(UserEventPlayback); ok {
+		return up.PlaybackUser(ctx, usr, since, cb)
+	}
+	return em.persister.Playback(ctx, since, func(evt *XRPCStreamEvent) error {
+		if evt.RepoDID() != did {
+			return nil
+		}
+		return cb(evt)
+	})
+}
+
+// RepoDID returns the DID of the account the event is about, or an empty string for events which are not account-specific.
+func (evt *XRPCStreamEvent) RepoDID() string {
+	switch {
+	case evt.RepoCommit != nil:
+		return evt.RepoCommit.Repo
+	case evt.RepoHandle != nil:
+		return evt.RepoHandle.Did
+	case evt.RepoMigrate != nil:
+		return evt.RepoMigrate.Did
+	case evt.RepoTombstone != nil:
+		return evt.RepoTombstone.Did
+	case evt.RepoIdentity != nil:
+		return evt.RepoIdentity.Did
+	case evt.RepoAccount != nil:
+		return evt.RepoAccount.Did
+	default:
+		return ""
+	}
+}
+
+// Sequence returns the sequence number of the event, or -1 for events without one (like info messages and error frames) and for a nil event.
+func (evt *XRPCStreamEvent) Sequence() int64 {
 	switch {
 	case evt == nil:
 		return -1
@@ -280,33 +340,78 @@ func sequenceForEvent(evt *XRPCStreamEvent) int64 {
 		return evt.RepoMigrate.Seq
 	case evt.RepoTombstone != nil:
 		return evt.RepoTombstone.Seq
-	case evt.RepoInfo != nil:
-		return -1
-	case evt.Error != nil:
-		return -1
+	case evt.RepoIdentity != nil:
+		return evt.RepoIdentity.Seq
+	case evt.RepoAccount != nil:
+		return evt.RepoAccount.Seq
+	case evt.LabelLabels != nil:
+		return evt.LabelLabels.Seq
 	default:
 		return -1
 	}
 }
 
-func (em *EventManager) rmSubscriber(sub *Subscriber) {
-	em.subsLk.Lock()
-	defer em.subsLk.Unlock()
-
-	for i, s := range em.subs {
-		if s == sub {
-			em.subs[i] = em.subs[len(em.subs)-1]
-			em.subs = em.subs[:len(em.subs)-1]
-			break
-		}
+// MessageType returns the message type of the event in the stream, like "#commit", or an empty string for error frames.
+func (evt *XRPCStreamEvent) MessageType() string {
+	switch {
+	case evt.RepoCommit != nil:
+		return "#commit"
+	case evt.RepoHandle != nil:
+		return "#handle"
+	case evt.RepoInfo != nil, evt.LabelInfo != nil:
+		return "#info"
+	case evt.RepoMigrate != nil:
+		return "#migrate"
+	case evt.RepoTombstone != nil:
+		return "#tombstone"
+	case evt.RepoIdentity != nil:
+		return "#identity"
+	case evt.RepoAccount != nil:
+		return "#account"
+	case evt.LabelLabels != nil:
+		return "#labels"
+	default:
+		return ""
 	}
 }
 
-func (em *EventManager) addSubscriber(sub *Subscriber) {
-	em.subsLk.Lock()
-	defer em.subsLk.Unlock()
+// WriteFrame writes the event as a frame of an event stream: the CBOR of the frame header, followed by that of the message (or error).
+func (evt *XRPCStreamEvent) WriteFrame(w io.Writer) error {
+	header := EventHeader{Op: EvtKindMessage, MsgType: evt.MessageType()}
+	var obj cbg.CBORMarshaler
+	switch {
+	case evt.Error != nil:
+		header = EventHeader{Op: EvtKindErrorFrame}
+		obj = evt.Error
+	case evt.RepoCommit != nil:
+		obj = evt.RepoCommit
+	case evt.RepoHandle != nil:
+		obj = evt.RepoHandle
+	case evt.RepoInfo != nil:
+		obj = evt.RepoInfo
+	case evt.RepoMigrate != nil:
+		obj = evt.RepoMigrate
+	case evt.RepoTombstone != nil:
+		obj = evt.RepoTombstone
+	case evt.RepoIdentity != nil:
+		obj = evt.RepoIdentity
+	case evt.RepoAccount != nil:
+		obj = evt.RepoAccount
+	case evt.LabelLabels != nil:
+		obj = evt.LabelLabels
+	case evt.LabelInfo != nil:
+		obj = evt.LabelInfo
+	default:
+		return fmt.Errorf("unrecognized event kind")
+	}
 
-	em.subs = append(em.subs, sub)
+	if err := header.MarshalCBOR(w); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+	if err := obj.MarshalCBOR(w); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	return nil
 }
 
 func (em *EventManager) TakeDownRepo(ctx context.Context, user models.Uid) error {
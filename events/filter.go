@@ -0,0 +1,154 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// EventFilter selects the events of a repo stream which a consumer is interested in, so that narrow consumers can drop most of the stream before scheduling or decoding records. Fields which are not set match all events.
+type EventFilter struct {
+	// Message types to keep, like "#commit" or "#identity"; error frames are always kept
+	Types []string
+	// DIDs of the repos to keep events of; events which are not about a repo (like info messages) are kept. The map must not be modified while the filter is in use
+	DIDs map[string]bool
+	// Collection NSIDs to keep the record operations of, like "app.bsky.feed.post"; those ending with a dot, like "app.bsky.graph.", match a whole namespace. Other operations are removed from commits, and commits left without operations are dropped
+	Collections []string
+}
+
+// Apply returns the event if it matches the filter, a copy of it if the operations of a commit had to be trimmed, or nil if it should be dropped. The event itself is not modified.
+func (f *EventFilter) Apply(xev *XRPCStreamEvent) *XRPCStreamEvent {
+	if f == nil {
+		return xev
+	}
+	if len(f.Types) > 0 && xev.Error == nil && !slices.Contains(f.Types, xev.MessageType()) {
+		return nil
+	}
+	if f.DIDs != nil {
+		if repo := xev.RepoDID(); repo != "" && !f.DIDs[repo] {
+			return nil
+		}
+	}
+	if len(f.Collections) == 0 || xev.RepoCommit == nil {
+		return xev
+	}
+
+	evt := xev.RepoCommit
+	var ops []*comatproto.SyncSubscribeRepos_RepoOp
+	for _, op := range evt.Ops {
+		if f.matchCollection(op.Path) {
+			ops = append(ops, op)
+		}
+	}
+	switch len(ops) {
+	case 0:
+		return nil
+	case len(evt.Ops):
+		return xev
+	}
+	trimmed := *evt
+	trimmed.Ops = ops
+	out := *xev
+	out.RepoCommit = &trimmed
+	return &out
+}
+
+func (f *EventFilter) matchCollection(path string) bool {
+	collection, _, _ := strings.Cut(path, "/")
+	for _, want := range f.Collections {
+		if collection == want || (strings.HasSuffix(want, ".") && strings.HasPrefix(collection, want)) {
+			return true
+		}
+	}
+	return false
+}
+
+type filteredScheduler struct {
+	Scheduler
+	filter *EventFilter
+}
+
+// NewFilteredScheduler returns a scheduler which passes the events matching filter to sched, and drops the others.
+func NewFilteredScheduler(filter *EventFilter, sched Scheduler) Scheduler {
+	return &filteredScheduler{Scheduler: sched, filter: filter}
+}
+
+func (s *filteredScheduler) AddWork(ctx context.Context, repo string, val *XRPCStreamEvent) error {
+	val = s.filter.Apply(val)
+	if val == nil {
+		eventsFilteredCounter.Inc()
+		return nil
+	}
+	return s.Scheduler.AddWork(ctx, repo, val)
+}
+
+// CommitRecord is a record operation of a commit.
+type CommitRecord struct {
+	Action     string
+	Collection string
+	Rkey       string
+	// nil for deletions
+	Cid *cid.Cid
+	// The CBOR of the record, which can be decoded with lexutil.CborDecodeValue; nil for deletions, and if the block isn't part of the commit (like in "tooBig" commits)
+	Record []byte
+}
+
+// CommitRecords returns the record operations of a commit, with the records which were created or updated. Only the blocks of these records are hashed and copied from the commit's CAR slice: the MST blocks, and records of operations removed by EventFilter.Apply, are skipped.
+func CommitRecords(evt *comatproto.SyncSubscribeRepos_Commit) ([]*CommitRecord, error) {
+	records := make([]*CommitRecord, 0, len(evt.Ops))
+	wanted := make(map[cid.Cid][]*CommitRecord)
+	for _, op := range evt.Ops {
+		collection, rkey, _ := strings.Cut(op.Path, "/")
+		rec := &CommitRecord{
+			Action:     op.Action,
+			Collection: collection,
+			Rkey:       rkey,
+		}
+		if op.Cid != nil {
+			c := cid.Cid(*op.Cid)
+			rec.Cid = &c
+			wanted[c] = append(wanted[c], rec)
+		}
+		records = append(records, rec)
+	}
+	if len(wanted) == 0 || len(evt.Blocks) == 0 {
+		return records, nil
+	}
+
+	r := getCarReader(evt.Blocks)
+	defer putCarReader(r)
+	if _, err := r.readHeader(); err != nil {
+		return nil, fmt.Errorf("reading commit CAR header (seq %d): %w", evt.Seq, err)
+	}
+	for len(wanted) > 0 {
+		c, data, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading commit CAR block (seq %d): %w", evt.Seq, err)
+		}
+		recs, ok := wanted[c]
+		if !ok {
+			continue
+		}
+		sum, err := c.Prefix().Sum(data)
+		if err != nil {
+			return nil, err
+		}
+		if !sum.Equals(c) {
+			return nil, fmt.Errorf("commit CAR block does not match its CID %s (seq %d)", c, evt.Seq)
+		}
+		for _, rec := range recs {
+			rec.Record = data
+		}
+		delete(wanted, c)
+	}
+	return records, nil
+}
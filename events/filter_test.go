@@ -0,0 +1,113 @@
+package events_test
+
+import (
+	"bytes"
+	"testing"
+
+	atproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/ipfs/go-cid"
+	car "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	op := func(path string) *atproto.SyncSubscribeRepos_RepoOp {
+		return &atproto.SyncSubscribeRepos_RepoOp{Action: "create", Path: path}
+	}
+	commit := &events.XRPCStreamEvent{RepoCommit: &atproto.SyncSubscribeRepos_Commit{
+		Repo: "did:plc:one",
+		Ops:  []*atproto.SyncSubscribeRepos_RepoOp{op("app.bsky.feed.post/1"), op("app.bsky.graph.follow/2"), op("app.bsky.feed.like/3")},
+	}}
+	identity := &events.XRPCStreamEvent{RepoIdentity: &atproto.SyncSubscribeRepos_Identity{Did: "did:plc:two"}}
+	info := &events.XRPCStreamEvent{RepoInfo: &atproto.SyncSubscribeRepos_Info{Name: "OutdatedCursor"}}
+	errFrame := &events.XRPCStreamEvent{Error: &events.ErrorFrame{Error: "FutureCursor"}}
+
+	var nilFilter *events.EventFilter
+	assert.Same(commit, nilFilter.Apply(commit))
+
+	f := &events.EventFilter{Types: []string{"#commit", "#info"}}
+	assert.Same(commit, f.Apply(commit))
+	assert.Nil(f.Apply(identity))
+	assert.Same(info, f.Apply(info))
+	assert.Same(errFrame, f.Apply(errFrame))
+
+	f = &events.EventFilter{DIDs: map[string]bool{"did:plc:two": true}}
+	assert.Nil(f.Apply(commit))
+	assert.Same(identity, f.Apply(identity))
+	assert.Same(info, f.Apply(info))
+
+	f = &events.EventFilter{Collections: []string{"app.bsky.feed.post", "app.bsky.graph."}}
+	trimmed := f.Apply(commit)
+	if assert.NotNil(trimmed) {
+		assert.Equal([]*atproto.SyncSubscribeRepos_RepoOp{op("app.bsky.feed.post/1"), op("app.bsky.graph.follow/2")}, trimmed.RepoCommit.Ops)
+		assert.Equal("did:plc:one", trimmed.RepoCommit.Repo)
+	}
+	// the original is left alone
+	assert.Len(commit.RepoCommit.Ops, 3)
+	assert.Same(identity, f.Apply(identity))
+
+	f = &events.EventFilter{Collections: []string{"app.bsky.actor."}}
+	assert.Nil(f.Apply(commit))
+	// NSIDs which don't end with a dot aren't prefixes
+	f = &events.EventFilter{Collections: []string{"app.bsky.feed.po", "app.bsky.graph"}}
+	assert.Nil(f.Apply(commit))
+	f = &events.EventFilter{Collections: []string{"app.bsky."}}
+	assert.Same(commit, f.Apply(commit))
+}
+
+func TestCommitRecords(t *testing.T) {
+	assert := assert.New(t)
+
+	block := func(data string) (cid.Cid, []byte) {
+		c, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: 0x12}.Sum([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c, []byte(data)
+	}
+	root, rootData := block("commit")
+	post, postData := block("post")
+	like, likeData := block("like")
+	mst, mstData := block("mst")
+
+	buf := new(bytes.Buffer)
+	assert.NoError(car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{root}, Version: 1}, buf))
+	for _, b := range []struct {
+		c    cid.Cid
+		data []byte
+	}{{root, rootData}, {mst, mstData}, {post, postData}, {like, likeData}} {
+		assert.NoError(carutil.LdWrite(buf, b.c.Bytes(), b.data))
+	}
+
+	link := func(c cid.Cid) *lexutil.LexLink {
+		l := lexutil.LexLink(c)
+		return &l
+	}
+	evt := &atproto.SyncSubscribeRepos_Commit{
+		Blocks: buf.Bytes(),
+		Ops: []*atproto.SyncSubscribeRepos_RepoOp{
+			{Action: "create", Path: "app.bsky.feed.post/1", Cid: link(post)},
+			{Action: "delete", Path: "app.bsky.feed.post/2"},
+			{Action: "update", Path: "app.bsky.feed.like/3", Cid: link(like)},
+		},
+	}
+	recs, err := events.CommitRecords(evt)
+	assert.NoError(err)
+	if assert.Len(recs, 3) {
+		assert.Equal(&events.CommitRecord{Action: "create", Collection: "app.bsky.feed.post", Rkey: "1", Cid: &post, Record: postData}, recs[0])
+		assert.Equal(&events.CommitRecord{Action: "delete", Collection: "app.bsky.feed.post", Rkey: "2"}, recs[1])
+		assert.Equal(&events.CommitRecord{Action: "update", Collection: "app.bsky.feed.like", Rkey: "3", Cid: &like, Record: likeData}, recs[2])
+	}
+
+	// a block which doesn't match its CID
+	evt.Ops = evt.Ops[:1]
+	evt.Blocks = bytes.Replace(evt.Blocks, postData, []byte("tsop"), 1)
+	_, err = events.CommitRecords(evt)
+	assert.ErrorContains(err, "does not match its CID")
+}
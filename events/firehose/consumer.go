@@ -0,0 +1,294 @@
+// Package firehose is a high-level consumer of repo (or label) event streams, on top of events.HandleRepoStream and the events schedulers: it reconnects with backoff, and resumes from a cursor persisted in a CursorStore.
+package firehose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/events/schedulers/sequential"
+	"github.com/bluesky-social/indigo/xrpc"
+	"github.com/carlmjohnson/versioninfo"
+	"github.com/gorilla/websocket"
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// ConsumerConfig configures a Consumer; fields which are not set have the value of DefaultConsumerConfig.
+type ConsumerConfig struct {
+	// The event stream method, by default com.atproto.sync.subscribeRepos
+	Method    string
+	UserAgent string
+	// Where the cursor is persisted, and read from on start; if nil, the consumer starts with the live stream, and only resumes from its cursor when reconnecting
+	Cursors CursorStore
+	// How often the cursor is persisted, if it changed
+	CursorInterval time.Duration
+	// Creates the scheduler of each connection, which is shut down when the connection ends; by default, a sequential scheduler
+	NewScheduler func(ident string, do func(context.Context, *events.XRPCStreamEvent) error) events.Scheduler
+	// If set, events which don't match are dropped before being scheduled (but still move the cursor forward)
+	Filter *events.EventFilter
+	// What to do when sequence numbers are missing from the stream
+	GapPolicy GapPolicy
+	// If set, called with each gap in the stream, after the GapPolicy was applied
+	OnGap func(ctx context.Context, gap Gap)
+	// If set, the last rev of recently active repos is tracked, and OnRepoGap is called with commits whose previous commit (their "since") wasn't received, and the rev of the last one which was; the repo can then be enqueued for backfill, like with backfill.Store.EnqueueJob
+	OnRepoGap func(ctx context.Context, did string, since string)
+	// How many repos OnRepoGap tracks the last rev of
+	RepoRevCacheSize int
+	// Delay before the first reconnection, doubled (with jitter) after each failed connection, up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// A connection which lasted at least this long resets the backoff
+	HealthyDuration time.Duration
+	Logger          *slog.Logger
+}
+
+func DefaultConsumerConfig() ConsumerConfig {
+	return ConsumerConfig{
+		Method:           "com.atproto.sync.subscribeRepos",
+		UserAgent:        "indigo/" + versioninfo.Short(),
+		CursorInterval:   5 * time.Second,
+		MinBackoff:       time.Second,
+		MaxBackoff:       time.Minute,
+		HealthyDuration:  time.Minute,
+		GapPolicy:        GapIgnore,
+		RepoRevCacheSize: 100_000,
+	}
+}
+
+// Consumer subscribes to the event stream of a host, and passes events to a handler through a scheduler, reconnecting (from the last processed event) until its context is cancelled.
+//
+// The cursor is the sequence number before that of the oldest event still being handled, so no events are skipped when resuming, even with parallel schedulers; some may be handled twice, though. Events whose handler returns an error are not retried.
+type Consumer struct {
+	host    string
+	handler func(context.Context, *events.XRPCStreamEvent) error
+	cfg     ConsumerConfig
+	logger  *slog.Logger
+
+	tracker *cursorTracker
+	// the start of the last gap the consumer resubscribed for
+	retriedGap int64
+	// the last rev of recently active repos, if OnRepoGap is set
+	revs *lru.Cache[string, string]
+}
+
+// NewConsumer returns a consumer of the event stream of host (like "wss://bsky.network", or an https:// URL), which calls handler for each event; handlers for each type of event can be set with events.RepoStreamCallbacks.EventHandler.
+func NewConsumer(host string, handler func(context.Context, *events.XRPCStreamEvent) error, cfg ConsumerConfig) *Consumer {
+	// zero fields have their default value
+	def := DefaultConsumerConfig()
+	orDefault(&cfg.Method, def.Method)
+	orDefault(&cfg.UserAgent, def.UserAgent)
+	orDefault(&cfg.CursorInterval, def.CursorInterval)
+	orDefault(&cfg.MinBackoff, def.MinBackoff)
+	orDefault(&cfg.MaxBackoff, def.MaxBackoff)
+	orDefault(&cfg.HealthyDuration, def.HealthyDuration)
+	orDefault(&cfg.RepoRevCacheSize, def.RepoRevCacheSize)
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if cfg.NewScheduler == nil {
+		cfg.NewScheduler = func(ident string, do func(context.Context, *events.XRPCStreamEvent) error) events.Scheduler {
+			return sequential.NewScheduler(ident, do)
+		}
+	}
+	c := &Consumer{
+		host:    host,
+		handler: handler,
+		cfg:     cfg,
+		logger:  logger.With("component", "firehose", "host", host),
+		tracker: newCursorTracker(),
+	}
+	if cfg.OnRepoGap != nil {
+		// only fails with a non-positive size
+		c.revs, _ = lru.New[string, string](cfg.RepoRevCacheSize)
+	}
+	return c
+}
+
+// Sets *v to def if it's the zero value.
+func orDefault[T comparable](v *T, def T) {
+	var zero T
+	if *v == zero {
+		*v = def
+	}
+}
+
+// Cursor returns the sequence number from which the consumer would resume.
+func (c *Consumer) Cursor() int64 {
+	return c.tracker.cursor()
+}
+
+// Run consumes the event stream until the context is cancelled, persisting the cursor periodically, and once more before returning. It only returns early if the persisted cursor can't be read.
+func (c *Consumer) Run(ctx context.Context) error {
+	if c.cfg.Cursors != nil {
+		cur, err := c.cfg.Cursors.GetCursor(ctx, c.host)
+		if err != nil {
+			return fmt.Errorf("reading firehose cursor: %w", err)
+		}
+		c.tracker.reset(cur)
+		if cur > 0 {
+			c.logger.Info("resuming from persisted cursor", "cursor", cur)
+		}
+
+		done := make(chan struct{})
+		defer func() {
+			<-done
+			// persisted even though the context was cancelled
+			c.persistCursor(context.WithoutCancel(ctx))
+		}()
+		go func() {
+			defer close(done)
+			c.runPersistCursor(ctx)
+		}()
+	}
+
+	backoff := c.cfg.MinBackoff
+	for {
+		start := time.Now()
+		err := c.consume(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == nil {
+			err = fmt.Errorf("firehose closed")
+		}
+		if errors.Is(err, errResubscribe) {
+			c.logger.Warn("resubscribing to firehose", "err", err, "cursor", c.tracker.cursor())
+			continue
+		}
+		if time.Since(start) >= c.cfg.HealthyDuration {
+			backoff = c.cfg.MinBackoff
+		}
+		reconnects.WithLabelValues(c.host).Inc()
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		c.logger.Error("firehose connection failed, reconnecting", "err", err, "cursor", c.tracker.cursor(), "wait", wait)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+		backoff = min(backoff*2, c.cfg.MaxBackoff)
+	}
+}
+
+// Connects to the event stream, from the current cursor, and handles events until the connection fails.
+func (c *Consumer) consume(ctx context.Context) error {
+	u, err := url.Parse(strings.TrimSuffix(c.host, "/") + "/xrpc/" + c.cfg.Method)
+	if err != nil {
+		return fmt.Errorf("invalid firehose host: %w", err)
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	cur := c.tracker.cursor()
+	if cur > 0 {
+		u.RawQuery = fmt.Sprintf("cursor=%d", cur)
+	}
+
+	c.logger.Info("subscribing to firehose", "cursor", cur)
+	con, resp, err := websocket.DefaultDialer.DialContext(ctx, u.String(), http.Header{
+		"User-Agent": []string{c.cfg.UserAgent},
+	})
+	if err != nil {
+		if resp != nil {
+			return fmt.Errorf("dialing firehose: %w (status %d)", err, resp.StatusCode)
+		}
+		return fmt.Errorf("dialing firehose: %w", err)
+	}
+	defer con.Close()
+	connected.WithLabelValues(c.host).Set(1)
+	defer connected.WithLabelValues(c.host).Set(0)
+
+	sched := &trackingScheduler{
+		Scheduler: c.cfg.NewScheduler(c.host, func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+			defer c.tracker.done(evt.Sequence())
+			return c.handler(ctx, evt)
+		}),
+		consumer: c,
+		lastSeq:  -1,
+	}
+	if cur > 0 {
+		sched.lastSeq = cur
+	}
+	err = events.HandleRepoStream(ctx, con, sched)
+	// the scheduler is shut down: events which were still in flight were abandoned, and will be received again
+	c.tracker.reset(c.tracker.cursor())
+	return err
+}
+
+// Tracks the events passed to the scheduler, and handles info messages and error frames about the stream itself.
+type trackingScheduler struct {
+	events.Scheduler
+	consumer *Consumer
+	// the last sequence number received on this connection (or the cursor it was opened with), or -1
+	lastSeq int64
+}
+
+func (s *trackingScheduler) AddWork(ctx context.Context, repo string, evt *events.XRPCStreamEvent) error {
+	c := s.consumer
+	switch {
+	case evt.RepoInfo != nil && evt.RepoInfo.Name == "OutdatedCursor":
+		c.logger.Warn("firehose cursor is older than the stream's backfill window, some events were missed", "cursor", c.tracker.cursor())
+		// the stream starts at its oldest event, which isn't a gap to resubscribe for
+		s.lastSeq = -1
+	case evt.Error != nil && evt.Error.Error == xrpc.ErrNameConsumerTooSlow:
+		tooSlow.WithLabelValues(c.host).Inc()
+		c.logger.Warn("firehose consumer is too slow, the host is closing the connection", "message", evt.Error.Message)
+	case evt.Error != nil && evt.Error.Error == xrpc.ErrNameFutureCursor:
+		// likely a cursor for another host: start over from the live stream
+		c.logger.Warn("firehose cursor is in the future, resetting it", "cursor", c.tracker.cursor())
+		c.tracker.reset(0)
+	}
+	seq := evt.Sequence()
+	if seq >= 0 {
+		if err := s.checkGap(ctx, seq); err != nil {
+			return err
+		}
+	}
+	if evt.RepoCommit != nil {
+		c.checkRepoRev(ctx, evt.RepoCommit)
+	}
+	c.tracker.start(seq)
+	evt = c.cfg.Filter.Apply(evt)
+	if evt == nil {
+		c.tracker.done(seq)
+		return nil
+	}
+	return s.Scheduler.AddWork(ctx, repo, evt)
+}
+
+// Persists the cursor every CursorInterval, until the context is cancelled.
+func (c *Consumer) runPersistCursor(ctx context.Context) {
+	t := time.NewTicker(c.cfg.CursorInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			c.persistCursor(ctx)
+		}
+	}
+}
+
+func (c *Consumer) persistCursor(ctx context.Context) {
+	cur, changed := c.tracker.persist()
+	if !changed {
+		return
+	}
+	cursorGauge.WithLabelValues(c.host).Set(float64(cur))
+	if err := c.cfg.Cursors.PutCursor(ctx, c.host, cur); err != nil {
+		c.logger.Error("failed to persist firehose cursor", "cursor", cur, "err", err)
+		c.tracker.persistFailed()
+	}
+}
@@ -0,0 +1,213 @@
+package firehose
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	atproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/gorilla/websocket"
+	"github.com/ipfs/go-cid"
+	"github.com/stretchr/testify/assert"
+)
+
+func frame(t *testing.T, hdr events.EventHeader, body interface {
+	MarshalCBOR(w io.Writer) error
+}) []byte {
+	var buf bytes.Buffer
+	if err := hdr.MarshalCBOR(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := body.MarshalCBOR(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestConsumer(t *testing.T) {
+	assert := assert.New(t)
+
+	// each connection gets the next 3 events after the cursor, then is closed
+	var lk sync.Mutex
+	var cursors []string
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/xrpc/com.atproto.sync.subscribeRepos", r.URL.Path)
+		cursor := r.URL.Query().Get("cursor")
+		lk.Lock()
+		cursors = append(cursors, cursor)
+		lk.Unlock()
+		con, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer con.Close()
+		from, _ := strconv.ParseInt(cursor, 10, 64)
+		for seq := from + 1; seq <= from+3; seq++ {
+			f := frame(t, events.EventHeader{Op: events.EvtKindMessage, MsgType: "#identity"}, &atproto.SyncSubscribeRepos_Identity{Did: "did:example:a", Seq: seq, Time: "2024-01-01T00:00:00.000Z"})
+			if err := con.WriteMessage(websocket.BinaryMessage, f); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+		con.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	}))
+	defer srv.Close()
+
+	store := NewFileCursorStore(filepath.Join(t.TempDir(), "cursors.json"))
+	assert.NoError(store.PutCursor(context.Background(), srv.URL, 10))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var seqs []int64
+	cfg := DefaultConsumerConfig()
+	cfg.Cursors = store
+	cfg.MinBackoff = time.Millisecond
+	c := NewConsumer(srv.URL, func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+		seqs = append(seqs, evt.Sequence())
+		if evt.Sequence() == 16 {
+			cancel()
+		}
+		return nil
+	}, cfg)
+	assert.NoError(c.Run(ctx))
+
+	// resumed from the persisted cursor, then from the last event of each connection
+	assert.Equal([]int64{11, 12, 13, 14, 15, 16}, seqs)
+	assert.Equal([]string{"10", "13"}, cursors)
+	// and the final cursor was persisted
+	cur, err := store.GetCursor(context.Background(), srv.URL)
+	assert.NoError(err)
+	assert.Equal(int64(16), cur)
+	cur, err = store.GetCursor(context.Background(), "https://other.example")
+	assert.NoError(err)
+	assert.Equal(int64(0), cur)
+}
+
+func TestConsumerGaps(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: 0x12}.Sum([]byte("commit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	commit := func(seq int64, rev, since string) []byte {
+		evt := &atproto.SyncSubscribeRepos_Commit{Repo: "did:example:a", Seq: seq, Rev: rev, Commit: lexutil.LexLink(c), Blocks: []byte{}, Ops: []*atproto.SyncSubscribeRepos_RepoOp{}, Blobs: []lexutil.LexLink{}, Time: "2024-01-01T00:00:00.000Z"}
+		if since != "" {
+			evt.Since = &since
+		}
+		return frame(t, events.EventHeader{Op: events.EvtKindMessage, MsgType: "#commit"}, evt)
+	}
+	// seq 13 (with rev 3) is missing
+	stream := []struct {
+		seq   int64
+		frame []byte
+	}{
+		{11, frame(t, events.EventHeader{Op: events.EvtKindMessage, MsgType: "#identity"}, &atproto.SyncSubscribeRepos_Identity{Did: "did:example:a", Seq: 11, Time: "2024-01-01T00:00:00.000Z"})},
+		{12, commit(12, "2", "1")},
+		{14, commit(14, "4", "3")},
+		{15, commit(15, "5", "4")},
+	}
+
+	// each connection gets the events after the cursor
+	var lk sync.Mutex
+	var cursors []string
+	upgrader := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cursor := r.URL.Query().Get("cursor")
+		lk.Lock()
+		cursors = append(cursors, cursor)
+		lk.Unlock()
+		con, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer con.Close()
+		from, _ := strconv.ParseInt(cursor, 10, 64)
+		for _, e := range stream {
+			if e.seq > from {
+				if err := con.WriteMessage(websocket.BinaryMessage, e.frame); err != nil {
+					return
+				}
+			}
+		}
+		// leave the connection open until the consumer closes it
+		con.ReadMessage()
+	}))
+	defer srv.Close()
+
+	store := NewFileCursorStore(filepath.Join(t.TempDir(), "cursors.json"))
+	assert.NoError(store.PutCursor(context.Background(), srv.URL, 10))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var seqs []int64
+	var gaps []Gap
+	var repoGaps []string
+	cfg := DefaultConsumerConfig()
+	cfg.Cursors = store
+	cfg.GapPolicy = GapResubscribe
+	cfg.OnGap = func(ctx context.Context, gap Gap) {
+		gaps = append(gaps, gap)
+	}
+	cfg.OnRepoGap = func(ctx context.Context, did string, since string) {
+		repoGaps = append(repoGaps, did+" "+since)
+	}
+	consumer := NewConsumer(srv.URL, func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+		seqs = append(seqs, evt.Sequence())
+		if evt.Sequence() == 15 {
+			cancel()
+		}
+		return nil
+	}, cfg)
+	assert.NoError(consumer.Run(ctx))
+
+	// resubscribed once from before the gap, then accepted it
+	assert.Equal([]string{"10", "12"}, cursors)
+	assert.Equal([]int64{11, 12, 14, 15}, seqs)
+	assert.Equal([]Gap{{From: 13, To: 13}}, gaps)
+	assert.Equal([]string{"did:example:a 2"}, repoGaps)
+}
+
+func TestCursorTracker(t *testing.T) {
+	assert := assert.New(t)
+
+	tr := newCursorTracker()
+	tr.reset(10)
+	assert.Equal(int64(10), tr.cursor())
+
+	// events handled out of order: the cursor stays before the oldest one in flight
+	tr.start(11)
+	tr.start(12)
+	tr.start(13)
+	tr.start(-1)
+	assert.Equal(int64(10), tr.cursor())
+	tr.done(12)
+	tr.done(-1)
+	assert.Equal(int64(10), tr.cursor())
+	tr.done(11)
+	assert.Equal(int64(12), tr.cursor())
+	tr.done(13)
+	assert.Equal(int64(13), tr.cursor())
+
+	cur, changed := tr.persist()
+	assert.Equal(int64(13), cur)
+	assert.True(changed)
+	_, changed = tr.persist()
+	assert.False(changed)
+	tr.persistFailed()
+	_, changed = tr.persist()
+	assert.True(changed)
+}
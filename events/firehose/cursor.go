@@ -0,0 +1,232 @@
+package firehose
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CursorStore persists the cursor of the event stream of each host. Sequence numbers are specific to each host, so cursors can't be shared between them.
+type CursorStore interface {
+	// GetCursor returns the persisted cursor for host, or zero if there is none.
+	GetCursor(ctx context.Context, host string) (int64, error)
+	PutCursor(ctx context.Context, host string, cursor int64) error
+}
+
+// FileCursorStore persists cursors in a JSON file, replaced atomically on each update.
+type FileCursorStore struct {
+	Path string
+
+	lk sync.Mutex
+}
+
+func NewFileCursorStore(path string) *FileCursorStore {
+	return &FileCursorStore{Path: path}
+}
+
+func (s *FileCursorStore) read() (map[string]int64, error) {
+	b, err := os.ReadFile(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]int64{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	cursors := map[string]int64{}
+	if err := json.Unmarshal(b, &cursors); err != nil {
+		return nil, fmt.Errorf("decoding cursor file %s: %w", s.Path, err)
+	}
+	return cursors, nil
+}
+
+func (s *FileCursorStore) GetCursor(ctx context.Context, host string) (int64, error) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	cursors, err := s.read()
+	if err != nil {
+		return 0, err
+	}
+	return cursors[host], nil
+}
+
+func (s *FileCursorStore) PutCursor(ctx context.Context, host string, cursor int64) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	cursors, err := s.read()
+	if err != nil {
+		return err
+	}
+	cursors[host] = cursor
+	b, err := json.Marshal(cursors)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), filepath.Base(s.Path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.Path)
+}
+
+// FirehoseCursor is the table of GormCursorStore.
+type FirehoseCursor struct {
+	Host      string `gorm:"primaryKey"`
+	Cursor    int64
+	UpdatedAt time.Time
+}
+
+// GormCursorStore persists cursors in a database table (firehose_cursors), with a row per host.
+type GormCursorStore struct {
+	db *gorm.DB
+}
+
+// NewGormCursorStore returns a store in db, creating or migrating its table.
+func NewGormCursorStore(db *gorm.DB) (*GormCursorStore, error) {
+	if err := db.AutoMigrate(&FirehoseCursor{}); err != nil {
+		return nil, fmt.Errorf("migrating firehose cursor table: %w", err)
+	}
+	return &GormCursorStore{db: db}, nil
+}
+
+func (s *GormCursorStore) GetCursor(ctx context.Context, host string) (int64, error) {
+	var row FirehoseCursor
+	if err := s.db.WithContext(ctx).Where("host = ?", host).Limit(1).Find(&row).Error; err != nil {
+		return 0, err
+	}
+	return row.Cursor, nil
+}
+
+func (s *GormCursorStore) PutCursor(ctx context.Context, host string, cursor int64) error {
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "host"}},
+		DoUpdates: clause.AssignmentColumns([]string{"cursor", "updated_at"}),
+	}).Create(&FirehoseCursor{Host: host, Cursor: cursor}).Error
+}
+
+// RedisCursorStore persists cursors in Redis.
+type RedisCursorStore struct {
+	Client redis.UniversalClient
+	// Returns the key of the cursor of a host; by default, "firehose/cursor/" followed by the host
+	Key func(host string) string
+	// Expiration of the cursors, if not zero
+	TTL time.Duration
+}
+
+func NewRedisCursorStore(client redis.UniversalClient) *RedisCursorStore {
+	return &RedisCursorStore{Client: client}
+}
+
+func (s *RedisCursorStore) key(host string) string {
+	if s.Key != nil {
+		return s.Key(host)
+	}
+	return "firehose/cursor/" + host
+}
+
+func (s *RedisCursorStore) GetCursor(ctx context.Context, host string) (int64, error) {
+	cur, err := s.Client.Get(ctx, s.key(host)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return cur, err
+}
+
+func (s *RedisCursorStore) PutCursor(ctx context.Context, host string, cursor int64) error {
+	return s.Client.Set(ctx, s.key(host), cursor, s.TTL).Err()
+}
+
+// Tracks the events being handled, to compute the cursor to resume from: the sequence number before that of the oldest event still in flight, or of the last event if none are.
+type cursorTracker struct {
+	lk       sync.Mutex
+	last     int64
+	inflight map[int64]int
+	// the last persisted cursor, or -1 to persist it again
+	persisted int64
+}
+
+func newCursorTracker() *cursorTracker {
+	return &cursorTracker{inflight: make(map[int64]int), persisted: -1}
+}
+
+// Records an event passed to the scheduler; events without a sequence number (seq < 0) are ignored.
+func (t *cursorTracker) start(seq int64) {
+	if seq < 0 {
+		return
+	}
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.inflight[seq]++
+	t.last = max(t.last, seq)
+}
+
+// Records an event which was handled.
+func (t *cursorTracker) done(seq int64) {
+	if seq < 0 {
+		return
+	}
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	if t.inflight[seq] <= 1 {
+		delete(t.inflight, seq)
+	} else {
+		t.inflight[seq]--
+	}
+}
+
+func (t *cursorTracker) cursor() int64 {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	return t.cursorLocked()
+}
+
+func (t *cursorTracker) cursorLocked() int64 {
+	cur := t.last
+	for seq := range t.inflight {
+		cur = min(cur, seq-1)
+	}
+	return cur
+}
+
+// Forgets the events in flight, and sets the cursor.
+func (t *cursorTracker) reset(cursor int64) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	clear(t.inflight)
+	t.last = cursor
+}
+
+// Returns the cursor, and whether it changed since it was last persisted.
+func (t *cursorTracker) persist() (int64, bool) {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	cur := t.cursorLocked()
+	if cur == t.persisted {
+		return cur, false
+	}
+	t.persisted = cur
+	return cur, true
+}
+
+// Marks the cursor as not persisted, after an error.
+func (t *cursorTracker) persistFailed() {
+	t.lk.Lock()
+	defer t.lk.Unlock()
+	t.persisted = -1
+}
@@ -0,0 +1,71 @@
+package firehose
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+)
+
+// Gap is a range of sequence numbers missing from the stream, From and To included. Sequence numbers should be consecutive, but hosts may skip some without losing any events (like after a failed database transaction), so gaps aren't necessarily missed events.
+type Gap struct {
+	From int64
+	To   int64
+}
+
+// GapPolicy is what a Consumer does when events are missing from the stream.
+type GapPolicy int
+
+const (
+	// Gaps are logged and counted, and passed to OnGap
+	GapIgnore GapPolicy = iota
+	// The consumer resubscribes from the cursor before the gap, in case the events were only missed by this connection; if the same gap is seen again, it's then handled like with GapIgnore
+	GapResubscribe
+)
+
+var errResubscribe = errors.New("events missing from the firehose, resubscribing")
+
+// Checks that an event follows the previous one on this connection, and applies the gap policy if it doesn't.
+func (s *trackingScheduler) checkGap(ctx context.Context, seq int64) error {
+	prev := s.lastSeq
+	if prev < 0 || seq <= prev+1 {
+		s.lastSeq = max(prev, seq)
+		return nil
+	}
+	c := s.consumer
+	gap := Gap{From: prev + 1, To: seq - 1}
+	if c.cfg.GapPolicy == GapResubscribe && gap.From != c.retriedGap {
+		c.retriedGap = gap.From
+		gapResubscribes.WithLabelValues(c.host).Inc()
+		return fmt.Errorf("%w (from %d to %d)", errResubscribe, gap.From, gap.To)
+	}
+	s.lastSeq = seq
+
+	seqGaps.WithLabelValues(c.host).Inc()
+	missedSeqs.WithLabelValues(c.host).Add(float64(gap.To - gap.From + 1))
+	c.logger.Warn("events missing from the firehose", "from", gap.From, "to", gap.To)
+	if c.cfg.OnGap != nil {
+		c.cfg.OnGap(ctx, gap)
+	}
+	return nil
+}
+
+// Checks that a commit follows the last one received for its repo, if it's still known, and calls OnRepoGap if it doesn't.
+func (c *Consumer) checkRepoRev(ctx context.Context, evt *comatproto.SyncSubscribeRepos_Commit) {
+	if c.revs == nil {
+		return
+	}
+	prev, ok := c.revs.Get(evt.Repo)
+	// revs are TIDs, which sort by time; older commits are received again after reconnecting
+	if ok && evt.Rev <= prev {
+		return
+	}
+	c.revs.Add(evt.Repo, evt.Rev)
+	if !ok || evt.Since == nil || *evt.Since == prev {
+		return
+	}
+	repoGaps.WithLabelValues(c.host).Inc()
+	c.logger.Info("commits of repo missing from the firehose", "did", evt.Repo, "since", prev, "rev", evt.Rev)
+	c.cfg.OnRepoGap(ctx, evt.Repo, prev)
+}
@@ -0,0 +1,46 @@
+package firehose
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var connected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "indigo_firehose_consumer_connected",
+	Help: "Whether the firehose consumer is connected to the host",
+}, []string{"host"})
+
+var reconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_firehose_consumer_reconnects_total",
+	Help: "Total number of times the firehose consumer reconnected to the host, after the connection failed",
+}, []string{"host"})
+
+var tooSlow = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_firehose_consumer_too_slow_total",
+	Help: "Total number of times the host closed the connection because the consumer was too slow",
+}, []string{"host"})
+
+var cursorGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "indigo_firehose_consumer_cursor",
+	Help: "The last persisted cursor of the firehose consumer",
+}, []string{"host"})
+
+var seqGaps = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_firehose_consumer_seq_gaps_total",
+	Help: "Total number of gaps in the sequence numbers of the stream",
+}, []string{"host"})
+
+var missedSeqs = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_firehose_consumer_missed_seqs_total",
+	Help: "Total number of sequence numbers missing from the stream",
+}, []string{"host"})
+
+var gapResubscribes = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_firehose_consumer_gap_resubscribes_total",
+	Help: "Total number of times the consumer resubscribed after a gap in the stream",
+}, []string{"host"})
+
+var repoGaps = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_firehose_consumer_repo_gaps_total",
+	Help: "Total number of commits whose previous commit of the same repo was not received",
+}, []string{"host"})
@@ -0,0 +1,118 @@
+// Package jetstream serves a simplified JSON event stream, compatible with Jetstream (https://github.com/bluesky-social/jetstream): one event per record operation, with the record decoded to JSON, and without the CAR slice and MST proofs of commits.
+package jetstream
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+
+	"github.com/ipfs/go-cid"
+	cbornode "github.com/ipfs/go-ipld-cbor"
+)
+
+// Kinds of events.
+const (
+	KindCommit   = "commit"
+	KindIdentity = "identity"
+	KindAccount  = "account"
+)
+
+// Operations of commit events.
+const (
+	OpCreate = "create"
+	OpUpdate = "update"
+	OpDelete = "delete"
+)
+
+// Event is an event of the stream. TimeUS, the time at which it was received in microseconds since the epoch, is unique and increasing, and is used as the cursor.
+type Event struct {
+	Did      string                                  `json:"did"`
+	TimeUS   int64                                   `json:"time_us"`
+	Kind     string                                  `json:"kind"`
+	Commit   *Commit                                 `json:"commit,omitempty"`
+	Identity *comatproto.SyncSubscribeRepos_Identity `json:"identity,omitempty"`
+	Account  *comatproto.SyncSubscribeRepos_Account  `json:"account,omitempty"`
+}
+
+// Commit is a single record operation of a commit.
+type Commit struct {
+	Rev        string `json:"rev"`
+	Operation  string `json:"operation"`
+	Collection string `json:"collection"`
+	RKey       string `json:"rkey"`
+	// The record, for creates and updates
+	Record json.RawMessage `json:"record,omitempty"`
+	CID    string          `json:"cid,omitempty"`
+}
+
+// Convert returns the events of the Jetstream format for an event of a repo stream, or none for messages which have no equivalent (like the deprecated #handle and #tombstone). Each operation of a commit is a separate event; operations whose record is missing from the commit (like in "tooBig" commits) are skipped. TimeUS is left for the caller to set.
+func Convert(xev *events.XRPCStreamEvent) ([]*Event, error) {
+	switch {
+	case xev.RepoCommit != nil:
+		evt := xev.RepoCommit
+		recs, err := events.CommitRecords(evt)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]*Event, 0, len(recs))
+		for _, rec := range recs {
+			c := &Commit{
+				Rev:        evt.Rev,
+				Operation:  rec.Action,
+				Collection: rec.Collection,
+				RKey:       rec.Rkey,
+			}
+			if rec.Action != OpDelete {
+				if rec.Record == nil {
+					continue
+				}
+				c.Record, err = RecordJSON(rec.Record)
+				if err != nil {
+					return nil, fmt.Errorf("decoding record %s/%s (seq %d): %w", rec.Collection, rec.Rkey, evt.Seq, err)
+				}
+				c.CID = rec.Cid.String()
+			}
+			out = append(out, &Event{Did: evt.Repo, Kind: KindCommit, Commit: c})
+		}
+		return out, nil
+	case xev.RepoIdentity != nil:
+		return []*Event{{Did: xev.RepoIdentity.Did, Kind: KindIdentity, Identity: xev.RepoIdentity}}, nil
+	case xev.RepoAccount != nil:
+		return []*Event{{Did: xev.RepoAccount.Did, Kind: KindAccount, Account: xev.RepoAccount}}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// RecordJSON converts the CBOR of a record to the JSON representation of the atproto data model, where links are {"$link": <CID>} and bytes are {"$bytes": <base64>}. Records of any type can be converted, even if they don't have a generated Go type.
+func RecordJSON(b []byte) (json.RawMessage, error) {
+	var v any
+	if err := cbornode.DecodeInto(b, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(dataModelJSON(v))
+}
+
+func dataModelJSON(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			v[k] = dataModelJSON(e)
+		}
+		return v
+	case []any:
+		for i, e := range v {
+			v[i] = dataModelJSON(e)
+		}
+		return v
+	case cid.Cid:
+		return map[string]string{"$link": v.String()}
+	case []byte:
+		return map[string]string{"$bytes": base64.RawStdEncoding.EncodeToString(v)}
+	default:
+		return v
+	}
+}
@@ -0,0 +1,201 @@
+package jetstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/events"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+
+	"github.com/gorilla/websocket"
+	"github.com/ipfs/go-cid"
+	car "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func testCommit(t *testing.T, did, collection string) *events.XRPCStreamEvent {
+	image, err := cid.V1Builder{Codec: cid.Raw, MhType: 0x12}.Sum([]byte("image"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := &bsky.FeedPost{
+		LexiconTypeID: "app.bsky.feed.post",
+		Text:          "hello",
+		CreatedAt:     "2024-01-01T00:00:00Z",
+		Embed: &bsky.FeedPost_Embed{EmbedImages: &bsky.EmbedImages{
+			LexiconTypeID: "app.bsky.embed.images",
+			Images:        []*bsky.EmbedImages_Image{{Image: &lexutil.LexBlob{Ref: lexutil.LexLink(image), MimeType: "image/png", Size: 5}}},
+		}},
+	}
+	rec := new(bytes.Buffer)
+	if err := post.MarshalCBOR(rec); err != nil {
+		t.Fatal(err)
+	}
+	c, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: 0x12}.Sum(rec.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := new(bytes.Buffer)
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{c}, Version: 1}, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if err := carutil.LdWrite(blocks, c.Bytes(), rec.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	link := lexutil.LexLink(c)
+	missing, err := cid.V1Builder{Codec: cid.DagCBOR, MhType: 0x12}.Sum([]byte("missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	missingLink := lexutil.LexLink(missing)
+	return &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{
+		Repo:   did,
+		Rev:    "3kabcdefghijk",
+		Commit: link,
+		Blocks: blocks.Bytes(),
+		Ops: []*comatproto.SyncSubscribeRepos_RepoOp{
+			{Action: "create", Path: collection + "/1", Cid: &link},
+			{Action: "delete", Path: collection + "/2"},
+			{Action: "update", Path: collection + "/3", Cid: &missingLink},
+		},
+	}}
+}
+
+func TestConvert(t *testing.T) {
+	assert := assert.New(t)
+
+	evts, err := Convert(testCommit(t, "did:plc:one", "app.bsky.feed.post"))
+	assert.NoError(err)
+	// the update's record is missing from the commit
+	if !assert.Len(evts, 2) {
+		return
+	}
+	assert.Equal(KindCommit, evts[0].Kind)
+	assert.Equal("did:plc:one", evts[0].Did)
+	assert.Equal("3kabcdefghijk", evts[0].Commit.Rev)
+	assert.Equal(OpCreate, evts[0].Commit.Operation)
+	assert.Equal("app.bsky.feed.post", evts[0].Commit.Collection)
+	assert.Equal("1", evts[0].Commit.RKey)
+	assert.NotEmpty(evts[0].Commit.CID)
+
+	var rec map[string]any
+	assert.NoError(json.Unmarshal(evts[0].Commit.Record, &rec))
+	assert.Equal("app.bsky.feed.post", rec["$type"])
+	assert.Equal("hello", rec["text"])
+	img := rec["embed"].(map[string]any)["images"].([]any)[0].(map[string]any)["image"].(map[string]any)
+	image, err := cid.V1Builder{Codec: cid.Raw, MhType: 0x12}.Sum([]byte("image"))
+	assert.NoError(err)
+	assert.Equal(map[string]any{"$link": image.String()}, img["ref"])
+
+	assert.Equal(&Event{Did: "did:plc:one", Kind: KindCommit, Commit: &Commit{Rev: "3kabcdefghijk", Operation: OpDelete, Collection: "app.bsky.feed.post", RKey: "2"}}, evts[1])
+
+	ident := &comatproto.SyncSubscribeRepos_Identity{Did: "did:plc:two"}
+	evts, err = Convert(&events.XRPCStreamEvent{RepoIdentity: ident})
+	assert.NoError(err)
+	assert.Equal([]*Event{{Did: "did:plc:two", Kind: KindIdentity, Identity: ident}}, evts)
+
+	evts, err = Convert(&events.XRPCStreamEvent{RepoInfo: &comatproto.SyncSubscribeRepos_Info{Name: "OutdatedCursor"}})
+	assert.NoError(err)
+	assert.Empty(evts)
+}
+
+func TestRecordJSONBytes(t *testing.T) {
+	assert := assert.New(t)
+
+	// {"a": h'0102', "b": [1]}
+	out, err := RecordJSON([]byte{0xa2, 0x61, 'a', 0x42, 0x01, 0x02, 0x61, 'b', 0x81, 0x01})
+	assert.NoError(err)
+	assert.JSONEq(`{"a": {"$bytes": "AQI"}, "b": [1]}`, string(out))
+}
+
+func TestServer(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	s := NewServer(ServerConfig{BufferSize: 4})
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	// each commit is two events (the update has no record), and the oldest three fall out of the buffer
+	for _, did := range []string{"did:plc:zero", "did:plc:one"} {
+		assert.NoError(s.HandleEvent(ctx, testCommit(t, did, "app.bsky.feed.post")))
+	}
+	assert.NoError(s.HandleEvent(ctx, testCommit(t, "did:plc:one", "app.bsky.graph.follow")))
+	assert.NoError(s.HandleEvent(ctx, &events.XRPCStreamEvent{RepoIdentity: &comatproto.SyncSubscribeRepos_Identity{Did: "did:plc:two"}}))
+
+	read := func(con *websocket.Conn) *Event {
+		assert.NoError(con.SetReadDeadline(time.Now().Add(5 * time.Second)))
+		typ, data, err := con.ReadMessage()
+		if !assert.NoError(err) {
+			t.FailNow()
+		}
+		assert.Equal(websocket.TextMessage, typ)
+		var evt Event
+		assert.NoError(json.Unmarshal(data, &evt))
+		return &evt
+	}
+
+	con, _, err := websocket.DefaultDialer.Dial(url+"?cursor=1&wantedCollections=app.bsky.feed.*&wantedDids=did:plc:one&wantedDids=did:plc:two", nil)
+	if !assert.NoError(err) {
+		return
+	}
+	defer con.Close()
+
+	// replayed from the buffer
+	evt := read(con)
+	assert.Equal("did:plc:one", evt.Did)
+	assert.Equal(OpDelete, evt.Commit.Operation)
+	assert.Equal("app.bsky.feed.post", evt.Commit.Collection)
+	last := evt.TimeUS
+	evt = read(con)
+	assert.Equal(KindIdentity, evt.Kind)
+	assert.Greater(evt.TimeUS, last)
+
+	// live
+	assert.NoError(s.HandleEvent(ctx, testCommit(t, "did:plc:zero", "app.bsky.feed.like")))
+	assert.NoError(s.HandleEvent(ctx, testCommit(t, "did:plc:one", "app.bsky.graph.block")))
+	assert.NoError(s.HandleEvent(ctx, testCommit(t, "did:plc:one", "app.bsky.feed.like")))
+	evt = read(con)
+	assert.Equal("did:plc:one", evt.Did)
+	assert.Equal("app.bsky.feed.like", evt.Commit.Collection)
+	assert.Equal(OpCreate, evt.Commit.Operation)
+
+	for _, q := range []string{"?cursor=x", "?wantedCollections=app.bsky.feed*", "?wantedDids=bob"} {
+		_, resp, err := websocket.DefaultDialer.Dial(url+q, nil)
+		assert.Error(err, q)
+		if assert.NotNil(resp, q) {
+			assert.Equal(400, resp.StatusCode, q)
+		}
+	}
+}
+
+func TestSetFilters(t *testing.T) {
+	assert := assert.New(t)
+
+	s := NewServer(ServerConfig{MaxWantedCollections: 2})
+	sub := &subscriber{}
+	assert.NoError(s.setFilters(sub, []string{"app.bsky.feed.post", "app.bsky.graph.*"}, nil))
+	assert.True(sub.matches(&encodedEvent{collection: "app.bsky.feed.post"}))
+	assert.False(sub.matches(&encodedEvent{collection: "app.bsky.feed.postgate"}))
+	assert.True(sub.matches(&encodedEvent{collection: "app.bsky.graph.follow"}))
+	assert.False(sub.matches(&encodedEvent{collection: "app.bsky.feed.like"}))
+	// the collection filter doesn't apply to identity and account events
+	assert.True(sub.matches(&encodedEvent{did: "did:plc:one"}))
+
+	assert.ErrorContains(s.setFilters(sub, []string{"a.b.c", "d.e.f", "g.h.i"}, nil), "too many")
+	// an invalid update leaves the filters alone
+	assert.True(sub.matches(&encodedEvent{collection: "app.bsky.feed.post"}))
+
+	assert.NoError(s.setFilters(sub, nil, []string{"did:plc:one"}))
+	assert.True(sub.matches(&encodedEvent{did: "did:plc:one", collection: "app.bsky.feed.like"}))
+	assert.False(sub.matches(&encodedEvent{did: "did:plc:two"}))
+}
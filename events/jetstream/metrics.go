@@ -0,0 +1,26 @@
+package jetstream
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var eventsEmitted = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_jetstream_events_emitted_total",
+	Help: "Total number of events emitted to subscribers, by kind",
+}, []string{"kind"})
+
+var convertErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indigo_jetstream_convert_errors_total",
+	Help: "Total number of repo stream events which could not be converted",
+})
+
+var subscribers = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "indigo_jetstream_subscribers",
+	Help: "Number of connected subscribers",
+})
+
+var slowSubscribers = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indigo_jetstream_slow_subscribers_total",
+	Help: "Total number of subscribers disconnected for not keeping up",
+})
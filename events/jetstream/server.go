@@ -0,0 +1,346 @@
+package jetstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/events"
+
+	"github.com/gorilla/websocket"
+)
+
+type ServerConfig struct {
+	// How many of the most recent events are kept in memory, for subscribers which connect with a cursor
+	BufferSize int
+	// How many events can be queued for a subscriber before it's disconnected for being too slow
+	SubscriberBuffer int
+	// Limits on the filters of a subscriber
+	MaxWantedCollections int
+	MaxWantedDIDs        int
+	Logger               *slog.Logger
+}
+
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		BufferSize:           100_000,
+		SubscriberBuffer:     10_000,
+		MaxWantedCollections: 100,
+		MaxWantedDIDs:        10_000,
+	}
+}
+
+// Server converts the events of a repo stream, passed to HandleEvent, and serves them to WebSocket subscribers in the Jetstream format. Like Jetstream, it accepts the query parameters "wantedCollections" (NSIDs, or prefixes like "app.bsky.graph.*"), "wantedDids" (both repeated), and "cursor" (a time_us to replay buffered events from). Subscribers can also update their filters by sending an "options_update" message.
+type Server struct {
+	cfg    ServerConfig
+	logger *slog.Logger
+
+	lk sync.Mutex
+	// ring buffer of the most recent events
+	buf      []*encodedEvent
+	next     int
+	full     bool
+	lastTime int64
+	subs     map[*subscriber]struct{}
+}
+
+// An event encoded once, and sent to every subscriber whose filters it matches.
+type encodedEvent struct {
+	timeUS     int64
+	did        string
+	collection string
+	data       []byte
+}
+
+func NewServer(cfg ServerConfig) *Server {
+	def := DefaultServerConfig()
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = def.BufferSize
+	}
+	if cfg.SubscriberBuffer <= 0 {
+		cfg.SubscriberBuffer = def.SubscriberBuffer
+	}
+	if cfg.MaxWantedCollections <= 0 {
+		cfg.MaxWantedCollections = def.MaxWantedCollections
+	}
+	if cfg.MaxWantedDIDs <= 0 {
+		cfg.MaxWantedDIDs = def.MaxWantedDIDs
+	}
+	logger := cfg.Logger
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Server{
+		cfg:    cfg,
+		logger: logger.With("component", "jetstream"),
+		buf:    make([]*encodedEvent, cfg.BufferSize),
+		subs:   make(map[*subscriber]struct{}),
+	}
+}
+
+// HandleEvent converts an event of the repo stream, and sends it to subscribers. Events must be handled in stream order, like with a sequential scheduler.
+func (s *Server) HandleEvent(ctx context.Context, xev *events.XRPCStreamEvent) error {
+	evts, err := Convert(xev)
+	if err != nil {
+		convertErrors.Inc()
+		s.logger.Warn("failed to convert event", "seq", xev.Sequence(), "err", err)
+		return nil
+	}
+	for _, evt := range evts {
+		if err := s.emit(evt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) emit(evt *Event) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	// unique and increasing, even if the clock goes backwards
+	evt.TimeUS = max(time.Now().UnixMicro(), s.lastTime+1)
+	s.lastTime = evt.TimeUS
+	data, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	ee := &encodedEvent{timeUS: evt.TimeUS, did: evt.Did, data: data}
+	if evt.Commit != nil {
+		ee.collection = evt.Commit.Collection
+	}
+
+	s.buf[s.next] = ee
+	s.next = (s.next + 1) % len(s.buf)
+	if s.next == 0 {
+		s.full = true
+	}
+	eventsEmitted.WithLabelValues(evt.Kind).Inc()
+
+	for sub := range s.subs {
+		if !sub.matches(ee) {
+			continue
+		}
+		select {
+		case sub.out <- ee:
+		default:
+			// too slow: disconnected, and removed from the subscribers
+			sub.cancel()
+			delete(s.subs, sub)
+			slowSubscribers.Inc()
+		}
+	}
+	return nil
+}
+
+// Registers a subscriber, and returns the buffered events after cursor (if non-zero) which match its filters.
+func (s *Server) subscribe(sub *subscriber, cursor int64) []*encodedEvent {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.subs[sub] = struct{}{}
+	subscribers.Inc()
+	if cursor <= 0 {
+		return nil
+	}
+
+	var replay []*encodedEvent
+	start, n := 0, s.next
+	if s.full {
+		start, n = s.next, len(s.buf)
+	}
+	for i := 0; i < n; i++ {
+		ee := s.buf[(start+i)%len(s.buf)]
+		if ee.timeUS > cursor && sub.matches(ee) {
+			replay = append(replay, ee)
+		}
+	}
+	return replay
+}
+
+func (s *Server) unsubscribe(sub *subscriber) {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	delete(s.subs, sub)
+	subscribers.Dec()
+}
+
+type subscriber struct {
+	out    chan *encodedEvent
+	cancel func()
+
+	// the filters can be updated by the subscriber
+	lk          sync.Mutex
+	collections []string
+	dids        map[string]bool
+}
+
+func (sub *subscriber) matches(ee *encodedEvent) bool {
+	sub.lk.Lock()
+	defer sub.lk.Unlock()
+	if len(sub.dids) > 0 && !sub.dids[ee.did] {
+		return false
+	}
+	// like with Jetstream, the collection filter doesn't apply to identity and account events
+	if len(sub.collections) == 0 || ee.collection == "" {
+		return true
+	}
+	for _, want := range sub.collections {
+		if ee.collection == want || (strings.HasSuffix(want, ".") && strings.HasPrefix(ee.collection, want)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validates and sets the filters of a subscriber.
+func (s *Server) setFilters(sub *subscriber, collections, dids []string) error {
+	if len(collections) > s.cfg.MaxWantedCollections {
+		return fmt.Errorf("too many wanted collections (max %d)", s.cfg.MaxWantedCollections)
+	}
+	if len(dids) > s.cfg.MaxWantedDIDs {
+		return fmt.Errorf("too many wanted DIDs (max %d)", s.cfg.MaxWantedDIDs)
+	}
+	var prefixes []string
+	for _, c := range collections {
+		if prefix, ok := strings.CutSuffix(c, "*"); ok {
+			if !strings.HasSuffix(prefix, ".") {
+				return fmt.Errorf("invalid wanted collection %q: wildcards must follow a dot", c)
+			}
+			prefixes = append(prefixes, prefix)
+			continue
+		}
+		if _, err := syntax.ParseNSID(c); err != nil {
+			return fmt.Errorf("invalid wanted collection: %w", err)
+		}
+		prefixes = append(prefixes, c)
+	}
+	var didSet map[string]bool
+	if len(dids) > 0 {
+		didSet = make(map[string]bool, len(dids))
+		for _, d := range dids {
+			if _, err := syntax.ParseDID(d); err != nil {
+				return fmt.Errorf("invalid wanted DID: %w", err)
+			}
+			didSet[d] = true
+		}
+	}
+
+	sub.lk.Lock()
+	defer sub.lk.Unlock()
+	sub.collections = prefixes
+	sub.dids = didSet
+	return nil
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	CheckOrigin:     func(r *http.Request) bool { return true },
+}
+
+// A message sent by a subscriber.
+type subscriberMessage struct {
+	Type    string `json:"type"`
+	Payload struct {
+		WantedCollections []string `json:"wantedCollections"`
+		WantedDIDs        []string `json:"wantedDids"`
+	} `json:"payload"`
+}
+
+// ServeHTTP handles a subscription.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var cursor int64
+	if c := q.Get("cursor"); c != "" {
+		var err error
+		cursor, err = strconv.ParseInt(c, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	sub := &subscriber{
+		out:    make(chan *encodedEvent, s.cfg.SubscriberBuffer),
+		cancel: cancel,
+	}
+	if err := s.setFilters(sub, q["wantedCollections"], q["wantedDids"]); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	con, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already replied with an error
+		return
+	}
+	defer con.Close()
+
+	logger := s.logger.With("remote_addr", r.RemoteAddr, "user_agent", r.UserAgent())
+	logger.Info("new subscriber", "cursor", cursor)
+
+	replay := s.subscribe(sub, cursor)
+	defer s.unsubscribe(sub)
+
+	// reads options updates, and notices when the connection is closed
+	go func() {
+		defer cancel()
+		for {
+			_, data, err := con.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg subscriberMessage
+			if err := json.Unmarshal(data, &msg); err != nil || msg.Type != "options_update" {
+				logger.Info("ignoring unknown subscriber message")
+				continue
+			}
+			if err := s.setFilters(sub, msg.Payload.WantedCollections, msg.Payload.WantedDIDs); err != nil {
+				logger.Info("invalid options update", "err", err)
+				_ = con.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()), time.Now().Add(time.Second))
+				return
+			}
+		}
+	}()
+
+	write := func(ee *encodedEvent) error {
+		if err := con.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+			return err
+		}
+		return con.WriteMessage(websocket.TextMessage, ee.data)
+	}
+	for _, ee := range replay {
+		if ctx.Err() != nil {
+			return
+		}
+		if err := write(ee); err != nil {
+			return
+		}
+	}
+
+	ping := time.NewTicker(30 * time.Second)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ping.C:
+			if err := con.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				return
+			}
+		case ee := <-sub.out:
+			if err := write(ee); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -15,6 +15,16 @@ var bytesFromStreamCounter = promauto.NewCounterVec(prometheus.CounterOpts{
 	Help: "Total bytes received from the stream",
 }, []string{"remote_addr"})
 
+var seqGapsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_repo_stream_seq_gaps_total",
+	Help: "Total number of gaps in the sequence numbers of events received from the stream",
+}, []string{"remote_addr"})
+
+var missedSeqsCounter = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_repo_stream_missed_seqs_total",
+	Help: "Total number of sequence numbers missing from the stream",
+}, []string{"remote_addr"})
+
 var eventsEnqueued = promauto.NewCounterVec(prometheus.CounterOpts{
 	Name: "indigo_events_enqueued_for_broadcast_total",
 	Help: "Total number of events enqueued to broadcast to subscribers",
@@ -24,3 +34,8 @@ var eventsBroadcast = promauto.NewCounterVec(prometheus.CounterOpts{
 	Name: "indigo_events_broadcast_total",
 	Help: "Total number of events broadcast to subscribers",
 }, []string{"pool"})
+
+var eventsFilteredCounter = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "indigo_repo_stream_events_filtered_total",
+	Help: "Total number of events dropped by a stream filter",
+})
@@ -19,6 +19,11 @@ type EventPersistence interface {
 	SetEventBroadcaster(func(*XRPCStreamEvent))
 }
 
+// UserEventPlayback is an optional interface for EventPersistence implementations which can efficiently replay the persisted events of a single account.
+type UserEventPlayback interface {
+	PlaybackUser(ctx context.Context, usr models.Uid, since int64, cb func(*XRPCStreamEvent) error) error
+}
+
 // MemPersister is the most naive implementation of event persistence
 // This EventPersistence option works fine with all event types
 // ill do better later
@@ -47,6 +52,10 @@ func (mp *MemPersister) Persist(ctx context.Context, e *XRPCStreamEvent) error {
 		e.RepoMigrate.Seq = mp.seq
 	case e.RepoTombstone != nil:
 		e.RepoTombstone.Seq = mp.seq
+	case e.RepoIdentity != nil:
+		e.RepoIdentity.Seq = mp.seq
+	case e.RepoAccount != nil:
+		e.RepoAccount.Seq = mp.seq
 	case e.LabelLabels != nil:
 		e.LabelLabels.Seq = mp.seq
 	default:
@@ -0,0 +1,246 @@
+package bounded
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/events"
+	"github.com/bluesky-social/indigo/events/schedulers"
+	logging "github.com/ipfs/go-log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var log = logging.Logger("bounded-scheduler")
+
+type Settings struct {
+	// Number of workers
+	Concurrency int
+	// Maximum number of work items queued or being processed, across all repos; AddWork blocks while it's reached, which stops the reader of the stream
+	MaxBuffered int
+	// Maximum number of work items queued or being processed for a single repo, so that one busy repo can't fill the whole buffer; zero means no limit other than MaxBuffered
+	MaxBufferedPerRepo int
+}
+
+func DefaultSettings() Settings {
+	return Settings{
+		Concurrency:        16,
+		MaxBuffered:        10_000,
+		MaxBufferedPerRepo: 100,
+	}
+}
+
+// Scheduler is a parallel scheduler with a fixed number of workers, which processes the work items of each repo in order (one at a time), and buffers a bounded number of them: when the buffer is full, AddWork blocks until a worker is done with an item.
+type Scheduler struct {
+	settings Settings
+
+	do func(context.Context, *events.XRPCStreamEvent) error
+
+	// holds one value per buffered work item
+	slots chan struct{}
+	// repos with buffered work items and no worker processing them; there are never more of them than buffered items, so sends don't block
+	ready   chan *repoQueue
+	stop    chan struct{}
+	workers sync.WaitGroup
+
+	lk    sync.Mutex
+	repos map[string]*repoQueue
+
+	ident string
+
+	// metrics
+	itemsAdded     prometheus.Counter
+	itemsProcessed prometheus.Counter
+	itemsActive    prometheus.Counter
+	workersActive  prometheus.Gauge
+	itemsBuffered  prometheus.Gauge
+	queueDuration  prometheus.Observer
+	backpressure   prometheus.Counter
+}
+
+type repoQueue struct {
+	repo string
+	// the first item is being processed, or about to be
+	tasks []*consumerTask
+	// closed when an item of the repo is done, if AddWork is waiting for room in the queue
+	space chan struct{}
+}
+
+type consumerTask struct {
+	val   *events.XRPCStreamEvent
+	added time.Time
+}
+
+func NewScheduler(settings Settings, ident string, do func(context.Context, *events.XRPCStreamEvent) error) *Scheduler {
+	settings.Concurrency = max(settings.Concurrency, 1)
+	settings.MaxBuffered = max(settings.MaxBuffered, 1)
+	p := &Scheduler{
+		settings: settings,
+
+		do: do,
+
+		slots: make(chan struct{}, settings.MaxBuffered),
+		ready: make(chan *repoQueue, settings.MaxBuffered),
+		stop:  make(chan struct{}),
+		repos: make(map[string]*repoQueue),
+
+		ident: ident,
+
+		itemsAdded:     schedulers.WorkItemsAdded.WithLabelValues(ident, "bounded"),
+		itemsProcessed: schedulers.WorkItemsProcessed.WithLabelValues(ident, "bounded"),
+		itemsActive:    schedulers.WorkItemsActive.WithLabelValues(ident, "bounded"),
+		workersActive:  schedulers.WorkersActive.WithLabelValues(ident, "bounded"),
+		itemsBuffered:  schedulers.WorkItemsBuffered.WithLabelValues(ident, "bounded"),
+		queueDuration:  schedulers.WorkItemQueueDuration.WithLabelValues(ident, "bounded"),
+		backpressure:   schedulers.BackpressureDuration.WithLabelValues(ident, "bounded"),
+	}
+
+	p.workers.Add(settings.Concurrency)
+	for i := 0; i < settings.Concurrency; i++ {
+		go p.worker()
+	}
+
+	p.workersActive.Set(float64(settings.Concurrency))
+
+	return p
+}
+
+// Shutdown waits for the workers to finish the items they are processing; buffered items which weren't started are dropped.
+func (p *Scheduler) Shutdown() {
+	log.Infof("shutting down bounded scheduler for %s", p.ident)
+
+	close(p.stop)
+	p.workers.Wait()
+
+	p.workersActive.Set(0)
+	p.itemsBuffered.Sub(float64(len(p.slots)))
+
+	log.Info("bounded scheduler shutdown complete")
+}
+
+// AddWork buffers a work item, to be processed after the earlier items of the same repo. It blocks while the buffer (or the queue of the repo) is full, and returns early with an error if the context is done.
+func (p *Scheduler) AddWork(ctx context.Context, repo string, val *events.XRPCStreamEvent) error {
+	p.itemsAdded.Inc()
+
+	start := time.Now()
+	blocked := false
+	defer func() {
+		if blocked {
+			p.backpressure.Add(time.Since(start).Seconds())
+		}
+	}()
+
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		blocked = true
+		select {
+		case p.slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for {
+		p.lk.Lock()
+		q, ok := p.repos[repo]
+		if !ok {
+			q = &repoQueue{repo: repo}
+			p.repos[repo] = q
+		}
+		if p.settings.MaxBufferedPerRepo <= 0 || len(q.tasks) < p.settings.MaxBufferedPerRepo {
+			q.tasks = append(q.tasks, &consumerTask{val: val, added: time.Now()})
+			if len(q.tasks) == 1 {
+				p.ready <- q
+			}
+			p.lk.Unlock()
+			p.itemsBuffered.Inc()
+			return nil
+		}
+		if q.space == nil {
+			q.space = make(chan struct{})
+		}
+		space := q.space
+		p.lk.Unlock()
+
+		// keeps the slot: the items of the repo will be done regardless
+		blocked = true
+		select {
+		case <-space:
+		case <-ctx.Done():
+			<-p.slots
+			return ctx.Err()
+		}
+	}
+}
+
+// Buffered returns the number of work items queued or being processed.
+func (p *Scheduler) Buffered() int {
+	return len(p.slots)
+}
+
+// RepoLag returns the number of work items of a repo which are queued or being processed, and how long ago the oldest of them was added.
+func (p *Scheduler) RepoLag(repo string) (int, time.Duration) {
+	p.lk.Lock()
+	defer p.lk.Unlock()
+	q, ok := p.repos[repo]
+	if !ok || len(q.tasks) == 0 {
+		return 0, 0
+	}
+	return len(q.tasks), time.Since(q.tasks[0].added)
+}
+
+func (p *Scheduler) worker() {
+	defer p.workers.Done()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case q := <-p.ready:
+			if !p.process(q) {
+				return
+			}
+		}
+	}
+}
+
+// Processes the items of a repo until its queue is empty, and returns false if the scheduler is shutting down.
+func (p *Scheduler) process(q *repoQueue) bool {
+	for {
+		p.lk.Lock()
+		work := q.tasks[0]
+		p.lk.Unlock()
+
+		p.queueDuration.Observe(time.Since(work.added).Seconds())
+		p.itemsActive.Inc()
+		if err := p.do(context.TODO(), work.val); err != nil {
+			log.Errorf("event handler failed: %s", err)
+		}
+		p.itemsProcessed.Inc()
+
+		p.lk.Lock()
+		q.tasks[0] = nil
+		q.tasks = q.tasks[1:]
+		if q.space != nil {
+			close(q.space)
+			q.space = nil
+		}
+		empty := len(q.tasks) == 0
+		if empty {
+			delete(p.repos, q.repo)
+		}
+		p.lk.Unlock()
+
+		<-p.slots
+		p.itemsBuffered.Dec()
+
+		if empty {
+			return true
+		}
+		select {
+		case <-p.stop:
+			return false
+		default:
+		}
+	}
+}
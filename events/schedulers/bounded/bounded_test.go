@@ -0,0 +1,210 @@
+package bounded
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/events"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func commitEvent(repo string, seq int64) *events.XRPCStreamEvent {
+	return &events.XRPCStreamEvent{RepoCommit: &comatproto.SyncSubscribeRepos_Commit{Repo: repo, Seq: seq}}
+}
+
+// Waits for cond to be true, failing the test after a second.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPerRepoOrdering(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	const repos, perRepo = 10, 100
+	var lk sync.Mutex
+	seen := make(map[string][]int64)
+	inFlight := make(map[string]bool)
+	var overlaps atomic.Int64
+	var processed sync.WaitGroup
+	processed.Add(repos * perRepo)
+
+	sched := NewScheduler(Settings{Concurrency: 8, MaxBuffered: 32, MaxBufferedPerRepo: 4}, "test-ordering", func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+		repo := evt.RepoCommit.Repo
+		lk.Lock()
+		if inFlight[repo] {
+			overlaps.Add(1)
+		}
+		inFlight[repo] = true
+		lk.Unlock()
+
+		// give other workers a chance to pick up the same repo
+		time.Sleep(time.Duration(evt.RepoCommit.Seq%3) * 100 * time.Microsecond)
+
+		lk.Lock()
+		inFlight[repo] = false
+		seen[repo] = append(seen[repo], evt.RepoCommit.Seq)
+		lk.Unlock()
+		processed.Done()
+		return nil
+	})
+	defer sched.Shutdown()
+
+	// interleaved, so the repos contend for the buffer
+	for i := 0; i < perRepo; i++ {
+		for r := 0; r < repos; r++ {
+			assert.NoError(sched.AddWork(ctx, fmt.Sprintf("did:plc:repo%d", r), commitEvent(fmt.Sprintf("did:plc:repo%d", r), int64(i))))
+		}
+	}
+	processed.Wait()
+
+	assert.Zero(overlaps.Load(), "items of the same repo were processed concurrently")
+	assert.Len(seen, repos)
+	for repo, seqs := range seen {
+		assert.Len(seqs, perRepo, repo)
+		for i, seq := range seqs {
+			if !assert.Equal(int64(i), seq, repo) {
+				break
+			}
+		}
+	}
+	waitFor(t, func() bool { return sched.Buffered() == 0 })
+}
+
+func TestConcurrencyBound(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var active, maxActive atomic.Int64
+	release := make(chan struct{})
+	sched := NewScheduler(Settings{Concurrency: 3, MaxBuffered: 100}, "test-concurrency", func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+		n := active.Add(1)
+		for {
+			m := maxActive.Load()
+			if n <= m || maxActive.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		<-release
+		active.Add(-1)
+		return nil
+	})
+
+	// one item per repo, so nothing is held back by ordering
+	for i := 0; i < 10; i++ {
+		repo := fmt.Sprintf("did:plc:repo%d", i)
+		assert.NoError(sched.AddWork(ctx, repo, commitEvent(repo, 1)))
+	}
+	waitFor(t, func() bool { return active.Load() == 3 })
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(int64(3), active.Load())
+	assert.Equal(10, sched.Buffered())
+
+	close(release)
+	waitFor(t, func() bool { return sched.Buffered() == 0 })
+	assert.Equal(int64(3), maxActive.Load())
+	sched.Shutdown()
+}
+
+func TestBufferBounds(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	release := make(chan struct{})
+	sched := NewScheduler(Settings{Concurrency: 1, MaxBuffered: 3, MaxBufferedPerRepo: 2}, "test-buffer", func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+		<-release
+		return nil
+	})
+
+	timeout := func() context.Context {
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		t.Cleanup(cancel)
+		return ctx
+	}
+
+	// the per-repo limit applies before the total one
+	assert.NoError(sched.AddWork(ctx, "did:plc:busy", commitEvent("did:plc:busy", 1)))
+	assert.NoError(sched.AddWork(ctx, "did:plc:busy", commitEvent("did:plc:busy", 2)))
+	assert.ErrorIs(sched.AddWork(timeout(), "did:plc:busy", commitEvent("did:plc:busy", 3)), context.DeadlineExceeded)
+	n, lag := sched.RepoLag("did:plc:busy")
+	assert.Equal(2, n)
+	assert.Greater(lag, time.Duration(0))
+
+	// a timed out item doesn't keep its slot
+	assert.Equal(2, sched.Buffered())
+	assert.NoError(sched.AddWork(ctx, "did:plc:other", commitEvent("did:plc:other", 1)))
+	assert.ErrorIs(sched.AddWork(timeout(), "did:plc:third", commitEvent("did:plc:third", 1)), context.DeadlineExceeded)
+	assert.Equal(3, sched.Buffered())
+
+	// a blocked AddWork resumes once an item is done
+	added := make(chan error)
+	go func() {
+		added <- sched.AddWork(ctx, "did:plc:third", commitEvent("did:plc:third", 1))
+	}()
+	select {
+	case <-added:
+		t.Fatal("AddWork should block while the buffer is full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	release <- struct{}{}
+	assert.NoError(<-added)
+
+	close(release)
+	waitFor(t, func() bool { return sched.Buffered() == 0 })
+	n, _ = sched.RepoLag("did:plc:busy")
+	assert.Zero(n)
+	sched.Shutdown()
+}
+
+func TestShutdown(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	started := make(chan struct{}, 10)
+	release := make(chan struct{})
+	var processed atomic.Int64
+	sched := NewScheduler(Settings{Concurrency: 2, MaxBuffered: 10}, "test-shutdown", func(ctx context.Context, evt *events.XRPCStreamEvent) error {
+		started <- struct{}{}
+		<-release
+		processed.Add(1)
+		return nil
+	})
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(sched.AddWork(ctx, "did:plc:abc", commitEvent("did:plc:abc", int64(i))))
+	}
+	<-started
+
+	// waits for the item being processed, then drops the rest of the buffer
+	done := make(chan struct{})
+	go func() {
+		sched.Shutdown()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Shutdown returned while an item was being processed")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown didn't return after the item was processed")
+	}
+	assert.Equal(int64(1), processed.Load())
+	assert.Len(started, 0)
+}
@@ -24,3 +24,19 @@ var WorkersActive = promauto.NewGaugeVec(prometheus.GaugeOpts{
 	Name: "indigo_scheduler_workers_active",
 	Help: "Number of workers currently active",
 }, []string{"pool", "scheduler_type"})
+
+var WorkItemsBuffered = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "indigo_scheduler_work_items_buffered",
+	Help: "Number of work items queued or being processed",
+}, []string{"pool", "scheduler_type"})
+
+var WorkItemQueueDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "indigo_scheduler_work_item_queue_duration_seconds",
+	Help:    "Time work items spent queued (behind earlier items of the same repo, or waiting for a worker) before being processed",
+	Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+}, []string{"pool", "scheduler_type"})
+
+var BackpressureDuration = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indigo_scheduler_backpressure_seconds_total",
+	Help: "Total time spent blocking the producer because the scheduler's buffer was full",
+}, []string{"pool", "scheduler_type"})
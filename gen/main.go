@@ -70,8 +70,13 @@ func main() {
 		atproto.SyncSubscribeRepos_Migrate{},
 		atproto.SyncSubscribeRepos_RepoOp{},
 		atproto.SyncSubscribeRepos_Tombstone{},
+		atproto.SyncSubscribeRepos_Identity{},
+		atproto.SyncSubscribeRepos_Account{},
 		atproto.LabelDefs_SelfLabels{},
 		atproto.LabelDefs_SelfLabel{},
+		atproto.LabelDefs_Label{},
+		atproto.LabelSubscribeLabels_Labels{},
+		atproto.LabelSubscribeLabels_Info{},
 	); err != nil {
 		panic(err)
 	}
@@ -80,7 +85,7 @@ func main() {
 		panic(err)
 	}
 
-	if err := cbg.WriteMapEncodersToFile("lex/util/cbor_gen.go", "util", lexutil.CborChecker{}, lexutil.LegacyBlob{}, lexutil.BlobSchema{}); err != nil {
+	if err := cbg.WriteMapEncodersToFile("lex/util/cbor_gen.go", "util", lexutil.CborChecker{}, lexutil.LegacyBlob{}, lexutil.BlobSchema{}, lexutil.StreamFrameHeader{}, lexutil.StreamErrorFrame{}); err != nil {
 		panic(err)
 	}
 
@@ -0,0 +1,263 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"golang.org/x/time/rate"
+)
+
+// CrawlLimitSettings tune how the crawl rate limit of each PDS adapts to its responses: the limit follows the RateLimit-* headers of the PDS, pauses while its rate limit is exhausted, is halved when too many requests fail, and recovers gradually up to the configured limit (the CrawlRateLimit of the PDS).
+type CrawlLimitSettings struct {
+	// Fraction of failed requests (network errors, server errors, and rate limited requests; exponentially weighted) above which the limit is lowered
+	MaxErrorRate float64
+	// The limit isn't lowered below this, in requests per second, unless the PDS asks for it with its rate limit headers
+	MinLimit float64
+	// The limit is adjusted at most once per interval
+	AdjustInterval time.Duration
+	// Longest pause when the rate limit of a PDS is exhausted
+	MaxPause time.Duration
+}
+
+func DefaultCrawlLimitSettings() CrawlLimitSettings {
+	return CrawlLimitSettings{
+		MaxErrorRate:   0.2,
+		MinLimit:       0.1,
+		AdjustInterval: 10 * time.Second,
+		MaxPause:       5 * time.Minute,
+	}
+}
+
+// CrawlLimitStatus is the current state of the crawl rate limit of a PDS.
+type CrawlLimitStatus struct {
+	// The limit of the PDS (its CrawlRateLimit), which the adaptive limit recovers up to
+	Configured float64 `json:"Configured"`
+	// The limit after adjustments for failed requests
+	Adaptive float64 `json:"Adaptive"`
+	// The limit applied: the override, or the lowest of the adaptive and header limits; zero if there is none
+	Current float64 `json:"Current"`
+	// If set by an operator, the limit applied instead, without adjustments
+	Override  float64 `json:"Override,omitempty"`
+	ErrorRate float64 `json:"ErrorRate"`
+	// The sustainable rate according to the last rate limit headers of the PDS, until they reset
+	HeaderLimit float64    `json:"HeaderLimit,omitempty"`
+	PausedUntil *time.Time `json:"PausedUntil,omitempty"`
+}
+
+// weight of each request in the error rate
+const crawlErrorRateAlpha = 0.1
+
+type crawlLimit struct {
+	lk       sync.Mutex
+	host     string
+	limiter  *rate.Limiter
+	settings CrawlLimitSettings
+
+	configured  float64
+	adaptive    float64
+	override    float64
+	errorRate   float64
+	headerLimit float64
+	headerUntil time.Time
+	pausedUntil time.Time
+	lastAdjust  time.Time
+}
+
+// Returns the crawl limit of a PDS, creating it if needed.
+func (rf *RepoFetcher) crawlLimit(pds *models.PDS) *crawlLimit {
+	limiter := rf.GetOrCreateLimiter(pds.ID, pds.CrawlRateLimit)
+
+	rf.LimitMux.Lock()
+	defer rf.LimitMux.Unlock()
+	cl, ok := rf.crawlLimits[pds.ID]
+	if !ok {
+		cl = &crawlLimit{
+			host:       pds.Host,
+			settings:   rf.CrawlLimitSettings,
+			configured: pds.CrawlRateLimit,
+			adaptive:   pds.CrawlRateLimit,
+		}
+		rf.crawlLimits[pds.ID] = cl
+	}
+	// the limiter may have been replaced with SetLimiter
+	cl.lk.Lock()
+	cl.limiter = limiter
+	cl.lk.Unlock()
+	return cl
+}
+
+// SetCrawlLimit sets the configured crawl rate limit of a PDS, which the adaptive limit recovers up to; it should match the CrawlRateLimit of the PDS in the database.
+func (rf *RepoFetcher) SetCrawlLimit(pds *models.PDS, limit float64) {
+	cl := rf.crawlLimit(pds)
+	cl.lk.Lock()
+	defer cl.lk.Unlock()
+	cl.configured = limit
+	cl.adaptive = limit
+	cl.applyLocked(time.Now())
+}
+
+// OverrideCrawlLimit sets the crawl rate limit of a PDS until the relay restarts, disabling adjustments; a limit of zero removes the override.
+func (rf *RepoFetcher) OverrideCrawlLimit(pds *models.PDS, limit float64) {
+	cl := rf.crawlLimit(pds)
+	cl.lk.Lock()
+	defer cl.lk.Unlock()
+	cl.override = limit
+	cl.applyLocked(time.Now())
+}
+
+// CrawlLimitStatus returns the state of the crawl rate limit of a PDS, or nil if it wasn't crawled yet.
+func (rf *RepoFetcher) CrawlLimitStatus(pdsID uint) *CrawlLimitStatus {
+	rf.LimitMux.RLock()
+	cl, ok := rf.crawlLimits[pdsID]
+	rf.LimitMux.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	cl.lk.Lock()
+	defer cl.lk.Unlock()
+	now := time.Now()
+	st := &CrawlLimitStatus{
+		Configured: cl.configured,
+		Adaptive:   cl.adaptive,
+		Current:    cl.currentLocked(now),
+		Override:   cl.override,
+		ErrorRate:  cl.errorRate,
+	}
+	if st.Current == float64(rate.Inf) {
+		st.Current = 0
+	}
+	if now.Before(cl.headerUntil) {
+		st.HeaderLimit = cl.headerLimit
+	}
+	if now.Before(cl.pausedUntil) {
+		until := cl.pausedUntil
+		st.PausedUntil = &until
+	}
+	return st
+}
+
+// Waits for the pause of the PDS, if any, and for the limiter.
+func (cl *crawlLimit) wait(ctx context.Context) error {
+	cl.lk.Lock()
+	now := time.Now()
+	// header limits which expired are lifted
+	cl.applyLocked(now)
+	pause := cl.pausedUntil.Sub(now)
+	limiter := cl.limiter
+	cl.lk.Unlock()
+	if pause > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pause):
+		}
+	}
+	return limiter.Wait(ctx)
+}
+
+// Records the result of a request to the PDS, with the rate limit headers of its response (for successful requests), and adjusts the limit.
+func (cl *crawlLimit) observe(err error, rl *xrpc.RatelimitInfo) {
+	var failed, throttled bool
+	var retryAfter time.Time
+	var xe *xrpc.Error
+	switch {
+	case err == nil:
+	case errors.As(err, &xe) && xe.StatusCode != 0:
+		// errors about the repo, like RepoNotFound, aren't failures of the PDS
+		throttled = xe.IsThrottled()
+		failed = throttled || xe.StatusCode >= 500
+		if xe.Ratelimit != nil {
+			rl = xe.Ratelimit
+		}
+		retryAfter = xe.RetryAfter
+	case errors.Is(err, context.Canceled):
+		// not the fault of the PDS
+		return
+	default:
+		// network errors
+		failed = true
+	}
+
+	cl.lk.Lock()
+	defer cl.lk.Unlock()
+	now := time.Now()
+	s := cl.settings
+
+	sample := 0.0
+	if failed {
+		sample = 1
+	}
+	cl.errorRate = cl.errorRate*(1-crawlErrorRateAlpha) + sample*crawlErrorRateAlpha
+
+	if rl != nil && rl.Reset.After(now) {
+		if rl.Remaining > 0 {
+			// spread the remaining requests until the reset
+			cl.headerLimit = float64(rl.Remaining) / rl.Reset.Sub(now).Seconds()
+			cl.headerUntil = rl.Reset
+		} else {
+			cl.pauseLocked(now, rl.Reset)
+		}
+	}
+	if throttled {
+		switch {
+		case retryAfter.After(now):
+			cl.pauseLocked(now, retryAfter)
+		case rl == nil || !rl.Reset.After(now):
+			cl.pauseLocked(now, now.Add(s.AdjustInterval))
+		}
+	}
+
+	if now.Sub(cl.lastAdjust) >= s.AdjustInterval {
+		switch {
+		case throttled || cl.errorRate > s.MaxErrorRate:
+			cl.adaptive = max(cl.adaptive/2, min(s.MinLimit, cl.configured))
+			cl.lastAdjust = now
+			crawlLimitDecreases.WithLabelValues(cl.host).Inc()
+			log.Warnw("lowering crawl rate limit of PDS", "pds", cl.host, "limit", cl.adaptive, "errorRate", cl.errorRate, "throttled", throttled)
+		case cl.adaptive < cl.configured && cl.errorRate < s.MaxErrorRate/2:
+			// additive increase, back to the configured limit in ten steps
+			cl.adaptive = min(cl.adaptive+cl.configured/10, cl.configured)
+			cl.lastAdjust = now
+		}
+	}
+	cl.applyLocked(now)
+}
+
+func (cl *crawlLimit) pauseLocked(now, until time.Time) {
+	if longest := now.Add(cl.settings.MaxPause); until.After(longest) {
+		until = longest
+	}
+	if until.After(cl.pausedUntil) {
+		cl.pausedUntil = until
+		crawlLimitPauses.WithLabelValues(cl.host).Inc()
+	}
+}
+
+func (cl *crawlLimit) currentLocked(now time.Time) float64 {
+	if cl.override > 0 {
+		return cl.override
+	}
+	limit := cl.adaptive
+	if cl.configured <= 0 {
+		// PDSs without a crawl limit are only paced by their rate limit headers
+		limit = float64(rate.Inf)
+	}
+	if now.Before(cl.headerUntil) {
+		limit = min(limit, cl.headerLimit)
+	}
+	return limit
+}
+
+func (cl *crawlLimit) applyLocked(now time.Time) {
+	limit := cl.currentLocked(now)
+	if cl.limiter.Limit() != rate.Limit(limit) {
+		cl.limiter.SetLimitAt(now, rate.Limit(limit))
+	}
+	crawlLimitGauge.WithLabelValues(cl.host).Set(limit)
+}
@@ -0,0 +1,83 @@
+package indexer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestCrawlLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	rf := NewRepoFetcher(nil, nil)
+	// adjusted after each request
+	rf.CrawlLimitSettings.AdjustInterval = 0
+	pds := &models.PDS{Host: "pds.example.com", CrawlRateLimit: 10}
+	pds.ID = 1
+	assert.Nil(rf.CrawlLimitStatus(pds.ID))
+	cl := rf.crawlLimit(pds)
+
+	// the remaining requests are spread until the reset
+	cl.observe(nil, &xrpc.RatelimitInfo{Limit: 100, Remaining: 50, Reset: time.Now().Add(20 * time.Second)})
+	st := rf.CrawlLimitStatus(pds.ID)
+	assert.Equal(10.0, st.Adaptive)
+	assert.InDelta(2.5, st.Current, 0.1)
+	assert.InDelta(2.5, float64(rf.GetLimiter(pds.ID).Limit()), 0.1)
+	assert.Nil(st.PausedUntil)
+
+	// rate limited: paused until the reset, and lowered
+	reset := time.Now().Add(time.Minute).Truncate(time.Second)
+	cl.observe(&xrpc.Error{StatusCode: 429, Ratelimit: &xrpc.RatelimitInfo{Limit: 100, Remaining: 0, Reset: reset}}, nil)
+	st = rf.CrawlLimitStatus(pds.ID)
+	assert.Equal(5.0, st.Adaptive)
+	if assert.NotNil(st.PausedUntil) {
+		assert.Equal(reset, *st.PausedUntil)
+	}
+
+	// server and network errors lower the limit, down to the minimum; errors about repos don't
+	for i := 0; i < 10; i++ {
+		cl.observe(&xrpc.Error{StatusCode: 502}, nil)
+		cl.observe(errors.New("connection refused"), nil)
+	}
+	st = rf.CrawlLimitStatus(pds.ID)
+	assert.Equal(0.1, st.Adaptive)
+	assert.Greater(st.ErrorRate, 0.5)
+	errorRate := st.ErrorRate
+	cl.observe(&xrpc.Error{StatusCode: 400, Name: "RepoNotFound"}, nil)
+	assert.Less(rf.CrawlLimitStatus(pds.ID).ErrorRate, errorRate)
+
+	// overrides apply as is
+	rf.OverrideCrawlLimit(pds, 20)
+	st = rf.CrawlLimitStatus(pds.ID)
+	assert.Equal(20.0, st.Current)
+	assert.Equal(20.0, float64(rf.GetLimiter(pds.ID).Limit()))
+	rf.OverrideCrawlLimit(pds, 0)
+
+	// once requests succeed again, the limit recovers up to the configured one
+	for i := 0; i < 50; i++ {
+		cl.observe(nil, nil)
+	}
+	st = rf.CrawlLimitStatus(pds.ID)
+	assert.Equal(10.0, st.Adaptive)
+	assert.Less(st.ErrorRate, 0.01)
+
+	// PDSs without a configured limit are only paced by their headers
+	unlimited := &models.PDS{Host: "other.example.com"}
+	unlimited.ID = 2
+	rf.crawlLimit(unlimited).observe(nil, nil)
+	assert.Equal(0.0, rf.CrawlLimitStatus(unlimited.ID).Current)
+	assert.Equal(rate.Inf, rf.GetLimiter(unlimited.ID).Limit())
+
+	rf.SetCrawlLimit(pds, 4)
+	st = rf.CrawlLimitStatus(pds.ID)
+	assert.Equal(4.0, st.Configured)
+	assert.Equal(4.0, st.Adaptive)
+	// the rate limit headers still apply
+	assert.InDelta(2.5, st.Current, 0.1)
+}
@@ -105,9 +105,9 @@ func (ix *Indexer) HandleRepoEvent(ctx context.Context, evt *repomgr.RepoEvent)
 		return err
 	}
 
-	toobig := false
+	toobig := evt.TooBig
 	slice := evt.RepoSlice
-	if len(slice) > MaxEventSliceLength || len(outops) > MaxOpsSliceLength {
+	if toobig || len(slice) > MaxEventSliceLength || len(outops) > MaxOpsSliceLength {
 		slice = []byte{}
 		outops = nil
 		toobig = true
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/bluesky-social/indigo/atproto/crypto"
+
 	did "github.com/whyrusleeping/go-did"
 	"go.opentelemetry.io/otel"
 )
@@ -12,6 +14,7 @@ type KeyManager struct {
 	didr DidResolver
 
 	signingKey *did.PrivKey
+	signer     crypto.Signer
 }
 
 type DidResolver interface {
@@ -25,6 +28,11 @@ func NewKeyManager(didr DidResolver, k *did.PrivKey) *KeyManager {
 	}
 }
 
+// SetSigner makes the key manager sign with signer instead of its signing key, eg for a key held in an HSM or KMS.
+func (km *KeyManager) SetSigner(signer crypto.Signer) {
+	km.signer = signer
+}
+
 func (km *KeyManager) VerifyUserSignature(ctx context.Context, did string, sig []byte, msg []byte) error {
 	ctx, span := otel.Tracer("keymgr").Start(ctx, "verifySignature")
 	defer span.End()
@@ -61,6 +69,10 @@ func (km *KeyManager) getKey(ctx context.Context, did string) (*did.PubKey, erro
 }
 
 func (km *KeyManager) SignForUser(ctx context.Context, did string, msg []byte) ([]byte, error) {
+	if km.signer != nil {
+		return km.signer.HashAndSign(ctx, msg)
+	}
+
 	if km.signingKey == nil {
 		return nil, fmt.Errorf("key manager does not have a signing key, cannot sign")
 	}
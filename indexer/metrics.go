@@ -34,3 +34,18 @@ var catchupEventsProcessed = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "indexer_catchup_events_processed",
 	Help: "Number of catchup events processed",
 })
+
+var crawlLimitGauge = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "indexer_crawl_rate_limit",
+	Help: "Current crawl rate limit of each PDS, in requests per second",
+}, []string{"pds"})
+
+var crawlLimitDecreases = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indexer_crawl_rate_limit_decreases",
+	Help: "Number of times the crawl rate limit of a PDS was lowered, after failed or rate limited requests",
+}, []string{"pds"})
+
+var crawlLimitPauses = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "indexer_crawl_pauses",
+	Help: "Number of times crawling a PDS was paused, because its rate limit was exhausted",
+}, []string{"pds"})
@@ -23,6 +23,8 @@ func NewRepoFetcher(db *gorm.DB, rm *repomgr.RepoManager) *RepoFetcher {
 		db:                     db,
 		Limiters:               make(map[uint]*rate.Limiter),
 		ApplyPDSClientSettings: func(*xrpc.Client) {},
+		CrawlLimitSettings:     DefaultCrawlLimitSettings(),
+		crawlLimits:            make(map[uint]*crawlLimit),
 	}
 }
 
@@ -32,8 +34,12 @@ type RepoFetcher struct {
 
 	Limiters map[uint]*rate.Limiter
 	LimitMux sync.RWMutex
+	// adaptive state of the crawl limits, also guarded by LimitMux
+	crawlLimits map[uint]*crawlLimit
 
 	ApplyPDSClientSettings func(*xrpc.Client)
+	// How crawl rate limits adapt to each PDS; only applies to PDSs crawled after it's changed
+	CrawlLimitSettings CrawlLimitSettings
 }
 
 func (rf *RepoFetcher) GetLimiter(pdsID uint) *rate.Limiter {
@@ -44,8 +50,8 @@ func (rf *RepoFetcher) GetLimiter(pdsID uint) *rate.Limiter {
 }
 
 func (rf *RepoFetcher) GetOrCreateLimiter(pdsID uint, pdsrate float64) *rate.Limiter {
-	rf.LimitMux.RLock()
-	defer rf.LimitMux.RUnlock()
+	rf.LimitMux.Lock()
+	defer rf.LimitMux.Unlock()
 
 	lim, ok := rf.Limiters[pdsID]
 	if !ok {
@@ -73,14 +79,19 @@ func (rf *RepoFetcher) fetchRepo(ctx context.Context, c *xrpc.Client, pds *model
 		attribute.String("rev", rev),
 	)
 
-	limiter := rf.GetOrCreateLimiter(pds.ID, pds.CrawlRateLimit)
+	cl := rf.crawlLimit(pds)
 
 	// Wait to prevent DOSing the PDS when connecting to a new stream with lots of active repos
-	limiter.Wait(ctx)
+	if err := cl.wait(ctx); err != nil {
+		return nil, err
+	}
 
 	log.Debugw("SyncGetRepo", "did", did, "since", rev)
+	var ratelimit *xrpc.RatelimitInfo
+	ctx = xrpc.WithCallOptions(ctx, xrpc.ObserveRatelimit(func(rl *xrpc.RatelimitInfo) { ratelimit = rl }))
 	// TODO: max size on these? A malicious PDS could just send us a petabyte sized repo here and kill us
 	repo, err := atproto.SyncGetRepo(ctx, c, did, rev)
+	cl.observe(err, ratelimit)
 	if err != nil {
 		reposFetched.WithLabelValues("fail").Inc()
 		return nil, fmt.Errorf("failed to fetch repo (did=%s,rev=%s,host=%s): %w", did, rev, pds.Host, err)
@@ -15,6 +15,7 @@ import (
 	comatproto "github.com/bluesky-social/indigo/api/atproto"
 	appbsky "github.com/bluesky-social/indigo/api/bsky"
 	label "github.com/bluesky-social/indigo/api/label"
+	"github.com/bluesky-social/indigo/atproto/crypto"
 	"github.com/bluesky-social/indigo/bgs"
 	"github.com/bluesky-social/indigo/carstore"
 	"github.com/bluesky-social/indigo/events"
@@ -37,7 +38,7 @@ var log = logging.Logger("labelmaker")
 
 type Server struct {
 	db                  *gorm.DB
-	cs                  *carstore.CarStore
+	cs                  carstore.Store
 	repoman             *repomgr.RepoManager
 	bgsSlurper          *bgs.Slurper
 	evtmgr              *events.EventManager
@@ -58,11 +59,13 @@ type RepoConfig struct {
 	Password   string
 	SigningKey *did.PrivKey
 	UserId     models.Uid
+	// Signs the repo instead of SigningKey if set, eg for a key held in an HSM or KMS
+	Signer crypto.Signer
 }
 
 // In addition to configuring the service, will connect to upstream BGS and start processing events. Won't handle HTTP or WebSocket endpoints until RunAPI() is called.
 // 'useWss' is a flag to use SSL for outbound WebSocket connections
-func NewServer(db *gorm.DB, cs *carstore.CarStore, repoUser RepoConfig, plcURL, blobPdsURL, xrpcProxyURL, xrpcProxyAdminPassword string, useWss bool) (*Server, error) {
+func NewServer(db *gorm.DB, cs carstore.Store, repoUser RepoConfig, plcURL, blobPdsURL, xrpcProxyURL, xrpcProxyAdminPassword string, useWss bool) (*Server, error) {
 
 	db.AutoMigrate(models.PDS{})
 	db.AutoMigrate(models.Label{})
@@ -73,6 +76,9 @@ func NewServer(db *gorm.DB, cs *carstore.CarStore, repoUser RepoConfig, plcURL,
 
 	didr := &api.PLCServer{Host: plcURL}
 	kmgr := indexer.NewKeyManager(didr, repoUser.SigningKey)
+	if repoUser.Signer != nil {
+		kmgr.SetSigner(repoUser.Signer)
+	}
 	evtmgr := events.NewEventManager(events.NewMemPersister())
 	repoman := repomgr.NewRepoManager(cs, kmgr)
 
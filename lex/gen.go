@@ -11,7 +11,9 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
 	"golang.org/x/tools/imports"
@@ -49,6 +51,10 @@ type InputType struct {
 	Schema   *TypeSchema `json:"schema"`
 }
 
+type MessageType struct {
+	Schema *TypeSchema `json:"schema"`
+}
+
 type TypeSchema struct {
 	prefix    string
 	id        string
@@ -56,14 +62,19 @@ type TypeSchema struct {
 	defMap    map[string]*ExtDef
 	needsCbor bool
 	needsType bool
-
-	Type        string      `json:"type"`
-	Key         string      `json:"key"`
-	Description string      `json:"description"`
-	Parameters  *TypeSchema `json:"parameters"`
-	Input       *InputType  `json:"input"`
-	Output      *OutputType `json:"output"`
-	Record      *TypeSchema `json:"record"`
+	// whether to generate a _Params struct variant of RPC functions
+	paramsStruct bool
+	// whether to generate a Validate method
+	validate bool
+
+	Type        string       `json:"type"`
+	Key         string       `json:"key"`
+	Description string       `json:"description"`
+	Parameters  *TypeSchema  `json:"parameters"`
+	Input       *InputType   `json:"input"`
+	Output      *OutputType  `json:"output"`
+	Message     *MessageType `json:"message"`
+	Record      *TypeSchema  `json:"record"`
 
 	Ref        string                 `json:"ref"`
 	Refs       []string               `json:"refs"`
@@ -71,10 +82,15 @@ type TypeSchema struct {
 	Nullable   []string               `json:"nullable"`
 	Properties map[string]*TypeSchema `json:"properties"`
 	MaxLength  int                    `json:"maxLength"`
+	MinLength  int                    `json:"minLength"`
 	Items      *TypeSchema            `json:"items"`
 	Const      any                    `json:"const"`
 	Enum       []string               `json:"enum"`
-	Closed     bool                   `json:"closed"`
+	// not enforced by Validate, since they are open sets
+	KnownValues  []string `json:"knownValues"`
+	MaxGraphemes int      `json:"maxGraphemes"`
+	MinGraphemes int      `json:"minGraphemes"`
+	Closed       bool     `json:"closed"`
 
 	Default any `json:"default"`
 	Minimum any `json:"minimum"`
@@ -300,7 +316,21 @@ func printerf(w io.Writer) func(format string, args ...any) {
 	}
 }
 
+// Options for GenCodeForSchemaWithOptions.
+type GenOptions struct {
+	// Whether to generate functions for queries and procedures
+	ReqCode bool
+	// Whether to also generate a variant of those functions which takes the query parameters as a struct (with optional parameters as pointers, omitted when nil), in addition to the positional ones
+	ParamsStructs bool
+	// Whether to generate Validate methods on object and union types, which check the constraints of their lexicon
+	Validate bool
+}
+
 func GenCodeForSchema(pkg string, prefix string, fname string, reqcode bool, s *Schema, defmap map[string]*ExtDef, imports map[string]string) error {
+	return GenCodeForSchemaWithOptions(pkg, prefix, fname, s, defmap, imports, GenOptions{ReqCode: reqcode})
+}
+
+func GenCodeForSchemaWithOptions(pkg string, prefix string, fname string, s *Schema, defmap map[string]*ExtDef, imports map[string]string, opts GenOptions) error {
 	buf := new(bytes.Buffer)
 	pf := printerf(buf)
 
@@ -342,15 +372,17 @@ func GenCodeForSchema(pkg string, prefix string, fname string, reqcode bool, s *
 	})
 	for _, ot := range tps {
 		fmt.Println("TYPE: ", ot.Name, ot.NeedsCbor, ot.NeedsType)
+		ot.Type.validate = opts.Validate
 		if err := ot.Type.WriteType(ot.Name, buf); err != nil {
 			return err
 		}
 	}
 
-	if reqcode {
+	if opts.ReqCode {
 		name := nameFromID(s.ID, prefix)
 		main, ok := s.Defs["main"]
 		if ok {
+			main.paramsStruct = opts.ParamsStructs
 			if err := writeMethods(name, main, buf); err != nil {
 				return err
 			}
@@ -424,8 +456,7 @@ func writeMethods(typename string, ts *TypeSchema, w io.Writer) error {
 	case "object", "string":
 		return nil
 	case "subscription":
-		// TODO: should probably have some methods generated for this
-		return nil
+		return ts.WriteSubscription(w, typename)
 	default:
 		return fmt.Errorf("unrecognized lexicon type %q", ts.Type)
 	}
@@ -480,6 +511,9 @@ func (s *TypeSchema) WriteRPC(w io.Writer, typename string) error {
 		}
 	}
 
+	// the signature without the query parameters
+	baseParams := params
+
 	if s.Parameters != nil {
 		if err := orderedMapIter(s.Parameters.Properties, func(name string, t *TypeSchema) error {
 			tn, err := s.typeNameForField(name, "", *t)
@@ -487,7 +521,7 @@ func (s *TypeSchema) WriteRPC(w io.Writer, typename string) error {
 				return err
 			}
 
-			// TODO: deal with optional params
+			// NOTE: optional params are handled by the _Params struct variant, if generated
 			params = params + fmt.Sprintf(", %s %s", name, tn)
 			return nil
 		}); err != nil {
@@ -527,12 +561,14 @@ func (s *TypeSchema) WriteRPC(w io.Writer, typename string) error {
 	pf("func %s(%s) %s {\n", fname, params, out)
 
 	outvar := "nil"
+	outDecl := ""
 	errRet := "err"
 	outRet := "nil"
 	if s.Output != nil {
 		switch s.Output.Encoding {
 		case EncodingCBOR, EncodingCAR, EncodingANY:
-			pf("buf := new(bytes.Buffer)\n")
+			outDecl = "buf := new(bytes.Buffer)\n"
+			pf(outDecl)
 			outvar = "buf"
 			errRet = "nil, err"
 			outRet = "buf.Bytes(), nil"
@@ -541,7 +577,8 @@ func (s *TypeSchema) WriteRPC(w io.Writer, typename string) error {
 			if s.Output.Schema.Type == "ref" {
 				_, outname = s.namesFromRef(s.Output.Schema.Ref)
 			}
-			pf("\tvar out %s\n", outname)
+			outDecl = fmt.Sprintf("\tvar out %s\n", outname)
+			pf(outDecl)
 			outvar = "&out"
 			errRet = "nil, err"
 			outRet = "&out, nil"
@@ -551,11 +588,12 @@ func (s *TypeSchema) WriteRPC(w io.Writer, typename string) error {
 	}
 
 	queryparams := "nil"
-	if s.Parameters != nil {
+	writeParams := func(lead string) error {
+		if s.Parameters == nil {
+			return nil
+		}
 		queryparams = "params"
-		pf(`
-	params := map[string]interface{}{
-`)
+		pf(lead + "\tparams := map[string]interface{}{\n")
 		if err := orderedMapIter(s.Parameters.Properties, func(name string, t *TypeSchema) error {
 			pf(`"%s": %s,
 `, name, name)
@@ -564,6 +602,10 @@ func (s *TypeSchema) WriteRPC(w io.Writer, typename string) error {
 			return err
 		}
 		pf("}\n")
+		return nil
+	}
+	if err := writeParams("\n"); err != nil {
+		return err
 	}
 
 	var reqtype string
@@ -582,6 +624,227 @@ func (s *TypeSchema) WriteRPC(w io.Writer, typename string) error {
 	pf("\treturn %s\n", outRet)
 	pf("}\n\n")
 
+	// binary outputs (like repo CAR files) can also be streamed
+	if s.Output != nil && s.Output.Encoding != EncodingJSON {
+		pf("// %sStream calls the XRPC method %q, returning the response body (which the caller must close) without buffering it in memory.\n", fname, s.id)
+		pf("func %sStream(%s) (io.ReadCloser, error) {\n", fname, params)
+		if err := writeParams(""); err != nil {
+			return err
+		}
+		pf("\treturn c.DoStream(ctx, %s, %q, \"%s\", %s, %s)\n", reqtype, inpenc, s.id, queryparams, inpvar)
+		pf("}\n\n")
+	}
+
+	if err := s.writePaginated(w, fname); err != nil {
+		return err
+	}
+
+	if s.paramsStruct && s.Parameters != nil && len(s.Parameters.Properties) > 0 {
+		if err := s.writeParamsStruct(w, fname); err != nil {
+			return err
+		}
+		pf("// %sWithParams calls the XRPC method %q, with the query parameters in a struct. Unset optional parameters are omitted.\n", fname, s.id)
+		pf("func %sWithParams(%s, p *%s_Params) %s {\n", fname, baseParams, fname, out)
+		pf(outDecl)
+		pf("\n")
+		if err := s.writeParamsFromStruct(w); err != nil {
+			return err
+		}
+		pf("\tif err := c.Do(ctx, %s, %q, \"%s\", params, %s, %s); err != nil {\n", reqtype, inpenc, s.id, inpvar, outvar)
+		pf("\t\treturn %s\n", errRet)
+		pf("\t}\n\n")
+		pf("\treturn %s\n", outRet)
+		pf("}\n\n")
+	}
+
+	return nil
+}
+
+// Writes an All variant of a cursor-paginated query: one with a "cursor" parameter, and an output object with a "cursor" and a single array, whose items the variant iterates over with xrpc.Paginate.
+func (s *TypeSchema) writePaginated(w io.Writer, fname string) error {
+	if s.Type != "query" || s.Parameters == nil || s.Output == nil || s.Output.Encoding != EncodingJSON || s.Output.Schema.Type != "object" {
+		return nil
+	}
+	if p, ok := s.Parameters.Properties["cursor"]; !ok || p.Type != "string" {
+		return nil
+	}
+	out := s.Output.Schema
+	if p, ok := out.Properties["cursor"]; !ok || p.Type != "string" {
+		return nil
+	}
+	var field string
+	for k, p := range out.Properties {
+		if p.Type == "array" {
+			if field != "" {
+				// which items to iterate over is ambiguous
+				return nil
+			}
+			field = k
+		}
+	}
+	if field == "" {
+		return nil
+	}
+	tn, err := s.typeNameForField(fname+"_Output", field, *out.Properties[field])
+	if err != nil {
+		return err
+	}
+	itemType := strings.TrimPrefix(tn, "[]")
+
+	params := "ctx context.Context, c *xrpc.Client"
+	var args []string
+	if err := orderedMapIter(s.Parameters.Properties, func(name string, t *TypeSchema) error {
+		args = append(args, name)
+		if name == "cursor" {
+			return nil
+		}
+		tn, err := s.typeNameForField(name, "", *t)
+		if err != nil {
+			return err
+		}
+		params += fmt.Sprintf(", %s %s", name, tn)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	pf := printerf(w)
+	pf("// %sAll calls %s for each page of results, following the cursor, and returns an iterator (with the signature of an iter.Seq2) over the items of their %q, paced according to rate limits; see xrpc.Paginate.\n", fname, fname, field)
+	pf("func %sAll(%s) func(yield func(%s, error) bool) {\n", fname, params, itemType)
+	pf("\treturn xrpc.Paginate(ctx, c, func(ctx context.Context, cursor string) ([]%s, string, error) {\n", itemType)
+	pf("\t\tout, err := %s(ctx, c, %s)\n", fname, strings.Join(args, ", "))
+	pf("\t\tif err != nil {\n\t\t\treturn nil, \"\", err\n\t\t}\n")
+	if slices.Contains(out.Required, "cursor") {
+		pf("\t\treturn out.%s, out.Cursor, nil\n", strings.Title(field))
+	} else {
+		pf("\t\tvar next string\n\t\tif out.Cursor != nil {\n\t\t\tnext = *out.Cursor\n\t\t}\n")
+		pf("\t\treturn out.%s, next, nil\n", strings.Title(field))
+	}
+	pf("\t})\n")
+	pf("}\n\n")
+	return nil
+}
+
+// Whether a query parameter is required (and so not optional in the _Params struct).
+func (s *TypeSchema) paramRequired(name string) bool {
+	return slices.Contains(s.Parameters.Required, name)
+}
+
+// Writes the _Params struct for the query parameters of a method: required parameters are values, and optional ones are pointers (or slices), nil if unset.
+func (s *TypeSchema) writeParamsStruct(w io.Writer, fname string) error {
+	pf := printerf(w)
+	pf("// %s_Params are the query parameters of a %s call.\n", fname, s.id)
+	pf("type %s_Params struct {\n", fname)
+	if err := orderedMapIter(s.Parameters.Properties, func(name string, t *TypeSchema) error {
+		tn, err := s.typeNameForField(name, "", *t)
+		if err != nil {
+			return err
+		}
+		if !s.paramRequired(name) && t.Type != "array" {
+			tn = "*" + tn
+		}
+		if t.Description != "" {
+			pf("// %s\n", t.Description)
+		}
+		pf("%s %s\n", strings.Title(name), tn)
+		return nil
+	}); err != nil {
+		return err
+	}
+	pf("}\n\n")
+	return nil
+}
+
+// Writes the params map of a method call, from the _Params struct p, omitting unset optional parameters.
+func (s *TypeSchema) writeParamsFromStruct(w io.Writer) error {
+	pf := printerf(w)
+	pf("\tparams := map[string]interface{}{}\n")
+	return orderedMapIter(s.Parameters.Properties, func(name string, t *TypeSchema) error {
+		field := strings.Title(name)
+		switch {
+		case s.paramRequired(name):
+			pf("params[%q] = p.%s\n", name, field)
+		case t.Type == "array":
+			pf("if p.%s != nil {\nparams[%q] = p.%s\n}\n", field, name, field)
+		default:
+			pf("if p.%s != nil {\nparams[%q] = *p.%s\n}\n", field, name, field)
+		}
+		return nil
+	})
+}
+
+// WriteSubscription writes a function to subscribe to the event stream of a subscription method, decoding its messages (the refs of the message union) and dispatching them to the callbacks in a _Callbacks struct. Parameters are always passed in a _Params struct, since the zero value of some (like a cursor) is meaningful.
+func (s *TypeSchema) WriteSubscription(w io.Writer, typename string) error {
+	pf := printerf(w)
+	fname := typename
+
+	type message struct {
+		msgType  string
+		field    string
+		typeName string
+	}
+	var msgs []message
+	if s.Message != nil && s.Message.Schema != nil {
+		if s.Message.Schema.Type != "union" {
+			return fmt.Errorf("unsupported subscription message schema type: %q", s.Message.Schema.Type)
+		}
+		for _, ref := range s.Message.Schema.Refs {
+			_, tname := s.namesFromRef(ref)
+			// the callback is named after the def, or the last segment of the NSID for main defs
+			name := strings.TrimSuffix(ref, "#main")
+			if i := strings.LastIndex(name, "#"); i >= 0 {
+				name = name[i+1:]
+			} else {
+				name = name[strings.LastIndex(name, ".")+1:]
+			}
+			// message types of main defs are their NSID, as with $type
+			msgs = append(msgs, message{msgType: strings.TrimSuffix(ref, "#main"), field: strings.Title(name), typeName: tname})
+		}
+	}
+
+	params := "ctx context.Context, c *xrpc.Client"
+	hasParams := s.Parameters != nil && len(s.Parameters.Properties) > 0
+	if hasParams {
+		if err := s.writeParamsStruct(w, fname); err != nil {
+			return err
+		}
+		params += fmt.Sprintf(", p *%s_Params", fname)
+	}
+
+	pf("// %s_Callbacks are called by %s for the messages of the %q event stream; messages without a callback are skipped.\n", fname, fname, s.id)
+	pf("type %s_Callbacks struct {\n", fname)
+	for _, m := range msgs {
+		pf("%s func(evt *%s) error\n", m.field, m.typeName)
+	}
+	pf("}\n\n")
+
+	pf("// %s subscribes to the event stream of %q, calling the callbacks for each message until the context is done, the stream ends, or a callback returns an error.", fname, s.id)
+	if hasParams {
+		pf(" Unset optional parameters are omitted.")
+	}
+	pf("\n")
+	pf("func %s(%s, cb *%s_Callbacks) error {\n", fname, params, fname)
+	queryparams := "nil"
+	if hasParams {
+		queryparams = "params"
+		if err := s.writeParamsFromStruct(w); err != nil {
+			return err
+		}
+	}
+	pf("\treturn c.Subscribe(ctx, %q, %s, func(msgType string, r io.Reader) error {\n", s.id, queryparams)
+	pf("\t\tswitch msgType {\n")
+	for _, m := range msgs {
+		pf("\t\tcase %q:\n", m.msgType)
+		pf("\t\t\tif cb.%s == nil {\n\t\t\t\treturn nil\n\t\t\t}\n", m.field)
+		pf("\t\t\tvar evt %s\n", m.typeName)
+		pf("\t\t\tif err := evt.UnmarshalCBOR(r); err != nil {\n")
+		pf("\t\t\t\treturn fmt.Errorf(\"decoding %%q message: %%w\", msgType, err)\n")
+		pf("\t\t\t}\n")
+		pf("\t\t\treturn cb.%s(&evt)\n", m.field)
+	}
+	pf("\t\tdefault:\n\t\t\treturn nil\n\t\t}\n")
+	pf("\t})\n")
+	pf("}\n\n")
 	return nil
 }
 
@@ -625,6 +888,99 @@ func CreateHandlerStub(pkg string, impmap map[string]string, dir string, schemas
 	return nil
 }
 
+// CreateHandlerInterfaces writes server code for the queries and procedures of the schemas, to implement them against generated interfaces (instead of methods of a Server type, like CreateHandlerStub): an interface for each method, and a RegisterHandlers function which routes requests to the methods an implementation has.
+func CreateHandlerInterfaces(pkg string, impmap map[string]string, dir string, schemas []*Schema) error {
+	buf := new(bytes.Buffer)
+
+	if err := WriteHandlerInterfaces(buf, schemas, pkg, impmap); err != nil {
+		return err
+	}
+
+	fname := filepath.Join(dir, "xrpc_handlers.go")
+	return writeCodeFile(buf.Bytes(), fname)
+}
+
+func WriteHandlerInterfaces(w io.Writer, schemas []*Schema, pkg string, impmap map[string]string) error {
+	pf := printerf(w)
+	pf("// Code generated by cmd/lexgen (see Makefile's lexgen); DO NOT EDIT.\n\n")
+	pf("package %s\n\n", pkg)
+	pf("import (\n")
+	pf("\t\"context\"\n")
+	pf("\t\"github.com/labstack/echo/v4\"\n")
+	orderedMapIter[string](impmap, func(k, v string) error {
+		pf("\t%s\"%s\"\n", importNameForPrefix(k), v)
+		return nil
+	})
+	pf(")\n\n")
+
+	type method struct {
+		id, fname, verb string
+	}
+	var methods []method
+	for _, s := range schemas {
+		var prefix string
+		for k := range impmap {
+			if strings.HasPrefix(s.ID, k) {
+				prefix = k
+				break
+			}
+		}
+		if prefix == "" {
+			return fmt.Errorf("no matching prefix for schema %q", s.ID)
+		}
+
+		main, ok := s.Defs["main"]
+		if !ok {
+			continue
+		}
+		var verb string
+		switch main.Type {
+		case "query":
+			verb = "GET"
+		case "procedure":
+			verb = "POST"
+		default:
+			continue
+		}
+
+		fname := idToTitle(s.ID)
+		tname := nameFromID(s.ID, prefix)
+		impname := importNameForPrefix(prefix)
+
+		body := new(bytes.Buffer)
+		paramtypes, returndef, err := main.writeRPCHandlerBody(body, fname, tname, impname, "h."+fname, false)
+		if err != nil {
+			return fmt.Errorf("writing handler for %s: %w", s.ID, err)
+		}
+
+		pf("// %sHandler implements the %s %s.\n", fname, s.ID, main.Type)
+		pf("type %sHandler interface {\n", fname)
+		pf("%s(%s) %s\n", fname, strings.Join(paramtypes, ", "), returndef)
+		pf("}\n\n")
+		pf("func handle%s(h %sHandler) echo.HandlerFunc {\n", fname, fname)
+		pf("return func(c echo.Context) error {\n")
+		if _, err := body.WriteTo(w); err != nil {
+			return err
+		}
+		pf("}\n}\n\n")
+
+		methods = append(methods, method{id: s.ID, fname: fname, verb: verb})
+	}
+
+	pf("// RegisterHandlers adds a route for each of the methods which impl implements (with the method's Handler interface), and returns their NSIDs. An *echo.Echo is an http.Handler, so it can also be served with net/http.\n")
+	pf("func RegisterHandlers(e *echo.Echo, impl any) []string {\n")
+	pf("var nsids []string\n")
+	for _, m := range methods {
+		pf("if h, ok := impl.(%sHandler); ok {\n", m.fname)
+		pf("e.%s(\"/xrpc/%s\", handle%s(h))\n", m.verb, m.id, m.fname)
+		pf("nsids = append(nsids, %q)\n", m.id)
+		pf("}\n")
+	}
+	pf("return nsids\n}\n")
+
+	return nil
+}
+
 func importNameForPrefix(prefix string) string {
 	return strings.Join(strings.Split(prefix, "."), "") + "types"
 }
@@ -837,9 +1193,18 @@ func (s *TypeSchema) WriteHandlerStub(w io.Writer, fname, shortname, impname str
 
 func (s *TypeSchema) WriteRPCHandler(w io.Writer, fname, shortname, impname string) error {
 	pf := printerf(w)
-	tname := shortname
-
 	pf("func (s *Server) Handle%s(c echo.Context) error {\n", fname)
+	if _, _, err := s.writeRPCHandlerBody(w, fname, shortname, impname, "s.handle"+fname, true); err != nil {
+		return err
+	}
+	pf("}\n\n")
+	return nil
+}
+
+// Writes the body of an echo handler: parses the parameters or input, calls the given function with them, and writes its output. Returns the parameter list and return type of the called function.
+func (s *TypeSchema) writeRPCHandlerBody(w io.Writer, fname, shortname, impname, callee string, sigComment bool) ([]string, string, error) {
+	pf := printerf(w)
+	tname := shortname
 
 	pf("ctx, span := otel.Tracer(\"server\").Start(c.Request().Context(), %q)\n", "Handle"+fname)
 	pf("defer span.End()\n")
@@ -960,7 +1325,7 @@ if err != nil {
 				}
 				return nil
 			}); err != nil {
-				return err
+				return nil, "", err
 			}
 		}
 	} else if s.Type == "procedure" {
@@ -987,11 +1352,11 @@ if err := c.Bind(&body); err != nil {
 				params = append(params, "body", "contentType")
 
 			default:
-				return fmt.Errorf("unrecognized input encoding: %q", s.Input.Encoding)
+				return nil, "", fmt.Errorf("unrecognized input encoding: %q", s.Input.Encoding)
 			}
 		}
 	} else {
-		return fmt.Errorf("can only generate handlers for queries or procedures")
+		return nil, "", fmt.Errorf("can only generate handlers for queries or procedures")
 	}
 
 	assign := "handleErr"
@@ -1011,32 +1376,34 @@ if err := c.Bind(&body); err != nil {
 			pf("var out io.Reader\n")
 			returndef = "(io.Reader, error)"
 		default:
-			return fmt.Errorf("unrecognized output encoding (RPC output handler): %q", s.Output.Encoding)
+			return nil, "", fmt.Errorf("unrecognized output encoding (RPC output handler): %q", s.Output.Encoding)
 		}
 	}
 	pf("var handleErr error\n")
-	pf("// func (s *Server) handle%s(%s) %s\n", fname, strings.Join(paramtypes, ","), returndef)
-	pf("%s = s.handle%s(%s)\n", assign, fname, strings.Join(params, ","))
+	if sigComment {
+		pf("// func (s *Server) handle%s(%s) %s\n", fname, strings.Join(paramtypes, ","), returndef)
+	}
+	pf("%s = %s(%s)\n", assign, callee, strings.Join(params, ","))
 	pf("if handleErr != nil {\nreturn handleErr\n}\n")
 
 	if s.Output != nil {
 		switch s.Output.Encoding {
 		case EncodingJSON:
-			pf("return c.JSON(200, out)\n}\n\n")
+			pf("return c.JSON(200, out)\n")
 		case EncodingANY:
-			pf("return c.Stream(200, \"application/octet-stream\", out)\n}\n\n")
+			pf("return c.Stream(200, \"application/octet-stream\", out)\n")
 		case EncodingCBOR:
-			pf("return c.Stream(200, \"application/octet-stream\", out)\n}\n\n")
+			pf("return c.Stream(200, \"application/octet-stream\", out)\n")
 		case EncodingCAR:
-			pf("return c.Stream(200, \"application/vnd.ipld.car\", out)\n}\n\n")
+			pf("return c.Stream(200, \"application/vnd.ipld.car\", out)\n")
 		default:
-			return fmt.Errorf("unrecognized output encoding (RPC output handler return): %q", s.Output.Encoding)
+			return nil, "", fmt.Errorf("unrecognized output encoding (RPC output handler return): %q", s.Output.Encoding)
 		}
 	} else {
-		pf("return nil\n}\n\n")
+		pf("return nil\n")
 	}
 
-	return nil
+	return paramtypes, returndef, nil
 }
 
 func (s *TypeSchema) namesFromRef(r string) (string, string) {
@@ -1170,9 +1537,124 @@ func (ts *TypeSchema) WriteType(name string, w io.Writer) error {
 		return err
 	}
 
+	if ts.validate {
+		if err := ts.writeValidate(name, w); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
+// Writes a Validate method for object and union types, checking the constraints of each field (recursively, for nested types which are Validators).
+func (ts *TypeSchema) writeValidate(name string, w io.Writer) error {
+	pf := printerf(w)
+	switch ts.Type {
+	case "object":
+	case "union":
+		if len(ts.Refs) == 0 {
+			return nil
+		}
+		reft, err := ts.lookupRef(ts.Refs[0])
+		if err != nil {
+			return err
+		}
+		if reft.Type == "string" {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	pf("// Validate checks the constraints of the %s schema, returning a *util.ValidationError for the first field which doesn't satisfy them.\n", ts.id)
+	pf("func (t *%s) Validate() error {\n", name)
+	pf("\tif t == nil {\n\t\treturn nil\n\t}\n")
+
+	if ts.Type == "union" {
+		for _, r := range ts.Refs {
+			vname, _ := ts.namesFromRef(r)
+			pf("\tif err := util.ValidateNested(\"\", t.%s); err != nil {\n\t\treturn err\n\t}\n", vname)
+		}
+		pf("\treturn nil\n}\n\n")
+		return nil
+	}
+
+	if err := orderedMapIter(ts.Properties, func(k string, v *TypeSchema) error {
+		goname := strings.Title(k)
+		tname, err := ts.typeNameForField(name, k, *v)
+		if err != nil {
+			return err
+		}
+		required := slices.Contains(ts.Required, k) && !slices.Contains(ts.Nullable, k)
+
+		switch {
+		case strings.HasPrefix(tname, "*") || tname == "interface{}":
+			// pointers to other types are nil when unset, whether optional or not
+			if required {
+				pf("\tif err := util.ValidateRequired(%q, t.%s != nil); err != nil {\n\t\treturn err\n\t}\n", k, goname)
+			}
+			pf("%s", ts.validateChecks(strconv.Quote(k), "t."+goname, v))
+		case strings.HasPrefix(tname, "[]") || required:
+			pf("%s", ts.validateChecks(strconv.Quote(k), "t."+goname, v))
+		default:
+			// optional values are pointers
+			if checks := ts.validateChecks(strconv.Quote(k), "*t."+goname, v); checks != "" {
+				pf("\tif t.%s != nil {\n%s\t}\n", goname, checks)
+			}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	pf("\treturn nil\n}\n\n")
+	return nil
+}
+
+// Returns the code checking the constraints of the value expr, of a field with the given schema and path (as a Go expression), if any.
+func (ts *TypeSchema) validateChecks(field, expr string, v *TypeSchema) string {
+	var b strings.Builder
+	check := func(format string, args ...any) {
+		fmt.Fprintf(&b, "\tif err := "+format+"; err != nil {\n\t\treturn err\n\t}\n", args...)
+	}
+	switch v.Type {
+	case "string":
+		if v.MinLength > 0 || v.MaxLength > 0 || v.MinGraphemes > 0 || v.MaxGraphemes > 0 {
+			check("util.ValidateString(%s, %s, %d, %d, %d, %d)", field, expr, v.MinLength, v.MaxLength, v.MinGraphemes, v.MaxGraphemes)
+		}
+		if len(v.Enum) > 0 {
+			var vals []string
+			for _, e := range v.Enum {
+				vals = append(vals, fmt.Sprintf("%q", e))
+			}
+			check("util.ValidateEnum(%s, %s, %s)", field, expr, strings.Join(vals, ", "))
+		}
+	case "integer":
+		minimum, hasMin := v.Minimum.(float64)
+		maximum, hasMax := v.Maximum.(float64)
+		if hasMin || hasMax {
+			check("util.ValidateRange(%s, %s, %d, %d, %t, %t)", field, expr, int64(minimum), int64(maximum), hasMin, hasMax)
+		}
+	case "array":
+		if v.MinLength > 0 || v.MaxLength > 0 {
+			check("util.ValidateLength(%s, len(%s), %d, %d)", field, expr, v.MinLength, v.MaxLength)
+		}
+		// nested arrays are not checked
+		if path, err := strconv.Unquote(field); err == nil && v.Items != nil && v.Items.Type != "array" {
+			if checks := ts.validateChecks(fmt.Sprintf("fmt.Sprintf(%q, i)", path+"[%d]"), "v", v.Items); checks != "" {
+				fmt.Fprintf(&b, "\tfor i, v := range %s {\n%s\t}\n", expr, checks)
+			}
+		}
+	case "ref":
+		if _, tn := ts.namesFromRef(v.Ref); tn == "string" || tn[0] == '[' {
+			return ""
+		}
+		check("util.ValidateNested(%s, %s)", field, expr)
+	case "object", "union", "unknown":
+		check("util.ValidateNested(%s, %s)", field, expr)
+	}
+	return b.String()
+}
+
 func (ts *TypeSchema) writeTypeDefinition(name string, w io.Writer) error {
 	pf := printerf(w)
 
@@ -0,0 +1,101 @@
+package lex
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of generated code in testdata/golden")
+
+const testTypesImport = "github.com/bluesky-social/indigo/lex/testdata/example"
+
+func readTestSchemas(t *testing.T) []*Schema {
+	t.Helper()
+	var schemas []*Schema
+	for _, name := range []string{"createThing.json", "getThings.json"} {
+		s, err := ReadSchema(filepath.Join("testdata", "lexicons", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		schemas = append(schemas, s)
+	}
+	return schemas
+}
+
+// Compares a generated file with testdata/golden/<name>.golden, or updates the latter with -update.
+func checkGolden(t *testing.T, dir, name string) {
+	t.Helper()
+	got, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := filepath.Join("testdata", "golden", name+".golden")
+	if *updateGolden {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(want), string(got), "%s differs from the golden file; re-run with -update if the change is expected", name)
+}
+
+func TestGenParamsStructs(t *testing.T) {
+	dir := t.TempDir()
+	schemas := readTestSchemas(t)
+	defmap := BuildExtDefMap(schemas, []string{"com.example"})
+	FixRecordReferences(schemas, defmap, "com.example")
+
+	imports := map[string]string{"com.example": testTypesImport}
+	for _, s := range schemas {
+		opts := GenOptions{ReqCode: true, ParamsStructs: true}
+		if err := GenCodeForSchemaWithOptions("example", "com.example", filepath.Join(dir, s.Name()+".go"), s, defmap, imports, opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkGolden(t, dir, "examplegetThings.go")
+	checkGolden(t, dir, "examplecreateThing.go")
+}
+
+func TestGenValidate(t *testing.T) {
+	dir := t.TempDir()
+	s, err := ReadSchema(filepath.Join("testdata", "lexicons", "thing.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	schemas := []*Schema{s}
+	defmap := BuildExtDefMap(schemas, []string{"com.example"})
+	FixRecordReferences(schemas, defmap, "com.example")
+
+	imports := map[string]string{"com.example": testTypesImport}
+	opts := GenOptions{Validate: true}
+	if err := GenCodeForSchemaWithOptions("example", "com.example", filepath.Join(dir, s.Name()+".go"), s, defmap, imports, opts); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, dir, "examplething.go")
+}
+
+func TestGenHandlerInterfaces(t *testing.T) {
+	dir := t.TempDir()
+	impmap := map[string]string{"com.example": testTypesImport}
+	if err := CreateHandlerInterfaces("example", impmap, dir, readTestSchemas(t)); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, dir, "xrpc_handlers.go")
+}
+
+func TestGenHandlerStub(t *testing.T) {
+	dir := t.TempDir()
+	impmap := map[string]string{"com.example": testTypesImport}
+	if err := CreateHandlerStub("example", impmap, dir, readTestSchemas(t), false); err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, dir, "stubs.go")
+}
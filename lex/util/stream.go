@@ -0,0 +1,20 @@
+package util
+
+// Operations of event stream (subscription) frames, in the "op" field of their header.
+const (
+	StreamOpMessage = 1
+	StreamOpError   = -1
+)
+
+// StreamFrameHeader is the header of an event stream (subscription) frame, which is followed by the frame's body in the same WebSocket message.
+type StreamFrameHeader struct {
+	Op int64 `cborgen:"op"`
+	// The message type of message frames, like "#commit"; empty for error frames
+	MsgType string `cborgen:"t,omitempty"`
+}
+
+// StreamErrorFrame is the body of an event stream error frame, after which the stream is closed.
+type StreamErrorFrame struct {
+	Error   string `cborgen:"error"`
+	Message string `cborgen:"message,omitempty"`
+}
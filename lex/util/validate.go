@@ -0,0 +1,108 @@
+package util
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/rivo/uniseg"
+)
+
+// ValidationError is returned by the generated Validate methods (see lexgen's --validate) for a value which doesn't satisfy the constraints of its lexicon.
+type ValidationError struct {
+	// The path of the invalid field, like "embed.images[0].alt"
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Field, e.Message)
+}
+
+// Validator is implemented by generated types which check the constraints of their lexicon.
+type Validator interface {
+	Validate() error
+}
+
+// ValidateNested validates v if it's a Validator (like a generated type), prefixing the path of a *ValidationError with field, if not empty.
+func ValidateNested(field string, v any) error {
+	vv, ok := v.(Validator)
+	if !ok {
+		return nil
+	}
+	err := vv.Validate()
+	var ve *ValidationError
+	if field == "" || !errors.As(err, &ve) {
+		return err
+	}
+	sep := "."
+	if strings.HasPrefix(ve.Field, "[") {
+		sep = ""
+	}
+	return &ValidationError{Field: field + sep + ve.Field, Message: ve.Message}
+}
+
+// Validate validates the decoded record, if its type is a Validator.
+func (ltd *LexiconTypeDecoder) Validate() error {
+	if ltd == nil {
+		return nil
+	}
+	return ValidateNested("", ltd.Val)
+}
+
+// ValidateString checks the length of a string in bytes (of UTF-8) and in graphemes; limits which are zero are not checked.
+func ValidateString(field, s string, minLength, maxLength, minGraphemes, maxGraphemes int) error {
+	if err := ValidateLength(field, len(s), minLength, maxLength); err != nil {
+		return err
+	}
+	if minGraphemes == 0 && maxGraphemes == 0 {
+		return nil
+	}
+	n := uniseg.GraphemeClusterCount(s)
+	switch {
+	case minGraphemes > 0 && n < minGraphemes:
+		return &ValidationError{Field: field, Message: fmt.Sprintf("must be at least %d graphemes (got %d)", minGraphemes, n)}
+	case maxGraphemes > 0 && n > maxGraphemes:
+		return &ValidationError{Field: field, Message: fmt.Sprintf("must be at most %d graphemes (got %d)", maxGraphemes, n)}
+	}
+	return nil
+}
+
+// ValidateLength checks the length of a string or array; limits which are zero are not checked.
+func ValidateLength(field string, n, minLength, maxLength int) error {
+	switch {
+	case minLength > 0 && n < minLength:
+		return &ValidationError{Field: field, Message: fmt.Sprintf("must have a length of at least %d (got %d)", minLength, n)}
+	case maxLength > 0 && n > maxLength:
+		return &ValidationError{Field: field, Message: fmt.Sprintf("must have a length of at most %d (got %d)", maxLength, n)}
+	}
+	return nil
+}
+
+// ValidateEnum checks that a string is one of the values of a closed enum.
+func ValidateEnum(field, s string, values ...string) error {
+	if !slices.Contains(values, s) {
+		return &ValidationError{Field: field, Message: fmt.Sprintf("must be one of %q (got %q)", values, s)}
+	}
+	return nil
+}
+
+// ValidateRange checks that an integer is within [min, max]; only the bounds set by hasMin and hasMax are checked.
+func ValidateRange(field string, n, min, max int64, hasMin, hasMax bool) error {
+	switch {
+	case hasMin && n < min:
+		return &ValidationError{Field: field, Message: fmt.Sprintf("must be at least %d (got %d)", min, n)}
+	case hasMax && n > max:
+		return &ValidationError{Field: field, Message: fmt.Sprintf("must be at most %d (got %d)", max, n)}
+	}
+	return nil
+}
+
+// ValidateRequired returns an error for a required field which is not set.
+func ValidateRequired(field string, set bool) error {
+	if !set {
+		return &ValidationError{Field: field, Message: "required field is missing"}
+	}
+	return nil
+}
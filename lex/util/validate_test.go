@@ -0,0 +1,44 @@
+package util
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type validated struct {
+	Text string
+}
+
+func (v *validated) MarshalCBOR(w io.Writer) error { return nil }
+
+func (v *validated) Validate() error {
+	return ValidateString("text", v.Text, 0, 10, 0, 3)
+}
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(ValidateString("s", "héllo", 1, 6, 0, 5))
+	assert.EqualError(ValidateString("s", "héllo", 0, 5, 0, 0), "invalid s: must have a length of at most 5 (got 6)")
+	// a single grapheme, of many bytes
+	assert.NoError(ValidateString("s", "👩‍👩‍👧", 0, 0, 1, 1))
+	assert.EqualError(ValidateString("s", "abcd", 0, 0, 0, 3), "invalid s: must be at most 3 graphemes (got 4)")
+	assert.EqualError(ValidateLength("a", 0, 1, 0), "invalid a: must have a length of at least 1 (got 0)")
+
+	assert.NoError(ValidateEnum("e", "b", "a", "b"))
+	assert.Error(ValidateEnum("e", "c", "a", "b"))
+
+	assert.NoError(ValidateRange("n", 0, 1, 0, false, false))
+	assert.NoError(ValidateRange("n", 100, 1, 0, true, false))
+	assert.EqualError(ValidateRange("n", 11, 1, 10, true, true), "invalid n: must be at most 10 (got 11)")
+
+	assert.EqualError(ValidateRequired("r", false), "invalid r: required field is missing")
+
+	// nested fields are prefixed with the path of their parent
+	assert.EqualError(ValidateNested("items[2]", &validated{Text: "abcd"}), "invalid items[2].text: must be at most 3 graphemes (got 4)")
+	assert.NoError(ValidateNested("x", "not a validator"))
+	ltd := &LexiconTypeDecoder{Val: &validated{Text: "abcd"}}
+	assert.EqualError(ValidateNested("record", ltd), "invalid record.text: must be at most 3 graphemes (got 4)")
+}
@@ -112,6 +112,10 @@ type PDS struct {
 	Blocked        bool
 	RateLimit      float64
 	CrawlRateLimit float64
+	// Paused hosts keep their repos, but aren't subscribed to until they're resumed
+	Paused bool
+	// Maximum number of repos accepted from the host; zero for no limit
+	RepoLimit int64
 }
 
 func ClientForPds(pds *PDS) *xrpc.Client {
@@ -145,3 +149,18 @@ type DomainBan struct {
 	gorm.Model
 	Domain string
 }
+
+// DidFilter is an entry of the DID filters of a relay: events about a blocked DID are dropped, and if the allowlist is enforced, only the events about allowed DIDs are accepted.
+type DidFilter struct {
+	gorm.Model
+	Did    string `gorm:"uniqueIndex"`
+	Allow  bool
+	Reason string
+}
+
+// HostFilter is an entry of the PDS host blocklist of a relay: events from the host (or its subdomains) are dropped.
+type HostFilter struct {
+	gorm.Model
+	Host   string `gorm:"uniqueIndex"`
+	Reason string
+}
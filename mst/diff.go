@@ -2,7 +2,7 @@ package mst
 
 import (
 	"context"
-	"fmt"
+	"sort"
 
 	"github.com/bluesky-social/indigo/util"
 	cid "github.com/ipfs/go-cid"
@@ -17,172 +17,234 @@ type DiffOp struct {
 	NewCid cid.Cid
 }
 
-// TODO: this code isn't great, should be rewritten on top of the baseline datastructures once functional and correct
+// DiffTrees returns the changes between the trees at from and to, sorted by key. Both trees are walked in key order, and subtrees with the same CID on both sides are skipped without being read, so the cost is proportional to the size of the changes rather than of the trees.
 func DiffTrees(ctx context.Context, bs blockstore.Blockstore, from, to cid.Cid) ([]*DiffOp, error) {
 	cst := util.CborStore(bs)
 
 	if from == cid.Undef {
 		return identityDiff(ctx, bs, to)
 	}
+	if from == to {
+		return nil, nil
+	}
 
-	ft := LoadMST(cst, from)
-	tt := LoadMST(cst, to)
-
-	fents, err := ft.getEntries(ctx)
+	fw, err := newDiffWalker(ctx, LoadMST(cst, from))
 	if err != nil {
 		return nil, err
 	}
-
-	tents, err := tt.getEntries(ctx)
+	tw, err := newDiffWalker(ctx, LoadMST(cst, to))
 	if err != nil {
 		return nil, err
 	}
 
-	var ixf, ixt int
-	var out []*DiffOp
-	for ixf < len(fents) && ixt < len(tents) {
-		ef := fents[ixf]
-		et := tents[ixt]
+	d := &diffState{
+		adds: make(map[string]cid.Cid),
+		dels: make(map[string]cid.Cid),
+		muts: make(map[string]*DiffOp),
+	}
 
-		if nodeEntriesEqual(&ef, &et) {
-			ixf++
-			ixt++
-			continue
-		}
+	for !fw.done() && !tw.done() {
+		ef, et := fw.curr(), tw.curr()
 
-		if ef.isLeaf() && et.isLeaf() {
-			if ef.Key == et.Key {
-				if ef.Val == et.Val {
-					return nil, fmt.Errorf("hang on, why are these leaves equal?")
+		switch {
+		case ef.isLeaf() && et.isLeaf():
+			switch {
+			case ef.Key == et.Key:
+				if ef.Val != et.Val {
+					d.del(ef.Key, ef.Val)
+					d.add(et.Key, et.Val)
 				}
+				fw.advance()
+				tw.advance()
+			case ef.Key < et.Key:
+				d.del(ef.Key, ef.Val)
+				fw.advance()
+			default:
+				d.add(et.Key, et.Val)
+				tw.advance()
+			}
 
-				out = append(out, &DiffOp{
-					Op:     "mut",
-					Rpath:  ef.Key,
-					OldCid: ef.Val,
-					NewCid: et.Val,
-				})
-				ixf++
-				ixt++
+		case ef.isTree() && et.isTree():
+			if ef.Tree.pointer.Defined() && ef.Tree.pointer == et.Tree.pointer {
+				// same subtree on both sides, whatever its position
+				fw.advance()
+				tw.advance()
 				continue
 			}
-			// different keys... what do?
-
-			// if the 'to' key is earlier than the 'from' key, call it an insert
-			// otherwise call it a deletion?
-
-			if ef.Key > et.Key {
-				out = append(out, &DiffOp{
-					Op:     "add",
-					Rpath:  et.Key,
-					NewCid: et.Val,
-				})
-				// only walk forward the pointer that was 'behind'
-				ixt++
-			} else {
-				out = append(out, &DiffOp{
-					Op:     "del",
-					Rpath:  ef.Key,
-					OldCid: ef.Val,
-				})
-				// only walk forward the pointer that was 'behind'
-				ixf++
+			// the subtree starting first may have keys the other side is yet to reach
+			flo, tlo := fw.lowerBound(), tw.lowerBound()
+			if flo <= tlo {
+				if err := fw.stepInto(ctx); err != nil {
+					return nil, err
+				}
+			}
+			if tlo <= flo {
+				if err := tw.stepInto(ctx); err != nil {
+					return nil, err
+				}
 			}
 
-			// call it an insertion?
-			continue
-		}
-
-		if ef.isTree() {
-			sub, err := ef.Tree.getEntries(ctx)
-			if err != nil {
+		case ef.isLeaf():
+			// the subtree only has keys after its lower bound, so the leaf comes first if it's not after it
+			if ef.Key <= tw.lowerBound() {
+				d.del(ef.Key, ef.Val)
+				fw.advance()
+			} else if err := tw.stepInto(ctx); err != nil {
 				return nil, err
 			}
 
-			fents = append(sub, fents[ixf+1:]...)
-			ixf = 0
-			continue
-		}
-
-		if et.isTree() {
-			sub, err := et.Tree.getEntries(ctx)
-			if err != nil {
+		default:
+			if et.Key <= fw.lowerBound() {
+				d.add(et.Key, et.Val)
+				tw.advance()
+			} else if err := fw.stepInto(ctx); err != nil {
 				return nil, err
 			}
-
-			tents = append(sub, tents[ixt+1:]...)
-			ixt = 0
-			continue
 		}
 	}
 
-	for ; ixf < len(fents); ixf++ {
+	for !fw.done() {
 		// deletions
-
-		e := fents[ixf]
+		e := fw.curr()
 		if e.isLeaf() {
-			out = append(out, &DiffOp{
-				Op:     "del",
-				Rpath:  e.Key,
-				OldCid: e.Val,
-			})
-
-		} else if e.isTree() {
-			if err := e.Tree.WalkLeavesFrom(ctx, "", func(key string, val cid.Cid) error {
-				out = append(out, &DiffOp{
-					Op:     "del",
-					Rpath:  key,
-					OldCid: val,
-				})
-				return nil
-			}); err != nil {
-				return nil, err
-			}
+			d.del(e.Key, e.Val)
+			fw.advance()
+		} else if err := fw.stepInto(ctx); err != nil {
+			return nil, err
 		}
 	}
 
-	for ; ixt < len(tents); ixt++ {
+	for !tw.done() {
 		// insertions
-
-		e := tents[ixt]
+		e := tw.curr()
 		if e.isLeaf() {
-			out = append(out, &DiffOp{
-				Op:     "add",
-				Rpath:  e.Key,
-				NewCid: e.Val,
-			})
-
-		} else if e.isTree() {
-			if err := e.Tree.WalkLeavesFrom(ctx, "", func(key string, val cid.Cid) error {
-				out = append(out, &DiffOp{
-					Op:     "add",
-					Rpath:  key,
-					NewCid: val,
-				})
-				return nil
-			}); err != nil {
-				return nil, err
-			}
+			d.add(e.Key, e.Val)
+			tw.advance()
+		} else if err := tw.stepInto(ctx); err != nil {
+			return nil, err
 		}
 	}
 
-	return out, nil
+	return d.ops(), nil
+}
+
+// Walks the entries of a tree in key order, stepping into subtrees only when asked to.
+type diffWalker struct {
+	stack []diffFrame
 }
 
-func nodeEntriesEqual(a, b *nodeEntry) bool {
-	if !(a.Key == b.Key && a.Val == b.Val) {
-		return false
+type diffFrame struct {
+	entries []nodeEntry
+	ix      int
+	// the last key before the current entry, in this node or its parents
+	prev string
+}
+
+func newDiffWalker(ctx context.Context, t *MerkleSearchTree) (*diffWalker, error) {
+	entries, err := t.getEntries(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	if a.Tree == nil && b.Tree == nil {
-		return true
+	w := &diffWalker{}
+	if len(entries) > 0 {
+		w.stack = append(w.stack, diffFrame{entries: entries})
 	}
+	return w, nil
+}
+
+func (w *diffWalker) done() bool {
+	return len(w.stack) == 0
+}
 
-	if a.Tree != nil && b.Tree != nil && a.Tree.pointer == b.Tree.pointer {
-		return true
+func (w *diffWalker) curr() nodeEntry {
+	f := &w.stack[len(w.stack)-1]
+	return f.entries[f.ix]
+}
+
+// Returns a key which all the keys of the current entry are after, or "" if there's none.
+func (w *diffWalker) lowerBound() string {
+	return w.stack[len(w.stack)-1].prev
+}
+
+// Moves past the current entry, skipping its subtree if it's a tree.
+func (w *diffWalker) advance() {
+	f := &w.stack[len(w.stack)-1]
+	if e := f.entries[f.ix]; e.isLeaf() {
+		f.prev = e.Key
+	}
+	f.ix++
+
+	for len(w.stack) > 0 {
+		f := &w.stack[len(w.stack)-1]
+		if f.ix < len(f.entries) {
+			return
+		}
+		w.stack = w.stack[:len(w.stack)-1]
+	}
+}
+
+// Moves to the first entry of the current subtree.
+func (w *diffWalker) stepInto(ctx context.Context) error {
+	e := w.curr()
+	prev := w.lowerBound()
+
+	entries, err := e.Tree.getEntries(ctx)
+	if err != nil {
+		return err
+	}
+
+	w.advance()
+	if len(entries) > 0 {
+		w.stack = append(w.stack, diffFrame{entries: entries, prev: prev})
 	}
+	return nil
+}
+
+// Collects the changes of a diff, matching up the deletions and insertions of the same key, which may be found in any order.
+type diffState struct {
+	adds map[string]cid.Cid
+	dels map[string]cid.Cid
+	muts map[string]*DiffOp
+}
+
+func (d *diffState) add(key string, val cid.Cid) {
+	if old, ok := d.dels[key]; ok {
+		delete(d.dels, key)
+		if old != val {
+			d.muts[key] = &DiffOp{Op: "mut", Rpath: key, OldCid: old, NewCid: val}
+		}
+		return
+	}
+	d.adds[key] = val
+}
 
-	return false
+func (d *diffState) del(key string, val cid.Cid) {
+	if nval, ok := d.adds[key]; ok {
+		delete(d.adds, key)
+		if nval != val {
+			d.muts[key] = &DiffOp{Op: "mut", Rpath: key, OldCid: val, NewCid: nval}
+		}
+		return
+	}
+	d.dels[key] = val
+}
+
+func (d *diffState) ops() []*DiffOp {
+	out := make([]*DiffOp, 0, len(d.adds)+len(d.dels)+len(d.muts))
+	for k, v := range d.adds {
+		out = append(out, &DiffOp{Op: "add", Rpath: k, NewCid: v})
+	}
+	for k, v := range d.dels {
+		out = append(out, &DiffOp{Op: "del", Rpath: k, OldCid: v})
+	}
+	for _, op := range d.muts {
+		out = append(out, op)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Rpath < out[j].Rpath
+	})
+	return out
 }
 
 func identityDiff(ctx context.Context, bs blockstore.Blockstore, root cid.Cid) ([]*DiffOp, error) {
@@ -46,6 +46,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/ipfs/go-cid"
 	cbor "github.com/ipfs/go-ipld-cbor"
@@ -970,6 +971,63 @@ func (mst *MerkleSearchTree) WalkLeavesFrom(ctx context.Context, from string, cb
 	return nil
 }
 
+// WalkPrefix walks the part of the tree covering the keys with a prefix: the
+// nodeCb callback is called on each of its nodes, which together prove which
+// keys have the prefix, and the leafCb callback on each of these keys, in
+// order. An empty prefix walks the whole tree.
+func (mst *MerkleSearchTree) WalkPrefix(ctx context.Context, prefix string, nodeCb func(node cid.Cid) error, leafCb func(key string, val cid.Cid) error) error {
+	// the keys with the prefix are the ones in [prefix, end)
+	var end string
+	if prefix != "" {
+		end = prefix[:len(prefix)-1] + string(prefix[len(prefix)-1]+1)
+	}
+	return mst.walkRange(ctx, prefix, end, nodeCb, func(key string, val cid.Cid) error {
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+		return leafCb(key, val)
+	})
+}
+
+// Walks the nodes with keys in [start, end), and the leaves next to them; an empty end is unbounded.
+func (mst *MerkleSearchTree) walkRange(ctx context.Context, start, end string, nodeCb func(node cid.Cid) error, leafCb func(key string, val cid.Cid) error) error {
+	ptr, err := mst.GetPointer(ctx)
+	if err != nil {
+		return err
+	}
+	if err := nodeCb(ptr); err != nil {
+		return err
+	}
+
+	entries, err := mst.getEntries(ctx)
+	if err != nil {
+		return fmt.Errorf("get entries: %w", err)
+	}
+
+	for i, e := range entries {
+		if e.isLeaf() {
+			if e.Key >= start && (end == "" || e.Key < end) {
+				if err := leafCb(e.Key, e.Val); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		// the keys of a subtree are between the leaves around it
+		if i > 0 && end != "" && entries[i-1].Key >= end {
+			continue
+		}
+		if i < len(entries)-1 && entries[i+1].Key <= start {
+			continue
+		}
+		if err := e.Tree.walkRange(ctx, start, end, nodeCb, leafCb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // TODO: Typescript: MST.list(count?, after?, before?) -> Leaf[]
 // TODO: Typescript: MST.listWithPrefix(prefix, count?) -> Leaf[]
 
@@ -12,6 +12,7 @@ import (
 	"testing"
 
 	"github.com/bluesky-social/indigo/util"
+	blockformat "github.com/ipfs/go-block-format"
 	cid "github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
@@ -285,6 +286,76 @@ func TestDiffMutationsBasic(t *testing.T) {
 	testMapDiffs(t, a, b)
 }
 
+func TestDiffMixedChanges(t *testing.T) {
+	for seed := int64(0); seed < 10; seed++ {
+		r := rand.New(rand.NewSource(seed))
+
+		a := map[string]string{}
+		for i := int64(0); i < 1000; i++ {
+			a[randKey(seed*10000+i)] = randStr(r.Int63())
+		}
+
+		b := maps.Clone(a)
+		for k := range b {
+			switch r.Intn(20) {
+			case 0:
+				delete(b, k)
+			case 1:
+				b[k] = randStr(r.Int63())
+			}
+		}
+		for i := 0; i < 50; i++ {
+			b[randKey(r.Int63())] = randStr(r.Int63())
+		}
+
+		testMapDiffs(t, a, b)
+		testMapDiffs(t, b, a)
+	}
+}
+
+type countingBlockstore struct {
+	blockstore.Blockstore
+	gets int
+}
+
+func (bs *countingBlockstore) Get(ctx context.Context, c cid.Cid) (blockformat.Block, error) {
+	bs.gets++
+	return bs.Blockstore.Get(ctx, c)
+}
+
+func TestDiffReadsOnlyChangedNodes(t *testing.T) {
+	a := map[string]cid.Cid{}
+	for i := int64(0); i < 5000; i++ {
+		a[randKey(i)] = randCid()
+	}
+	b := maps.Clone(a)
+	added := randKey(99999)
+	b[added] = randCid()
+
+	bs := &countingBlockstore{Blockstore: memBs()}
+	cida := mustCidTree(t, cidMapToMst(t, bs, a))
+	cidb := mustCidTree(t, cidMapToMst(t, bs, b))
+
+	report, err := VerifyTree(context.TODO(), bs, cida, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs.gets = 0
+	diffs, err := DiffTrees(context.TODO(), bs, cida, cidb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 || diffs[0].Op != "add" || diffs[0].Rpath != added {
+		t.Fatalf("unexpected diff: %v", diffs)
+	}
+
+	// a path down each tree, give or take the neighbors of the new key
+	if limit := 4 * (report.Layer + 1); bs.gets > limit {
+		t.Fatalf("read %d nodes of trees of %d, expected at most %d", bs.gets, report.Nodes, limit)
+	}
+}
+
 func diffMaps(a, b map[string]cid.Cid) []*DiffOp {
 	var akeys, bkeys []string
 
@@ -633,3 +704,160 @@ func BenchmarkCountPrefixLen(b *testing.B) {
 		}
 	}
 }
+
+func TestVerifyTree(t *testing.T) {
+	ctx := context.TODO()
+	bs := memBs()
+
+	m := make(map[string]cid.Cid)
+	for i := int64(0); i < 1000; i++ {
+		m[randKey(i)] = randCid()
+	}
+	root := mustCidTree(t, cidMapToMst(t, bs, m))
+
+	report, err := VerifyTree(ctx, bs, root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() {
+		t.Fatalf("unexpected problems: %v", report.Problems)
+	}
+	if report.Leaves != len(m) {
+		t.Fatalf("expected %d leaves, got %d", len(m), report.Leaves)
+	}
+	if report.Layer < 1 {
+		t.Fatalf("expected a tree several layers deep, root is on layer %d", report.Layer)
+	}
+
+	empty := mustCidTree(t, NewEmptyMST(util.CborStore(bs)))
+	report, err = VerifyTree(ctx, bs, empty, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Layer != -1 {
+		t.Fatalf("unexpected report for empty tree: %+v", report)
+	}
+}
+
+func hasProblem(report *VerifyReport, kind ProblemKind) bool {
+	for _, p := range report.Problems {
+		if p.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRebuildTreeMissingNode(t *testing.T) {
+	ctx := context.TODO()
+	bs := memBs()
+
+	m := make(map[string]cid.Cid)
+	for i := int64(0); i < 1000; i++ {
+		m[randKey(i)] = randCid()
+	}
+	root := mustCidTree(t, cidMapToMst(t, bs, m))
+
+	var nd nodeData
+	if err := util.CborStore(bs).Get(ctx, root, &nd); err != nil {
+		t.Fatal(err)
+	}
+	var sub *cid.Cid
+	for _, e := range nd.Entries {
+		if e.Tree != nil {
+			sub = e.Tree
+			break
+		}
+	}
+	if sub == nil {
+		t.Fatal("root has no subtrees")
+	}
+	if err := bs.DeleteBlock(ctx, *sub); err != nil {
+		t.Fatal(err)
+	}
+
+	tree, report, err := RebuildTree(ctx, bs, root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasProblem(report, ProblemMissingBlock) {
+		t.Fatalf("expected a missing block, got %v", report.Problems)
+	}
+
+	nroot := mustCidTree(t, tree)
+	nreport, err := VerifyTree(ctx, bs, nroot, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nreport.OK() {
+		t.Fatalf("unexpected problems in rebuilt tree: %v", nreport.Problems)
+	}
+	if nreport.Leaves != report.Leaves || nreport.Leaves == 0 || nreport.Leaves >= len(m) {
+		t.Fatalf("expected the %d reachable leaves in rebuilt tree, got %d", report.Leaves, nreport.Leaves)
+	}
+
+	if err := tree.WalkLeavesFrom(ctx, "", func(key string, val cid.Cid) error {
+		if m[key] != val {
+			return fmt.Errorf("unexpected leaf %q: %s", key, val)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyTreeBadNodes(t *testing.T) {
+	ctx := context.TODO()
+	bs := memBs()
+	cst := util.CborStore(bs)
+
+	// keys out of order
+	unsorted := &nodeData{
+		Entries: []treeEntry{
+			{KeySuffix: []byte("com.example.record/bbb"), Val: randCid()},
+			{PrefixLen: 19, KeySuffix: []byte("aaa"), Val: randCid()},
+		},
+	}
+	root, err := cst.Put(ctx, unsorted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tree, report, err := RebuildTree(ctx, bs, root, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasProblem(report, ProblemKeyOrder) {
+		t.Fatalf("expected a key order problem, got %v", report.Problems)
+	}
+
+	nreport, err := VerifyTree(ctx, bs, mustCidTree(t, tree), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !nreport.OK() || nreport.Leaves != 2 {
+		t.Fatalf("unexpected report for rebuilt tree: %+v", nreport)
+	}
+
+	// a block which doesn't match its CID
+	blk, err := bs.Get(ctx, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	badCid := randCid()
+	bad, err := blockformat.NewBlockWithCid(blk.RawData(), badCid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bs.Put(ctx, bad); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = VerifyTree(ctx, bs, badCid, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasProblem(report, ProblemCIDMismatch) {
+		t.Fatalf("expected a CID mismatch, got %v", report.Problems)
+	}
+}
@@ -3,6 +3,7 @@
 package mst
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"strings"
@@ -110,6 +111,48 @@ func deserializeNodeData(ctx context.Context, cst cbor.IpldStore, nd *nodeData,
 	return entries, nil
 }
 
+// Leaf is a key of an MST, and the CID of its value.
+type Leaf struct {
+	Key string
+	Val cid.Cid
+}
+
+// DecodeNode decodes the block of an MST node on its own, without loading its subtrees, returning its leaves in key order and the CIDs of its subtrees.
+func DecodeNode(data []byte) ([]Leaf, []cid.Cid, error) {
+	var nd nodeData
+	if err := nd.UnmarshalCBOR(bytes.NewReader(data)); err != nil {
+		return nil, nil, fmt.Errorf("decoding MST node: %w", err)
+	}
+
+	var subtrees []cid.Cid
+	if nd.Left != nil {
+		subtrees = append(subtrees, *nd.Left)
+	}
+
+	leaves := make([]Leaf, 0, len(nd.Entries))
+	var lastKey string
+	for _, e := range nd.Entries {
+		if e.PrefixLen < 0 || int(e.PrefixLen) > len(lastKey) {
+			return nil, nil, fmt.Errorf("invalid MST key prefix length %d after %q", e.PrefixLen, lastKey)
+		}
+		key := lastKey[:e.PrefixLen] + string(e.KeySuffix)
+		if err := ensureValidMstKey(key); err != nil {
+			return nil, nil, err
+		}
+		if len(leaves) > 0 && key <= lastKey {
+			return nil, nil, fmt.Errorf("MST keys out of order: %q after %q", key, lastKey)
+		}
+
+		leaves = append(leaves, Leaf{Key: key, Val: e.Val})
+		if e.Tree != nil {
+			subtrees = append(subtrees, *e.Tree)
+		}
+		lastKey = key
+	}
+
+	return leaves, subtrees, nil
+}
+
 // Typescript: serializeNodeData(entries) -> NodeData
 func serializeNodeData(entries []nodeEntry) (*nodeData, error) {
 	var data nodeData
@@ -0,0 +1,317 @@
+package mst
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/bluesky-social/indigo/util"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	ipld "github.com/ipfs/go-ipld-format"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ProblemKind is the kind of a structural problem found in a tree by VerifyTree.
+type ProblemKind string
+
+const (
+	// A node (or record) block isn't in the blockstore
+	ProblemMissingBlock ProblemKind = "missing_block"
+	// A block's data doesn't hash to its CID
+	ProblemCIDMismatch ProblemKind = "cid_mismatch"
+	// A node can't be decoded, or isn't in canonical DAG-CBOR
+	ProblemBadEncoding ProblemKind = "bad_encoding"
+	ProblemInvalidKey  ProblemKind = "invalid_key"
+	// A key isn't after the previous key of its node
+	ProblemKeyOrder ProblemKind = "key_order"
+	// A key is outside of the range of its subtree, as delimited by the keys of the parent nodes
+	ProblemKeyRange ProblemKind = "key_out_of_range"
+	// A key doesn't belong on the layer of its node, given its hash, or a subtree isn't one layer below its parent
+	ProblemWrongLayer ProblemKind = "wrong_layer"
+	// A node other than the root has no entries nor subtree, or the root only points to a subtree
+	ProblemEmptyNode ProblemKind = "empty_node"
+	// The record block of a leaf isn't in the blockstore
+	ProblemMissingRecord ProblemKind = "missing_record"
+)
+
+// Problem is a structural problem found in a tree.
+type Problem struct {
+	Kind ProblemKind
+	// The node where the problem was found
+	Node cid.Cid
+	// The key concerned, if any
+	Key     string
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Key != "" {
+		return fmt.Sprintf("%s: node %s, key %q: %s", p.Kind, p.Node, p.Key, p.Message)
+	}
+	return fmt.Sprintf("%s: node %s: %s", p.Kind, p.Node, p.Message)
+}
+
+type VerifyReport struct {
+	Problems []Problem
+	// Number of nodes read
+	Nodes int
+	// Number of leaves found, including those with problems
+	Leaves int
+	// Layer of the root node, or -1 if it's empty or unknown
+	Layer int
+}
+
+// OK returns whether no problems were found.
+func (vr *VerifyReport) OK() bool {
+	return len(vr.Problems) == 0
+}
+
+type VerifyOptions struct {
+	// Also check that the record block of each leaf is in the blockstore and matches its CID
+	CheckRecords bool
+}
+
+// VerifyTree checks the structure of the tree at root: that every node can be read, is canonically encoded and matches its CID, that the keys are valid and in order within the range of their subtree, and that every node sits on the layer given by the hashes of its keys. Problems are collected in the report rather than stopping the walk, so that every readable part of the tree is checked; the error is only for failing to read the blockstore.
+func VerifyTree(ctx context.Context, bs blockstore.Blockstore, root cid.Cid, opts *VerifyOptions) (*VerifyReport, error) {
+	ctx, span := otel.Tracer("mst").Start(ctx, "VerifyTree")
+	defer span.End()
+
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+
+	v := &verifier{
+		bs:     bs,
+		opts:   opts,
+		report: &VerifyReport{Layer: -1},
+	}
+	if err := v.walk(ctx, root, -1, "", "", true); err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(attribute.Int("nodes", v.report.Nodes), attribute.Int("problems", len(v.report.Problems)))
+	return v.report, nil
+}
+
+// RebuildTree builds a new tree, written to bs, from the leaves which can still be reached from root, skipping the parts of the tree which are missing or can't be decoded. With CheckRecords, leaves whose record is missing or corrupt are dropped as well. The report is that of the old tree.
+func RebuildTree(ctx context.Context, bs blockstore.Blockstore, root cid.Cid, opts *VerifyOptions) (*MerkleSearchTree, *VerifyReport, error) {
+	ctx, span := otel.Tracer("mst").Start(ctx, "RebuildTree")
+	defer span.End()
+
+	if opts == nil {
+		opts = &VerifyOptions{}
+	}
+
+	// a key found more than once keeps the first value found, in walk order
+	leaves := make(map[string]cid.Cid)
+	v := &verifier{
+		bs:     bs,
+		opts:   opts,
+		report: &VerifyReport{Layer: -1},
+		onLeaf: func(key string, val cid.Cid) {
+			if _, ok := leaves[key]; !ok {
+				leaves[key] = val
+			}
+		},
+	}
+	if err := v.walk(ctx, root, -1, "", "", true); err != nil {
+		return nil, nil, err
+	}
+
+	keys := make([]string, 0, len(leaves))
+	for k := range leaves {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	t := NewEmptyMST(util.CborStore(bs))
+	for _, k := range keys {
+		nt, err := t.Add(ctx, k, leaves[k], -1)
+		if err != nil {
+			return nil, nil, fmt.Errorf("adding %q to rebuilt tree: %w", k, err)
+		}
+		t = nt
+	}
+
+	if _, err := t.GetPointer(ctx); err != nil {
+		return nil, nil, fmt.Errorf("writing rebuilt tree: %w", err)
+	}
+
+	span.SetAttributes(attribute.Int("leaves", len(keys)), attribute.Int("problems", len(v.report.Problems)))
+	return t, v.report, nil
+}
+
+type verifier struct {
+	bs     blockstore.Blockstore
+	opts   *VerifyOptions
+	report *VerifyReport
+	// called with the leaves which have a valid key, and a valid record if checked
+	onLeaf func(key string, val cid.Cid)
+}
+
+func (v *verifier) problem(kind ProblemKind, node cid.Cid, key string, format string, args ...any) {
+	v.report.Problems = append(v.report.Problems, Problem{
+		Kind:    kind,
+		Node:    node,
+		Key:     key,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Checks the node at ptr and its subtrees. Its keys must be strictly between lo and hi, each unbounded if empty, and it must be on the given layer, if not -1.
+func (v *verifier) walk(ctx context.Context, ptr cid.Cid, layer int, lo, hi string, root bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	blk, err := v.bs.Get(ctx, ptr)
+	if err != nil {
+		if ipld.IsNotFound(err) {
+			v.problem(ProblemMissingBlock, ptr, "", "node block not found")
+			return nil
+		}
+		return err
+	}
+	v.report.Nodes++
+
+	// a node which doesn't match its CID is still worth looking inside, for whatever can be recovered
+	data := blk.RawData()
+	v.checkCid(ptr, "", ptr, data)
+
+	var nd nodeData
+	if err := nd.UnmarshalCBOR(bytes.NewReader(data)); err != nil {
+		v.problem(ProblemBadEncoding, ptr, "", "decoding node: %s", err)
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	if err := nd.MarshalCBOR(buf); err != nil {
+		v.problem(ProblemBadEncoding, ptr, "", "re-encoding node: %s", err)
+	} else if !bytes.Equal(buf.Bytes(), data) {
+		v.problem(ProblemBadEncoding, ptr, "", "node is not canonically encoded")
+	}
+
+	if len(nd.Entries) == 0 {
+		switch {
+		case root && nd.Left != nil:
+			v.problem(ProblemEmptyNode, ptr, "", "root node only points to a subtree")
+		case !root && nd.Left == nil:
+			v.problem(ProblemEmptyNode, ptr, "", "node has no entries nor subtree")
+		}
+	}
+
+	nodeLayer := layer
+	keys := make([]string, 0, len(nd.Entries))
+	var prev string
+	for i, e := range nd.Entries {
+		if e.PrefixLen < 0 || int(e.PrefixLen) > len(prev) {
+			// none of the following keys can be trusted either
+			v.problem(ProblemBadEncoding, ptr, "", "entry %d has a prefix length of %d, but the previous key has %d bytes", i, e.PrefixLen, len(prev))
+			break
+		}
+		key := prev[:e.PrefixLen] + string(e.KeySuffix)
+		keys = append(keys, key)
+
+		if !isValidMstKey(key) {
+			v.problem(ProblemInvalidKey, ptr, key, "not a valid MST key")
+		}
+		if i > 0 && key <= prev {
+			v.problem(ProblemKeyOrder, ptr, key, "key is not after the previous key %q", prev)
+		} else if (lo != "" && key <= lo) || (hi != "" && key >= hi) {
+			v.problem(ProblemKeyRange, ptr, key, "key is outside of its subtree range (%q, %q)", lo, hi)
+		}
+
+		kl := leadingZerosOnHash(key)
+		if nodeLayer < 0 {
+			nodeLayer = kl
+		} else if kl != nodeLayer {
+			v.problem(ProblemWrongLayer, ptr, key, "key belongs on layer %d, not %d", kl, nodeLayer)
+		}
+		prev = key
+	}
+
+	if root {
+		v.report.Layer = nodeLayer
+	}
+
+	for i, e := range nd.Entries[:len(keys)] {
+		v.report.Leaves++
+
+		if v.opts.CheckRecords {
+			ok, err := v.checkRecord(ctx, ptr, keys[i], e.Val)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+		}
+		if v.onLeaf != nil && isValidMstKey(keys[i]) {
+			v.onLeaf(keys[i], e.Val)
+		}
+	}
+
+	childLayer := -1
+	if nodeLayer > 0 {
+		childLayer = nodeLayer - 1
+	}
+	hasSubtrees := nd.Left != nil
+	for _, e := range nd.Entries[:len(keys)] {
+		hasSubtrees = hasSubtrees || e.Tree != nil
+	}
+	if nodeLayer == 0 && hasSubtrees {
+		v.problem(ProblemWrongLayer, ptr, "", "node on layer 0 has subtrees")
+	}
+
+	if nd.Left != nil {
+		next := hi
+		if len(keys) > 0 {
+			next = keys[0]
+		}
+		if err := v.walk(ctx, *nd.Left, childLayer, lo, next, false); err != nil {
+			return err
+		}
+	}
+	for i, e := range nd.Entries[:len(keys)] {
+		if e.Tree == nil {
+			continue
+		}
+		next := hi
+		if i+1 < len(keys) {
+			next = keys[i+1]
+		}
+		if err := v.walk(ctx, *e.Tree, childLayer, keys[i], next, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Checks that the record block of a leaf is present and matches its CID.
+func (v *verifier) checkRecord(ctx context.Context, node cid.Cid, key string, val cid.Cid) (bool, error) {
+	blk, err := v.bs.Get(ctx, val)
+	if err != nil {
+		if ipld.IsNotFound(err) {
+			v.problem(ProblemMissingRecord, node, key, "record block %s not found", val)
+			return false, nil
+		}
+		return false, err
+	}
+	return v.checkCid(node, key, val, blk.RawData()), nil
+}
+
+func (v *verifier) checkCid(node cid.Cid, key string, c cid.Cid, data []byte) bool {
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		v.problem(ProblemCIDMismatch, node, key, "hashing block %s: %s", c, err)
+		return false
+	}
+	if !sum.Equals(c) {
+		v.problem(ProblemCIDMismatch, node, key, "block %s hashes to %s", c, sum)
+		return false
+	}
+	return true
+}
@@ -42,7 +42,7 @@ var log = logging.Logger("pds")
 
 type Server struct {
 	db             *gorm.DB
-	cs             *carstore.CarStore
+	cs             carstore.Store
 	repoman        *repomgr.RepoManager
 	feedgen        *FeedGenerator
 	notifman       notifs.NotificationManager
@@ -69,7 +69,7 @@ const UserActorDeclType = "app.bsky.system.actorUser"
 // NewServer.
 const serverListenerBootTimeout = 5 * time.Second
 
-func NewServer(db *gorm.DB, cs *carstore.CarStore, serkey *did.PrivKey, handleSuffix, serviceUrl string, didr plc.PLCClient, jwtkey []byte) (*Server, error) {
+func NewServer(db *gorm.DB, cs carstore.Store, serkey *did.PrivKey, handleSuffix, serviceUrl string, didr plc.PLCClient, jwtkey []byte) (*Server, error) {
 	db.AutoMigrate(&User{})
 	db.AutoMigrate(&Peering{})
 
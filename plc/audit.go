@@ -0,0 +1,431 @@
+package plc
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/multiformats/go-multihash"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// An operation can be nullified by one signed with a higher priority rotation key, within this long after it was created
+const RecoveryWindow = 72 * time.Hour
+
+// Max size of an audit log response
+const maxAuditLogSize = 16 << 20
+
+// LogEntry is an entry of the audit log of a DID, as returned by the /log/audit endpoint of a PLC directory.
+type LogEntry struct {
+	DID       string          `json:"did"`
+	Operation json.RawMessage `json:"operation"`
+	CID       string          `json:"cid"`
+	Nullified bool            `json:"nullified"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// Operation has the fields of all the types of PLC operations: "plc_operation", "plc_tombstone", and the legacy "create".
+type Operation struct {
+	Type string `json:"type"`
+
+	RotationKeys        []string             `json:"rotationKeys,omitempty"`
+	VerificationMethods map[string]string    `json:"verificationMethods,omitempty"`
+	AlsoKnownAs         []string             `json:"alsoKnownAs,omitempty"`
+	Services            map[string]OpService `json:"services,omitempty"`
+
+	// legacy "create" operations only
+	SigningKey  string `json:"signingKey,omitempty"`
+	RecoveryKey string `json:"recoveryKey,omitempty"`
+	Handle      string `json:"handle,omitempty"`
+	Service     string `json:"service,omitempty"`
+
+	Prev *string `json:"prev"`
+	Sig  string  `json:"sig"`
+}
+
+type OpService struct {
+	Type     string `json:"type"`
+	Endpoint string `json:"endpoint"`
+}
+
+// State is the data of a DID after an operation.
+type State struct {
+	RotationKeys        []string
+	VerificationMethods map[string]string
+	AlsoKnownAs         []string
+	Services            map[string]OpService
+}
+
+// AuditProblemKind is the kind of a problem found in an audit log by VerifyAuditLog.
+type AuditProblemKind string
+
+const (
+	// An operation can't be decoded, or isn't a known type
+	ProblemBadOperation AuditProblemKind = "bad_operation"
+	// An operation doesn't hash to the CID of its entry
+	ProblemCIDMismatch AuditProblemKind = "cid_mismatch"
+	// An entry is for another DID, or the genesis operation doesn't hash to the DID
+	ProblemDIDMismatch AuditProblemKind = "did_mismatch"
+	// An operation isn't signed by any of the rotation keys it's allowed to be signed by
+	ProblemBadSignature AuditProblemKind = "bad_signature"
+	// An operation points to a previous operation which isn't in the log, or the first operation isn't a genesis
+	ProblemUnknownPrev AuditProblemKind = "unknown_prev"
+	// An operation which isn't nullified doesn't follow the current head of the log
+	ProblemFork AuditProblemKind = "fork"
+	// A nullified operation wasn't overridden by a higher priority key within the recovery window
+	ProblemBadNullification AuditProblemKind = "bad_nullification"
+	// An operation follows a tombstone
+	ProblemAfterTombstone AuditProblemKind = "after_tombstone"
+)
+
+type AuditProblem struct {
+	Kind AuditProblemKind
+	// CID of the entry concerned
+	CID     string
+	Message string
+}
+
+func (p AuditProblem) String() string {
+	return fmt.Sprintf("%s: operation %s: %s", p.Kind, p.CID, p.Message)
+}
+
+// AuditedOp is an entry of an audit log, as checked by VerifyAuditLog.
+type AuditedOp struct {
+	CID       string
+	Prev      string
+	Type      string
+	CreatedAt time.Time
+	Nullified bool
+	// The rotation key which signed the operation, and its index in the keys allowed to sign it (lower is higher priority), or -1 if none did
+	SignedBy string
+	KeyIndex int
+	// The state of the DID after the operation, or nil for a tombstone or an operation which can't be decoded
+	State *State
+	// Whether no problems were found with this operation
+	Valid bool
+}
+
+// Audit is the verified history of a DID.
+type Audit struct {
+	DID      string
+	Ops      []AuditedOp
+	Problems []AuditProblem
+	// The current state of the DID, after the last operation which isn't nullified, or nil if tombstoned
+	Current    *State
+	Tombstoned bool
+}
+
+// OK returns whether no problems were found.
+func (a *Audit) OK() bool {
+	return len(a.Problems) == 0
+}
+
+// FetchAuditLog fetches the full operation log of a DID, nullified operations included, from a PLC directory.
+func FetchAuditLog(ctx context.Context, c *http.Client, host, did string) ([]LogEntry, error) {
+	ctx, span := otel.Tracer("plc").Start(ctx, "FetchAuditLog")
+	defer span.End()
+
+	if c == nil {
+		c = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", host+"/"+did+"/log/audit", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching audit log: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("audit log request failed (code %d): %s", resp.StatusCode, resp.Status)
+	}
+
+	var entries []LogEntry
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxAuditLogSize)).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("decoding audit log: %w", err)
+	}
+	span.SetAttributes(attribute.Int("entries", len(entries)))
+	return entries, nil
+}
+
+// AuditDID fetches the audit log of a DID from a PLC directory, and verifies it.
+func AuditDID(ctx context.Context, c *http.Client, host, did string) (*Audit, error) {
+	entries, err := FetchAuditLog(ctx, c, host, did)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyAuditLog(did, entries), nil
+}
+
+// VerifyAuditLog checks the audit log of a DID, with its entries in order of creation: that every operation matches its CID and is signed by one of the rotation keys of the operation it follows (or its own, for the genesis operation, which must also hash to the DID), that the operations which aren't nullified form a single chain, and that each nullified operation was overridden by a higher priority key within the recovery window. Problems are collected in the audit rather than stopping the verification.
+func VerifyAuditLog(did string, entries []LogEntry) *Audit {
+	a := &Audit{DID: did}
+	v := &auditVerifier{
+		audit: a,
+		ops:   make(map[string]int),
+	}
+	for _, e := range entries {
+		v.verify(e)
+	}
+	v.checkNullified()
+
+	if i, ok := v.ops[v.head]; ok && !v.tombstoned {
+		a.Current = a.Ops[i].State
+	}
+	a.Tombstoned = v.tombstoned
+	return a
+}
+
+type auditVerifier struct {
+	audit *Audit
+	// index of the operations which could be decoded, by CID
+	ops map[string]int
+	// CID of the last operation which isn't nullified
+	head       string
+	tombstoned bool
+}
+
+func (v *auditVerifier) problem(op *AuditedOp, kind AuditProblemKind, format string, args ...any) {
+	op.Valid = false
+	v.audit.Problems = append(v.audit.Problems, AuditProblem{
+		Kind:    kind,
+		CID:     op.CID,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *auditVerifier) verify(e LogEntry) {
+	v.audit.Ops = append(v.audit.Ops, AuditedOp{
+		CID:       e.CID,
+		Type:      "unknown",
+		CreatedAt: e.CreatedAt,
+		Nullified: e.Nullified,
+		KeyIndex:  -1,
+		Valid:     true,
+	})
+	op := &v.audit.Ops[len(v.audit.Ops)-1]
+
+	if e.DID != v.audit.DID {
+		v.problem(op, ProblemDIDMismatch, "entry is for %s", e.DID)
+	}
+
+	var o Operation
+	if err := json.Unmarshal(e.Operation, &o); err != nil {
+		v.problem(op, ProblemBadOperation, "decoding operation: %s", err)
+		return
+	}
+	op.Type = o.Type
+	if o.Prev != nil {
+		op.Prev = *o.Prev
+	}
+
+	signed, err := encodeOperation(e.Operation, true)
+	if err != nil {
+		v.problem(op, ProblemBadOperation, "encoding operation: %s", err)
+		return
+	}
+	if c, err := cborCid(signed); err != nil || c != e.CID {
+		v.problem(op, ProblemCIDMismatch, "operation hashes to %s", c)
+	}
+
+	switch o.Type {
+	case "plc_operation":
+		op.State = &State{
+			RotationKeys:        o.RotationKeys,
+			VerificationMethods: o.VerificationMethods,
+			AlsoKnownAs:         o.AlsoKnownAs,
+			Services:            o.Services,
+		}
+	case "create":
+		op.State = legacyCreateState(&o)
+	case "plc_tombstone":
+		if o.Prev == nil {
+			v.problem(op, ProblemBadOperation, "tombstone has no previous operation")
+		}
+	default:
+		v.problem(op, ProblemBadOperation, "unknown operation type %q", o.Type)
+		return
+	}
+
+	// the keys allowed to sign the operation
+	var keys []string
+	if o.Prev == nil {
+		if len(v.audit.Ops) > 1 {
+			v.problem(op, ProblemUnknownPrev, "genesis operation is not the first of the log")
+		}
+		if op.State != nil {
+			keys = op.State.RotationKeys
+		}
+		if d := didForGenesis(signed); d != v.audit.DID {
+			v.problem(op, ProblemDIDMismatch, "genesis operation hashes to %s", d)
+		}
+	} else {
+		i, ok := v.ops[*o.Prev]
+		if !ok || v.audit.Ops[i].State == nil {
+			v.problem(op, ProblemUnknownPrev, "previous operation %s not found", *o.Prev)
+		} else {
+			keys = v.audit.Ops[i].State.RotationKeys
+		}
+	}
+
+	if err := verifyOpSignature(op, e.Operation, o.Sig, keys); err != nil {
+		v.problem(op, ProblemBadSignature, "%s", err)
+	}
+
+	v.ops[e.CID] = len(v.audit.Ops) - 1
+
+	if e.Nullified {
+		return
+	}
+	if v.tombstoned {
+		v.problem(op, ProblemAfterTombstone, "operation follows a tombstone")
+	}
+	if v.head != "" && op.Prev != v.head {
+		v.problem(op, ProblemFork, "operation follows %s, not the current head %s", op.Prev, v.head)
+	}
+	v.head = e.CID
+	if o.Type == "plc_tombstone" {
+		v.tombstoned = true
+	}
+}
+
+// Checks that each nullified operation was overridden, within the recovery window, by an operation which isn't nullified, with the same previous operation (or one which was itself nullified), and signed by a higher priority key.
+func (v *auditVerifier) checkNullified() {
+	for i := range v.audit.Ops {
+		op := &v.audit.Ops[i]
+		if !op.Nullified {
+			continue
+		}
+
+		overridden := false
+		for j := range v.audit.Ops {
+			other := &v.audit.Ops[j]
+			if other.Nullified || other.Prev != op.Prev || other.CID == op.CID || other.KeyIndex < 0 {
+				continue
+			}
+			if other.CreatedAt.Before(op.CreatedAt) || other.CreatedAt.Sub(op.CreatedAt) > RecoveryWindow {
+				continue
+			}
+			if op.KeyIndex < 0 || other.KeyIndex < op.KeyIndex {
+				overridden = true
+				break
+			}
+		}
+		if !overridden && !v.nullifiedByAncestor(op) {
+			v.problem(op, ProblemBadNullification, "not overridden by a higher priority key within %s", RecoveryWindow)
+		}
+	}
+}
+
+// Returns whether an operation follows one which was nullified, and so was nullified along with it.
+func (v *auditVerifier) nullifiedByAncestor(op *AuditedOp) bool {
+	i, ok := v.ops[op.Prev]
+	return ok && v.audit.Ops[i].Nullified
+}
+
+// Verifies the signature of an operation against the allowed rotation keys, in order of priority, setting the key which signed it.
+func verifyOpSignature(op *AuditedOp, raw json.RawMessage, sig string, keys []string) error {
+	if len(keys) == 0 {
+		return fmt.Errorf("no rotation keys to verify the signature with")
+	}
+	sigBytes, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return fmt.Errorf("decoding signature: %w", err)
+	}
+	unsigned, err := encodeOperation(raw, false)
+	if err != nil {
+		return err
+	}
+
+	for i, k := range keys {
+		pub, err := crypto.ParsePublicDIDKey(k)
+		if err != nil {
+			continue
+		}
+		if pub.HashAndVerify(unsigned, sigBytes) == nil {
+			op.SignedBy = k
+			op.KeyIndex = i
+			return nil
+		}
+	}
+	return fmt.Errorf("not signed by any of the %d allowed rotation keys", len(keys))
+}
+
+// Returns the state after a legacy "create" operation, which had a signing key and a recovery key, both of which are rotation keys.
+func legacyCreateState(o *Operation) *State {
+	handle := o.Handle
+	if !strings.HasPrefix(handle, "at://") {
+		handle = "at://" + handle
+	}
+	service := o.Service
+	if !strings.HasPrefix(service, "http://") && !strings.HasPrefix(service, "https://") {
+		service = "https://" + service
+	}
+	return &State{
+		RotationKeys:        []string{o.RecoveryKey, o.SigningKey},
+		VerificationMethods: map[string]string{"atproto": o.SigningKey},
+		AlsoKnownAs:         []string{handle},
+		Services: map[string]OpService{
+			"atproto_pds": {Type: "AtprotoPersonalDataServer", Endpoint: service},
+		},
+	}
+}
+
+// Returns the DAG-CBOR encoding of an operation, as it was signed (without its signature) or as it was hashed.
+func encodeOperation(raw json.RawMessage, withSig bool) ([]byte, error) {
+	if !withSig {
+		var m map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &m); err != nil {
+			return nil, err
+		}
+		delete(m, "sig")
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		raw = b
+	}
+
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagjson.Decode(nb, bytes.NewReader(raw)); err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err := dagcbor.Encode(nb.Build(), buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func cborCid(data []byte) (string, error) {
+	c, err := cid.NewPrefixV1(cid.DagCBOR, multihash.SHA2_256).Sum(data)
+	if err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
+
+// Returns the DID derived from a signed genesis operation.
+func didForGenesis(signed []byte) string {
+	h := sha256.Sum256(signed)
+	enc := strings.ToLower(base32.StdEncoding.EncodeToString(h[:]))
+	return "did:plc:" + enc[:24]
+}
@@ -0,0 +1,193 @@
+package plc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loadAuditLog(t *testing.T, name string) []LogEntry {
+	t.Helper()
+	b, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []LogEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		t.Fatal(err)
+	}
+	return entries
+}
+
+func problemKinds(a *Audit) []AuditProblemKind {
+	var kinds []AuditProblemKind
+	for _, p := range a.Problems {
+		kinds = append(kinds, p.Kind)
+	}
+	return kinds
+}
+
+// Sets a field of the operation of an entry, recomputing its CID unless keepCID.
+func editOperation(t *testing.T, e *LogEntry, field string, val any, keepCID bool) {
+	t.Helper()
+	var m map[string]any
+	if err := json.Unmarshal(e.Operation, &m); err != nil {
+		t.Fatal(err)
+	}
+	m[field] = val
+	raw, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Operation = raw
+	if keepCID {
+		return
+	}
+	signed, err := encodeOperation(raw, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.CID, err = cborCid(signed); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyAuditLogValid(t *testing.T) {
+	assert := assert.New(t)
+	entries := loadAuditLog(t, "audit_valid.json")
+	did := entries[0].DID
+
+	a := VerifyAuditLog(did, entries)
+	assert.True(a.OK(), "%v", a.Problems)
+	assert.False(a.Tombstoned)
+	assert.Len(a.Ops, 3)
+	for _, op := range a.Ops {
+		assert.True(op.Valid)
+		// signed by the second rotation key
+		assert.Equal(1, op.KeyIndex)
+	}
+	assert.Equal("", a.Ops[0].Prev)
+	assert.Equal(a.Ops[0].CID, a.Ops[1].Prev)
+	assert.Equal([]string{"at://alice3.example.com"}, a.Current.AlsoKnownAs)
+	assert.Equal("https://pds.example.com", a.Current.Services["atproto_pds"].Endpoint)
+
+	// the DID is derived from the genesis operation
+	a = VerifyAuditLog("did:plc:aaaaaaaaaaaaaaaaaaaaaaaa", entries)
+	assert.Contains(problemKinds(a), ProblemDIDMismatch)
+}
+
+func TestVerifyAuditLogTamperedPrev(t *testing.T) {
+	assert := assert.New(t)
+	entries := loadAuditLog(t, "audit_valid.json")
+
+	editOperation(t, &entries[2], "prev", "bafyreie5737gdxlw5i64vzichcalba3z2v5n6icifvx5xytvske7mr3hpm", true)
+	a := VerifyAuditLog(entries[0].DID, entries)
+	assert.False(a.OK())
+	assert.Equal([]AuditProblemKind{ProblemCIDMismatch, ProblemUnknownPrev, ProblemBadSignature, ProblemFork}, problemKinds(a))
+	for _, p := range a.Problems {
+		assert.Equal(entries[2].CID, p.CID)
+	}
+	assert.True(a.Ops[1].Valid)
+	assert.False(a.Ops[2].Valid)
+
+	// pointing to another operation of the log invalidates the signature, as the signed data changed
+	entries = loadAuditLog(t, "audit_valid.json")
+	editOperation(t, &entries[2], "prev", entries[0].CID, false)
+	a = VerifyAuditLog(entries[0].DID, entries)
+	assert.Equal([]AuditProblemKind{ProblemBadSignature, ProblemFork}, problemKinds(a))
+}
+
+func TestVerifyAuditLogBadSignature(t *testing.T) {
+	assert := assert.New(t)
+	entries := loadAuditLog(t, "audit_valid.json")
+
+	// re-signed by a key which isn't a rotation key, with a consistent CID
+	priv, err := crypto.GeneratePrivateKeyK256()
+	assert.NoError(err)
+	unsigned, err := encodeOperation(entries[1].Operation, false)
+	assert.NoError(err)
+	sig, err := priv.HashAndSign(unsigned)
+	assert.NoError(err)
+	editOperation(t, &entries[1], "sig", base64.RawURLEncoding.EncodeToString(sig), false)
+
+	a := VerifyAuditLog(entries[0].DID, entries[:2])
+	assert.Equal([]AuditProblemKind{ProblemBadSignature}, problemKinds(a))
+	assert.Equal(entries[1].CID, a.Problems[0].CID)
+	assert.Equal(-1, a.Ops[1].KeyIndex)
+	assert.Equal("", a.Ops[1].SignedBy)
+
+	// an undecodable signature
+	entries = loadAuditLog(t, "audit_valid.json")
+	editOperation(t, &entries[2], "sig", "not base64!", false)
+	a = VerifyAuditLog(entries[0].DID, entries)
+	assert.Equal([]AuditProblemKind{ProblemBadSignature}, problemKinds(a))
+}
+
+func TestVerifyAuditLogFork(t *testing.T) {
+	assert := assert.New(t)
+	entries := loadAuditLog(t, "audit_fork.json")
+
+	// two operations follow the genesis, and neither is nullified
+	a := VerifyAuditLog(entries[0].DID, entries)
+	assert.Equal([]AuditProblemKind{ProblemFork}, problemKinds(a))
+	assert.Equal(entries[2].CID, a.Problems[0].CID)
+	assert.Equal(a.Ops[0].CID, a.Ops[1].Prev)
+	assert.Equal(a.Ops[0].CID, a.Ops[2].Prev)
+}
+
+func TestVerifyAuditLogNullification(t *testing.T) {
+	assert := assert.New(t)
+
+	// overridden by the higher priority key within the recovery window
+	entries := loadAuditLog(t, "audit_nullified.json")
+	a := VerifyAuditLog(entries[0].DID, entries)
+	assert.True(a.OK(), "%v", a.Problems)
+	assert.True(a.Ops[1].Nullified)
+	assert.Equal(1, a.Ops[1].KeyIndex)
+	assert.Equal(0, a.Ops[2].KeyIndex)
+	assert.Less(entries[2].CreatedAt.Sub(entries[1].CreatedAt), RecoveryWindow)
+	assert.Equal([]string{"at://alice.example.com"}, a.Current.AlsoKnownAs)
+
+	// the same recovery, after the window
+	entries = loadAuditLog(t, "audit_nullified_late.json")
+	assert.Greater(entries[2].CreatedAt.Sub(entries[1].CreatedAt), RecoveryWindow)
+	a = VerifyAuditLog(entries[0].DID, entries)
+	assert.Equal([]AuditProblemKind{ProblemBadNullification}, problemKinds(a))
+	assert.Equal(entries[1].CID, a.Problems[0].CID)
+
+	// nullified without any recovery operation
+	entries = loadAuditLog(t, "audit_nullified.json")
+	a = VerifyAuditLog(entries[0].DID, entries[:2])
+	assert.Equal([]AuditProblemKind{ProblemBadNullification}, problemKinds(a))
+
+	// a recovery can't come before the operation it nullifies
+	entries = loadAuditLog(t, "audit_nullified.json")
+	entries[2].CreatedAt = entries[1].CreatedAt.Add(-time.Minute)
+	a = VerifyAuditLog(entries[0].DID, entries)
+	assert.Equal([]AuditProblemKind{ProblemBadNullification}, problemKinds(a))
+}
+
+func TestVerifyAuditLogTombstone(t *testing.T) {
+	assert := assert.New(t)
+	entries := loadAuditLog(t, "audit_tombstone.json")
+
+	a := VerifyAuditLog(entries[0].DID, entries)
+	assert.True(a.OK(), "%v", a.Problems)
+	assert.True(a.Tombstoned)
+	assert.Nil(a.Current)
+	assert.Equal("plc_tombstone", a.Ops[1].Type)
+
+	// nothing can follow a tombstone
+	valid := loadAuditLog(t, "audit_valid.json")
+	next := valid[1]
+	editOperation(t, &next, "prev", entries[1].CID, false)
+	next.CreatedAt = entries[1].CreatedAt.Add(time.Hour)
+	a = VerifyAuditLog(entries[0].DID, append(entries, next))
+	assert.Contains(problemKinds(a), ProblemAfterTombstone)
+}
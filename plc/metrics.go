@@ -14,3 +14,18 @@ var cacheMissesTotal = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "plc_cache_misses_total",
 	Help: "Total number of cache misses",
 })
+
+var mirrorOps = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "plc_mirror_ops_total",
+	Help: "Total number of PLC operations mirrored",
+})
+
+var mirrorSyncErrors = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "plc_mirror_sync_errors_total",
+	Help: "Total number of failed PLC mirror syncs",
+})
+
+var mirrorStaleness = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "plc_mirror_staleness_seconds",
+	Help: "Age of the last operation mirrored from the PLC directory",
+})
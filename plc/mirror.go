@@ -0,0 +1,475 @@
+package plc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrDIDNotFound is returned by a Mirror for DIDs which it has no operations of.
+	ErrDIDNotFound = errors.New("DID not found in mirror")
+	// ErrDIDTombstoned is returned by a Mirror for DIDs which were deactivated.
+	ErrDIDTombstoned = errors.New("DID is tombstoned")
+)
+
+// MirrorOp is an operation of the PLC directory, as mirrored in the local database.
+type MirrorOp struct {
+	ID        uint   `gorm:"primarykey"`
+	DID       string `gorm:"column:did;index"`
+	CID       string `gorm:"column:cid;uniqueIndex"`
+	Prev      string
+	Operation string
+	Nullified bool
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// MirrorDID is the current state of a DID in the local database: the last operation which isn't nullified.
+type MirrorDID struct {
+	DID        string `gorm:"column:did;primarykey"`
+	Head       string
+	Operation  string
+	Tombstoned bool
+	// CreatedAt of the head operation
+	HeadCreatedAt time.Time
+}
+
+func (MirrorOp) TableName() string {
+	return "plc_mirror_ops"
+}
+
+func (MirrorDID) TableName() string {
+	return "plc_mirror_dids"
+}
+
+type MirrorOptions struct {
+	// Method, hostname and port of the PLC directory to mirror
+	Host   string
+	Client *http.Client
+	// Number of operations requested per page of the export, at most 1000
+	PageSize int
+	// How long to wait before polling the export again, once caught up
+	PollInterval time.Duration
+	// Max number of export requests per second
+	RateLimit float64
+	Logger    *slog.Logger
+}
+
+func DefaultMirrorOptions() *MirrorOptions {
+	return &MirrorOptions{
+		Host:         "https://plc.directory",
+		Client:       &http.Client{Timeout: time.Minute},
+		PageSize:     1000,
+		PollInterval: 5 * time.Second,
+		RateLimit:    2,
+		Logger:       slog.Default(),
+	}
+}
+
+// Mirror copies the operations of a PLC directory into a local database, from the export of the directory, and resolves DIDs from it. Operations are not verified again: the directory is trusted to have done so, as with resolving DIDs from it directly.
+type Mirror struct {
+	db      *gorm.DB
+	opts    *MirrorOptions
+	limiter *rate.Limiter
+
+	// held for the duration of a sync
+	syncLk sync.Mutex
+
+	lk sync.Mutex
+	// CreatedAt of the last operation mirrored, which is the cursor of the export
+	last time.Time
+	// when the last page of the export which wasn't full was fetched, at which point the mirror was up to date
+	caughtUp time.Time
+}
+
+func NewMirror(db *gorm.DB, opts *MirrorOptions) (*Mirror, error) {
+	if opts == nil {
+		opts = DefaultMirrorOptions()
+	}
+	if err := db.AutoMigrate(&MirrorOp{}, &MirrorDID{}); err != nil {
+		return nil, fmt.Errorf("migrating mirror tables: %w", err)
+	}
+
+	m := &Mirror{
+		db:      db,
+		opts:    opts,
+		limiter: rate.NewLimiter(rate.Limit(opts.RateLimit), 1),
+	}
+
+	var last MirrorOp
+	err := db.Order("created_at desc").Limit(1).Find(&last).Error
+	if err != nil {
+		return nil, fmt.Errorf("loading mirror cursor: %w", err)
+	}
+	m.last = last.CreatedAt
+	return m, nil
+}
+
+// Run syncs the mirror until the context is cancelled, polling the export for new operations once caught up.
+func (m *Mirror) Run(ctx context.Context) error {
+	for {
+		_, fetched, err := m.syncPage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			mirrorSyncErrors.Inc()
+			m.opts.Logger.Error("failed to sync PLC mirror", "err", err)
+		}
+		mirrorStaleness.Set(m.Staleness().Seconds())
+
+		// a full page means there are more operations to fetch right away
+		if err == nil && fetched >= m.opts.PageSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(m.opts.PollInterval):
+		}
+	}
+}
+
+// SyncOnce fetches the next page of the export, from the last operation mirrored, and applies it. It returns the number of new operations in the page.
+func (m *Mirror) SyncOnce(ctx context.Context) (int, error) {
+	n, _, err := m.syncPage(ctx)
+	return n, err
+}
+
+// Returns the number of new operations applied, and the number of operations in the page (including those already mirrored).
+func (m *Mirror) syncPage(ctx context.Context) (int, int, error) {
+	ctx, span := otel.Tracer("plc").Start(ctx, "MirrorSyncOnce")
+	defer span.End()
+
+	m.syncLk.Lock()
+	defer m.syncLk.Unlock()
+
+	if err := m.limiter.Wait(ctx); err != nil {
+		return 0, 0, err
+	}
+
+	m.lk.Lock()
+	after := m.last
+	m.lk.Unlock()
+
+	fetched := time.Now()
+	entries, err := m.fetchExport(ctx, after)
+	if err != nil {
+		return 0, 0, err
+	}
+	span.SetAttributes(attribute.Int("ops", len(entries)))
+	if len(entries) == 0 {
+		m.lk.Lock()
+		m.caughtUp = fetched
+		m.lk.Unlock()
+		return 0, 0, nil
+	}
+
+	// the page starts with the operations at the cursor, which were (at least partly) mirrored already
+	n := 0
+	err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		cids := make([]string, len(entries))
+		for i, e := range entries {
+			cids[i] = e.CID
+		}
+		var existing []string
+		if err := tx.Model(&MirrorOp{}).Where("cid IN ?", cids).Pluck("cid", &existing).Error; err != nil {
+			return err
+		}
+		seen := make(map[string]bool, len(existing))
+		for _, cid := range existing {
+			seen[cid] = true
+		}
+
+		for _, e := range entries {
+			if seen[e.CID] {
+				continue
+			}
+			seen[e.CID] = true
+			if err := applyOp(tx, e); err != nil {
+				return fmt.Errorf("applying operation %s of %s: %w", e.CID, e.DID, err)
+			}
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	m.lk.Lock()
+	if last := entries[len(entries)-1].CreatedAt; last.After(m.last) {
+		m.last = last
+	}
+	if len(entries) < m.opts.PageSize {
+		m.caughtUp = fetched
+	}
+	m.lk.Unlock()
+	mirrorOps.Add(float64(n))
+	return n, len(entries), nil
+}
+
+// Fetches a page of the export, starting from the operations created at the given time. The export's "after" parameter is exclusive, and several operations can share a timestamp (which has millisecond precision), so the request is for operations after the previous millisecond: operations at the boundary of the previous page aren't skipped, and are ignored by CID when applying the page.
+func (m *Mirror) fetchExport(ctx context.Context, after time.Time) ([]LogEntry, error) {
+	q := url.Values{}
+	q.Set("count", strconv.Itoa(m.opts.PageSize))
+	if !after.IsZero() {
+		q.Set("after", after.Add(-time.Millisecond).UTC().Format(time.RFC3339Nano))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", m.opts.Host+"/export?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.opts.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching export: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("export request failed (code %d): %s", resp.StatusCode, resp.Status)
+	}
+
+	// the export is one JSON entry per line
+	var entries []LogEntry
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(nil, maxAuditLogSize)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		var e LogEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return nil, fmt.Errorf("decoding export entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("reading export: %w", err)
+	}
+	return entries, nil
+}
+
+// Stores an operation and updates the state of its DID. An operation which doesn't follow the current head of its DID is a recovery, which nullifies the operations after the one it follows. If the operation it follows isn't in the mirror, nothing is nullified, rather than every operation of the DID.
+func applyOp(tx *gorm.DB, e LogEntry) error {
+	var o Operation
+	if err := json.Unmarshal(e.Operation, &o); err != nil {
+		return err
+	}
+	var prev string
+	if o.Prev != nil {
+		prev = *o.Prev
+	}
+
+	res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&MirrorOp{
+		DID:       e.DID,
+		CID:       e.CID,
+		Prev:      prev,
+		Operation: string(e.Operation),
+		Nullified: e.Nullified,
+		CreatedAt: e.CreatedAt,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	// already mirrored, from the overlap between pages
+	if res.RowsAffected == 0 || e.Nullified {
+		return nil
+	}
+
+	var cur MirrorDID
+	if err := tx.Where("did = ?", e.DID).Limit(1).Find(&cur).Error; err != nil {
+		return err
+	}
+	if cur.Head != "" && cur.Head != prev {
+		var prevOp MirrorOp
+		res := tx.Where("did = ? AND cid = ?", e.DID, prev).Limit(1).Find(&prevOp)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected > 0 {
+			err := tx.Model(&MirrorOp{}).
+				Where("did = ? AND created_at > ? AND cid != ? AND NOT nullified", e.DID, prevOp.CreatedAt, e.CID).
+				Update("nullified", true).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Save(&MirrorDID{
+		DID:           e.DID,
+		Head:          e.CID,
+		Operation:     string(e.Operation),
+		Tombstoned:    o.Type == "plc_tombstone",
+		HeadCreatedAt: e.CreatedAt,
+	}).Error
+}
+
+// Staleness returns how far behind the directory the mirror can be: the time since it was last caught up with the export, or if it's still catching up, since the last operation mirrored was created.
+func (m *Mirror) Staleness() time.Duration {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+	if m.last.IsZero() && m.caughtUp.IsZero() {
+		return 0
+	}
+	if m.caughtUp.After(m.last) {
+		return time.Since(m.caughtUp)
+	}
+	return time.Since(m.last)
+}
+
+// Document returns the DID document of a DID, as the PLC directory would serve it.
+func (m *Mirror) Document(ctx context.Context, did string) (*identity.DIDDocument, error) {
+	var cur MirrorDID
+	if err := m.db.WithContext(ctx).Where("did = ?", did).Limit(1).Find(&cur).Error; err != nil {
+		return nil, err
+	}
+	if cur.DID == "" {
+		return nil, ErrDIDNotFound
+	}
+	if cur.Tombstoned {
+		return nil, ErrDIDTombstoned
+	}
+
+	var o Operation
+	if err := json.Unmarshal([]byte(cur.Operation), &o); err != nil {
+		return nil, fmt.Errorf("decoding operation %s: %w", cur.Head, err)
+	}
+	st := &State{
+		RotationKeys:        o.RotationKeys,
+		VerificationMethods: o.VerificationMethods,
+		AlsoKnownAs:         o.AlsoKnownAs,
+		Services:            o.Services,
+	}
+	if o.Type == "create" {
+		st = legacyCreateState(&o)
+	}
+	return documentFor(did, st)
+}
+
+func documentFor(did string, st *State) (*identity.DIDDocument, error) {
+	d, err := syntax.ParseDID(did)
+	if err != nil {
+		return nil, err
+	}
+	doc := &identity.DIDDocument{
+		DID:         d,
+		AlsoKnownAs: st.AlsoKnownAs,
+	}
+
+	names := make([]string, 0, len(st.VerificationMethods))
+	for name := range st.VerificationMethods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		doc.VerificationMethod = append(doc.VerificationMethod, identity.DocVerificationMethod{
+			ID:                 did + "#" + name,
+			Type:               "Multikey",
+			Controller:         did,
+			PublicKeyMultibase: strings.TrimPrefix(st.VerificationMethods[name], "did:key:"),
+		})
+	}
+
+	names = names[:0]
+	for name := range st.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		doc.Service = append(doc.Service, identity.DocService{
+			ID:              "#" + name,
+			Type:            st.Services[name].Type,
+			ServiceEndpoint: st.Services[name].Endpoint,
+		})
+	}
+	return doc, nil
+}
+
+// AuditLog returns the mirrored operations of a DID, nullified ones included, in the format of the audit log of the PLC directory.
+func (m *Mirror) AuditLog(ctx context.Context, did string) ([]LogEntry, error) {
+	var ops []MirrorOp
+	if err := m.db.WithContext(ctx).Where("did = ?", did).Order("created_at asc, id asc").Find(&ops).Error; err != nil {
+		return nil, err
+	}
+	if len(ops) == 0 {
+		return nil, ErrDIDNotFound
+	}
+
+	entries := make([]LogEntry, len(ops))
+	for i, op := range ops {
+		entries[i] = LogEntry{
+			DID:       op.DID,
+			Operation: json.RawMessage(op.Operation),
+			CID:       op.CID,
+			Nullified: op.Nullified,
+			CreatedAt: op.CreatedAt,
+		}
+	}
+	return entries, nil
+}
+
+// ServeHTTP serves the resolution endpoints of the PLC directory from the mirror: DID documents at /{did}, and audit logs at /{did}/log/audit. Writes are not supported.
+func (m *Mirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	did, rest, _ := strings.Cut(path, "/")
+	if !strings.HasPrefix(did, "did:plc:") {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	var out any
+	var err error
+	switch rest {
+	case "":
+		out, err = m.Document(r.Context(), did)
+	case "log/audit":
+		out, err = m.AuditLog(r.Context(), did)
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	switch {
+	case errors.Is(err, ErrDIDNotFound):
+		http.Error(w, fmt.Sprintf("DID not registered: %s", did), http.StatusNotFound)
+		return
+	case errors.Is(err, ErrDIDTombstoned):
+		http.Error(w, fmt.Sprintf("DID not available: %s", did), http.StatusGone)
+		return
+	case err != nil:
+		m.opts.Logger.Error("failed to serve from PLC mirror", "did", did, "err", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Mirror-Staleness", strconv.FormatInt(int64(m.Staleness().Seconds()), 10))
+	json.NewEncoder(w).Encode(out)
+}
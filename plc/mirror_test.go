@@ -0,0 +1,299 @@
+package plc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Fake PLC directory export, which serves entries in order of creation, and records the cursors it was requested with.
+type fakeExport struct {
+	lk      sync.Mutex
+	entries []LogEntry
+	afters  []string
+}
+
+func (f *fakeExport) add(entries ...LogEntry) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.entries = append(f.entries, entries...)
+}
+
+func (f *fakeExport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/export" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	f.lk.Lock()
+	defer f.lk.Unlock()
+
+	after := r.URL.Query().Get("after")
+	f.afters = append(f.afters, after)
+	var cursor time.Time
+	if after != "" {
+		var err error
+		if cursor, err = time.Parse(time.RFC3339Nano, after); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+	}
+	count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+
+	enc := json.NewEncoder(w)
+	n := 0
+	for _, e := range f.entries {
+		if n >= count {
+			break
+		}
+		if !e.CreatedAt.After(cursor) {
+			continue
+		}
+		// the export shows operations as they were created
+		e.Nullified = false
+		enc.Encode(e)
+		n++
+	}
+}
+
+func testMirror(t *testing.T, path string, export *fakeExport) *Mirror {
+	t.Helper()
+	srv := httptest.NewServer(export)
+	t.Cleanup(srv.Close)
+
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMirror(db, &MirrorOptions{
+		Host:         srv.URL,
+		Client:       srv.Client(),
+		PageSize:     2,
+		PollInterval: time.Millisecond,
+		RateLimit:    1000,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestMirrorSync(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	entries := loadAuditLog(t, "audit_valid.json")
+	did := entries[0].DID
+
+	export := &fakeExport{entries: entries}
+	m := testMirror(t, "file::memory:", export)
+
+	// pages of two operations, until a page which isn't full
+	n, err := m.SyncOnce(ctx)
+	assert.NoError(err)
+	assert.Equal(2, n)
+	n, err = m.SyncOnce(ctx)
+	assert.NoError(err)
+	assert.Equal(1, n)
+	n, err = m.SyncOnce(ctx)
+	assert.NoError(err)
+	assert.Zero(n)
+	// each page starts from the last operation mirrored, inclusively
+	cursor := func(e LogEntry) string { return e.CreatedAt.Add(-time.Millisecond).Format(time.RFC3339Nano) }
+	assert.Equal([]string{"", cursor(entries[1]), cursor(entries[2])}, export.afters)
+
+	var ops []MirrorOp
+	assert.NoError(m.db.Order("created_at asc").Find(&ops).Error)
+	assert.Len(ops, 3)
+	for i, op := range ops {
+		assert.Equal(entries[i].CID, op.CID)
+		assert.Equal(did, op.DID)
+		assert.False(op.Nullified)
+	}
+	assert.Equal("", ops[0].Prev)
+	assert.Equal(ops[0].CID, ops[1].Prev)
+
+	var cur MirrorDID
+	assert.NoError(m.db.Where("did = ?", did).First(&cur).Error)
+	assert.Equal(entries[2].CID, cur.Head)
+	assert.False(cur.Tombstoned)
+	assert.True(cur.HeadCreatedAt.Equal(entries[2].CreatedAt))
+
+	doc, err := m.Document(ctx, did)
+	assert.NoError(err)
+	assert.Equal(did, doc.DID.String())
+	assert.Equal([]string{"at://alice3.example.com"}, doc.AlsoKnownAs)
+	assert.Len(doc.VerificationMethod, 1)
+	assert.Equal(did+"#atproto", doc.VerificationMethod[0].ID)
+	assert.Len(doc.Service, 1)
+	assert.Equal("https://pds.example.com", doc.Service[0].ServiceEndpoint)
+
+	log, err := m.AuditLog(ctx, did)
+	assert.NoError(err)
+	assert.True(VerifyAuditLog(did, log).OK())
+
+	_, err = m.Document(ctx, "did:plc:aaaaaaaaaaaaaaaaaaaaaaaa")
+	assert.ErrorIs(err, ErrDIDNotFound)
+	_, err = m.AuditLog(ctx, "did:plc:aaaaaaaaaaaaaaaaaaaaaaaa")
+	assert.ErrorIs(err, ErrDIDNotFound)
+}
+
+func TestMirrorResume(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	entries := loadAuditLog(t, "audit_valid.json")
+	path := filepath.Join(t.TempDir(), "mirror.sqlite")
+
+	export := &fakeExport{entries: entries[:2]}
+	m := testMirror(t, path, export)
+	n, err := m.SyncOnce(ctx)
+	assert.NoError(err)
+	assert.Equal(2, n)
+
+	// a new mirror on the same database continues from the last operation mirrored
+	export.add(entries[2])
+	m = testMirror(t, path, export)
+	n, err = m.SyncOnce(ctx)
+	assert.NoError(err)
+	assert.Equal(1, n)
+	assert.Equal(entries[1].CreatedAt.Add(-time.Millisecond).Format(time.RFC3339Nano), export.afters[len(export.afters)-1])
+
+	var count int64
+	assert.NoError(m.db.Model(&MirrorOp{}).Count(&count).Error)
+	assert.Equal(int64(3), count)
+
+	// operations seen again, eg from a page overlapping the previous one, are ignored
+	assert.NoError(m.db.Transaction(func(tx *gorm.DB) error {
+		return applyOp(tx, entries[1])
+	}))
+	var cur MirrorDID
+	assert.NoError(m.db.Where("did = ?", entries[0].DID).First(&cur).Error)
+	assert.Equal(entries[2].CID, cur.Head)
+}
+
+func TestMirrorSameTimestamp(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	entries := loadAuditLog(t, "audit_valid.json")
+
+	// the second page starts with an operation created at the same time as the last one of the first page
+	entries[2].CreatedAt = entries[1].CreatedAt
+	m := testMirror(t, "file::memory:", &fakeExport{entries: entries})
+	n, err := m.SyncOnce(ctx)
+	assert.NoError(err)
+	assert.Equal(2, n)
+	n, err = m.SyncOnce(ctx)
+	assert.NoError(err)
+	assert.Equal(1, n)
+	n, err = m.SyncOnce(ctx)
+	assert.NoError(err)
+	assert.Zero(n)
+
+	var cur MirrorDID
+	assert.NoError(m.db.Where("did = ?", entries[0].DID).First(&cur).Error)
+	assert.Equal(entries[2].CID, cur.Head)
+}
+
+func TestMirrorNullified(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	entries := loadAuditLog(t, "audit_nullified.json")
+	did := entries[0].DID
+
+	// the recovery operation arrives after the one it nullifies was mirrored
+	export := &fakeExport{entries: entries[:2]}
+	m := testMirror(t, "file::memory:", export)
+	_, err := m.SyncOnce(ctx)
+	assert.NoError(err)
+	doc, err := m.Document(ctx, did)
+	assert.NoError(err)
+	assert.Equal([]string{"at://mallory.example.com"}, doc.AlsoKnownAs)
+
+	export.add(entries[2])
+	n, err := m.SyncOnce(ctx)
+	assert.NoError(err)
+	assert.Equal(1, n)
+	doc, err = m.Document(ctx, did)
+	assert.NoError(err)
+	assert.Equal([]string{"at://alice.example.com"}, doc.AlsoKnownAs)
+
+	log, err := m.AuditLog(ctx, did)
+	assert.NoError(err)
+	assert.Len(log, 3)
+	assert.False(log[0].Nullified)
+	assert.True(log[1].Nullified)
+	assert.False(log[2].Nullified)
+	assert.True(VerifyAuditLog(did, log).OK())
+}
+
+func TestMirrorUnknownPrev(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	entries := loadAuditLog(t, "audit_valid.json")
+	did := entries[0].DID
+
+	m := testMirror(t, "file::memory:", &fakeExport{entries: entries[:2]})
+	_, err := m.SyncOnce(ctx)
+	assert.NoError(err)
+
+	// an operation which doesn't follow the head, nor any operation in the mirror, doesn't nullify anything
+	var op map[string]any
+	assert.NoError(json.Unmarshal(entries[2].Operation, &op))
+	op["prev"] = "bafyreiunknownunknownunknownunknownunknownunknownunknownu"
+	e := entries[2]
+	e.Operation, err = json.Marshal(op)
+	assert.NoError(err)
+	assert.NoError(m.db.Transaction(func(tx *gorm.DB) error {
+		return applyOp(tx, e)
+	}))
+
+	var ops []MirrorOp
+	assert.NoError(m.db.Where("did = ?", did).Find(&ops).Error)
+	assert.Len(ops, 3)
+	for _, op := range ops {
+		assert.False(op.Nullified)
+	}
+	var cur MirrorDID
+	assert.NoError(m.db.Where("did = ?", did).First(&cur).Error)
+	assert.Equal(e.CID, cur.Head)
+}
+
+func TestMirrorTombstoned(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	entries := loadAuditLog(t, "audit_tombstone.json")
+	did := entries[0].DID
+
+	m := testMirror(t, "file::memory:", &fakeExport{entries: entries})
+	_, err := m.SyncOnce(ctx)
+	assert.NoError(err)
+
+	_, err = m.Document(ctx, did)
+	assert.ErrorIs(err, ErrDIDTombstoned)
+	// the audit log is still available
+	log, err := m.AuditLog(ctx, did)
+	assert.NoError(err)
+	assert.Len(log, 2)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+	assert.Equal(http.StatusGone, get("/"+did).Code)
+	assert.Equal(http.StatusOK, get("/"+did+"/log/audit").Code)
+	assert.Equal(http.StatusNotFound, get("/did:plc:aaaaaaaaaaaaaaaaaaaaaaaa").Code)
+	assert.Equal(http.StatusNotFound, get("/did:web:example.com").Code)
+	assert.Equal(http.StatusNotFound, get("/"+did+"/data").Code)
+}
@@ -3,6 +3,7 @@ package repo
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 
@@ -322,7 +323,7 @@ func (r *Repo) ForEach(ctx context.Context, prefix string, cb func(k string, v c
 	t := mst.LoadMST(r.cst, r.sc.Data)
 
 	if err := t.WalkLeavesFrom(ctx, prefix, cb); err != nil {
-		if err != ErrDoneIterating {
+		if !errors.Is(err, ErrDoneIterating) {
 			return err
 		}
 	}
@@ -357,6 +358,30 @@ func (r *Repo) GetRecord(ctx context.Context, rpath string) (cid.Cid, cbg.CBORMa
 	return cc, rec, nil
 }
 
+// DiffSince returns the records created ("add"), updated ("mut") and deleted ("del") between the commits at oldRoot and newRoot, sorted by path. Only the parts of the MST which changed between the two commits are read. If oldRoot is undefined, every record of newRoot is created.
+func DiffSince(ctx context.Context, bs blockstore.Blockstore, oldRoot, newRoot cid.Cid) ([]*mst.DiffOp, error) {
+	ctx, span := otel.Tracer("repo").Start(ctx, "DiffSince")
+	defer span.End()
+
+	cst := util.CborStore(bs)
+
+	var oldTree cid.Cid
+	if oldRoot.Defined() {
+		var sc SignedCommit
+		if err := cst.Get(ctx, oldRoot, &sc); err != nil {
+			return nil, fmt.Errorf("loading old commit: %w", err)
+		}
+		oldTree = sc.Data
+	}
+
+	var sc SignedCommit
+	if err := cst.Get(ctx, newRoot, &sc); err != nil {
+		return nil, fmt.Errorf("loading new commit: %w", err)
+	}
+
+	return mst.DiffTrees(ctx, bs, oldTree, sc.Data)
+}
+
 func (r *Repo) DiffSince(ctx context.Context, oldrepo cid.Cid) ([]*mst.DiffOp, error) {
 	ctx, span := otel.Tracer("repo").Start(ctx, "DiffSince")
 	defer span.End()
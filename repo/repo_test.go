@@ -1,12 +1,29 @@
 package repo
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"math/rand"
 	"os"
+	"slices"
+	"strings"
 	"testing"
 
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/mst"
+	"github.com/bluesky-social/indigo/util"
+
 	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	carv1 "github.com/ipld/go-car"
+	carutil "github.com/ipld/go-car/util"
 )
 
 func TestRepo(t *testing.T) {
@@ -30,3 +47,478 @@ func TestRepo(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestExportCollections(t *testing.T) {
+	ctx := context.TODO()
+
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	r := NewRepo(ctx, "did:plc:exporttest", bs)
+
+	// enough records for a tree a few levels deep
+	want := make(map[string]cid.Cid)
+	for i := 0; i < 300; i++ {
+		var coll string
+		var rec CborMarshaler
+		switch i % 3 {
+		case 0:
+			coll, rec = "app.bsky.feed.post", &appbsky.FeedPost{Text: fmt.Sprintf("post %d", i)}
+		case 1:
+			coll, rec = "app.bsky.feed.like", &appbsky.FeedLike{CreatedAt: fmt.Sprintf("like %d", i)}
+		default:
+			coll, rec = "app.bsky.graph.follow", &appbsky.GraphFollow{Subject: fmt.Sprintf("did:plc:follow%d", i)}
+		}
+		rc, rkey, err := r.CreateRecord(ctx, coll, rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if coll != "app.bsky.feed.like" {
+			want[coll+"/"+rkey] = rc
+		}
+	}
+
+	kmgr := &util.FakeKeyManager{}
+	root, _, err := r.Commit(ctx, kmgr.SignForUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = OpenRepo(ctx, bs, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := r.ExportCollections(ctx, []string{"app.bsky.graph.follow", "app.bsky.feed.post"}, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	full := new(bytes.Buffer)
+	if err := r.ExportCollections(ctx, []string{"app.bsky.feed.like", "app.bsky.feed.post", "app.bsky.graph.follow"}, full); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() >= full.Len() {
+		t.Fatalf("filtered export (%d bytes) isn't smaller than the full one (%d bytes)", buf.Len(), full.Len())
+	}
+
+	exp, err := ReadRepoFromCar(ctx, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp.SignedCommit().Did != "did:plc:exporttest" {
+		t.Fatalf("unexpected commit: %+v", exp.SignedCommit())
+	}
+
+	// the exported collections can be walked, and have all their records
+	for _, coll := range []string{"app.bsky.feed.post/", "app.bsky.graph.follow/"} {
+		if err := exp.ForEach(ctx, coll, func(k string, v cid.Cid) error {
+			if !strings.HasPrefix(k, coll) {
+				return ErrDoneIterating
+			}
+			if want[k] != v {
+				return fmt.Errorf("unexpected record %s: %s", k, v)
+			}
+			if _, _, err := exp.GetRecord(ctx, k); err != nil {
+				return err
+			}
+			delete(want, k)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(want) > 0 {
+		t.Fatalf("%d records missing from the export", len(want))
+	}
+
+	// the others can't
+	if err := exp.ForEach(ctx, "app.bsky.feed.like/", func(k string, v cid.Cid) error {
+		if !strings.HasPrefix(k, "app.bsky.feed.like/") {
+			return ErrDoneIterating
+		}
+		_, _, err := exp.GetRecord(ctx, k)
+		return err
+	}); err == nil {
+		t.Fatal("expected likes to be missing from the export")
+	}
+}
+
+func TestRepairMST(t *testing.T) {
+	ctx := context.TODO()
+
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	r := NewRepo(ctx, "did:plc:repairtest", bs)
+
+	var lost string
+	var lostCid cid.Cid
+	for i := 0; i < 100; i++ {
+		rc, rkey, err := r.CreateRecord(ctx, "app.bsky.feed.post", &appbsky.FeedPost{Text: fmt.Sprintf("post %d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 42 {
+			lost, lostCid = "app.bsky.feed.post/"+rkey, rc
+		}
+	}
+
+	kmgr := &util.FakeKeyManager{}
+	root, _, err := r.Commit(ctx, kmgr.SignForUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := VerifyMST(ctx, bs, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Leaves != 100 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+
+	if err := bs.DeleteBlock(ctx, lostCid); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = VerifyMST(ctx, bs, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 1 || report.Problems[0].Kind != mst.ProblemMissingRecord || report.Problems[0].Key != lost {
+		t.Fatalf("expected the missing record %s, got %v", lost, report.Problems)
+	}
+
+	r, err = OpenRepo(ctx, bs, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.RepairMST(ctx); err != nil {
+		t.Fatal(err)
+	}
+	root, _, err = r.Commit(ctx, kmgr.SignForUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err = VerifyMST(ctx, bs, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Leaves != 99 {
+		t.Fatalf("unexpected report after repair: %+v", report)
+	}
+}
+
+func TestDiffSince(t *testing.T) {
+	ctx := context.TODO()
+
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	r := NewRepo(ctx, "did:plc:difftest", bs)
+
+	var rkeys []string
+	for i := 0; i < 200; i++ {
+		_, rkey, err := r.CreateRecord(ctx, "app.bsky.feed.post", &appbsky.FeedPost{Text: fmt.Sprintf("post %d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		rkeys = append(rkeys, "app.bsky.feed.post/"+rkey)
+	}
+
+	kmgr := &util.FakeKeyManager{}
+	oldRoot, _, err := r.Commit(ctx, kmgr.SignForUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	created, _, err := r.CreateRecord(ctx, "app.bsky.feed.like", &appbsky.FeedLike{CreatedAt: "now"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteRecord(ctx, rkeys[10]); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := r.PutRecord(ctx, rkeys[10], &appbsky.FeedPost{Text: "edited"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.DeleteRecord(ctx, rkeys[100]); err != nil {
+		t.Fatal(err)
+	}
+
+	newRoot, _, err := r.Commit(ctx, kmgr.SignForUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops, err := DiffSince(ctx, bs, oldRoot, newRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string]*mst.DiffOp)
+	for _, op := range ops {
+		got[op.Op] = op
+	}
+	if len(ops) != 3 || len(got) != 3 {
+		t.Fatalf("expected one create, update and delete, got %d ops", len(ops))
+	}
+	if op := got["add"]; op.NewCid != created || !strings.HasPrefix(op.Rpath, "app.bsky.feed.like/") {
+		t.Fatalf("unexpected create: %+v", op)
+	}
+	if op := got["mut"]; op.NewCid != updated || op.Rpath != rkeys[10] {
+		t.Fatalf("unexpected update: %+v", op)
+	}
+	if op := got["del"]; op.Rpath != rkeys[100] || !op.OldCid.Defined() {
+		t.Fatalf("unexpected delete: %+v", op)
+	}
+
+	all, err := DiffSince(ctx, bs, cid.Undef, newRoot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 200 {
+		t.Fatalf("expected 200 records created since the start, got %d", len(all))
+	}
+}
+
+// Writes the blocks of the repo at root to a CAR file, in key order with nodes first, or else in the given order.
+func writeTestCar(t *testing.T, bs blockstore.Blockstore, root cid.Cid, order func([]cid.Cid)) []byte {
+	ctx := context.TODO()
+
+	var sc SignedCommit
+	if err := util.CborStore(bs).Get(ctx, root, &sc); err != nil {
+		t.Fatal(err)
+	}
+	cids := []cid.Cid{root}
+	if err := mst.LoadMST(util.CborStore(bs), sc.Data).WalkPrefix(ctx, "", func(c cid.Cid) error {
+		cids = append(cids, c)
+		return nil
+	}, func(_ string, c cid.Cid) error {
+		cids = append(cids, c)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if order != nil {
+		order(cids)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := carv1.WriteHeader(&carv1.CarHeader{Roots: []cid.Cid{root}, Version: 1}, buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cids {
+		blk, err := bs.Get(ctx, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := carutil.LdWrite(buf, c.Bytes(), blk.RawData()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestStreamReader(t *testing.T) {
+	ctx := context.TODO()
+
+	bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	r := NewRepo(ctx, "did:plc:streamtest", bs)
+
+	want := make(map[string]cid.Cid)
+	for i := 0; i < 300; i++ {
+		rc, rkey, err := r.CreateRecord(ctx, "app.bsky.feed.post", &appbsky.FeedPost{Text: fmt.Sprintf("post %d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want["app.bsky.feed.post/"+rkey] = rc
+	}
+
+	kmgr := &util.FakeKeyManager{}
+	root, rev, err := r.Commit(ctx, kmgr.SignForUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, order := range map[string]func([]cid.Cid){
+		"walk":     nil,
+		"reversed": func(cids []cid.Cid) { slices.Reverse(cids) },
+		"shuffled": func(cids []cid.Cid) {
+			rand.New(rand.NewSource(1)).Shuffle(len(cids), func(i, j int) { cids[i], cids[j] = cids[j], cids[i] })
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sr, err := NewStreamReader(bytes.NewReader(writeTestCar(t, bs, root, order)), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sc, err := sr.Commit(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sc.Rev != rev {
+				t.Fatalf("expected commit rev %s, got %s", rev, sc.Rev)
+			}
+
+			got := make(map[string]cid.Cid)
+			if err := sr.ForEach(ctx, func(path string, c cid.Cid, data []byte) error {
+				blk, err := bs.Get(ctx, c)
+				if err != nil {
+					return err
+				}
+				if !bytes.Equal(blk.RawData(), data) {
+					return fmt.Errorf("unexpected data for %s", path)
+				}
+				got[path] = c
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, want) {
+				t.Fatalf("expected %d records, got %d", len(want), len(got))
+			}
+		})
+	}
+
+	// a missing record
+	var missing cid.Cid
+	for _, c := range want {
+		missing = c
+		break
+	}
+	data := writeTestCar(t, bs, root, func(cids []cid.Cid) {
+		i := slices.Index(cids, missing)
+		copy(cids[i:], cids[i+1:])
+		cids[len(cids)-1] = root
+	})
+	sr, err := NewStreamReader(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sr.ForEach(ctx, func(string, cid.Cid, []byte) error { return nil }); err == nil || !strings.Contains(err.Error(), "missing 0 MST nodes and 1 records") {
+		t.Fatalf("expected a missing record, got: %v", err)
+	}
+
+	// the commit last, with little room to buffer what comes before it
+	sr, err = NewStreamReader(bytes.NewReader(writeTestCar(t, bs, root, func(cids []cid.Cid) {
+		i := slices.Index(cids, root)
+		cids[i], cids[len(cids)-1] = cids[len(cids)-1], cids[i]
+	})), &StreamOptions{MaxBuffered: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sr.Commit(ctx); !errors.Is(err, ErrStreamBufferFull) {
+		t.Fatalf("expected a full buffer, got: %v", err)
+	}
+}
+
+// Returns the identity it was given until purged, like a cache which hasn't seen a key rotation yet.
+type staleDirectory struct {
+	identity.MockDirectory
+	stale  *identity.Identity
+	purged int
+}
+
+func (d *staleDirectory) LookupDID(ctx context.Context, did syntax.DID) (*identity.Identity, error) {
+	if d.stale != nil {
+		return d.stale, nil
+	}
+	return d.MockDirectory.LookupDID(ctx, did)
+}
+
+func (d *staleDirectory) Purge(ctx context.Context, a syntax.AtIdentifier) error {
+	d.stale = nil
+	d.purged++
+	return nil
+}
+
+func testIdentity(t *testing.T, did string, priv crypto.PrivateKey) identity.Identity {
+	pub, err := priv.PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity.Identity{
+		DID: syntax.DID(did),
+		Keys: map[string]identity.Key{
+			"atproto": {
+				Type:               "Multikey",
+				PublicKeyMultibase: pub.Multibase(),
+			},
+		},
+	}
+}
+
+func TestVerifyCommitSignature(t *testing.T) {
+	ctx := context.TODO()
+
+	p256, err := crypto.GeneratePrivateKeyP256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k256, err := crypto.GeneratePrivateKeyK256()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string]crypto.PrivateKey{"p256": p256, "k256": k256}
+
+	for name, priv := range keys {
+		t.Run(name, func(t *testing.T) {
+			did := "did:plc:sig" + name
+			bs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+			r := NewRepo(ctx, did, bs)
+			if _, _, err := r.CreateRecord(ctx, "app.bsky.feed.post", &appbsky.FeedPost{Text: "signed"}); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := r.Commit(ctx, KeySigner(priv)); err != nil {
+				t.Fatal(err)
+			}
+			sc := r.SignedCommit()
+
+			dir := &staleDirectory{MockDirectory: identity.NewMockDirectory()}
+			dir.Insert(testIdentity(t, did, priv))
+			if err := VerifyCommitSignature(ctx, dir, &sc); err != nil {
+				t.Fatal(err)
+			}
+			// from the key cache this time
+			if err := VerifyCommitSignature(ctx, dir, &sc); err != nil {
+				t.Fatal(err)
+			}
+			if dir.purged != 0 {
+				t.Fatalf("directory purged %d times for a valid signature", dir.purged)
+			}
+
+			// the DID rotated to this key after the directory cached it
+			var other crypto.PrivateKey = k256
+			if name == "k256" {
+				other = p256
+			}
+			old := testIdentity(t, did, other)
+			dir.stale = &old
+			if err := VerifyCommitSignature(ctx, dir, &sc); err != nil {
+				t.Fatalf("signature not verified after the key rotation: %s", err)
+			}
+			if dir.purged != 1 {
+				t.Fatalf("directory purged %d times, expected once", dir.purged)
+			}
+
+			// signed with another key than the current one
+			wrong := mockDirectory(t, did, other)
+			err := VerifyCommitSignature(ctx, wrong, &sc)
+			if !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("expected ErrInvalidSignature, got %v", err)
+			}
+
+			tampered := sc
+			tampered.Sig = slices.Clone(sc.Sig)
+			tampered.Sig[0] ^= 0xff
+			if err := VerifyCommitSignature(ctx, dir, &tampered); !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("expected ErrInvalidSignature for a tampered signature, got %v", err)
+			}
+		})
+	}
+}
+
+func mockDirectory(t *testing.T, did string, priv crypto.PrivateKey) identity.Directory {
+	dir := identity.NewMockDirectory()
+	dir.Insert(testIdentity(t, did, priv))
+	return &dir
+}
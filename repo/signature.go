@@ -0,0 +1,99 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"go.opentelemetry.io/otel"
+)
+
+// ErrInvalidSignature is returned by VerifyCommitSignature when the signature of a commit doesn't match the signing key of its DID.
+var ErrInvalidSignature = errors.New("invalid commit signature")
+
+// Parsed signing keys, by their representation in DID documents, as parsing is relatively costly (K-256 keys in particular) and directories don't always keep the parsed key of an identity.
+var parsedKeys, _ = lru.New[string, crypto.PublicKey](100_000)
+
+// VerifyCommitSignature checks the signature of a commit against the repo signing key of its DID, resolved with dir. Both P-256 and K-256 keys are supported. If the signature doesn't match, the DID is purged from dir and resolved once more, in case the key was rotated since it was cached.
+func VerifyCommitSignature(ctx context.Context, dir identity.Directory, commit *SignedCommit) error {
+	ctx, span := otel.Tracer("repo").Start(ctx, "VerifyCommitSignature")
+	defer span.End()
+
+	did, err := syntax.ParseDID(commit.Did)
+	if err != nil {
+		return fmt.Errorf("commit has an invalid DID: %w", err)
+	}
+
+	sb, err := commit.Unsigned().BytesForSigning()
+	if err != nil {
+		return fmt.Errorf("commit serialization failed: %w", err)
+	}
+
+	err = verifyWithDirectory(ctx, dir, did, sb, commit.Sig)
+	if err == nil || !errors.Is(err, ErrInvalidSignature) && !errors.Is(err, identity.ErrKeyNotDeclared) {
+		return err
+	}
+
+	if perr := dir.Purge(ctx, did.AtIdentifier()); perr != nil {
+		return err
+	}
+	return verifyWithDirectory(ctx, dir, did, sb, commit.Sig)
+}
+
+func verifyWithDirectory(ctx context.Context, dir identity.Directory, did syntax.DID, msg, sig []byte) error {
+	ident, err := dir.LookupDID(ctx, did)
+	if err != nil {
+		return fmt.Errorf("resolving %s: %w", did, err)
+	}
+
+	pub, err := signingKey(ident)
+	if err != nil {
+		return fmt.Errorf("signing key of %s: %w", did, err)
+	}
+
+	if err := pub.HashAndVerify(msg, sig); err != nil {
+		return fmt.Errorf("%w (key %s of %s): %s", ErrInvalidSignature, pub.DIDKey(), did, err)
+	}
+	return nil
+}
+
+// Returns the parsed repo signing key of an identity, from the cache if possible.
+func signingKey(ident *identity.Identity) (crypto.PublicKey, error) {
+	if ident.ParsedPublicKey != nil {
+		return ident.ParsedPublicKey, nil
+	}
+
+	k, ok := ident.Keys["atproto"]
+	if !ok {
+		return nil, identity.ErrKeyNotDeclared
+	}
+	ck := k.Type + ":" + k.PublicKeyMultibase
+	if pub, ok := parsedKeys.Get(ck); ok {
+		return pub, nil
+	}
+
+	pub, err := ident.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	parsedKeys.Add(ck, pub)
+	return pub, nil
+}
+
+// KeySigner returns a signer for Repo.Commit which signs with a private key, of any supported type.
+func KeySigner(priv crypto.PrivateKey) func(context.Context, string, []byte) ([]byte, error) {
+	return func(_ context.Context, _ string, msg []byte) ([]byte, error) {
+		return priv.HashAndSign(msg)
+	}
+}
+
+// SignerFunc returns a signer for Repo.Commit which signs with a crypto.Signer, eg for a signing key held in an HSM or KMS.
+func SignerFunc(signer crypto.Signer) func(context.Context, string, []byte) ([]byte, error) {
+	return func(ctx context.Context, _ string, msg []byte) ([]byte, error) {
+		return signer.HashAndSign(ctx, msg)
+	}
+}
@@ -0,0 +1,244 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/bluesky-social/indigo/mst"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrStreamBufferFull is returned by StreamReader when more than MaxBuffered bytes of blocks come before the nodes pointing to them.
+var ErrStreamBufferFull = errors.New("too many blocks buffered before being reached from the commit")
+
+type StreamOptions struct {
+	// Maximum total size of the blocks held until the tree reaches them, as a CAR file may have its blocks in any order
+	MaxBuffered int
+}
+
+func DefaultStreamOptions() *StreamOptions {
+	return &StreamOptions{
+		MaxBuffered: 128 << 20,
+	}
+}
+
+// StreamReader reads a repo from a CAR file block by block, as opposed to ReadRepoFromCar which loads all of it in memory first. Each block is checked against its CID, and records are handed out as soon as the MST nodes leading to them from the commit have been read, so only the blocks which come too early, and the paths of the records yet to be read, are kept in memory.
+type StreamReader struct {
+	br   *car.BlockReader
+	opts *StreamOptions
+
+	commit *SignedCommit
+
+	// blocks read before the tree reached them
+	pending     map[cid.Cid]blocks.Block
+	pendingSize int
+
+	// reached from the commit, and not read yet
+	nodes   map[cid.Cid]bool
+	records map[cid.Cid][]string
+	// records handed out, in case the tree reaches them again under another path
+	read map[cid.Cid]bool
+
+	// records handed out
+	count int
+}
+
+func NewStreamReader(r io.Reader, opts *StreamOptions) (*StreamReader, error) {
+	if opts == nil {
+		opts = DefaultStreamOptions()
+	}
+
+	br, err := car.NewBlockReader(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(br.Roots) == 0 {
+		return nil, fmt.Errorf("CAR file has no root")
+	}
+
+	return &StreamReader{
+		br:      br,
+		opts:    opts,
+		pending: make(map[cid.Cid]blocks.Block),
+		nodes:   make(map[cid.Cid]bool),
+		records: make(map[cid.Cid][]string),
+		read:    make(map[cid.Cid]bool),
+	}, nil
+}
+
+// Commit reads the CAR file up to the signed commit at its root, and returns it.
+func (sr *StreamReader) Commit(ctx context.Context) (*SignedCommit, error) {
+	if sr.commit != nil {
+		return sr.commit, nil
+	}
+
+	root := sr.br.Roots[0]
+	for {
+		blk, ok := sr.pending[root]
+		if ok {
+			sr.unbuffer(root)
+		} else {
+			var err error
+			blk, err = sr.next(ctx)
+			if err != nil {
+				if err == io.EOF {
+					return nil, fmt.Errorf("commit %s not found in CAR file", root)
+				}
+				return nil, err
+			}
+			if blk.Cid() != root {
+				if err := sr.buffer(blk); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+
+		var sc SignedCommit
+		if err := sc.UnmarshalCBOR(bytes.NewReader(blk.RawData())); err != nil {
+			return nil, fmt.Errorf("decoding commit: %w", err)
+		}
+		if sc.Version != ATP_REPO_VERSION && sc.Version != ATP_REPO_VERSION_2 {
+			return nil, fmt.Errorf("unsupported repo version: %d", sc.Version)
+		}
+
+		sr.commit = &sc
+		sr.nodes[sc.Data] = true
+		return sr.commit, nil
+	}
+}
+
+// ForEach reads the rest of the CAR file, calling cb with each record of the repo, in the order of the file rather than in key order. A record under several paths is handed out once for each, but with nil data for the paths reached after the record was read, as it isn't kept; its data is that of the earlier call with the same CID. It fails if the file ends before every record of the repo was read.
+func (sr *StreamReader) ForEach(ctx context.Context, cb func(path string, c cid.Cid, data []byte) error) error {
+	ctx, span := otel.Tracer("repo").Start(ctx, "StreamForEach")
+	defer span.End()
+
+	sc, err := sr.Commit(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the root node may have come before the commit
+	if err := sr.reached(ctx, sc.Data, cb); err != nil {
+		return err
+	}
+
+	for len(sr.nodes) > 0 || len(sr.records) > 0 {
+		blk, err := sr.next(ctx)
+		if err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("CAR file is missing %d MST nodes and %d records of the repo", len(sr.nodes), len(sr.records))
+			}
+			return err
+		}
+
+		if err := sr.handle(ctx, blk, cb); err != nil {
+			return err
+		}
+	}
+
+	span.SetAttributes(attribute.Int("records", sr.count))
+	return nil
+}
+
+func (sr *StreamReader) next(ctx context.Context) (blocks.Block, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	blk, err := sr.br.Next()
+	if err != nil {
+		return nil, err
+	}
+
+	sum, err := blk.Cid().Prefix().Sum(blk.RawData())
+	if err != nil {
+		return nil, fmt.Errorf("hashing block %s: %w", blk.Cid(), err)
+	}
+	if !sum.Equals(blk.Cid()) {
+		return nil, fmt.Errorf("block %s does not match its CID", blk.Cid())
+	}
+	return blk, nil
+}
+
+func (sr *StreamReader) buffer(blk blocks.Block) error {
+	if _, ok := sr.pending[blk.Cid()]; ok {
+		return nil
+	}
+	if sr.pendingSize+len(blk.RawData()) > sr.opts.MaxBuffered {
+		return ErrStreamBufferFull
+	}
+	sr.pending[blk.Cid()] = blk
+	sr.pendingSize += len(blk.RawData())
+	return nil
+}
+
+func (sr *StreamReader) unbuffer(c cid.Cid) {
+	sr.pendingSize -= len(sr.pending[c].RawData())
+	delete(sr.pending, c)
+}
+
+// Handles a block which was just read: a node or record the tree reached, or else one to keep until it does. Blocks which are never reached, like those of older commits, are only dropped at the end.
+func (sr *StreamReader) handle(ctx context.Context, blk blocks.Block, cb func(path string, c cid.Cid, data []byte) error) error {
+	c := blk.Cid()
+
+	if paths, ok := sr.records[c]; ok {
+		delete(sr.records, c)
+		sr.read[c] = true
+		for _, p := range paths {
+			sr.count++
+			if err := cb(p, c, blk.RawData()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if sr.nodes[c] {
+		delete(sr.nodes, c)
+
+		leaves, subtrees, err := mst.DecodeNode(blk.RawData())
+		if err != nil {
+			return fmt.Errorf("node %s: %w", c, err)
+		}
+		for _, l := range leaves {
+			if sr.read[l.Val] {
+				sr.count++
+				if err := cb(l.Key, l.Val, nil); err != nil {
+					return err
+				}
+				continue
+			}
+			sr.records[l.Val] = append(sr.records[l.Val], l.Key)
+			if err := sr.reached(ctx, l.Val, cb); err != nil {
+				return err
+			}
+		}
+		for _, st := range subtrees {
+			sr.nodes[st] = true
+			if err := sr.reached(ctx, st, cb); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return sr.buffer(blk)
+}
+
+// Handles the block with a CID the tree just reached, if it was read already.
+func (sr *StreamReader) reached(ctx context.Context, c cid.Cid, cb func(path string, c cid.Cid, data []byte) error) error {
+	blk, ok := sr.pending[c]
+	if !ok {
+		return nil
+	}
+	sr.unbuffer(c)
+	return sr.handle(ctx, blk, cb)
+}
@@ -0,0 +1,37 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bluesky-social/indigo/mst"
+	"github.com/bluesky-social/indigo/util"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// VerifyMST checks the structure of the MST of the repo at a commit, and that the record of every leaf is present and matches its CID. See mst.VerifyTree for what is checked.
+func VerifyMST(ctx context.Context, bs blockstore.Blockstore, root cid.Cid) (*mst.VerifyReport, error) {
+	var sc SignedCommit
+	if err := util.CborStore(bs).Get(ctx, root, &sc); err != nil {
+		return nil, fmt.Errorf("loading commit: %w", err)
+	}
+
+	return mst.VerifyTree(ctx, bs, sc.Data, &mst.VerifyOptions{CheckRecords: true})
+}
+
+// RepairMST replaces the MST of the repo with one rebuilt from the records which can still be reached from it, dropping those which are missing or corrupt, and returns the problems found in the old one. The repaired tree is part of the next Commit.
+func (r *Repo) RepairMST(ctx context.Context) (*mst.VerifyReport, error) {
+	if !r.sc.Data.Defined() {
+		return nil, fmt.Errorf("repo has no tree to repair")
+	}
+
+	t, report, err := mst.RebuildTree(ctx, r.bs, r.sc.Data, &mst.VerifyOptions{CheckRecords: true})
+	if err != nil {
+		return nil, err
+	}
+
+	r.mst = t
+	r.dirty = true
+	return report, nil
+}
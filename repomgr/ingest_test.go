@@ -12,10 +12,12 @@ import (
 	atproto "github.com/bluesky-social/indigo/api/atproto"
 	bsky "github.com/bluesky-social/indigo/api/bsky"
 	"github.com/bluesky-social/indigo/carstore"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
 	"github.com/bluesky-social/indigo/models"
 	"github.com/bluesky-social/indigo/repo"
 	"github.com/bluesky-social/indigo/util"
 	"github.com/ipfs/go-cid"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -119,12 +121,13 @@ func TestIngestWithGap(t *testing.T) {
 	var since *string
 	ctx := context.TODO()
 	for i := 0; i < 5; i++ {
-		slice, _, nrev, tid := doPost(t, cs2, did, since, i)
+		slice, rc, nrev, tid := doPost(t, cs2, did, since, i)
 
 		ops := []*atproto.SyncSubscribeRepos_RepoOp{
 			{
 				Action: "create",
 				Path:   "app.bsky.feed.post/" + tid,
+				Cid:    (*lexutil.LexLink)(&rc),
 			},
 		}
 
@@ -151,6 +154,7 @@ func TestIngestWithGap(t *testing.T) {
 	}
 }
 
+// Creates a post in the repo, returning the slice of the commit, the cid of the post, the new rev and the rkey of the post.
 func doPost(t *testing.T, cs *carstore.CarStore, did string, prev *string, postid int) ([]byte, cid.Cid, string, string) {
 	ctx := context.TODO()
 	ds, err := cs.NewDeltaSession(ctx, 1, prev)
@@ -158,9 +162,21 @@ func doPost(t *testing.T, cs *carstore.CarStore, did string, prev *string, posti
 		t.Fatal(err)
 	}
 
-	r := repo.NewRepo(ctx, did, ds)
+	var r *repo.Repo
+	if prev == nil {
+		r = repo.NewRepo(ctx, did, ds)
+	} else {
+		head, err := cs.GetUserRepoHead(ctx, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err = repo.OpenRepo(ctx, ds, head)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
 
-	_, tid, err := r.CreateRecord(ctx, "app.bsky.feed.post", &bsky.FeedPost{
+	rc, tid, err := r.CreateRecord(ctx, "app.bsky.feed.post", &bsky.FeedPost{
 		Text: fmt.Sprintf("hello friend %d", postid),
 	})
 	if err != nil {
@@ -177,7 +193,78 @@ func doPost(t *testing.T, cs *carstore.CarStore, did string, prev *string, posti
 		t.Fatal(err)
 	}
 
-	return slice, root, nrev, tid
+	return slice, rc, nrev, tid
+}
+
+func TestIngestRejectsMismatchedOps(t *testing.T) {
+	dir := t.TempDir()
+	cs := testCarstore(t, dir)
+	repoman := NewRepoManager(cs, &util.FakeKeyManager{})
+	repoman.SetStrictCommitOps(true)
+
+	dir2 := t.TempDir()
+	cs2 := testCarstore(t, dir2)
+
+	did := "did:plc:beepboop"
+	ctx := context.TODO()
+
+	slice, rc, nrev, tid := doPost(t, cs2, did, nil, 0)
+	if err := repoman.HandleExternalUserEvent(ctx, 1, 1, did, nil, nrev, slice, []*atproto.SyncSubscribeRepos_RepoOp{
+		{Action: "create", Path: "app.bsky.feed.post/" + tid, Cid: (*lexutil.LexLink)(&rc)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	since := nrev
+
+	// an op for a record which the commit doesn't touch
+	slice, rc, nrev, tid = doPost(t, cs2, did, &since, 1)
+	err := repoman.HandleExternalUserEvent(ctx, 1, 1, did, &since, nrev, slice, []*atproto.SyncSubscribeRepos_RepoOp{
+		{Action: "create", Path: "app.bsky.feed.post/" + tid, Cid: (*lexutil.LexLink)(&rc)},
+		{Action: "delete", Path: "app.bsky.feed.post/3kaaaaaaaaaaa"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "validating commit ops") {
+		t.Fatalf("expected commit ops validation to fail, got: %v", err)
+	}
+
+	// the same commit, with its actual ops
+	if err := repoman.HandleExternalUserEvent(ctx, 1, 1, did, &since, nrev, slice, []*atproto.SyncSubscribeRepos_RepoOp{
+		{Action: "create", Path: "app.bsky.feed.post/" + tid, Cid: (*lexutil.LexLink)(&rc)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIngestCountsMismatchedOps(t *testing.T) {
+	dir := t.TempDir()
+	cs := testCarstore(t, dir)
+	repoman := NewRepoManager(cs, &util.FakeKeyManager{})
+
+	dir2 := t.TempDir()
+	cs2 := testCarstore(t, dir2)
+
+	did := "did:plc:beepboop"
+	ctx := context.TODO()
+
+	slice, rc, nrev, tid := doPost(t, cs2, did, nil, 0)
+	if err := repoman.HandleExternalUserEvent(ctx, 1, 1, did, nil, nrev, slice, []*atproto.SyncSubscribeRepos_RepoOp{
+		{Action: "create", Path: "app.bsky.feed.post/" + tid, Cid: (*lexutil.LexLink)(&rc)},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	since := nrev
+
+	// without strict checking, mismatched ops are counted but the commit is still accepted
+	before := testutil.ToFloat64(commitOpsMismatches)
+	slice, rc, nrev, tid = doPost(t, cs2, did, &since, 1)
+	if err := repoman.HandleExternalUserEvent(ctx, 1, 1, did, &since, nrev, slice, []*atproto.SyncSubscribeRepos_RepoOp{
+		{Action: "create", Path: "app.bsky.feed.post/" + tid, Cid: (*lexutil.LexLink)(&rc)},
+		{Action: "delete", Path: "app.bsky.feed.post/3kaaaaaaaaaaa"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := testutil.ToFloat64(commitOpsMismatches); got != before+1 {
+		t.Fatalf("expected mismatch to be counted, got %v (was %v)", got, before)
+	}
 }
 
 func TestDuplicateRecord(t *testing.T) {
@@ -9,3 +9,8 @@ var repoOpsImported = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "repomgr_repo_ops_imported",
 	Help: "Number of repo ops imported",
 })
+
+var commitOpsMismatches = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "repomgr_commit_ops_mismatches",
+	Help: "Number of external commits whose ops don't match the changes to the repo (rejected if strict commit op checking is enabled)",
+})
@@ -0,0 +1,255 @@
+package repomgr
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	atproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/carstore"
+	lexutil "github.com/bluesky-social/indigo/lex/util"
+	"github.com/bluesky-social/indigo/models"
+	"github.com/bluesky-social/indigo/mst"
+	"github.com/bluesky-social/indigo/repo"
+	"github.com/bluesky-social/indigo/util"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ErrNonArchival is returned when reading repos from a RepoManager in non-archival mode.
+var ErrNonArchival = errors.New("repo data is not kept in non-archival mode")
+
+// SetNonArchival switches the RepoManager to non-archival mode: instead of storing repos in the carstore, it only tracks the head commit of each repo in cs. External commits are still validated and re-emitted, but repos and records can't be read anymore, and local repos can't be written. Data already in the carstore is left as is.
+func (rm *RepoManager) SetNonArchival(cs *carstore.NonArchivalCarstore) {
+	rm.noArchive = cs
+}
+
+// NonArchival returns whether the RepoManager is in non-archival mode.
+func (rm *RepoManager) NonArchival() bool {
+	return rm.noArchive != nil
+}
+
+// Reads the blocks of a CAR file into memory, and returns its root.
+func loadCarSlice(ctx context.Context, r io.Reader) (cid.Cid, blockstore.Blockstore, error) {
+	membs := blockstore.NewBlockstore(datastore.NewMapDatastore())
+	root, err := repo.IngestRepo(ctx, membs, r)
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("reading car slice: %w", err)
+	}
+	return root, membs, nil
+}
+
+// Checks the commit of an external event against the head of the repo, and the ops of the event against the commit, which only requires the blocks of the event.
+func (rm *RepoManager) handleExternalUserEventNoArchive(ctx context.Context, pdsid uint, uid models.Uid, did string, since *string, nrev string, carslice []byte, ops []*atproto.SyncSubscribeRepos_RepoOp) error {
+	ctx, span := otel.Tracer("repoman").Start(ctx, "HandleExternalUserEventNoArchive")
+	defer span.End()
+
+	span.SetAttributes(attribute.Int64("uid", int64(uid)))
+
+	log.Debugw("HandleExternalUserEventNoArchive", "pds", pdsid, "uid", uid, "since", since, "nrev", nrev)
+
+	unlock := rm.lockUser(ctx, uid)
+	defer unlock()
+
+	root, bs, err := loadCarSlice(ctx, bytes.NewReader(carslice))
+	if err != nil {
+		return fmt.Errorf("importing external carslice: %w", err)
+	}
+
+	r, err := repo.OpenRepo(ctx, bs, root)
+	if err != nil {
+		return fmt.Errorf("opening external user repo (%d, root=%s): %w", uid, root, err)
+	}
+
+	if err := rm.CheckRepoSig(ctx, r, did); err != nil {
+		return err
+	}
+
+	if rev := r.SignedCommit().Rev; rev != nrev {
+		return fmt.Errorf("commit rev (%s) does not match event rev (%s)", rev, nrev)
+	}
+
+	currev, err := rm.noArchive.GetUserRepoRev(ctx, uid)
+	if err != nil {
+		return err
+	}
+	// with no known head, the commit is accepted as is
+	if currev != "" {
+		if nrev <= currev {
+			return fmt.Errorf("commit rev (%s) is not newer than the current rev (%s)", nrev, currev)
+		}
+		if since != nil && *since != currev {
+			return fmt.Errorf("revision mismatch: %s != %s: %w", *since, currev, carstore.ErrRepoBaseMismatch)
+		}
+	}
+
+	tree := mst.LoadMST(util.CborStore(bs), r.DataCid())
+
+	var evtops []RepoOp
+	for _, op := range ops {
+		parts := strings.SplitN(op.Path, "/", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid rpath in mst diff, must have collection and rkey")
+		}
+
+		switch EventKind(op.Action) {
+		case EvtKindCreateRecord, EvtKindUpdateRecord:
+			// the record must be in the tree of the signed commit
+			reccid, err := tree.Get(ctx, op.Path)
+			if err != nil {
+				return fmt.Errorf("resolving changed record in car slice: %w", err)
+			}
+			if op.Cid != nil && cid.Cid(*op.Cid) != reccid {
+				return fmt.Errorf("record cid of %s op for %s does not match the commit (%s != %s)", op.Action, op.Path, cid.Cid(*op.Cid), reccid)
+			}
+
+			rop := RepoOp{
+				Kind:       EventKind(op.Action),
+				Collection: parts[0],
+				Rkey:       parts[1],
+				RecCid:     &reccid,
+			}
+
+			blk, err := bs.Get(ctx, reccid)
+			if err != nil {
+				return fmt.Errorf("reading changed record from car slice: %w", err)
+			}
+			if rm.hydrateRecords {
+				rec, err := lexutil.CborDecodeValue(blk.RawData())
+				if err != nil {
+					return fmt.Errorf("decoding changed record from car slice: %w", err)
+				}
+				rop.Record = rec
+			}
+
+			evtops = append(evtops, rop)
+		case EvtKindDeleteRecord:
+			// the previous tree isn't kept, so deletions can't be checked
+			evtops = append(evtops, RepoOp{
+				Kind:       EvtKindDeleteRecord,
+				Collection: parts[0],
+				Rkey:       parts[1],
+			})
+		default:
+			return fmt.Errorf("unrecognized external user event kind: %q", op.Action)
+		}
+	}
+
+	if err := rm.noArchive.UpdateUserRepoHead(ctx, uid, root, nrev); err != nil {
+		return err
+	}
+
+	if rm.events != nil {
+		rm.events(ctx, &RepoEvent{
+			User:      uid,
+			NewRoot:   root,
+			Rev:       nrev,
+			Since:     since,
+			Ops:       evtops,
+			RepoSlice: carslice,
+			PDS:       pdsid,
+		})
+	}
+
+	return nil
+}
+
+// Imports a repo fetched from its PDS: a full repo is re-emitted as creations of all of its records, but a partial one (since rev) can't be diffed without the previous tree, and is re-emitted as a "too big" commit, for consumers to fetch the repo.
+func (rm *RepoManager) importNewRepoNoArchive(ctx context.Context, user models.Uid, repoDid string, r io.Reader, rev *string) error {
+	ctx, span := otel.Tracer("repoman").Start(ctx, "ImportNewRepoNoArchive")
+	defer span.End()
+
+	unlock := rm.lockUser(ctx, user)
+	defer unlock()
+
+	currev, err := rm.noArchive.GetUserRepoRev(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	if rev != nil && *rev != currev {
+		return fmt.Errorf("ImportNewRepo called with incorrect base")
+	}
+	partial := rev != nil && *rev != ""
+
+	carslice, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	root, bs, err := loadCarSlice(ctx, bytes.NewReader(carslice))
+	if err != nil {
+		return err
+	}
+
+	nr, err := repo.OpenRepo(ctx, bs, root)
+	if err != nil {
+		return fmt.Errorf("opening new repo: %w", err)
+	}
+
+	if err := rm.CheckRepoSig(ctx, nr, repoDid); err != nil {
+		return fmt.Errorf("new user signature check failed: %w", err)
+	}
+
+	nrev := nr.SignedCommit().Rev
+	if currev != "" && nrev <= currev {
+		if nrev == currev {
+			// nothing new
+			return nil
+		}
+		return fmt.Errorf("imported repo rev (%s) is older than the current rev (%s)", nrev, currev)
+	}
+
+	var ops []RepoOp
+	if !partial {
+		diffops, err := nr.DiffSince(ctx, cid.Undef)
+		if err != nil {
+			return fmt.Errorf("walking new repo: %w", err)
+		}
+
+		for _, op := range diffops {
+			repoOpsImported.Inc()
+			out, err := processOp(ctx, bs, op, rm.hydrateRecords)
+			if err != nil {
+				log.Errorw("failed to process repo op", "err", err, "path", op.Rpath, "repo", repoDid)
+			}
+
+			if out != nil {
+				ops = append(ops, *out)
+			}
+		}
+	}
+
+	if err := rm.noArchive.UpdateUserRepoHead(ctx, user, root, nrev); err != nil {
+		return err
+	}
+
+	if rm.events != nil {
+		rm.events(ctx, &RepoEvent{
+			User:      user,
+			NewRoot:   root,
+			Rev:       nrev,
+			Since:     &currev,
+			RepoSlice: carslice,
+			Ops:       ops,
+			TooBig:    partial,
+		})
+	}
+
+	return nil
+}
+
+// PruneArchivedRepo deletes the data of a repo stored in the carstore before switching to non-archival mode, keeping its head.
+func (rm *RepoManager) PruneArchivedRepo(ctx context.Context, uid models.Uid) error {
+	unlock := rm.lockUser(ctx, uid)
+	defer unlock()
+
+	return rm.cs.WipeUserData(ctx, uid)
+}
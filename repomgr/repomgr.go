@@ -11,6 +11,7 @@ import (
 
 	atproto "github.com/bluesky-social/indigo/api/atproto"
 	bsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/carstore"
 	lexutil "github.com/bluesky-social/indigo/lex/util"
 	"github.com/bluesky-social/indigo/models"
@@ -33,7 +34,7 @@ import (
 
 var log = logging.Logger("repomgr")
 
-func NewRepoManager(cs *carstore.CarStore, kmgr KeyManager) *RepoManager {
+func NewRepoManager(cs carstore.Store, kmgr KeyManager) *RepoManager {
 
 	return &RepoManager{
 		cs:        cs,
@@ -52,15 +53,33 @@ func (rm *RepoManager) SetEventHandler(cb func(context.Context, *RepoEvent), hyd
 	rm.hydrateRecords = hydrateRecords
 }
 
+// SetDirectory makes the RepoManager check the signatures of the commits it ingests with repo.VerifyCommitSignature, resolving signing keys with dir, rather than with its KeyManager.
+func (rm *RepoManager) SetDirectory(dir identity.Directory) {
+	rm.dir = dir
+}
+
+// SetStrictCommitOps makes HandleExternalUserEvent reject commits whose ops don't exactly match the changes to the repo. By default, mismatches are only logged and counted.
+func (rm *RepoManager) SetStrictCommitOps(strict bool) {
+	rm.strictCommitOps = strict
+}
+
 type RepoManager struct {
-	cs   *carstore.CarStore
+	cs   carstore.Store
 	kmgr KeyManager
+	// if set, used to check commit signatures instead of kmgr
+	dir identity.Directory
 
 	lklk      sync.Mutex
 	userLocks map[models.Uid]*userLock
 
 	events         func(context.Context, *RepoEvent)
 	hydrateRecords bool
+
+	// set in non-archival mode, see SetNonArchival
+	noArchive *carstore.NonArchivalCarstore
+
+	// reject external commits whose ops don't match the repo diff, see SetStrictCommitOps
+	strictCommitOps bool
 }
 
 type ActorInfo struct {
@@ -79,6 +98,8 @@ type RepoEvent struct {
 	RepoSlice []byte
 	PDS       uint
 	Ops       []RepoOp
+	// Set if Ops doesn't list the changes of the commit, for consumers to fetch the repo instead
+	TooBig bool
 }
 
 type RepoOp struct {
@@ -140,7 +161,7 @@ func (rm *RepoManager) lockUser(ctx context.Context, user models.Uid) func() {
 	}
 }
 
-func (rm *RepoManager) CarStore() *carstore.CarStore {
+func (rm *RepoManager) CarStore() carstore.Store {
 	return rm.cs
 }
 
@@ -407,6 +428,9 @@ func (rm *RepoManager) GetRepoRoot(ctx context.Context, user models.Uid) (cid.Ci
 	unlock := rm.lockUser(ctx, user)
 	defer unlock()
 
+	if rm.noArchive != nil {
+		return rm.noArchive.GetUserRepoHead(ctx, user)
+	}
 	return rm.cs.GetUserRepoHead(ctx, user)
 }
 
@@ -414,14 +438,24 @@ func (rm *RepoManager) GetRepoRev(ctx context.Context, user models.Uid) (string,
 	unlock := rm.lockUser(ctx, user)
 	defer unlock()
 
+	if rm.noArchive != nil {
+		return rm.noArchive.GetUserRepoRev(ctx, user)
+	}
 	return rm.cs.GetUserRepoRev(ctx, user)
 }
 
 func (rm *RepoManager) ReadRepo(ctx context.Context, user models.Uid, since string, w io.Writer) error {
+	if rm.noArchive != nil {
+		return ErrNonArchival
+	}
 	return rm.cs.ReadUserCar(ctx, user, since, true, w)
 }
 
 func (rm *RepoManager) GetRecord(ctx context.Context, user models.Uid, collection string, rkey string, maybeCid cid.Cid) (cid.Cid, cbg.CBORMarshaler, error) {
+	if rm.noArchive != nil {
+		return cid.Undef, nil, ErrNonArchival
+	}
+
 	bs, err := rm.cs.ReadOnlySession(user)
 	if err != nil {
 		return cid.Undef, nil, err
@@ -450,6 +484,10 @@ func (rm *RepoManager) GetRecord(ctx context.Context, user models.Uid, collectio
 }
 
 func (rm *RepoManager) GetRecordProof(ctx context.Context, user models.Uid, collection string, rkey string) (cid.Cid, []blocks.Block, error) {
+	if rm.noArchive != nil {
+		return cid.Undef, nil, ErrNonArchival
+	}
+
 	robs, err := rm.cs.ReadOnlySession(user)
 	if err != nil {
 		return cid.Undef, nil, err
@@ -476,6 +514,10 @@ func (rm *RepoManager) GetRecordProof(ctx context.Context, user models.Uid, coll
 }
 
 func (rm *RepoManager) GetProfile(ctx context.Context, uid models.Uid) (*bsky.ActorProfile, error) {
+	if rm.noArchive != nil {
+		return nil, ErrNonArchival
+	}
+
 	bs, err := rm.cs.ReadOnlySession(uid)
 	if err != nil {
 		return nil, err
@@ -504,6 +546,50 @@ func (rm *RepoManager) GetProfile(ctx context.Context, uid models.Uid) (*bsky.Ac
 	return ap, nil
 }
 
+// Checks that the ops of a commit are exactly the changes to the records of the repo since the previous commit.
+func checkCommitOps(ctx context.Context, bs blockstore.Blockstore, oldRoot, newRoot cid.Cid, ops []*atproto.SyncSubscribeRepos_RepoOp) error {
+	diff, err := repo.DiffSince(ctx, bs, oldRoot, newRoot)
+	if err != nil {
+		return fmt.Errorf("diffing against previous commit: %w", err)
+	}
+
+	changes := make(map[string]*mst.DiffOp, len(diff))
+	for _, d := range diff {
+		changes[d.Rpath] = d
+	}
+
+	for _, op := range ops {
+		d, ok := changes[op.Path]
+		if !ok {
+			return fmt.Errorf("%s op on %s does not match a change in the repo", op.Action, op.Path)
+		}
+		delete(changes, op.Path)
+
+		var want string
+		switch EventKind(op.Action) {
+		case EvtKindCreateRecord:
+			want = "add"
+		case EvtKindUpdateRecord:
+			want = "mut"
+		case EvtKindDeleteRecord:
+			want = "del"
+		default:
+			return fmt.Errorf("unrecognized op action: %q", op.Action)
+		}
+		if d.Op != want {
+			return fmt.Errorf("%s op on %s, but the change to the record is %q", op.Action, op.Path, d.Op)
+		}
+		if want != "del" && (op.Cid == nil || cid.Cid(*op.Cid) != d.NewCid) {
+			return fmt.Errorf("%s op on %s has a different cid than the record (%s)", op.Action, op.Path, d.NewCid)
+		}
+	}
+
+	if len(changes) > 0 {
+		return fmt.Errorf("commit changes %d records with no op", len(changes))
+	}
+	return nil
+}
+
 func (rm *RepoManager) CheckRepoSig(ctx context.Context, r *repo.Repo, expdid string) error {
 	ctx, span := otel.Tracer("repoman").Start(ctx, "CheckRepoSig")
 	defer span.End()
@@ -514,20 +600,33 @@ func (rm *RepoManager) CheckRepoSig(ctx context.Context, r *repo.Repo, expdid st
 	}
 
 	scom := r.SignedCommit()
+	if err := rm.verifyCommitSig(ctx, repoDid, &scom); err != nil {
+		return fmt.Errorf("signature check failed (sig: %x): %w", scom.Sig, err)
+	}
 
-	usc := scom.Unsigned()
-	sb, err := usc.BytesForSigning()
-	if err != nil {
-		return fmt.Errorf("commit serialization failed: %w", err)
+	return nil
+}
+
+func (rm *RepoManager) verifyCommitSig(ctx context.Context, did string, scom *repo.SignedCommit) error {
+	if scom.Did != did {
+		return fmt.Errorf("commit is for %q, not %q", scom.Did, did)
 	}
-	if err := rm.kmgr.VerifyUserSignature(ctx, repoDid, scom.Sig, sb); err != nil {
-		return fmt.Errorf("signature check failed (sig: %x) (sb: %x) : %w", scom.Sig, sb, err)
+	if rm.dir != nil {
+		return repo.VerifyCommitSignature(ctx, rm.dir, scom)
 	}
 
-	return nil
+	sb, err := scom.Unsigned().BytesForSigning()
+	if err != nil {
+		return fmt.Errorf("commit serialization failed: %w", err)
+	}
+	return rm.kmgr.VerifyUserSignature(ctx, did, scom.Sig, sb)
 }
 
 func (rm *RepoManager) HandleExternalUserEvent(ctx context.Context, pdsid uint, uid models.Uid, did string, since *string, nrev string, carslice []byte, ops []*atproto.SyncSubscribeRepos_RepoOp) error {
+	if rm.noArchive != nil {
+		return rm.handleExternalUserEventNoArchive(ctx, pdsid, uid, did, since, nrev, carslice, ops)
+	}
+
 	ctx, span := otel.Tracer("repoman").Start(ctx, "HandleExternalUserEvent")
 	defer span.End()
 
@@ -576,6 +675,17 @@ func (rm *RepoManager) HandleExternalUserEvent(ctx context.Context, pdsid uint,
 
 	}
 
+	// commits too big to list their ops have none, and can't be checked
+	if ds.BaseCid().Defined() && len(ops) > 0 {
+		if err := checkCommitOps(ctx, ds, ds.BaseCid(), root, ops); err != nil {
+			commitOpsMismatches.Inc()
+			if rm.strictCommitOps {
+				return fmt.Errorf("validating commit ops (since=%v): %w", since, err)
+			}
+			log.Warnw("commit ops do not match repo changes", "pds", pdsid, "did", did, "since", since, "err", err)
+		}
+	}
+
 	var evtops []RepoOp
 
 	for _, op := range ops {
@@ -777,6 +887,10 @@ func (rm *RepoManager) BatchWrite(ctx context.Context, user models.Uid, writes [
 }
 
 func (rm *RepoManager) ImportNewRepo(ctx context.Context, user models.Uid, repoDid string, r io.Reader, rev *string) error {
+	if rm.noArchive != nil {
+		return rm.importNewRepoNoArchive(ctx, user, repoDid, r, rev)
+	}
+
 	ctx, span := otel.Tracer("repoman").Start(ctx, "ImportNewRepo")
 	defer span.End()
 
@@ -811,13 +925,7 @@ func (rm *RepoManager) ImportNewRepo(ctx context.Context, user models.Uid, repoD
 		}
 
 		scom := r.SignedCommit()
-
-		usc := scom.Unsigned()
-		sb, err := usc.BytesForSigning()
-		if err != nil {
-			return fmt.Errorf("commit serialization failed: %w", err)
-		}
-		if err := rm.kmgr.VerifyUserSignature(ctx, repoDid, scom.Sig, sb); err != nil {
+		if err := rm.verifyCommitSig(ctx, repoDid, &scom); err != nil {
 			return fmt.Errorf("new user signature check failed: %w", err)
 		}
 
@@ -1046,7 +1154,7 @@ func (rm *RepoManager) TakeDownRepo(ctx context.Context, uid models.Uid) error {
 	unlock := rm.lockUser(ctx, uid)
 	defer unlock()
 
-	return rm.cs.WipeUserData(ctx, uid)
+	return rm.wipeUserData(ctx, uid)
 }
 
 // technically identical to TakeDownRepo, for now
@@ -1054,5 +1162,16 @@ func (rm *RepoManager) ResetRepo(ctx context.Context, uid models.Uid) error {
 	unlock := rm.lockUser(ctx, uid)
 	defer unlock()
 
+	return rm.wipeUserData(ctx, uid)
+}
+
+func (rm *RepoManager) wipeUserData(ctx context.Context, uid models.Uid) error {
+	if rm.noArchive != nil {
+		if err := rm.noArchive.WipeUserData(ctx, uid); err != nil {
+			return err
+		}
+	}
+
+	// in non-archival mode, there may still be data from before
 	return rm.cs.WipeUserData(ctx, uid)
 }
@@ -0,0 +1,352 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/backfill"
+)
+
+// Admin endpoints for controlling the backfiller, served on the (internal) metrics listener rather than the public API.
+func (s *Server) registerAdminHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/admin/backfill/status", s.handleBackfillStatus)
+	mux.HandleFunc("/admin/backfill/progress", s.handleBackfillProgress)
+	mux.HandleFunc("/admin/backfill/pause", s.handleBackfillPause)
+	mux.HandleFunc("/admin/backfill/resume", s.handleBackfillResume)
+	mux.HandleFunc("/admin/backfill/drain", s.handleBackfillDrain)
+	mux.HandleFunc("/admin/backfill/dead", s.handleBackfillDead)
+	mux.HandleFunc("/admin/backfill/requeue", s.handleBackfillRequeue)
+	mux.HandleFunc("/admin/reindex/status", s.handleReindexStatus)
+	mux.HandleFunc("/admin/reindex/start", s.handleReindexStart)
+	mux.HandleFunc("/admin/reindex/finish", s.handleReindexFinish)
+	mux.HandleFunc("/admin/reindex/cancel", s.handleReindexCancel)
+	mux.HandleFunc("/admin/account/purge", s.handleAccountPurge)
+	mux.HandleFunc("/admin/optout/list", s.handleOptOutList)
+	mux.HandleFunc("/admin/optout/add", s.handleOptOutAdd)
+	mux.HandleFunc("/admin/optout/remove", s.handleOptOutRemove)
+}
+
+type backfillStatus struct {
+	Paused   bool   `json:"paused"`
+	InFlight int    `json:"inFlight"`
+	Error    string `json:"error,omitempty"`
+}
+
+func (s *Server) writeBackfillStatus(w http.ResponseWriter, code int, errMsg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(backfillStatus{
+		Paused:   s.bf.Paused(),
+		InFlight: s.bf.InFlight(),
+		Error:    errMsg,
+	})
+}
+
+func (s *Server) handleBackfillStatus(w http.ResponseWriter, r *http.Request) {
+	s.writeBackfillStatus(w, http.StatusOK, "")
+}
+
+// Job counts by state, throughput, and estimated completion time of the backfill.
+func (s *Server) handleBackfillProgress(w http.ResponseWriter, r *http.Request) {
+	st, err := s.bf.Status(r.Context())
+	if err != nil {
+		s.writeBackfillStatus(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+func (s *Server) handleBackfillPause(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeBackfillStatus(w, http.StatusMethodNotAllowed, "must use POST")
+		return
+	}
+	s.bf.Pause()
+	s.logger.Warn("backfill paused by admin request")
+	s.writeBackfillStatus(w, http.StatusOK, "")
+}
+
+func (s *Server) handleBackfillResume(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeBackfillStatus(w, http.StatusMethodNotAllowed, "must use POST")
+		return
+	}
+	s.bf.Resume()
+	s.logger.Warn("backfill resumed by admin request")
+	s.writeBackfillStatus(w, http.StatusOK, "")
+}
+
+// Pauses the backfiller and waits for in-flight jobs to complete. The optional 'timeout' query parameter (a Go duration string) bounds the wait; the backfiller remains paused even if the wait times out.
+func (s *Server) handleBackfillDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeBackfillStatus(w, http.StatusMethodNotAllowed, "must use POST")
+		return
+	}
+	timeout := time.Minute
+	if t := r.URL.Query().Get("timeout"); t != "" {
+		d, err := time.ParseDuration(t)
+		if err != nil {
+			s.writeBackfillStatus(w, http.StatusBadRequest, "invalid timeout: "+err.Error())
+			return
+		}
+		timeout = d
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	s.logger.Warn("draining backfill by admin request", "timeout", timeout)
+	if err := s.bf.Drain(ctx); err != nil {
+		s.writeBackfillStatus(w, http.StatusGatewayTimeout, "backfill not drained: "+err.Error())
+		return
+	}
+	s.writeBackfillStatus(w, http.StatusOK, "")
+}
+
+// Lists backfill jobs which failed too many times, ordered by DID. Takes optional 'limit' (default 100) and 'cursor' (the last DID of the previous page) query parameters.
+func (s *Server) handleBackfillDead(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 1000 {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"error": "invalid limit (1 to 1000)"})
+			return
+		}
+		limit = v
+	}
+	jobs, err := s.bfs.ListDeadJobs(r.Context(), r.URL.Query().Get("cursor"), limit)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]any{"error": err.Error()})
+		return
+	}
+	resp := map[string]any{"jobs": jobs}
+	if len(jobs) == limit {
+		resp["cursor"] = jobs[len(jobs)-1].Repo
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// Enqueues the dead backfill job for the 'did' query parameter again, with its attempts reset.
+func (s *Server) handleBackfillRequeue(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]any{"error": "must use POST"})
+		return
+	}
+	did, err := syntax.ParseDID(r.URL.Query().Get("did"))
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{"error": "invalid DID: " + err.Error()})
+		return
+	}
+	s.logger.Warn("requeueing dead backfill job by admin request", "did", did)
+	if err := s.bfs.RequeueDeadJob(r.Context(), did.String()); err != nil {
+		code := http.StatusInternalServerError
+		if errors.Is(err, backfill.ErrJobNotFound) {
+			code = http.StatusNotFound
+		}
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]any{"did": did, "error": err.Error()})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"did": did, "state": backfill.StateEnqueued})
+}
+
+type reindexResponse struct {
+	*ReindexStatus
+	// indices detached from the aliases by a finished reindex
+	Previous []string `json:"previous,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+func (s *Server) writeReindexStatus(w http.ResponseWriter, r *http.Request, code int, errMsg string, previous []string) {
+	resp := reindexResponse{
+		Previous: previous,
+		Error:    errMsg,
+	}
+	status, err := s.GetReindexStatus(r.Context())
+	if err != nil {
+		s.logger.Error("failed to get reindex status", "err", err)
+		if resp.Error == "" {
+			code = http.StatusInternalServerError
+			resp.Error = "failed to get reindex status: " + err.Error()
+		}
+	}
+	resp.ReindexStatus = status
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func reindexErrorCode(err error) int {
+	switch {
+	case errors.Is(err, ErrReindexInProgress), errors.Is(err, ErrNoReindex), errors.Is(err, ErrReindexNotReady):
+		return http.StatusConflict
+	case errors.Is(err, ErrReindexDisabled):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (s *Server) handleReindexStatus(w http.ResponseWriter, r *http.Request) {
+	s.writeReindexStatus(w, r, http.StatusOK, "", nil)
+}
+
+func (s *Server) handleReindexStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeReindexStatus(w, r, http.StatusMethodNotAllowed, "must use POST", nil)
+		return
+	}
+	if err := s.StartReindex(r.Context()); err != nil {
+		s.writeReindexStatus(w, r, reindexErrorCode(err), err.Error(), nil)
+		return
+	}
+	s.writeReindexStatus(w, r, http.StatusOK, "", nil)
+}
+
+// Swaps the aliases to the new indices. Fails if the reindex backfill is incomplete, unless the 'force' query parameter is "true".
+func (s *Server) handleReindexFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeReindexStatus(w, r, http.StatusMethodNotAllowed, "must use POST", nil)
+		return
+	}
+	force := r.URL.Query().Get("force") == "true"
+	previous, err := s.FinishReindex(r.Context(), force)
+	if err != nil {
+		s.writeReindexStatus(w, r, reindexErrorCode(err), err.Error(), previous)
+		return
+	}
+	s.writeReindexStatus(w, r, http.StatusOK, "", previous)
+}
+
+func (s *Server) handleReindexCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeReindexStatus(w, r, http.StatusMethodNotAllowed, "must use POST", nil)
+		return
+	}
+	if err := s.CancelReindex(r.Context()); err != nil {
+		s.writeReindexStatus(w, r, reindexErrorCode(err), err.Error(), nil)
+		return
+	}
+	s.writeReindexStatus(w, r, http.StatusOK, "", nil)
+}
+
+type purgeResponse struct {
+	*PurgeResult
+	Error string `json:"error,omitempty"`
+}
+
+func writePurgeResponse(w http.ResponseWriter, code int, result *PurgeResult, errMsg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(purgeResponse{
+		PurgeResult: result,
+		Error:       errMsg,
+	})
+}
+
+// Manually removes all documents for an account, given by the 'did' query parameter (eg, after a takedown which was missed on the firehose).
+func (s *Server) handleAccountPurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writePurgeResponse(w, http.StatusMethodNotAllowed, nil, "must use POST")
+		return
+	}
+	did, err := syntax.ParseDID(r.URL.Query().Get("did"))
+	if err != nil {
+		writePurgeResponse(w, http.StatusBadRequest, nil, "invalid DID: "+err.Error())
+		return
+	}
+	s.logger.Warn("purging account by admin request", "did", did)
+	result, err := s.PurgeAccount(r.Context(), did, "admin")
+	if err != nil {
+		writePurgeResponse(w, http.StatusInternalServerError, result, err.Error())
+		return
+	}
+	writePurgeResponse(w, http.StatusOK, result, "")
+}
+
+type optOutResponse struct {
+	DID      string `json:"did,omitempty"`
+	OptedOut bool   `json:"optedOut"`
+	Reason   string `json:"reason,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func writeOptOutResponse(w http.ResponseWriter, code int, resp optOutResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (s *Server) handleOptOutList(w http.ResponseWriter, r *http.Request) {
+	rows, err := s.ListOptOuts(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]any{"error": err.Error()})
+		return
+	}
+	if rows == nil {
+		rows = []IndexOptOut{}
+	}
+	json.NewEncoder(w).Encode(map[string]any{"accounts": rows})
+}
+
+// Excludes the account given by the 'did' query parameter from indexing, and removes its posts and profile from the indices.
+func (s *Server) handleOptOutAdd(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOptOutResponse(w, http.StatusMethodNotAllowed, optOutResponse{Error: "must use POST"})
+		return
+	}
+	did, err := syntax.ParseDID(r.URL.Query().Get("did"))
+	if err != nil {
+		writeOptOutResponse(w, http.StatusBadRequest, optOutResponse{Error: "invalid DID: " + err.Error()})
+		return
+	}
+	s.logger.Warn("opting account out of indexing by admin request", "did", did)
+	if err := s.OptOut(r.Context(), did, OptOutOperator); err != nil {
+		writeOptOutResponse(w, http.StatusInternalServerError, optOutResponse{DID: did.String(), Error: err.Error()})
+		return
+	}
+	writeOptOutResponse(w, http.StatusOK, optOutResponse{DID: did.String(), OptedOut: true, Reason: OptOutOperator})
+}
+
+// Removes an operator opt-out for the account given by the 'did' query parameter, and re-enqueues its repo for backfill. Self-label opt-outs can only be removed by the account (by removing the label).
+func (s *Server) handleOptOutRemove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOptOutResponse(w, http.StatusMethodNotAllowed, optOutResponse{Error: "must use POST"})
+		return
+	}
+	did, err := syntax.ParseDID(r.URL.Query().Get("did"))
+	if err != nil {
+		writeOptOutResponse(w, http.StatusBadRequest, optOutResponse{Error: "invalid DID: " + err.Error()})
+		return
+	}
+	s.logger.Warn("opting account back in to indexing by admin request", "did", did)
+	removed, err := s.RemoveOptOut(r.Context(), did, OptOutOperator)
+	if err != nil {
+		writeOptOutResponse(w, http.StatusInternalServerError, optOutResponse{DID: did.String(), Error: err.Error()})
+		return
+	}
+	resp := optOutResponse{DID: did.String()}
+	if reason, ok := s.optOutReason(did); ok {
+		resp.OptedOut = true
+		resp.Reason = reason
+	}
+	if !removed {
+		resp.Error = "account has no operator opt-out"
+		writeOptOutResponse(w, http.StatusNotFound, resp)
+		return
+	}
+	writeOptOutResponse(w, http.StatusOK, resp)
+}
@@ -0,0 +1,222 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+
+	"github.com/labstack/echo/v4"
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Options for post aggregations.
+type PostAggregationOpts struct {
+	// Number of top hashtags and link domains to return
+	Size int
+	// Histogram bucket size: "hour" or "day"
+	Interval string
+	// Posts created within this window (up to now) are aggregated, unless the query has 'since:' or 'until:' operators
+	Window time.Duration
+}
+
+// Upper bound on Window, to bound the number of histogram buckets
+const maxAggregationWindow = 31 * 24 * time.Hour
+
+type AggregationBucket struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+type PostAggregationsOutput struct {
+	// number of posts matching the query (within the time window)
+	HitsTotal int64 `json:"hitsTotal"`
+	// most common hashtags (lower-case, without '#')
+	Tags []AggregationBucket `json:"tags"`
+	// most commonly linked domains (including parent domains)
+	Domains []AggregationBucket `json:"domains"`
+	// post counts by creation time; keys are the start of each bucket (RFC 3339, UTC)
+	Histogram []AggregationBucket `json:"histogram"`
+}
+
+// Runs an aggregation-only (no hits) query over posts matching the search query, for top hashtags, top link domains, and a creation time histogram.
+func DoAggregatePosts(ctx context.Context, dir identity.Directory, escli *es.Client, index, q string, opts PostAggregationOpts) (*EsSearchResponse, error) {
+	ctx, span := tracer.Start(ctx, "DoAggregatePosts")
+	defer span.End()
+
+	if opts.Size <= 0 || opts.Size > 100 {
+		return nil, fmt.Errorf("disallowed aggregation size")
+	}
+	switch opts.Interval {
+	case "hour", "day":
+	default:
+		return nil, fmt.Errorf("unsupported histogram interval: %q", opts.Interval)
+	}
+	if opts.Window <= 0 || opts.Window > maxAggregationWindow {
+		return nil, fmt.Errorf("disallowed aggregation window")
+	}
+
+	pq := ParseSearchQuery(SanitizeQuery(q))
+	var extraFilters []map[string]any
+	bounded := false
+	for _, op := range pq.Operators {
+		if (op.Name == "since" || op.Name == "until") && !op.Negated {
+			bounded = true
+		}
+	}
+	if !bounded {
+		extraFilters = append(extraFilters, map[string]any{
+			"range": map[string]any{
+				"created_at": map[string]any{"gte": "now-" + esDuration(opts.Window)},
+			},
+		})
+	}
+
+	query := map[string]any{
+		"query":            pq.boolQuery(ctx, dir, queryDocPost, []string{"everything"}, extraFilters, nil),
+		"size":             0,
+		"track_total_hits": true,
+		"aggs": map[string]any{
+			"tags": map[string]any{
+				"terms": map[string]any{"field": "tag", "size": opts.Size},
+			},
+			"domains": map[string]any{
+				"terms": map[string]any{"field": "url_domain", "size": opts.Size},
+			},
+			"histogram": map[string]any{
+				"date_histogram": map[string]any{
+					"field":             "created_at",
+					"calendar_interval": opts.Interval,
+					"min_doc_count":     0,
+				},
+			},
+		},
+	}
+	return doSearch(ctx, escli, index, query)
+}
+
+// Bucket aggregation results, as returned by OpenSearch.
+type esBuckets struct {
+	Buckets []struct {
+		Key      any   `json:"key"`
+		DocCount int64 `json:"doc_count"`
+	} `json:"buckets"`
+}
+
+func parseBuckets(raw json.RawMessage, dates bool) ([]AggregationBucket, error) {
+	out := []AggregationBucket{}
+	if raw == nil {
+		return out, nil
+	}
+	var parsed esBuckets
+	if err := json.Unmarshal(raw, &parsed); err != nil {
+		return nil, fmt.Errorf("decoding aggregation buckets: %w", err)
+	}
+	for _, b := range parsed.Buckets {
+		var key string
+		switch k := b.Key.(type) {
+		case string:
+			key = k
+		case float64:
+			// date histogram keys are epoch milliseconds
+			if dates {
+				key = time.UnixMilli(int64(k)).UTC().Format(time.RFC3339)
+			} else {
+				key = strconv.FormatFloat(k, 'f', -1, 64)
+			}
+		default:
+			continue
+		}
+		out = append(out, AggregationBucket{Key: key, Count: b.DocCount})
+	}
+	return out, nil
+}
+
+func (s *Server) AggregatePosts(ctx context.Context, q string, opts PostAggregationOpts) (*PostAggregationsOutput, error) {
+	ctx, span := tracer.Start(ctx, "AggregatePosts")
+	defer span.End()
+
+	resp, err := DoAggregatePosts(ctx, s.dir, s.escli, s.postIndex, q, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	out := PostAggregationsOutput{HitsTotal: int64(resp.Hits.Total.Value)}
+	if out.Tags, err = parseBuckets(resp.Aggregations["tags"], false); err != nil {
+		return nil, err
+	}
+	if out.Domains, err = parseBuckets(resp.Aggregations["domains"], false); err != nil {
+		return nil, err
+	}
+	if out.Histogram, err = parseBuckets(resp.Aggregations["histogram"], true); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// There is no Lexicon for this endpoint; it takes the same query syntax as post search, and returns bucketed counts instead of posts.
+func (s *Server) handleSearchPostsAggregations(e echo.Context) error {
+	ctx, span := tracer.Start(e.Request().Context(), "handleSearchPostsAggregations")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("query", e.QueryParam("q")))
+
+	q := strings.TrimSpace(e.QueryParam("q"))
+	if q == "" {
+		return e.JSON(400, map[string]any{
+			"error": "must pass non-empty search query",
+		})
+	}
+
+	opts := PostAggregationOpts{
+		Size:     10,
+		Interval: "hour",
+		Window:   24 * time.Hour,
+	}
+	if l := strings.TrimSpace(e.QueryParam("limit")); l != "" {
+		v, err := strconv.Atoi(l)
+		if err != nil || v < 1 || v > 100 {
+			return &echo.HTTPError{Code: 400, Message: "invalid value for 'limit' (1 to 100)"}
+		}
+		opts.Size = v
+	}
+	if i := strings.TrimSpace(e.QueryParam("interval")); i != "" {
+		if i != "hour" && i != "day" {
+			return &echo.HTTPError{Code: 400, Message: "invalid value for 'interval' (hour or day)"}
+		}
+		opts.Interval = i
+	}
+	if w := strings.TrimSpace(e.QueryParam("window")); w != "" {
+		d, err := time.ParseDuration(w)
+		if err != nil || d <= 0 || d > maxAggregationWindow {
+			return &echo.HTTPError{Code: 400, Message: fmt.Sprintf("invalid value for 'window' (duration up to %s)", maxAggregationWindow)}
+		}
+		opts.Window = d
+	}
+	span.SetAttributes(attribute.Int("limit", opts.Size), attribute.String("interval", opts.Interval), attribute.String("window", opts.Window.String()))
+
+	q, blocked := s.queryFilter.Filter(SanitizeQuery(q), requestLanguages(e.Request()))
+	if blocked {
+		span.SetAttributes(attribute.Bool("blocked", true))
+		if s.queryFilter.Policy() == BlockedQueryPolicyReject {
+			return e.JSON(400, map[string]any{
+				"error": "search query not allowed",
+			})
+		}
+		return e.JSON(200, PostAggregationsOutput{Tags: []AggregationBucket{}, Domains: []AggregationBucket{}, Histogram: []AggregationBucket{}})
+	}
+
+	out, err := s.AggregatePosts(ctx, q, opts)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", fmt.Sprintf("failed to AggregatePosts: %s", err)))
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return e.JSON(200, out)
+}
@@ -0,0 +1,41 @@
+package search
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBuckets(t *testing.T) {
+	assert := assert.New(t)
+
+	var resp EsSearchResponse
+	body := `{
+		"took": 3,
+		"timed_out": false,
+		"hits": {"total": {"value": 12, "relation": "eq"}, "hits": []},
+		"aggregations": {
+			"tags": {"buckets": [{"key": "art", "doc_count": 7}, {"key": "birds", "doc_count": 2}]},
+			"histogram": {"buckets": [
+				{"key_as_string": "2024-01-01T00:00:00.000Z", "key": 1704067200000, "doc_count": 5},
+				{"key_as_string": "2024-01-01T01:00:00.000Z", "key": 1704070800000, "doc_count": 0}
+			]}
+		}
+	}`
+	assert.NoError(json.Unmarshal([]byte(body), &resp))
+
+	tags, err := parseBuckets(resp.Aggregations["tags"], false)
+	assert.NoError(err)
+	assert.Equal([]AggregationBucket{{Key: "art", Count: 7}, {Key: "birds", Count: 2}}, tags)
+
+	hist, err := parseBuckets(resp.Aggregations["histogram"], true)
+	assert.NoError(err)
+	assert.Equal([]AggregationBucket{{Key: "2024-01-01T00:00:00Z", Count: 5}, {Key: "2024-01-01T01:00:00Z", Count: 0}}, hist)
+
+	// missing aggregation
+	domains, err := parseBuckets(resp.Aggregations["domains"], false)
+	assert.NoError(err)
+	assert.Empty(domains)
+	assert.NotNil(domains)
+}
@@ -0,0 +1,214 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	esapi "github.com/opensearch-project/opensearch-go/v2/opensearchapi"
+)
+
+// The configured post and profile index names are used as aliases, each pointing to a single versioned index (eg, "palomar_post_20240501120000"). Searches and writes go through the alias, which lets a new index be built and swapped in without downtime (see StartReindex).
+
+// Name of a new concrete index behind the given alias.
+func versionedIndexName(alias string, now time.Time) string {
+	return fmt.Sprintf("%s_%s", alias, now.UTC().Format("20060102150405"))
+}
+
+// Returns the concrete indices which the alias points to, or nil if there is no alias with that name. Note that a concrete index with the same name is not an alias.
+func (s *Server) aliasIndices(ctx context.Context, alias string) ([]string, error) {
+	req := esapi.IndicesGetAliasRequest{
+		Name: []string{alias},
+	}
+	res, err := req.Do(ctx, s.escli)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up alias: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alias response: %w", err)
+	}
+	if res.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if res.IsError() {
+		return nil, fmt.Errorf("alias lookup error, code=%d: %s", res.StatusCode, string(body))
+	}
+
+	// response is keyed by concrete index name
+	var parsed map[string]json.RawMessage
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse alias response: %w", err)
+	}
+	indices := make([]string, 0, len(parsed))
+	for name := range parsed {
+		indices = append(indices, name)
+	}
+	sort.Strings(indices)
+	return indices, nil
+}
+
+func (s *Server) indexExists(ctx context.Context, name string) (bool, error) {
+	req := esapi.IndicesExistsRequest{
+		Index: []string{name},
+	}
+	res, err := req.Do(ctx, s.escli)
+	if err != nil {
+		return false, fmt.Errorf("failed to check index existence: %w", err)
+	}
+	defer res.Body.Close()
+	io.ReadAll(res.Body)
+	if res.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if res.IsError() {
+		return false, fmt.Errorf("failed to check index existence, code=%d", res.StatusCode)
+	}
+	return true, nil
+}
+
+// Creates a concrete index from an embedded schema file. If alias is not empty, the index is created as the write index of that alias.
+func (s *Server) createIndex(ctx context.Context, name, schemaJSON, alias string) error {
+	if len(schemaJSON) < 2 {
+		return fmt.Errorf("empty schema file (go:embed failed)")
+	}
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(schemaJSON), &schema); err != nil {
+		return fmt.Errorf("invalid index schema: %w", err)
+	}
+	if alias != "" {
+		schema["aliases"] = map[string]any{
+			alias: map[string]any{"is_write_index": true},
+		}
+	}
+	b, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+
+	req := esapi.IndicesCreateRequest{
+		Index: name,
+		Body:  bytes.NewReader(b),
+	}
+	res, err := req.Do(ctx, s.escli)
+	if err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read create index response: %w", err)
+	}
+	if res.IsError() {
+		return fmt.Errorf("failed to create index %s, code=%d: %s", name, res.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (s *Server) deleteIndex(ctx context.Context, name string) error {
+	req := esapi.IndicesDeleteRequest{
+		Index: []string{name},
+	}
+	res, err := req.Do(ctx, s.escli)
+	if err != nil {
+		return fmt.Errorf("failed to delete index: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read delete index response: %w", err)
+	}
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to delete index %s, code=%d: %s", name, res.StatusCode, string(body))
+	}
+	return nil
+}
+
+// Number of documents in an index or alias, optionally only those matching a query.
+func (s *Server) countDocuments(ctx context.Context, index string, query map[string]any) (int64, error) {
+	req := esapi.CountRequest{
+		Index: []string{index},
+	}
+	if query != nil {
+		b, err := json.Marshal(map[string]any{"query": query})
+		if err != nil {
+			return 0, err
+		}
+		req.Body = bytes.NewReader(b)
+	}
+	res, err := req.Do(ctx, s.escli)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count documents: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read count response: %w", err)
+	}
+	if res.IsError() {
+		return 0, fmt.Errorf("count error, code=%d: %s", res.StatusCode, string(body))
+	}
+	var parsed struct {
+		Count int64 `json:"count"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return 0, fmt.Errorf("failed to parse count response: %w", err)
+	}
+	return parsed.Count, nil
+}
+
+// Atomically points the alias at a new concrete index. Any indices the alias currently points to are detached but kept. If the alias name is currently a concrete (pre-alias) index, that index is deleted in the same operation, since an alias can not share a name with an index.
+func (s *Server) swapAlias(ctx context.Context, alias, newIndex string) error {
+	old, err := s.aliasIndices(ctx, alias)
+	if err != nil {
+		return err
+	}
+	var actions []map[string]any
+	if old == nil {
+		legacy, err := s.indexExists(ctx, alias)
+		if err != nil {
+			return err
+		}
+		if legacy {
+			actions = append(actions, map[string]any{
+				"remove_index": map[string]any{"index": alias},
+			})
+		}
+	}
+	for _, idx := range old {
+		actions = append(actions, map[string]any{
+			"remove": map[string]any{"index": idx, "alias": alias},
+		})
+	}
+	actions = append(actions, map[string]any{
+		"add": map[string]any{"index": newIndex, "alias": alias, "is_write_index": true},
+	})
+
+	b, err := json.Marshal(map[string]any{"actions": actions})
+	if err != nil {
+		return err
+	}
+	req := esapi.IndicesUpdateAliasesRequest{
+		Body: bytes.NewReader(b),
+	}
+	res, err := req.Do(ctx, s.escli)
+	if err != nil {
+		return fmt.Errorf("failed to update aliases: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read update aliases response: %w", err)
+	}
+	if res.IsError() {
+		return fmt.Errorf("failed to update alias %s, code=%d: %s", alias, res.StatusCode, string(body))
+	}
+	s.logger.Warn("swapped opensearch alias", "alias", alias, "index", newIndex, "previous", old)
+	return nil
+}
@@ -0,0 +1,152 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// Minimal fake of the OpenSearch index and alias APIs.
+type fakeIndices struct {
+	lk sync.Mutex
+	// alias names by concrete index name
+	indices map[string][]string
+}
+
+func (f *fakeIndices) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(name, "_alias/"):
+		alias := strings.TrimPrefix(name, "_alias/")
+		out := map[string]any{}
+		for idx, aliases := range f.indices {
+			for _, a := range aliases {
+				if a == alias {
+					out[idx] = map[string]any{"aliases": map[string]any{alias: map[string]any{}}}
+				}
+			}
+		}
+		if len(out) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		json.NewEncoder(w).Encode(out)
+	case r.Method == http.MethodHead:
+		if _, ok := f.indices[name]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	case r.Method == http.MethodPut:
+		var body struct {
+			Aliases map[string]any `json:"aliases"`
+		}
+		b, _ := io.ReadAll(r.Body)
+		json.Unmarshal(b, &body)
+		f.indices[name] = nil
+		for a := range body.Aliases {
+			f.indices[name] = append(f.indices[name], a)
+		}
+	case r.Method == http.MethodPost && name == "_aliases":
+		var body struct {
+			Actions []map[string]map[string]any `json:"actions"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		for _, action := range body.Actions {
+			for kind, args := range action {
+				idx, _ := args["index"].(string)
+				alias, _ := args["alias"].(string)
+				switch kind {
+				case "add":
+					f.indices[idx] = append(f.indices[idx], alias)
+				case "remove":
+					var kept []string
+					for _, a := range f.indices[idx] {
+						if a != alias {
+							kept = append(kept, a)
+						}
+					}
+					f.indices[idx] = kept
+				case "remove_index":
+					delete(f.indices, idx)
+				}
+			}
+		}
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+}
+
+func testAliasServer(t *testing.T, f *fakeIndices) *Server {
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	escli, err := es.NewClient(es.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Server{
+		escli:        escli,
+		postIndex:    "palomar_post",
+		profileIndex: "palomar_profile",
+		feedIndex:    "palomar_feed",
+		logger:       slog.Default(),
+	}
+}
+
+func TestEnsureIndicesAliases(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// a profile index from before aliasing exists; the post and feed indices are missing
+	f := &fakeIndices{indices: map[string][]string{"palomar_profile": nil}}
+	s := testAliasServer(t, f)
+	assert.NoError(s.EnsureIndices(ctx))
+
+	assert.Len(f.indices, 3)
+	_, ok := f.indices["palomar_profile"]
+	assert.True(ok)
+	posts, err := s.aliasIndices(ctx, "palomar_post")
+	assert.NoError(err)
+	assert.Len(posts, 1)
+	assert.True(strings.HasPrefix(posts[0], "palomar_post_"))
+
+	// idempotent
+	assert.NoError(s.EnsureIndices(ctx))
+	assert.Len(f.indices, 3)
+}
+
+func TestSwapAlias(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	f := &fakeIndices{indices: map[string][]string{
+		"palomar_post_1":    {"palomar_post"},
+		"palomar_post_2":    nil,
+		"palomar_profile":   nil,
+		"palomar_profile_2": nil,
+	}}
+	s := testAliasServer(t, f)
+
+	// swap from a versioned index: the old index is kept, but detached
+	assert.NoError(s.swapAlias(ctx, "palomar_post", "palomar_post_2"))
+	posts, err := s.aliasIndices(ctx, "palomar_post")
+	assert.NoError(err)
+	assert.Equal([]string{"palomar_post_2"}, posts)
+	assert.Empty(f.indices["palomar_post_1"])
+
+	// swap from a concrete index with the alias name: the old index is replaced
+	assert.NoError(s.swapAlias(ctx, "palomar_profile", "palomar_profile_2"))
+	profiles, err := s.aliasIndices(ctx, "palomar_profile")
+	assert.NoError(err)
+	assert.Equal([]string{"palomar_profile_2"}, profiles)
+	_, ok := f.indices["palomar_profile"]
+	assert.False(ok)
+}
@@ -0,0 +1,315 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	es "github.com/opensearch-project/opensearch-go/v2"
+	esapi "github.com/opensearch-project/opensearch-go/v2/opensearchapi"
+)
+
+type BulkIndexerConfig struct {
+	// Maximum number of documents (index or delete operations) per _bulk request
+	BatchSize int
+	// Pending documents are sent at least this often, even if the batch is not full
+	FlushInterval time.Duration
+	// How many times to retry a batch (or individual documents) rejected with HTTP 429 (Too Many Requests)
+	MaxRetries int
+	// Delay before the first retry, doubled for each subsequent retry
+	RetryBackoff time.Duration
+}
+
+func DefaultBulkIndexerConfig() BulkIndexerConfig {
+	return BulkIndexerConfig{
+		BatchSize:     500,
+		FlushInterval: time.Second,
+		MaxRetries:    5,
+		RetryBackoff:  500 * time.Millisecond,
+	}
+}
+
+type bulkItem struct {
+	// "index", "delete", or "update"
+	action string
+	index  string
+	docID  string
+	// document JSON (or partial update); nil for deletes
+	body []byte
+	// called once with the final outcome for this document (optional)
+	done func(error)
+}
+
+// Batches document index and delete operations through the OpenSearch _bulk API.
+//
+// Operations are queued, and sent when a batch is full or the flush interval passes. The outcome of each operation is reported asynchronously to its callback. Operations are sent in the order they were queued, so a delete queued after an index of the same document wins.
+type BulkIndexer struct {
+	escli  *es.Client
+	logger *slog.Logger
+	config BulkIndexerConfig
+	// optional; batches which fail while it is open are held until it closes, instead of failing
+	breaker *CircuitBreaker
+
+	queue   chan bulkItem
+	flushes chan chan struct{}
+}
+
+func NewBulkIndexer(escli *es.Client, logger *slog.Logger, config BulkIndexerConfig) *BulkIndexer {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 1
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	return &BulkIndexer{
+		escli:   escli,
+		logger:  logger.With("component", "bulk-indexer"),
+		config:  config,
+		queue:   make(chan bulkItem, config.BatchSize*2),
+		flushes: make(chan chan struct{}),
+	}
+}
+
+// Queues a document to be indexed (created or replaced). Blocks if the queue is full, until there is space or the context is cancelled.
+func (b *BulkIndexer) Index(ctx context.Context, index, docID string, body []byte, done func(error)) error {
+	return b.enqueue(ctx, bulkItem{action: "index", index: index, docID: docID, body: body, done: done})
+}
+
+// Queues a document to be deleted. A document which does not exist is not an error.
+func (b *BulkIndexer) Delete(ctx context.Context, index, docID string, done func(error)) error {
+	return b.enqueue(ctx, bulkItem{action: "delete", index: index, docID: docID, done: done})
+}
+
+func (b *BulkIndexer) enqueue(ctx context.Context, item bulkItem) error {
+	select {
+	case b.queue <- item:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Sends any queued operations, and waits for them to complete. Requires Run to be running.
+func (b *BulkIndexer) Flush(ctx context.Context) error {
+	ch := make(chan struct{})
+	select {
+	case b.flushes <- ch:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Sends batches until the context is cancelled, then sends any remaining queued operations. Expects to be run in a goroutine.
+func (b *BulkIndexer) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]bulkItem, 0, b.config.BatchSize)
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		// NOTE: a fresh context, so the final batch is sent during shutdown
+		b.sendBatch(context.Background(), batch)
+		batch = make([]bulkItem, 0, b.config.BatchSize)
+	}
+
+	for {
+		select {
+		case item := <-b.queue:
+			batch = append(batch, item)
+			if len(batch) >= b.config.BatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case ch := <-b.flushes:
+			// drain anything already queued
+			for len(b.queue) > 0 {
+				batch = append(batch, <-b.queue)
+				if len(batch) >= b.config.BatchSize {
+					send()
+				}
+			}
+			send()
+			close(ch)
+		case <-ctx.Done():
+			for len(b.queue) > 0 {
+				batch = append(batch, <-b.queue)
+				if len(batch) >= b.config.BatchSize {
+					send()
+				}
+			}
+			send()
+			return
+		}
+	}
+}
+
+type bulkResponse struct {
+	Errors bool                          `json:"errors"`
+	Items  []map[string]bulkResponseItem `json:"items"`
+}
+
+type bulkResponseItem struct {
+	ID     string          `json:"_id"`
+	Status int             `json:"status"`
+	Error  json.RawMessage `json:"error,omitempty"`
+}
+
+// Sends a batch, retrying the whole request or individual documents which are rate-limited, and reports the outcome of every document.
+func (b *BulkIndexer) sendBatch(ctx context.Context, batch []bulkItem) {
+	backoff := b.config.RetryBackoff
+	for attempt := 0; len(batch) > 0; attempt++ {
+		if attempt > 0 {
+			bulkRetries.Inc()
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		lastAttempt := attempt >= b.config.MaxRetries
+		bulkBatchSize.Observe(float64(len(batch)))
+
+		results, err := b.doBulk(ctx, batch)
+		if err != nil && b.breaker != nil && b.breaker.Open() {
+			b.logger.Warn("opensearch unavailable, holding bulk batch until the circuit breaker closes", "size", len(batch), "err", err)
+			if b.breaker.Wait(ctx) == nil {
+				// not counted as an attempt
+				attempt--
+				backoff = b.config.RetryBackoff
+				continue
+			}
+		}
+		if err != nil {
+			if isRateLimited(err) && !lastAttempt {
+				b.logger.Warn("bulk request rate-limited, will retry", "size", len(batch), "attempt", attempt)
+				continue
+			}
+			bulkRequestFailures.Inc()
+			b.logger.Error("bulk request failed", "size", len(batch), "err", err)
+			for _, item := range batch {
+				item.finish(err)
+			}
+			return
+		}
+
+		// once an operation on a document is retried, every later operation on that document in the batch is retried with it (even if it succeeded), so they are re-applied in their original order
+		var retry []bulkItem
+		retrying := make(map[[2]string]bool)
+		for i, item := range batch {
+			res := results[i]
+			key := [2]string{item.index, item.docID}
+			if retrying[key] {
+				retry = append(retry, item)
+				continue
+			}
+			switch {
+			case res.Status >= 200 && res.Status < 300:
+				item.finish(nil)
+			case item.action == "delete" && res.Status == http.StatusNotFound:
+				item.finish(nil)
+			case res.Status == http.StatusTooManyRequests && !lastAttempt:
+				retrying[key] = true
+				retry = append(retry, item)
+			default:
+				bulkItemFailures.WithLabelValues(item.action).Inc()
+				b.logger.Warn("bulk item failed", "action", item.action, "index", item.index, "docID", item.docID, "status", res.Status, "error", string(res.Error))
+				item.finish(fmt.Errorf("bulk %s failed, status=%d: %s", item.action, res.Status, string(res.Error)))
+			}
+		}
+		if len(retry) > 0 {
+			b.logger.Warn("bulk items rate-limited, will retry", "count", len(retry), "attempt", attempt)
+		}
+		batch = retry
+	}
+}
+
+type rateLimitedError struct {
+	status int
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("bulk request rejected, code=%d", e.status)
+}
+
+func isRateLimited(err error) bool {
+	_, ok := err.(*rateLimitedError)
+	return ok
+}
+
+func (b *BulkIndexer) doBulk(ctx context.Context, batch []bulkItem) ([]bulkResponseItem, error) {
+	return sendBulk(ctx, b.escli, batch)
+}
+
+// Makes a single _bulk request, returning the per-document results in the same order as the batch.
+func sendBulk(ctx context.Context, escli *es.Client, batch []bulkItem) ([]bulkResponseItem, error) {
+	var buf bytes.Buffer
+	for _, item := range batch {
+		meta, err := json.Marshal(map[string]any{
+			item.action: map[string]string{
+				"_index": item.index,
+				"_id":    item.docID,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(meta)
+		buf.WriteByte('\n')
+		if item.body != nil {
+			buf.Write(item.body)
+			buf.WriteByte('\n')
+		}
+	}
+
+	req := esapi.BulkRequest{
+		Body: bytes.NewReader(buf.Bytes()),
+	}
+	res, err := req.Do(ctx, escli)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send bulk request: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bulk response: %w", err)
+	}
+	if res.StatusCode == http.StatusTooManyRequests {
+		return nil, &rateLimitedError{status: res.StatusCode}
+	}
+	if res.IsError() {
+		return nil, fmt.Errorf("bulk request error, code=%d: %s", res.StatusCode, string(body))
+	}
+
+	var parsed bulkResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse bulk response: %w", err)
+	}
+	if len(parsed.Items) != len(batch) {
+		return nil, fmt.Errorf("bulk response item count mismatch: sent %d, got %d", len(batch), len(parsed.Items))
+	}
+	results := make([]bulkResponseItem, len(batch))
+	for i, m := range parsed.Items {
+		// each item is keyed by the action type
+		for _, res := range m {
+			results[i] = res
+		}
+	}
+	return results, nil
+}
+
+func (item *bulkItem) finish(err error) {
+	if item.done != nil {
+		item.done(err)
+	}
+}
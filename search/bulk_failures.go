@@ -0,0 +1,95 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/backfill"
+)
+
+// Repos with documents which failed to be written through the bulk indexer.
+//
+// Bulk writes complete asynchronously, after the backfill (or firehose) handler which queued them has returned, so failures can't be returned to the backfiller. Instead, the backfill jobs of these repos are marked as failed, and re-backfilled according to the backfill retry policy (see Server.retryBulkFailures).
+type bulkFailures struct {
+	lk    sync.Mutex
+	repos map[syntax.DID]bool
+}
+
+func newBulkFailures() *bulkFailures {
+	return &bulkFailures{repos: make(map[syntax.DID]bool)}
+}
+
+func (f *bulkFailures) add(did syntax.DID) {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	f.repos[did] = true
+}
+
+// Returns all the recorded repos, and clears them.
+func (f *bulkFailures) take() []syntax.DID {
+	f.lk.Lock()
+	defer f.lk.Unlock()
+	out := make([]syntax.DID, 0, len(f.repos))
+	for did := range f.repos {
+		out = append(out, did)
+	}
+	f.repos = make(map[syntax.DID]bool)
+	return out
+}
+
+// Wraps the callback of a bulk write, to record the repo if the write fails.
+func (s *Server) bulkDone(did syntax.DID, done func(error)) func(error) {
+	return func(err error) {
+		done(err)
+		if err != nil && s.bulkFailed != nil {
+			s.bulkFailed.add(did)
+		}
+	}
+}
+
+// Periodically re-backfills repos with failed bulk writes, until the context is cancelled.
+func (s *Server) runBulkFailureRetries(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.retryBulkFailures(ctx)
+		}
+	}
+}
+
+// Marks the backfill jobs of repos with failed bulk writes as failed, so that they are retried (and eventually moved to the dead-letter state, if writes keep failing) like any other failed backfill. Repos without a job are enqueued.
+func (s *Server) retryBulkFailures(ctx context.Context) {
+	for _, did := range s.bulkFailed.take() {
+		log := s.logger.With("repo", did)
+		job, err := s.bfs.GetJob(ctx, did.String())
+		if errors.Is(err, backfill.ErrJobNotFound) {
+			if err := s.bfs.EnqueueJob(ctx, did.String()); err != nil {
+				log.Error("failed to enqueue backfill after bulk indexing failure", "err", err)
+			}
+			bulkRepoRetries.Inc()
+			continue
+		}
+		if err != nil {
+			log.Error("failed to get backfill job after bulk indexing failure", "err", err)
+			s.bulkFailed.add(did)
+			continue
+		}
+		if job.State() == backfill.StateInProgress {
+			// the backfill would overwrite the state when it completes; try again once it has
+			s.bulkFailed.add(did)
+			continue
+		}
+		if err := job.SetState(ctx, "failed (bulk indexing)"); err != nil {
+			log.Error("failed to set backfill job state after bulk indexing failure", "err", err)
+			continue
+		}
+		bulkRepoRetries.Inc()
+	}
+}
@@ -0,0 +1,173 @@
+package search
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/backfill"
+
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestBulkIndexer(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	// fake OpenSearch: rejects the first request entirely, then rate-limits one document, then accepts everything
+	var lk sync.Mutex
+	requests := 0
+	var sentIDs []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lk.Lock()
+		defer lk.Unlock()
+		requests++
+		if r.URL.Path != "/_bulk" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if requests == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		var items []map[string]bulkResponseItem
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			var meta map[string]map[string]string
+			if err := json.Unmarshal(scanner.Bytes(), &meta); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			for action, m := range meta {
+				sentIDs = append(sentIDs, m["_id"])
+				status := 201
+				if action == "delete" {
+					status = 404
+				} else {
+					// skip the document line
+					scanner.Scan()
+				}
+				if requests == 2 && (m["_id"] == "doc2" || (m["_id"] == "doc3" && action == "index")) {
+					status = 429
+				}
+				if m["_id"] == "bad" {
+					status = 400
+				}
+				items = append(items, map[string]bulkResponseItem{action: {ID: m["_id"], Status: status}})
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{"errors": true, "items": items})
+	}))
+	defer srv.Close()
+
+	escli, err := es.NewClient(es.Config{Addresses: []string{srv.URL}})
+	assert.NoError(err)
+
+	config := DefaultBulkIndexerConfig()
+	config.BatchSize = 10
+	config.FlushInterval = time.Hour
+	config.RetryBackoff = time.Millisecond
+	bi := NewBulkIndexer(escli, slog.Default(), config)
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go bi.Run(runCtx)
+
+	var outcomes sync.Map
+	done := func(id string) func(error) {
+		return func(err error) {
+			outcomes.Store(id, err)
+		}
+	}
+	for _, id := range []string{"doc1", "doc2", "bad"} {
+		assert.NoError(bi.Index(ctx, "posts", id, []byte(fmt.Sprintf(`{"text": "%s"}`, id)), done(id)))
+	}
+	assert.NoError(bi.Delete(ctx, "posts", "gone", done("gone")))
+	// the delete is accepted while the index before it is rate-limited; both are retried, in order, so the delete still wins
+	assert.NoError(bi.Index(ctx, "posts", "doc3", []byte(`{"text": "doc3"}`), done("doc3")))
+	assert.NoError(bi.Delete(ctx, "posts", "doc3", done("doc3-delete")))
+	assert.NoError(bi.Flush(ctx))
+
+	for _, id := range []string{"doc1", "doc2", "gone", "doc3", "doc3-delete"} {
+		res, ok := outcomes.Load(id)
+		assert.True(ok, id)
+		assert.Nil(res, id)
+	}
+	res, ok := outcomes.Load("bad")
+	assert.True(ok)
+	assert.Contains(fmt.Sprint(res), "status=400")
+
+	lk.Lock()
+	defer lk.Unlock()
+	assert.Equal(3, requests)
+	// second request has all six operations, third only the rate-limited ones and the later delete of doc3
+	assert.Equal("doc1,doc2,bad,gone,doc3,doc3,doc2,doc3,doc3", strings.Join(sentIDs, ","))
+}
+
+func TestRetryBulkFailures(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(db.AutoMigrate(&backfill.GormDBJob{}))
+	bfs := backfill.NewGormstore(db)
+	s := &Server{logger: slog.Default(), bfs: bfs, bulkFailed: newBulkFailures()}
+
+	complete := syntax.DID("did:plc:complete")
+	running := syntax.DID("did:plc:running")
+	unknown := syntax.DID("did:plc:unknown")
+	ok := syntax.DID("did:plc:ok")
+	for did, state := range map[syntax.DID]string{complete: backfill.StateComplete, running: backfill.StateInProgress, ok: backfill.StateComplete} {
+		job, err := bfs.GetOrCreateJob(ctx, did.String(), state)
+		assert.NoError(err)
+		assert.Equal(state, job.State())
+	}
+
+	var outcomes int
+	done := func(error) { outcomes++ }
+	s.bulkDone(complete, done)(errors.New("bulk index failed, status=500"))
+	s.bulkDone(running, done)(errors.New("bulk index failed, status=500"))
+	s.bulkDone(unknown, done)(errors.New("bulk delete failed, status=500"))
+	s.bulkDone(ok, done)(nil)
+	assert.Equal(4, outcomes)
+
+	s.retryBulkFailures(ctx)
+
+	// completed repos are failed, so they are retried with the backfill retry policy
+	job, err := bfs.GetJob(ctx, complete.String())
+	assert.NoError(err)
+	assert.Equal("failed (bulk indexing)", job.State())
+	assert.Equal(1, job.RetryCount())
+
+	// repos which were never backfilled are enqueued
+	job, err = bfs.GetJob(ctx, unknown.String())
+	assert.NoError(err)
+	assert.Equal(backfill.StateEnqueued, job.State())
+
+	// successful writes don't affect the job
+	job, err = bfs.GetJob(ctx, ok.String())
+	assert.NoError(err)
+	assert.Equal(backfill.StateComplete, job.State())
+
+	// in-progress backfills are left alone until they finish
+	job, err = bfs.GetJob(ctx, running.String())
+	assert.NoError(err)
+	assert.Equal(backfill.StateInProgress, job.State())
+	assert.Equal([]syntax.DID{running}, s.bulkFailed.take())
+}
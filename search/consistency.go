@@ -0,0 +1,231 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/backfill"
+	"github.com/bluesky-social/indigo/repo"
+	"github.com/bluesky-social/indigo/xrpc"
+
+	"github.com/ipfs/go-cid"
+)
+
+type ConsistencyCheckConfig struct {
+	// How often a sample of repos is checked
+	Interval time.Duration
+	// Number of repos (with a completed backfill) checked per round
+	SampleSize int
+	// Differences in document counts up to this size are not considered drift (eg, records written since the last index refresh)
+	Tolerance int64
+	// If set, drifted repos are backfilled again. Accounts with more documents than records (eg, missed deletions) are purged first.
+	Repair bool
+}
+
+func DefaultConsistencyCheckConfig() ConsistencyCheckConfig {
+	return ConsistencyCheckConfig{
+		Interval:   10 * time.Minute,
+		SampleSize: 20,
+		Tolerance:  2,
+	}
+}
+
+// Record counts for a repo, from the PDS and from the search indices, by document type ("post", "profile", "feed").
+type RepoConsistency struct {
+	DID   string
+	Repo  map[string]int64
+	Index map[string]int64
+}
+
+// Whether any document type differs by more than the tolerance.
+func (rc *RepoConsistency) Drifted(tolerance int64) bool {
+	for _, docType := range []string{"post", "profile", "feed"} {
+		diff := rc.Repo[docType] - rc.Index[docType]
+		if diff > tolerance || -diff > tolerance {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether the index has more documents than the repo has records, of any type.
+func (rc *RepoConsistency) hasExtraDocs() bool {
+	for docType, n := range rc.Index {
+		if n > rc.Repo[docType] {
+			return true
+		}
+	}
+	return false
+}
+
+// Counts a repo record under the document type it is indexed as, applying the same rules as indexing.
+func countIndexedRecord(counts map[string]int64, path string) {
+	if !isIndexedPath(path) {
+		return
+	}
+	collection, rkey, ok := strings.Cut(path, "/")
+	if !ok {
+		return
+	}
+	switch collection {
+	case "app.bsky.feed.post":
+		if tidRegex.MatchString(rkey) {
+			counts["post"]++
+		}
+	case "app.bsky.actor.profile":
+		if rkey == "self" {
+			counts["profile"]++
+		}
+	case feedGeneratorCollection, listCollection:
+		if _, _, err := splitRecordPath(path); err == nil {
+			counts["feed"]++
+		}
+	}
+}
+
+// Periodically checks a random sample of backfilled repos against the indices, until the context is cancelled.
+func (s *Server) RunConsistencyChecker(ctx context.Context) {
+	if s.consistency == nil {
+		return
+	}
+	log := s.logger.With("component", "consistency-checker")
+	log.Info("starting consistency checker", "interval", s.consistency.Interval, "sample", s.consistency.SampleSize, "repair", s.consistency.Repair)
+
+	ticker := time.NewTicker(s.consistency.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.checkConsistencySample(ctx); err != nil {
+			log.Error("consistency check failed", "err", err)
+		}
+	}
+}
+
+func (s *Server) checkConsistencySample(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "checkConsistencySample")
+	defer span.End()
+
+	var dids []string
+	err := s.db.Model(&backfill.GormDBJob{}).
+		Where("state = ?", backfill.StateComplete).
+		Order("RANDOM()").
+		Limit(s.consistency.SampleSize).
+		Pluck("repo", &dids).Error
+	if err != nil {
+		return fmt.Errorf("sampling backfilled repos: %w", err)
+	}
+
+	checked, drifted := 0, 0
+	for _, raw := range dids {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log := s.logger.With("component", "consistency-checker", "did", raw)
+		did, err := syntax.ParseDID(raw)
+		if err != nil {
+			continue
+		}
+		rc, err := s.CheckRepoConsistency(ctx, did)
+		if err != nil {
+			consistencyCheckFailures.Inc()
+			log.Warn("failed to check repo consistency", "err", err)
+			continue
+		}
+		checked++
+		consistencyReposChecked.Inc()
+		if !rc.Drifted(s.consistency.Tolerance) {
+			continue
+		}
+		drifted++
+		consistencyReposDrifted.Inc()
+		log.Warn("repo drifted from search index", "repo", rc.Repo, "index", rc.Index)
+		if s.consistency.Repair {
+			if err := s.repairRepo(ctx, rc); err != nil {
+				log.Error("failed to repair repo", "err", err)
+			}
+		}
+	}
+	if checked > 0 {
+		consistencyDriftRatio.Set(float64(drifted) / float64(checked))
+	}
+	return nil
+}
+
+// Compares record counts in an account's repo (fetched from its PDS) with document counts in the search indices.
+func (s *Server) CheckRepoConsistency(ctx context.Context, did syntax.DID) (*RepoConsistency, error) {
+	ctx, span := tracer.Start(ctx, "CheckRepoConsistency")
+	defer span.End()
+
+	ident, err := s.dir.LookupDID(ctx, did)
+	if err != nil {
+		return nil, fmt.Errorf("resolving identity: %w", err)
+	}
+	client := s.bgsxrpc
+	if pds := ident.PDSEndpoint(); pds != "" {
+		client = &xrpc.Client{
+			Client: &http.Client{Timeout: 2 * time.Minute},
+			Host:   pds,
+		}
+	}
+	repodata, err := comatproto.SyncGetRepo(ctx, client, did.String(), "")
+	if err != nil {
+		return nil, fmt.Errorf("fetching repo: %w", err)
+	}
+	r, err := repo.ReadRepoFromCar(ctx, bytes.NewReader(repodata))
+	if err != nil {
+		return nil, fmt.Errorf("reading repo: %w", err)
+	}
+
+	rc := &RepoConsistency{
+		DID:   did.String(),
+		Repo:  map[string]int64{},
+		Index: map[string]int64{},
+	}
+	err = r.ForEach(ctx, "", func(k string, v cid.Cid) error {
+		countIndexedRecord(rc.Repo, k)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking repo: %w", err)
+	}
+
+	t := s.primaryTarget()
+	for _, idx := range []struct{ docType, index string }{
+		{"post", t.post},
+		{"profile", t.profile},
+		{"feed", t.feed},
+	} {
+		n, err := s.countDocuments(ctx, idx.index, map[string]any{
+			"term": map[string]any{"did": did.String()},
+		})
+		if err != nil {
+			return nil, err
+		}
+		rc.Index[idx.docType] = n
+	}
+	return rc, nil
+}
+
+// Re-enqueues a drifted repo in the backfiller. Stale documents are not removed by a backfill, so if there are any, the account's documents are purged first.
+func (s *Server) repairRepo(ctx context.Context, rc *RepoConsistency) error {
+	if rc.hasExtraDocs() {
+		if _, err := s.PurgeAccount(ctx, syntax.DID(rc.DID), "repair"); err != nil {
+			return err
+		}
+	}
+	if err := s.reenqueueRepo(ctx, rc.DID); err != nil {
+		return err
+	}
+	consistencyRepairs.Inc()
+	return nil
+}
@@ -0,0 +1,38 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoConsistency(t *testing.T) {
+	assert := assert.New(t)
+
+	counts := map[string]int64{}
+	for _, path := range []string{
+		"app.bsky.feed.post/3kabcdefghij2",
+		"app.bsky.feed.post/3kabcdefghij3",
+		"app.bsky.feed.post/not-a-tid",
+		"app.bsky.feed.like/3kabcdefghij4",
+		"app.bsky.actor.profile/self",
+		"app.bsky.actor.profile/other",
+		"app.bsky.feed.generator/cool-feed",
+		"app.bsky.graph.list/3kabcdefghij5",
+	} {
+		countIndexedRecord(counts, path)
+	}
+	assert.Equal(map[string]int64{"post": 2, "profile": 1, "feed": 2}, counts)
+
+	rc := &RepoConsistency{
+		Repo:  counts,
+		Index: map[string]int64{"post": 1, "profile": 1, "feed": 2},
+	}
+	assert.False(rc.Drifted(1))
+	assert.True(rc.Drifted(0))
+	assert.False(rc.hasExtraDocs())
+
+	rc.Index["feed"] = 5
+	assert.True(rc.Drifted(2))
+	assert.True(rc.hasExtraDocs())
+}
@@ -0,0 +1,95 @@
+package search
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Position in a search result set, as passed in the 'cursor' parameter of the search endpoints.
+//
+// Cursors returned by the server hold the sort values of the last result of the previous page (encoded as base64 JSON), and are used for OpenSearch 'search_after' pagination, which is stable and works at any depth. A plain integer cursor is still accepted as a result offset, for clients holding cursors from before; offsets are limited to the first 10,000 results.
+type SearchCursor struct {
+	Offset int
+	// sort values of the last result on the previous page; takes precedence over Offset
+	After []json.RawMessage
+}
+
+func ParseSearchCursor(s string) (SearchCursor, error) {
+	var c SearchCursor
+	if s == "" {
+		return c, nil
+	}
+	if offset, err := strconv.Atoi(s); err == nil {
+		c.Offset = max(offset, 0)
+		return c, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, fmt.Errorf("invalid cursor encoding: %w", err)
+	}
+	if err := json.Unmarshal(b, &c.After); err != nil {
+		return c, fmt.Errorf("invalid cursor: %w", err)
+	}
+	if len(c.After) == 0 {
+		return c, fmt.Errorf("invalid cursor: no sort values")
+	}
+	// sort values are only ever strings, numbers, or null; anything else would be passed through to the query
+	for _, v := range c.After {
+		if len(v) == 0 {
+			return c, fmt.Errorf("invalid cursor: empty sort value")
+		}
+		switch v[0] {
+		case '{', '[', 't', 'f':
+			return c, fmt.Errorf("invalid cursor: unexpected sort value")
+		}
+	}
+	return c, nil
+}
+
+func (c SearchCursor) String() string {
+	if len(c.After) == 0 {
+		return strconv.Itoa(c.Offset)
+	}
+	b, err := json.Marshal(c.After)
+	if err != nil {
+		// only fails for invalid raw JSON, which ParseSearchCursor and OpenSearch responses don't produce
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Sets the pagination parameters on a search request body. The query must have a deterministic sort order (ending with a unique tie-breaker) for 'search_after' to be stable.
+func (c SearchCursor) apply(query map[string]any) {
+	if len(c.After) > 0 {
+		query["search_after"] = c.After
+		return
+	}
+	query["from"] = c.Offset
+}
+
+// The offset to validate with checkParams: 'search_after' pages are not limited by depth.
+func (c SearchCursor) depth() int {
+	if len(c.After) > 0 {
+		return 0
+	}
+	return c.Offset
+}
+
+// Cursor for the page after a search response, or nil if this was the last page (fewer results than requested).
+func nextSearchCursor(resp *EsSearchResponse, size int) *string {
+	hits := resp.Hits.Hits
+	if size <= 0 || len(hits) < size {
+		return nil
+	}
+	last := hits[len(hits)-1]
+	if len(last.Sort) == 0 {
+		return nil
+	}
+	s := SearchCursor{After: last.Sort}.String()
+	return &s
+}
+
+// Tie-breaker for sort orders, so pagination is stable between results with equal sort values.
+var sortTieBreaker = map[string]any{"_id": map[string]any{"order": "asc"}}
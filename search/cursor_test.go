@@ -0,0 +1,48 @@
+package search
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchCursor(t *testing.T) {
+	assert := assert.New(t)
+
+	c, err := ParseSearchCursor("")
+	assert.NoError(err)
+	assert.Equal(SearchCursor{}, c)
+
+	// legacy offset cursors
+	c, err = ParseSearchCursor("75")
+	assert.NoError(err)
+	assert.Equal(75, c.Offset)
+	assert.Equal(75, c.depth())
+	q := map[string]any{}
+	c.apply(q)
+	assert.Equal(map[string]any{"from": 75}, q)
+
+	// round-trip of sort values, preserving large integers exactly
+	resp := &EsSearchResponse{}
+	resp.Hits.Hits = []EsSearchHit{
+		{ID: "a"},
+		{ID: "b", Sort: []json.RawMessage{json.RawMessage(`1.5`), json.RawMessage(`1714567890123`), json.RawMessage(`"did:plc:abc_3kabc"`)}},
+	}
+	assert.Nil(nextSearchCursor(resp, 3))
+	next := nextSearchCursor(resp, 2)
+	assert.NotNil(next)
+	c, err = ParseSearchCursor(*next)
+	assert.NoError(err)
+	assert.Equal(0, c.depth())
+	q = map[string]any{}
+	c.apply(q)
+	b, err := json.Marshal(q)
+	assert.NoError(err)
+	assert.Equal(`{"search_after":[1.5,1714567890123,"did:plc:abc_3kabc"]}`, string(b))
+
+	for _, bad := range []string{"not a cursor!", "W10", "W3sieCI6MX1d"} {
+		_, err = ParseSearchCursor(bad)
+		assert.Error(err, bad)
+	}
+}
@@ -0,0 +1,191 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	esapi "github.com/opensearch-project/opensearch-go/v2/opensearchapi"
+)
+
+// Post like and repost counts are not in the repo records, so they are periodically fetched from the AppView and written to the post documents as partial updates. Each round refreshes the recent posts which were refreshed longest ago (or never).
+
+// Max number of posts per app.bsky.feed.getPosts request
+const engagementFetchSize = 25
+
+// Adds the engagement count fields to the post index mapping, so indices created before those fields existed can be ranked and updated without a reindex.
+func (s *Server) ensureEngagementMapping(ctx context.Context) error {
+	b, err := json.Marshal(map[string]any{
+		"properties": map[string]any{
+			"like_count":            map[string]any{"type": "integer"},
+			"repost_count":          map[string]any{"type": "integer"},
+			"engagement_updated_at": map[string]any{"type": "date"},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	req := esapi.IndicesPutMappingRequest{
+		Index: []string{s.postIndex},
+		Body:  bytes.NewReader(b),
+	}
+	res, err := req.Do(ctx, s.escli)
+	if err != nil {
+		return fmt.Errorf("failed to update post index mapping: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read mapping response: %w", err)
+	}
+	if res.IsError() {
+		return fmt.Errorf("failed to update post index mapping, code=%d: %s", res.StatusCode, string(body))
+	}
+	return nil
+}
+
+// Refreshes post engagement counts until the context is cancelled. Does nothing if engagement boosting is not configured.
+func (s *Server) RunEngagementHydrator(ctx context.Context) {
+	if s.relevance == nil || !s.relevance.hydrateEngagement() {
+		return
+	}
+	log := s.logger.With("component", "engagement-hydrator")
+	log.Info("starting engagement hydrator", "appview", s.relevance.AppViewHost, "interval", s.relevance.EngagementRefreshInterval)
+
+	ticker := time.NewTicker(s.relevance.EngagementRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		n, err := s.hydrateEngagement(ctx)
+		if err != nil {
+			log.Error("failed to refresh engagement counts", "err", err)
+			continue
+		}
+		log.Debug("refreshed engagement counts", "posts", n)
+	}
+}
+
+type engagementPost struct {
+	docID string
+	uri   string
+}
+
+// Runs one round of engagement count updates, returning the number of posts updated.
+func (s *Server) hydrateEngagement(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "hydrateEngagement")
+	defer span.End()
+
+	posts, err := s.staleEngagementPosts(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	updated := 0
+	for len(posts) > 0 {
+		chunk := posts[:min(engagementFetchSize, len(posts))]
+		posts = posts[len(chunk):]
+
+		uris := make([]string, len(chunk))
+		for i, p := range chunk {
+			uris[i] = p.uri
+		}
+		out, err := appbsky.FeedGetPosts(ctx, s.appviewxrpc, uris)
+		if err != nil {
+			engagementFetchFailures.Inc()
+			return updated, fmt.Errorf("fetching posts from appview: %w", err)
+		}
+		views := make(map[string]*appbsky.FeedDefs_PostView, len(out.Posts))
+		for _, pv := range out.Posts {
+			views[pv.Uri] = pv
+		}
+
+		// posts missing from the response (deleted, or hidden by the AppView) are marked as updated with zero counts, so they don't block the queue
+		now := syntax.DatetimeNow().String()
+		batch := make([]bulkItem, 0, len(chunk))
+		for _, p := range chunk {
+			var likes, reposts int64
+			if pv := views[p.uri]; pv != nil {
+				if pv.LikeCount != nil {
+					likes = *pv.LikeCount
+				}
+				if pv.RepostCount != nil {
+					reposts = *pv.RepostCount
+				}
+			}
+			b, err := json.Marshal(map[string]any{
+				"doc": map[string]any{
+					"like_count":            likes,
+					"repost_count":          reposts,
+					"engagement_updated_at": now,
+				},
+			})
+			if err != nil {
+				return updated, err
+			}
+			batch = append(batch, bulkItem{action: "update", index: s.postIndex, docID: p.docID, body: b})
+		}
+		results, err := sendBulk(ctx, s.escli, batch)
+		if err != nil {
+			return updated, err
+		}
+		for _, res := range results {
+			// the post may have been deleted from the index since it was selected
+			if res.Error == nil {
+				updated++
+			}
+		}
+	}
+	engagementPostsUpdated.Add(float64(updated))
+	return updated, nil
+}
+
+// Selects the recent posts whose engagement counts were refreshed least recently.
+func (s *Server) staleEngagementPosts(ctx context.Context) ([]engagementPost, error) {
+	query := map[string]any{
+		"size":    s.relevance.EngagementBatchSize,
+		"_source": []string{"did", "record_rkey"},
+		"query": map[string]any{
+			"range": map[string]any{
+				"created_at": map[string]any{"gte": "now-" + esDuration(s.relevance.EngagementMaxAge)},
+			},
+		},
+		"sort": []any{
+			map[string]any{
+				"engagement_updated_at": map[string]any{
+					"order":         "asc",
+					"missing":       "_first",
+					"unmapped_type": "date",
+				},
+			},
+		},
+	}
+	resp, err := doSearch(ctx, s.escli, s.postIndex, query)
+	if err != nil {
+		return nil, err
+	}
+	posts := make([]engagementPost, 0, len(resp.Hits.Hits))
+	for _, hit := range resp.Hits.Hits {
+		var doc struct {
+			DID        string `json:"did"`
+			RecordRkey string `json:"record_rkey"`
+		}
+		if err := json.Unmarshal(hit.Source, &doc); err != nil {
+			return nil, fmt.Errorf("decoding post doc: %w", err)
+		}
+		posts = append(posts, engagementPost{
+			docID: hit.ID,
+			uri:   fmt.Sprintf("at://%s/app.bsky.feed.post/%s", doc.DID, doc.RecordRkey),
+		})
+	}
+	return posts, nil
+}
@@ -23,40 +23,78 @@ import (
 	typegen "github.com/whyrusleeping/cbor-gen"
 )
 
-func (s *Server) getLastCursor() (int64, error) {
+// Returns the last persisted firehose cursor for a relay host, creating the cursor row if needed. Sequence numbers are specific to each relay, so every host has its own cursor. A cursor from before hosts were tracked (with no host) belongs to the primary relay.
+func (s *Server) getLastCursor(host string) (int64, error) {
 	var lastSeq LastSeq
-	if err := s.db.Find(&lastSeq).Error; err != nil {
+	if err := s.db.Where("host = ?", host).Find(&lastSeq).Error; err != nil {
 		return 0, err
 	}
+	if lastSeq.ID != 0 {
+		return lastSeq.Seq, nil
+	}
 
-	if lastSeq.ID == 0 {
-		return 0, s.db.Create(&lastSeq).Error
+	if host == s.bgshost {
+		var legacy LastSeq
+		if err := s.db.Where("host IS NULL OR host = ''").Find(&legacy).Error; err != nil {
+			return 0, err
+		}
+		if legacy.ID != 0 {
+			return legacy.Seq, s.db.Model(&legacy).Update("host", host).Error
+		}
 	}
 
-	return lastSeq.Seq, nil
+	lastSeq.Host = host
+	return 0, s.db.Create(&lastSeq).Error
 }
 
-func (s *Server) updateLastCursor(curs int64) error {
-	return s.db.Model(LastSeq{}).Where("id = 1").Update("seq", curs).Error
+func (s *Server) updateLastCursor(host string, curs int64) error {
+	return s.db.Model(LastSeq{}).Where("host = ?", host).Update("seq", curs).Error
 }
 
 func (s *Server) RunIndexer(ctx context.Context) error {
-	cur, err := s.getLastCursor()
-	if err != nil {
-		return fmt.Errorf("get last cursor: %w", err)
+	if s.bulk != nil {
+		go s.bulk.Run(ctx)
+		go s.runBulkFailureRetries(ctx, time.Minute)
 	}
+	go s.RunEngagementHydrator(ctx)
 
+	resumed, err := s.bfs.ResumeInterrupted(ctx)
+	if err != nil {
+		return fmt.Errorf("resuming interrupted backfill jobs: %w", err)
+	}
+	if resumed > 0 {
+		s.logger.Info("resuming interrupted backfill jobs", "count", resumed)
+	}
 	err = s.bfs.LoadJobs(ctx)
 	if err != nil {
 		return fmt.Errorf("loading backfill jobs: %w", err)
 	}
 	go s.bf.Start()
-	go s.discoverRepos()
+	if s.backfillNotifyURL != "" {
+		go s.bfs.ListenPostgres(ctx, s.backfillNotifyURL)
+	}
+	go s.discoverRepos(ctx, s.bfs)
+	go s.RunConsistencyChecker(ctx)
+	go s.RunOptOutScrubber(ctx)
+
+	if err := s.resumeReindex(ctx); err != nil {
+		return fmt.Errorf("resuming reindex: %w", err)
+	}
+
+	return s.consumeFirehose(ctx)
+}
+
+// Subscribes to the firehose of a single relay, until the connection fails or the context is cancelled.
+func (s *Server) consumeRelay(ctx context.Context, host string) error {
+	cur, err := s.getLastCursor(host)
+	if err != nil {
+		return fmt.Errorf("get last cursor: %w", err)
+	}
 
 	d := websocket.DefaultDialer
-	u, err := url.Parse(s.bgshost)
+	u, err := url.Parse(host)
 	if err != nil {
-		return fmt.Errorf("invalid bgshost URI: %w", err)
+		return fmt.Errorf("invalid relay host URI: %w", err)
 	}
 	u.Path = "xrpc/com.atproto.sync.subscribeRepos"
 	if cur != 0 {
@@ -69,6 +107,8 @@ func (s *Server) RunIndexer(ctx context.Context) error {
 		return fmt.Errorf("events dial failed: %w", err)
 	}
 
+	// for pausing event handlers while OpenSearch is unavailable
+	connCtx := ctx
 	rsc := &events.RepoStreamCallbacks{
 		RepoCommit: func(evt *comatproto.SyncSubscribeRepos_Commit) error {
 			ctx := context.Background()
@@ -77,7 +117,7 @@ func (s *Server) RunIndexer(ctx context.Context) error {
 
 			defer func() {
 				if evt.Seq%50 == 0 {
-					if err := s.updateLastCursor(evt.Seq); err != nil {
+					if err := s.updateLastCursor(host, evt.Seq); err != nil {
 						s.logger.Error("failed to persist cursor", "err", err)
 					}
 				}
@@ -90,7 +130,7 @@ func (s *Server) RunIndexer(ctx context.Context) error {
 			}
 
 			if evt.TooBig {
-				if err := s.processTooBigCommit(ctx, evt); err != nil {
+				if err := s.withOpenSearch(connCtx, func() error { return s.processTooBigCommit(ctx, evt) }); err != nil {
 					// TODO: handle this case (instead of return nil)
 					logEvt.Error("failed to process tooBig event", "err", err)
 					return nil
@@ -100,9 +140,15 @@ func (s *Server) RunIndexer(ctx context.Context) error {
 			}
 
 			// Pass events to the backfiller which will process or buffer as needed
-			if err := s.bf.HandleEvent(ctx, evt); err != nil {
+			if err := s.withOpenSearch(connCtx, func() error { return s.bf.HandleEvent(ctx, evt) }); err != nil {
 				logEvt.Error("failed to handle event", "err", err)
 			}
+			// ... and to the reindex backfiller, which writes to the new indices
+			if rx := s.activeReindex(); rx != nil {
+				if err := s.withOpenSearch(connCtx, func() error { return rx.bf.HandleEvent(ctx, evt) }); err != nil {
+					logEvt.Error("failed to handle event for reindex", "err", err)
+				}
+			}
 
 			return nil
 
@@ -117,25 +163,64 @@ func (s *Server) RunIndexer(ctx context.Context) error {
 				s.logger.Error("bad DID in RepoHandle event", "did", evt.Did, "handle", evt.Handle, "seq", evt.Seq, "err", err)
 				return nil
 			}
-			if err := s.updateUserHandle(ctx, did, evt.Handle); err != nil {
+			if err := s.withOpenSearch(connCtx, func() error { return s.updateUserHandle(ctx, did, evt.Handle) }); err != nil {
 				// TODO: handle this case (instead of return nil)
 				s.logger.Error("failed to update user handle", "did", evt.Did, "handle", evt.Handle, "seq", evt.Seq, "err", err)
 			}
 			return nil
 		},
+		RepoIdentity: func(evt *comatproto.SyncSubscribeRepos_Identity) error {
+			ctx := context.Background()
+			ctx, span := tracer.Start(ctx, "RepoIdentity")
+			defer span.End()
+
+			if err := s.withOpenSearch(connCtx, func() error { return s.handleIdentityEvent(ctx, evt) }); err != nil {
+				s.logger.Error("failed to handle identity event", "did", evt.Did, "seq", evt.Seq, "err", err)
+			}
+			return nil
+		},
+		RepoAccount: func(evt *comatproto.SyncSubscribeRepos_Account) error {
+			ctx := context.Background()
+			ctx, span := tracer.Start(ctx, "RepoAccount")
+			defer span.End()
+
+			if err := s.withOpenSearch(connCtx, func() error { return s.handleAccountEvent(ctx, evt) }); err != nil {
+				s.logger.Error("failed to handle account event", "did", evt.Did, "seq", evt.Seq, "err", err)
+			}
+			return nil
+		},
+		RepoTombstone: func(evt *comatproto.SyncSubscribeRepos_Tombstone) error {
+			ctx := context.Background()
+			ctx, span := tracer.Start(ctx, "RepoTombstone")
+			defer span.End()
+
+			did, err := syntax.ParseDID(evt.Did)
+			if err != nil {
+				s.logger.Error("bad DID in RepoTombstone event", "did", evt.Did, "seq", evt.Seq, "err", err)
+				return nil
+			}
+			err = s.withOpenSearch(connCtx, func() error {
+				_, err := s.PurgeAccount(ctx, did, "tombstone")
+				return err
+			})
+			if err != nil {
+				s.logger.Error("failed to purge tombstoned account", "did", evt.Did, "seq", evt.Seq, "err", err)
+			}
+			return nil
+		},
 	}
 
 	return events.HandleRepoStream(
 		ctx, con, autoscaling.NewScheduler(
 			autoscaling.DefaultAutoscaleSettings(),
-			s.bgshost,
+			host,
 			rsc.EventHandler,
 		),
 	)
 }
 
-func (s *Server) discoverRepos() {
-	ctx := context.Background()
+// Enqueues a backfill job in the store for every repo known to the relay. Returns early (with an error) only if the context is cancelled.
+func (s *Server) discoverRepos(ctx context.Context, store *backfill.Gormstore) error {
 	log := s.logger.With("func", "discoverRepos")
 	log.Info("starting repo discovery")
 
@@ -145,7 +230,26 @@ func (s *Server) discoverRepos() {
 	total := 0
 	totalErrored := 0
 
+	// repos with local CAR files first, as they're quick to backfill
+	if s.carSource != nil {
+		dids, err := s.carSource.Repos()
+		if err != nil {
+			log.Error("failed to list repo CAR files", "dir", s.carSource.Dir, "err", err)
+		}
+		for _, did := range dids {
+			if _, err := store.GetOrCreateJobWithPriority(ctx, did, backfill.StateEnqueued, s.bfOpts.Priorities.Bulk); err != nil {
+				log.Error("failed to get or create job", "did", did, "err", err)
+				totalErrored++
+			}
+		}
+		log.Info("enqueued repos from CAR files", "dir", s.carSource.Dir, "total", len(dids))
+		total += len(dids)
+	}
+
 	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		resp, err := comatproto.SyncListRepos(ctx, s.bgsxrpc, cursor, limit)
 		if err != nil {
 			log.Error("failed to list repos", "err", err)
@@ -155,7 +259,7 @@ func (s *Server) discoverRepos() {
 		log.Info("got repo page", "count", len(resp.Repos), "cursor", resp.Cursor)
 		errored := 0
 		for _, repo := range resp.Repos {
-			_, err := s.bfs.GetOrCreateJob(ctx, repo.Did, backfill.StateEnqueued)
+			_, err := store.GetOrCreateJobWithPriority(ctx, repo.Did, backfill.StateEnqueued, s.bfOpts.Priorities.Bulk)
 			if err != nil {
 				log.Error("failed to get or create job", "did", repo.Did, "err", err)
 				errored++
@@ -172,11 +276,58 @@ func (s *Server) discoverRepos() {
 	}
 
 	log.Info("finished repo discovery", "totalJobs", total, "totalErrored", totalErrored)
+	return nil
+}
+
+// A set of post, profile, and feed indices (or aliases) which documents are written to.
+type indexTarget struct {
+	post    string
+	profile string
+	feed    string
+}
+
+// The configured aliases, which serve searches.
+func (s *Server) primaryTarget() indexTarget {
+	return indexTarget{post: s.postIndex, profile: s.profileIndex, feed: s.feedIndex}
+}
+
+// Record collections which are indexed. Other records in backfilled repos and firehose events are skipped.
+var indexedCollections = []string{
+	"app.bsky.feed.post",
+	"app.bsky.actor.profile",
+	feedGeneratorCollection,
+	listCollection,
+}
+
+func isIndexedPath(path string) bool {
+	for _, c := range indexedCollections {
+		if strings.HasPrefix(path, c+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// All the targets which new documents should be written to: the primary aliases, plus the new indices of any reindex in progress.
+func (s *Server) writeTargets() []indexTarget {
+	targets := []indexTarget{s.primaryTarget()}
+	if rx := s.activeReindex(); rx != nil {
+		targets = append(targets, rx.target())
+	}
+	return targets
 }
 
 func (s *Server) handleCreateOrUpdate(ctx context.Context, rawDID string, rev string, path string, rec typegen.CBORMarshaler, rcid *cid.Cid) error {
-	// Since this gets called in a backfill job, we need to check if the path is a post or profile
-	if !strings.Contains(path, "app.bsky.feed.post") && !strings.Contains(path, "app.bsky.actor.profile") {
+	return s.handleCreateOrUpdateTo(ctx, s.primaryTarget(), rawDID, path, rec, rcid)
+}
+
+func (s *Server) handleDelete(ctx context.Context, rawDID, rev, path string) error {
+	return s.handleDeleteFrom(ctx, s.primaryTarget(), rawDID, path)
+}
+
+func (s *Server) handleCreateOrUpdateTo(ctx context.Context, t indexTarget, rawDID string, path string, rec typegen.CBORMarshaler, rcid *cid.Cid) error {
+	// Since this gets called in a backfill job, we need to check if the path is an indexed record type
+	if !isIndexedPath(path) {
 		return nil
 	}
 
@@ -195,25 +346,25 @@ func (s *Server) handleCreateOrUpdate(ctx context.Context, rawDID string, rev st
 
 	switch rec := rec.(type) {
 	case *bsky.FeedPost:
-		if err := s.indexPost(ctx, ident, rec, path, *rcid); err != nil {
-			postsFailed.Inc()
+		if err := s.indexPost(ctx, t.post, ident, rec, path, *rcid); err != nil {
 			return fmt.Errorf("indexing post for %s: %w", did.String(), err)
 		}
-		postsIndexed.Inc()
 	case *bsky.ActorProfile:
-		if err := s.indexProfile(ctx, ident, rec, path, *rcid); err != nil {
-			profilesFailed.Inc()
+		if err := s.indexProfile(ctx, t.profile, ident, rec, path, *rcid); err != nil {
 			return fmt.Errorf("indexing profile for %s: %w", did.String(), err)
 		}
-		profilesIndexed.Inc()
+	case *bsky.FeedGenerator, *bsky.GraphList:
+		if err := s.indexFeed(ctx, t.feed, ident, rec, path, *rcid); err != nil {
+			return fmt.Errorf("indexing feed for %s: %w", did.String(), err)
+		}
 	default:
 	}
 	return nil
 }
 
-func (s *Server) handleDelete(ctx context.Context, rawDID, rev, path string) error {
-	// Since this gets called in a backfill job, we need to check if the path is a post or profile
-	if !strings.Contains(path, "app.bsky.feed.post") && !strings.Contains(path, "app.bsky.actor.profile") {
+func (s *Server) handleDeleteFrom(ctx context.Context, t indexTarget, rawDID, path string) error {
+	// Since this gets called in a backfill job, we need to check if the path is an indexed record type
+	if !isIndexedPath(path) {
 		return nil
 	}
 
@@ -233,12 +384,19 @@ func (s *Server) handleDelete(ctx context.Context, rawDID, rev, path string) err
 	switch {
 	// TODO: handle profile deletes, its an edge case, but worth doing still
 	case strings.Contains(path, "app.bsky.feed.post"):
-		if err := s.deletePost(ctx, ident, path); err != nil {
+		_, rkey, err := splitRecordPath(path)
+		if err != nil {
+			return err
+		}
+		if err := s.deletePost(ctx, t.post, ident, rkey); err != nil {
 			return err
 		}
-		postsDeleted.Inc()
 	case strings.Contains(path, "app.bsky.actor.profile"):
 		// profilesDeleted.Inc()
+	case strings.HasPrefix(path, feedGeneratorCollection+"/"), strings.HasPrefix(path, listCollection+"/"):
+		if err := s.deleteFeed(ctx, t.feed, ident, path); err != nil {
+			return err
+		}
 	}
 
 	return nil
@@ -268,8 +426,9 @@ func (s *Server) processTooBigCommit(ctx context.Context, evt *comatproto.SyncSu
 		return fmt.Errorf("identity not found for did: %s", did.String())
 	}
 
+	targets := s.writeTargets()
 	return r.ForEach(ctx, "", func(k string, v cid.Cid) error {
-		if strings.HasPrefix(k, "app.bsky.feed.post") || strings.HasPrefix(k, "app.bsky.actor.profile") {
+		if isIndexedPath(k) {
 			rcid, rec, err := r.GetRecord(ctx, k)
 			if err != nil {
 				// TODO: handle this case (instead of return nil)
@@ -277,16 +436,22 @@ func (s *Server) processTooBigCommit(ctx context.Context, evt *comatproto.SyncSu
 				return nil
 			}
 
-			switch rec := rec.(type) {
-			case *bsky.FeedPost:
-				if err := s.indexPost(ctx, ident, rec, k, rcid); err != nil {
-					return fmt.Errorf("indexing post: %w", err)
-				}
-			case *bsky.ActorProfile:
-				if err := s.indexProfile(ctx, ident, rec, k, rcid); err != nil {
-					return fmt.Errorf("indexing profile: %w", err)
+			for _, t := range targets {
+				switch rec := rec.(type) {
+				case *bsky.FeedPost:
+					if err := s.indexPost(ctx, t.post, ident, rec, k, rcid); err != nil {
+						return fmt.Errorf("indexing post: %w", err)
+					}
+				case *bsky.ActorProfile:
+					if err := s.indexProfile(ctx, t.profile, ident, rec, k, rcid); err != nil {
+						return fmt.Errorf("indexing profile: %w", err)
+					}
+				case *bsky.FeedGenerator, *bsky.GraphList:
+					if err := s.indexFeed(ctx, t.feed, ident, rec, k, rcid); err != nil {
+						return fmt.Errorf("indexing feed: %w", err)
+					}
+				default:
 				}
-			default:
 			}
 
 		}
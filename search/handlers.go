@@ -3,39 +3,34 @@ package search
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 
 	appbsky "github.com/bluesky-social/indigo/api/bsky"
 	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/backfill"
 
 	"github.com/labstack/echo/v4"
 	otel "go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var tracer = otel.Tracer("search")
 
-func parseCursorLimit(e echo.Context) (int, int, error) {
-	offset := 0
-	if c := strings.TrimSpace(e.QueryParam("cursor")); c != "" {
-		v, err := strconv.Atoi(c)
-		if err != nil {
-			return 0, 0, &echo.HTTPError{
-				Code:    400,
-				Message: fmt.Sprintf("invalid value for 'cursor': %s", err),
-			}
+func parseCursorLimit(e echo.Context) (SearchCursor, int, error) {
+	cursor, err := ParseSearchCursor(strings.TrimSpace(e.QueryParam("cursor")))
+	if err != nil {
+		return cursor, 0, &echo.HTTPError{
+			Code:    400,
+			Message: fmt.Sprintf("invalid value for 'cursor': %s", err),
 		}
-		offset = v
 	}
-
-	if offset < 0 {
-		offset = 0
-	}
-	if offset > 10000 {
-		return 0, 0, &echo.HTTPError{
+	if cursor.Offset > 10000 {
+		return cursor, 0, &echo.HTTPError{
 			Code:    400,
 			Message: fmt.Sprintf("invalid value for 'cursor' (can't paginate so deep)"),
 		}
@@ -45,7 +40,7 @@ func parseCursorLimit(e echo.Context) (int, int, error) {
 	if l := strings.TrimSpace(e.QueryParam("limit")); l != "" {
 		v, err := strconv.Atoi(l)
 		if err != nil {
-			return 0, 0, &echo.HTTPError{
+			return cursor, 0, &echo.HTTPError{
 				Code:    400,
 				Message: fmt.Sprintf("invalid value for 'count': %s", err),
 			}
@@ -60,7 +55,7 @@ func parseCursorLimit(e echo.Context) (int, int, error) {
 	if limit < 0 {
 		limit = 0
 	}
-	return offset, limit, nil
+	return cursor, limit, nil
 }
 
 func (s *Server) handleSearchPostsSkeleton(e echo.Context) error {
@@ -76,16 +71,37 @@ func (s *Server) handleSearchPostsSkeleton(e echo.Context) error {
 		})
 	}
 
-	offset, limit, err := parseCursorLimit(e)
+	cursor, limit, err := parseCursorLimit(e)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", fmt.Sprintf("invalid cursor/limit: %s", err)))
 		span.SetStatus(codes.Error, err.Error())
 		return err
 	}
 
-	span.SetAttributes(attribute.Int("offset", offset), attribute.Int("limit", limit))
+	highlight := false
+	if h := strings.TrimSpace(e.QueryParam("highlight")); h == "true" || h == "1" || h == "y" {
+		highlight = true
+	}
+
+	span.SetAttributes(
+		attribute.Int("offset", cursor.Offset),
+		attribute.Bool("search_after", len(cursor.After) > 0),
+		attribute.Int("limit", limit),
+		attribute.Bool("highlight", highlight),
+	)
 
-	out, err := s.SearchPosts(ctx, q, offset, limit)
+	q, blocked := s.queryFilter.Filter(SanitizeQuery(q), requestLanguages(e.Request()))
+	if blocked {
+		span.SetAttributes(attribute.Bool("blocked", true))
+		if s.queryFilter.Policy() == BlockedQueryPolicyReject {
+			return e.JSON(400, map[string]any{
+				"error": "search query not allowed",
+			})
+		}
+		return e.JSON(200, SearchPostsSkeletonOutput{Posts: []*SkeletonSearchPost{}})
+	}
+
+	out, err := s.SearchPosts(ctx, q, cursor, limit, highlight)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", fmt.Sprintf("failed to SearchPosts: %s", err)))
 		span.SetStatus(codes.Error, err.Error())
@@ -110,7 +126,7 @@ func (s *Server) handleSearchActorsSkeleton(e echo.Context) error {
 		})
 	}
 
-	offset, limit, err := parseCursorLimit(e)
+	cursor, limit, err := parseCursorLimit(e)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", fmt.Sprintf("invalid cursor/limit: %s", err)))
 		span.SetStatus(codes.Error, err.Error())
@@ -123,12 +139,24 @@ func (s *Server) handleSearchActorsSkeleton(e echo.Context) error {
 	}
 
 	span.SetAttributes(
-		attribute.Int("offset", offset),
+		attribute.Int("offset", cursor.Offset),
+		attribute.Bool("search_after", len(cursor.After) > 0),
 		attribute.Int("limit", limit),
 		attribute.Bool("typeahead", typeahead),
 	)
 
-	out, err := s.SearchProfiles(ctx, q, typeahead, offset, limit)
+	q, blocked := s.queryFilter.Filter(SanitizeQuery(q), requestLanguages(e.Request()))
+	if blocked {
+		span.SetAttributes(attribute.Bool("blocked", true))
+		if s.queryFilter.Policy() == BlockedQueryPolicyReject {
+			return e.JSON(400, map[string]any{
+				"error": "search query not allowed",
+			})
+		}
+		return e.JSON(200, appbsky.UnspeccedSearchActorsSkeleton_Output{Actors: []*appbsky.UnspeccedDefs_SkeletonSearchActor{}})
+	}
+
+	out, err := s.SearchProfiles(ctx, q, typeahead, cursor, limit)
 	if err != nil {
 		span.SetAttributes(attribute.String("error", fmt.Sprintf("failed to SearchProfiles: %s", err)))
 		span.SetStatus(codes.Error, err.Error())
@@ -140,6 +168,185 @@ func (s *Server) handleSearchActorsSkeleton(e echo.Context) error {
 	return e.JSON(200, out)
 }
 
+// Autocomplete variant of actor search, for search-as-you-type UIs. There is no cursor: only the first page of results is returned, and the default limit is lower.
+func (s *Server) handleSearchActorsSkeletonTypeahead(e echo.Context) error {
+	ctx, span := tracer.Start(e.Request().Context(), "handleSearchActorsSkeletonTypeahead")
+	defer span.End()
+
+	span.SetAttributes(attribute.String("query", e.QueryParam("q")))
+
+	// a lone "@" (as typed in front of a handle) isn't a query yet
+	q := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(e.QueryParam("q")), "@"))
+	if q == "" {
+		return e.JSON(400, map[string]any{
+			"error": "must pass non-empty search query",
+		})
+	}
+
+	_, limit, err := parseCursorLimit(e)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", fmt.Sprintf("invalid cursor/limit: %s", err)))
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	if strings.TrimSpace(e.QueryParam("limit")) == "" {
+		limit = 10
+	}
+
+	span.SetAttributes(attribute.Int("limit", limit))
+
+	q, blocked := s.queryFilter.Filter(SanitizeQuery(q), requestLanguages(e.Request()))
+	if blocked {
+		span.SetAttributes(attribute.Bool("blocked", true))
+		if s.queryFilter.Policy() == BlockedQueryPolicyReject {
+			return e.JSON(400, map[string]any{
+				"error": "search query not allowed",
+			})
+		}
+		return e.JSON(200, appbsky.UnspeccedSearchActorsSkeleton_Output{Actors: []*appbsky.UnspeccedDefs_SkeletonSearchActor{}})
+	}
+
+	out, err := s.SearchProfiles(ctx, q, true, SearchCursor{}, limit)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", fmt.Sprintf("failed to SearchProfiles: %s", err)))
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	out.Cursor = nil
+
+	span.SetAttributes(attribute.Int("actors.length", len(out.Actors)))
+
+	return e.JSON(200, out)
+}
+
+// Same as the app.bsky.unspecced.searchPostsSkeleton Lexicon output, with optional highlights.
+type SearchPostsSkeletonOutput struct {
+	Cursor    *string               `json:"cursor,omitempty"`
+	HitsTotal *int64                `json:"hitsTotal,omitempty"`
+	Posts     []*SkeletonSearchPost `json:"posts"`
+}
+
+type SkeletonSearchPost struct {
+	Uri string `json:"uri"`
+	// only included if requested, and any terms matched the post text or image alt text
+	Highlights []*SearchHighlight `json:"highlights,omitempty"`
+}
+
+// There are no lexicons for feed generator or list search yet; these mirror the post and actor skeleton responses.
+
+type SkeletonSearchFeed struct {
+	Uri string `json:"uri"`
+}
+
+type SearchFeedsSkeletonOutput struct {
+	Cursor    *string               `json:"cursor,omitempty"`
+	HitsTotal *int64                `json:"hitsTotal,omitempty"`
+	Feeds     []*SkeletonSearchFeed `json:"feeds"`
+}
+
+type SkeletonSearchList struct {
+	Uri string `json:"uri"`
+}
+
+type SearchListsSkeletonOutput struct {
+	Cursor    *string               `json:"cursor,omitempty"`
+	HitsTotal *int64                `json:"hitsTotal,omitempty"`
+	Lists     []*SkeletonSearchList `json:"lists"`
+}
+
+func (s *Server) handleSearchFeedsSkeleton(e echo.Context) error {
+	ctx, span := tracer.Start(e.Request().Context(), "handleSearchFeedsSkeleton")
+	defer span.End()
+
+	params, err := s.parseFeedSearchParams(e, span)
+	if err != nil || params == nil {
+		return err
+	}
+	if params.blocked {
+		return e.JSON(200, SearchFeedsSkeletonOutput{Feeds: []*SkeletonSearchFeed{}})
+	}
+
+	uris, cursor, hitsTotal, err := s.SearchFeeds(ctx, feedGeneratorCollection, params.q, params.cursor, params.limit)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", fmt.Sprintf("failed to SearchFeeds: %s", err)))
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	out := SearchFeedsSkeletonOutput{Feeds: []*SkeletonSearchFeed{}, Cursor: cursor, HitsTotal: hitsTotal}
+	for _, u := range uris {
+		out.Feeds = append(out.Feeds, &SkeletonSearchFeed{Uri: u})
+	}
+	span.SetAttributes(attribute.Int("feeds.length", len(out.Feeds)))
+	return e.JSON(200, out)
+}
+
+func (s *Server) handleSearchListsSkeleton(e echo.Context) error {
+	ctx, span := tracer.Start(e.Request().Context(), "handleSearchListsSkeleton")
+	defer span.End()
+
+	params, err := s.parseFeedSearchParams(e, span)
+	if err != nil || params == nil {
+		return err
+	}
+	if params.blocked {
+		return e.JSON(200, SearchListsSkeletonOutput{Lists: []*SkeletonSearchList{}})
+	}
+
+	uris, cursor, hitsTotal, err := s.SearchFeeds(ctx, listCollection, params.q, params.cursor, params.limit)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", fmt.Sprintf("failed to SearchFeeds: %s", err)))
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+
+	out := SearchListsSkeletonOutput{Lists: []*SkeletonSearchList{}, Cursor: cursor, HitsTotal: hitsTotal}
+	for _, u := range uris {
+		out.Lists = append(out.Lists, &SkeletonSearchList{Uri: u})
+	}
+	span.SetAttributes(attribute.Int("lists.length", len(out.Lists)))
+	return e.JSON(200, out)
+}
+
+type feedSearchParams struct {
+	q      string
+	cursor SearchCursor
+	limit  int
+	// the query was blocked by the query filter; the caller should return an empty result
+	blocked bool
+}
+
+// Common query, cursor, and limit handling for the feed generator and list endpoints. Returns nil (and no error) if an error response has already been written.
+func (s *Server) parseFeedSearchParams(e echo.Context, span trace.Span) (*feedSearchParams, error) {
+	span.SetAttributes(attribute.String("query", e.QueryParam("q")))
+
+	q := strings.TrimSpace(e.QueryParam("q"))
+	if q == "" {
+		return nil, e.JSON(400, map[string]any{
+			"error": "must pass non-empty search query",
+		})
+	}
+
+	cursor, limit, err := parseCursorLimit(e)
+	if err != nil {
+		span.SetAttributes(attribute.String("error", fmt.Sprintf("invalid cursor/limit: %s", err)))
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int("offset", cursor.Offset), attribute.Bool("search_after", len(cursor.After) > 0), attribute.Int("limit", limit))
+
+	q, blocked := s.queryFilter.Filter(SanitizeQuery(q), requestLanguages(e.Request()))
+	if blocked {
+		span.SetAttributes(attribute.Bool("blocked", true))
+		if s.queryFilter.Policy() == BlockedQueryPolicyReject {
+			return nil, e.JSON(400, map[string]any{
+				"error": "search query not allowed",
+			})
+		}
+	}
+	return &feedSearchParams{q: q, cursor: cursor, limit: limit, blocked: blocked}, nil
+}
+
 type IndexError struct {
 	DID string `json:"did"`
 	Err string `json:"err"`
@@ -170,8 +377,9 @@ func (s *Server) handleIndexRepos(e echo.Context) error {
 	skipped := 0
 	for _, did := range dids {
 		job, err := s.bfs.GetJob(ctx, did)
-		if job == nil && err == nil {
-			err := s.bfs.EnqueueJob(ctx, did)
+		// repos which are not yet backfilled (or in progress) are enqueued ahead of bulk backfill
+		if errors.Is(err, backfill.ErrJobNotFound) || (err == nil && job.State() != backfill.StateComplete && job.State() != backfill.StateInProgress) {
+			err := s.bfs.EnqueueJobWithPriority(ctx, did, s.bfOpts.Priorities.Requested)
 			if err != nil {
 				errs = append(errs, IndexError{
 					DID: did,
@@ -193,16 +401,16 @@ func (s *Server) handleIndexRepos(e echo.Context) error {
 	})
 }
 
-func (s *Server) SearchPosts(ctx context.Context, q string, offset, size int) (*appbsky.UnspeccedSearchPostsSkeleton_Output, error) {
+func (s *Server) SearchPosts(ctx context.Context, q string, cursor SearchCursor, size int, highlight bool) (*SearchPostsSkeletonOutput, error) {
 	ctx, span := tracer.Start(ctx, "SearchPosts")
 	defer span.End()
 
-	resp, err := DoSearchPosts(ctx, s.dir, s.escli, s.postIndex, q, offset, size)
+	resp, err := DoSearchPostsRanked(ctx, s.dir, s.escli, s.postIndex, q, s.relevance, cursor, size, highlight)
 	if err != nil {
 		return nil, err
 	}
 
-	posts := []*appbsky.UnspeccedDefs_SkeletonSearchPost{}
+	posts := []*SkeletonSearchPost{}
 	for _, r := range resp.Hits.Hits {
 		var doc PostDoc
 		if err := json.Unmarshal(r.Source, &doc); err != nil {
@@ -214,16 +422,13 @@ func (s *Server) SearchPosts(ctx context.Context, q string, offset, size int) (*
 			return nil, fmt.Errorf("invalid DID in indexed document: %w", err)
 		}
 
-		posts = append(posts, &appbsky.UnspeccedDefs_SkeletonSearchPost{
-			Uri: fmt.Sprintf("at://%s/app.bsky.feed.post/%s", did, doc.RecordRkey),
+		posts = append(posts, &SkeletonSearchPost{
+			Uri:        fmt.Sprintf("at://%s/app.bsky.feed.post/%s", did, doc.RecordRkey),
+			Highlights: parseHighlights(r.Highlight),
 		})
 	}
 
-	out := appbsky.UnspeccedSearchPostsSkeleton_Output{Posts: posts}
-	if len(posts) == size && (offset+size) < 10000 {
-		s := fmt.Sprintf("%d", offset+size)
-		out.Cursor = &s
-	}
+	out := SearchPostsSkeletonOutput{Posts: posts, Cursor: nextSearchCursor(resp, size)}
 	if resp.Hits.Total.Relation == "eq" {
 		i := int64(resp.Hits.Total.Value)
 		out.HitsTotal = &i
@@ -231,7 +436,7 @@ func (s *Server) SearchPosts(ctx context.Context, q string, offset, size int) (*
 	return &out, nil
 }
 
-func (s *Server) SearchProfiles(ctx context.Context, q string, typeahead bool, offset, size int) (*appbsky.UnspeccedSearchActorsSkeleton_Output, error) {
+func (s *Server) SearchProfiles(ctx context.Context, q string, typeahead bool, cursor SearchCursor, size int) (*appbsky.UnspeccedSearchActorsSkeleton_Output, error) {
 	ctx, span := tracer.Start(ctx, "SearchProfiles")
 	defer span.End()
 
@@ -240,7 +445,7 @@ func (s *Server) SearchProfiles(ctx context.Context, q string, typeahead bool, o
 	if typeahead {
 		resp, err = DoSearchProfilesTypeahead(ctx, s.escli, s.profileIndex, q, size)
 	} else {
-		resp, err = DoSearchProfiles(ctx, s.dir, s.escli, s.profileIndex, q, offset, size)
+		resp, err = DoSearchProfilesRanked(ctx, s.dir, s.escli, s.profileIndex, q, s.relevance, cursor, size)
 	}
 	if err != nil {
 		return nil, err
@@ -263,14 +468,40 @@ func (s *Server) SearchProfiles(ctx context.Context, q string, typeahead bool, o
 		})
 	}
 
-	out := appbsky.UnspeccedSearchActorsSkeleton_Output{Actors: actors}
-	if len(actors) == size && (offset+size) < 10000 {
-		s := fmt.Sprintf("%d", offset+size)
-		out.Cursor = &s
-	}
+	out := appbsky.UnspeccedSearchActorsSkeleton_Output{Actors: actors, Cursor: nextSearchCursor(resp, size)}
 	if resp.Hits.Total.Relation == "eq" {
 		i := int64(resp.Hits.Total.Value)
 		out.HitsTotal = &i
 	}
 	return &out, nil
 }
+
+// Searches feed generator or list records (depending on the collection), returning AT-URIs, a cursor if there may be more results, and the total hit count if known.
+func (s *Server) SearchFeeds(ctx context.Context, collection, q string, cursor SearchCursor, size int) ([]string, *string, *int64, error) {
+	ctx, span := tracer.Start(ctx, "SearchFeeds")
+	defer span.End()
+
+	resp, err := DoSearchFeeds(ctx, s.dir, s.escli, s.feedIndex, collection, q, cursor, size)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	uris := []string{}
+	for _, r := range resp.Hits.Hits {
+		var doc FeedDoc
+		if err := json.Unmarshal(r.Source, &doc); err != nil {
+			return nil, nil, nil, fmt.Errorf("decoding feed doc from search response: %w", err)
+		}
+		if _, err := syntax.ParseDID(doc.DID); err != nil {
+			return nil, nil, nil, fmt.Errorf("invalid DID in indexed document: %w", err)
+		}
+		uris = append(uris, doc.URI())
+	}
+
+	var hitsTotal *int64
+	if resp.Hits.Total.Relation == "eq" {
+		i := int64(resp.Hits.Total.Value)
+		hitsTotal = &i
+	}
+	return uris, nextSearchCursor(resp, size), hitsTotal, nil
+}
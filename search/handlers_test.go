@@ -0,0 +1,114 @@
+package search
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfilesTypeaheadQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	query := profilesTypeaheadQuery(" @Alice.bsky ", 10)
+	assert.Equal(10, query["size"])
+	should := query["query"].(map[string]interface{})["bool"].(map[string]interface{})["should"].([]interface{})
+	assert.Len(should, 3)
+
+	ngram := should[0].(map[string]interface{})["multi_match"].(map[string]interface{})
+	assert.Equal("Alice.bsky", ngram["query"])
+	assert.Equal([]string{"handle_ngram^2", "display_name_ngram"}, ngram["fields"])
+
+	legacy := should[1].(map[string]interface{})["multi_match"].(map[string]interface{})
+	assert.Equal("Alice.bsky", legacy["query"])
+	assert.Equal("bool_prefix", legacy["type"])
+
+	// handle prefix matches are on the lower-cased query
+	prefix := should[2].(map[string]interface{})["prefix"].(map[string]interface{})["handle"].(map[string]interface{})
+	assert.Equal("alice.bsky", prefix["value"])
+}
+
+func TestHandleSearchActorsSkeletonTypeahead(t *testing.T) {
+	assert := assert.New(t)
+
+	var lk sync.Mutex
+	var searches []map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/palomar_profile/_search" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		b, _ := io.ReadAll(r.Body)
+		var query map[string]any
+		if err := json.Unmarshal(b, &query); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lk.Lock()
+		searches = append(searches, query)
+		lk.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"took":1,"timed_out":false,"hits":{"total":{"value":1,"relation":"eq"},"hits":[{"_index":"palomar_profile","_id":"did:plc:abc123","_score":1,"_source":{"did":"did:plc:abc123","handle":"alice.example.com"}}]}}`)
+	}))
+	defer srv.Close()
+	escli, err := es.NewClient(es.Config{Addresses: []string{srv.URL}})
+	assert.NoError(err)
+	s := &Server{escli: escli, profileIndex: "palomar_profile", logger: slog.Default()}
+
+	get := func(params url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/xrpc/app.bsky.unspecced.searchActorsSkeletonTypeahead?"+params.Encode(), nil)
+		rec := httptest.NewRecorder()
+		e := echo.New()
+		if err := s.handleSearchActorsSkeletonTypeahead(e.NewContext(req, rec)); err != nil {
+			e.HTTPErrorHandler(err, e.NewContext(req, rec))
+		}
+		return rec
+	}
+
+	// empty queries, including a lone "@", are rejected without searching
+	for _, q := range []string{"", "  ", "@", " @ "} {
+		rec := get(url.Values{"q": {q}})
+		assert.Equal(http.StatusBadRequest, rec.Code, "query %q", q)
+		assert.Contains(rec.Body.String(), "must pass non-empty search query")
+	}
+	assert.Empty(searches)
+
+	rec := get(url.Values{"q": {"@Alice"}})
+	assert.Equal(http.StatusOK, rec.Code)
+	var out struct {
+		Cursor *string `json:"cursor"`
+		Actors []struct {
+			Did string `json:"did"`
+		} `json:"actors"`
+	}
+	assert.NoError(json.Unmarshal(rec.Body.Bytes(), &out))
+	assert.Nil(out.Cursor)
+	assert.Len(out.Actors, 1)
+	assert.Equal("did:plc:abc123", out.Actors[0].Did)
+
+	// default limit of 10, and the "@" is not part of the query
+	assert.Len(searches, 1)
+	assert.EqualValues(10, searches[0]["size"])
+	body, err := json.Marshal(searches[0])
+	assert.NoError(err)
+	assert.Contains(string(body), `"value":"alice"`)
+	assert.False(strings.Contains(string(body), "@"))
+
+	rec = get(url.Values{"q": {"alice"}, "limit": {"5"}})
+	assert.Equal(http.StatusOK, rec.Code)
+	assert.Len(searches, 2)
+	assert.EqualValues(5, searches[1]["size"])
+
+	rec = get(url.Values{"q": {"alice"}, "limit": {"lots"}})
+	assert.Equal(http.StatusBadRequest, rec.Code)
+	assert.Len(searches, 2)
+}
@@ -0,0 +1,88 @@
+package search
+
+import (
+	"strings"
+)
+
+// Marks the start and end of matched terms in OpenSearch highlight fragments. These are Unicode private-use characters, which are stripped from the returned text.
+const (
+	highlightPreTag  = "\ue000"
+	highlightPostTag = "\ue001"
+)
+
+// Post document fields which are highlighted, and the names they are returned under.
+var postHighlightFields = map[string]string{
+	"text":               "text",
+	"embed_img_alt_text": "altText",
+}
+
+// The "highlight" section of a post search query. Queries match against the combined "everything" field, so matches are not required to be in the highlighted field itself. Whole field values are returned (not fragments), so match offsets apply directly to the record text.
+func postHighlightQuery() map[string]any {
+	fields := map[string]any{}
+	for f := range postHighlightFields {
+		fields[f] = map[string]any{"number_of_fragments": 0}
+	}
+	return map[string]any{
+		"pre_tags":            []string{highlightPreTag},
+		"post_tags":           []string{highlightPostTag},
+		"require_field_match": false,
+		"fields":              fields,
+	}
+}
+
+// Matched terms in a field of a search result.
+type SearchHighlight struct {
+	// "text" (post text) or "altText" (image alt text)
+	Field string `json:"field"`
+	// the field value
+	Text string `json:"text"`
+	// matched terms, as UTF-8 byte ranges of Text (like rich text facets)
+	Matches []HighlightMatch `json:"matches"`
+}
+
+type HighlightMatch struct {
+	ByteStart int `json:"byteStart"`
+	ByteEnd   int `json:"byteEnd"`
+}
+
+// Converts the "highlight" section of a search hit to structured highlights, in a stable order (by field, then value).
+func parseHighlights(hl map[string][]string) []*SearchHighlight {
+	var out []*SearchHighlight
+	for _, f := range []string{"text", "embed_img_alt_text"} {
+		for _, frag := range hl[f] {
+			h := parseHighlightFragment(frag)
+			if len(h.Matches) == 0 {
+				continue
+			}
+			h.Field = postHighlightFields[f]
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+func parseHighlightFragment(frag string) *SearchHighlight {
+	var text strings.Builder
+	h := &SearchHighlight{Matches: []HighlightMatch{}}
+	start := -1
+	for len(frag) > 0 {
+		i := strings.IndexAny(frag, highlightPreTag+highlightPostTag)
+		if i < 0 {
+			text.WriteString(frag)
+			break
+		}
+		text.WriteString(frag[:i])
+		if strings.HasPrefix(frag[i:], highlightPreTag) {
+			start = text.Len()
+			frag = frag[i+len(highlightPreTag):]
+			continue
+		}
+		if start >= 0 && text.Len() > start {
+			h.Matches = append(h.Matches, HighlightMatch{ByteStart: start, ByteEnd: text.Len()})
+		}
+		start = -1
+		frag = frag[i+len(highlightPostTag):]
+	}
+	h.Text = text.String()
+	return h
+}
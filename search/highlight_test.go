@@ -0,0 +1,30 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseHighlights(t *testing.T) {
+	assert := assert.New(t)
+
+	hl := parseHighlights(map[string][]string{
+		"text":               {"the \ue000café\ue001 on the \ue000corner\ue001"},
+		"embed_img_alt_text": {"no matches here", "a \ue000café\ue001"},
+	})
+	assert.Equal([]*SearchHighlight{
+		{
+			Field:   "text",
+			Text:    "the café on the corner",
+			Matches: []HighlightMatch{{ByteStart: 4, ByteEnd: 9}, {ByteStart: 17, ByteEnd: 23}},
+		},
+		{
+			Field:   "altText",
+			Text:    "a café",
+			Matches: []HighlightMatch{{ByteStart: 2, ByteEnd: 7}},
+		},
+	}, hl)
+
+	assert.Nil(parseHighlights(nil))
+}
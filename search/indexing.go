@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
+	"net/http"
 	"regexp"
 	"strings"
 
@@ -13,21 +15,31 @@ import (
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/atproto/syntax"
 	"github.com/ipfs/go-cid"
+	typegen "github.com/whyrusleeping/cbor-gen"
 	"go.opentelemetry.io/otel/attribute"
 
 	esapi "github.com/opensearch-project/opensearch-go/v2/opensearchapi"
 )
 
-func (s *Server) deletePost(ctx context.Context, ident *identity.Identity, rkey string) error {
+func (s *Server) deletePost(ctx context.Context, index string, ident *identity.Identity, rkey string) error {
 	ctx, span := tracer.Start(ctx, "deletePost")
 	defer span.End()
 	span.SetAttributes(attribute.String("repo", ident.DID.String()), attribute.String("rkey", rkey))
 
-	log := s.logger.With("repo", ident.DID, "rkey", rkey, "op", "deletePost")
+	log := s.logger.With("repo", ident.DID, "rkey", rkey, "op", "deletePost", "index", index)
 	log.Info("deleting post from index")
 	docID := fmt.Sprintf("%s_%s", ident.DID.String(), rkey)
+	done := func(err error) {
+		if err == nil {
+			postsDeleted.Inc()
+		}
+	}
+	if s.bulk != nil {
+		return s.bulk.Delete(ctx, index, docID, s.bulkDone(ident.DID, done))
+	}
+
 	req := esapi.DeleteRequest{
-		Index:      s.postIndex,
+		Index:      index,
 		DocumentID: docID,
 		Refresh:    "true",
 	}
@@ -45,18 +57,58 @@ func (s *Server) deletePost(ctx context.Context, ident *identity.Identity, rkey
 		log.Warn("opensearch indexing error", "status_code", res.StatusCode, "response", res, "body", string(body))
 		return fmt.Errorf("indexing error, code=%d", res.StatusCode)
 	}
+	done(nil)
 	return nil
 }
 
-func (s *Server) indexPost(ctx context.Context, ident *identity.Identity, rec *appbsky.FeedPost, path string, rcid cid.Cid) error {
+// Indexes (creates or replaces) a single document of a repo: queued through the bulk indexer if there is one, otherwise sent immediately. The callback is called with the final outcome.
+//
+// NOTE: with the bulk indexer, a nil error only means the document was queued. If it later fails to be written, the repo is re-backfilled (see bulkFailures).
+func (s *Server) indexDocument(ctx context.Context, log *slog.Logger, did syntax.DID, index, docID string, b []byte, done func(error)) error {
+	if s.bulk != nil {
+		return s.bulk.Index(ctx, index, docID, b, s.bulkDone(did, done))
+	}
+
+	err := s.indexDocumentNow(ctx, log, index, docID, b)
+	done(err)
+	return err
+}
+
+func (s *Server) indexDocumentNow(ctx context.Context, log *slog.Logger, index, docID string, b []byte) error {
+	req := esapi.IndexRequest{
+		Index:      index,
+		DocumentID: docID,
+		Body:       bytes.NewReader(b),
+	}
+
+	res, err := req.Do(ctx, s.escli)
+	if err != nil {
+		log.Warn("failed to send indexing request", "err", err)
+		return fmt.Errorf("failed to send indexing request: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		log.Warn("failed to read indexing response", "err", err)
+		return fmt.Errorf("failed to read indexing response: %w", err)
+	}
+	if res.IsError() {
+		log.Warn("opensearch indexing error", "status_code", res.StatusCode, "response", res, "body", string(body))
+		return fmt.Errorf("indexing error, code=%d", res.StatusCode)
+	}
+	return nil
+}
+
+// TODO: replace with an atproto/syntax package type for TID
+var tidRegex = regexp.MustCompile(`^[234567abcdefghijklmnopqrstuvwxyz]{13}$`)
+
+func (s *Server) indexPost(ctx context.Context, index string, ident *identity.Identity, rec *appbsky.FeedPost, path string, rcid cid.Cid) error {
 	ctx, span := tracer.Start(ctx, "indexPost")
 	defer span.End()
 	span.SetAttributes(attribute.String("repo", ident.DID.String()), attribute.String("path", path))
 
-	log := s.logger.With("repo", ident.DID, "path", path, "op", "indexPost")
+	log := s.logger.With("repo", ident.DID, "path", path, "op", "indexPost", "index", index)
 	parts := strings.SplitN(path, "/", 3)
-	// TODO: replace with an atproto/syntax package type for TID
-	var tidRegex = regexp.MustCompile(`^[234567abcdefghijklmnopqrstuvwxyz]{13}$`)
 	if len(parts) != 2 || !tidRegex.MatchString(parts[1]) {
 		log.Warn("skipping index post record with weird path/TID", "did", ident.DID, "path", path)
 		return nil
@@ -64,6 +116,11 @@ func (s *Server) indexPost(ctx context.Context, ident *identity.Identity, rec *a
 	rkey := parts[1]
 
 	log = log.With("rkey", rkey)
+	if _, ok := s.optOutReason(ident.DID); ok {
+		log.Debug("skipping post of opted-out account")
+		optOutDocsSkipped.WithLabelValues("post").Inc()
+		return nil
+	}
 
 	_, err := syntax.ParseDatetimeLenient(rec.CreatedAt)
 	if err != nil {
@@ -78,42 +135,43 @@ func (s *Server) indexPost(ctx context.Context, ident *identity.Identity, rec *a
 	}
 
 	log.Debug("indexing post")
-	req := esapi.IndexRequest{
-		Index:      s.postIndex,
-		DocumentID: doc.DocId(),
-		Body:       bytes.NewReader(b),
-	}
-
-	res, err := req.Do(ctx, s.escli)
-	if err != nil {
-		log.Warn("failed to send indexing request", "err", err)
-		return fmt.Errorf("failed to send indexing request: %w", err)
-	}
-	defer res.Body.Close()
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		log.Warn("failed to read indexing response", "err", err)
-		return fmt.Errorf("failed to read indexing response: %w", err)
-	}
-	if res.IsError() {
-		log.Warn("opensearch indexing error", "status_code", res.StatusCode, "response", res, "body", string(body))
-		return fmt.Errorf("indexing error, code=%d", res.StatusCode)
-	}
-	return nil
+	return s.indexDocument(ctx, log, ident.DID, index, doc.DocId(), b, func(err error) {
+		if err != nil {
+			postsFailed.Inc()
+		} else {
+			postsIndexed.Inc()
+		}
+	})
 }
 
-func (s *Server) indexProfile(ctx context.Context, ident *identity.Identity, rec *appbsky.ActorProfile, path string, rcid cid.Cid) error {
+func (s *Server) indexProfile(ctx context.Context, index string, ident *identity.Identity, rec *appbsky.ActorProfile, path string, rcid cid.Cid) error {
 	ctx, span := tracer.Start(ctx, "indexProfile")
 	defer span.End()
 	span.SetAttributes(attribute.String("repo", ident.DID.String()), attribute.String("path", path))
 
-	log := s.logger.With("repo", ident.DID, "path", path, "op", "indexProfile")
+	log := s.logger.With("repo", ident.DID, "path", path, "op", "indexProfile", "index", index)
 	parts := strings.SplitN(path, "/", 3)
 	if len(parts) != 2 || parts[1] != "self" {
 		log.Warn("skipping indexing non-canonical profile record", "did", ident.DID, "path", path)
 		return nil
 	}
 
+	if profileOptsOut(rec) {
+		optOutDocsSkipped.WithLabelValues("profile").Inc()
+		return s.OptOut(ctx, ident.DID, OptOutSelfLabel)
+	}
+	if reason, ok := s.optOutReason(ident.DID); ok {
+		if reason != OptOutSelfLabel {
+			log.Debug("skipping profile of opted-out account")
+			optOutDocsSkipped.WithLabelValues("profile").Inc()
+			return nil
+		}
+		// the self-label was removed
+		if _, err := s.RemoveOptOut(ctx, ident.DID, OptOutSelfLabel); err != nil {
+			return err
+		}
+	}
+
 	log.Info("indexing profile", "handle", ident.Handle)
 
 	doc := TransformProfile(rec, ident, rcid.String())
@@ -121,30 +179,117 @@ func (s *Server) indexProfile(ctx context.Context, ident *identity.Identity, rec
 	if err != nil {
 		return err
 	}
-	req := esapi.IndexRequest{
-		Index:      s.profileIndex,
-		DocumentID: ident.DID.String(),
-		Body:       bytes.NewReader(b),
+	return s.indexDocument(ctx, log, ident.DID, index, ident.DID.String(), b, func(err error) {
+		if err != nil {
+			profilesFailed.Inc()
+		} else {
+			profilesIndexed.Inc()
+		}
+	})
+}
+
+// Indexes a feed generator or list record.
+func (s *Server) indexFeed(ctx context.Context, index string, ident *identity.Identity, rec typegen.CBORMarshaler, path string, rcid cid.Cid) error {
+	ctx, span := tracer.Start(ctx, "indexFeed")
+	defer span.End()
+	span.SetAttributes(attribute.String("repo", ident.DID.String()), attribute.String("path", path))
+
+	log := s.logger.With("repo", ident.DID, "path", path, "op", "indexFeed", "index", index)
+	collection, rkey, err := splitRecordPath(path)
+	if err != nil {
+		log.Warn("skipping indexing feed record with invalid path", "err", err)
+		return nil
+	}
+
+	var doc FeedDoc
+	switch rec := rec.(type) {
+	case *appbsky.FeedGenerator:
+		doc = TransformFeedGenerator(rec, ident, rkey, rcid.String())
+	case *appbsky.GraphList:
+		doc = TransformList(rec, ident, rkey, rcid.String())
+	default:
+		return fmt.Errorf("unexpected record type for feed index: %T", rec)
+	}
+	if doc.RecordCollection != collection {
+		log.Warn("skipping feed record in unexpected collection")
+		return nil
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return err
 	}
 
+	log.Debug("indexing feed")
+	return s.indexDocument(ctx, log, ident.DID, index, doc.DocId(), b, func(err error) {
+		if err != nil {
+			feedsFailed.WithLabelValues(collection).Inc()
+		} else {
+			feedsIndexed.WithLabelValues(collection).Inc()
+		}
+	})
+}
+
+func (s *Server) deleteFeed(ctx context.Context, index string, ident *identity.Identity, path string) error {
+	ctx, span := tracer.Start(ctx, "deleteFeed")
+	defer span.End()
+	span.SetAttributes(attribute.String("repo", ident.DID.String()), attribute.String("path", path))
+
+	log := s.logger.With("repo", ident.DID, "path", path, "op", "deleteFeed", "index", index)
+	collection, rkey, err := splitRecordPath(path)
+	if err != nil {
+		log.Warn("skipping deleting feed record with invalid path", "err", err)
+		return nil
+	}
+
+	log.Info("deleting feed from index")
+	docID := feedDocId(ident.DID.String(), collection, rkey)
+	done := func(err error) {
+		if err == nil {
+			feedsDeleted.WithLabelValues(collection).Inc()
+		}
+	}
+	if s.bulk != nil {
+		return s.bulk.Delete(ctx, index, docID, s.bulkDone(ident.DID, done))
+	}
+
+	req := esapi.DeleteRequest{
+		Index:      index,
+		DocumentID: docID,
+	}
 	res, err := req.Do(ctx, s.escli)
 	if err != nil {
-		log.Warn("failed to send indexing request", "err", err)
-		return fmt.Errorf("failed to send indexing request: %w", err)
+		return fmt.Errorf("failed to delete feed: %w", err)
 	}
 	defer res.Body.Close()
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		log.Warn("failed to read indexing response", "err", err)
 		return fmt.Errorf("failed to read indexing response: %w", err)
 	}
-	if res.IsError() {
+	if res.IsError() && res.StatusCode != http.StatusNotFound {
 		log.Warn("opensearch indexing error", "status_code", res.StatusCode, "response", res, "body", string(body))
 		return fmt.Errorf("indexing error, code=%d", res.StatusCode)
 	}
+	done(nil)
 	return nil
 }
 
+// Splits a repo path ("<collection>/<rkey>") into its parts, validating the syntax.
+func splitRecordPath(path string) (string, string, error) {
+	parts := strings.SplitN(path, "/", 3)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("invalid record path: %q", path)
+	}
+	collection, err := syntax.ParseNSID(parts[0])
+	if err != nil {
+		return "", "", err
+	}
+	rkey, err := syntax.ParseRecordKey(parts[1])
+	if err != nil {
+		return "", "", err
+	}
+	return collection.String(), rkey.String(), nil
+}
+
 func (s *Server) updateUserHandle(ctx context.Context, did syntax.DID, handle string) error {
 	ctx, span := tracer.Start(ctx, "updateUserHandle")
 	defer span.End()
@@ -169,8 +314,14 @@ func (s *Server) updateUserHandle(ctx context.Context, did syntax.DID, handle st
 		return fmt.Errorf("got nil identity from directory")
 	}
 
-	log.Info("updating user handle", "handle_from_dir", ident.Handle)
 	span.SetAttributes(attribute.String("dir.handle", ident.Handle.String()))
+	return s.updateProfileHandle(ctx, ident)
+}
+
+// Sets the handle on an account's profile documents, in every index being written to. Accounts without a profile document are skipped.
+func (s *Server) updateProfileHandle(ctx context.Context, ident *identity.Identity) error {
+	log := s.logger.With("repo", ident.DID.String(), "op", "updateProfileHandle")
+	log.Info("updating user handle", "handle_from_dir", ident.Handle)
 
 	b, err := json.Marshal(map[string]any{
 		"script": map[string]any{
@@ -186,26 +337,32 @@ func (s *Server) updateUserHandle(ctx context.Context, did syntax.DID, handle st
 		return err
 	}
 
-	req := esapi.UpdateRequest{
-		Index:      s.profileIndex,
-		DocumentID: did.String(),
-		Body:       bytes.NewReader(b),
-	}
+	for _, t := range s.writeTargets() {
+		req := esapi.UpdateRequest{
+			Index:      t.profile,
+			DocumentID: ident.DID.String(),
+			Body:       bytes.NewReader(b),
+		}
 
-	res, err := req.Do(ctx, s.escli)
-	if err != nil {
-		log.Warn("failed to send indexing request", "err", err)
-		return fmt.Errorf("failed to send indexing request: %w", err)
-	}
-	defer res.Body.Close()
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		log.Warn("failed to read indexing response", "err", err)
-		return fmt.Errorf("failed to read indexing response: %w", err)
-	}
-	if res.IsError() {
-		log.Warn("opensearch indexing error", "status_code", res.StatusCode, "response", res, "body", string(body))
-		return fmt.Errorf("indexing error, code=%d", res.StatusCode)
+		res, err := req.Do(ctx, s.escli)
+		if err != nil {
+			log.Warn("failed to send indexing request", "err", err)
+			return fmt.Errorf("failed to send indexing request: %w", err)
+		}
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		if err != nil {
+			log.Warn("failed to read indexing response", "err", err)
+			return fmt.Errorf("failed to read indexing response: %w", err)
+		}
+		// no profile record was indexed (or a reindex has not reached it yet); the current handle is picked up when it is
+		if res.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if res.IsError() {
+			log.Warn("opensearch indexing error", "index", t.profile, "status_code", res.StatusCode, "response", res, "body", string(body))
+			return fmt.Errorf("indexing error, code=%d", res.StatusCode)
+		}
 	}
 	return nil
 }
@@ -52,11 +52,167 @@ var profilesDeleted = promauto.NewCounter(prometheus.CounterOpts{
 	Help: "Number of profiles deleted",
 })
 
+var feedsIndexed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "search_feeds_indexed",
+	Help: "Number of feed generator and list records indexed",
+}, []string{"collection"})
+
+var feedsFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "search_feeds_failed",
+	Help: "Number of feed generator and list records that failed indexing",
+}, []string{"collection"})
+
+var feedsDeleted = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "search_feeds_deleted",
+	Help: "Number of feed generator and list records deleted",
+}, []string{"collection"})
+
+var accountsPurged = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "search_accounts_purged",
+	Help: "Number of accounts whose documents were purged, by reason (account status)",
+}, []string{"reason"})
+
+var accountDocsPurged = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "search_account_docs_purged",
+	Help: "Number of documents deleted by account purges",
+}, []string{"doc_type"})
+
+var accountPurgesFailed = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_account_purges_failed",
+	Help: "Number of account purges that failed",
+})
+
+var engagementPostsUpdated = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_engagement_posts_updated",
+	Help: "Number of post engagement counts refreshed from the AppView",
+})
+
+var engagementFetchFailures = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_engagement_fetch_failures",
+	Help: "Number of failed requests for post engagement counts",
+})
+
+var relayConnected = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "search_relay_connected",
+	Help: "Whether the firehose is currently being consumed from a relay host (1) or not (0)",
+}, []string{"host"})
+
+var relayDisconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "search_relay_disconnects",
+	Help: "Number of failed or dropped relay firehose connections",
+}, []string{"host"})
+
+var relayFailovers = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_relay_failovers",
+	Help: "Number of times firehose consumption failed over to another relay",
+})
+
+var consistencyReposChecked = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_consistency_repos_checked",
+	Help: "Number of repos compared against the search indices by the consistency checker",
+})
+
+var consistencyReposDrifted = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_consistency_repos_drifted",
+	Help: "Number of checked repos whose record counts differ from the search indices",
+})
+
+var consistencyDriftRatio = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "search_consistency_drift_ratio",
+	Help: "Fraction of repos found drifted in the last consistency check round",
+})
+
+var consistencyCheckFailures = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_consistency_check_failures",
+	Help: "Number of repos which could not be checked (eg, PDS unavailable)",
+})
+
+var consistencyRepairs = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_consistency_repairs",
+	Help: "Number of drifted repos re-enqueued for backfill",
+})
+
+var openSearchRetries = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_opensearch_retries",
+	Help: "Number of OpenSearch requests retried after a network error or a retryable status",
+})
+
+var openSearchBreakerTrips = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_opensearch_breaker_trips",
+	Help: "Number of times the OpenSearch circuit breaker opened",
+})
+
+var openSearchBreakerOpen = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "search_opensearch_breaker_open",
+	Help: "Whether the OpenSearch circuit breaker is open (1), pausing firehose consumption",
+})
+
+var firehoseEventRetries = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_firehose_event_retries",
+	Help: "Number of firehose events handled again after OpenSearch became available",
+})
+
+var optOutsAdded = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "search_optouts_added",
+	Help: "Number of accounts opted out of indexing, by reason",
+}, []string{"reason"})
+
+var optOutAccounts = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "search_optout_accounts",
+	Help: "Number of accounts opted out of indexing",
+})
+
+var optOutDocsSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "search_optout_docs_skipped",
+	Help: "Number of documents not indexed because the account opted out",
+}, []string{"doc_type"})
+
+var optOutDocsScrubbed = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "search_optout_docs_scrubbed",
+	Help: "Number of documents of opted-out accounts deleted from the indices",
+}, []string{"doc_type"})
+
 var currentSeq = promauto.NewGauge(prometheus.GaugeOpts{
 	Name: "search_current_seq",
 	Help: "Current sequence number",
 })
 
+var queriesBlocked = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_queries_blocked",
+	Help: "Number of search queries blocked by the query filter",
+})
+
+var stopwordsRemoved = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_query_stopwords_removed",
+	Help: "Number of stopwords removed from search queries",
+})
+
+var bulkBatchSize = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "search_bulk_batch_size",
+	Help:    "Number of documents in each OpenSearch bulk request",
+	Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+})
+
+var bulkRequestFailures = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_bulk_request_failures",
+	Help: "Number of OpenSearch bulk requests which failed entirely",
+})
+
+var bulkItemFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "search_bulk_item_failures",
+	Help: "Number of documents in OpenSearch bulk requests which failed, by action",
+}, []string{"action"})
+
+var bulkRetries = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_bulk_retries",
+	Help: "Number of OpenSearch bulk requests retried after being rate-limited (HTTP 429)",
+})
+
+var bulkRepoRetries = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "search_bulk_repo_retries",
+	Help: "Number of repos queued to be backfilled again after documents failed to be written through the OpenSearch bulk API",
+})
+
 var reqSz = promauto.NewHistogramVec(prometheus.HistogramOpts{
 	Name:    "http_request_size_bytes",
 	Help:    "A histogram of request sizes for requests.",
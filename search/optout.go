@@ -0,0 +1,245 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"github.com/bluesky-social/indigo/backfill"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Reasons an account is excluded from indexing.
+const (
+	// the account's profile has the "!no-unauthenticated" self-label
+	OptOutSelfLabel = "self-label"
+	// added by an operator, through the admin API
+	OptOutOperator = "operator"
+)
+
+// Self-label by which an account asks not to be shown to logged-out users; such accounts are not indexed.
+const noUnauthenticatedLabel = "!no-unauthenticated"
+
+// Number of DIDs per delete-by-query request when scrubbing opted-out accounts.
+const optOutScrubBatchSize = 500
+
+// An account whose posts and profile are not indexed.
+type IndexOptOut struct {
+	DID       string    `gorm:"column:did;primarykey" json:"did"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// In-memory copy of the opt-out table, checked for every indexed document.
+type optOutSet struct {
+	lk      sync.RWMutex
+	reasons map[string]string
+}
+
+func (o *optOutSet) get(did string) (string, bool) {
+	o.lk.RLock()
+	defer o.lk.RUnlock()
+	reason, ok := o.reasons[did]
+	return reason, ok
+}
+
+func (o *optOutSet) set(did, reason string) {
+	o.lk.Lock()
+	defer o.lk.Unlock()
+	o.reasons[did] = reason
+}
+
+func (o *optOutSet) remove(did string) {
+	o.lk.Lock()
+	defer o.lk.Unlock()
+	delete(o.reasons, did)
+}
+
+func (o *optOutSet) dids() []string {
+	o.lk.RLock()
+	defer o.lk.RUnlock()
+	out := make([]string, 0, len(o.reasons))
+	for did := range o.reasons {
+		out = append(out, did)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// Replaces the set with the contents of the database, which other processes may have changed.
+func (o *optOutSet) load(db *gorm.DB) error {
+	var rows []IndexOptOut
+	if err := db.Find(&rows).Error; err != nil {
+		return fmt.Errorf("loading index opt-outs: %w", err)
+	}
+	reasons := make(map[string]string, len(rows))
+	for _, row := range rows {
+		reasons[row.DID] = row.Reason
+	}
+	o.lk.Lock()
+	defer o.lk.Unlock()
+	o.reasons = reasons
+	return nil
+}
+
+// Whether the profile record has the "!no-unauthenticated" self-label.
+func profileOptsOut(rec *appbsky.ActorProfile) bool {
+	if rec.Labels == nil || rec.Labels.LabelDefs_SelfLabels == nil {
+		return false
+	}
+	for _, le := range rec.Labels.LabelDefs_SelfLabels.Values {
+		if le.Val == noUnauthenticatedLabel {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether an account's posts and profile are excluded from indexing, and why.
+func (s *Server) optOutReason(did syntax.DID) (string, bool) {
+	if s.optOuts == nil {
+		return "", false
+	}
+	return s.optOuts.get(did.String())
+}
+
+// Excludes an account from indexing, and removes any posts and profile already indexed. An operator opt-out takes precedence over a self-label one, so it is not replaced (or later removed) when the self-label changes.
+func (s *Server) OptOut(ctx context.Context, did syntax.DID, reason string) error {
+	ctx, span := tracer.Start(ctx, "OptOut")
+	defer span.End()
+	span.SetAttributes(attribute.String("repo", did.String()), attribute.String("reason", reason))
+
+	prev, ok := s.optOuts.get(did.String())
+	if ok && (prev == reason || prev == OptOutOperator) {
+		return nil
+	}
+	row := IndexOptOut{DID: did.String(), Reason: reason}
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "did"}},
+		DoUpdates: clause.AssignmentColumns([]string{"reason"}),
+	}).Create(&row).Error
+	if err != nil {
+		return fmt.Errorf("saving index opt-out: %w", err)
+	}
+	s.optOuts.set(did.String(), reason)
+	optOutsAdded.WithLabelValues(reason).Inc()
+	s.logger.Info("account opted out of indexing", "did", did, "reason", reason)
+
+	if ok {
+		// already scrubbed
+		return nil
+	}
+	return s.scrubOptedOut(ctx, []string{did.String()})
+}
+
+// Allows an account to be indexed again, if it was opted out for the given reason, and re-enqueues its repo for backfill so its documents are restored. Returns false if the account was not opted out for that reason.
+func (s *Server) RemoveOptOut(ctx context.Context, did syntax.DID, reason string) (bool, error) {
+	ctx, span := tracer.Start(ctx, "RemoveOptOut")
+	defer span.End()
+	span.SetAttributes(attribute.String("repo", did.String()), attribute.String("reason", reason))
+
+	res := s.db.Where("did = ? AND reason = ?", did.String(), reason).Delete(&IndexOptOut{})
+	if res.Error != nil {
+		return false, fmt.Errorf("removing index opt-out: %w", res.Error)
+	}
+	if prev, ok := s.optOuts.get(did.String()); res.RowsAffected == 0 && (!ok || prev != reason) {
+		return false, nil
+	}
+	s.optOuts.remove(did.String())
+	s.logger.Info("account opted back in to indexing", "did", did, "reason", reason)
+
+	if s.bfs == nil {
+		return true, nil
+	}
+	return true, s.reenqueueRepo(ctx, did.String())
+}
+
+// Re-enqueues a repo in the backfiller (as a requested job), whatever the state of its previous backfill.
+func (s *Server) reenqueueRepo(ctx context.Context, did string) error {
+	job, err := s.bfs.GetJob(ctx, did)
+	switch {
+	case errors.Is(err, backfill.ErrJobNotFound):
+		// created by EnqueueJob
+	case err != nil:
+		return err
+	default:
+		if err := job.SetState(ctx, backfill.StateEnqueued); err != nil {
+			return err
+		}
+	}
+	return s.bfs.EnqueueJobWithPriority(ctx, did, s.bfOpts.Priorities.Requested)
+}
+
+// Deletes posts and profiles of the given accounts from every index being written to.
+func (s *Server) scrubOptedOut(ctx context.Context, dids []string) error {
+	for len(dids) > 0 {
+		batch := dids[:min(len(dids), optOutScrubBatchSize)]
+		dids = dids[len(batch):]
+
+		query, err := json.Marshal(map[string]any{
+			"query": map[string]any{
+				"terms": map[string]any{"did": batch},
+			},
+		})
+		if err != nil {
+			return err
+		}
+		for _, t := range s.writeTargets() {
+			for _, idx := range []struct{ docType, index string }{
+				{"post", t.post},
+				{"profile", t.profile},
+			} {
+				n, err := s.deleteByQuery(ctx, idx.index, query)
+				if err != nil {
+					return fmt.Errorf("scrubbing opted-out accounts from %s: %w", idx.index, err)
+				}
+				optOutDocsScrubbed.WithLabelValues(idx.docType).Add(float64(n))
+			}
+		}
+	}
+	return nil
+}
+
+// Periodically reloads the opt-out list (which may have been changed by other processes), and deletes any documents of opted-out accounts which were indexed anyway (eg, by a backfill which was already running), until the context is cancelled.
+func (s *Server) RunOptOutScrubber(ctx context.Context) {
+	if s.optOutScrubInterval <= 0 {
+		return
+	}
+	log := s.logger.With("component", "optout-scrubber")
+	ticker := time.NewTicker(s.optOutScrubInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.optOuts.load(s.db); err != nil {
+			log.Error("failed to reload opt-outs", "err", err)
+			continue
+		}
+		dids := s.optOuts.dids()
+		optOutAccounts.Set(float64(len(dids)))
+		if err := s.scrubOptedOut(ctx, dids); err != nil {
+			log.Error("failed to scrub opted-out accounts", "err", err)
+		}
+	}
+}
+
+// Lists opted-out accounts, oldest first.
+func (s *Server) ListOptOuts(ctx context.Context) ([]IndexOptOut, error) {
+	var rows []IndexOptOut
+	if err := s.db.WithContext(ctx).Order("created_at").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
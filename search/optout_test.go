@@ -0,0 +1,112 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	appbsky "github.com/bluesky-social/indigo/api/bsky"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestProfileOptsOut(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.False(profileOptsOut(&appbsky.ActorProfile{}))
+	labels := func(vals ...string) *appbsky.ActorProfile_Labels {
+		sl := &comatproto.LabelDefs_SelfLabels{}
+		for _, v := range vals {
+			sl.Values = append(sl.Values, &comatproto.LabelDefs_SelfLabel{Val: v})
+		}
+		return &appbsky.ActorProfile_Labels{LabelDefs_SelfLabels: sl}
+	}
+	assert.False(profileOptsOut(&appbsky.ActorProfile{Labels: labels("porn")}))
+	assert.True(profileOptsOut(&appbsky.ActorProfile{Labels: labels("porn", "!no-unauthenticated")}))
+}
+
+func TestOptOut(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var lk sync.Mutex
+	var scrubbed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lk.Lock()
+		defer lk.Unlock()
+		index, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if r.Method != http.MethodPost || action != "_delete_by_query" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var body map[string]map[string]map[string][]string
+		json.NewDecoder(r.Body).Decode(&body)
+		scrubbed = append(scrubbed, index+":"+strings.Join(body["query"]["terms"]["did"], ","))
+		json.NewEncoder(w).Encode(map[string]any{"deleted": 1})
+	}))
+	defer srv.Close()
+	escli, err := es.NewClient(es.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(db.AutoMigrate(&IndexOptOut{}))
+
+	s := &Server{
+		escli:        escli,
+		db:           db,
+		postIndex:    "palomar_post",
+		profileIndex: "palomar_profile",
+		feedIndex:    "palomar_feed",
+		logger:       slog.Default(),
+		optOuts:      &optOutSet{},
+	}
+	assert.NoError(s.optOuts.load(db))
+	did := syntax.DID("did:plc:abc222")
+
+	// opting out scrubs posts and profiles (but not feeds)
+	assert.NoError(s.OptOut(ctx, did, OptOutSelfLabel))
+	assert.Equal([]string{"palomar_post:did:plc:abc222", "palomar_profile:did:plc:abc222"}, scrubbed)
+	reason, ok := s.optOutReason(did)
+	assert.True(ok)
+	assert.Equal(OptOutSelfLabel, reason)
+
+	// an operator opt-out replaces the self-label one, without scrubbing again
+	assert.NoError(s.OptOut(ctx, did, OptOutOperator))
+	assert.NoError(s.OptOut(ctx, did, OptOutSelfLabel))
+	assert.Len(scrubbed, 2)
+	reason, _ = s.optOutReason(did)
+	assert.Equal(OptOutOperator, reason)
+
+	// ... and is not removed with the self-label
+	removed, err := s.RemoveOptOut(ctx, did, OptOutSelfLabel)
+	assert.NoError(err)
+	assert.False(removed)
+
+	// the list is persisted
+	other := &optOutSet{}
+	assert.NoError(other.load(db))
+	assert.Equal([]string{"did:plc:abc222"}, other.dids())
+
+	removed, err = s.RemoveOptOut(ctx, did, OptOutOperator)
+	assert.NoError(err)
+	assert.True(removed)
+	_, ok = s.optOutReason(did)
+	assert.False(ok)
+	rows, err := s.ListOptOuts(ctx)
+	assert.NoError(err)
+	assert.Empty(rows)
+}
@@ -13,6 +13,8 @@ import (
 )
 
 // ParseQuery takes a query string and pulls out some facet patterns ("from:handle.net") as filters
+//
+// Deprecated: use ParseSearchQuery, which supports more operators and negation.
 func ParseQuery(ctx context.Context, dir identity.Directory, raw string) (string, []map[string]interface{}) {
 	var filters []map[string]interface{}
 	parts, err := shlex.Split(raw)
@@ -0,0 +1,134 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	comatproto "github.com/bluesky-social/indigo/api/atproto"
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+	"go.opentelemetry.io/otel/attribute"
+
+	esapi "github.com/opensearch-project/opensearch-go/v2/opensearchapi"
+)
+
+// Number of documents removed by an account purge, by document type ("post", "profile", "feed").
+type PurgeResult struct {
+	DID     string           `json:"did"`
+	Deleted map[string]int64 `json:"deleted"`
+}
+
+// Removes all documents (posts, profile, feeds and lists) for an account from every index being written to, including the new indices of an in-progress reindex. Used when an account is taken down, deactivated, or deleted. The reason is only used for logging and metrics.
+//
+// Note that documents are not restored if the account is later reactivated: the repo needs to be re-indexed (eg, with the indexRepos endpoint), or records will be picked up as they are updated.
+func (s *Server) PurgeAccount(ctx context.Context, did syntax.DID, reason string) (*PurgeResult, error) {
+	ctx, span := tracer.Start(ctx, "PurgeAccount")
+	defer span.End()
+	span.SetAttributes(attribute.String("repo", did.String()), attribute.String("reason", reason))
+
+	log := s.logger.With("repo", did.String(), "op", "PurgeAccount", "reason", reason)
+
+	query, err := json.Marshal(map[string]any{
+		"query": map[string]any{
+			"term": map[string]any{"did": did.String()},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PurgeResult{
+		DID:     did.String(),
+		Deleted: map[string]int64{},
+	}
+	for _, t := range s.writeTargets() {
+		for _, idx := range []struct{ docType, index string }{
+			{"post", t.post},
+			{"profile", t.profile},
+			{"feed", t.feed},
+		} {
+			n, err := s.deleteByQuery(ctx, idx.index, query)
+			if err != nil {
+				accountPurgesFailed.Inc()
+				log.Error("failed to purge account documents", "index", idx.index, "err", err)
+				return result, err
+			}
+			result.Deleted[idx.docType] += n
+			accountDocsPurged.WithLabelValues(idx.docType).Add(float64(n))
+		}
+	}
+	accountsPurged.WithLabelValues(reason).Inc()
+	log.Info("purged account documents", "deleted", result.Deleted)
+	return result, nil
+}
+
+// Deletes all documents in the index matching a query, returning the number deleted. Version conflicts (eg, with concurrent indexing) are skipped rather than aborting the request.
+func (s *Server) deleteByQuery(ctx context.Context, index string, query []byte) (int64, error) {
+	refresh := true
+	req := esapi.DeleteByQueryRequest{
+		Index:     []string{index},
+		Body:      bytes.NewReader(query),
+		Conflicts: "proceed",
+		Refresh:   &refresh,
+	}
+	res, err := req.Do(ctx, s.escli)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send delete-by-query request: %w", err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read delete-by-query response: %w", err)
+	}
+	if res.IsError() {
+		return 0, fmt.Errorf("delete-by-query error, code=%d: %s", res.StatusCode, string(body))
+	}
+	var parsed struct {
+		Deleted int64 `json:"deleted"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return 0, fmt.Errorf("failed to parse delete-by-query response: %w", err)
+	}
+	return parsed.Deleted, nil
+}
+
+// Handles an '#account' firehose event: documents are purged when an account becomes inactive for any reason (takendown, suspended, deactivated, deleted).
+func (s *Server) handleAccountEvent(ctx context.Context, evt *comatproto.SyncSubscribeRepos_Account) error {
+	if evt.Active {
+		return nil
+	}
+	did, err := syntax.ParseDID(evt.Did)
+	if err != nil {
+		return fmt.Errorf("bad DID in account event: %w", err)
+	}
+	reason := "inactive"
+	if evt.Status != nil && *evt.Status != "" {
+		reason = *evt.Status
+	}
+	_, err = s.PurgeAccount(ctx, did, reason)
+	return err
+}
+
+// Handles an '#identity' firehose event: the identity is re-resolved, and documents are purged if the DID no longer resolves (eg, a tombstoned DID). Otherwise any handle change is applied to the profile.
+func (s *Server) handleIdentityEvent(ctx context.Context, evt *comatproto.SyncSubscribeRepos_Identity) error {
+	did, err := syntax.ParseDID(evt.Did)
+	if err != nil {
+		return fmt.Errorf("bad DID in identity event: %w", err)
+	}
+	if err := s.dir.Purge(ctx, did.AtIdentifier()); err != nil {
+		return fmt.Errorf("failed to purge DID from directory: %w", err)
+	}
+	ident, err := s.dir.LookupDID(ctx, did)
+	if errors.Is(err, identity.ErrDIDNotFound) {
+		_, err = s.PurgeAccount(ctx, did, "identity")
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lookup DID in directory: %w", err)
+	}
+	return s.updateProfileHandle(ctx, ident)
+}
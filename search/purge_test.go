@@ -0,0 +1,59 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	es "github.com/opensearch-project/opensearch-go/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurgeAccount(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var lk sync.Mutex
+	var indices []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lk.Lock()
+		defer lk.Unlock()
+		index, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if r.Method != http.MethodPost || action != "_delete_by_query" || r.URL.Query().Get("conflicts") != "proceed" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var body map[string]map[string]map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["query"]["term"]["did"] != "did:plc:abc222" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		indices = append(indices, index)
+		json.NewEncoder(w).Encode(map[string]any{"deleted": 2})
+	}))
+	defer srv.Close()
+	escli, err := es.NewClient(es.Config{Addresses: []string{srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		escli:        escli,
+		postIndex:    "palomar_post",
+		profileIndex: "palomar_profile",
+		feedIndex:    "palomar_feed",
+		logger:       slog.Default(),
+	}
+
+	result, err := s.PurgeAccount(ctx, syntax.DID("did:plc:abc222"), "takendown")
+	assert.NoError(err)
+	assert.Equal(map[string]int64{"post": 2, "profile": 2, "feed": 2}, result.Deleted)
+	assert.Equal([]string{"palomar_post", "palomar_profile", "palomar_feed"}, indices)
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log/slog"
+	"strings"
 
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"go.opentelemetry.io/otel/attribute"
@@ -19,6 +20,10 @@ type EsSearchHit struct {
 	ID     string          `json:"_id"`
 	Score  float64         `json:"_score"`
 	Source json.RawMessage `json:"_source"`
+	// sort values, for 'search_after' pagination
+	Sort []json.RawMessage `json:"sort,omitempty"`
+	// highlighted field values, if highlighting was requested
+	Highlight map[string][]string `json:"highlight,omitempty"`
 }
 
 type EsSearchHits struct {
@@ -34,6 +39,8 @@ type EsSearchResponse struct {
 	Took     int          `json:"took"`
 	TimedOut bool         `json:"timed_out"`
 	Hits     EsSearchHits `json:"hits"`
+	// raw results by aggregation name, if the query had any
+	Aggregations map[string]json.RawMessage `json:"aggregations,omitempty"`
 }
 
 type UserResult struct {
@@ -56,82 +63,80 @@ func checkParams(offset, size int) error {
 }
 
 func DoSearchPosts(ctx context.Context, dir identity.Directory, escli *es.Client, index, q string, offset, size int) (*EsSearchResponse, error) {
+	return DoSearchPostsRanked(ctx, dir, escli, index, q, nil, SearchCursor{Offset: offset}, size, false)
+}
+
+// Like DoSearchPosts, but with relevance ranking: if the config is not nil, results are ordered by score (with newer posts first for equal scores) instead of by creation time. If highlight is set, hits include highlighted post text and image alt text.
+func DoSearchPostsRanked(ctx context.Context, dir identity.Directory, escli *es.Client, index, q string, rc *RelevanceConfig, cursor SearchCursor, size int, highlight bool) (*EsSearchResponse, error) {
 	ctx, span := tracer.Start(ctx, "DoSearchPosts")
 	defer span.End()
 
-	if err := checkParams(offset, size); err != nil {
+	if err := checkParams(cursor.depth(), size); err != nil {
 		return nil, err
 	}
-	queryStr, filters := ParseQuery(ctx, dir, q)
-	basic := map[string]interface{}{
-		"simple_query_string": map[string]interface{}{
-			"query":            queryStr,
-			"fields":           []string{"everything"},
-			"flags":            "AND|NOT|OR|PHRASE|PRECEDENCE|WHITESPACE",
-			"default_operator": "and",
-			"lenient":          true,
-			"analyze_wildcard": false,
+	fields := []string{"everything"}
+	if rc != nil {
+		fields = weightedFields(rc.PostFieldWeights, fields)
+	}
+	pq := ParseSearchQuery(SanitizeQuery(q))
+	byCreated := map[string]any{
+		"created_at": map[string]any{
+			"order": "desc",
 		},
 	}
 	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must":   basic,
-				"filter": filters,
-			},
-		},
-		"sort": map[string]any{
-			"created_at": map[string]any{
-				"order": "desc",
-			},
-		},
-		"size": size,
-		"from": offset,
+		"query": pq.boolQuery(ctx, dir, queryDocPost, fields, nil, nil),
+		"sort":  []any{byCreated, sortTieBreaker},
+		"size":  size,
 	}
+	if rc != nil {
+		query["query"] = rc.postQuery(query["query"].(map[string]any))
+		query["sort"] = []any{"_score", byCreated, sortTieBreaker}
+	}
+	if highlight {
+		query["highlight"] = postHighlightQuery()
+	}
+	cursor.apply(query)
 
 	return doSearch(ctx, escli, index, query)
 }
 
 func DoSearchProfiles(ctx context.Context, dir identity.Directory, escli *es.Client, index, q string, offset, size int) (*EsSearchResponse, error) {
+	return DoSearchProfilesRanked(ctx, dir, escli, index, q, nil, SearchCursor{Offset: offset}, size)
+}
+
+// Like DoSearchProfiles, with the field weights from the relevance config (if not nil).
+func DoSearchProfilesRanked(ctx context.Context, dir identity.Directory, escli *es.Client, index, q string, rc *RelevanceConfig, cursor SearchCursor, size int) (*EsSearchResponse, error) {
 	ctx, span := tracer.Start(ctx, "DoSearchProfiles")
 	defer span.End()
 
-	if err := checkParams(offset, size); err != nil {
+	if err := checkParams(cursor.depth(), size); err != nil {
 		return nil, err
 	}
 
-	queryStr, filters := ParseQuery(ctx, dir, q)
-	basic := map[string]interface{}{
-		"simple_query_string": map[string]interface{}{
-			"query":            queryStr,
-			"fields":           []string{"everything"},
-			"flags":            "AND|NOT|OR|PHRASE|PRECEDENCE|WHITESPACE",
-			"default_operator": "and",
-			"lenient":          true,
-			"analyze_wildcard": false,
-		},
+	fields := []string{"everything"}
+	if rc != nil {
+		fields = weightedFields(rc.ProfileFieldWeights, fields)
 	}
-
+	pq := ParseSearchQuery(SanitizeQuery(q))
 	query := map[string]interface{}{
-		"query": map[string]interface{}{
-			"bool": map[string]interface{}{
-				"must": basic,
-				"should": []interface{}{
-					map[string]interface{}{"term": map[string]interface{}{"has_avatar": true}},
-					map[string]interface{}{"term": map[string]interface{}{"has_banner": true}},
-				},
-				"minimum_should_match": 0,
-				"filter":               filters,
-				"boost":                0.5,
+		"query": pq.boolQuery(ctx, dir, queryDocProfile, fields, nil, map[string]any{
+			"should": []interface{}{
+				map[string]interface{}{"term": map[string]interface{}{"has_avatar": true}},
+				map[string]interface{}{"term": map[string]interface{}{"has_banner": true}},
 			},
-		},
+			"minimum_should_match": 0,
+			"boost":                0.5,
+		}),
+		"sort": []any{"_score", sortTieBreaker},
 		"size": size,
-		"from": offset,
 	}
+	cursor.apply(query)
 
 	return doSearch(ctx, escli, index, query)
 }
 
+// Prefix ("autocomplete") search of accounts by handle and display name. Matches against the edge-ngram fields ("handle_ngram" and "display_name_ngram"), with a boost for handles which start with the query; documents indexed before those fields existed are still matched through the older "typeahead" field.
 func DoSearchProfilesTypeahead(ctx context.Context, escli *es.Client, index, q string, size int) (*EsSearchResponse, error) {
 	ctx, span := tracer.Start(ctx, "DoSearchProfilesTypeahead")
 	defer span.End()
@@ -140,23 +145,80 @@ func DoSearchProfilesTypeahead(ctx context.Context, escli *es.Client, index, q s
 		return nil, err
 	}
 
-	query := map[string]interface{}{
+	return doSearch(ctx, escli, index, profilesTypeaheadQuery(q, size))
+}
+
+// Builds the query for DoSearchProfilesTypeahead.
+func profilesTypeaheadQuery(q string, size int) map[string]interface{} {
+	// clients often pass the "@" which is displayed in front of handles
+	q = strings.TrimPrefix(strings.TrimSpace(SanitizeQuery(q)), "@")
+
+	return map[string]interface{}{
 		"query": map[string]interface{}{
-			"multi_match": map[string]interface{}{
-				"query":    q,
-				"type":     "bool_prefix",
-				"operator": "and",
-				"fields": []string{
-					// adding handle here improves relevency but may be too expensive in prod
-					//"handle^2",
-					"typeahead",
-					"typeahead._2gram",
-					"typeahead._3gram",
+			"bool": map[string]interface{}{
+				"should": []interface{}{
+					map[string]interface{}{
+						"multi_match": map[string]interface{}{
+							"query":    q,
+							"type":     "cross_fields",
+							"operator": "and",
+							"fields": []string{
+								"handle_ngram^2",
+								"display_name_ngram",
+							},
+						},
+					},
+					map[string]interface{}{
+						"multi_match": map[string]interface{}{
+							"query":    q,
+							"type":     "bool_prefix",
+							"operator": "and",
+							"fields": []string{
+								"typeahead",
+								"typeahead._2gram",
+								"typeahead._3gram",
+							},
+						},
+					},
+					map[string]interface{}{
+						"prefix": map[string]interface{}{
+							"handle": map[string]interface{}{
+								"value": strings.ToLower(q),
+								"boost": 3,
+							},
+						},
+					},
 				},
+				"minimum_should_match": 1,
 			},
 		},
 		"size": size,
 	}
+}
+
+// Searches feed generator or list records, depending on the collection.
+func DoSearchFeeds(ctx context.Context, dir identity.Directory, escli *es.Client, index, collection, q string, cursor SearchCursor, size int) (*EsSearchResponse, error) {
+	ctx, span := tracer.Start(ctx, "DoSearchFeeds")
+	defer span.End()
+
+	if err := checkParams(cursor.depth(), size); err != nil {
+		return nil, err
+	}
+
+	pq := ParseSearchQuery(SanitizeQuery(q))
+	query := map[string]interface{}{
+		"query": pq.boolQuery(ctx, dir, queryDocFeed, []string{"name^2", "everything"}, []map[string]any{
+			{"term": map[string]any{"record_collection": collection}},
+		}, map[string]any{
+			"should": []interface{}{
+				map[string]interface{}{"term": map[string]interface{}{"has_avatar": true}},
+			},
+			"minimum_should_match": 0,
+		}),
+		"sort": []any{"_score", sortTieBreaker},
+		"size": size,
+	}
+	cursor.apply(query)
 
 	return doSearch(ctx, escli, index, query)
 }
@@ -0,0 +1,177 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const (
+	// blocked queries return an empty (but otherwise successful) result set
+	BlockedQueryPolicyEmpty = "empty"
+	// blocked queries return an HTTP 400 error
+	BlockedQueryPolicyReject = "reject"
+)
+
+// Operator configuration for query-time term filtering. Usually loaded from a JSON file with LoadQueryFilterConfig.
+type QueryFilterConfig struct {
+	// Stopwords to remove from queries, keyed by language code (eg, "en"). Lists under the special key "*" apply to every query, regardless of language.
+	Stopwords map[string][]string `json:"stopwords,omitempty"`
+	// Words or phrases (matched case-insensitively, ignoring punctuation) which cause the entire query to be blocked.
+	BlockedTerms []string `json:"blockedTerms,omitempty"`
+	// What to do with blocked queries: BlockedQueryPolicyEmpty (the default) or BlockedQueryPolicyReject.
+	BlockedPolicy string `json:"blockedPolicy,omitempty"`
+}
+
+func LoadQueryFilterConfig(path string) (*QueryFilterConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config QueryFilterConfig
+	if err := json.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("parsing query filter config (%s): %w", path, err)
+	}
+	return &config, nil
+}
+
+// QueryFilter removes stopwords from queries, and identifies queries containing blocked terms. A nil *QueryFilter is valid, and passes all queries through unmodified.
+type QueryFilter struct {
+	// language code to set of lower-case stopwords
+	stopwords map[string]map[string]bool
+	// each blocked term, as a sequence of normalized words
+	blocked [][]string
+	policy  string
+}
+
+func NewQueryFilter(config *QueryFilterConfig) (*QueryFilter, error) {
+	f := QueryFilter{
+		stopwords: make(map[string]map[string]bool),
+		policy:    config.BlockedPolicy,
+	}
+	switch f.policy {
+	case "":
+		f.policy = BlockedQueryPolicyEmpty
+	case BlockedQueryPolicyEmpty, BlockedQueryPolicyReject:
+	default:
+		return nil, fmt.Errorf("unknown blocked query policy: %s", config.BlockedPolicy)
+	}
+	for lang, words := range config.Stopwords {
+		set := make(map[string]bool, len(words))
+		for _, w := range words {
+			set[strings.ToLower(strings.TrimSpace(w))] = true
+		}
+		f.stopwords[strings.ToLower(lang)] = set
+	}
+	for _, term := range config.BlockedTerms {
+		words := normalizeWords(term)
+		if len(words) == 0 {
+			return nil, fmt.Errorf("empty blocked query term: %q", term)
+		}
+		f.blocked = append(f.blocked, words)
+	}
+	return &f, nil
+}
+
+// Policy returns how blocked queries should be handled.
+func (f *QueryFilter) Policy() string {
+	if f == nil {
+		return BlockedQueryPolicyEmpty
+	}
+	return f.policy
+}
+
+// Filter checks a sanitized query (see SanitizeQuery) for blocked terms, and removes any stopwords for the given languages. The second return value is true if the query is blocked, in which case the caller should apply the blocked query policy instead of running the query.
+//
+// Stopwords are only removed when they appear as a bare term: quoted phrases, negated terms, and facets are left alone. If every term in a query is a stopword, the query is returned unmodified.
+func (f *QueryFilter) Filter(q string, langs []string) (string, bool) {
+	if f == nil {
+		return q, false
+	}
+
+	if len(f.blocked) > 0 {
+		words := normalizeWords(q)
+		for _, term := range f.blocked {
+			if containsWords(words, term) {
+				queriesBlocked.Inc()
+				return "", true
+			}
+		}
+	}
+
+	if len(f.stopwords) == 0 {
+		return q, false
+	}
+	sets := []map[string]bool{f.stopwords["*"]}
+	for _, lang := range langs {
+		sets = append(sets, f.stopwords[strings.ToLower(lang)])
+	}
+	isStopword := func(term string) bool {
+		term = strings.ToLower(term)
+		for _, set := range sets {
+			if set[term] {
+				return true
+			}
+		}
+		return false
+	}
+
+	terms := strings.Fields(q)
+	keep := make([]string, 0, len(terms))
+	inQuote := false
+	for _, term := range terms {
+		quotes := strings.Count(term, `"`)
+		if !inQuote && quotes == 0 && isStopword(term) {
+			continue
+		}
+		if quotes%2 == 1 {
+			inQuote = !inQuote
+		}
+		keep = append(keep, term)
+	}
+	if len(keep) == 0 || len(keep) == len(terms) {
+		return q, false
+	}
+	stopwordsRemoved.Add(float64(len(terms) - len(keep)))
+	return strings.Join(keep, " "), false
+}
+
+// Splits a string into lower-case words, ignoring any punctuation or query syntax.
+func normalizeWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// Whether seq appears as a contiguous sub-sequence of words.
+func containsWords(words, seq []string) bool {
+	for i := 0; i+len(seq) <= len(words); i++ {
+		match := true
+		for j := range seq {
+			if words[i+j] != seq[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// Extracts base language codes (eg, "en" from "en-US") from a request's Accept-Language header, in the order given.
+func requestLanguages(r *http.Request) []string {
+	var langs []string
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, _, _ := strings.Cut(part, ";")
+		base, _, _ := strings.Cut(strings.TrimSpace(tag), "-")
+		if base != "" && base != "*" {
+			langs = append(langs, strings.ToLower(base))
+		}
+	}
+	return langs
+}
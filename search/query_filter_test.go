@@ -0,0 +1,71 @@
+package search
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryFilter(t *testing.T) {
+	assert := assert.New(t)
+
+	qf, err := NewQueryFilter(&QueryFilterConfig{
+		Stopwords: map[string][]string{
+			"*":  {"rt"},
+			"en": {"the", "a"},
+			"de": {"der", "die"},
+		},
+		BlockedTerms: []string{"Forbidden", "bad phrase"},
+	})
+	assert.NoError(err)
+	assert.Equal(BlockedQueryPolicyEmpty, qf.Policy())
+
+	fixtures := []struct {
+		q       string
+		langs   []string
+		out     string
+		blocked bool
+	}{
+		{q: "the cat", langs: nil, out: "the cat"},
+		{q: "the cat", langs: []string{"en"}, out: "cat"},
+		{q: "The cat", langs: []string{"de", "en"}, out: "cat"},
+		{q: "die katze", langs: []string{"en"}, out: "die katze"},
+		{q: "rt cat", langs: nil, out: "cat"},
+		{q: `"the cat" a dog`, langs: []string{"en"}, out: `"the cat" dog`},
+		{q: `"a the" the`, langs: []string{"en"}, out: `"a the"`},
+		{q: "-the cat", langs: []string{"en"}, out: "-the cat"},
+		{q: "the a", langs: []string{"en"}, out: "the a"},
+		{q: "forbidden", out: "", blocked: true},
+		{q: "some FORBIDDEN! thing", out: "", blocked: true},
+		{q: `"bad phrase" here`, out: "", blocked: true},
+		{q: "bad other phrase", out: "bad other phrase"},
+	}
+	for _, fix := range fixtures {
+		out, blocked := qf.Filter(fix.q, fix.langs)
+		assert.Equal(fix.out, out, fix.q)
+		assert.Equal(fix.blocked, blocked, fix.q)
+	}
+
+	// nil filter passes through
+	var nilFilter *QueryFilter
+	out, blocked := nilFilter.Filter("the forbidden", []string{"en"})
+	assert.Equal("the forbidden", out)
+	assert.False(blocked)
+
+	_, err = NewQueryFilter(&QueryFilterConfig{BlockedPolicy: "dunno"})
+	assert.Error(err)
+	_, err = NewQueryFilter(&QueryFilterConfig{BlockedTerms: []string{"!!"}})
+	assert.Error(err)
+}
+
+func TestRequestLanguages(t *testing.T) {
+	assert := assert.New(t)
+
+	req, err := http.NewRequest("GET", "/", nil)
+	assert.NoError(err)
+	assert.Empty(requestLanguages(req))
+
+	req.Header.Set("Accept-Language", "en-US,en;q=0.9, DE;q=0.8, *;q=0.1")
+	assert.Equal([]string{"en", "en", "de"}, requestLanguages(req))
+}
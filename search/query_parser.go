@@ -0,0 +1,307 @@
+package search
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// A search query operator, like `from:handle.example.com` or `-lang:en`.
+type QueryOperator struct {
+	// operator name, lower-case (eg, "from" or "has")
+	Name  string
+	Value string
+	// prefixed with "-": exclude matching documents
+	Negated bool
+}
+
+// A user search query, split in to free text and structured operators.
+type ParsedQuery struct {
+	// Remaining terms and quoted phrases, in 'simple_query_string' syntax (including "-" negation of terms). May be empty.
+	Text      string
+	Operators []QueryOperator
+}
+
+// operators recognized by ParseSearchQuery; anything else which looks like "name:value" is left as text
+var queryOperatorNames = map[string]bool{
+	"from":   true,
+	"to":     true,
+	"did":    true,
+	"domain": true,
+	"lang":   true,
+	"since":  true,
+	"until":  true,
+	"has":    true,
+}
+
+// Values of the 'has:' operator.
+var queryHasValues = map[string]bool{
+	"image": true,
+	"link":  true,
+}
+
+// Splits a (sanitized) search query into free text and operators:
+//
+//   - `from:<handle or DID>`: posts by an account (or feeds and lists created by it)
+//   - `to:<handle or DID>`: posts mentioning an account
+//   - `did:<...>`: shorthand for `from:did:<...>`
+//   - `domain:<domain>`: posts linking to the domain (or its sub-domains); accounts with a handle under the domain
+//   - `lang:<code>`: posts in a language (2-letter code, eg "en")
+//   - `since:<date>` and `until:<date>`: posts created on or after, or before, a date (YYYY-MM-DD) or timestamp
+//   - `has:image` and `has:link`: posts with embedded images, or with links
+//
+// Any operator can be negated with a "-" prefix. Quoted phrases are preserved in the text, and are never treated as operators. Operators which do not apply to a given search (eg, `lang:` for accounts) are ignored.
+func ParseSearchQuery(raw string) ParsedQuery {
+	var pq ParsedQuery
+	var text []string
+	for _, tok := range tokenizeQuery(raw) {
+		if op, ok := parseQueryOperator(tok); ok {
+			pq.Operators = append(pq.Operators, op)
+			continue
+		}
+		text = append(text, tok)
+	}
+	pq.Text = strings.Join(text, " ")
+	return pq
+}
+
+// Splits on whitespace, except inside quoted phrases.
+func tokenizeQuery(raw string) []string {
+	var tokens []string
+	var cur strings.Builder
+	inQuote := false
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			cur.WriteRune(r)
+		case r == ' ' && !inQuote:
+			if cur.Len() > 0 {
+				tokens = append(tokens, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		tokens = append(tokens, cur.String())
+	}
+	return tokens
+}
+
+func parseQueryOperator(tok string) (QueryOperator, bool) {
+	var op QueryOperator
+	if strings.HasPrefix(tok, "-") {
+		op.Negated = true
+		tok = tok[1:]
+	}
+	// quoted phrases and grouping are always text
+	if strings.ContainsAny(tok, `"()`) {
+		return op, false
+	}
+	name, val, ok := strings.Cut(tok, ":")
+	if !ok || val == "" {
+		return op, false
+	}
+	op.Name = strings.ToLower(name)
+	op.Value = val
+	if !queryOperatorNames[op.Name] {
+		return op, false
+	}
+	if op.Name == "has" {
+		op.Value = strings.ToLower(op.Value)
+		if !queryHasValues[op.Value] {
+			return op, false
+		}
+	}
+	// "did:plc:abc" is a DID filter
+	if op.Name == "did" {
+		op.Value = "did:" + op.Value
+	}
+	return op, true
+}
+
+// The kind of document being searched, which determines how operators are translated to OpenSearch queries.
+type queryDocType int
+
+const (
+	queryDocPost queryDocType = iota
+	queryDocProfile
+	queryDocFeed
+)
+
+// Translates the query operators into OpenSearch query clauses, for the "filter" and "must_not" sections of a boolean query. Handles in `from:` and `to:` are resolved to DIDs using the directory; operators with invalid or unresolvable values are dropped (and logged).
+func (pq *ParsedQuery) clauses(ctx context.Context, dir identity.Directory, docType queryDocType) (filter, mustNot []map[string]any) {
+	for _, op := range pq.Operators {
+		clause := operatorClause(ctx, dir, docType, op)
+		if clause == nil {
+			continue
+		}
+		if op.Negated {
+			mustNot = append(mustNot, clause)
+		} else {
+			filter = append(filter, clause)
+		}
+	}
+	return filter, mustNot
+}
+
+func operatorClause(ctx context.Context, dir identity.Directory, docType queryDocType, op QueryOperator) map[string]any {
+	term := func(field, val string) map[string]any {
+		return map[string]any{"term": map[string]any{field: val}}
+	}
+	switch op.Name {
+	case "from", "did":
+		did, ok := resolveQueryAccount(ctx, dir, op.Value)
+		if !ok {
+			return nil
+		}
+		return term("did", did)
+	case "to":
+		if docType != queryDocPost {
+			return nil
+		}
+		did, ok := resolveQueryAccount(ctx, dir, op.Value)
+		if !ok {
+			return nil
+		}
+		return term("mention_did", did)
+	case "domain":
+		domain := strings.ToLower(strings.TrimPrefix(op.Value, "@"))
+		// same syntax rules as handles; also keeps wildcard characters out of the query below
+		if _, err := syntax.ParseHandle(domain); err != nil {
+			return nil
+		}
+		switch docType {
+		case queryDocPost:
+			return term("url_domain", domain)
+		case queryDocProfile:
+			return map[string]any{
+				"bool": map[string]any{
+					"should": []any{
+						term("handle", domain),
+						map[string]any{"wildcard": map[string]any{"handle": "*." + domain}},
+					},
+					"minimum_should_match": 1,
+				},
+			}
+		}
+	case "lang":
+		if docType != queryDocPost {
+			return nil
+		}
+		lang := strings.ToLower(strings.SplitN(op.Value, "-", 2)[0])
+		return term("lang_code_iso2", lang)
+	case "since", "until":
+		if docType != queryDocPost {
+			return nil
+		}
+		t, ok := parseQueryDate(op.Value)
+		if !ok {
+			slog.Debug("ignoring invalid date in search query", "operator", op.Name, "value", op.Value)
+			return nil
+		}
+		bound := "gte"
+		if op.Name == "until" {
+			bound = "lt"
+		}
+		return map[string]any{
+			"range": map[string]any{
+				"created_at": map[string]any{bound: t.Format(time.RFC3339)},
+			},
+		}
+	case "has":
+		if docType != queryDocPost {
+			return nil
+		}
+		switch op.Value {
+		case "image":
+			return map[string]any{"range": map[string]any{"embed_img_count": map[string]any{"gt": 0}}}
+		case "link":
+			return map[string]any{
+				"bool": map[string]any{
+					"should": []any{
+						map[string]any{"exists": map[string]any{"field": "link_url"}},
+						map[string]any{"exists": map[string]any{"field": "embed_url"}},
+					},
+					"minimum_should_match": 1,
+				},
+			}
+		}
+	}
+	return nil
+}
+
+// Resolves a handle (or passes through a DID) to a DID string.
+func resolveQueryAccount(ctx context.Context, dir identity.Directory, val string) (string, bool) {
+	if strings.HasPrefix(val, "did:") {
+		did, err := syntax.ParseDID(val)
+		if err != nil {
+			return "", false
+		}
+		return did.String(), true
+	}
+	handle, err := syntax.ParseHandle(strings.TrimPrefix(val, "@"))
+	if err != nil {
+		return "", false
+	}
+	id, err := dir.LookupHandle(ctx, handle)
+	if err != nil {
+		if err != identity.ErrHandleNotFound {
+			slog.Error("failed to resolve handle", "err", err)
+		}
+		return "", false
+	}
+	return id.DID.String(), true
+}
+
+// Parses a date (YYYY-MM-DD, as UTC midnight) or a full timestamp.
+func parseQueryDate(val string) (time.Time, bool) {
+	if t, err := time.Parse(time.DateOnly, val); err == nil {
+		return t, true
+	}
+	dt, err := syntax.ParseDatetimeLenient(val)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return dt.Time().UTC(), true
+}
+
+// Builds the boolean query for a parsed query: free text (or everything, if there is none), plus operator filters and any extra filters. The extra map is merged in to the "bool" section (eg, for "should" boosting).
+func (pq *ParsedQuery) boolQuery(ctx context.Context, dir identity.Directory, docType queryDocType, textFields []string, extraFilters []map[string]any, extra map[string]any) map[string]any {
+	var must map[string]any
+	if pq.Text == "" {
+		must = map[string]any{"match_all": map[string]any{}}
+	} else {
+		must = map[string]any{
+			"simple_query_string": map[string]any{
+				"query":            pq.Text,
+				"fields":           textFields,
+				"flags":            "AND|NOT|OR|PHRASE|PRECEDENCE|WHITESPACE",
+				"default_operator": "and",
+				"lenient":          true,
+				"analyze_wildcard": false,
+			},
+		}
+	}
+	filter, mustNot := pq.clauses(ctx, dir, docType)
+	filter = append(filter, extraFilters...)
+	b := map[string]any{
+		"must": must,
+	}
+	if len(filter) > 0 {
+		b["filter"] = filter
+	}
+	if len(mustNot) > 0 {
+		b["must_not"] = mustNot
+	}
+	for k, v := range extra {
+		b[k] = v
+	}
+	return map[string]any{"bool": b}
+}
@@ -0,0 +1,70 @@
+package search
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bluesky-social/indigo/atproto/identity"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	pq := ParseSearchQuery(`cats "at the zoo: day two" -dogs from:known.example.com -lang:en has:IMAGE has:video since:2024-01-02 foo:bar did:plc:abc222`)
+	assert.Equal(`cats "at the zoo: day two" -dogs has:video foo:bar`, pq.Text)
+	assert.Equal([]QueryOperator{
+		{Name: "from", Value: "known.example.com"},
+		{Name: "lang", Value: "en", Negated: true},
+		{Name: "has", Value: "image"},
+		{Name: "since", Value: "2024-01-02"},
+		{Name: "did", Value: "did:plc:abc222"},
+	}, pq.Operators)
+
+	pq = ParseSearchQuery("")
+	assert.Equal("", pq.Text)
+	assert.Empty(pq.Operators)
+
+	// grouping is left alone
+	pq = ParseSearchQuery("(from:known.example.com OR cats)")
+	assert.Equal("(from:known.example.com OR cats)", pq.Text)
+	assert.Empty(pq.Operators)
+}
+
+func TestSearchQueryClauses(t *testing.T) {
+	ctx := context.Background()
+	assert := assert.New(t)
+	dir := identity.NewMockDirectory()
+	dir.Insert(identity.Identity{
+		Handle: syntax.Handle("known.example.com"),
+		DID:    syntax.DID("did:plc:abc222"),
+	})
+
+	pq := ParseSearchQuery("from:known.example.com to:missing.example.com -domain:Example.com lang:en-US since:2024-01-02 until:2024-02-01T12:00:00Z has:image since:yesterday")
+	filter, mustNot := pq.clauses(ctx, &dir, queryDocPost)
+	assert.Equal([]map[string]any{
+		{"term": map[string]any{"did": "did:plc:abc222"}},
+		{"term": map[string]any{"lang_code_iso2": "en"}},
+		{"range": map[string]any{"created_at": map[string]any{"gte": "2024-01-02T00:00:00Z"}}},
+		{"range": map[string]any{"created_at": map[string]any{"lt": "2024-02-01T12:00:00Z"}}},
+		{"range": map[string]any{"embed_img_count": map[string]any{"gt": 0}}},
+	}, filter)
+	assert.Equal([]map[string]any{
+		{"term": map[string]any{"url_domain": "example.com"}},
+	}, mustNot)
+
+	// post-only operators are ignored for accounts, and domains match handles
+	filter, mustNot = pq.clauses(ctx, &dir, queryDocProfile)
+	assert.Equal([]map[string]any{
+		{"term": map[string]any{"did": "did:plc:abc222"}},
+	}, filter)
+	assert.Equal(1, len(mustNot))
+
+	// no text: match everything, with filters
+	q := pq.boolQuery(ctx, &dir, queryDocPost, []string{"everything"}, nil, nil)
+	b := q["bool"].(map[string]any)
+	assert.Equal(map[string]any{"match_all": map[string]any{}}, b["must"])
+	assert.Equal(1, len(b["must_not"].([]map[string]any)))
+}
@@ -0,0 +1,364 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bluesky-social/indigo/backfill"
+
+	"github.com/ipfs/go-cid"
+	typegen "github.com/whyrusleeping/cbor-gen"
+	"gorm.io/gorm"
+)
+
+// A reindex builds a fresh set of versioned indices (eg, after a schema change) while the current ones keep serving searches, then atomically swaps the aliases over:
+//
+//   - StartReindex creates the new indices, and starts a separate backfiller which crawls every repo into them. Live firehose events are written to both the current and the new indices.
+//   - GetReindexStatus reports progress: backfill jobs by state, and document counts for the current and new indices.
+//   - FinishReindex points the aliases at the new indices. The previous indices are detached but not deleted.
+//   - CancelReindex stops, and deletes the new indices.
+//
+// Progress is persisted in the database, and a reindex continues after a restart.
+
+var (
+	ErrReindexInProgress = errors.New("a reindex is already in progress")
+	ErrNoReindex         = errors.New("no reindex in progress")
+	ErrReindexNotReady   = errors.New("reindex backfill has not finished")
+	ErrReindexDisabled   = errors.New("reindexing requires the indexer to be running")
+)
+
+// backfill jobs for the reindex are kept apart from the primary backfill jobs
+const reindexJobsTable = "reindex_jobs"
+
+// Persisted state of the in-progress reindex, if any. There is at most one row.
+type ReindexState struct {
+	ID           uint `gorm:"primarykey"`
+	PostIndex    string
+	ProfileIndex string
+	FeedIndex    string
+	StartedAt    time.Time
+	// set once every repo known to the relay has been enqueued
+	DiscoveryDone bool
+}
+
+type reindexer struct {
+	state ReindexState
+	store *backfill.Gormstore
+	bf    *backfill.Backfiller
+	// stops repo discovery (nil once discovery is done)
+	cancel context.CancelFunc
+}
+
+func (rx *reindexer) target() indexTarget {
+	return indexTarget{post: rx.state.PostIndex, profile: rx.state.ProfileIndex, feed: rx.state.FeedIndex}
+}
+
+type aliasTarget struct {
+	alias  string
+	schema string
+	// new index for the alias; empty if no reindex is in progress
+	target string
+}
+
+func (s *Server) aliasTargets(t indexTarget) []aliasTarget {
+	return []aliasTarget{
+		{alias: s.postIndex, schema: palomarPostSchemaJSON, target: t.post},
+		{alias: s.profileIndex, schema: palomarProfileSchemaJSON, target: t.profile},
+		{alias: s.feedIndex, schema: palomarFeedSchemaJSON, target: t.feed},
+	}
+}
+
+type ReindexIndexStatus struct {
+	Alias string `json:"alias"`
+	// indices the alias currently points to; empty if the alias name is a concrete index from before aliasing
+	Current     []string `json:"current"`
+	CurrentDocs int64    `json:"currentDocs"`
+	// index being built by the reindex, if any
+	Target     string `json:"target,omitempty"`
+	TargetDocs int64  `json:"targetDocs,omitempty"`
+}
+
+type ReindexStatus struct {
+	Running       bool       `json:"running"`
+	StartedAt     *time.Time `json:"startedAt,omitempty"`
+	DiscoveryDone bool       `json:"discoveryDone"`
+	// backfill jobs for the new indices, by state (eg, "enqueued" or "complete")
+	Jobs    map[string]int64     `json:"jobs,omitempty"`
+	Indices []ReindexIndexStatus `json:"indices"`
+}
+
+func (s *Server) activeReindex() *reindexer {
+	s.reindexLk.RLock()
+	defer s.reindexLk.RUnlock()
+	return s.reindex
+}
+
+func (s *Server) reindexJobsDB() *gorm.DB {
+	return s.db.Table(reindexJobsTable).Session(&gorm.Session{})
+}
+
+// Enables reindexing, and continues any reindex which was in progress when the process last exited. Called when the indexer starts.
+func (s *Server) resumeReindex(ctx context.Context) error {
+	s.reindexLk.Lock()
+	defer s.reindexLk.Unlock()
+	s.reindexEnabled = true
+
+	var state ReindexState
+	if err := s.db.Find(&state).Error; err != nil {
+		return err
+	}
+	if state.ID == 0 {
+		return nil
+	}
+	if state.FeedIndex == "" {
+		// reindex was started before feeds were indexed
+		state.FeedIndex = versionedIndexName(s.feedIndex, state.StartedAt)
+		if err := s.createIndex(ctx, state.FeedIndex, palomarFeedSchemaJSON, ""); err != nil {
+			return err
+		}
+		if err := s.db.Save(&state).Error; err != nil {
+			return fmt.Errorf("saving reindex state: %w", err)
+		}
+	}
+	s.logger.Warn("resuming reindex", "postIndex", state.PostIndex, "profileIndex", state.ProfileIndex, "feedIndex", state.FeedIndex, "startedAt", state.StartedAt)
+	return s.startReindexer(ctx, state)
+}
+
+// Creates new versioned indices, and starts backfilling them. Live firehose events are written to the new indices from now on.
+func (s *Server) StartReindex(ctx context.Context) error {
+	s.reindexLk.Lock()
+	defer s.reindexLk.Unlock()
+	if !s.reindexEnabled {
+		return ErrReindexDisabled
+	}
+	if s.reindex != nil {
+		return ErrReindexInProgress
+	}
+
+	now := time.Now()
+	state := ReindexState{
+		ID:           1,
+		PostIndex:    versionedIndexName(s.postIndex, now),
+		ProfileIndex: versionedIndexName(s.profileIndex, now),
+		FeedIndex:    versionedIndexName(s.feedIndex, now),
+		StartedAt:    now,
+	}
+	s.logger.Warn("starting reindex", "postIndex", state.PostIndex, "profileIndex", state.ProfileIndex, "feedIndex", state.FeedIndex)
+	var created []string
+	for _, at := range s.aliasTargets(indexTarget{post: state.PostIndex, profile: state.ProfileIndex, feed: state.FeedIndex}) {
+		if err := s.createIndex(ctx, at.target, at.schema, ""); err != nil {
+			for _, name := range created {
+				s.deleteIndex(ctx, name)
+			}
+			return err
+		}
+		created = append(created, at.target)
+	}
+
+	// jobs from any previous reindex are stale
+	if err := s.db.Migrator().DropTable(reindexJobsTable); err != nil {
+		return fmt.Errorf("clearing reindex jobs: %w", err)
+	}
+	if err := s.reindexJobsDB().AutoMigrate(&backfill.GormDBJob{}); err != nil {
+		return fmt.Errorf("creating reindex jobs table: %w", err)
+	}
+	if err := s.db.Save(&state).Error; err != nil {
+		return fmt.Errorf("saving reindex state: %w", err)
+	}
+	return s.startReindexer(ctx, state)
+}
+
+// Starts the backfiller (and if needed, repo discovery) for a reindex. Caller must hold reindexLk.
+func (s *Server) startReindexer(ctx context.Context, state ReindexState) error {
+	store := backfill.NewGormstore(s.reindexJobsDB())
+	store.RetryPolicy = s.bfs.RetryPolicy
+	if _, err := store.ResumeInterrupted(ctx); err != nil {
+		return fmt.Errorf("resuming interrupted reindex jobs: %w", err)
+	}
+	if err := store.LoadJobs(ctx); err != nil {
+		return fmt.Errorf("loading reindex jobs: %w", err)
+	}
+
+	rx := &reindexer{
+		state: state,
+		store: store,
+	}
+	t := rx.target()
+	createOrUpdate := func(ctx context.Context, rawDID string, rev string, path string, rec typegen.CBORMarshaler, rcid *cid.Cid) error {
+		return s.handleCreateOrUpdateTo(ctx, t, rawDID, path, rec, rcid)
+	}
+	rx.bf = backfill.NewBackfiller(
+		"search-reindex",
+		store,
+		createOrUpdate,
+		createOrUpdate,
+		func(ctx context.Context, rawDID, rev, path string) error {
+			return s.handleDeleteFrom(ctx, t, rawDID, path)
+		},
+		s.bfOpts,
+	)
+	go rx.bf.Start()
+
+	if !state.DiscoveryDone {
+		dctx, cancel := context.WithCancel(context.Background())
+		rx.cancel = cancel
+		go func() {
+			if err := s.discoverRepos(dctx, store); err != nil {
+				return
+			}
+			if err := s.db.Model(&ReindexState{}).Where("id = ?", state.ID).Update("discovery_done", true).Error; err != nil {
+				s.logger.Error("failed to persist reindex state", "err", err)
+			}
+			s.reindexLk.Lock()
+			rx.state.DiscoveryDone = true
+			s.reindexLk.Unlock()
+		}()
+	}
+
+	s.reindex = rx
+	return nil
+}
+
+// Stops the reindex backfiller and discovery, and clears the persisted state. Caller must hold reindexLk.
+func (s *Server) stopReindexer(rx *reindexer) error {
+	if rx.cancel != nil {
+		rx.cancel()
+	}
+	rx.bf.Stop()
+	s.reindex = nil
+
+	if err := s.db.Delete(&ReindexState{}, rx.state.ID).Error; err != nil {
+		return fmt.Errorf("clearing reindex state: %w", err)
+	}
+	if err := s.db.Migrator().DropTable(reindexJobsTable); err != nil {
+		return fmt.Errorf("clearing reindex jobs: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) GetReindexStatus(ctx context.Context) (*ReindexStatus, error) {
+	status := &ReindexStatus{}
+	var target indexTarget
+
+	s.reindexLk.RLock()
+	rx := s.reindex
+	if rx != nil {
+		status.Running = true
+		startedAt := rx.state.StartedAt
+		status.StartedAt = &startedAt
+		status.DiscoveryDone = rx.state.DiscoveryDone
+		target = rx.target()
+	}
+	s.reindexLk.RUnlock()
+
+	if rx != nil {
+		var rows []struct {
+			State string
+			Count int64
+		}
+		if err := s.reindexJobsDB().Select("state, count(*) as count").Group("state").Scan(&rows).Error; err != nil {
+			return nil, fmt.Errorf("counting reindex jobs: %w", err)
+		}
+		status.Jobs = make(map[string]int64, len(rows))
+		for _, r := range rows {
+			status.Jobs[r.State] = r.Count
+		}
+	}
+
+	for _, idx := range s.aliasTargets(target) {
+		is := ReindexIndexStatus{
+			Alias:  idx.alias,
+			Target: idx.target,
+		}
+		current, err := s.aliasIndices(ctx, idx.alias)
+		if err != nil {
+			return nil, err
+		}
+		is.Current = current
+		if is.CurrentDocs, err = s.countDocuments(ctx, idx.alias, nil); err != nil {
+			return nil, err
+		}
+		if idx.target != "" {
+			if is.TargetDocs, err = s.countDocuments(ctx, idx.target, nil); err != nil {
+				return nil, err
+			}
+		}
+		status.Indices = append(status.Indices, is)
+	}
+	return status, nil
+}
+
+// Points the aliases at the new indices and ends the reindex. Unless forced, fails if the backfill has not finished. Returns the indices which the aliases previously pointed to; these are kept (eg, for rollback) and should be deleted by an operator once no longer needed.
+func (s *Server) FinishReindex(ctx context.Context, force bool) ([]string, error) {
+	s.reindexLk.Lock()
+	defer s.reindexLk.Unlock()
+	rx := s.reindex
+	if rx == nil {
+		return nil, ErrNoReindex
+	}
+
+	if !force {
+		if !rx.state.DiscoveryDone {
+			return nil, fmt.Errorf("%w: repo discovery is still running", ErrReindexNotReady)
+		}
+		var pending int64
+		if err := s.reindexJobsDB().Where("state IN ?", []string{backfill.StateEnqueued, backfill.StateInProgress}).Count(&pending).Error; err != nil {
+			return nil, fmt.Errorf("counting reindex jobs: %w", err)
+		}
+		if pending > 0 {
+			return nil, fmt.Errorf("%w: %d repos remaining", ErrReindexNotReady, pending)
+		}
+	}
+
+	// make sure queued writes have landed before swapping
+	if s.bulk != nil {
+		if err := s.bulk.Flush(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	var previous []string
+	for _, idx := range s.aliasTargets(rx.target()) {
+		current, err := s.aliasIndices(ctx, idx.alias)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.swapAlias(ctx, idx.alias, idx.target); err != nil {
+			return nil, err
+		}
+		for _, name := range current {
+			if name != idx.target {
+				previous = append(previous, name)
+			}
+		}
+	}
+
+	s.logger.Warn("finished reindex", "postIndex", rx.state.PostIndex, "profileIndex", rx.state.ProfileIndex, "feedIndex", rx.state.FeedIndex, "previous", previous)
+	if err := s.stopReindexer(rx); err != nil {
+		return previous, err
+	}
+	return previous, nil
+}
+
+// Stops the reindex in progress, and deletes the new indices. The aliases are not changed.
+func (s *Server) CancelReindex(ctx context.Context) error {
+	s.reindexLk.Lock()
+	defer s.reindexLk.Unlock()
+	rx := s.reindex
+	if rx == nil {
+		return ErrNoReindex
+	}
+
+	s.logger.Warn("cancelling reindex", "postIndex", rx.state.PostIndex, "profileIndex", rx.state.ProfileIndex, "feedIndex", rx.state.FeedIndex)
+	if err := s.stopReindexer(rx); err != nil {
+		return err
+	}
+	for _, at := range s.aliasTargets(rx.target()) {
+		if err := s.deleteIndex(ctx, at.target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
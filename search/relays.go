@@ -0,0 +1,110 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Returned (as a context cause) when a fallback relay connection is closed because the primary relay is available again.
+var errFailback = errors.New("primary relay available again")
+
+// A connection which lasted at least this long was healthy, and resets the reconnect backoff.
+const relayHealthyDuration = time.Minute
+
+// Consumes the firehose until the context is cancelled, starting with the primary relay (BGSHost). When a connection fails or drops, the next configured relay is tried, wrapping around (with backoff) once every relay has failed. While on a fallback relay, the primary is checked periodically, and reconnected to once it is healthy.
+func (s *Server) consumeFirehose(ctx context.Context) error {
+	hosts := append([]string{s.bgshost}, s.fallbackHosts...)
+	log := s.logger.With("func", "consumeFirehose")
+
+	idx := 0
+	backoff := time.Second
+	for {
+		host := hosts[idx]
+		connCtx, cancel := context.WithCancelCause(ctx)
+		if idx > 0 {
+			go s.watchPrimaryRelay(connCtx, cancel)
+		}
+
+		log.Info("subscribing to relay firehose", "host", host, "fallback", idx > 0)
+		relayConnected.WithLabelValues(host).Set(1)
+		start := time.Now()
+		err := s.consumeRelay(connCtx, host)
+		relayConnected.WithLabelValues(host).Set(0)
+		failback := errors.Is(context.Cause(connCtx), errFailback)
+		cancel(nil)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if failback {
+			log.Warn("primary relay is available again, failing back", "host", hosts[0], "fallback", host)
+			idx = 0
+			continue
+		}
+		relayDisconnects.WithLabelValues(host).Inc()
+		if err == nil {
+			err = fmt.Errorf("firehose closed")
+		}
+		if time.Since(start) >= relayHealthyDuration {
+			backoff = time.Second
+		}
+
+		next := (idx + 1) % len(hosts)
+		log.Error("relay firehose failed", "host", host, "err", err, "next", hosts[next])
+		if next != idx {
+			relayFailovers.Inc()
+		}
+		// every relay has failed in a row (or there is only one): wait before starting over
+		if next == 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff = min(2*backoff, time.Minute)
+		}
+		idx = next
+	}
+}
+
+// Periodically checks the primary relay's health endpoint, and cancels the context (with errFailback) once it responds.
+func (s *Server) watchPrimaryRelay(ctx context.Context, cancel context.CancelCauseFunc) {
+	ticker := time.NewTicker(s.failbackInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := s.checkRelayHealth(ctx, s.bgshost); err != nil {
+			s.logger.Debug("primary relay still unavailable", "host", s.bgshost, "err", err)
+			continue
+		}
+		cancel(errFailback)
+		return
+	}
+}
+
+func (s *Server) checkRelayHealth(ctx context.Context, host string) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	u := strings.Replace(host, "ws", "http", 1) + "/xrpc/_health"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("health check status: %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestRelayCursors(t *testing.T) {
+	assert := assert.New(t)
+
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(db.AutoMigrate(&LastSeq{}))
+	// cursor persisted before hosts were tracked
+	assert.NoError(db.Exec("INSERT INTO last_seqs (id, seq) VALUES (1, 1234)").Error)
+
+	s := &Server{db: db, bgshost: "wss://relay.example.com"}
+
+	// the legacy cursor belongs to the primary relay
+	cur, err := s.getLastCursor("wss://relay.example.com")
+	assert.NoError(err)
+	assert.Equal(int64(1234), cur)
+
+	// a fallback relay starts without a cursor
+	cur, err = s.getLastCursor("wss://other.example.com")
+	assert.NoError(err)
+	assert.Equal(int64(0), cur)
+
+	assert.NoError(s.updateLastCursor("wss://other.example.com", 50))
+	assert.NoError(s.updateLastCursor("wss://relay.example.com", 2000))
+	cur, err = s.getLastCursor("wss://other.example.com")
+	assert.NoError(err)
+	assert.Equal(int64(50), cur)
+	cur, err = s.getLastCursor("wss://relay.example.com")
+	assert.NoError(err)
+	assert.Equal(int64(2000), cur)
+
+	var count int64
+	assert.NoError(db.Model(&LastSeq{}).Count(&count).Error)
+	assert.Equal(int64(2), count)
+}
@@ -0,0 +1,179 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Configuration for relevance ranking of search results. When a RelevanceConfig is set on the server, post results are ordered by score (text match, decayed by age and boosted by engagement) instead of strictly by time.
+type RelevanceConfig struct {
+	// Decay function applied to post scores by age: "gauss", "exp", or "" (no decay)
+	RecencyDecay string
+	// Posts this much older than RecencyOffset have their score multiplied by RecencyDecayFactor
+	RecencyScale time.Duration
+	// Posts younger than this are not decayed
+	RecencyOffset time.Duration
+	// Between 0 and 1 (exclusive)
+	RecencyDecayFactor float64
+
+	// Boosts by engagement counts: the score is multiplied by ln(2 + weight * count). Zero disables the boost.
+	LikeWeight   float64
+	RepostWeight float64
+
+	// Weights of text fields in post and profile queries (eg, {"text": 2, "everything": 1}). If empty, only the combined "everything" field is searched.
+	PostFieldWeights    map[string]float64
+	ProfileFieldWeights map[string]float64
+
+	// AppView to fetch post engagement counts from (eg, "https://api.bsky.app"). Counts are only fetched if this is set and one of the engagement weights is non-zero.
+	AppViewHost string
+	// How often a batch of engagement counts is refreshed
+	EngagementRefreshInterval time.Duration
+	// Number of posts refreshed per interval, least-recently refreshed first
+	EngagementBatchSize int
+	// Posts older than this are no longer refreshed
+	EngagementMaxAge time.Duration
+}
+
+func DefaultRelevanceConfig() RelevanceConfig {
+	return RelevanceConfig{
+		RecencyDecay:              "gauss",
+		RecencyScale:              7 * 24 * time.Hour,
+		RecencyOffset:             12 * time.Hour,
+		RecencyDecayFactor:        0.5,
+		EngagementRefreshInterval: time.Minute,
+		EngagementBatchSize:       1000,
+		EngagementMaxAge:          7 * 24 * time.Hour,
+	}
+}
+
+func (rc *RelevanceConfig) Validate() error {
+	switch rc.RecencyDecay {
+	case "", "gauss", "exp":
+	default:
+		return fmt.Errorf("unsupported recency decay function: %q", rc.RecencyDecay)
+	}
+	if rc.RecencyDecay != "" {
+		if rc.RecencyScale <= 0 {
+			return fmt.Errorf("recency decay scale must be positive")
+		}
+		if rc.RecencyDecayFactor <= 0 || rc.RecencyDecayFactor >= 1 {
+			return fmt.Errorf("recency decay factor must be between 0 and 1")
+		}
+	}
+	if rc.LikeWeight < 0 || rc.RepostWeight < 0 {
+		return fmt.Errorf("engagement weights can not be negative")
+	}
+	for _, weights := range []map[string]float64{rc.PostFieldWeights, rc.ProfileFieldWeights} {
+		for field, w := range weights {
+			if w <= 0 {
+				return fmt.Errorf("field weight must be positive: %s", field)
+			}
+		}
+	}
+	return nil
+}
+
+// Whether engagement counts need to be fetched from the AppView.
+func (rc *RelevanceConfig) hydrateEngagement() bool {
+	return rc.AppViewHost != "" && rc.EngagementRefreshInterval > 0 && (rc.LikeWeight > 0 || rc.RepostWeight > 0)
+}
+
+// Parses field weights from a flag value like "text=2,everything=1". A field without a weight has weight 1.
+func ParseFieldWeights(s string) (map[string]float64, error) {
+	weights := map[string]float64{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		field, val, ok := strings.Cut(part, "=")
+		w := 1.0
+		if ok {
+			var err error
+			w, err = strconv.ParseFloat(strings.TrimSpace(val), 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid weight for field %s: %w", field, err)
+			}
+		}
+		weights[strings.TrimSpace(field)] = w
+	}
+	return weights, nil
+}
+
+// Query field list (eg, "text^2") from weights, or the default fields if there are none.
+func weightedFields(weights map[string]float64, def []string) []string {
+	if len(weights) == 0 {
+		return def
+	}
+	fields := make([]string, 0, len(weights))
+	for field, w := range weights {
+		if w == 1 {
+			fields = append(fields, field)
+		} else {
+			fields = append(fields, field+"^"+strconv.FormatFloat(w, 'f', -1, 64))
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Formats a duration in OpenSearch time units.
+func esDuration(d time.Duration) string {
+	return fmt.Sprintf("%ds", int64(d/time.Second))
+}
+
+// Scoring functions (for a 'function_score' query) for posts.
+func (rc *RelevanceConfig) postScoreFunctions() []map[string]any {
+	var funcs []map[string]any
+	if rc.RecencyDecay != "" {
+		funcs = append(funcs, map[string]any{
+			rc.RecencyDecay: map[string]any{
+				"created_at": map[string]any{
+					"origin": "now",
+					"scale":  esDuration(rc.RecencyScale),
+					"offset": esDuration(rc.RecencyOffset),
+					"decay":  rc.RecencyDecayFactor,
+				},
+			},
+		})
+	}
+	for _, boost := range []struct {
+		field  string
+		weight float64
+	}{
+		{"like_count", rc.LikeWeight},
+		{"repost_count", rc.RepostWeight},
+	} {
+		if boost.weight <= 0 {
+			continue
+		}
+		funcs = append(funcs, map[string]any{
+			"field_value_factor": map[string]any{
+				"field":    boost.field,
+				"factor":   boost.weight,
+				"modifier": "ln2p",
+				"missing":  0,
+			},
+		})
+	}
+	return funcs
+}
+
+// Wraps a post query with the configured score functions, if any.
+func (rc *RelevanceConfig) postQuery(query map[string]any) map[string]any {
+	funcs := rc.postScoreFunctions()
+	if len(funcs) == 0 {
+		return query
+	}
+	return map[string]any{
+		"function_score": map[string]any{
+			"query":      query,
+			"functions":  funcs,
+			"score_mode": "multiply",
+			"boost_mode": "multiply",
+		},
+	}
+}
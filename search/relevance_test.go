@@ -0,0 +1,58 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseFieldWeights(t *testing.T) {
+	assert := assert.New(t)
+
+	weights, err := ParseFieldWeights("text=2, everything,embed_img_alt_text=0.5")
+	assert.NoError(err)
+	assert.Equal(map[string]float64{"text": 2, "everything": 1, "embed_img_alt_text": 0.5}, weights)
+	assert.Equal([]string{"embed_img_alt_text^0.5", "everything", "text^2"}, weightedFields(weights, nil))
+	assert.Equal([]string{"everything"}, weightedFields(nil, []string{"everything"}))
+
+	_, err = ParseFieldWeights("text=lots")
+	assert.Error(err)
+}
+
+func TestRelevancePostQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	rc := DefaultRelevanceConfig()
+	assert.NoError(rc.Validate())
+	rc.LikeWeight = 0.5
+	q := rc.postQuery(map[string]any{"match_all": map[string]any{}})
+	fs := q["function_score"].(map[string]any)
+	assert.Equal(map[string]any{"match_all": map[string]any{}}, fs["query"])
+	assert.Equal([]map[string]any{
+		{"gauss": map[string]any{"created_at": map[string]any{
+			"origin": "now",
+			"scale":  "604800s",
+			"offset": "43200s",
+			"decay":  0.5,
+		}}},
+		{"field_value_factor": map[string]any{
+			"field":    "like_count",
+			"factor":   0.5,
+			"modifier": "ln2p",
+			"missing":  0,
+		}},
+	}, fs["functions"])
+
+	// nothing to score by: the query is unchanged
+	rc = RelevanceConfig{}
+	assert.NoError(rc.Validate())
+	assert.Equal(map[string]any{"match_all": map[string]any{}}, rc.postQuery(map[string]any{"match_all": map[string]any{}}))
+
+	rc = DefaultRelevanceConfig()
+	rc.RecencyDecay = "linear"
+	assert.Error(rc.Validate())
+	rc = DefaultRelevanceConfig()
+	rc.RecencyScale = -time.Hour
+	assert.Error(rc.Validate())
+}
@@ -0,0 +1,205 @@
+package search
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	es "github.com/opensearch-project/opensearch-go/v2"
+)
+
+type OpenSearchRetryConfig struct {
+	// How many times to retry a request which failed with a network error, or with status 429, 502, 503, or 504
+	MaxRetries int
+	// Delay before the first retry, doubled (with jitter) for each subsequent retry
+	InitialBackoff time.Duration
+	// Upper bound on the delay between retries
+	MaxBackoff time.Duration
+	// Consecutive failed requests (including retries) which open the circuit breaker; zero disables it
+	BreakerThreshold int
+	// How long the circuit breaker stays open before requests are attempted again
+	BreakerCooldown time.Duration
+}
+
+func DefaultOpenSearchRetryConfig() OpenSearchRetryConfig {
+	return OpenSearchRetryConfig{
+		MaxRetries:       3,
+		InitialBackoff:   250 * time.Millisecond,
+		MaxBackoff:       10 * time.Second,
+		BreakerThreshold: 10,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// Response statuses which are retried, and count as failures for the circuit breaker.
+var retryableStatuses = []int{http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// Configures retries on an OpenSearch client config, and (if enabled) wraps its HTTP transport with a circuit breaker. The breaker is returned (nil if disabled), and should also be passed to NewServer, so firehose consumption pauses while it is open.
+func (c OpenSearchRetryConfig) Apply(cfg *es.Config) (*CircuitBreaker, error) {
+	cfg.RetryOnStatus = retryableStatuses
+	cfg.MaxRetries = c.MaxRetries
+	cfg.DisableRetry = c.MaxRetries <= 0
+	cfg.EnableRetryOnTimeout = true
+	cfg.RetryBackoff = c.backoff
+
+	if c.BreakerThreshold <= 0 {
+		return nil, nil
+	}
+
+	base := cfg.Transport
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	// the client only applies CACert to an *http.Transport, so it has to be done before wrapping
+	if cfg.CACert != nil {
+		tr, ok := base.(*http.Transport)
+		if !ok {
+			return nil, fmt.Errorf("unable to set CA certificate for transport of type %T", base)
+		}
+		tr = tr.Clone()
+		if tr.TLSClientConfig == nil {
+			tr.TLSClientConfig = &tls.Config{}
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(cfg.CACert) {
+			return nil, fmt.Errorf("unable to add CA certificate")
+		}
+		tr.TLSClientConfig.RootCAs = pool
+		base = tr
+		cfg.CACert = nil
+	}
+
+	breaker := NewCircuitBreaker(c.BreakerThreshold, c.BreakerCooldown)
+	cfg.Transport = &breakerTransport{base: base, breaker: breaker}
+	return breaker, nil
+}
+
+// Exponential backoff with "equal jitter": a random delay between half and all of the exponential delay.
+func (c OpenSearchRetryConfig) backoff(attempt int) time.Duration {
+	openSearchRetries.Inc()
+	d := c.InitialBackoff
+	for i := 1; i < attempt && d < c.MaxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, c.MaxBackoff)
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// Returned for requests made while the circuit breaker is open.
+var ErrCircuitOpen = errors.New("opensearch circuit breaker is open")
+
+// Tracks consecutive OpenSearch request failures. After too many, the breaker opens: requests fail immediately, and firehose consumption pauses, until the cooldown has passed. The next request after that is a trial; if it fails, the breaker opens again.
+type CircuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	lk        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: max(threshold, 1),
+		cooldown:  cooldown,
+	}
+}
+
+// Whether the breaker is open (and still cooling down).
+func (b *CircuitBreaker) Open() bool {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	return time.Now().Before(b.openUntil)
+}
+
+// Blocks until the breaker is not open, or the context is cancelled.
+func (b *CircuitBreaker) Wait(ctx context.Context) error {
+	for {
+		b.lk.Lock()
+		wait := time.Until(b.openUntil)
+		b.lk.Unlock()
+		if wait <= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (b *CircuitBreaker) recordSuccess() {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	if b.failures >= b.threshold {
+		openSearchBreakerOpen.Set(0)
+	}
+	b.failures = 0
+}
+
+func (b *CircuitBreaker) recordFailure() {
+	b.lk.Lock()
+	defer b.lk.Unlock()
+	b.failures++
+	// NOTE: a failed trial request (after the cooldown) opens the breaker again
+	if b.failures >= b.threshold {
+		if b.failures == b.threshold {
+			openSearchBreakerTrips.Inc()
+		}
+		b.openUntil = time.Now().Add(b.cooldown)
+		openSearchBreakerOpen.Set(1)
+	}
+}
+
+type breakerTransport struct {
+	base    http.RoundTripper
+	breaker *CircuitBreaker
+}
+
+func (t *breakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.breaker.Open() {
+		return nil, ErrCircuitOpen
+	}
+	resp, err := t.base.RoundTrip(req)
+	switch {
+	case err != nil:
+		// a cancelled request says nothing about the cluster's health
+		if req.Context().Err() == nil {
+			t.breaker.recordFailure()
+		}
+	case slices.Contains(retryableStatuses, resp.StatusCode):
+		t.breaker.recordFailure()
+	default:
+		t.breaker.recordSuccess()
+	}
+	return resp, err
+}
+
+// Runs a firehose event handler, first waiting while the OpenSearch circuit breaker is open. If the handler fails and the breaker has opened (ie, OpenSearch is unavailable), the handler is run again once the breaker closes, instead of the event being dropped, so handlers need to be safe to repeat. Returns early only if the context is cancelled.
+func (s *Server) withOpenSearch(ctx context.Context, fn func() error) error {
+	for {
+		if s.breaker != nil {
+			if err := s.breaker.Wait(ctx); err != nil {
+				return err
+			}
+		}
+		err := fn()
+		if err == nil || s.breaker == nil || !s.breaker.Open() {
+			return err
+		}
+		firehoseEventRetries.Inc()
+		s.logger.Warn("opensearch unavailable, pausing firehose until the circuit breaker closes", "err", err)
+	}
+}
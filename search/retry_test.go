@@ -0,0 +1,88 @@
+package search
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	es "github.com/opensearch-project/opensearch-go/v2"
+	esapi "github.com/opensearch-project/opensearch-go/v2/opensearchapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenSearchRetryBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	c := DefaultOpenSearchRetryConfig()
+	c.InitialBackoff = 100 * time.Millisecond
+	c.MaxBackoff = time.Second
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		d := c.backoff(attempt)
+		assert.GreaterOrEqual(d, want/2)
+		assert.LessOrEqual(d, want)
+	}
+}
+
+func TestOpenSearchCircuitBreaker(t *testing.T) {
+	assert := assert.New(t)
+
+	var requests, failing atomic.Int64
+	failing.Store(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		if failing.Load() == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{}`))
+			return
+		}
+		w.Write([]byte(`{"count": 0}`))
+	}))
+	defer srv.Close()
+
+	rc := OpenSearchRetryConfig{
+		MaxRetries:       2,
+		InitialBackoff:   time.Millisecond,
+		MaxBackoff:       time.Millisecond,
+		BreakerThreshold: 5,
+		BreakerCooldown:  100 * time.Millisecond,
+	}
+	cfg := es.Config{Addresses: []string{srv.URL}}
+	breaker, err := rc.Apply(&cfg)
+	assert.NoError(err)
+	escli, err := es.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	count := func() (*esapi.Response, error) {
+		return esapi.CountRequest{Index: []string{"test"}}.Do(ctx, escli)
+	}
+
+	// a request and its retries
+	res, err := count()
+	assert.NoError(err)
+	assert.Equal(http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(int64(3), requests.Load())
+	assert.False(breaker.Open())
+
+	// the breaker opens, and later requests fail without reaching the server
+	_, err = count()
+	assert.Error(err)
+	assert.True(breaker.Open())
+	n := requests.Load()
+	_, err = count()
+	assert.ErrorIs(err, ErrCircuitOpen)
+	assert.Equal(n, requests.Load())
+
+	// after the cooldown, a successful request closes it
+	failing.Store(0)
+	assert.NoError(breaker.Wait(ctx))
+	res, err = count()
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.False(breaker.Open())
+}
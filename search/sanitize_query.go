@@ -0,0 +1,97 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// max size (in bytes) of an untrusted query string, after sanitizing
+	maxQueryBytes = 512
+	// max number of whitespace-separated terms in an untrusted query string
+	maxQueryTerms = 32
+	// max nesting depth of grouping parentheses
+	maxQueryParenDepth = 4
+)
+
+// SanitizeQuery cleans up an untrusted, user-provided query string before it is passed to ParseQuery and ends up in an OpenSearch 'simple_query_string' query.
+//
+// Only the syntax enabled by the query flags we send (AND, NOT, OR, PHRASE, PRECEDENCE, WHITESPACE) is preserved: other special characters (escapes, wildcards, fuzzy/slop) are replaced with whitespace. Unbalanced quotes and parentheses are dropped, parentheses are limited in nesting depth, and the overall query is limited in size and number of terms. The output is always valid UTF-8, and sanitizing is idempotent.
+func SanitizeQuery(raw string) string {
+	// character-level filtering, and truncation at a rune boundary
+	var b strings.Builder
+	for _, r := range strings.ToValidUTF8(raw, "") {
+		switch {
+		case unicode.IsSpace(r) || unicode.IsControl(r):
+			r = ' '
+		case r == '\\' || r == '*' || r == '~':
+			// escapes, prefix wildcards, and fuzzy/slop operators
+			r = ' '
+		}
+		if b.Len()+utf8.RuneLen(r) > maxQueryBytes {
+			break
+		}
+		b.WriteRune(r)
+	}
+
+	terms := strings.Fields(b.String())
+	if len(terms) > maxQueryTerms {
+		terms = terms[:maxQueryTerms]
+	}
+	s := strings.Join(terms, " ")
+
+	// drop the last quote if they are unbalanced
+	if strings.Count(s, `"`)%2 == 1 {
+		i := strings.LastIndex(s, `"`)
+		s = s[:i] + s[i+1:]
+	}
+
+	s = balanceParens(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Removes any parentheses (outside of quoted phrases) which are unmatched or nested too deeply.
+func balanceParens(s string) string {
+	drop := make(map[int]bool)
+	var open []int
+	inQuote := false
+	for i, r := range s {
+		switch r {
+		case '"':
+			inQuote = !inQuote
+		case '(':
+			if !inQuote {
+				open = append(open, i)
+			}
+		case ')':
+			if inQuote {
+				continue
+			}
+			if len(open) == 0 {
+				drop[i] = true
+				continue
+			}
+			if len(open) > maxQueryParenDepth {
+				drop[open[len(open)-1]] = true
+				drop[i] = true
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	for _, i := range open {
+		drop[i] = true
+	}
+	if len(drop) == 0 {
+		return s
+	}
+
+	var b strings.Builder
+	for i, r := range s {
+		if drop[i] {
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,91 @@
+package search
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSanitizeQuery(t *testing.T) {
+	assert := assert.New(t)
+
+	fixtures := []struct {
+		raw string
+		out string
+	}{
+		{raw: "", out: ""},
+		{raw: "  simple  ", out: "simple"},
+		{raw: "some +test \"with phrase\" -ok", out: "some +test \"with phrase\" -ok"},
+		{raw: "from:known.example.com hello", out: "from:known.example.com hello"},
+		{raw: "a | (b c)", out: "a | (b c)"},
+		{raw: "wild* fuzzy~2 \\escaped", out: "wild fuzzy 2 escaped"},
+		{raw: "unbalanced \"quote", out: "unbalanced quote"},
+		{raw: "\"one\" \"two", out: "\"one\" two"},
+		{raw: "((open", out: "open"},
+		{raw: "close))", out: "close"},
+		{raw: ")(backwards)(", out: "(backwards)"},
+		{raw: "\"(literal\" (x)", out: "\"(literal\" (x)"},
+		{raw: "((((((deep))))))", out: "((((deep))))"},
+		{raw: "tab\tnew\nline\x00null", out: "tab new line null"},
+		{raw: "bad\xffutf8", out: "badutf8"},
+	}
+
+	for _, fix := range fixtures {
+		assert.Equal(fix.out, SanitizeQuery(fix.raw), fix.raw)
+	}
+
+	long := strings.Repeat("word ", 1000)
+	assert.Equal(maxQueryTerms, len(strings.Fields(SanitizeQuery(long))))
+
+	huge := strings.Repeat("🦋", 1000)
+	out := SanitizeQuery(huge)
+	assert.True(len(out) <= maxQueryBytes)
+	assert.True(utf8.ValidString(out))
+}
+
+func FuzzSanitizeQuery(f *testing.F) {
+	for _, seed := range []string{"", "simple", "some +test \"with phrase\" -ok", "((((((deep))))))", "\"(\" )(", "a\\*~b"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, raw string) {
+		out := SanitizeQuery(raw)
+		if !utf8.ValidString(out) {
+			t.Fatalf("invalid UTF-8 for %q: %q", raw, out)
+		}
+		if len(out) > maxQueryBytes {
+			t.Fatalf("too long for %q: %d bytes", raw, len(out))
+		}
+		if len(strings.Fields(out)) > maxQueryTerms {
+			t.Fatalf("too many terms for %q: %q", raw, out)
+		}
+		if strings.ContainsAny(out, "\\*~") {
+			t.Fatalf("special characters remain for %q: %q", raw, out)
+		}
+		if strings.Count(out, `"`)%2 != 0 {
+			t.Fatalf("unbalanced quotes for %q: %q", raw, out)
+		}
+		depth := 0
+		inQuote := false
+		for _, r := range out {
+			switch {
+			case r == '"':
+				inQuote = !inQuote
+			case r == '(' && !inQuote:
+				depth++
+			case r == ')' && !inQuote:
+				depth--
+			}
+			if depth < 0 || depth > maxQueryParenDepth {
+				t.Fatalf("bad parentheses for %q: %q", raw, out)
+			}
+		}
+		if depth != 0 {
+			t.Fatalf("unbalanced parentheses for %q: %q", raw, out)
+		}
+		if again := SanitizeQuery(out); again != out {
+			t.Fatalf("not idempotent for %q: %q != %q", raw, again, out)
+		}
+	})
+}
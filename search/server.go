@@ -4,11 +4,12 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
-	"io"
 	"log/slog"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/bluesky-social/indigo/atproto/identity"
 	"github.com/bluesky-social/indigo/backfill"
@@ -28,31 +29,97 @@ type Server struct {
 	escli        *es.Client
 	postIndex    string
 	profileIndex string
+	feedIndex    string
 	db           *gorm.DB
 	bgshost      string
 	bgsxrpc      *xrpc.Client
 	dir          identity.Directory
 	echo         *echo.Echo
 	logger       *slog.Logger
+	queryFilter  *QueryFilter
+	// nil if documents are indexed individually
+	bulk *BulkIndexer
+	// repos to re-backfill after failed bulk writes; nil if documents are indexed individually
+	bulkFailed *bulkFailures
+	// nil if there is no OpenSearch circuit breaker
+	breaker *CircuitBreaker
+	// accounts which are not indexed
+	optOuts             *optOutSet
+	optOutScrubInterval time.Duration
+	// relays to fail over to, in order of preference (bgshost is the primary)
+	fallbackHosts    []string
+	failbackInterval time.Duration
 
-	bfs *backfill.Gormstore
-	bf  *backfill.Backfiller
+	// nil if the consistency checker is disabled
+	consistency *ConsistencyCheckConfig
+	// nil if results are not ranked by relevance
+	relevance *RelevanceConfig
+	// for fetching post engagement counts; nil if not enabled
+	appviewxrpc *xrpc.Client
+
+	bfs    *backfill.Gormstore
+	bf     *backfill.Backfiller
+	bfOpts *backfill.BackfillOptions
+	// nil unless backfilling from a directory of CAR files
+	carSource *backfill.DirSource
+	// empty unless backfill jobs are announced with Postgres NOTIFY
+	backfillNotifyURL string
+
+	reindexLk sync.RWMutex
+	// nil unless a reindex is in progress
+	reindex *reindexer
+	// only processes running the indexer can reindex
+	reindexEnabled bool
 }
 
 type LastSeq struct {
-	ID  uint `gorm:"primarykey"`
-	Seq int64
+	ID uint `gorm:"primarykey"`
+	// relay the cursor is for (websocket URL)
+	Host string `gorm:"uniqueIndex"`
+	Seq  int64
 }
 
 type Config struct {
 	BGSHost             string
 	ProfileIndex        string
 	PostIndex           string
+	FeedIndex           string
 	Logger              *slog.Logger
 	BGSSyncRateLimit    int
 	IndexMaxConcurrency int
+	// Optional query-time stopword and blocked term filtering
+	QueryFilter *QueryFilterConfig
+	// If set, documents are batched through the OpenSearch _bulk API, instead of being indexed individually
+	BulkIndex *BulkIndexerConfig
+	// If set, post results are ranked by relevance (recency and engagement) instead of by time
+	Relevance *RelevanceConfig
+	// Relays to consume the firehose from, in order, when the BGSHost firehose is unavailable
+	FallbackBGSHosts []string
+	// While consuming from a fallback relay, how often to check whether the primary is available again (default 5 minutes)
+	FailbackInterval time.Duration
+	// If set, samples of backfilled repos are periodically compared against the indices
+	ConsistencyCheck *ConsistencyCheckConfig
+	// The circuit breaker wrapping the OpenSearch client's transport (see OpenSearchRetryConfig), if any. Firehose consumption pauses while it is open.
+	OpenSearchBreaker *CircuitBreaker
+	// Backfill job priorities, by how repos are enqueued (default backfill.DefaultJobPriorities)
+	BackfillPriorities *backfill.JobPriorities
+	// How often documents of opted-out accounts are scrubbed from the indices, and the opt-out list reloaded (default 1 hour; negative to disable)
+	OptOutScrubInterval time.Duration
+	// If set, repos are backfilled from the CAR files in this directory (see backfill.DirSource), falling back to the relay for repos not in it
+	BackfillCARDir string
+	// If positive, repos are backfilled directly from each account's PDS instead of the relay, at up to this many requests per second to each PDS host (BGSSyncRateLimit then only bounds the number of parallel backfills)
+	BackfillPDSRateLimit float64
+	// How failed backfill jobs are retried, before they are moved to the dead-letter state (default backfill.DefaultRetryPolicy)
+	BackfillRetry *backfill.RetryPolicy
+	// If set, repos are indexed as they are downloaded, with bounded memory, rather than loaded in memory first (see backfill.Backfiller.StreamRepos)
+	BackfillStreamRepos bool
+	// If set (a Postgres connection string for the same database), backfill jobs enqueued by any process sharing the database, such as a readonly API server, are announced with NOTIFY, and wake the indexer's idle backfiller immediately instead of at its next poll
+	BackfillNotifyURL string
 }
 
+// Postgres notification channel on which enqueued backfill jobs are announced, if enabled.
+const backfillNotifyChannel = "palomar_backfill"
+
 func NewServer(db *gorm.DB, escli *es.Client, dir identity.Directory, config Config) (*Server, error) {
 	logger := config.Logger
 	if logger == nil {
@@ -64,12 +131,20 @@ func NewServer(db *gorm.DB, escli *es.Client, dir identity.Directory, config Con
 	logger.Info("running database migrations")
 	db.AutoMigrate(&LastSeq{})
 	db.AutoMigrate(&backfill.GormDBJob{})
+	db.AutoMigrate(&ReindexState{})
+	db.AutoMigrate(&IndexOptOut{})
 
 	bgsws := config.BGSHost
 	if !strings.HasPrefix(bgsws, "ws") {
 		return nil, fmt.Errorf("specified bgs host must include 'ws://' or 'wss://'")
 	}
 
+	for _, h := range config.FallbackBGSHosts {
+		if !strings.HasPrefix(h, "ws") {
+			return nil, fmt.Errorf("fallback bgs hosts must include 'ws://' or 'wss://'")
+		}
+	}
+
 	bgshttp := strings.Replace(bgsws, "ws", "http", 1)
 	bgsxrpc := &xrpc.Client{
 		Host: bgshttp,
@@ -79,6 +154,7 @@ func NewServer(db *gorm.DB, escli *es.Client, dir identity.Directory, config Con
 		escli:        escli,
 		profileIndex: config.ProfileIndex,
 		postIndex:    config.PostIndex,
+		feedIndex:    config.FeedIndex,
 		db:           db,
 		bgshost:      config.BGSHost, // NOTE: the original URL, not 'bgshttp'
 		bgsxrpc:      bgsxrpc,
@@ -86,7 +162,62 @@ func NewServer(db *gorm.DB, escli *es.Client, dir identity.Directory, config Con
 		logger:       logger,
 	}
 
+	s.breaker = config.OpenSearchBreaker
+	s.optOuts = &optOutSet{}
+	if err := s.optOuts.load(db); err != nil {
+		return nil, err
+	}
+	s.optOutScrubInterval = config.OptOutScrubInterval
+	if s.optOutScrubInterval == 0 {
+		s.optOutScrubInterval = time.Hour
+	}
+	s.fallbackHosts = config.FallbackBGSHosts
+	s.failbackInterval = config.FailbackInterval
+	if s.failbackInterval <= 0 {
+		s.failbackInterval = 5 * time.Minute
+	}
+
+	if config.ConsistencyCheck != nil {
+		if config.ConsistencyCheck.Interval <= 0 || config.ConsistencyCheck.SampleSize <= 0 {
+			return nil, fmt.Errorf("consistency check interval and sample size must be positive")
+		}
+		s.consistency = config.ConsistencyCheck
+	}
+
+	if config.QueryFilter != nil {
+		qf, err := NewQueryFilter(config.QueryFilter)
+		if err != nil {
+			return nil, err
+		}
+		s.queryFilter = qf
+	}
+
+	if config.BulkIndex != nil {
+		s.bulk = NewBulkIndexer(escli, logger, *config.BulkIndex)
+		s.bulk.breaker = s.breaker
+		s.bulkFailed = newBulkFailures()
+	}
+
+	if config.Relevance != nil {
+		if err := config.Relevance.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid relevance config: %w", err)
+		}
+		s.relevance = config.Relevance
+		if s.relevance.hydrateEngagement() {
+			s.appviewxrpc = &xrpc.Client{
+				Host: s.relevance.AppViewHost,
+			}
+		}
+	}
+
 	bfstore := backfill.NewGormstore(db)
+	if config.BackfillRetry != nil {
+		bfstore.RetryPolicy = *config.BackfillRetry
+	}
+	if config.BackfillNotifyURL != "" {
+		bfstore.NotifyChannel = backfillNotifyChannel
+		s.backfillNotifyURL = config.BackfillNotifyURL
+	}
 	opts := backfill.DefaultBackfillOptions()
 	if config.BGSSyncRateLimit > 0 {
 		opts.SyncRequestsPerSecond = config.BGSSyncRateLimit
@@ -100,7 +231,32 @@ func NewServer(db *gorm.DB, escli *es.Client, dir identity.Directory, config Con
 	} else {
 		opts.ParallelRecordCreates = 20
 	}
-	opts.NSIDFilter = "app.bsky."
+	// only the collections which are indexed
+	opts.NSIDFilters = []string{
+		"app.bsky.actor.profile/",
+		"app.bsky.feed.generator/",
+		"app.bsky.feed.post/",
+		"app.bsky.graph.list/",
+	}
+	if config.BackfillPriorities != nil {
+		opts.Priorities = *config.BackfillPriorities
+	}
+	opts.StreamRepos = config.BackfillStreamRepos
+	if config.BackfillPDSRateLimit > 0 {
+		pds := backfill.NewPDSSource(dir, config.BackfillPDSRateLimit, 1)
+		pds.UserAgent = "atproto-backfill-search/0.0.1"
+		opts.Source = pds
+	}
+	if config.BackfillCARDir != "" {
+		fallback := opts.Source
+		if fallback == nil {
+			relay := backfill.NewHTTPSource(opts.CheckoutPath, opts.SyncRequestsPerSecond)
+			relay.UserAgent = "atproto-backfill-search/0.0.1"
+			fallback = relay
+		}
+		s.carSource = backfill.NewDirSource(config.BackfillCARDir, fallback)
+		opts.Source = s.carSource
+	}
 	bf := backfill.NewBackfiller(
 		"search",
 		bfstore,
@@ -112,6 +268,7 @@ func NewServer(db *gorm.DB, escli *es.Client, dir identity.Directory, config Con
 
 	s.bfs = bfstore
 	s.bf = bf
+	s.bfOpts = opts
 
 	return s, nil
 }
@@ -122,6 +279,10 @@ var palomarPostSchemaJSON string
 //go:embed profile_schema.json
 var palomarProfileSchemaJSON string
 
+//go:embed feed_schema.json
+var palomarFeedSchemaJSON string
+
+// Ensures the post, profile, and feed aliases exist, creating a new versioned index behind each missing alias. An existing concrete index with the alias name (from before indices were aliased) is left in place, and is replaced by the first reindex.
 func (s *Server) EnsureIndices(ctx context.Context) error {
 
 	indices := []struct {
@@ -130,34 +291,34 @@ func (s *Server) EnsureIndices(ctx context.Context) error {
 	}{
 		{Name: s.postIndex, SchemaJSON: palomarPostSchemaJSON},
 		{Name: s.profileIndex, SchemaJSON: palomarProfileSchemaJSON},
+		{Name: s.feedIndex, SchemaJSON: palomarFeedSchemaJSON},
 	}
 	for _, idx := range indices {
-		resp, err := s.escli.Indices.Exists([]string{idx.Name})
+		current, err := s.aliasIndices(ctx, idx.Name)
 		if err != nil {
 			return err
 		}
-		defer resp.Body.Close()
-		io.ReadAll(resp.Body)
-		if resp.IsError() && resp.StatusCode != 404 {
-			return fmt.Errorf("failed to check index existence")
+		if current != nil {
+			s.logger.Info("using opensearch alias", "alias", idx.Name, "indices", current)
+			continue
 		}
-		if resp.StatusCode == 404 {
-			s.logger.Warn("creating opensearch index", "index", idx.Name)
-			if len(idx.SchemaJSON) < 2 {
-				return fmt.Errorf("empty schema file (go:embed failed)")
-			}
-			buf := strings.NewReader(idx.SchemaJSON)
-			resp, err := s.escli.Indices.Create(
-				idx.Name,
-				s.escli.Indices.Create.WithBody(buf))
-			if err != nil {
-				return err
-			}
-			defer resp.Body.Close()
-			io.ReadAll(resp.Body)
-			if resp.IsError() {
-				return fmt.Errorf("failed to create index")
-			}
+		legacy, err := s.indexExists(ctx, idx.Name)
+		if err != nil {
+			return err
+		}
+		if legacy {
+			s.logger.Warn("opensearch index is not an alias; a reindex will migrate it", "index", idx.Name)
+			continue
+		}
+		name := versionedIndexName(idx.Name, time.Now())
+		s.logger.Warn("creating opensearch index", "index", name, "alias", idx.Name)
+		if err := s.createIndex(ctx, name, idx.SchemaJSON, idx.Name); err != nil {
+			return err
+		}
+	}
+	if s.relevance != nil {
+		if err := s.ensureEngagementMapping(ctx); err != nil {
+			return err
 		}
 	}
 	return nil
@@ -202,6 +363,10 @@ func (s *Server) RunAPI(listen string) error {
 	e.GET("/metrics", echo.WrapHandler(promhttp.Handler()))
 	e.GET("/xrpc/app.bsky.unspecced.searchPostsSkeleton", s.handleSearchPostsSkeleton)
 	e.GET("/xrpc/app.bsky.unspecced.searchActorsSkeleton", s.handleSearchActorsSkeleton)
+	e.GET("/xrpc/app.bsky.unspecced.searchActorsSkeletonTypeahead", s.handleSearchActorsSkeletonTypeahead)
+	e.GET("/xrpc/app.bsky.unspecced.searchFeedsSkeleton", s.handleSearchFeedsSkeleton)
+	e.GET("/xrpc/app.bsky.unspecced.searchListsSkeleton", s.handleSearchListsSkeleton)
+	e.GET("/xrpc/app.bsky.unspecced.searchPostsAggregations", s.handleSearchPostsAggregations)
 	e.GET("/xrpc/app.bsky.unspecced.indexRepos", s.handleIndexRepos)
 	s.echo = e
 
@@ -211,6 +376,7 @@ func (s *Server) RunAPI(listen string) error {
 
 func (s *Server) RunMetrics(listen string) error {
 	http.Handle("/metrics", promhttp.Handler())
+	s.registerAdminHandlers(http.DefaultServeMux)
 	return http.ListenAndServe(listen, nil)
 }
 
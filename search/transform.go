@@ -1,6 +1,8 @@
 package search
 
 import (
+	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
@@ -37,6 +39,7 @@ type PostDoc struct {
 	MentionDID      []string `json:"mention_did,omitempty"`
 	LinkURL         []string `json:"link_url,omitempty"`
 	EmbedURL        *string  `json:"embed_url,omitempty"`
+	URLDomain       []string `json:"url_domain,omitempty"`
 	EmbedATURI      *string  `json:"embed_aturi,omitempty"`
 	ReplyRootATURI  *string  `json:"reply_root_aturi,omitempty"`
 	EmbedImgCount   int      `json:"embed_img_count"`
@@ -46,6 +49,29 @@ type PostDoc struct {
 	Emoji           []string `json:"emoji,omitempty"`
 }
 
+// A feed generator or list record. These share an index, distinguished by collection.
+type FeedDoc struct {
+	DocIndexTs       string   `json:"doc_index_ts"`
+	DID              string   `json:"did"`
+	RecordCollection string   `json:"record_collection"`
+	RecordRkey       string   `json:"record_rkey"`
+	RecordCID        string   `json:"record_cid"`
+	CreatedAt        *string  `json:"created_at,omitempty"`
+	Name             string   `json:"name"`
+	Description      *string  `json:"description,omitempty"`
+	ServiceDID       *string  `json:"service_did,omitempty"`
+	ListPurpose      *string  `json:"list_purpose,omitempty"`
+	SelfLabel        []string `json:"self_label,omitempty"`
+	Tag              []string `json:"tag,omitempty"`
+	Emoji            []string `json:"emoji,omitempty"`
+	HasAvatar        bool     `json:"has_avatar"`
+}
+
+const (
+	feedGeneratorCollection = "app.bsky.feed.generator"
+	listCollection          = "app.bsky.graph.list"
+)
+
 // Returns the search index document ID (`_id`) for this document.
 //
 // This identifier should be URL safe and not contain a slash ("/").
@@ -60,6 +86,22 @@ func (d *PostDoc) DocId() string {
 	return d.DID + "_" + d.RecordRkey
 }
 
+// Returns the search index document ID (`_id`) for this document.
+//
+// This identifier should be URL safe and not contain a slash ("/").
+func (d *FeedDoc) DocId() string {
+	return feedDocId(d.DID, d.RecordCollection, d.RecordRkey)
+}
+
+func feedDocId(did, collection, rkey string) string {
+	return did + "_" + collection + "_" + rkey
+}
+
+// Returns the AT-URI of the record this document was created from.
+func (d *FeedDoc) URI() string {
+	return fmt.Sprintf("at://%s/%s/%s", d.DID, d.RecordCollection, d.RecordRkey)
+}
+
 func TransformProfile(profile *appbsky.ActorProfile, ident *identity.Identity, cid string) ProfileDoc {
 	// TODO: placeholder for future alt text on profile blobs
 	var altText []string
@@ -167,6 +209,7 @@ func TransformPost(post *appbsky.FeedPost, ident *identity.Identity, rkey, cid s
 		MentionDID:      mentionDIDs,
 		LinkURL:         linkURLs,
 		EmbedURL:        embedURL,
+		URLDomain:       parseURLDomains(linkURLs, embedURL),
 		EmbedATURI:      embedATURI,
 		ReplyRootATURI:  replyRootATURI,
 		EmbedImgCount:   embedImgCount,
@@ -183,6 +226,89 @@ func TransformPost(post *appbsky.FeedPost, ident *identity.Identity, rkey, cid s
 	return doc
 }
 
+func TransformFeedGenerator(gen *appbsky.FeedGenerator, ident *identity.Identity, rkey, cid string) FeedDoc {
+	var selfLabels []string
+	if gen.Labels != nil && gen.Labels.LabelDefs_SelfLabels != nil {
+		for _, le := range gen.Labels.LabelDefs_SelfLabels.Values {
+			selfLabels = append(selfLabels, le.Val)
+		}
+	}
+	doc := FeedDoc{
+		DocIndexTs:       time.Now().UTC().Format(util.ISO8601),
+		DID:              ident.DID.String(),
+		RecordCollection: feedGeneratorCollection,
+		RecordRkey:       rkey,
+		RecordCID:        cid,
+		Name:             gen.DisplayName,
+		Description:      gen.Description,
+		SelfLabel:        selfLabels,
+		Tag:              parseFacetTags(gen.DescriptionFacets),
+		HasAvatar:        gen.Avatar != nil,
+	}
+	if gen.Did != "" {
+		doc.ServiceDID = &gen.Did
+	}
+	if gen.Description != nil {
+		doc.Emoji = parseEmojis(*gen.Description)
+	}
+	if gen.CreatedAt != "" {
+		doc.CreatedAt = &gen.CreatedAt
+	}
+	return doc
+}
+
+func TransformList(list *appbsky.GraphList, ident *identity.Identity, rkey, cid string) FeedDoc {
+	var selfLabels []string
+	if list.Labels != nil && list.Labels.LabelDefs_SelfLabels != nil {
+		for _, le := range list.Labels.LabelDefs_SelfLabels.Values {
+			selfLabels = append(selfLabels, le.Val)
+		}
+	}
+	doc := FeedDoc{
+		DocIndexTs:       time.Now().UTC().Format(util.ISO8601),
+		DID:              ident.DID.String(),
+		RecordCollection: listCollection,
+		RecordRkey:       rkey,
+		RecordCID:        cid,
+		Name:             list.Name,
+		Description:      list.Description,
+		ListPurpose:      list.Purpose,
+		SelfLabel:        selfLabels,
+		Tag:              parseFacetTags(list.DescriptionFacets),
+		HasAvatar:        list.Avatar != nil,
+	}
+	if list.Description != nil {
+		doc.Emoji = parseEmojis(*list.Description)
+	}
+	if list.CreatedAt != "" {
+		doc.CreatedAt = &list.CreatedAt
+	}
+	return doc
+}
+
+// Hostnames of the URLs, and each of their parent domains (eg, "en.wikipedia.org" and "wikipedia.org"), for searching by domain.
+func parseURLDomains(urls []string, extra *string) []string {
+	if extra != nil {
+		urls = append(urls[:len(urls):len(urls)], *extra)
+	}
+	var ret []string
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+		host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+		labels := strings.Split(host, ".")
+		for i := 0; i < len(labels)-1; i++ {
+			ret = append(ret, strings.Join(labels[i:], "."))
+		}
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return dedupeStrings(ret)
+}
+
 func dedupeStrings(in []string) []string {
 	var out []string
 	seen := make(map[string]bool)
@@ -222,6 +348,22 @@ func parsePostTags(p *appbsky.FeedPost) []string {
 	return dedupeStrings(ret)
 }
 
+// Hashtags from rich-text facets (eg, in a feed generator or list description).
+func parseFacetTags(facets []*appbsky.RichtextFacet) []string {
+	var ret []string
+	for _, facet := range facets {
+		for _, feat := range facet.Features {
+			if feat.RichtextFacet_Tag != nil {
+				ret = append(ret, feat.RichtextFacet_Tag.Tag)
+			}
+		}
+	}
+	if len(ret) == 0 {
+		return nil
+	}
+	return dedupeStrings(ret)
+}
+
 func parseEmojis(s string) []string {
 	var ret []string = []string{}
 	seen := make(map[string]bool)
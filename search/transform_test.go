@@ -113,3 +113,39 @@ func testPostFixture(t *testing.T, row postFixture) {
 	assert.Equal(row.PostDoc, doc)
 	assert.Equal(row.DocId, doc.DocId())
 }
+
+func TestTransformFeeds(t *testing.T) {
+	assert := assert.New(t)
+
+	ident := identity.Identity{
+		DID:    syntax.DID("did:plc:abc111"),
+		Handle: syntax.Handle("handle.example.com"),
+	}
+	desc := "cat pictures 🐈 only"
+	gen := appbsky.FeedGenerator{
+		Did:         "did:web:feeds.example.com",
+		DisplayName: "Cats",
+		Description: &desc,
+		CreatedAt:   "2024-01-01T00:00:00Z",
+	}
+	doc := TransformFeedGenerator(&gen, &ident, "cats", "bafyreiabc")
+	assert.Equal("app.bsky.feed.generator", doc.RecordCollection)
+	assert.Equal("Cats", doc.Name)
+	assert.Equal("did:web:feeds.example.com", *doc.ServiceDID)
+	assert.Equal([]string{"🐈"}, doc.Emoji)
+	assert.Equal("did:plc:abc111_app.bsky.feed.generator_cats", doc.DocId())
+	assert.Equal("at://did:plc:abc111/app.bsky.feed.generator/cats", doc.URI())
+
+	purpose := "app.bsky.graph.defs#curatelist"
+	list := appbsky.GraphList{
+		Name:    "Cat People",
+		Purpose: &purpose,
+	}
+	doc = TransformList(&list, &ident, "3kaz2ifpkqs2x", "bafyreiabc")
+	assert.Equal("app.bsky.graph.list", doc.RecordCollection)
+	assert.Equal("Cat People", doc.Name)
+	assert.Equal(&purpose, doc.ListPurpose)
+	assert.Nil(doc.CreatedAt)
+	assert.Nil(doc.ServiceDID)
+	assert.Equal("at://did:plc:abc111/app.bsky.graph.list/3kaz2ifpkqs2x", doc.URI())
+}
@@ -10,6 +10,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/bluesky-social/indigo/api"
 	atproto "github.com/bluesky-social/indigo/api/atproto"
 	"github.com/bluesky-social/indigo/repo"
 	"github.com/bluesky-social/indigo/xrpc"
@@ -332,6 +333,257 @@ func TestBGSTakedown(t *testing.T) {
 	assert.Equal(alice.did, last.RepoCommit.Repo)
 }
 
+func TestBGSHostAdmin(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping BGS test in 'short' test mode")
+	}
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	didr := TestPLC(t)
+	p1 := MustSetupPDS(t, ".hpds", didr)
+	p1.Run(t)
+
+	b1 := MustSetupBGS(t, didr)
+	b1.Run(t)
+	if err := b1.bgs.CreateAdminToken("admin-key"); err != nil {
+		t.Fatal(err)
+	}
+	admin := &api.RelayAdminClient{Host: "http://" + b1.Host(), AdminKey: "admin-key"}
+
+	b1.tr.TrialHosts = []string{p1.RawHost()}
+
+	p1.RequestScraping(t, b1)
+	time.Sleep(time.Millisecond * 50)
+	es1 := b1.Events(t, 0)
+
+	bob := p1.MustNewUser(t, "bob.hpds")
+	alice := p1.MustNewUser(t, "alice.hpds")
+	bob.Post(t, "cats for cats")
+	alice.Post(t, "no i like dogs")
+	es1.WaitFor(4)
+
+	host := func() api.RelayHost {
+		t.Helper()
+		hosts, err := admin.ListHosts(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hosts) != 1 {
+			t.Fatalf("expected a single host, got %d", len(hosts))
+		}
+		return hosts[0]
+	}
+
+	h := host()
+	assert.Equal(p1.RawHost(), h.Host)
+	assert.True(h.Connected)
+	assert.Equal(int64(2), h.RepoCount)
+	assert.NotNil(h.LastEventAt)
+
+	// no more repos are accepted from the host
+	assert.NoError(admin.SetHostRepoLimit(ctx, p1.RawHost(), 2))
+	carol := p1.MustNewUser(t, "carol.hpds")
+	carol.Post(t, "hello?")
+	time.Sleep(time.Millisecond * 100)
+	h = host()
+	assert.Equal(int64(2), h.RepoCount)
+	assert.Equal(int64(2), h.RepoLimit)
+
+	// events from a paused host are dropped until it's resumed (the test PDS doesn't replay events from cursors)
+	assert.NoError(admin.PauseHost(ctx, p1.RawHost()))
+	time.Sleep(time.Millisecond * 50)
+	h = host()
+	assert.True(h.Paused)
+	assert.False(h.Connected)
+
+	es2 := b1.Events(t, -1)
+	alice.Post(t, "is anyone there")
+	time.Sleep(time.Millisecond * 100)
+	assert.Len(es2.All(), 0)
+
+	assert.NoError(admin.ResumeHost(ctx, p1.RawHost()))
+	time.Sleep(time.Millisecond * 50)
+	alice.Post(t, "back again")
+	last := es2.Next()
+	assert.Equal(alice.did, last.RepoCommit.Repo)
+	h = host()
+	assert.False(h.Paused)
+	assert.True(h.Connected)
+
+	res, err := admin.PurgeHost(ctx, p1.RawHost())
+	assert.NoError(err)
+	assert.Equal(int64(2), res.ReposDeleted)
+	hosts, err := admin.ListHosts(ctx)
+	assert.NoError(err)
+	assert.Len(hosts, 0)
+
+	assert.Error(admin.PauseHost(ctx, p1.RawHost()))
+}
+
+func TestBGSNonArchival(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping BGS test in 'short' test mode")
+	}
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	didr := TestPLC(t)
+	p1 := MustSetupPDS(t, ".napds", didr)
+	p1.Run(t)
+
+	b1 := MustSetupBGS(t, didr)
+	b1.SetNonArchival(t)
+	b1.Run(t)
+
+	b1.tr.TrialHosts = []string{p1.RawHost()}
+
+	p1.RequestScraping(t, b1)
+	time.Sleep(time.Millisecond * 50)
+	es1 := b1.Events(t, 0)
+
+	bob := p1.MustNewUser(t, "bob.napds")
+	bob.Post(t, "cats for cats")
+	post := bob.Post(t, "and dogs")
+	evts := es1.WaitFor(3)
+
+	// commits are still checked and re-emitted with their blocks
+	last := evts[2].RepoCommit
+	assert.Equal(bob.did, last.Repo)
+	assert.False(last.TooBig)
+	assert.Len(last.Ops, 1)
+	assert.Equal(post.Cid, last.Ops[0].Cid.String())
+	sc := commitFromSlice(t, last.Blocks, (cid.Cid)(last.Commit))
+	assert.Equal(last.Rev, sc.Rev)
+
+	// but repos aren't kept
+	c := &xrpc.Client{Host: "http://" + b1.Host()}
+	head, err := atproto.SyncGetLatestCommit(ctx, c, bob.did)
+	assert.NoError(err)
+	assert.Equal(last.Rev, head.Rev)
+	_, err = atproto.SyncGetRepo(ctx, c, bob.did, "")
+	assert.Error(err)
+}
+
+func TestBGSHandleRecheck(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping BGS test in 'short' test mode")
+	}
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	didr := TestPLC(t)
+	p1 := MustSetupPDS(t, ".hcpds", didr)
+	p1.Run(t)
+
+	b1 := MustSetupBGS(t, didr)
+	b1.Run(t)
+
+	b1.tr.TrialHosts = []string{p1.RawHost()}
+
+	p1.RequestScraping(t, b1)
+	time.Sleep(time.Millisecond * 50)
+	es1 := b1.Events(t, 0)
+
+	bob := p1.MustNewUser(t, "bob.hcpds")
+	bob.Post(t, "cats for cats")
+	es1.WaitFor(2)
+
+	// nothing changed
+	res, err := b1.bgs.RecheckHandle(ctx, bob.did)
+	assert.NoError(err)
+	assert.True(res.Valid)
+	assert.False(res.Changed)
+	assert.Equal("bob.hcpds", res.Handle)
+
+	// the handle doesn't resolve anymore
+	b1.tr.TrialHosts = nil
+	res, err = b1.bgs.RecheckHandle(ctx, bob.did)
+	assert.NoError(err)
+	assert.False(res.Valid)
+	assert.True(res.Changed)
+
+	evt := es1.Next()
+	if assert.NotNil(evt.RepoIdentity) {
+		assert.Equal(bob.did, evt.RepoIdentity.Did)
+		assert.Equal("handle.invalid", *evt.RepoIdentity.Handle)
+	}
+
+	res, err = b1.bgs.RecheckHandle(ctx, bob.did)
+	assert.NoError(err)
+	assert.False(res.Changed)
+
+	// and it does again
+	b1.tr.TrialHosts = []string{p1.RawHost()}
+	res, err = b1.bgs.RecheckHandle(ctx, bob.did)
+	assert.NoError(err)
+	assert.True(res.Valid)
+	assert.True(res.Changed)
+
+	evt = es1.Next()
+	if assert.NotNil(evt.RepoIdentity) {
+		assert.Equal("bob.hcpds", *evt.RepoIdentity.Handle)
+	}
+}
+
+func TestBGSEventFilters(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping BGS test in 'short' test mode")
+	}
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	didr := TestPLC(t)
+	p1 := MustSetupPDS(t, ".fpds", didr)
+	p1.Run(t)
+
+	b1 := MustSetupBGS(t, didr)
+	b1.Run(t)
+
+	b1.tr.TrialHosts = []string{p1.RawHost()}
+
+	p1.RequestScraping(t, b1)
+	time.Sleep(time.Millisecond * 50)
+	es1 := b1.Events(t, 0)
+
+	bob := p1.MustNewUser(t, "bob.fpds")
+	alice := p1.MustNewUser(t, "alice.fpds")
+	es1.WaitFor(2)
+
+	filter := b1.bgs.Filter()
+	assert.NoError(filter.BlockDid(ctx, bob.did, "spam"))
+	bob.Post(t, "buy my stuff")
+	alice.Post(t, "hello")
+	evt := es1.Next()
+	assert.Equal(alice.did, evt.RepoCommit.Repo)
+
+	// only alice is allowed
+	assert.NoError(filter.RemoveDid(ctx, bob.did))
+	assert.NoError(filter.AllowDid(ctx, alice.did, ""))
+	filter.SetAllowlistOnly(true)
+	bob.Post(t, "buy my stuff again")
+	alice.Post(t, "hello again")
+	evt = es1.Next()
+	assert.Equal(alice.did, evt.RepoCommit.Repo)
+	filter.SetAllowlistOnly(false)
+
+	list := filter.List()
+	assert.Len(list.Dids, 1)
+	assert.True(list.Dids[0].Allow)
+
+	// everything from the host is dropped
+	host, _, _ := strings.Cut(p1.RawHost(), ":")
+	assert.NoError(filter.BlockHost(ctx, host, ""))
+	alice.Post(t, "is anyone there")
+	time.Sleep(time.Millisecond * 100)
+	assert.Len(es1.All(), 4)
+
+	assert.NoError(filter.UnblockHost(ctx, host))
+	bob.Post(t, "back again")
+	evt = es1.Next()
+	assert.Equal(bob.did, evt.RepoCommit.Repo)
+}
+
 func jsonPrint(v any) {
 	b, _ := json.Marshal(v)
 	fmt.Println(string(b))
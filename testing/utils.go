@@ -375,9 +375,11 @@ func TestPLC(t *testing.T) *plc.FakeDid {
 }
 
 type TestBGS struct {
-	bgs *bgs.BGS
-	tr  *api.TestHandleResolver
-	db  *gorm.DB
+	bgs     *bgs.BGS
+	tr      *api.TestHandleResolver
+	db      *gorm.DB
+	cardb   *gorm.DB
+	repoman *repomgr.RepoManager
 
 	// listener is owned by by the BGS structure and should be closed by
 	// shutting down the BGS.
@@ -465,12 +467,23 @@ func SetupBGS(ctx context.Context, didr plc.PLCClient) (*TestBGS, error) {
 
 	return &TestBGS{
 		db:       maindb,
+		cardb:    cardb,
+		repoman:  repoman,
 		bgs:      b,
 		tr:       tr,
 		listener: listener,
 	}, nil
 }
 
+// SetNonArchival switches the BGS to non-archival mode, which must be done before it runs.
+func (b *TestBGS) SetNonArchival(t *testing.T) {
+	cs, err := carstore.NewNonArchivalCarstore(b.cardb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.repoman.SetNonArchival(cs)
+}
+
 func (b *TestBGS) Run(t *testing.T) {
 	go func() {
 		if err := b.bgs.StartWithListener(b.listener); err != nil {
@@ -543,6 +556,13 @@ func (b *TestBGS) Events(t *testing.T, since int64) *EventStream {
 				es.Lk.Unlock()
 				return nil
 			},
+			RepoIdentity: func(evt *atproto.SyncSubscribeRepos_Identity) error {
+				fmt.Println("received identity event: ", evt.Seq, evt.Did)
+				es.Lk.Lock()
+				es.Events = append(es.Events, &events.XRPCStreamEvent{RepoIdentity: evt})
+				es.Lk.Unlock()
+				return nil
+			},
 		}
 		seqScheduler := sequential.NewScheduler("test", rsc.EventHandler)
 		if err := events.HandleRepoStream(ctx, con, seqScheduler); err != nil {
@@ -44,8 +44,15 @@ func (l LeveledZap) Debug(msg string, keysAndValues ...interface{}) {
 // client needs. CLI tools might want shorter timeouts and fewer retries by
 // default.
 func RobustHTTPClient() *http.Client {
+	return RobustHTTPClientWithTransport(nil)
+}
 
+// Like RobustHTTPClient, but with the given transport (which can be shared by many clients), instead of a new one.
+func RobustHTTPClientWithTransport(transport http.RoundTripper) *http.Client {
 	retryClient := retryablehttp.NewClient()
+	if transport != nil {
+		retryClient.HTTPClient.Transport = transport
+	}
 	retryClient.RetryMax = 3
 	retryClient.RetryWaitMin = 1 * time.Second
 	retryClient.RetryWaitMax = 10 * time.Second
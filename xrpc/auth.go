@@ -0,0 +1,135 @@
+package xrpc
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthManager transparently refreshes a client's session: when a request fails because the access token expired, the session is refreshed (with com.atproto.server.refreshSession) and the request is sent again, once. The zero value is ready to use, and it is safe for concurrent requests; only one of them refreshes the session.
+//
+// Requests with a body which is an io.Reader can only be retried if it is also an io.Seeker.
+type AuthManager struct {
+	// Called with the new session after each refresh, eg to persist it. An error fails the request which triggered the refresh.
+	OnRefresh func(ctx context.Context, auth *AuthInfo) error
+
+	// protects the client's Auth
+	lk sync.Mutex
+}
+
+// The client's current access token, if any.
+func (c *Client) accessJwt() string {
+	if c.AuthManager != nil {
+		c.AuthManager.lk.Lock()
+		defer c.AuthManager.lk.Unlock()
+	}
+	if c.Auth == nil {
+		return ""
+	}
+	return c.Auth.AccessJwt
+}
+
+// Refreshes the client's session, unless another request already did since the expired token was sent.
+func (am *AuthManager) refresh(ctx context.Context, c *Client, expired string) error {
+	am.lk.Lock()
+	defer am.lk.Unlock()
+
+	if c.Auth == nil || c.Auth.RefreshJwt == "" {
+		return errors.New("no refresh token")
+	}
+	if c.Auth.AccessJwt != expired {
+		return nil
+	}
+
+	var out AuthInfo
+	if err := c.do(WithServiceProxy(ctx, ""), "POST", "", "com.atproto.server.refreshSession", "", nil, c.Auth.RefreshJwt, false, &out); err != nil {
+		return err
+	}
+	next := *c.Auth
+	next.AccessJwt = out.AccessJwt
+	next.RefreshJwt = out.RefreshJwt
+	if out.Handle != "" {
+		next.Handle = out.Handle
+	}
+	if out.Did != "" {
+		next.Did = out.Did
+	}
+	if am.OnRefresh != nil {
+		if err := am.OnRefresh(ctx, &next); err != nil {
+			return err
+		}
+	}
+	*c.Auth = next
+	return nil
+}
+
+// Whether a request failed because its access token expired.
+func isExpiredToken(err error) bool {
+	switch StatusCode(err) {
+	case http.StatusUnauthorized:
+		return true
+	case http.StatusBadRequest:
+		return IsErrorName(err, ErrNameExpiredToken)
+	}
+	return false
+}
+
+// Returns a function which rewinds the request body to where it is now, or nil if it can't be rewound.
+func rewinder(r io.Reader) func() error {
+	sk, ok := r.(io.Seeker)
+	if !ok {
+		return nil
+	}
+	offset, err := sk.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil
+	}
+	return func() error {
+		_, err := sk.Seek(offset, io.SeekStart)
+		return err
+	}
+}
+
+// AuthProvider authenticates requests, for auth schemes the client doesn't otherwise support, or to share auth between clients. Authorization returns the Authorization header value for a request to the given method, or an empty string to fall back to the client's other auth: AdminToken (for admin methods), ServiceAuth, or the session in Auth.
+type AuthProvider interface {
+	Authorization(ctx context.Context, method string) (string, error)
+}
+
+// BasicAuth authenticates requests with HTTP basic auth.
+type BasicAuth struct {
+	Username string
+	Password string
+	// If set, only requests to methods for which it returns true are authenticated (like IsAdminMethod)
+	Methods func(method string) bool
+}
+
+func (a *BasicAuth) Authorization(ctx context.Context, method string) (string, error) {
+	if a.Methods != nil && !a.Methods(method) {
+		return "", nil
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(a.Username+":"+a.Password)), nil
+}
+
+// AdminAuth authenticates requests to admin methods (see IsAdminMethod) with the admin password, like Client.AdminToken.
+func AdminAuth(password string) *BasicAuth {
+	return &BasicAuth{Username: "admin", Password: password, Methods: IsAdminMethod}
+}
+
+// IsAdminMethod reports whether a method requires admin auth (HTTP basic auth with the admin password), rather than an account's session.
+func IsAdminMethod(method string) bool {
+	return strings.HasPrefix(method, "com.atproto.admin.") || method == "com.atproto.account.createInviteCode" || method == "com.atproto.server.createInviteCodes"
+}
+
+// Returns the Authorization header value for service auth requests.
+func (a *ServiceAuth) Authorization(ctx context.Context, method string) (string, error) {
+	tok, err := a.token(ctx, method, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return "Bearer " + tok, nil
+}
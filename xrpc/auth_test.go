@@ -0,0 +1,123 @@
+package xrpc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthRefresh(t *testing.T) {
+	assert := assert.New(t)
+
+	var refreshes atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if r.URL.Path == "/xrpc/com.atproto.server.refreshSession" {
+			if auth != "Bearer refresh1" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"ExpiredToken","message":"Token has expired"}`))
+				return
+			}
+			refreshes.Add(1)
+			w.Write([]byte(`{"accessJwt":"access2","refreshJwt":"refresh2","handle":"alice.test","did":"did:plc:alice"}`))
+			return
+		}
+		if auth != "Bearer access2" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"ExpiredToken","message":"Token has expired"}`))
+			return
+		}
+		// echo the body, to check it was sent again
+		body, _ := io.ReadAll(r.Body)
+		json.NewEncoder(w).Encode(map[string]string{"body": string(body)})
+	}))
+	defer srv.Close()
+
+	var persisted *AuthInfo
+	c := &Client{
+		Host: srv.URL,
+		Auth: &AuthInfo{AccessJwt: "access1", RefreshJwt: "refresh1", Handle: "alice.test", Did: "did:plc:alice"},
+		AuthManager: &AuthManager{
+			OnRefresh: func(ctx context.Context, auth *AuthInfo) error {
+				persisted = auth
+				return nil
+			},
+		},
+	}
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var out map[string]string
+			assert.NoError(c.Do(ctx, Procedure, "application/json", "com.example.echo", nil, map[string]string{"text": "hello"}, &out))
+			assert.Equal(`{"text":"hello"}`, out["body"])
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(int64(1), refreshes.Load())
+	assert.Equal("access2", c.Auth.AccessJwt)
+	assert.Equal("refresh2", c.Auth.RefreshJwt)
+	if assert.NotNil(persisted) {
+		assert.Equal("access2", persisted.AccessJwt)
+	}
+
+	// once the refresh token has expired too, the refresh error is returned
+	c.Auth.AccessJwt = "access3"
+	err := c.Do(ctx, Query, "", "com.example.echo", nil, nil, nil)
+	assert.ErrorContains(err, "refreshing expired session")
+	assert.Equal(int64(1), refreshes.Load())
+
+	// without an auth manager, the expired token error is returned
+	c.AuthManager = nil
+	err = c.Do(ctx, Query, "", "com.example.echo", nil, nil, nil)
+	assert.True(isExpiredToken(err))
+}
+
+func TestAuthProvider(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	// admin password for admin methods, and the session for the others
+	c := &Client{
+		Host:         srv.URL,
+		Auth:         &AuthInfo{AccessJwt: "access"},
+		AuthProvider: AdminAuth("hunter2"),
+	}
+	assert.NoError(c.Do(ctx, Query, "", "com.atproto.admin.getAccountInfo", nil, nil, nil))
+	user, pass, ok := (&http.Request{Header: http.Header{"Authorization": {auth}}}).BasicAuth()
+	assert.True(ok)
+	assert.Equal("admin", user)
+	assert.Equal("hunter2", pass)
+
+	assert.NoError(c.Do(ctx, Query, "", "app.bsky.actor.getProfile", nil, nil, nil))
+	assert.Equal("Bearer access", auth)
+
+	// the legacy AdminToken field is equivalent
+	legacy := &Client{Host: srv.URL, AdminToken: &pass}
+	assert.NoError(legacy.Do(ctx, Query, "", "com.atproto.admin.getAccountInfo", nil, nil, nil))
+	expected, _ := AdminAuth("hunter2").Authorization(ctx, "com.atproto.admin.getAccountInfo")
+	assert.Equal(expected, auth)
+
+	c.AuthProvider = &BasicAuth{Username: "user", Password: "pass"}
+	assert.NoError(c.Do(ctx, Query, "", "app.bsky.actor.getProfile", nil, nil, nil))
+	assert.True(strings.HasPrefix(auth, "Basic "))
+}
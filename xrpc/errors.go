@@ -0,0 +1,45 @@
+package xrpc
+
+import (
+	"errors"
+)
+
+// Common error names, as returned in the "error" field of XRPC error responses. Methods may define their own.
+const (
+	ErrNameInvalidRequest    = "InvalidRequest"
+	ErrNameAuthRequired      = "AuthRequired"
+	ErrNameExpiredToken      = "ExpiredToken"
+	ErrNameInvalidToken      = "InvalidToken"
+	ErrNameRateLimitExceeded = "RateLimitExceeded"
+	ErrNameRecordNotFound    = "RecordNotFound"
+	ErrNameRepoNotFound      = "RepoNotFound"
+	ErrNameRepoTakendown     = "RepoTakendown"
+	ErrNameRepoDeactivated   = "RepoDeactivated"
+	ErrNameBlobNotFound      = "BlobNotFound"
+	// Error frames of event streams
+	ErrNameFutureCursor    = "FutureCursor"
+	ErrNameConsumerTooSlow = "ConsumerTooSlow"
+)
+
+// ErrorName returns the error name of an XRPC error response (like "RepoNotFound"), or an empty string if err is not an *Error, or the response had no error name.
+func ErrorName(err error) string {
+	var xe *Error
+	if !errors.As(err, &xe) {
+		return ""
+	}
+	return xe.Name
+}
+
+// IsErrorName reports whether err is an XRPC error response with the given error name.
+func IsErrorName(err error, name string) bool {
+	return name != "" && ErrorName(err) == name
+}
+
+// StatusCode returns the HTTP status of an XRPC error response, or zero if err is not an *Error.
+func StatusCode(err error) int {
+	var xe *Error
+	if !errors.As(err, &xe) {
+		return 0
+	}
+	return xe.StatusCode
+}
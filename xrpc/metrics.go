@@ -0,0 +1,55 @@
+package xrpc
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var clientRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "xrpc_client_requests_total",
+	Help: "Number of outbound XRPC requests, by remote host, method (NSID), and HTTP status code (or 'error' if no response was received)",
+}, []string{"host", "nsid", "status"})
+
+var clientRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "xrpc_client_request_duration_seconds",
+	Help:    "Latency of outbound XRPC requests (until response headers are received), by remote host and method (NSID)",
+	Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+}, []string{"host", "nsid"})
+
+var clientRatelimitRemaining = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "xrpc_client_ratelimit_remaining",
+	Help: "Most recent 'ratelimit-remaining' response header value, by remote host and method (NSID)",
+}, []string{"host", "nsid"})
+
+var clientRetries = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "xrpc_client_retries_total",
+	Help: "Number of retried outbound XRPC requests, by remote host, method (NSID), and reason ('network', 'status', or 'ratelimit')",
+}, []string{"host", "nsid", "reason"})
+
+func observeRetry(host, method, reason string) {
+	if u, err := url.Parse(host); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	clientRetries.WithLabelValues(host, method, reason).Inc()
+}
+
+// Records metrics for a single request. resp is nil if the request failed without a response.
+func observeRequest(req *http.Request, method string, start time.Time, resp *http.Response) {
+	host := req.URL.Host
+	status := "error"
+	if resp != nil {
+		status = strconv.Itoa(resp.StatusCode)
+		if v := resp.Header.Get("ratelimit-remaining"); v != "" {
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				clientRatelimitRemaining.WithLabelValues(host, method).Set(float64(n))
+			}
+		}
+	}
+	clientRequests.WithLabelValues(host, method, status).Inc()
+	clientRequestDuration.WithLabelValues(host, method).Observe(time.Since(start).Seconds())
+}
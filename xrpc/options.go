@@ -0,0 +1,114 @@
+package xrpc
+
+import (
+	"context"
+	"maps"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("xrpc")
+
+// CallOption customizes a single call (or all the calls made with a context); see WithCallOptions.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	headers map[string]string
+	timeout time.Duration
+	attrs   []attribute.KeyValue
+	noRetry bool
+	// nil if not set, to tell it apart from disabling proxying
+	proxy *string
+	// called with the rate limit headers of successful responses, if any; see ObserveRatelimit
+	observeRatelimit func(*RatelimitInfo)
+}
+
+type callOptionsKey struct{}
+
+// WithCallOptions returns a context for calls with the given options, on top of any already set on ctx. Generated API functions pass their context to the client, so this is also how options are given to them:
+//
+//	ctx = xrpc.WithCallOptions(ctx, xrpc.Header("X-Request-Id", id), xrpc.Timeout(5*time.Second))
+//	out, err := bsky.FeedGetTimeline(ctx, client, "", "", 50)
+func WithCallOptions(ctx context.Context, opts ...CallOption) context.Context {
+	o := callOptionsFrom(ctx)
+	o.headers = maps.Clone(o.headers)
+	o.attrs = append([]attribute.KeyValue(nil), o.attrs...)
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return context.WithValue(ctx, callOptionsKey{}, o)
+}
+
+func callOptionsFrom(ctx context.Context) callOptions {
+	o, _ := ctx.Value(callOptionsKey{}).(callOptions)
+	return o
+}
+
+// Header sets a request header, overriding the client's Headers.
+func Header(key, value string) CallOption {
+	return func(o *callOptions) {
+		if o.headers == nil {
+			o.headers = make(map[string]string)
+		}
+		o.headers[key] = value
+	}
+}
+
+// Timeout bounds the duration of a call, including any retries and (for DoStream) reading the response body.
+func Timeout(d time.Duration) CallOption {
+	return func(o *callOptions) {
+		o.timeout = d
+	}
+}
+
+// Attributes adds attributes to the tracing span of a call.
+func Attributes(kv ...attribute.KeyValue) CallOption {
+	return func(o *callOptions) {
+		o.attrs = append(o.attrs, kv...)
+	}
+}
+
+// NoRetry disables retries, whatever the client's RetryPolicy.
+func NoRetry() CallOption {
+	return func(o *callOptions) {
+		o.noRetry = true
+	}
+}
+
+// Proxy sets the atproto-proxy header (see ServiceProxy), overriding the client's Proxy. An empty proxy disables proxying.
+func Proxy(proxy string) CallOption {
+	return func(o *callOptions) {
+		o.proxy = &proxy
+	}
+}
+
+// ObserveRatelimit calls fn with the RateLimit-* headers of successful responses which have them, so that callers can pace their requests; those of failed requests are in the Ratelimit of the returned *Error. It replaces any function set before, like by Paginate.
+func ObserveRatelimit(fn func(*RatelimitInfo)) CallOption {
+	return func(o *callOptions) {
+		o.observeRatelimit = fn
+	}
+}
+
+// Starts a call: applies the timeout, if any, and starts its tracing span. The returned function ends both, with the result of the call.
+func (c *Client) startCall(ctx context.Context, method string) (context.Context, func(error)) {
+	opts := callOptionsFrom(ctx)
+	cancel := func() {}
+	if opts.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+	}
+	ctx, span := tracer.Start(ctx, method, trace.WithSpanKind(trace.SpanKindClient))
+	span.SetAttributes(attribute.String("nsid", method), attribute.String("host", c.Host))
+	span.SetAttributes(opts.attrs...)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+		cancel()
+	}
+}
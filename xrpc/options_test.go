@@ -0,0 +1,59 @@
+package xrpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestCallOptions(t *testing.T) {
+	assert := assert.New(t)
+
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	var headers http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = r.Header
+		if r.URL.Path == "/xrpc/com.example.slow" {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c := &Client{Host: srv.URL, Headers: map[string]string{"X-Client": "a", "X-Both": "client"}}
+	ctx := WithCallOptions(context.Background(), Header("X-Both", "call"), Attributes(attribute.String("purpose", "test")))
+	// options accumulate
+	ctx = WithCallOptions(ctx, Header("X-Call", "b"), Proxy("did:web:example.com#svc"))
+
+	assert.NoError(c.Do(ctx, Query, "", "com.example.fast", nil, nil, nil))
+	assert.Equal("a", headers.Get("X-Client"))
+	assert.Equal("call", headers.Get("X-Both"))
+	assert.Equal("b", headers.Get("X-Call"))
+	assert.Equal("did:web:example.com#svc", headers.Get(ProxyHeader))
+
+	start := time.Now()
+	err := c.Do(WithCallOptions(ctx, Timeout(50*time.Millisecond)), Query, "", "com.example.slow", nil, nil, nil)
+	assert.ErrorIs(err, context.DeadlineExceeded)
+	assert.Less(time.Since(start), 5*time.Second)
+
+	spans := rec.Ended()
+	if assert.Len(spans, 2) {
+		assert.Equal("com.example.fast", spans[0].Name())
+		assert.Contains(spans[0].Attributes(), attribute.String("purpose", "test"))
+		assert.Contains(spans[0].Attributes(), attribute.String("nsid", "com.example.fast"))
+		assert.Equal("com.example.slow", spans[1].Name())
+		assert.NotEmpty(spans[1].Events()) // the recorded error
+	}
+}
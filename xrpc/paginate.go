@@ -0,0 +1,62 @@
+package xrpc
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Paginate returns an iterator (with the signature of an iter.Seq2) over the items of a cursor-paginated query. It calls fetch with the cursor of the previous page (empty for the first), and yields its items, until a page has no cursor (or the same one again), or an error, which is yielded last.
+//
+// Pages are paced according to the rate limit headers of the responses: once no requests remain, the next page waits for the limit to reset. If the client has no RetryPolicy (which would retry it already), a rate limited page is also retried after the reset. Either wait is bounded by the MaxRateLimitWait of the client's policy, or of DefaultRetryPolicy.
+func Paginate[T any](ctx context.Context, c *Client, fetch func(ctx context.Context, cursor string) (items []T, next string, err error)) func(yield func(T, error) bool) {
+	return func(yield func(T, error) bool) {
+		policy := c.Retry
+		if policy == nil {
+			policy = DefaultRetryPolicy()
+		}
+		var ratelimit *RatelimitInfo
+		ctx := WithCallOptions(ctx, ObserveRatelimit(func(rl *RatelimitInfo) { ratelimit = rl }))
+
+		var zero T
+		cursor := ""
+		retries := 0
+		for {
+			if ratelimit != nil && ratelimit.Remaining == 0 {
+				if err := sleepCtx(ctx, min(time.Until(ratelimit.Reset), policy.MaxRateLimitWait)); err != nil {
+					yield(zero, err)
+					return
+				}
+			}
+			ratelimit = nil
+
+			items, next, err := fetch(ctx, cursor)
+			if err != nil {
+				var xe *Error
+				if c.Retry == nil && errors.As(err, &xe) && xe.IsThrottled() {
+					if wait, _, ok := policy.delay(ctx, Query, err, retries, time.Now()); ok {
+						retries++
+						if err := sleepCtx(ctx, wait); err != nil {
+							yield(zero, err)
+							return
+						}
+						continue
+					}
+				}
+				yield(zero, err)
+				return
+			}
+			retries = 0
+
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+			if next == "" || next == cursor {
+				return
+			}
+			cursor = next
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package xrpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaginate(t *testing.T) {
+	assert := assert.New(t)
+
+	pages := map[string]struct {
+		Items  []int  `json:"items"`
+		Cursor string `json:"cursor,omitempty"`
+	}{
+		"":  {Items: []int{1, 2}, Cursor: "a"},
+		"a": {Items: []int{3}, Cursor: "b"},
+		"b": {Items: []int{4, 5}},
+	}
+	throttled := false
+	var requests []time.Time
+	var reset time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, time.Now())
+		cursor := r.URL.Query().Get("cursor")
+		if cursor == "b" && !throttled {
+			throttled = true
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":"RateLimitExceeded"}`))
+			return
+		}
+		if cursor == "a" {
+			// no requests left until a second from now
+			w.Header().Set("RateLimit-Limit", "10")
+			w.Header().Set("RateLimit-Remaining", "0")
+			reset = time.Unix(time.Now().Add(time.Second).Unix(), 0)
+			w.Header().Set("RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		}
+		json.NewEncoder(w).Encode(pages[cursor])
+	}))
+	defer srv.Close()
+
+	c := &Client{Host: srv.URL, Client: http.DefaultClient}
+	type page struct {
+		Items  []int  `json:"items"`
+		Cursor string `json:"cursor"`
+	}
+	fetch := func(ctx context.Context, cursor string) ([]int, string, error) {
+		var out page
+		if err := c.Do(ctx, Query, "", "com.example.list", map[string]any{"cursor": cursor}, nil, &out); err != nil {
+			return nil, "", err
+		}
+		return out.Items, out.Cursor, nil
+	}
+
+	var got []int
+	Paginate(context.Background(), c, fetch)(func(n int, err error) bool {
+		assert.NoError(err)
+		got = append(got, n)
+		return true
+	})
+	assert.Equal([]int{1, 2, 3, 4, 5}, got)
+	// the throttled page was retried
+	assert.Len(requests, 4)
+	// and the page after the rate limit ran out waited for the reset
+	assert.False(requests[2].Before(reset))
+
+	// stopping early doesn't fetch more pages
+	requests = nil
+	Paginate(context.Background(), c, fetch)(func(n int, err error) bool {
+		return false
+	})
+	assert.Len(requests, 1)
+
+	// errors end the iteration
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var errs []error
+	Paginate(ctx, c, fetch)(func(n int, err error) bool {
+		errs = append(errs, err)
+		return true
+	})
+	assert.Len(errs, 1)
+	assert.ErrorIs(errs[0], context.Canceled)
+}
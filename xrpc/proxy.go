@@ -0,0 +1,50 @@
+package xrpc
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/bluesky-social/indigo/atproto/syntax"
+)
+
+// Service IDs (the fragment of a service entry in a DID document) of common services which requests are proxied to.
+const (
+	ServiceIDBskyAppView = "bsky_appview"
+	ServiceIDLabeler     = "atproto_labeler"
+	ServiceIDBskyChat    = "bsky_chat"
+)
+
+// Header which asks a PDS to proxy a request to another service, identified by DID and service ID.
+const ProxyHeader = "atproto-proxy"
+
+// ServiceProxy returns an atproto-proxy header value for the service with the given ID in the DID document of did, like "did:web:api.bsky.app#bsky_appview".
+func ServiceProxy(did syntax.DID, serviceID string) string {
+	return did.String() + "#" + serviceID
+}
+
+// ParseServiceProxy splits an atproto-proxy header value into the service DID and service ID.
+func ParseServiceProxy(proxy string) (syntax.DID, string, error) {
+	d, id, ok := strings.Cut(proxy, "#")
+	if !ok || id == "" {
+		return "", "", fmt.Errorf("service proxy must be a DID and a service ID, separated by '#': %q", proxy)
+	}
+	did, err := syntax.ParseDID(d)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid service proxy DID: %w", err)
+	}
+	return did, id, nil
+}
+
+// WithServiceProxy returns a context for requests which are proxied (by the PDS) to the given service, instead of the client's Proxy, if any. An empty proxy disables proxying. It is short for WithCallOptions(ctx, Proxy(proxy)).
+func WithServiceProxy(ctx context.Context, proxy string) context.Context {
+	return WithCallOptions(ctx, Proxy(proxy))
+}
+
+// The atproto-proxy header for a request, if any.
+func (c *Client) serviceProxy(ctx context.Context) string {
+	if proxy := callOptionsFrom(ctx).proxy; proxy != nil {
+		return *proxy
+	}
+	return c.Proxy
+}
@@ -0,0 +1,170 @@
+package xrpc
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how a Client retries failed requests. Queries are retried after network errors and server errors (status 500, 502, 503, or 504); procedures, which might not be safe to repeat, only when rate limited (status 429) or when the server is unavailable (status 503), unless RetryProcedures is set. A rate limited request is retried once the limit resets, according to the RateLimit-Reset or Retry-After response headers.
+//
+// Requests with a body which is an io.Reader can only be retried if it is also an io.Seeker.
+type RetryPolicy struct {
+	// Retries after the first attempt
+	MaxRetries int
+	// Delay before the first retry, doubled (with jitter) for each subsequent retry
+	InitialBackoff time.Duration
+	// Upper bound on the delay between retries
+	MaxBackoff time.Duration
+	// The longest a rate limited request waits for the limit to reset; if it resets later, the error is returned instead
+	MaxRateLimitWait time.Duration
+	// Whether procedures are also retried after network and server errors
+	RetryProcedures bool
+}
+
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxRetries:       3,
+		InitialBackoff:   500 * time.Millisecond,
+		MaxBackoff:       10 * time.Second,
+		MaxRateLimitWait: time.Minute,
+	}
+}
+
+// WithoutRetry returns a context for requests which are not retried, whatever the client's RetryPolicy. It is short for WithCallOptions(ctx, NoRetry()).
+func WithoutRetry(ctx context.Context) context.Context {
+	return WithCallOptions(ctx, NoRetry())
+}
+
+// How long to wait before retrying a request which failed with err, after the given number of retries, and why; false if it should not be retried.
+func (p *RetryPolicy) delay(ctx context.Context, kind XRPCRequestType, err error, retries int, now time.Time) (time.Duration, string, bool) {
+	if p == nil || retries >= p.MaxRetries || ctx.Err() != nil || callOptionsFrom(ctx).noRetry {
+		return 0, "", false
+	}
+
+	var xe *Error
+	if !errors.As(err, &xe) {
+		var ue *url.Error
+		if errors.As(err, &ue) && (kind == Query || p.RetryProcedures) {
+			return p.backoff(retries), "network", true
+		}
+		return 0, "", false
+	}
+
+	switch xe.StatusCode {
+	case http.StatusTooManyRequests:
+		var reset time.Time
+		if xe.Ratelimit != nil && xe.Ratelimit.Remaining == 0 {
+			reset = xe.Ratelimit.Reset
+		}
+		if !xe.RetryAfter.IsZero() {
+			reset = xe.RetryAfter
+		}
+		if reset.IsZero() {
+			return p.backoff(retries), "ratelimit", true
+		}
+		wait := reset.Sub(now)
+		if wait > p.MaxRateLimitWait {
+			return 0, "", false
+		}
+		return max(wait, 0), "ratelimit", true
+	case http.StatusServiceUnavailable:
+		if !xe.RetryAfter.IsZero() {
+			wait := xe.RetryAfter.Sub(now)
+			if wait > p.MaxRateLimitWait {
+				return 0, "", false
+			}
+			return max(wait, 0), "status", true
+		}
+		return p.backoff(retries), "status", true
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout:
+		if kind == Query || p.RetryProcedures {
+			return p.backoff(retries), "status", true
+		}
+	}
+	return 0, "", false
+}
+
+// Exponential backoff with "equal jitter": a random delay between half and all of the exponential delay.
+func (p *RetryPolicy) backoff(retries int) time.Duration {
+	d := p.InitialBackoff
+	for i := 0; i < retries && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 {
+		d = min(d, p.MaxBackoff)
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// Parses a Retry-After header, either a number of seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Time {
+	if v == "" {
+		return time.Time{}
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return now.Add(time.Duration(secs) * time.Second)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t
+	}
+	return time.Time{}
+}
+
+// HostLimiter bounds the number of concurrent requests to each host. It can be shared by many clients.
+type HostLimiter struct {
+	perHost int
+
+	lk    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+// NewHostLimiter returns a limiter which allows up to perHost concurrent requests to each host.
+func NewHostLimiter(perHost int) *HostLimiter {
+	return &HostLimiter{
+		perHost: max(perHost, 1),
+		hosts:   make(map[string]chan struct{}),
+	}
+}
+
+// Waits for a request slot for the host, and returns a function to release it.
+func (l *HostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	l.lk.Lock()
+	sem, ok := l.hosts[host]
+	if !ok {
+		sem = make(chan struct{}, l.perHost)
+		l.hosts[host] = sem
+	}
+	l.lk.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Waits for the given duration, or until the context is cancelled.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,87 @@
+package xrpc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var calls atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		switch {
+		case n == 1:
+			w.WriteHeader(http.StatusBadGateway)
+		case n == 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`{"ok":true}`))
+		}
+	}))
+	defer srv.Close()
+
+	policy := &RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, MaxRateLimitWait: time.Second}
+	c := &Client{Host: srv.URL, Retry: policy, HostLimiter: NewHostLimiter(2)}
+
+	var out map[string]bool
+	assert.NoError(c.Do(ctx, Query, "", "com.example.test", nil, nil, &out))
+	assert.True(out["ok"])
+	assert.Equal(int64(3), calls.Load())
+
+	// procedures are not retried after a server error
+	calls.Store(0)
+	err := c.Do(ctx, Procedure, "application/json", "com.example.test", nil, map[string]string{}, &out)
+	var xe *Error
+	assert.True(errors.As(err, &xe), "%v", err)
+	assert.Equal(http.StatusBadGateway, xe.StatusCode)
+	assert.Equal(int64(1), calls.Load())
+
+	// nor when opted out
+	calls.Store(0)
+	assert.Error(c.Do(WithoutRetry(ctx), Query, "", "com.example.test", nil, nil, &out))
+	assert.Equal(int64(1), calls.Load())
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+	now := time.Now()
+	p := DefaultRetryPolicy()
+
+	// rate limits are waited out, unless they reset too far in the future
+	limited := &Error{StatusCode: 429, Ratelimit: &RatelimitInfo{Remaining: 0, Reset: now.Add(30 * time.Second)}}
+	wait, reason, ok := p.delay(ctx, Procedure, limited, 0, now)
+	assert.True(ok)
+	assert.Equal("ratelimit", reason)
+	assert.Equal(30*time.Second, wait)
+
+	limited.Ratelimit.Reset = now.Add(time.Hour)
+	_, _, ok = p.delay(ctx, Query, limited, 0, now)
+	assert.False(ok)
+
+	// client errors and exhausted retries are not retried
+	_, _, ok = p.delay(ctx, Query, &Error{StatusCode: 400}, 0, now)
+	assert.False(ok)
+	_, _, ok = p.delay(ctx, Query, &Error{StatusCode: 502}, p.MaxRetries, now)
+	assert.False(ok)
+
+	for i := 0; i < 10; i++ {
+		d := p.backoff(i)
+		assert.LessOrEqual(d, p.MaxBackoff)
+		assert.GreaterOrEqual(d, min(p.InitialBackoff<<i, p.MaxBackoff)/2)
+	}
+
+	assert.Equal(now.Add(5*time.Second), parseRetryAfter("5", now))
+	assert.True(parseRetryAfter("soon", now).IsZero())
+}
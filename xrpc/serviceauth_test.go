@@ -0,0 +1,124 @@
+package xrpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bluesky-social/indigo/atproto/crypto"
+	"github.com/bluesky-social/indigo/atproto/syntax"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServiceAuthToken(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, gen := range []func() (crypto.PrivateKey, error){
+		func() (crypto.PrivateKey, error) { return crypto.GeneratePrivateKeyK256() },
+		func() (crypto.PrivateKey, error) { return crypto.GeneratePrivateKeyP256() },
+	} {
+		key, err := gen()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sa := &ServiceAuth{
+			Issuer:   syntax.DID("did:plc:alice"),
+			Key:      key,
+			Audience: ServiceProxy(syntax.DID("did:web:api.bsky.app"), ServiceIDBskyAppView),
+		}
+		now := time.Unix(1700000000, 0)
+		tok, err := sa.Token("app.bsky.feed.getTimeline", now)
+		assert.NoError(err)
+
+		parts := strings.Split(tok, ".")
+		assert.Len(parts, 3)
+		claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+		assert.NoError(err)
+		var claims serviceAuthClaims
+		assert.NoError(json.Unmarshal(claimsJSON, &claims))
+		assert.Equal("did:plc:alice", claims.Iss)
+		assert.Equal("did:web:api.bsky.app#bsky_appview", claims.Aud)
+		assert.Equal("app.bsky.feed.getTimeline", claims.Lxm)
+		assert.Equal(now.Unix(), claims.Iat)
+		assert.Equal(now.Add(DefaultServiceAuthLifetime).Unix(), claims.Exp)
+		assert.NotEmpty(claims.Jti)
+
+		pub, err := key.PublicKey()
+		assert.NoError(err)
+		sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+		assert.NoError(err)
+		assert.NoError(pub.HashAndVerify([]byte(parts[0]+"."+parts[1]), sig))
+	}
+}
+
+func TestServiceAuthSigner(t *testing.T) {
+	assert := assert.New(t)
+
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := crypto.NewStdSigner(sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sa := &ServiceAuth{
+		Issuer:   syntax.DID("did:plc:alice"),
+		Signer:   signer,
+		Audience: "did:web:api.bsky.app",
+	}
+	authz, err := sa.Authorization(context.Background(), "app.bsky.feed.getTimeline")
+	assert.NoError(err)
+	parts := strings.Split(strings.TrimPrefix(authz, "Bearer "), ".")
+	assert.Len(parts, 3)
+
+	pub, err := signer.PublicKey()
+	assert.NoError(err)
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	assert.NoError(err)
+	assert.NoError(pub.HashAndVerify([]byte(parts[0]+"."+parts[1]), sig))
+}
+
+func TestServiceProxy(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var proxy, auth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxy = r.Header.Get(ProxyHeader)
+		auth = r.Header.Get("Authorization")
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c := &Client{
+		Host:  srv.URL,
+		Auth:  &AuthInfo{AccessJwt: "access"},
+		Proxy: ServiceProxy(syntax.DID("did:web:api.bsky.app"), ServiceIDBskyAppView),
+	}
+	assert.NoError(c.Do(ctx, Query, "", "app.bsky.feed.getTimeline", nil, nil, nil))
+	assert.Equal("did:web:api.bsky.app#bsky_appview", proxy)
+	assert.Equal("Bearer access", auth)
+
+	assert.NoError(c.Do(WithServiceProxy(ctx, "did:plc:labeler#atproto_labeler"), Query, "", "com.atproto.label.queryLabels", nil, nil, nil))
+	assert.Equal("did:plc:labeler#atproto_labeler", proxy)
+
+	assert.NoError(c.Do(WithServiceProxy(ctx, ""), Query, "", "com.atproto.repo.describeRepo", nil, nil, nil))
+	assert.Equal("", proxy)
+
+	did, id, err := ParseServiceProxy(c.Proxy)
+	assert.NoError(err)
+	assert.Equal(syntax.DID("did:web:api.bsky.app"), did)
+	assert.Equal(ServiceIDBskyAppView, id)
+	_, _, err = ParseServiceProxy("did:web:api.bsky.app")
+	assert.Error(err)
+}
@@ -0,0 +1,139 @@
+package xrpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/bluesky-social/indigo/lex/util"
+	"github.com/gorilla/websocket"
+)
+
+// StreamHandler is called by Subscribe with the message type (like "#commit") and CBOR body of each message frame of an event stream.
+type StreamHandler func(msgType string, body io.Reader) error
+
+// How often Subscribe pings the server, and how long it waits for any frame (or pong) before giving up on the connection.
+const (
+	streamPingInterval = 30 * time.Second
+	streamReadTimeout  = time.Minute
+)
+
+// Subscribe connects to the event stream of a subscription method over WebSocket (the client's host, with its scheme changed to ws or wss), with the same headers and auth as other requests, and calls handler for each message frame, until the context is done, the server closes the stream, or handler returns an error. Message types are relative to the method: "com.atproto.sync.subscribeRepos#commit" is passed as "#commit". An error frame is returned as an *Error with its name and message; frames with unknown operations are skipped.
+func (c *Client) Subscribe(ctx context.Context, method string, params map[string]any, handler StreamHandler) error {
+	u, err := url.Parse(c.Host + "/xrpc/" + method)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "https":
+		u.Scheme = "wss"
+	case "http":
+		u.Scheme = "ws"
+	}
+	if len(params) > 0 {
+		u.RawQuery = makeParams(params)
+	}
+
+	header := http.Header{}
+	if err := c.setHeaders(ctx, header, method, c.accessJwt()); err != nil {
+		return err
+	}
+
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: defaultTimeout,
+	}
+	if t, ok := c.Transport.(*http.Transport); ok && t.TLSClientConfig != nil {
+		dialer.TLSClientConfig = t.TLSClientConfig
+	}
+	con, resp, err := dialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		if resp != nil && resp.StatusCode != http.StatusSwitchingProtocols {
+			return errorFromStreamResponse(resp)
+		}
+		return fmt.Errorf("dialing event stream: %w", err)
+	}
+	defer con.Close()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		t := time.NewTicker(streamPingInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				_ = con.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second))
+			case <-ctx.Done():
+				// unblocks the read below
+				con.Close()
+				return
+			}
+		}
+	}()
+	con.SetPongHandler(func(string) error {
+		return con.SetReadDeadline(time.Now().Add(streamReadTimeout))
+	})
+
+	for {
+		if err := con.SetReadDeadline(time.Now().Add(streamReadTimeout)); err != nil {
+			return err
+		}
+		mt, r, err := con.NextReader()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			return fmt.Errorf("reading event stream: %w", err)
+		}
+		if mt != websocket.BinaryMessage {
+			return fmt.Errorf("expected binary message from event stream, got type %d", mt)
+		}
+
+		var hdr util.StreamFrameHeader
+		if err := hdr.UnmarshalCBOR(r); err != nil {
+			return fmt.Errorf("reading frame header: %w", err)
+		}
+		switch hdr.Op {
+		case util.StreamOpMessage:
+			if err := handler(strings.TrimPrefix(hdr.MsgType, method), r); err != nil {
+				return err
+			}
+		case util.StreamOpError:
+			var ef util.StreamErrorFrame
+			if err := ef.UnmarshalCBOR(r); err != nil {
+				return fmt.Errorf("reading error frame: %w", err)
+			}
+			return &Error{
+				Name:    ef.Error,
+				Message: ef.Message,
+				Wrapped: &XRPCError{ErrStr: ef.Error, Message: ef.Message},
+			}
+		}
+	}
+}
+
+// Builds an *Error from a failed WebSocket handshake, whose body (if any) has been read into memory by the dialer.
+func errorFromStreamResponse(resp *http.Response) error {
+	if resp.Body == nil {
+		return errorFromHTTPResponse(resp, nil)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errorFromHTTPResponse(resp, err)
+	}
+	var xe XRPCError
+	if err := json.Unmarshal(b, &xe); err != nil {
+		return errorFromHTTPResponse(resp, fmt.Errorf("failed to decode xrpc error message: %w", err))
+	}
+	return errorFromHTTPResponse(resp, &xe)
+}
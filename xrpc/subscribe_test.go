@@ -0,0 +1,75 @@
+package xrpc
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bluesky-social/indigo/lex/util"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribe(t *testing.T) {
+	assert := assert.New(t)
+
+	frame := func(hdr util.StreamFrameHeader, body interface{ MarshalCBOR(io.Writer) error }) []byte {
+		buf := new(bytes.Buffer)
+		assert.NoError(hdr.MarshalCBOR(buf))
+		assert.NoError(body.MarshalCBOR(buf))
+		return buf.Bytes()
+	}
+
+	var upgrader websocket.Upgrader
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/xrpc/com.example.subscribe", r.URL.Path)
+		if r.URL.Query().Get("cursor") == "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"InvalidRequest","message":"no cursor"}`))
+			return
+		}
+		assert.Equal("Bearer token", r.Header.Get("Authorization"))
+		con, err := upgrader.Upgrade(w, r, nil)
+		if !assert.NoError(err) {
+			return
+		}
+		defer con.Close()
+		frames := [][]byte{
+			frame(util.StreamFrameHeader{Op: util.StreamOpMessage, MsgType: "#first"}, &util.CborChecker{Type: "one"}),
+			// relative and absolute message types are the same
+			frame(util.StreamFrameHeader{Op: util.StreamOpMessage, MsgType: "com.example.subscribe#second"}, &util.CborChecker{Type: "two"}),
+			// skipped
+			frame(util.StreamFrameHeader{Op: 2}, &util.CborChecker{}),
+			frame(util.StreamFrameHeader{Op: util.StreamOpError}, &util.StreamErrorFrame{Error: ErrNameFutureCursor, Message: "cursor in the future"}),
+		}
+		for _, f := range frames {
+			assert.NoError(con.WriteMessage(websocket.BinaryMessage, f))
+		}
+	}))
+	defer srv.Close()
+
+	c := &Client{Host: srv.URL, Auth: &AuthInfo{AccessJwt: "token"}}
+
+	var got []string
+	err := c.Subscribe(context.Background(), "com.example.subscribe", map[string]any{"cursor": 1}, func(msgType string, r io.Reader) error {
+		var evt util.CborChecker
+		if err := evt.UnmarshalCBOR(r); err != nil {
+			return err
+		}
+		got = append(got, msgType+" "+evt.Type)
+		return nil
+	})
+	assert.Equal([]string{"#first one", "#second two"}, got)
+	assert.True(IsErrorName(err, ErrNameFutureCursor))
+	assert.Equal(0, StatusCode(err))
+	assert.EqualError(err, "XRPC STREAM ERROR: FutureCursor: cursor in the future")
+
+	// errors in the handshake are like those of other requests
+	err = c.Subscribe(context.Background(), "com.example.subscribe", nil, func(string, io.Reader) error { return nil })
+	assert.Equal(http.StatusBadRequest, StatusCode(err))
+	assert.True(IsErrorName(err, ErrNameInvalidRequest))
+}
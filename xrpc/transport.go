@@ -0,0 +1,108 @@
+package xrpc
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// TransportConfig configures the HTTP transport (connection pooling, dialing, TLS, and HTTP/2) of clients. A transport is meant to be shared by many clients, so connections are reused across them.
+type TransportConfig struct {
+	// Idle (keep-alive) connections kept across all hosts; zero means no limit
+	MaxIdleConns int
+	// Idle (keep-alive) connections kept for each host
+	MaxIdleConnsPerHost int
+	// Connections (idle, active, or being dialed) to each host; zero means no limit
+	MaxConnsPerHost int
+	// How long idle connections are kept
+	IdleConnTimeout time.Duration
+	// Timeout for establishing TCP connections
+	DialTimeout time.Duration
+	// Interval of TCP keep-alive probes
+	KeepAlive time.Duration
+	// Timeout for TLS handshakes
+	TLSHandshakeTimeout time.Duration
+	// Timeout for receiving response headers, once the request is sent; zero means no timeout
+	ResponseHeaderTimeout time.Duration
+	// TLS configuration; if nil, the default configuration is used
+	TLSConfig *tls.Config
+	// Whether to use only HTTP/1.1, even with servers which support HTTP/2
+	DisableHTTP2 bool
+	// Whether to send requests to http:// URLs over HTTP/2 without TLS ("prior knowledge", or h2c), for servers (like internal services behind a load balancer) known to support it
+	HTTP2PriorKnowledge bool
+}
+
+func DefaultTransportConfig() TransportConfig {
+	return TransportConfig{
+		MaxIdleConns:        1000,
+		MaxIdleConnsPerHost: 100,
+		IdleConnTimeout:     90 * time.Second,
+		DialTimeout:         30 * time.Second,
+		KeepAlive:           30 * time.Second,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+}
+
+// NewTransport returns a transport with the given configuration, to be shared by clients (see Client.Transport, or http.Client.Transport).
+func NewTransport(cfg TransportConfig) http.RoundTripper {
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		ExpectContinueTimeout: time.Second,
+		TLSClientConfig:       cfg.TLSConfig,
+		// a custom dialer or TLS config otherwise disables HTTP/2
+		ForceAttemptHTTP2: !cfg.DisableHTTP2,
+	}
+	if cfg.DisableHTTP2 {
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	if !cfg.HTTP2PriorKnowledge {
+		return t
+	}
+	return &h2cTransport{
+		https: t,
+		h2c: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, addr)
+			},
+		},
+	}
+}
+
+// Sends requests to http:// URLs over HTTP/2 without TLS, and the others with the regular transport.
+type h2cTransport struct {
+	https *http.Transport
+	h2c   *http2.Transport
+}
+
+func (t *h2cTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "http" {
+		return t.h2c.RoundTrip(req)
+	}
+	return t.https.RoundTrip(req)
+}
+
+var sharedTransport = sync.OnceValue(func() http.RoundTripper {
+	return NewTransport(DefaultTransportConfig())
+})
+
+// SharedTransport returns the process-wide transport (with DefaultTransportConfig) used by clients without their own Client or Transport.
+func SharedTransport() http.RoundTripper {
+	return sharedTransport()
+}
@@ -0,0 +1,58 @@
+package xrpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+type countingTransport struct {
+	base  http.RoundTripper
+	count atomic.Int64
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.count.Add(1)
+	return t.base.RoundTrip(req)
+}
+
+func TestTransport(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	var proto atomic.Value
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proto.Store(r.Proto)
+		w.Write([]byte(`{}`))
+	})
+	srv := httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+	defer srv.Close()
+
+	assert.Same(SharedTransport(), SharedTransport())
+
+	// clients share their transport, whichever default HTTP client they use
+	tr := &countingTransport{base: NewTransport(DefaultTransportConfig())}
+	for _, c := range []*Client{
+		{Host: srv.URL, Transport: tr},
+		{Host: srv.URL, Transport: tr, Retry: DefaultRetryPolicy()},
+	} {
+		assert.NoError(c.Do(ctx, Query, "", "com.example.test", nil, nil, nil))
+		body, err := c.DoStream(ctx, Query, "", "com.example.test", nil, nil)
+		assert.NoError(err)
+		assert.NoError(body.Close())
+	}
+	assert.Equal(int64(4), tr.count.Load())
+	assert.Equal("HTTP/1.1", proto.Load())
+
+	cfg := DefaultTransportConfig()
+	cfg.HTTP2PriorKnowledge = true
+	c := &Client{Host: srv.URL, Transport: NewTransport(cfg)}
+	assert.NoError(c.Do(ctx, Query, "", "com.example.test", nil, nil, nil))
+	assert.Equal("HTTP/2.0", proto.Load())
+}
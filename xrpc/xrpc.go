@@ -3,7 +3,6 @@ package xrpc
 import (
 	"bytes"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,6 +10,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/bluesky-social/indigo/util"
@@ -18,22 +18,52 @@ import (
 )
 
 type Client struct {
-	// Client is an HTTP client to use. If not set, defaults to http.RobustHTTPClient().
+	// Client is an HTTP client to use. If not set, defaults to a client like util.RobustHTTPClient(), with Transport.
 	Client     *http.Client
 	Auth       *AuthInfo
 	AdminToken *string
 	Host       string
 	UserAgent  *string
 	Headers    map[string]string
+	// If set, the session in Auth is refreshed when the access token expires
+	AuthManager *AuthManager
+	// If set, failed requests are retried (see WithoutRetry to opt out for a request), and the default HTTP client does not retry on its own
+	Retry *RetryPolicy
+	// If set, bounds the number of concurrent requests to each host
+	HostLimiter *HostLimiter
+	// If set, the atproto-proxy header (see ServiceProxy), with which the PDS proxies requests to another service. WithServiceProxy overrides it for a request.
+	Proxy string
+	// If set, requests are authenticated with service auth tokens minted for each request, instead of the session in Auth
+	ServiceAuth *ServiceAuth
+	// If set, authenticates requests, before (or instead of) the client's other auth; see BasicAuth and AdminAuth
+	AuthProvider AuthProvider
+	// The transport of the default HTTP clients, when Client is not set; SharedTransport() if nil. See NewTransport.
+	Transport http.RoundTripper
 }
 
-func (c *Client) getClient() *http.Client {
-	if c.Client == nil {
-		return util.RobustHTTPClient()
+func (c *Client) getClient(stream bool) *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	transport := c.Transport
+	if transport == nil {
+		transport = SharedTransport()
+	}
+	switch {
+	case stream:
+		// no overall timeout, which would include reading the response body, and no retries by the robust client, which buffers request bodies in memory to send them again
+		return &http.Client{Transport: transport}
+	case c.Retry != nil:
+		// retries are done by Do, so they're not compounded by the robust client's own
+		return &http.Client{Transport: transport, Timeout: defaultTimeout}
+	default:
+		return util.RobustHTTPClientWithTransport(transport)
 	}
-	return c.Client
 }
 
+// Timeout of the default HTTP clients, except for streamed requests.
+const defaultTimeout = 30 * time.Second
+
 type XRPCRequestType int
 
 type AuthInfo struct {
@@ -52,10 +82,18 @@ func (xe *XRPCError) Error() string {
 	return fmt.Sprintf("%s: %s", xe.ErrStr, xe.Message)
 }
 
+// Error is returned by Do for responses with a status other than 200, and by Subscribe for error frames. Its Wrapped error is an *XRPCError if the response body had the standard error fields.
 type Error struct {
+	// The HTTP status of the response; zero for error frames of event streams
 	StatusCode int
-	Wrapped    error
-	Ratelimit  *RatelimitInfo
+	// The error name ("error" field) of the response body, like "RecordNotFound" or "ExpiredToken"; empty if the body had none
+	Name string
+	// The "message" field of the response body, if any
+	Message   string
+	Wrapped   error
+	Ratelimit *RatelimitInfo
+	// From the Retry-After response header, if any
+	RetryAfter time.Time
 }
 
 func (e *Error) Error() string {
@@ -64,6 +102,9 @@ func (e *Error) Error() string {
 	if e.Wrapped == nil {
 		return fmt.Sprintf("XRPC ERROR %d", e.StatusCode)
 	}
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("XRPC STREAM ERROR: %s", e.Wrapped)
+	}
 	if e.StatusCode == http.StatusTooManyRequests && e.Ratelimit != nil {
 		return fmt.Sprintf("XRPC ERROR %d: %s (throttled until %s)", e.StatusCode, e.Wrapped, e.Ratelimit.Reset.Local())
 	}
@@ -85,24 +126,36 @@ func errorFromHTTPResponse(resp *http.Response, err error) error {
 	r := &Error{
 		StatusCode: resp.StatusCode,
 		Wrapped:    err,
+		RetryAfter: parseRetryAfter(resp.Header.Get("retry-after"), time.Now()),
 	}
-	if resp.Header.Get("ratelimit-limit") != "" {
-		r.Ratelimit = &RatelimitInfo{
-			Policy: resp.Header.Get("ratelimit-policy"),
-		}
-		if n, err := strconv.ParseInt(resp.Header.Get("ratelimit-reset"), 10, 64); err == nil {
-			r.Ratelimit.Reset = time.Unix(n, 0)
-		}
-		if n, err := strconv.ParseInt(resp.Header.Get("ratelimit-limit"), 10, 64); err == nil {
-			r.Ratelimit.Limit = int(n)
-		}
-		if n, err := strconv.ParseInt(resp.Header.Get("ratelimit-remaining"), 10, 64); err == nil {
-			r.Ratelimit.Remaining = int(n)
-		}
+	if xe, ok := err.(*XRPCError); ok {
+		r.Name = xe.ErrStr
+		r.Message = xe.Message
 	}
+	r.Ratelimit = parseRatelimit(resp.Header)
 	return r
 }
 
+// Parses the RateLimit-* headers of a response; nil if it has none.
+func parseRatelimit(h http.Header) *RatelimitInfo {
+	if h.Get("ratelimit-limit") == "" {
+		return nil
+	}
+	rl := &RatelimitInfo{
+		Policy: h.Get("ratelimit-policy"),
+	}
+	if n, err := strconv.ParseInt(h.Get("ratelimit-reset"), 10, 64); err == nil {
+		rl.Reset = time.Unix(n, 0)
+	}
+	if n, err := strconv.ParseInt(h.Get("ratelimit-limit"), 10, 64); err == nil {
+		rl.Limit = int(n)
+	}
+	if n, err := strconv.ParseInt(h.Get("ratelimit-remaining"), 10, 64); err == nil {
+		rl.Remaining = int(n)
+	}
+	return rl
+}
+
 type RatelimitInfo struct {
 	Limit     int
 	Remaining int
@@ -131,11 +184,47 @@ func makeParams(p map[string]any) string {
 	return params.Encode()
 }
 
-func (c *Client) Do(ctx context.Context, kind XRPCRequestType, inpenc string, method string, params map[string]interface{}, bodyobj interface{}, out interface{}) error {
+// Do sends a request, and decodes the response into out: a *bytes.Buffer for the raw body, or otherwise a value to decode JSON into. A bodyobj which is an io.Reader is sent as is (and streamed, without buffering it in memory); anything else is encoded as JSON.
+func (c *Client) Do(ctx context.Context, kind XRPCRequestType, inpenc string, method string, params map[string]interface{}, bodyobj interface{}, out interface{}) (err error) {
+	ctx, finish := c.startCall(ctx, method)
+	defer func() { finish(err) }()
+
+	_, streamBody := bodyobj.(io.Reader)
+	return c.doRetrying(ctx, kind, method, params, bodyobj, func(m, paramStr string, body io.Reader, bearer string) error {
+		return c.do(ctx, m, inpenc, method, paramStr, body, bearer, streamBody, out)
+	})
+}
+
+// DoStream is like Do, but returns the response body instead of decoding it, so large responses (like repo CAR files) can be processed without buffering them in memory. The caller must close the body. The client's HTTP timeout, if any, applies to reading the whole body; without a custom Client, there is none, so use the context to bound the request.
+func (c *Client) DoStream(ctx context.Context, kind XRPCRequestType, inpenc string, method string, params map[string]interface{}, bodyobj interface{}) (io.ReadCloser, error) {
+	ctx, finish := c.startCall(ctx, method)
+
+	var out io.ReadCloser
+	err := c.doRetrying(ctx, kind, method, params, bodyobj, func(m, paramStr string, body io.Reader, bearer string) error {
+		resp, err := c.send(ctx, m, inpenc, method, paramStr, body, bearer, true)
+		if err != nil {
+			return err
+		}
+		out = resp.Body
+		return nil
+	})
+	if err != nil {
+		finish(err)
+		return nil, err
+	}
+	// the call (and its timeout, if any) lasts until the body is closed
+	return &closeFunc{ReadCloser: out, fn: func() { finish(nil) }}, nil
+}
+
+// Encodes the request, and calls send (with the HTTP method, encoded parameters, body, and access token) until it succeeds, or fails in a way which isn't retried: refreshing an expired session first if there's an AuthManager, or after a delay according to the RetryPolicy.
+func (c *Client) doRetrying(ctx context.Context, kind XRPCRequestType, method string, params map[string]interface{}, bodyobj interface{}, send func(m, paramStr string, body io.Reader, bearer string) error) error {
 	var body io.Reader
+	// rewinds the body to send it again, after refreshing the session or to retry; nil if that's not possible
+	rewind := func() error { return nil }
 	if bodyobj != nil {
 		if rr, ok := bodyobj.(io.Reader); ok {
 			body = rr
+			rewind = rewinder(rr)
 		} else {
 			b, err := json.Marshal(bodyobj)
 			if err != nil {
@@ -143,6 +232,7 @@ func (c *Client) Do(ctx context.Context, kind XRPCRequestType, inpenc string, me
 			}
 
 			body = bytes.NewReader(b)
+			rewind = rewinder(body)
 		}
 	}
 
@@ -161,48 +251,51 @@ func (c *Client) Do(ctx context.Context, kind XRPCRequestType, inpenc string, me
 		paramStr = "?" + makeParams(params)
 	}
 
-	req, err := http.NewRequest(m, c.Host+"/xrpc/"+method+paramStr, body)
-	if err != nil {
-		return err
-	}
-
-	if bodyobj != nil && inpenc != "" {
-		req.Header.Set("Content-Type", inpenc)
-	}
-	if c.UserAgent != nil {
-		req.Header.Set("User-Agent", *c.UserAgent)
-	} else {
-		req.Header.Set("User-Agent", "indigo/"+versioninfo.Short())
-	}
+	refreshed := false
+	retries := 0
+	for {
+		bearer := c.accessJwt()
+		err := send(m, paramStr, body, bearer)
+		if err == nil || rewind == nil {
+			return err
+		}
 
-	if c.Headers != nil {
-		for k, v := range c.Headers {
-			req.Header.Set(k, v)
+		switch {
+		case c.AuthManager != nil && c.ServiceAuth == nil && !refreshed && isExpiredToken(err) && !c.useAdminAuth(method):
+			if err := c.AuthManager.refresh(ctx, c, bearer); err != nil {
+				return fmt.Errorf("refreshing expired session: %w", err)
+			}
+			refreshed = true
+		default:
+			wait, reason, ok := c.Retry.delay(ctx, kind, err, retries, time.Now())
+			if !ok {
+				return err
+			}
+			retries++
+			observeRetry(c.Host, method, reason)
+			if err := sleepCtx(ctx, wait); err != nil {
+				return err
+			}
+		}
+		if err := rewind(); err != nil {
+			return err
 		}
 	}
+}
 
-	// use admin auth if we have it configured and are doing a request that requires it
-	if c.AdminToken != nil && (strings.HasPrefix(method, "com.atproto.admin.") || method == "com.atproto.account.createInviteCode" || method == "com.atproto.server.createInviteCodes") {
-		req.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("admin:"+*c.AdminToken)))
-	} else if c.Auth != nil {
-		req.Header.Set("Authorization", "Bearer "+c.Auth.AccessJwt)
-	}
+// Whether admin auth is configured, and the method requires it.
+func (c *Client) useAdminAuth(method string) bool {
+	return c.AdminToken != nil && IsAdminMethod(method)
+}
 
-	resp, err := c.getClient().Do(req.WithContext(ctx))
+// Sends a single request, with the given bearer token (if any, and not using admin auth), and decodes the response into out.
+func (c *Client) do(ctx context.Context, m, inpenc, method, paramStr string, body io.Reader, bearer string, stream bool, out interface{}) error {
+	resp, err := c.send(ctx, m, inpenc, method, paramStr, body, bearer, stream)
 	if err != nil {
-		return fmt.Errorf("request failed: %w", err)
+		return err
 	}
-
 	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		var xe XRPCError
-		if err := json.NewDecoder(resp.Body).Decode(&xe); err != nil {
-			return errorFromHTTPResponse(resp, fmt.Errorf("failed to decode xrpc error message: %w", err))
-		}
-		return errorFromHTTPResponse(resp, &xe)
-	}
-
 	if out != nil {
 		if buf, ok := out.(*bytes.Buffer); ok {
 			if resp.ContentLength < 0 {
@@ -225,3 +318,115 @@ func (c *Client) Do(ctx context.Context, kind XRPCRequestType, inpenc string, me
 
 	return nil
 }
+
+// Sends a single request, with the given bearer token (if any, and not using admin auth). A response with a status other than 200 is returned as an error; otherwise, the caller must close the response body.
+func (c *Client) send(ctx context.Context, m, inpenc, method, paramStr string, body io.Reader, bearer string, stream bool) (*http.Response, error) {
+	req, err := http.NewRequest(m, c.Host+"/xrpc/"+method+paramStr, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil && inpenc != "" {
+		req.Header.Set("Content-Type", inpenc)
+	}
+	if err := c.setHeaders(ctx, req.Header, method, bearer); err != nil {
+		return nil, err
+	}
+
+	release := func() {}
+	if c.HostLimiter != nil {
+		release, err = c.HostLimiter.acquire(ctx, req.URL.Host)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	resp, err := c.getClient(stream).Do(req.WithContext(ctx))
+	observeRequest(req, method, start, resp)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+
+	if resp.StatusCode != 200 {
+		defer release()
+		defer resp.Body.Close()
+		var xe XRPCError
+		if err := json.NewDecoder(resp.Body).Decode(&xe); err != nil {
+			return nil, errorFromHTTPResponse(resp, fmt.Errorf("failed to decode xrpc error message: %w", err))
+		}
+		return nil, errorFromHTTPResponse(resp, &xe)
+	}
+
+	if observe := callOptionsFrom(ctx).observeRatelimit; observe != nil {
+		if rl := parseRatelimit(resp.Header); rl != nil {
+			observe(rl)
+		}
+	}
+
+	// the host limiter's slot is held until the body is closed
+	resp.Body = &closeFunc{ReadCloser: resp.Body, fn: release}
+	return resp, nil
+}
+
+// Sets the headers of a request: the user agent, the client's and call's headers, the service proxy, and authorization, with the given bearer token if no other auth applies.
+func (c *Client) setHeaders(ctx context.Context, h http.Header, method, bearer string) error {
+	if c.UserAgent != nil {
+		h.Set("User-Agent", *c.UserAgent)
+	} else {
+		h.Set("User-Agent", "indigo/"+versioninfo.Short())
+	}
+
+	if c.Headers != nil {
+		for k, v := range c.Headers {
+			h.Set(k, v)
+		}
+	}
+	for k, v := range callOptionsFrom(ctx).headers {
+		h.Set(k, v)
+	}
+
+	if proxy := c.serviceProxy(ctx); proxy != "" {
+		h.Set(ProxyHeader, proxy)
+	}
+
+	var authz string
+	if c.AuthProvider != nil {
+		var err error
+		authz, err = c.AuthProvider.Authorization(ctx, method)
+		if err != nil {
+			return fmt.Errorf("authorizing request: %w", err)
+		}
+	}
+	switch {
+	case authz != "":
+		h.Set("Authorization", authz)
+	case c.useAdminAuth(method):
+		// use admin auth if we have it configured and are doing a request that requires it
+		authz, _ = AdminAuth(*c.AdminToken).Authorization(ctx, method)
+		h.Set("Authorization", authz)
+	case c.ServiceAuth != nil:
+		authz, err := c.ServiceAuth.Authorization(ctx, method)
+		if err != nil {
+			return err
+		}
+		h.Set("Authorization", authz)
+	case bearer != "":
+		h.Set("Authorization", "Bearer "+bearer)
+	}
+	return nil
+}
+
+// Calls fn (once) when closed.
+type closeFunc struct {
+	io.ReadCloser
+	fn   func()
+	once sync.Once
+}
+
+func (r *closeFunc) Close() error {
+	err := r.ReadCloser.Close()
+	r.once.Do(r.fn)
+	return err
+}
@@ -1,7 +1,16 @@
 package xrpc
 
 import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
 )
 
 // TestMakeParams tests the makeParams function.
@@ -57,3 +66,129 @@ func TestMakeParams(t *testing.T) {
 		})
 	}
 }
+
+func TestClientMetrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ratelimit-limit", "100")
+		w.Header().Set("ratelimit-remaining", "42")
+		if r.URL.Path == "/xrpc/com.example.fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"InvalidRequest","message":"nope"}`))
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer srv.Close()
+
+	c := Client{Host: srv.URL}
+	host := strings.TrimPrefix(srv.URL, "http://")
+	ctx := context.Background()
+
+	if err := c.Do(ctx, Query, "", "com.example.ok", nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Do(ctx, Query, "", "com.example.fail", nil, nil, nil); err == nil {
+		t.Fatal("expected error")
+	}
+
+	if v := testutil.ToFloat64(clientRequests.WithLabelValues(host, "com.example.ok", "200")); v != 1 {
+		t.Errorf("expected 1 successful request, got %f", v)
+	}
+	if v := testutil.ToFloat64(clientRequests.WithLabelValues(host, "com.example.fail", "400")); v != 1 {
+		t.Errorf("expected 1 failed request, got %f", v)
+	}
+	if v := testutil.ToFloat64(clientRatelimitRemaining.WithLabelValues(host, "com.example.ok")); v != 42 {
+		t.Errorf("expected ratelimit remaining of 42, got %f", v)
+	}
+}
+
+func TestDoStream(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	const size = 1 << 20
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/xrpc/com.example.missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"NotFound","message":"no such thing"}`))
+			return
+		}
+		// echo the request body back, followed by some more data
+		n, _ := io.Copy(w, r.Body)
+		io.CopyN(w, zeroReader{}, size-n)
+	}))
+	defer srv.Close()
+
+	limiter := NewHostLimiter(1)
+	c := &Client{Host: srv.URL, HostLimiter: limiter}
+
+	body, err := c.DoStream(ctx, Procedure, "*/*", "com.example.echo", nil, strings.NewReader("hello"))
+	assert.NoError(err)
+	prefix := make([]byte, 5)
+	_, err = io.ReadFull(body, prefix)
+	assert.NoError(err)
+	assert.Equal("hello", string(prefix))
+	n, err := io.Copy(io.Discard, body)
+	assert.NoError(err)
+	assert.Equal(int64(size-5), n)
+
+	// the limiter slot is held until the body is closed
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	_, err = c.DoStream(tctx, Query, "", "com.example.echo", nil, nil)
+	cancel()
+	assert.ErrorIs(err, context.DeadlineExceeded)
+	assert.NoError(body.Close())
+
+	_, err = c.DoStream(ctx, Query, "", "com.example.missing", nil, nil)
+	var xe *Error
+	assert.ErrorAs(err, &xe)
+	assert.Equal(http.StatusNotFound, xe.StatusCode)
+
+	// error responses release the limiter slot
+	body, err = c.DoStream(ctx, Query, "", "com.example.echo", nil, nil)
+	assert.NoError(err)
+	assert.NoError(body.Close())
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestErrorResponse(t *testing.T) {
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/xrpc/com.example.missing":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"RepoNotFound","message":"Could not find repo: did:plc:abc"}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`<html>bad gateway</html>`))
+		}
+	}))
+	defer srv.Close()
+	c := &Client{Host: srv.URL, Client: http.DefaultClient}
+
+	err := c.Do(ctx, Query, "", "com.example.missing", nil, nil, nil)
+	var xe *Error
+	assert.ErrorAs(err, &xe)
+	assert.Equal(http.StatusBadRequest, xe.StatusCode)
+	assert.Equal("RepoNotFound", xe.Name)
+	assert.Equal("Could not find repo: did:plc:abc", xe.Message)
+	assert.True(IsErrorName(err, ErrNameRepoNotFound))
+	assert.False(IsErrorName(err, ErrNameRecordNotFound))
+	assert.Equal("XRPC ERROR 400: RepoNotFound: Could not find repo: did:plc:abc", err.Error())
+
+	// still an *Error without the standard fields
+	err = c.Do(ctx, Query, "", "com.example.broken", nil, nil, nil)
+	assert.Equal(http.StatusBadGateway, StatusCode(err))
+	assert.Equal("", ErrorName(err))
+	assert.False(IsErrorName(err, ""))
+
+	assert.Equal(0, StatusCode(io.EOF))
+}